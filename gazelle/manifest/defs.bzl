@@ -27,6 +27,9 @@ def gazelle_python_manifest(
         pip_repository_name = "",
         pip_deps_repository_name = "",
         manifest = ":gazelle_python.yaml",
+        licenses = None,
+        entry_points = None,
+        extras = None,
         **kwargs):
     """A macro for defining the updating and testing targets for the Gazelle manifest file.
 
@@ -42,6 +45,20 @@ def gazelle_python_manifest(
         pip_deps_repository_name: deprecated - the old {bzl:obj}`pip_parse` target name.
         manifest: the Gazelle manifest file.
             defaults to the same value as manifest.
+        licenses: the target for the licenses.json file generated by
+            modules_mapping when include_licenses is set, e.g. a filegroup
+            with output_group = "licenses". If set, the licenses of the
+            distributions are added to the manifest.
+        entry_points: the target for the entry_points.json file generated by
+            modules_mapping when include_entry_points is set, e.g. a filegroup
+            with output_group = "entry_points". If set, the modules of the
+            console and GUI scripts of the distributions are added to the
+            manifest.
+        extras: the target for the extras.json file generated by
+            modules_mapping when include_extras is set, e.g. a filegroup with
+            output_group = "extras". If set, the distributions required by the
+            extras requested in the requirements, e.g. requests[socks], are
+            added to the manifest. Requires requirements.
         **kwargs: other bazel attributes passed to the generate and test targets
             generated by this macro.
     """
@@ -57,6 +74,9 @@ def gazelle_python_manifest(
         # This is a temporary check while pip_deps_repository_name exists as deprecated.
         fail("pip_repository_name must be set in //{}:{}".format(native.package_name(), name))
 
+    if extras and not requirements:
+        fail("requirements must be set with extras in //{}:{}".format(native.package_name(), name))
+
     test_target = "{}.test".format(name)
     update_target = "{}.update".format(name)
     update_target_label = "//{}:{}".format(native.package_name(), update_target)
@@ -85,6 +105,12 @@ def gazelle_python_manifest(
         "--output=$(execpath {})".format(generated_manifest),
         "--update-target={}".format(update_target_label),
     ]
+    if licenses:
+        update_args.append("--licenses=$(execpath {})".format(licenses))
+    if entry_points:
+        update_args.append("--entry-points=$(execpath {})".format(entry_points))
+    if extras:
+        update_args.append("--extras=$(execpath {})".format(extras))
 
     native.genrule(
         name = manifest_genrule,
@@ -94,7 +120,7 @@ def gazelle_python_manifest(
         srcs = [
             modules_mapping,
             manifest_generator_hash,
-        ] + ([requirements] if requirements else []),
+        ] + ([requirements] if requirements else []) + ([licenses] if licenses else []) + ([entry_points] if entry_points else []) + ([extras] if extras else []),
         tags = ["manual"],
     )
 
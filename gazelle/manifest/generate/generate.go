@@ -21,11 +21,13 @@ generating the Bazel BUILD files.
 package main
 
 import (
+	"bufio"
 	"encoding/json"
 	"flag"
 	"fmt"
 	"log"
 	"os"
+	"regexp"
 	"strings"
 
 	"github.com/bazel-contrib/rules_python/gazelle/manifest"
@@ -37,6 +39,9 @@ func main() {
 		requirementsPath          string
 		pipRepositoryName         string
 		modulesMappingPath        string
+		licensesPath              string
+		entryPointsPath           string
+		extrasPath                string
 		outputPath                string
 		updateTarget              string
 	)
@@ -61,6 +66,21 @@ func main() {
 		"modules-mapping",
 		"",
 		"The modules_mapping.json file.")
+	flag.StringVar(
+		&licensesPath,
+		"licenses",
+		"",
+		"The licenses.json file, optional.")
+	flag.StringVar(
+		&entryPointsPath,
+		"entry-points",
+		"",
+		"The entry_points.json file, optional.")
+	flag.StringVar(
+		&extrasPath,
+		"extras",
+		"",
+		"The extras.json file, optional. Requires --requirements.")
 	flag.StringVar(
 		&outputPath,
 		"output",
@@ -90,6 +110,35 @@ func main() {
 		log.Fatalf("ERROR: %v\n", err)
 	}
 
+	var licenses map[string][]string
+	if licensesPath != "" {
+		if err := unmarshalJSONInto(licensesPath, &licenses); err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+	}
+
+	var entryPoints map[string]string
+	if entryPointsPath != "" {
+		if entryPoints, err = unmarshalJSON(entryPointsPath); err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+	}
+
+	var extras map[string]map[string][]string
+	if extrasPath != "" {
+		if requirementsPath == "" {
+			log.Fatalln("ERROR: --requirements must be set with --extras")
+		}
+		if err := unmarshalJSONInto(extrasPath, &extras); err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		requested, err := requestedExtras(requirementsPath)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		extras = filterExtras(extras, requested)
+	}
+
 	header := generateHeader(updateTarget)
 	repository := manifest.PipRepository{
 		Name: pipRepositoryName,
@@ -98,6 +147,9 @@ func main() {
 	manifestFile := manifest.NewFile(&manifest.Manifest{
 		ModulesMapping: modulesMapping,
 		PipRepository:  &repository,
+		Licenses:       licenses,
+		EntryPoints:    entryPoints,
+		Extras:         extras,
 	})
 	if err := writeOutput(
 		outputPath,
@@ -112,19 +164,91 @@ func main() {
 
 // unmarshalJSON returns the parsed mapping from the given JSON file path.
 func unmarshalJSON(jsonPath string) (map[string]string, error) {
+	output := make(map[string]string)
+	if err := unmarshalJSONInto(jsonPath, &output); err != nil {
+		return nil, err
+	}
+	return output, nil
+}
+
+// unmarshalJSONInto parses the given JSON file path into output.
+func unmarshalJSONInto(jsonPath string, output interface{}) error {
 	file, err := os.Open(jsonPath)
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
+		return fmt.Errorf("failed to unmarshal JSON file: %w", err)
 	}
 	defer file.Close()
 
 	decoder := json.NewDecoder(file)
-	output := make(map[string]string)
-	if err := decoder.Decode(&output); err != nil {
-		return nil, fmt.Errorf("failed to unmarshal JSON file: %w", err)
+	if err := decoder.Decode(output); err != nil {
+		return fmt.Errorf("failed to unmarshal JSON file: %w", err)
 	}
 
-	return output, nil
+	return nil
+}
+
+// requirementExtrasRegexp matches the distribution name and the extras of a
+// requirement, e.g. "requests[socks]==2.31.0".
+var requirementExtrasRegexp = regexp.MustCompile(`^\s*([A-Za-z0-9][A-Za-z0-9._-]*)\s*\[([^\]]*)\]`)
+
+// distributionNameSeparatorsRegexp matches the runs of separators in the
+// distribution names, normalized by normalizeDistributionName.
+var distributionNameSeparatorsRegexp = regexp.MustCompile(`[-_.]+`)
+
+// normalizeDistributionName returns the name of the distribution normalized
+// per PEP 503, so that "PyYAML" and "pyyaml" match.
+func normalizeDistributionName(name string) string {
+	return distributionNameSeparatorsRegexp.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// requestedExtras returns the extras requested in the requirements file, by
+// normalized distribution name.
+func requestedExtras(requirementsPath string) (map[string]map[string]bool, error) {
+	file, err := os.Open(requirementsPath)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the requested extras: %w", err)
+	}
+	defer file.Close()
+
+	requested := make(map[string]map[string]bool)
+	scanner := bufio.NewScanner(file)
+	for scanner.Scan() {
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		match := requirementExtrasRegexp.FindStringSubmatch(line)
+		if match == nil {
+			continue
+		}
+		name := normalizeDistributionName(match[1])
+		for _, extra := range strings.Split(match[2], ",") {
+			if extra = strings.TrimSpace(extra); extra != "" {
+				if requested[name] == nil {
+					requested[name] = make(map[string]bool)
+				}
+				requested[name][normalizeDistributionName(extra)] = true
+			}
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("failed to read the requested extras: %w", err)
+	}
+	return requested, nil
+}
+
+// filterExtras returns the extras of the wheels that are requested.
+func filterExtras(extras map[string]map[string][]string, requested map[string]map[string]bool) map[string]map[string][]string {
+	filtered := make(map[string]map[string][]string)
+	for wheel, wheelExtras := range extras {
+		for extra, distributions := range wheelExtras {
+			if !requested[normalizeDistributionName(wheel)][normalizeDistributionName(extra)] {
+				continue
+			}
+			if filtered[wheel] == nil {
+				filtered[wheel] = make(map[string][]string)
+			}
+			filtered[wheel][extra] = distributions
+		}
+	}
+	return filtered
 }
 
 // generateHeader generates the YAML header human-readable comment.
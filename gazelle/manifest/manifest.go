@@ -151,6 +151,16 @@ type Manifest struct {
 	// PipRepository contains the information for pip_parse or pip_repository
 	// target.
 	PipRepository *PipRepository `yaml:"pip_repository,omitempty"`
+	// Licenses maps the Python wheel names to their licenses, from their
+	// "License ::" classifiers or their License-Expression.
+	Licenses map[string][]string `yaml:"licenses,omitempty"`
+	// EntryPoints is the mapping from the modules of the console and GUI
+	// scripts declared in the entry points of the Python wheels to the wheel
+	// names, for the modules missing from ModulesMapping.
+	EntryPoints ModulesMapping `yaml:"entry_points,omitempty"`
+	// Extras maps the Python wheel names to their extras requested in the
+	// requirements, and these to the names of the distributions they require.
+	Extras map[string]map[string][]string `yaml:"extras,omitempty"`
 }
 
 type PipRepository struct {
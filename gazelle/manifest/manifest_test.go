@@ -97,4 +97,100 @@ func TestFile(t *testing.T) {
 			t.FailNow()
 		}
 	})
+	t.Run("EncodeWithLicenses", func(t *testing.T) {
+		licenses := map[string][]string{
+			"arrow": {"Apache Software License"},
+		}
+		f := manifest.NewFile(&manifest.Manifest{
+			ModulesMapping: modulesMapping,
+			Licenses:       licenses,
+		})
+		var b bytes.Buffer
+		if err := f.EncodeWithoutIntegrity(&b); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if !strings.Contains(b.String(), "  licenses:\n    arrow:\n    - Apache Software License\n") {
+			log.Printf("encoded manifest doesn't contain the licenses: %v\n", b.String())
+			t.FailNow()
+		}
+		path := t.TempDir() + "/gazelle_python.yaml"
+		if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		decoded := manifest.NewFile(&manifest.Manifest{})
+		if err := decoded.Decode(path); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(licenses, decoded.Manifest.Licenses) {
+			log.Println("decoded licenses don't match expected value")
+			t.FailNow()
+		}
+	})
+	t.Run("EncodeWithEntryPoints", func(t *testing.T) {
+		entryPoints := manifest.ModulesMapping{
+			"awscli_wrapper.main": "awscli",
+		}
+		f := manifest.NewFile(&manifest.Manifest{
+			ModulesMapping: modulesMapping,
+			EntryPoints:    entryPoints,
+		})
+		var b bytes.Buffer
+		if err := f.EncodeWithoutIntegrity(&b); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if !strings.Contains(b.String(), "  entry_points:\n    awscli_wrapper.main: awscli\n") {
+			log.Printf("encoded manifest doesn't contain the entry points: %v\n", b.String())
+			t.FailNow()
+		}
+		path := t.TempDir() + "/gazelle_python.yaml"
+		if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		decoded := manifest.NewFile(&manifest.Manifest{})
+		if err := decoded.Decode(path); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(entryPoints, decoded.Manifest.EntryPoints) {
+			log.Println("decoded entry points don't match expected value")
+			t.FailNow()
+		}
+	})
+	t.Run("EncodeWithExtras", func(t *testing.T) {
+		extras := map[string]map[string][]string{
+			"requests": {"socks": {"PySocks"}},
+		}
+		f := manifest.NewFile(&manifest.Manifest{
+			ModulesMapping: modulesMapping,
+			Extras:         extras,
+		})
+		var b bytes.Buffer
+		if err := f.EncodeWithoutIntegrity(&b); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if !strings.Contains(b.String(), "  extras:\n    requests:\n      socks:\n      - PySocks\n") {
+			log.Printf("encoded manifest doesn't contain the extras: %v\n", b.String())
+			t.FailNow()
+		}
+		path := t.TempDir() + "/gazelle_python.yaml"
+		if err := os.WriteFile(path, b.Bytes(), 0o644); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		decoded := manifest.NewFile(&manifest.Manifest{})
+		if err := decoded.Decode(path); err != nil {
+			log.Println(err)
+			t.FailNow()
+		}
+		if !reflect.DeepEqual(extras, decoded.Manifest.Extras) {
+			log.Println("decoded extras don't match expected value")
+			t.FailNow()
+		}
+	})
 }
@@ -30,21 +30,52 @@ def _modules_mapping_impl(ctx):
         transitive = [dep[DefaultInfo].files for dep in ctx.attr.wheels] + [dep[DefaultInfo].data_runfiles.files for dep in ctx.attr.wheels],
     )
 
+    licenses = None
+    if ctx.attr.include_licenses:
+        licenses = ctx.actions.declare_file(ctx.attr.licenses_name)
+
+    entry_points = None
+    if ctx.attr.include_entry_points:
+        entry_points = ctx.actions.declare_file(ctx.attr.entry_points_name)
+
+    extras = None
+    if ctx.attr.include_extras:
+        extras = ctx.actions.declare_file(ctx.attr.extras_name)
+
     # Run the generator once per-wheel (to leverage caching)
     per_wheel_outputs = []
+    per_wheel_licenses = []
+    per_wheel_entry_points = []
+    per_wheel_extras = []
     for idx, whl in enumerate(all_wheels.to_list()):
         wheel_modules_mapping = ctx.actions.declare_file("{}.{}".format(modules_mapping.short_path, idx))
+        outputs = [wheel_modules_mapping]
         args = ctx.actions.args()
         args.add("--output_file", wheel_modules_mapping.path)
         if ctx.attr.include_stub_packages:
             args.add("--include_stub_packages")
+        if licenses:
+            wheel_licenses = ctx.actions.declare_file("{}.{}".format(licenses.short_path, idx))
+            args.add("--licenses_output_file", wheel_licenses.path)
+            outputs.append(wheel_licenses)
+            per_wheel_licenses.append(wheel_licenses)
+        if entry_points:
+            wheel_entry_points = ctx.actions.declare_file("{}.{}".format(entry_points.short_path, idx))
+            args.add("--entry_points_output_file", wheel_entry_points.path)
+            outputs.append(wheel_entry_points)
+            per_wheel_entry_points.append(wheel_entry_points)
+        if extras:
+            wheel_extras = ctx.actions.declare_file("{}.{}".format(extras.short_path, idx))
+            args.add("--extras_output_file", wheel_extras.path)
+            outputs.append(wheel_extras)
+            per_wheel_extras.append(wheel_extras)
         args.add_all("--exclude_patterns", ctx.attr.exclude_patterns)
         args.add("--wheel", whl.path)
 
         ctx.actions.run(
             inputs = [whl],
             mnemonic = "PyGazelleModMapGen",
-            outputs = [wheel_modules_mapping],
+            outputs = outputs,
             executable = ctx.executable._generator,
             arguments = [args],
             use_default_shell_env = False,
@@ -65,21 +96,82 @@ def _modules_mapping_impl(ctx):
         use_default_shell_env = False,
     )
 
-    return [DefaultInfo(files = depset([modules_mapping]))]
+    output_groups = {}
+
+    # The licenses, the entry points and the extras are merged the same way as
+    # the modules mappings.
+    if licenses:
+        _merge(ctx, licenses, per_wheel_licenses, "PyGazelleLicensesMerge")
+        output_groups["licenses"] = depset([licenses])
+    if entry_points:
+        _merge(ctx, entry_points, per_wheel_entry_points, "PyGazelleEntryPointsMerge")
+        output_groups["entry_points"] = depset([entry_points])
+    if extras:
+        _merge(ctx, extras, per_wheel_extras, "PyGazelleExtrasMerge")
+        output_groups["extras"] = depset([extras])
+
+    return [
+        DefaultInfo(files = depset([modules_mapping])),
+        OutputGroupInfo(**output_groups),
+    ]
+
+def _merge(ctx, output, inputs, mnemonic):
+    merge_args = ctx.actions.args()
+    merge_args.add("--output", output.path)
+    merge_args.add_all("--inputs", [f.path for f in inputs])
+
+    ctx.actions.run(
+        inputs = inputs,
+        mnemonic = mnemonic,
+        outputs = [output],
+        executable = ctx.executable._merger,
+        arguments = [merge_args],
+        use_default_shell_env = False,
+    )
 
 modules_mapping = rule(
     _modules_mapping_impl,
     attrs = {
+        "entry_points_name": attr.string(
+            default = "entry_points.json",
+            doc = "The name for the output JSON file of the entry points, when include_entry_points is set.",
+            mandatory = False,
+        ),
         "exclude_patterns": attr.string_list(
             default = ["^_|(\\._)+"],
             doc = "A set of regex patterns to match against each calculated module path. By default, exclude the modules starting with underscores.",
             mandatory = False,
         ),
+        "extras_name": attr.string(
+            default = "extras.json",
+            doc = "The name for the output JSON file of the extras, when include_extras is set.",
+            mandatory = False,
+        ),
+        "include_entry_points": attr.bool(
+            default = False,
+            doc = "Whether to also generate a JSON file mapping the modules of the console and GUI scripts of the wheels to the wheel names, available in the 'entry_points' output group.",
+            mandatory = False,
+        ),
+        "include_extras": attr.bool(
+            default = False,
+            doc = "Whether to also generate a JSON file mapping the wheel names to the distributions required by each of their extras, available in the 'extras' output group.",
+            mandatory = False,
+        ),
+        "include_licenses": attr.bool(
+            default = False,
+            doc = "Whether to also generate a JSON file mapping the wheel names to their licenses, available in the 'licenses' output group.",
+            mandatory = False,
+        ),
         "include_stub_packages": attr.bool(
             default = False,
             doc = "Whether to include stub packages in the mapping.",
             mandatory = False,
         ),
+        "licenses_name": attr.string(
+            default = "licenses.json",
+            doc = "The name for the output JSON file of the licenses, when include_licenses is set.",
+            mandatory = False,
+        ),
         "modules_mapping_name": attr.string(
             default = "modules_mapping.json",
             doc = "The name for the output JSON file.",
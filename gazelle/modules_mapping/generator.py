@@ -13,6 +13,8 @@
 # limitations under the License.
 
 import argparse
+import configparser
+import email.parser
 import json
 import pathlib
 import re
@@ -26,12 +28,27 @@ class Generator:
     output_file = None
     excluded_patterns = None
 
-    def __init__(self, stderr, output_file, excluded_patterns, include_stub_packages):
+    def __init__(
+        self,
+        stderr,
+        output_file,
+        excluded_patterns,
+        include_stub_packages,
+        licenses_output_file=None,
+        entry_points_output_file=None,
+        extras_output_file=None,
+    ):
         self.stderr = stderr
         self.output_file = output_file
         self.excluded_patterns = [re.compile(pattern) for pattern in excluded_patterns]
         self.include_stub_packages = include_stub_packages
+        self.licenses_output_file = licenses_output_file
+        self.entry_points_output_file = entry_points_output_file
+        self.extras_output_file = extras_output_file
         self.mapping = {}
+        self.licenses = {}
+        self.entry_points = {}
+        self.extras = {}
 
     # dig_wheel analyses the wheel .whl file determining the modules it provides
     # by looking at the directory structure.
@@ -46,6 +63,11 @@ class Generator:
             return
         with zipfile.ZipFile(whl, "r") as zip_file:
             for path in zip_file.namelist():
+                if is_dist_info_metadata(path):
+                    self.licenses_for_metadata(zip_file.read(path), whl)
+                    self.extras_for_metadata(zip_file.read(path), whl)
+                if is_dist_info_entry_points(path):
+                    self.modules_for_entry_points(zip_file.read(path), whl)
                 if is_metadata(path):
                     if data_has_purelib_or_platlib(path):
                         self.module_for_path(path, whl)
@@ -98,6 +120,54 @@ class Generator:
             if not self.is_excluded(module):
                 self.mapping[module] = wheel_name
 
+    # licenses_for_metadata records the licenses of the wheel declared in its
+    # METADATA file: the last part of its "License ::" classifiers, or its
+    # License-Expression when it has no such classifier.
+    def licenses_for_metadata(self, data, whl):
+        metadata = email.parser.BytesHeaderParser().parsebytes(data)
+        licenses = set()
+        for classifier in metadata.get_all("Classifier", []):
+            parts = [part.strip() for part in classifier.split("::")]
+            if len(parts) > 1 and parts[0] == "License":
+                licenses.add(parts[-1])
+        if not licenses and metadata.get("License-Expression"):
+            licenses.add(metadata.get("License-Expression").strip())
+        if licenses:
+            self.licenses[get_wheel_name(whl)] = sorted(licenses)
+
+    # extras_for_metadata records the distributions required by each extra of
+    # the wheel, declared in its METADATA file, e.g. "PySocks" for the "socks"
+    # extra of "Requires-Dist: PySocks>=1.5.6; extra == 'socks'".
+    def extras_for_metadata(self, data, whl):
+        metadata = email.parser.BytesHeaderParser().parsebytes(data)
+        extras = {}
+        for requirement in metadata.get_all("Requires-Dist", []):
+            name = REQUIREMENT_NAME.match(requirement)
+            _, _, marker = requirement.partition(";")
+            extra = EXTRA_MARKER.search(marker)
+            if name and extra:
+                extras.setdefault(extra.group(1), set()).add(name.group(1))
+        if extras:
+            self.extras[get_wheel_name(whl)] = {
+                extra: sorted(names) for extra, names in extras.items()
+            }
+
+    # modules_for_entry_points records the modules of the console and GUI
+    # scripts declared in the entry_points.txt file of the wheel, e.g. "pkg.cli"
+    # for "tool = pkg.cli:main".
+    def modules_for_entry_points(self, data, whl):
+        parser = configparser.ConfigParser(delimiters=("=",), interpolation=None)
+        parser.optionxform = str
+        parser.read_string(data.decode("utf-8"))
+        wheel_name = get_wheel_name(whl)
+        for section in ("console_scripts", "gui_scripts"):
+            if not parser.has_section(section):
+                continue
+            for _, value in parser.items(section):
+                module = value.split(":", 1)[0].strip()
+                if module and not self.is_excluded(module):
+                    self.entry_points[module] = wheel_name
+
     def is_excluded(self, module):
         for pattern in self.excluded_patterns:
             if pattern.search(module):
@@ -122,9 +192,26 @@ class Generator:
         mapping_json = json.dumps(self.mapping)
         with open(self.output_file, "w") as f:
             f.write(mapping_json)
+        if self.licenses_output_file:
+            with open(self.licenses_output_file, "w") as f:
+                f.write(json.dumps(self.licenses))
+        if self.entry_points_output_file:
+            with open(self.entry_points_output_file, "w") as f:
+                f.write(json.dumps(self.entry_points))
+        if self.extras_output_file:
+            with open(self.extras_output_file, "w") as f:
+                f.write(json.dumps(self.extras))
         return 0
 
 
+# REQUIREMENT_NAME matches the distribution name of a requirement.
+# Ref: https://packaging.python.org/en/latest/specifications/dependency-specifiers/.
+REQUIREMENT_NAME = re.compile(r"\s*([A-Za-z0-9][A-Za-z0-9._-]*)")
+
+# EXTRA_MARKER matches the extra of the environment marker of a requirement.
+EXTRA_MARKER = re.compile(r"\bextra\s*==\s*[\"']([^\"']+)[\"']")
+
+
 def get_wheel_name(path):
     pp = pathlib.PurePath(path)
     if pp.suffix != ".whl":
@@ -144,6 +231,29 @@ def is_metadata(path):
     return top_level.endswith(".dist-info") or top_level.endswith(".data")
 
 
+# is_dist_info_metadata checks if the path is the METADATA file of the wheel.
+# Ref: https://packaging.python.org/en/latest/specifications/core-metadata/.
+def is_dist_info_metadata(path):
+    parts = path.split("/")
+    return (
+        len(parts) == 2
+        and parts[0].lower().endswith(".dist-info")
+        and parts[1] == "METADATA"
+    )
+
+
+# is_dist_info_entry_points checks if the path is the entry_points.txt file of
+# the wheel.
+# Ref: https://packaging.python.org/en/latest/specifications/entry-points/.
+def is_dist_info_entry_points(path):
+    parts = path.split("/")
+    return (
+        len(parts) == 2
+        and parts[0].lower().endswith(".dist-info")
+        and parts[1] == "entry_points.txt"
+    )
+
+
 # The .data is allowed to contain a full purelib or platlib directory
 # These get unpacked into site-packages, so require indexing too.
 # This is the same if "Root-Is-Purelib: true" is set and the files are at the root.
@@ -161,9 +271,18 @@ if __name__ == "__main__":
     parser.add_argument("--output_file", type=str)
     parser.add_argument("--include_stub_packages", action="store_true")
     parser.add_argument("--exclude_patterns", nargs="+", default=[])
+    parser.add_argument("--licenses_output_file", type=str)
+    parser.add_argument("--entry_points_output_file", type=str)
+    parser.add_argument("--extras_output_file", type=str)
     parser.add_argument("--wheel", type=pathlib.Path)
     args = parser.parse_args()
     generator = Generator(
-        sys.stderr, args.output_file, args.exclude_patterns, args.include_stub_packages
+        sys.stderr,
+        args.output_file,
+        args.exclude_patterns,
+        args.include_stub_packages,
+        args.licenses_output_file,
+        args.entry_points_output_file,
+        args.extras_output_file,
     )
     sys.exit(generator.run(args.wheel))
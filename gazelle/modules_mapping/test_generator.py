@@ -1,5 +1,7 @@
 import pathlib
+import tempfile
 import unittest
+import zipfile
 
 from generator import Generator
 
@@ -19,6 +21,66 @@ class GeneratorTest(unittest.TestCase):
             gen.mapping.items(),
         )
 
+    def test_licenses(self):
+        whl = pathlib.Path(__file__).parent / "pytest-8.3.3-py3-none-any.whl"
+        gen = Generator(None, None, {}, False)
+        gen.dig_wheel(whl)
+        self.assertEqual({"pytest": ["MIT License"]}, gen.licenses)
+
+    def test_entry_points(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            whl = pathlib.Path(tmp) / "awscli-1.32.0-py3-none-any.whl"
+            with zipfile.ZipFile(whl, "w") as zip_file:
+                zip_file.writestr("awscli/__init__.py", "")
+                zip_file.writestr(
+                    "awscli-1.32.0.dist-info/entry_points.txt",
+                    "[console_scripts]\n"
+                    + "aws = awscli_wrapper.main:main\n"
+                    + "aws_completer = awscli.completer:complete\n"
+                    + "\n"
+                    + "[gui_scripts]\n"
+                    + "aws-gui = awscli_gui\n"
+                    + "\n"
+                    + "[awscli.plugins]\n"
+                    + "s3 = awscli_s3.plugin:register\n",
+                )
+            gen = Generator(None, None, {}, False)
+            gen.dig_wheel(whl)
+        self.assertEqual(
+            {
+                "awscli_wrapper.main": "awscli",
+                "awscli.completer": "awscli",
+                "awscli_gui": "awscli",
+            },
+            gen.entry_points,
+        )
+
+    def test_extras(self):
+        with tempfile.TemporaryDirectory() as tmp:
+            whl = pathlib.Path(tmp) / "requests-2.31.0-py3-none-any.whl"
+            with zipfile.ZipFile(whl, "w") as zip_file:
+                zip_file.writestr("requests/__init__.py", "")
+                zip_file.writestr(
+                    "requests-2.31.0.dist-info/METADATA",
+                    "Metadata-Version: 2.1\n"
+                    + "Name: requests\n"
+                    + "Requires-Dist: idna<4,>=2.5\n"
+                    + "Requires-Dist: PySocks!=1.5.7,>=1.5.6; extra == 'socks'\n"
+                    + 'Requires-Dist: chardet<6,>=3.0.2; extra == "use_chardet_on_py3"\n'
+                    + 'Requires-Dist: win-inet-pton; sys_platform == "win32" and extra == "socks"\n',
+                )
+            gen = Generator(None, None, {}, False)
+            gen.dig_wheel(whl)
+        self.assertEqual(
+            {
+                "requests": {
+                    "socks": ["PySocks", "win-inet-pton"],
+                    "use_chardet_on_py3": ["chardet"],
+                },
+            },
+            gen.extras,
+        )
+
     def test_stub_generator(self):
         whl = pathlib.Path(__file__).parent / "django_types-0.19.1-py3-none-any.whl"
         gen = Generator(None, None, {}, True)
@@ -0,0 +1,87 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// packageLibrary is an indexed py_library target of a Python package.
+type packageLibrary struct {
+	target label.Label
+	srcs   int
+	// init is set when the target includes the __init__.py file of the
+	// package.
+	init bool
+}
+
+// addPackageLibrary records the py_library target as a library of the Python
+// package of its Bazel package, and of the packages whose __init__.py files
+// are among its sources, by directory relative to the repository root.
+func (py *Resolver) addPackageLibrary(target label.Label, r *rule.Rule) {
+	if r.Kind() != pyLibraryKind {
+		return
+	}
+	if py.packageLibraries == nil {
+		py.packageLibraries = make(map[string][]packageLibrary)
+	}
+	srcs := ruleSrcs(r)
+	libraries := map[string]packageLibrary{
+		target.Pkg: {target: target, srcs: len(srcs)},
+	}
+	for _, src := range srcs {
+		if path.Base(src) == pyLibraryEntrypointFilename {
+			dir := path.Join(target.Pkg, path.Dir(src))
+			libraries[dir] = packageLibrary{target: target, srcs: len(srcs), init: true}
+		}
+	}
+	for dir, library := range libraries {
+		py.packageLibraries[dir] = append(py.packageLibraries[dir], library)
+	}
+}
+
+// findAncestorPackage returns the library of the deepest Python package among
+// the modules, relative to the Python project root, and the module of that
+// package. The libraries including the __init__.py file of the package are
+// preferred to the other libraries of its Bazel package, e.g. when its
+// __init__.py file is empty with python_generation_mode file, then the ones
+// with the fewest sources and the first by label. The index is complete once
+// the rules are resolved, so it's safe to read concurrently.
+func (py *Resolver) findAncestorPackage(pythonProjectRoot string, modules []string) (label.Label, string, bool) {
+	for _, module := range modules {
+		libraries := py.packageLibraries[path.Join(pythonProjectRoot, strings.ReplaceAll(module, ".", "/"))]
+		if len(libraries) == 0 {
+			continue
+		}
+		best := libraries[0]
+		for _, library := range libraries[1:] {
+			if library.init != best.init {
+				if library.init {
+					best = library
+				}
+				continue
+			}
+			if library.srcs < best.srcs || (library.srcs == best.srcs && library.target.String() < best.target.String()) {
+				best = library
+			}
+		}
+		return best.target, module, true
+	}
+	return label.NoLabel, "", false
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindAncestorPackage(t *testing.T) {
+	py := &Resolver{}
+	library := func(pkg, name string, srcs ...string) {
+		r := rule.NewRule(pyLibraryKind, name)
+		r.SetAttr("srcs", srcs)
+		py.addPackageLibrary(label.New("", pkg, name), r)
+	}
+	// The libraries of a package whose empty __init__.py file is dropped.
+	library("src/plugins", "registry", "registry.py", "formats.py")
+	library("src/plugins", "loader", "loader.py")
+	// The library including the __init__.py file is preferred.
+	library("src/plugins/formats", "base", "base.py")
+	library("src/plugins/formats", "formats", "__init__.py", "csv.py", "json.py")
+	// A library including the __init__.py file of a subdirectory.
+	library("src/vendored", "vendored", "six/__init__.py", "six/moves.py")
+	binary := rule.NewRule(pyBinaryKind, "tool")
+	binary.SetAttr("srcs", []string{"__init__.py"})
+	py.addPackageLibrary(label.New("", "src/tools", "tool"), binary)
+
+	tests := []struct {
+		modules []string
+		target  string
+		module  string
+	}{
+		{modules: []string{"plugins.csv_reader", "plugins"}, target: "//src/plugins:loader", module: "plugins"},
+		{modules: []string{"plugins.formats.yaml", "plugins.formats", "plugins"}, target: "//src/plugins/formats", module: "plugins.formats"},
+		{modules: []string{"vendored.six.moves.urllib", "vendored.six.moves", "vendored.six", "vendored"}, target: "//src/vendored", module: "vendored.six"},
+		{modules: []string{"tools.cli", "tools"}},
+		{modules: []string{"unknown"}},
+	}
+	for _, tt := range tests {
+		target, module, ok := py.findAncestorPackage("src", tt.modules)
+		assert.Equal(t, tt.target != "", ok, tt.modules)
+		if ok {
+			assert.Equal(t, tt.target, target.String(), tt.modules)
+		}
+		assert.Equal(t, tt.module, module, tt.modules)
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// loadBazelIgnore returns the directories listed in the .bazelignore file of
+// the repository, relative to its root. Like Bazel, glob patterns aren't
+// supported, so they're skipped.
+func loadBazelIgnore(repoRoot string) ([]string, error) {
+	data, err := os.ReadFile(filepath.Join(repoRoot, ".bazelignore"))
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to read .bazelignore: %w", err)
+	}
+	var dirs []string
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") || strings.ContainsAny(line, "*?[") {
+			continue
+		}
+		dirs = append(dirs, path.Clean(line))
+	}
+	return dirs, nil
+}
+
+// ignoredDirectory returns the directory listed in .bazelignore that contains
+// the package of the first-party target, if any. Bazel can't build the
+// targets of these directories, so the imports resolving to them don't get a
+// dependency.
+func (py *Resolver) ignoredDirectory(target, from label.Label) (string, bool) {
+	if target.Repo != "" && target.Repo != from.Repo {
+		return "", false
+	}
+	for _, dir := range py.bazelIgnoredDirs {
+		if target.Pkg == dir || strings.HasPrefix(target.Pkg, dir+"/") {
+			return dir, true
+		}
+	}
+	return "", false
+}
+
+// skipsIgnoredDirectory reports whether the dependency on the target is
+// skipped because of .bazelignore, warning about it.
+func (py *Resolver) skipsIgnoredDirectory(res *ruleResolution, mod Module, moduleName string, target label.Label) bool {
+	dir, ok := py.ignoredDirectory(target, res.from)
+	if !ok {
+		return false
+	}
+	res.logf("WARNING: %q, line %d: %q resolves to %s, in the directory %q ignored by .bazelignore, "+
+		"so the dependency is skipped\n", mod.Filepath, mod.LineNumber, moduleName, target, dir)
+	py.recordResolution(res.from, mod, moduleName, resolutionStrategyUnresolved, "")
+	return true
+}
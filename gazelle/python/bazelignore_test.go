@@ -0,0 +1,64 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadBazelIgnore(t *testing.T) {
+	root := t.TempDir()
+	dirs, err := loadBazelIgnore(root)
+	assert.NoError(t, err)
+	assert.Empty(t, dirs)
+
+	content := "# comment\n\nnode_modules\n  third_party/vendored/  \nbuild/*\n"
+	if err := os.WriteFile(filepath.Join(root, ".bazelignore"), []byte(content), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	dirs, err = loadBazelIgnore(root)
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"node_modules", "third_party/vendored"}, dirs)
+}
+
+func TestIgnoredDirectory(t *testing.T) {
+	py := &Resolver{bazelIgnoredDirs: []string{"third_party/vendored"}}
+	from := label.New("", "app", "app")
+	tests := []struct {
+		target string
+		dir    string
+		ok     bool
+	}{
+		{target: "//third_party/vendored:lib", dir: "third_party/vendored", ok: true},
+		{target: "//third_party/vendored/sub:lib", dir: "third_party/vendored", ok: true},
+		{target: "//third_party/vendored_other:lib"},
+		{target: "//third_party:lib"},
+		{target: "@pypi//third_party/vendored:lib"},
+	}
+	for _, tt := range tests {
+		target, err := label.Parse(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		dir, ok := py.ignoredDirectory(target, from)
+		assert.Equal(t, tt.ok, ok, tt.target)
+		assert.Equal(t, tt.dir, dir, tt.target)
+	}
+}
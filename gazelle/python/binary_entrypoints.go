@@ -0,0 +1,42 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"strings"
+)
+
+// parseBinaryEntrypoints parses the value of the python_binary_entrypoints
+// directive, the comma-separated names of the files getting a py_binary, e.g.
+// "main.py,cli.py". An empty value resets the names.
+func parseBinaryEntrypoints(value string) ([]string, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return nil, nil
+	}
+	var names []string
+	for _, name := range strings.Split(value, ",") {
+		name = strings.TrimSpace(name)
+		if !strings.HasSuffix(name, ".py") || strings.ContainsAny(name, "/*?[") {
+			return nil, fmt.Errorf("invalid file name %q: expected the name of a Python file, e.g. main.py", name)
+		}
+		if name == pyLibraryEntrypointFilename || name == pyTestEntrypointFilename {
+			return nil, fmt.Errorf("invalid file name %q: it's an entry point of the package", name)
+		}
+		names = append(names, name)
+	}
+	return names, nil
+}
@@ -0,0 +1,37 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseBinaryEntrypoints(t *testing.T) {
+	names, err := parseBinaryEntrypoints(" main.py, cli.py ")
+	assert.NoError(t, err)
+	assert.Equal(t, []string{"main.py", "cli.py"}, names)
+
+	names, err = parseBinaryEntrypoints("")
+	assert.NoError(t, err)
+	assert.Nil(t, names)
+
+	for _, value := range []string{"main", "cmd/main.py", "*.py", "main.py,", "__init__.py", "__test__.py"} {
+		if _, err := parseBinaryEntrypoints(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
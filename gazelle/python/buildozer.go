@@ -0,0 +1,220 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"io"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+const (
+	// resolveOutputBuild is the -python_resolve_output mode writing the
+	// resolved dependencies to the BUILD files, the default.
+	resolveOutputBuild = "build"
+	// resolveOutputBuildozer is the -python_resolve_output mode writing the
+	// changes of the resolved dependencies as buildozer commands instead.
+	resolveOutputBuildozer = "buildozer"
+)
+
+// buildozerAttrs are the dependency attributes whose changes are written as
+// buildozer commands.
+var buildozerAttrs = []string{"deps", "pyi_deps", depsToRemoveAttr}
+
+// buildozerTarget is a target whose dependency changes are written as
+// buildozer commands, once all the dependencies are resolved.
+type buildozerTarget struct {
+	label label.Label
+	// rule is the rule written to the BUILD file: the existing rule when
+	// there is one, or the generated one.
+	rule *rule.Rule
+	// original maps the dependency attributes of the existing rule to their
+	// value before the generated rule is merged into it.
+	original map[string]bzl.Expr
+}
+
+// addBuildozerTargets records the targets generated in the package, with the
+// dependency attributes of the existing rules, when the resolved dependencies
+// are written as buildozer commands. It's called before the other passes
+// change these attributes. Rules marked with a "# keep" comment are skipped.
+func (py *Python) addBuildozerTargets(args language.GenerateArgs, gen []*rule.Rule) {
+	if py.resolveOutput != resolveOutputBuildozer {
+		return
+	}
+	for _, r := range gen {
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		original := make(map[string]bzl.Expr)
+		if target != r {
+			for _, attr := range buildozerAttrs {
+				if expr := target.Attr(attr); expr != nil {
+					original[attr] = expr
+				}
+			}
+		}
+		py.buildozerTargets = append(py.buildozerTargets, buildozerTarget{
+			label:    label.New("", args.Rel, r.Name()),
+			rule:     target,
+			original: original,
+		})
+	}
+}
+
+// buildozerValues returns the strings of the lists of expr, a list or a sum of
+// lists and select() calls, whose branches are ignored. It returns false for
+// any other expression.
+func buildozerValues(expr bzl.Expr) ([]string, bool) {
+	if expr == nil {
+		return nil, true
+	}
+	parts, ok := sumParts(expr)
+	if !ok {
+		return nil, false
+	}
+	var values []string
+	for _, part := range parts {
+		list, ok := part.(*bzl.ListExpr)
+		if !ok {
+			continue
+		}
+		for _, elem := range list.List {
+			if str, ok := elem.(*bzl.StringExpr); ok {
+				values = append(values, str.Value)
+			}
+		}
+	}
+	return values, true
+}
+
+// buildozerCommands returns the buildozer commands turning the original
+// dependency attributes of the target into the resolved ones. The
+// dependencies are added and removed one by one, and the other attributes are
+// replaced as a whole, with a remove followed by an add so that buildozer
+// keeps them lists. The attributes that aren't lists, e.g. the references to a
+// py_deps.bzl file, are skipped with a warning when they change.
+func (t buildozerTarget) commands() []string {
+	var commands []string
+	for _, attr := range buildozerAttrs {
+		before, okBefore := buildozerValues(t.original[attr])
+		after, okAfter := buildozerValues(t.rule.Attr(attr))
+		if !okBefore || !okAfter {
+			if formatExpr(t.original[attr]) != formatExpr(t.rule.Attr(attr)) {
+				log.Printf("WARNING: the %s of %s can't be written as buildozer commands", attr, t.label)
+			}
+			continue
+		}
+		if attr == "deps" {
+			if added := difference(after, before); len(added) > 0 {
+				commands = append(commands, "add deps "+strings.Join(added, " "))
+			}
+			if removed := difference(before, after); len(removed) > 0 {
+				commands = append(commands, "remove deps "+strings.Join(removed, " "))
+			}
+			continue
+		}
+		if strings.Join(before, " ") == strings.Join(after, " ") {
+			continue
+		}
+		if len(before) > 0 {
+			commands = append(commands, "remove "+attr)
+		}
+		if len(after) > 0 {
+			commands = append(commands, "add "+attr+" "+strings.Join(after, " "))
+		}
+	}
+	return commands
+}
+
+// formatExpr returns the string form of expr, or "" when it's nil.
+func formatExpr(expr bzl.Expr) string {
+	if expr == nil {
+		return ""
+	}
+	return bzl.FormatString(expr)
+}
+
+// difference returns the values of a missing from b, in their order in a.
+func difference(a, b []string) []string {
+	in := make(map[string]bool, len(b))
+	for _, v := range b {
+		in[v] = true
+	}
+	var diff []string
+	for _, v := range a {
+		if !in[v] {
+			diff = append(diff, v)
+		}
+	}
+	return diff
+}
+
+// restore sets the dependency attributes of the target back to their original
+// value, so that the BUILD file is left as it was.
+func (t buildozerTarget) restore() {
+	for _, attr := range buildozerAttrs {
+		if expr, ok := t.original[attr]; ok {
+			t.rule.SetAttr(attr, expr)
+		} else {
+			t.rule.DelAttr(attr)
+		}
+	}
+}
+
+// writeBuildozerCommands writes the dependency changes of the recorded targets
+// as a buildozer command file, one line per target sorted by label, to the
+// -python_buildozer_file file or to the standard output, and leaves the
+// dependency attributes of the BUILD files untouched.
+func (py *Python) writeBuildozerCommands() {
+	var lines []string
+	for _, t := range py.buildozerTargets {
+		if commands := t.commands(); len(commands) > 0 {
+			lines = append(lines, strings.Join(commands, "|")+"|"+t.label.String())
+		}
+		t.restore()
+	}
+	sort.Strings(lines)
+	if err := writeBuildozerFile(py.buildozerFilePath, lines); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeBuildozerFile writes the lines of a buildozer command file to path, or
+// to the standard output when path is empty.
+func writeBuildozerFile(path string, lines []string) error {
+	var data strings.Builder
+	for _, line := range lines {
+		data.WriteString(line + "\n")
+	}
+	var err error
+	if path == "" {
+		_, err = io.WriteString(os.Stdout, data.String())
+	} else {
+		err = os.WriteFile(path, []byte(data.String()), 0o644)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to write the buildozer commands: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,84 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestBuildozerCommands(t *testing.T) {
+	f, err := rule.LoadData("BUILD", "app", []byte(`
+py_library(
+    name = "app",
+    deps = ["//old", "//kept"] + select({"//conditions:gpu": ["//gpu"]}),
+    pyi_deps = ["//old_stubs"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	r := f.Rules[0]
+	target := buildozerTarget{label: label.New("", "app", "app"), rule: r, original: map[string]bzl.Expr{}}
+	for _, attr := range buildozerAttrs {
+		if expr := r.Attr(attr); expr != nil {
+			target.original[attr] = expr
+		}
+	}
+	r.SetAttr("deps", []string{"//kept", "//lib", "//util"})
+	r.DelAttr("pyi_deps")
+	r.SetAttr(depsToRemoveAttr, []string{"//api"})
+	assert.Equal(t, []string{
+		"add deps //lib //util",
+		"remove deps //old",
+		"remove pyi_deps",
+		"add deps_to_remove //api",
+	}, target.commands())
+
+	// The BUILD file is left as it was.
+	target.restore()
+	assert.Same(t, target.original["deps"], r.Attr("deps"))
+	assert.Equal(t, []string{"//old_stubs"}, r.AttrStrings("pyi_deps"))
+	assert.Nil(t, r.Attr(depsToRemoveAttr))
+
+	// A new target gets all its dependencies added, and an unchanged one
+	// none.
+	r.SetAttr("pyi_deps", []string{"//new_stubs"})
+	target.original = map[string]bzl.Expr{}
+	assert.Equal(t, []string{
+		"add deps //old //kept",
+		"add pyi_deps //new_stubs",
+	}, target.commands())
+	target.original = map[string]bzl.Expr{"deps": r.Attr("deps"), "pyi_deps": r.Attr("pyi_deps")}
+	assert.Empty(t, target.commands())
+}
+
+func TestWriteBuildozerFile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "deps.buildozer")
+	if !assert.NoError(t, writeBuildozerFile(path, []string{"add deps //lib|//app", "remove deps //old|//cli"})) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "add deps //lib|//app\nremove deps //old|//cli\n", string(data))
+}
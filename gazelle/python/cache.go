@@ -0,0 +1,436 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// cacheVersion is the version of the format of the -python_cache_file file.
+// The caches written with another version are discarded, so it must be
+// bumped whenever the parsing or the resolution changes.
+const cacheVersion = 9
+
+// cacheFile is the format of the -python_cache_file file.
+type cacheFile struct {
+	Version int `json:"version"`
+	// Files maps the Python files, relative to the repository root, to their
+	// parsing.
+	Files map[string]cachedFile `json:"files"`
+	// Targets maps the labels of the resolved targets to the resolution of
+	// their imports.
+	Targets map[string]cachedResolution `json:"targets"`
+	// Provides maps the labels of the indexed targets to the modules they
+	// provide, so that the dependents of the targets whose modules changed
+	// are resolved again, see reresolveDependents.
+	Provides map[string][]string `json:"provides,omitempty"`
+}
+
+// cachedFile is the parsing of a Python file, valid as long as its digest is
+// unchanged.
+type cachedFile struct {
+	Digest string        `json:"digest"`
+	Output *ParserOutput `json:"output"`
+}
+
+// cachedResolution is the resolution of the imports of a target, valid as
+// long as its key is unchanged.
+type cachedResolution struct {
+	Key               string              `json:"key"`
+	Deps              []string            `json:"deps,omitempty"`
+	PyiDeps           []string            `json:"pyi_deps,omitempty"`
+	PlatformDeps      map[string][]string `json:"platform_deps,omitempty"`
+	DepSources        map[string]Module   `json:"dep_sources,omitempty"`
+	OptionalImports   []string            `json:"optional_imports,omitempty"`
+	Distributions     []string            `json:"distributions,omitempty"`
+	UnresolvedImports []unresolvedImport  `json:"unresolved_imports,omitempty"`
+	Messages          []string            `json:"messages,omitempty"`
+	// Modules, ResolvedDeps and NoDepsOrder are the imports of the target and
+	// the parts of its generated rule needed to resolve them again without
+	// generating it, when the modules of a dependency change.
+	Modules      []Module `json:"modules,omitempty"`
+	ResolvedDeps []string `json:"resolved_deps,omitempty"`
+	NoDepsOrder  bool     `json:"no_deps_order,omitempty"`
+}
+
+// resolutionCache is the cache of the parsing and of the resolution of the
+// previous runs, read from and written to the -python_cache_file file. A nil
+// cache caches nothing.
+//
+// The parsing of a file is keyed by the digest of its content. The resolution
+// of a target is keyed by its imports and by the environment of the run: the
+// directives, the files they refer to, e.g. the manifests and the deps order
+// files, the modules registered by the BUILD rules, e.g. the outs of the
+// py_generated targets and the python_extension targets, and the indexed
+// targets.
+type resolutionCache struct {
+	path     string
+	previous cacheFile
+	// mu guards current.Files, written by the concurrent parsers.
+	mu      sync.Mutex
+	current cacheFile
+	// environment is the digest of the directives and of the files they refer
+	// to, fed while configuring the packages.
+	environment hash.Hash
+	// environmentFiles are the files already fed to the environment.
+	environmentFiles map[string]bool
+	// registries are the registries of the modules, by name, shared by the
+	// configurations of every package and only complete once every package
+	// is configured.
+	registries map[string]map[string]label.Label
+	// indexed are the descriptions of the indexed targets.
+	indexed []string
+	// resolutionKey is the digest of the environment and of the indexed
+	// targets, computed when resolving the first target.
+	resolutionKey string
+}
+
+// loadResolutionCache reads the cache at path, if any. Unreadable caches and
+// the ones written with another version are discarded.
+func loadResolutionCache(path string) *resolutionCache {
+	rc := &resolutionCache{
+		path: path,
+		current: cacheFile{
+			Version:  cacheVersion,
+			Files:    make(map[string]cachedFile),
+			Targets:  make(map[string]cachedResolution),
+			Provides: make(map[string][]string),
+		},
+		environment:      sha256.New(),
+		environmentFiles: make(map[string]bool),
+		registries:       make(map[string]map[string]label.Label),
+	}
+	fmt.Fprintf(rc.environment, "version %d\n", cacheVersion)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return rc
+	}
+	if err == nil {
+		err = json.Unmarshal(data, &rc.previous)
+	}
+	if err != nil {
+		log.Printf("WARNING: discarding the Python cache %q: %v\n", path, err)
+		rc.previous = cacheFile{}
+	} else if rc.previous.Version != cacheVersion {
+		rc.previous = cacheFile{}
+	}
+	return rc
+}
+
+// parseFile parses the Python file of the package relPackagePath with the
+// parser p, unless the cache has the parsing of the same content.
+func (rc *resolutionCache) parseFile(ctx context.Context, p *FileParser, repoRoot, relPackagePath, filename string) (*ParserOutput, error) {
+	if rc == nil {
+		return p.ParseFile(ctx, repoRoot, relPackagePath, filename)
+	}
+	code, err := os.ReadFile(filepath.Join(repoRoot, relPackagePath, filename))
+	if err != nil {
+		return nil, err
+	}
+	rel := filepath.ToSlash(filepath.Join(relPackagePath, filename))
+	sum := sha256.Sum256(code)
+	// The forward references are only parsed when the string annotations are
+	// resolved, so the setting is part of the digest.
+	digest := fmt.Sprintf("%s-%t", hex.EncodeToString(sum[:]), p.resolveStringAnnotations)
+	if cached, ok := rc.previous.Files[rel]; ok && cached.Digest == digest && cached.Output != nil {
+		rc.addFile(rel, cached)
+		return cached.Output, nil
+	}
+	p.SetCodeAndFile(code, relPackagePath, filename)
+	output, err := p.Parse(ctx)
+	if err != nil {
+		return nil, err
+	}
+	rc.addFile(rel, cachedFile{Digest: digest, Output: output})
+	return output, nil
+}
+
+// addFile records the parsing of the file rel in the cache being written.
+func (rc *resolutionCache) addFile(rel string, file cachedFile) {
+	rc.mu.Lock()
+	defer rc.mu.Unlock()
+	rc.current.Files[rel] = file
+}
+
+// addConfiguration feeds the directives of the BUILD file of the package rel,
+// and the content of the files they refer to, to the environment.
+func (rc *resolutionCache) addConfiguration(rel string, f *rule.File, files []string) {
+	if rc == nil || f == nil {
+		return
+	}
+	for _, d := range f.Directives {
+		fmt.Fprintf(rc.environment, "directive %q %q %q\n", rel, d.Key, d.Value)
+	}
+	rc.addFiles(files)
+}
+
+// addFiles feeds the content of the files to the environment, once.
+func (rc *resolutionCache) addFiles(files []string) {
+	for _, file := range files {
+		if rc.environmentFiles[file] {
+			continue
+		}
+		rc.environmentFiles[file] = true
+		// Missing files are reported by the resolution itself.
+		data, _ := os.ReadFile(file)
+		fmt.Fprintf(rc.environment, "file %q %d\n", file, len(data))
+		rc.environment.Write(data)
+	}
+}
+
+// addRegistry records the registry of the modules, mapping them to the
+// labels of their targets, fed to the environment when resolving the first
+// target.
+func (rc *resolutionCache) addRegistry(name string, modules map[string]label.Label) {
+	if rc == nil {
+		return
+	}
+	rc.registries[name] = modules
+}
+
+// addIndexed records the indexed target, with the modules it provides and
+// the content of its __init__.py files, whose re-exports are followed.
+func (rc *resolutionCache) addIndexed(repoRoot string, target label.Label, r *rule.Rule, provides []resolve.ImportSpec, visibility []string) {
+	if rc == nil {
+		return
+	}
+	var b strings.Builder
+	fmt.Fprintf(&b, "%s %s %q", target, r.Kind(), visibility)
+	modules := make([]string, 0, len(provides))
+	for _, provide := range provides {
+		fmt.Fprintf(&b, " %s", provide.Imp)
+		modules = append(modules, provide.Imp)
+	}
+	sort.Strings(modules)
+	rc.current.Provides[target.String()] = modules
+	for _, src := range ruleSrcs(r) {
+		if filepath.Base(src) != pyLibraryEntrypointFilename {
+			continue
+		}
+		data, _ := os.ReadFile(filepath.Join(repoRoot, target.Pkg, src))
+		fmt.Fprintf(&b, " %s:%x", src, sha256.Sum256(data))
+	}
+	rc.indexed = append(rc.indexed, b.String())
+}
+
+// addNamespace records the target as a provider of the implicit namespace
+// package.
+func (rc *resolutionCache) addNamespace(namespace string, target label.Label) {
+	if rc == nil {
+		return
+	}
+	rc.indexed = append(rc.indexed, fmt.Sprintf("namespace %s %s", namespace, target))
+}
+
+// addAlias records the alias rule forwarding to the actual target.
+func (rc *resolutionCache) addAlias(alias, actual label.Label) {
+	if rc == nil {
+		return
+	}
+	rc.indexed = append(rc.indexed, fmt.Sprintf("alias %s %s", alias, actual))
+}
+
+// addExternal records the targets of an external repository providing the
+// module.
+func (rc *resolutionCache) addExternal(repository, module string, targets []label.Label) {
+	if rc == nil {
+		return
+	}
+	rc.indexed = append(rc.indexed, fmt.Sprintf("external %s %s %v", repository, module, targets))
+}
+
+// key returns the key of the resolution of the modules of the target from.
+func (rc *resolutionCache) key(from label.Label, modules *treeset.Set) string {
+	if rc.resolutionKey == "" {
+		for name, registry := range rc.registries {
+			for module, target := range registry {
+				rc.indexed = append(rc.indexed, fmt.Sprintf("%s %s %s", name, module, target))
+			}
+		}
+		sort.Strings(rc.indexed)
+		for _, indexed := range rc.indexed {
+			fmt.Fprintf(rc.environment, "indexed %s\n", indexed)
+		}
+		rc.resolutionKey = hex.EncodeToString(rc.environment.Sum(nil))
+	}
+	h := sha256.New()
+	fmt.Fprintf(h, "%s %s\n", rc.resolutionKey, from)
+	if modules != nil {
+		data, _ := json.Marshal(modules.Values())
+		h.Write(data)
+	}
+	return hex.EncodeToString(h.Sum(nil))
+}
+
+// resolution returns the cached resolution of the target from, if its key
+// is unchanged.
+func (rc *resolutionCache) resolution(from label.Label, key string) (cachedResolution, bool) {
+	if rc == nil || key == "" {
+		return cachedResolution{}, false
+	}
+	cached, ok := rc.previous.Targets[from.String()]
+	return cached, ok && cached.Key == key
+}
+
+// write writes the cache, keeping the entries of the previous run that
+// weren't used by this one, e.g. the ones of the packages that weren't
+// visited.
+func (rc *resolutionCache) write() error {
+	for rel, file := range rc.previous.Files {
+		if _, ok := rc.current.Files[rel]; !ok {
+			rc.current.Files[rel] = file
+		}
+	}
+	for target, resolution := range rc.previous.Targets {
+		if _, ok := rc.current.Targets[target]; !ok {
+			rc.current.Targets[target] = resolution
+		}
+	}
+	for target, modules := range rc.previous.Provides {
+		if _, ok := rc.current.Provides[target]; !ok {
+			rc.current.Provides[target] = modules
+		}
+	}
+	data, err := json.Marshal(rc.current)
+	if err != nil {
+		return fmt.Errorf("failed to encode the Python cache: %w", err)
+	}
+	if err := os.WriteFile(rc.path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the Python cache: %w", err)
+	}
+	return nil
+}
+
+// resolutionCacheKey returns the key of the cached resolution of the target
+// from, or an empty string when the resolution isn't cached: the flags
+// recording the resolution decisions or annotating the Python files need
+// them to be taken every time.
+func (py *Resolver) resolutionCacheKey(from label.Label, modules *treeset.Set) string {
+	if py.cache == nil || py.recordResolutions || py.profile != nil || py.ignoreModules != nil ||
+		py.depsToRemoveReport != nil || !py.explainDependency.Equal(label.NoLabel) {
+		return ""
+	}
+	return py.cache.key(from, modules)
+}
+
+// replay records the cached resolution of the imports of the target, as the
+// resolution of its imports would.
+func (res *ruleResolution) replay(cached cachedResolution) {
+	for _, dep := range cached.Deps {
+		res.deps.Add(dep)
+	}
+	for _, dep := range cached.PyiDeps {
+		res.pyiDeps.Add(dep)
+	}
+	for platform, platformDeps := range cached.PlatformDeps {
+		set := treeset.NewWith(godsutils.StringComparator)
+		for _, dep := range platformDeps {
+			set.Add(dep)
+		}
+		res.platformDeps[platform] = set
+	}
+	for dep, mod := range cached.DepSources {
+		res.depSources[dep] = mod
+	}
+	res.optionalImports = cached.OptionalImports
+	res.distributions = cached.Distributions
+	res.unresolvedImports = cached.UnresolvedImports
+	res.messages = cached.Messages
+}
+
+// cacheResolution records the resolution of the imports of the target of the
+// rule r in the cache being written.
+func (py *Resolver) cacheResolution(r *rule.Rule, res *ruleResolution) {
+	cached := cachedResolution{
+		Key:               res.cacheKey,
+		Deps:              stringValues(res.deps),
+		PyiDeps:           stringValues(res.pyiDeps),
+		DepSources:        res.depSources,
+		OptionalImports:   res.optionalImports,
+		Distributions:     res.distributions,
+		UnresolvedImports: res.unresolvedImports,
+		Messages:          res.messages,
+		NoDepsOrder:       ignoresDepsOrder(r),
+	}
+	if res.modules != nil {
+		for _, mod := range res.modules.Values() {
+			cached.Modules = append(cached.Modules, mod.(Module))
+		}
+	}
+	if resolvedDeps, ok := r.PrivateAttr(resolvedDepsKey).(*treeset.Set); ok && !resolvedDeps.Empty() {
+		cached.ResolvedDeps = stringValues(resolvedDeps)
+	}
+	if len(res.platformDeps) > 0 {
+		cached.PlatformDeps = make(map[string][]string, len(res.platformDeps))
+		for platform, set := range res.platformDeps {
+			cached.PlatformDeps[platform] = stringValues(set)
+		}
+	}
+	py.cache.current.Targets[res.from.String()] = cached
+}
+
+// stringValues returns the values of the set of strings.
+func stringValues(set *treeset.Set) []string {
+	values := make([]string, 0, set.Size())
+	for _, v := range set.Values() {
+		values = append(values, v.(string))
+	}
+	return values
+}
+
+// Configure applies the directives of the BUILD file f to the configuration
+// of the package rel, also feeding them to the environment of the cache.
+func (py *Python) Configure(c *config.Config, rel string, f *rule.File) {
+	py.Configurer.Configure(c, rel, f)
+	if py.cache == nil {
+		return
+	}
+	cfg := c.Exts[languageName].(pythonconfig.Configs)[rel]
+	py.cache.addConfiguration(rel, f, cfg.InputFiles())
+	py.cache.addRegistry("generated", cfg.GeneratedModules())
+	py.cache.addRegistry("native", cfg.NativeModules())
+}
+
+// writeCache writes the -python_cache_file file.
+func (py *Python) writeCache() {
+	if py.cache == nil {
+		return
+	}
+	if err := py.cache.write(); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,202 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolutionCacheParseFile(t *testing.T) {
+	root := t.TempDir()
+	cachePath := filepath.Join(root, ".gazelle-python-cache")
+	writeFile := func(content string) {
+		if err := os.MkdirAll(filepath.Join(root, "pkg"), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, "pkg", "foo.py"), []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	parse := func() *ParserOutput {
+		rc := loadResolutionCache(cachePath)
+		output, err := rc.parseFile(context.Background(), NewFileParser(), root, "pkg", "foo.py")
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := rc.write(); err != nil {
+			t.Fatal(err)
+		}
+		return output
+	}
+
+	writeFile("import bar\n")
+	assert.Equal(t, "bar", parse().Modules[0].Name)
+	assert.Equal(t, "bar", parse().Modules[0].Name)
+
+	writeFile("import baz\n")
+	assert.Equal(t, "baz", parse().Modules[0].Name)
+
+	// Corrupted caches are discarded.
+	if err := os.WriteFile(cachePath, []byte("{"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, "baz", parse().Modules[0].Name)
+}
+
+func TestResolutionCacheKey(t *testing.T) {
+	from := label.New("", "pkg", "pkg")
+	modules := treeset.NewWith(moduleComparator)
+	modules.Add(Module{Name: "bar", LineNumber: 1, Filepath: "pkg/foo.py"})
+	key := func(directive string) string {
+		rc := loadResolutionCache(filepath.Join(t.TempDir(), "cache"))
+		f := rule.EmptyFile("pkg/BUILD", "pkg")
+		f.Directives = []rule.Directive{{Key: "python_resolve_visibility", Value: directive}}
+		rc.addConfiguration("pkg", f, nil)
+		return rc.key(from, modules)
+	}
+
+	assert.Equal(t, key("ignore"), key("ignore"))
+	assert.NotEqual(t, key("ignore"), key("require"))
+
+	// The registries are fed to the environment when resolving the first
+	// target, after every package added its modules to them.
+	registryKey := func(name string, entries map[string]label.Label) string {
+		rc := loadResolutionCache(filepath.Join(t.TempDir(), "cache"))
+		registry := make(map[string]label.Label)
+		rc.addRegistry(name, registry)
+		for module, target := range entries {
+			registry[module] = target
+		}
+		return rc.key(from, modules)
+	}
+	gen := label.New("", "tools", "gen")
+	assert.Equal(t, registryKey("generated", nil), registryKey("generated", map[string]label.Label{}))
+	assert.NotEqual(t, registryKey("generated", nil), registryKey("generated", map[string]label.Label{"tools.version": gen}))
+	assert.NotEqual(t, registryKey("generated", map[string]label.Label{"tools.version": gen}), registryKey("native", map[string]label.Label{"tools.version": gen}))
+}
+
+func TestResolutionCacheReplay(t *testing.T) {
+	from := label.New("", "pkg", "pkg")
+	py := &Resolver{cache: loadResolutionCache(filepath.Join(t.TempDir(), "cache"))}
+	res := py.newRuleResolution(nil, nil, from)
+	res.cacheKey = "key"
+	res.deps.Add("//bar")
+	res.platformDeps["windows"] = treeset.NewWith(godsutils.StringComparator, "//winbar")
+	res.depSources["//bar"] = Module{Name: "bar"}
+	res.optionalImports = []string{"ujson"}
+	res.logf("WARNING: %s", "bar")
+	py.cacheResolution(rule.NewRule(pyLibraryKind, "pkg"), res)
+
+	_, ok := py.cache.resolution(from, "key")
+	assert.False(t, ok, "only the resolutions of the previous run are reused")
+	py.cache.previous = py.cache.current
+	_, ok = py.cache.resolution(from, "other")
+	assert.False(t, ok)
+	cached, ok := py.cache.resolution(from, "key")
+	if !assert.True(t, ok) {
+		return
+	}
+
+	replayed := py.newRuleResolution(nil, nil, from)
+	replayed.replay(cached)
+	assert.Equal(t, []interface{}{"//bar"}, replayed.deps.Values())
+	assert.Equal(t, []interface{}{"//winbar"}, replayed.platformDeps["windows"].Values())
+	assert.Equal(t, "bar", replayed.depSources["//bar"].Name)
+	assert.Equal(t, []string{"ujson"}, replayed.optionalImports)
+	assert.Equal(t, []string{"WARNING: bar"}, replayed.messages)
+}
+
+func TestResolutionCacheDependents(t *testing.T) {
+	repoRoot := t.TempDir()
+	for _, dir := range []string{"app", "lib", "tools", "unvisited"} {
+		if err := os.Mkdir(filepath.Join(repoRoot, dir), 0o755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	rc := loadResolutionCache(filepath.Join(t.TempDir(), "cache"))
+	rc.previous = cacheFile{
+		Provides: map[string][]string{
+			"//lib":          {"lib", "lib.util"},
+			"//lib:extra":    {"lib.extra"},
+			"//tools":        {"tools"},
+			"//gone":         {"gone"},
+			"//unvisited:ok": {"unvisited"},
+		},
+		Targets: map[string]cachedResolution{
+			"//app":          {Deps: []string{"//lib"}},
+			"//app:cli":      {UnresolvedImports: []unresolvedImport{{Import: "lib.helpers.run"}}},
+			"//app:gone":     {PlatformDeps: map[string][]string{"linux": {"//gone"}}},
+			"//app:tools":    {Deps: []string{"//tools"}},
+			"//lib:lib_test": {Deps: []string{":lib"}},
+		},
+	}
+	// lib/helpers.py was added to //lib and lib/util.py moved out of it,
+	// //lib:extra was removed and //gone was deleted with its package.
+	rc.current.Provides = map[string][]string{
+		"//lib":   {"lib", "lib.helpers"},
+		"//tools": {"tools"},
+	}
+	changed := rc.changedProviders(repoRoot, map[string]bool{"lib": true})
+	assert.Equal(t, map[string][]string{
+		"//lib":       {"lib.helpers"},
+		"//lib:extra": nil,
+		"//gone":      nil,
+	}, changed)
+	assert.NotContains(t, rc.previous.Provides, "//gone")
+	assert.Contains(t, rc.previous.Provides, "//unvisited:ok")
+
+	// The targets resolved by the run are up to date.
+	assert.Equal(t, []string{"//app", "//app:cli", "//app:gone"},
+		rc.dependents(changed, map[string]bool{"//lib:lib_test": true}))
+}
+
+func TestWriteDependentFiles(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "BUILD.bazel")
+	original := "py_library(name = \"app\")\n"
+	if err := os.WriteFile(path, []byte(original), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	f, err := rule.LoadFile(path, "app")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Rules[0].SetAttr("deps", []string{"//lib"})
+	read := func() string {
+		data, err := os.ReadFile(path)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(data)
+	}
+
+	// The print and diff modes leave the files outside of the visited
+	// packages untouched.
+	py := &Python{dependentFiles: map[string]*rule.File{"app": f}}
+	py.writeDependentFiles()
+	assert.Equal(t, original, read())
+
+	py.updatesFiles = true
+	py.writeDependentFiles()
+	assert.Contains(t, read(), `deps = ["//lib"]`)
+}
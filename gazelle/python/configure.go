@@ -15,10 +15,12 @@
 package python
 
 import (
+	"errors"
 	"flag"
 	"fmt"
 	"log"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
 
@@ -31,18 +33,131 @@ import (
 
 // Configurer satisfies the config.Configurer interface. It's the
 // language-specific configuration extension.
-type Configurer struct{}
+type Configurer struct {
+	// preflight is set by the -python_preflight flag.
+	preflight bool
+	// reportCycles is set by the -python_report_cycles flag.
+	reportCycles bool
+	// cycleReportPath is set by the -python_cycle_report flag.
+	cycleReportPath string
+	// recordResolutionsPath is set by the -python_record_resolutions flag.
+	recordResolutionsPath string
+	// verifyResolutionsPath is set by the -python_verify_resolutions flag.
+	verifyResolutionsPath string
+	// explainDependency is set by the -python_explain_dependency flag.
+	explainDependency string
+	// explainOutputPath is set by the -python_explain_output flag.
+	explainOutputPath string
+	// diagnosticsPath is set by the -python_diagnostics_file flag.
+	diagnosticsPath string
+	// addIgnoreAnnotationsPath is set by the -python_add_ignore_annotations
+	// flag.
+	addIgnoreAnnotationsPath string
+	// profileOutputPath is set by the -python_profile_output flag.
+	profileOutputPath string
+	// cachePath is set by the -python_cache_file flag.
+	cachePath string
+	// depsToRemoveReportPath is set by the -python_deps_to_remove_report flag.
+	depsToRemoveReportPath string
+	// depsOrderIndexPath is set by the -python_deps_order_index flag.
+	depsOrderIndexPath string
+	// maxMemory is set by the -python_max_memory flag.
+	maxMemory string
+	// resolveOutput is set by the -python_resolve_output flag.
+	resolveOutput string
+	// buildozerFilePath is set by the -python_buildozer_file flag.
+	buildozerFilePath string
+	// wheelAuditPath is set by the -python_wheel_audit flag.
+	wheelAuditPath string
+	// namingReportPath is set by the -python_naming_report flag.
+	namingReportPath string
+	// importGraphPath is set by the -python_import_graph flag.
+	importGraphPath string
+	// wrapperMacros are the macros declared in the root BUILD file with
+	// python_wrapper_macro, registered as kinds of the extension.
+	wrapperMacros []pythonconfig.WrapperMacroInfo
+	// updatesFiles is whether Gazelle runs in the fix mode, which updates the
+	// files in place, rather than in the print or diff modes.
+	updatesFiles bool
+}
 
 // RegisterFlags registers command-line flags used by the extension. This
 // method is called once with the root configuration when Gazelle
 // starts. RegisterFlags may set an initial values in Config.Exts. When flags
 // are set, they should modify these values.
-func (py *Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {}
+func (py *Configurer) RegisterFlags(fs *flag.FlagSet, cmd string, c *config.Config) {
+	fs.BoolVar(&py.preflight, "python_preflight", false,
+		"validates the Python configuration of the whole repository before generating rules, reporting all problems at once")
+	fs.BoolVar(&py.reportCycles, "python_report_cycles", false,
+		"reports the import cycles between the Python targets, with the imports causing them")
+	fs.StringVar(&py.cycleReportPath, "python_cycle_report", "",
+		"path to a JSON file where the import cycles between the Python targets are written, relative to the repository root")
+	fs.StringVar(&py.recordResolutionsPath, "python_record_resolutions", "",
+		"path to a JSON file where the resolution of every Python import is recorded, relative to the repository root")
+	fs.StringVar(&py.verifyResolutionsPath, "python_verify_resolutions", "",
+		"path to a JSON file written by -python_record_resolutions; fails if the resolution of any Python import differs from it")
+	fs.StringVar(&py.explainDependency, "python_explain_dependency", "",
+		"label of a dependency, e.g. //pkg:target; logs why it is added to the Python targets depending on it")
+	fs.StringVar(&py.explainOutputPath, "python_explain_output", "",
+		"path to a JSON file where the resolution decisions of the Python imports are written, relative to the repository root; "+
+			"only the ones resolving to -python_explain_dependency if it is set")
+	fs.StringVar(&py.diagnosticsPath, "python_diagnostics_file", "",
+		"path to a JSON file where the imports left unresolved by the python_unresolved_imports directive are written, relative to the repository root")
+	fs.StringVar(&py.addIgnoreAnnotationsPath, "python_add_ignore_annotations", "",
+		"path to a file listing Python modules, one per line, or to a JSON file written by -python_diagnostics_file, relative to the repository root; "+
+			"adds '# gazelle:ignore' annotations for these modules to the Python files importing them")
+	fs.StringVar(&py.profileOutputPath, "python_profile_output", "",
+		"path to a JSON file where the time spent by each resolution strategy, by module prefix, is written, relative to the repository root")
+	fs.StringVar(&py.cachePath, "python_cache_file", "",
+		"path to a file caching the parsing of the Python files and the resolution of their imports between runs, relative to the repository root")
+	fs.StringVar(&py.depsToRemoveReportPath, "python_deps_to_remove_report", "",
+		"path to a JSON file where the dependencies listed in deps_to_remove because they violate the layers are justified, relative to the repository root")
+	fs.StringVar(&py.depsOrderIndexPath, "python_deps_order_index", "",
+		"path to a .bzl file where the layer of each Python target in the python_deps_order_file layers is written, relative to the repository root")
+	fs.StringVar(&py.maxMemory, "python_max_memory", "",
+		"soft memory limit of the run, e.g. 8GiB; the garbage collector runs more often as it gets closer, and fewer resolutions are computed ahead")
+	fs.StringVar(&py.resolveOutput, "python_resolve_output", resolveOutputBuild,
+		"where the resolved Python dependencies are written: 'build' updates the BUILD files, 'buildozer' writes the changes as buildozer commands instead")
+	fs.StringVar(&py.buildozerFilePath, "python_buildozer_file", "",
+		"path to the file where the buildozer commands of -python_resolve_output=buildozer are written, relative to the repository root; the standard output if unset")
+	fs.StringVar(&py.wheelAuditPath, "python_wheel_audit", "",
+		"path to a JSON file where the third-party distributions without a wheel for some python_target_platforms, per the python_wheel_lock_file, are written, relative to the repository root")
+	fs.StringVar(&py.namingReportPath, "python_naming_report", "",
+		"path to a JSON file where the generated targets named differently by the python_naming_strategy than by the legacy one are written, relative to the repository root")
+	fs.StringVar(&py.importGraphPath, "python_import_graph", "",
+		"path to a file where the resolved imports are written, from the module and its providing target to the importing target, relative to the repository root; "+
+			"a DOT graph if it has the .dot extension, JSON otherwise")
+}
 
 // CheckFlags validates the configuration after command line flags are parsed.
 // This is called once with the root configuration when Gazelle starts.
 // CheckFlags may set default values in flags or make implied changes.
 func (py *Configurer) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
+	for _, path := range []*string{&py.cycleReportPath, &py.recordResolutionsPath, &py.verifyResolutionsPath, &py.explainOutputPath, &py.diagnosticsPath, &py.addIgnoreAnnotationsPath, &py.profileOutputPath, &py.cachePath, &py.depsToRemoveReportPath, &py.depsOrderIndexPath, &py.buildozerFilePath, &py.wheelAuditPath, &py.namingReportPath, &py.importGraphPath} {
+		if *path != "" && !filepath.IsAbs(*path) {
+			*path = filepath.Join(c.RepoRoot, *path)
+		}
+	}
+	if py.resolveOutput != resolveOutputBuild && py.resolveOutput != resolveOutputBuildozer {
+		return fmt.Errorf("invalid value %q for -python_resolve_output: expected %q or %q", py.resolveOutput, resolveOutputBuild, resolveOutputBuildozer)
+	}
+	if py.buildozerFilePath != "" && py.resolveOutput != resolveOutputBuildozer {
+		return fmt.Errorf("-python_buildozer_file requires -python_resolve_output=%s", resolveOutputBuildozer)
+	}
+	wrapperMacros, err := loadWrapperMacros(c)
+	if err != nil {
+		return err
+	}
+	py.wrapperMacros = wrapperMacros
+	// The print and diff modes of Gazelle leave the repository untouched, so
+	// the files generated next to the BUILD files aren't written either.
+	py.updatesFiles = true
+	if mode := fs.Lookup("mode"); mode != nil {
+		py.updatesFiles = mode.Value.String() == "fix"
+	}
+	if py.preflight {
+		return runPreflight(c)
+	}
 	return nil
 }
 
@@ -60,6 +175,8 @@ func (py *Configurer) KnownDirectives() []string {
 		pythonconfig.GenerationMode,
 		pythonconfig.GenerationModePerFileIncludeInit,
 		pythonconfig.GenerationModePerPackageRequireTestEntryPoint,
+		pythonconfig.GenerationModePerFileMergeCycles,
+		pythonconfig.GenerationModePerFileTestUtils,
 		pythonconfig.LibraryNamingConvention,
 		pythonconfig.BinaryNamingConvention,
 		pythonconfig.TestNamingConvention,
@@ -75,7 +192,86 @@ func (py *Configurer) KnownDirectives() []string {
 		pythonconfig.GenerateProto,
 		pythonconfig.PythonResolveSiblingImports,
 		pythonconfig.PythonIncludeAncestorConftest,
+		pythonconfig.DepsOrderFile,
+		pythonconfig.DepsOrderMode,
+		pythonconfig.EntryPointPolicy,
+		pythonconfig.ImportWeightsFile,
+		pythonconfig.ImportWeightBudget,
+		pythonconfig.OptionalImports,
+		pythonconfig.UnresolvedImports,
+		pythonconfig.GeneratedModule,
+		pythonconfig.NativeModule,
+		pythonconfig.LicenseLabel,
+		pythonconfig.ResolveVisibility,
+		pythonconfig.ResolveConflictPolicy,
+		pythonconfig.ToolingFilePattern,
+		pythonconfig.ImplicitNamespacePackages,
+		pythonconfig.ResolveStringAnnotations,
+		pythonconfig.FlattenSubpackages,
+		pythonconfig.FoldSubdirs,
+		pythonconfig.GenerateInitFiles,
+		pythonconfig.TestRunner,
+		pythonconfig.Profile,
+		pythonconfig.ResolveSymbol,
+		pythonconfig.ResolutionScope,
+		pythonconfig.DistributionTests,
+		pythonconfig.ThirdPartyPrefix,
+		pythonconfig.ExternalRepository,
+		pythonconfig.TypeStubPattern,
+		pythonconfig.AttachStubDeps,
+		pythonconfig.GenerateDepsFile,
+		pythonconfig.PackageData,
+		pythonconfig.TestTimingsFile,
+		pythonconfig.TestShardSeconds,
+		pythonconfig.TestShardFiles,
+		pythonconfig.TestShardCases,
+		pythonconfig.TestShardMax,
+		pythonconfig.WheelLockFile,
+		pythonconfig.TargetPlatforms,
+		pythonconfig.NamingStrategy,
+		pythonconfig.ResolveAncestorPackage,
+		pythonconfig.Opaque,
+		pythonconfig.PythonVersion,
+		pythonconfig.ShebangBinaries,
+		pythonconfig.PyprojectDependencies,
+		pythonconfig.GenerateWheel,
+		pythonconfig.GenerateDoctests,
+		pythonconfig.SrcsStrategy,
+		pythonconfig.TestonlyDirs,
+		pythonconfig.DefaultAttr,
+		pythonconfig.PytestMarker,
+		pythonconfig.NotebookConverter,
+		pythonconfig.ExcludeRegex,
+		pythonconfig.WrapperMacro,
+		pythonconfig.CoarseGrainedFacade,
+		pythonconfig.BinaryEntrypoints,
+		pythonconfig.GenerateCython,
+		// The annotation exempting a target from the deps order is also
+		// recognized above the rules, see addNoDepsOrderComments.
+		string(annotationKindNoDepsOrder),
+	}
+}
+
+// expandProfiles returns the directives with each python_profile directive
+// replaced by the directives of its preset, so that the directives following
+// it override the preset.
+func expandProfiles(directives []rule.Directive) ([]rule.Directive, error) {
+	expanded := make([]rule.Directive, 0, len(directives))
+	for _, d := range directives {
+		if d.Key != pythonconfig.Profile {
+			expanded = append(expanded, d)
+			continue
+		}
+		profileDirectives, ok := pythonconfig.ProfileDirectives(pythonconfig.ProfileType(strings.TrimSpace(d.Value)))
+		if !ok {
+			return nil, fmt.Errorf("invalid value for directive %q: %s: possible values are %s",
+				pythonconfig.Profile, d.Value, strings.Join(pythonconfig.ProfileNames(), "/"))
+		}
+		for _, pd := range profileDirectives {
+			expanded = append(expanded, rule.Directive{Key: pd.Key, Value: pd.Value})
+		}
 	}
+	return expanded, nil
 }
 
 // Configure modifies the configuration using directives and other information
@@ -93,6 +289,11 @@ func (py *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 	// Create the root config.
 	if _, exists := c.Exts[languageName]; !exists {
 		rootConfig := pythonconfig.New(c.RepoRoot, "")
+		visibilityFile, err := pythonconfig.LoadVisibilityFile(c.RepoRoot)
+		if err != nil {
+			log.Fatal(err)
+		}
+		rootConfig.SetVisibilityFile(visibilityFile)
 		c.Exts[languageName] = pythonconfig.Configs{"": rootConfig}
 	}
 
@@ -109,168 +310,608 @@ func (py *Configurer) Configure(c *config.Config, rel string, f *rule.File) {
 		return
 	}
 
-	gazelleManifestFilename := "gazelle_python.yaml"
+	directives, err := expandProfiles(f.Directives)
+	if err != nil {
+		log.Fatal(err)
+	}
+	deferred := deferredDirectives{manifestFilename: "gazelle_python.yaml"}
+	for _, d := range directives {
+		if err := configureDirective(c, rel, config, d, &deferred); err != nil {
+			log.Fatal(err)
+		}
+	}
 
-	for _, d := range f.Directives {
-		switch d.Key {
-		case "exclude":
-			// We record the exclude directive for coarse-grained packages
-			// since we do manual tree traversal in this mode.
-			config.AddExcludedPattern(filepath.Join(rel, strings.TrimSpace(d.Value)))
-		case pythonconfig.PythonExtensionDirective:
-			switch d.Value {
-			case "enabled":
-				config.SetExtensionEnabled(true)
-			case "disabled":
-				config.SetExtensionEnabled(false)
-			default:
-				err := fmt.Errorf("invalid value for directive %q: %s: possible values are enabled/disabled",
-					pythonconfig.PythonExtensionDirective, d.Value)
-				log.Fatal(err)
-			}
-		case pythonconfig.PythonRootDirective:
-			config.SetPythonProjectRoot(rel)
-			config.SetDefaultVisibility([]string{fmt.Sprintf(pythonconfig.DefaultVisibilityFmtString, rel)})
-		case pythonconfig.PythonManifestFileNameDirective:
-			gazelleManifestFilename = strings.TrimSpace(d.Value)
-		case pythonconfig.IgnoreFilesDirective:
-			for _, ignoreFile := range strings.Split(d.Value, ",") {
-				config.AddIgnoreFile(ignoreFile)
-			}
-		case pythonconfig.IgnoreDependenciesDirective:
-			for _, ignoreDependency := range strings.Split(d.Value, ",") {
-				config.AddIgnoreDependency(ignoreDependency)
-			}
-		case pythonconfig.ValidateImportStatementsDirective:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
-			}
-			config.SetValidateImportStatements(v)
-		case pythonconfig.GenerationMode:
-			switch pythonconfig.GenerationModeType(strings.TrimSpace(d.Value)) {
-			case pythonconfig.GenerationModePackage:
-				config.SetCoarseGrainedGeneration(false)
-				config.SetPerFileGeneration(false)
-			case pythonconfig.GenerationModeFile:
-				config.SetCoarseGrainedGeneration(false)
-				config.SetPerFileGeneration(true)
-			case pythonconfig.GenerationModeProject:
-				config.SetCoarseGrainedGeneration(true)
-				config.SetPerFileGeneration(false)
-			default:
-				err := fmt.Errorf("invalid value for directive %q: %s",
-					pythonconfig.GenerationMode, d.Value)
-				log.Fatal(err)
-			}
-		case pythonconfig.GenerationModePerFileIncludeInit:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
-			}
-			config.SetPerFileGenerationIncludeInit(v)
-		case pythonconfig.GenerationModePerPackageRequireTestEntryPoint:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Printf("invalid value for gazelle:%s in %q: %q",
-					pythonconfig.GenerationModePerPackageRequireTestEntryPoint, rel, d.Value)
-			} else {
-				config.SetPerPackageGenerationRequireTestEntryPoint(v)
-			}
-		case pythonconfig.LibraryNamingConvention:
-			config.SetLibraryNamingConvention(strings.TrimSpace(d.Value))
-		case pythonconfig.BinaryNamingConvention:
-			config.SetBinaryNamingConvention(strings.TrimSpace(d.Value))
-		case pythonconfig.TestNamingConvention:
-			config.SetTestNamingConvention(strings.TrimSpace(d.Value))
-		case pythonconfig.ProtoNamingConvention:
-			config.SetProtoNamingConvention(strings.TrimSpace(d.Value))
-		case pythonconfig.DefaultVisibilty:
-			switch directiveArg := strings.TrimSpace(d.Value); directiveArg {
-			case "NONE":
-				config.SetDefaultVisibility([]string{})
-			case "DEFAULT":
-				pythonProjectRoot := config.PythonProjectRoot()
-				defaultVisibility := fmt.Sprintf(pythonconfig.DefaultVisibilityFmtString, pythonProjectRoot)
-				config.SetDefaultVisibility([]string{defaultVisibility})
-			default:
-				// Handle injecting the python root. Assume that the user used the
-				// exact string "$python_root$".
-				labels := strings.ReplaceAll(directiveArg, "$python_root$", config.PythonProjectRoot())
-				config.SetDefaultVisibility(strings.Split(labels, ","))
-			}
-		case pythonconfig.Visibility:
-			labels := strings.ReplaceAll(strings.TrimSpace(d.Value), "$python_root$", config.PythonProjectRoot())
-			config.AppendVisibility(labels)
-		case pythonconfig.TestFilePattern:
-			value := strings.TrimSpace(d.Value)
-			if value == "" {
-				log.Fatal("directive 'python_test_file_pattern' requires a value")
-			}
-			globStrings := strings.Split(value, ",")
-			for _, g := range globStrings {
-				if !doublestar.ValidatePattern(g) {
-					log.Fatalf("invalid glob pattern '%s'", g)
-				}
-			}
-			config.SetTestFilePattern(globStrings)
-		case pythonconfig.LabelConvention:
-			value := strings.TrimSpace(d.Value)
-			if value == "" {
-				log.Fatalf("directive '%s' requires a value", pythonconfig.LabelConvention)
-			}
-			config.SetLabelConvention(value)
-		case pythonconfig.LabelNormalization:
-			switch directiveArg := strings.ToLower(strings.TrimSpace(d.Value)); directiveArg {
-			case "pep503":
-				config.SetLabelNormalization(pythonconfig.Pep503LabelNormalizationType)
-			case "none":
-				config.SetLabelNormalization(pythonconfig.NoLabelNormalizationType)
-			case "snake_case":
-				config.SetLabelNormalization(pythonconfig.SnakeCaseLabelNormalizationType)
-			default:
-				config.SetLabelNormalization(pythonconfig.DefaultLabelNormalizationType)
-			}
-		case pythonconfig.ExperimentalAllowRelativeImports:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Printf("invalid value for gazelle:%s in %q: %q",
-					pythonconfig.ExperimentalAllowRelativeImports, rel, d.Value)
-			}
-			config.SetExperimentalAllowRelativeImports(v)
-		case pythonconfig.GeneratePyiDeps:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
-			}
-			config.SetGeneratePyiDeps(v)
-		case pythonconfig.GeneratePyiSrcs:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
+	if err := addGeneratedModules(config, rel, f, deferred.generatedModules); err != nil {
+		log.Fatal(err)
+	}
+	if err := addNativeModules(config, rel, f, deferred.nativeModules); err != nil {
+		log.Fatal(err)
+	}
+	for _, value := range deferred.opaqueLibraries {
+		if err := addOpaqueLibrary(config, rel, value); err != nil {
+			log.Fatal(fmt.Errorf("invalid value for directive %q: %w", pythonconfig.Opaque, err))
+		}
+	}
+
+	if repository := config.PyprojectRepository(); repository != "" {
+		pyprojectPath := filepath.Join(c.RepoRoot, rel, pyprojectFilename)
+		config.SetPyprojectPath(pyprojectPath)
+		if err := addPyprojectDependencies(config, pyprojectPath, repository); err != nil {
+			log.Fatal(err)
+		}
+	}
+
+	gazelleManifestPath := filepath.Join(c.RepoRoot, rel, deferred.manifestFilename)
+	config.SetGazelleManifestPath(gazelleManifestPath)
+}
+
+// deferredDirectives are the values of the directives of a BUILD file applied
+// after all the others, as they depend on them, e.g. on python_root.
+type deferredDirectives struct {
+	manifestFilename string
+	generatedModules []string
+	nativeModules    []string
+	opaqueLibraries  []string
+}
+
+// configureDirective applies the directive d of the BUILD file of the package
+// rel to its configuration, or records it in deferred. It returns an error for
+// an invalid value, which Configure reports as fatal and the preflight phase
+// collects with the others.
+func configureDirective(c *config.Config, rel string, config *pythonconfig.Config, d rule.Directive, deferred *deferredDirectives) error {
+	switch d.Key {
+	case "exclude":
+		// We record the exclude directive for coarse-grained packages
+		// since we do manual tree traversal in this mode.
+		config.AddExcludedPattern(filepath.Join(rel, strings.TrimSpace(d.Value)))
+	case pythonconfig.PythonExtensionDirective:
+		switch d.Value {
+		case "enabled":
+			config.SetExtensionEnabled(true)
+		case "disabled":
+			config.SetExtensionEnabled(false)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s: possible values are enabled/disabled",
+				pythonconfig.PythonExtensionDirective, d.Value)
+		}
+	case pythonconfig.PythonRootDirective:
+		config.SetPythonProjectRoot(rel)
+		// A default visibility using placeholders is expanded for each
+		// python_root, so it's kept for the new project.
+		if !pythonconfig.HasVisibilityPlaceholder(config.DefaultVisibilty()) {
+			config.SetDefaultVisibility([]string{fmt.Sprintf(pythonconfig.DefaultVisibilityFmtString, "$python_root$")})
+		}
+	case pythonconfig.PythonManifestFileNameDirective:
+		deferred.manifestFilename = strings.TrimSpace(d.Value)
+	case pythonconfig.IgnoreFilesDirective:
+		for _, ignoreFile := range strings.Split(d.Value, ",") {
+			config.AddIgnoreFile(ignoreFile)
+		}
+	case pythonconfig.IgnoreDependenciesDirective:
+		for _, ignoreDependency := range strings.Split(d.Value, ",") {
+			config.AddIgnoreDependency(ignoreDependency)
+		}
+	case pythonconfig.ValidateImportStatementsDirective:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetValidateImportStatements(v)
+	case pythonconfig.GenerationMode:
+		switch pythonconfig.GenerationModeType(strings.TrimSpace(d.Value)) {
+		case pythonconfig.GenerationModePackage:
+			config.SetCoarseGrainedGeneration(false)
+			config.SetPerFileGeneration(false)
+		case pythonconfig.GenerationModeFile:
+			config.SetCoarseGrainedGeneration(false)
+			config.SetPerFileGeneration(true)
+		case pythonconfig.GenerationModeProject:
+			config.SetCoarseGrainedGeneration(true)
+			config.SetPerFileGeneration(false)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.GenerationMode, d.Value)
+		}
+	case pythonconfig.GenerationModePerFileIncludeInit:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetPerFileGenerationIncludeInit(v)
+	case pythonconfig.GenerationModePerFileMergeCycles:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetPerFileGenerationMergeCycles(v)
+	case pythonconfig.GenerationModePerFileTestUtils:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetPerFileGenerationTestUtils(v)
+	case pythonconfig.GenerationModePerPackageRequireTestEntryPoint:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			log.Printf("invalid value for gazelle:%s in %q: %q",
+				pythonconfig.GenerationModePerPackageRequireTestEntryPoint, rel, d.Value)
+		} else {
+			config.SetPerPackageGenerationRequireTestEntryPoint(v)
+		}
+	case pythonconfig.LibraryNamingConvention:
+		config.SetLibraryNamingConvention(strings.TrimSpace(d.Value))
+	case pythonconfig.BinaryNamingConvention:
+		config.SetBinaryNamingConvention(strings.TrimSpace(d.Value))
+	case pythonconfig.TestNamingConvention:
+		config.SetTestNamingConvention(strings.TrimSpace(d.Value))
+	case pythonconfig.ProtoNamingConvention:
+		config.SetProtoNamingConvention(strings.TrimSpace(d.Value))
+	case pythonconfig.DefaultVisibilty:
+		switch directiveArg := strings.TrimSpace(d.Value); directiveArg {
+		case "NONE":
+			config.DeclareDefaultVisibility([]string{})
+		case "DEFAULT":
+			// The python-visibility.yaml file, if any, applies again.
+			defaultVisibility := fmt.Sprintf(pythonconfig.DefaultVisibilityFmtString, "$python_root$")
+			config.SetDefaultVisibility([]string{defaultVisibility})
+		default:
+			// The "$python_root$" and "$package$" placeholders are expanded
+			// for each generated rule.
+			config.DeclareDefaultVisibility(strings.Split(directiveArg, ","))
+		}
+	case pythonconfig.Visibility:
+		config.AppendVisibility(strings.TrimSpace(d.Value))
+	case pythonconfig.TestFilePattern:
+		value := strings.TrimSpace(d.Value)
+		if value == "" {
+			return errors.New("directive 'python_test_file_pattern' requires a value")
+		}
+		globStrings := strings.Split(value, ",")
+		for _, g := range globStrings {
+			if !doublestar.ValidatePattern(g) {
+				return fmt.Errorf("invalid glob pattern '%s'", g)
 			}
-			config.SetGeneratePyiSrcs(v)
-		case pythonconfig.GenerateProto:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
+		}
+		config.SetTestFilePattern(globStrings)
+	case pythonconfig.ToolingFilePattern:
+		// An empty value resets the patterns, e.g. for a subtree.
+		var globStrings []string
+		if value := strings.TrimSpace(d.Value); value != "" {
+			globStrings = strings.Split(value, ",")
+		}
+		for _, g := range globStrings {
+			if !doublestar.ValidatePattern(g) {
+				return fmt.Errorf("invalid glob pattern '%s'", g)
 			}
-			config.SetGenerateProto(v)
-		case pythonconfig.PythonResolveSiblingImports:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
+		}
+		config.SetToolingFilePattern(globStrings)
+	case pythonconfig.TestonlyDirs:
+		// An empty value resets the directories, e.g. for a subtree.
+		var dirs []string
+		for _, dir := range strings.Split(d.Value, ",") {
+			if dir = strings.TrimSpace(dir); strings.Contains(dir, "/") {
+				return fmt.Errorf("invalid value for directive %q: %q: expected a directory name", pythonconfig.TestonlyDirs, dir)
+			} else if dir != "" {
+				dirs = append(dirs, dir)
 			}
-			config.SetResolveSiblingImports(v)
-		case pythonconfig.PythonIncludeAncestorConftest:
-			v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
-			if err != nil {
-				log.Fatal(err)
+		}
+		config.SetTestonlyDirs(dirs)
+	case pythonconfig.TypeStubPattern:
+		// An empty value disables the type stub packages, e.g. for a subtree.
+		var patterns []string
+		if value := strings.TrimSpace(d.Value); value != "" {
+			patterns = strings.Split(value, ",")
+		}
+		for _, pattern := range patterns {
+			if !strings.Contains(pattern, "$distribution_name$") {
+				return fmt.Errorf("invalid type stub pattern '%s': it must contain $distribution_name$", pattern)
 			}
-			config.SetIncludeAncestorConftest(v)
+		}
+		config.SetTypeStubPattern(patterns)
+	case pythonconfig.LabelConvention:
+		value := strings.TrimSpace(d.Value)
+		if value == "" {
+			return fmt.Errorf("directive '%s' requires a value", pythonconfig.LabelConvention)
+		}
+		config.SetLabelConvention(value)
+	case pythonconfig.LabelNormalization:
+		switch directiveArg := strings.ToLower(strings.TrimSpace(d.Value)); directiveArg {
+		case "pep503":
+			config.SetLabelNormalization(pythonconfig.Pep503LabelNormalizationType)
+		case "none":
+			config.SetLabelNormalization(pythonconfig.NoLabelNormalizationType)
+		case "snake_case":
+			config.SetLabelNormalization(pythonconfig.SnakeCaseLabelNormalizationType)
+		default:
+			config.SetLabelNormalization(pythonconfig.DefaultLabelNormalizationType)
+		}
+	case pythonconfig.ExperimentalAllowRelativeImports:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			log.Printf("invalid value for gazelle:%s in %q: %q",
+				pythonconfig.ExperimentalAllowRelativeImports, rel, d.Value)
+		}
+		config.SetExperimentalAllowRelativeImports(v)
+	case pythonconfig.GeneratePyiDeps:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGeneratePyiDeps(v)
+	case pythonconfig.GeneratePyiSrcs:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGeneratePyiSrcs(v)
+	case pythonconfig.GenerateProto:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGenerateProto(v)
+	case pythonconfig.PythonResolveSiblingImports:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetResolveSiblingImports(v)
+	case pythonconfig.PythonIncludeAncestorConftest:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetIncludeAncestorConftest(v)
+	case pythonconfig.ImplicitNamespacePackages:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetImplicitNamespacePackages(v)
+	case pythonconfig.ResolveStringAnnotations:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetResolveStringAnnotations(v)
+	case pythonconfig.BinaryEntrypoints:
+		names, err := parseBinaryEntrypoints(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.BinaryEntrypoints, err)
+		}
+		config.SetBinaryEntrypoints(names)
+	case pythonconfig.GenerateCython:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGenerateCython(v)
+	case pythonconfig.CoarseGrainedFacade:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetCoarseGrainedFacade(rel, v)
+	case pythonconfig.FlattenSubpackages:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetFlattenSubpackages(v)
+	case pythonconfig.FoldSubdirs:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetFoldSubdirs(v)
+	case pythonconfig.GenerateInitFiles:
+		switch mode := pythonconfig.InitFilesModeType(strings.TrimSpace(d.Value)); mode {
+		case pythonconfig.InitFilesModeNone, pythonconfig.InitFilesModeEmpty, pythonconfig.InitFilesModeNamespace:
+			config.SetInitFilesMode(mode)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.GenerateInitFiles, d.Value)
+		}
+	case pythonconfig.TestRunner:
+		testRunner, args, err := parseTestRunner(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.TestRunner, err)
+		}
+		config.SetTestRunner(testRunner, args)
+	case pythonconfig.GenerateDepsFile:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGenerateDepsFile(v)
+	case pythonconfig.DepsOrderFile:
+		value := strings.TrimSpace(d.Value)
+		if value == "" {
+			return fmt.Errorf("directive '%s' requires a value", pythonconfig.DepsOrderFile)
+		}
+		config.SetDepsOrderPath(filepath.Join(c.RepoRoot, rel, value))
+	case pythonconfig.DepsOrderMode:
+		switch mode := pythonconfig.DepsOrderModeType(strings.TrimSpace(d.Value)); mode {
+		case pythonconfig.DepsOrderModeRemove, pythonconfig.DepsOrderModeError:
+			config.SetDepsOrderMode(mode)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.DepsOrderMode, d.Value)
+		}
+	case pythonconfig.AttachStubDeps:
+		switch mode := pythonconfig.AttachStubDepsModeType(strings.TrimSpace(d.Value)); mode {
+		case pythonconfig.AttachStubDepsNever, pythonconfig.AttachStubDepsPyiOnly, pythonconfig.AttachStubDepsRuntime:
+			config.SetAttachStubDepsMode(mode)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.AttachStubDeps, d.Value)
+		}
+	case pythonconfig.OptionalImports:
+		switch mode := pythonconfig.OptionalImportsModeType(strings.TrimSpace(d.Value)); mode {
+		case pythonconfig.OptionalImportsModeIgnore, pythonconfig.OptionalImportsModeAdd, pythonconfig.OptionalImportsModeIfAvailable,
+			pythonconfig.OptionalImportsModeTag:
+			config.SetOptionalImportsMode(mode)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.OptionalImports, d.Value)
+		}
+	case pythonconfig.PackageData:
+		mode, target, err := parsePackageData(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %v", pythonconfig.PackageData, err)
+		}
+		config.SetPackageData(mode, target)
+	case pythonconfig.UnresolvedImports:
+		switch mode := pythonconfig.UnresolvedImportsModeType(strings.TrimSpace(d.Value)); mode {
+		case pythonconfig.UnresolvedImportsModeError, pythonconfig.UnresolvedImportsModeTag:
+			config.SetUnresolvedImportsMode(mode)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.UnresolvedImports, d.Value)
+		}
+	case pythonconfig.ResolveVisibility:
+		switch mode := pythonconfig.ResolveVisibilityModeType(strings.TrimSpace(d.Value)); mode {
+		case pythonconfig.ResolveVisibilityModeIgnore, pythonconfig.ResolveVisibilityModePrefer, pythonconfig.ResolveVisibilityModeRequire, pythonconfig.ResolveVisibilityModeWarn:
+			config.SetResolveVisibilityMode(mode)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.ResolveVisibility, d.Value)
+		}
+	case pythonconfig.ResolveConflictPolicy:
+		switch policy := pythonconfig.ResolveConflictPolicyType(strings.TrimSpace(d.Value)); policy {
+		case pythonconfig.ResolveConflictPolicyError, pythonconfig.ResolveConflictPolicyFirst,
+			pythonconfig.ResolveConflictPolicyNearest, pythonconfig.ResolveConflictPolicySkip:
+			config.SetResolveConflictPolicy(policy)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.ResolveConflictPolicy, d.Value)
+		}
+	case pythonconfig.ResolutionScope:
+		switch scope := pythonconfig.ResolutionScopeType(strings.TrimSpace(d.Value)); scope {
+		case pythonconfig.ResolutionScopeRepository, pythonconfig.ResolutionScopeProject:
+			config.SetResolutionScope(scope)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.ResolutionScope, d.Value)
+		}
+	case pythonconfig.DistributionTests:
+		filename := strings.TrimSpace(d.Value)
+		if filename == "" || filepath.Base(filename) != filename || filepath.Ext(filename) != ".py" {
+			return fmt.Errorf("invalid value for directive %q: %q: expected a Python file of the package",
+				pythonconfig.DistributionTests, d.Value)
+		}
+		config.SetDistributionTests(filename)
+	case pythonconfig.EntryPointPolicy:
+		fields := strings.Fields(d.Value)
+		if len(fields) == 0 {
+			return fmt.Errorf("directive '%s' requires a value", pythonconfig.EntryPointPolicy)
+		}
+		switch kind := pythonconfig.EntryPointPolicyKind(fields[0]); kind {
+		case pythonconfig.EntryPointPolicyTest, pythonconfig.EntryPointPolicyBinary:
+			config.SetEntryPointPolicy(kind, fields[1:])
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s: the kind of targets must be %q or %q",
+				pythonconfig.EntryPointPolicy, d.Value, pythonconfig.EntryPointPolicyTest, pythonconfig.EntryPointPolicyBinary)
+		}
+	case pythonconfig.ImportWeightsFile:
+		value := strings.TrimSpace(d.Value)
+		if value == "" {
+			return fmt.Errorf("directive '%s' requires a value", pythonconfig.ImportWeightsFile)
+		}
+		config.SetImportWeightsPath(filepath.Join(c.RepoRoot, rel, value))
+	case pythonconfig.ImportWeightBudget:
+		budget, err := strconv.Atoi(strings.TrimSpace(d.Value))
+		if err != nil || budget < 0 {
+			return fmt.Errorf("invalid value for directive %q: %s: the budget must be a non-negative integer",
+				pythonconfig.ImportWeightBudget, d.Value)
+		}
+		config.SetImportWeightBudget(budget)
+	case pythonconfig.TestTimingsFile:
+		value := strings.TrimSpace(d.Value)
+		if value == "" {
+			return fmt.Errorf("directive '%s' requires a value", pythonconfig.TestTimingsFile)
+		}
+		config.SetTestTimingsPath(filepath.Join(c.RepoRoot, rel, value))
+	case pythonconfig.TestShardSeconds:
+		seconds, err := strconv.Atoi(strings.TrimSpace(d.Value))
+		if err != nil || seconds < 0 {
+			return fmt.Errorf("invalid value for directive %q: %s: the duration must be a non-negative integer",
+				pythonconfig.TestShardSeconds, d.Value)
+		}
+		config.SetTestShardSeconds(seconds)
+	case pythonconfig.TestShardFiles:
+		files, err := strconv.Atoi(strings.TrimSpace(d.Value))
+		if err != nil || files < 0 {
+			return fmt.Errorf("invalid value for directive %q: %s: the number of files must be a non-negative integer",
+				pythonconfig.TestShardFiles, d.Value)
+		}
+		config.SetTestShardFiles(files)
+	case pythonconfig.TestShardCases:
+		cases, err := strconv.Atoi(strings.TrimSpace(d.Value))
+		if err != nil || cases < 0 {
+			return fmt.Errorf("invalid value for directive %q: %s: the number of test cases must be a non-negative integer",
+				pythonconfig.TestShardCases, d.Value)
+		}
+		config.SetTestShardCases(cases)
+	case pythonconfig.TestShardMax:
+		maxCount, err := strconv.Atoi(strings.TrimSpace(d.Value))
+		if err != nil || maxCount < 0 {
+			return fmt.Errorf("invalid value for directive %q: %s: the shard_count must be a non-negative integer",
+				pythonconfig.TestShardMax, d.Value)
+		}
+		config.SetTestShardMax(maxCount)
+	case pythonconfig.WheelLockFile:
+		value := strings.TrimSpace(d.Value)
+		if value == "" {
+			return fmt.Errorf("directive '%s' requires a value", pythonconfig.WheelLockFile)
+		}
+		config.SetWheelLockPath(filepath.Join(c.RepoRoot, rel, value))
+	case pythonconfig.TargetPlatforms:
+		platforms, err := parseTargetPlatforms(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.TargetPlatforms, err)
+		}
+		config.SetTargetPlatforms(platforms)
+	case pythonconfig.NamingStrategy:
+		name := strings.TrimSpace(d.Value)
+		if _, ok := pythonconfig.LookupNamingStrategy(name); !ok {
+			return fmt.Errorf("invalid value for directive %q: %s: must be one of %s",
+				pythonconfig.NamingStrategy, d.Value, strings.Join(pythonconfig.NamingStrategies(), ", "))
+		}
+		config.SetNamingStrategy(name)
+	case pythonconfig.ResolveAncestorPackage:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetResolveAncestorPackage(v)
+	case pythonconfig.ShebangBinaries:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetShebangBinaries(v)
+	case pythonconfig.GenerateWheel:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGenerateWheel(v)
+	case pythonconfig.GenerateDoctests:
+		v, err := strconv.ParseBool(strings.TrimSpace(d.Value))
+		if err != nil {
+			return err
+		}
+		config.SetGenerateDoctests(v)
+	case pythonconfig.SrcsStrategy:
+		switch strategy := pythonconfig.SrcsStrategyType(strings.TrimSpace(d.Value)); strategy {
+		case pythonconfig.SrcsStrategyList, pythonconfig.SrcsStrategyGlob:
+			config.SetSrcsStrategy(strategy)
+		default:
+			return fmt.Errorf("invalid value for directive %q: %s",
+				pythonconfig.SrcsStrategy, d.Value)
+		}
+	case pythonconfig.PyprojectDependencies:
+		config.SetPyprojectRepository(strings.TrimSpace(d.Value))
+	case pythonconfig.PythonVersion:
+		minor, err := parsePythonVersion(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.PythonVersion, err)
+		}
+		config.SetPythonVersion(minor)
+	case pythonconfig.GeneratedModule:
+		if _, _, err := parseGeneratedModule(rel, d.Value); err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.GeneratedModule, err)
+		}
+		deferred.generatedModules = append(deferred.generatedModules, d.Value)
+	case pythonconfig.NativeModule:
+		if _, _, err := parseNativeModule(rel, d.Value); err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.NativeModule, err)
+		}
+		deferred.nativeModules = append(deferred.nativeModules, d.Value)
+	case pythonconfig.Opaque:
+		if _, err := parseOpaque(rel, d.Value); err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.Opaque, err)
+		}
+		deferred.opaqueLibraries = append(deferred.opaqueLibraries, d.Value)
+	case pythonconfig.DefaultAttr:
+		kind, attr, value, err := parseDefaultAttr(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.DefaultAttr, err)
+		}
+		config.SetDefaultAttr(kind, attr, value)
+	case pythonconfig.PytestMarker:
+		name, marker, err := parsePytestMarker(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.PytestMarker, err)
+		}
+		config.SetPytestMarker(name, marker)
+	case pythonconfig.NotebookConverter:
+		converter, err := parseNotebookConverter(rel, d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.NotebookConverter, err)
+		}
+		config.SetNotebookConverter(converter)
+	case pythonconfig.WrapperMacro:
+		// The macros are registered as kinds from the root BUILD file,
+		// see loadWrapperMacros.
+		if rel != "" {
+			return fmt.Errorf("the directive %q is only supported in the root BUILD file", pythonconfig.WrapperMacro)
+		}
+		macro, err := parseWrapperMacro(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.WrapperMacro, err)
+		}
+		config.AddWrapperMacro(macro)
+	case pythonconfig.ExcludeRegex:
+		// An empty value resets the expressions, e.g. for a subtree.
+		if value := strings.TrimSpace(d.Value); value == "" {
+			config.ResetExcludeRegexes()
+		} else if re, err := regexp.Compile(value); err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.ExcludeRegex, err)
+		} else {
+			config.AddExcludeRegex(re)
+		}
+	case pythonconfig.LicenseLabel:
+		license, l, err := parseLicenseLabel(rel, d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.LicenseLabel, err)
+		}
+		config.SetLicenseLabel(license, l)
+	case pythonconfig.ResolveSymbol:
+		module, symbol, l, err := parseResolveSymbol(rel, d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.ResolveSymbol, err)
+		}
+		config.SetSymbolResolve(module, symbol, l)
+	case "resolve":
+		// The resolve configurer records the exact overrides, while the
+		// wildcard ones, e.g. foo.bar.*, are looked up by the resolver.
+		prefix, l, ok, err := parseResolveWildcard(rel, d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", "resolve", err)
+		}
+		if ok {
+			config.SetWildcardResolve(prefix, l)
+		}
+	case pythonconfig.ThirdPartyPrefix:
+		prefix, template, err := parseThirdPartyPrefix(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.ThirdPartyPrefix, err)
+		}
+		config.AddThirdPartyPrefix(prefix, template, rel)
+	case pythonconfig.ExternalRepository:
+		name, path, err := parseExternalRepository(d.Value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.ExternalRepository, err)
+		}
+		config.AddExternalRepository(name, externalRepositoryPath(c.RepoRoot, rel, path))
+	case string(annotationKindNoDepsOrder):
+		// The annotation is only recognized without a value above the rules,
+		// see addNoDepsOrderComments.
+		if strings.TrimSpace(d.Value) != "" {
+			return fmt.Errorf("the directive %q takes no value", string(annotationKindNoDepsOrder))
 		}
 	}
-
-	gazelleManifestPath := filepath.Join(c.RepoRoot, rel, gazelleManifestFilename)
-	config.SetGazelleManifestPath(gazelleManifestPath)
+	return nil
 }
@@ -0,0 +1,66 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// resolveConflict picks the match an import resolves to, according to the
+// python_resolve_conflict_policy directive, when several targets provide its
+// module. It returns false when the policy doesn't pick any of them. Ties are
+// broken by the order of the labels, so the result is stable.
+func resolveConflict(policy pythonconfig.ResolveConflictPolicyType, matches []resolve.FindResult, pkg string) (resolve.FindResult, bool) {
+	sorted := append([]resolve.FindResult{}, matches...)
+	sort.SliceStable(sorted, func(i, j int) bool {
+		return sorted[i].Label.String() < sorted[j].Label.String()
+	})
+	switch policy {
+	case pythonconfig.ResolveConflictPolicyFirst:
+		return sorted[0], true
+	case pythonconfig.ResolveConflictPolicyNearest:
+		nearest := sorted[0]
+		for _, match := range sorted[1:] {
+			if packageDistance(pkg, match.Label.Pkg) < packageDistance(pkg, nearest.Label.Pkg) {
+				nearest = match
+			}
+		}
+		return nearest, true
+	default:
+		return resolve.FindResult{}, false
+	}
+}
+
+// packageDistance returns the number of directories between the packages a
+// and b, going through their closest common ancestor.
+func packageDistance(a, b string) int {
+	var aParts, bParts []string
+	if a != "" {
+		aParts = strings.Split(a, "/")
+	}
+	if b != "" {
+		bParts = strings.Split(b, "/")
+	}
+	common := 0
+	for common < len(aParts) && common < len(bParts) && aParts[common] == bParts[common] {
+		common++
+	}
+	return len(aParts) - common + len(bParts) - common
+}
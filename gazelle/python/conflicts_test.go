@@ -0,0 +1,63 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestPackageDistance(t *testing.T) {
+	assert.Equal(t, 0, packageDistance("", ""))
+	assert.Equal(t, 0, packageDistance("foo/bar", "foo/bar"))
+	assert.Equal(t, 2, packageDistance("", "foo/bar"))
+	assert.Equal(t, 1, packageDistance("foo/bar", "foo"))
+	assert.Equal(t, 3, packageDistance("foo/bar", "foo/baz/qux"))
+	assert.Equal(t, 2, packageDistance("foo", "bar"))
+}
+
+func TestResolveConflict(t *testing.T) {
+	matches := []resolve.FindResult{
+		{Label: label.New("", "vendored/util", "util")},
+		{Label: label.New("", "lib", "util")},
+		{Label: label.New("", "app/util", "util")},
+	}
+
+	match, ok := resolveConflict(pythonconfig.ResolveConflictPolicyFirst, matches, "app")
+	assert.True(t, ok)
+	assert.Equal(t, "//app/util", match.Label.String())
+
+	match, ok = resolveConflict(pythonconfig.ResolveConflictPolicyNearest, matches, "vendored")
+	assert.True(t, ok)
+	assert.Equal(t, "//vendored/util", match.Label.String())
+
+	match, ok = resolveConflict(pythonconfig.ResolveConflictPolicyNearest, matches, "lib/sub")
+	assert.True(t, ok)
+	assert.Equal(t, "//lib:util", match.Label.String())
+
+	// //app/util and //vendored/util are both 2 directories away, the first
+	// label wins.
+	match, ok = resolveConflict(pythonconfig.ResolveConflictPolicyNearest, []resolve.FindResult{matches[0], matches[2]}, "")
+	assert.True(t, ok)
+	assert.Equal(t, "//app/util", match.Label.String())
+
+	_, ok = resolveConflict(pythonconfig.ResolveConflictPolicyError, matches, "app")
+	assert.False(t, ok)
+}
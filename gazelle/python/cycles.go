@@ -0,0 +1,220 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+)
+
+// importGraph is the first-party dependency graph between the generated
+// targets. Each edge remembers the import that introduced it.
+type importGraph struct {
+	edges map[string]map[string]Module
+}
+
+// importEdge is an edge of the importGraph.
+type importEdge struct {
+	From   string `json:"from"`
+	To     string `json:"to"`
+	File   string `json:"file"`
+	Line   uint32 `json:"line"`
+	Import string `json:"import"`
+}
+
+// importCycle is a strongly-connected component of the importGraph.
+type importCycle struct {
+	// Targets are all the targets of the component, sorted.
+	Targets []string `json:"targets"`
+	// Chain is one of the shortest cycles going through the first target.
+	Chain []importEdge `json:"chain"`
+}
+
+// cycleReport is the format of the file written with -python_cycle_report.
+type cycleReport struct {
+	Cycles []importCycle `json:"cycles"`
+}
+
+// addEdge records that the target from depends on the target to because of
+// the import mod. Only the first import introducing an edge is kept.
+func (g *importGraph) addEdge(from, to string, mod Module) {
+	if g.edges == nil {
+		g.edges = make(map[string]map[string]Module)
+	}
+	if g.edges[from] == nil {
+		g.edges[from] = make(map[string]Module)
+	}
+	if _, ok := g.edges[from][to]; !ok {
+		g.edges[from][to] = mod
+	}
+}
+
+// successors returns the sorted targets the target from depends on.
+func (g *importGraph) successors(from string) []string {
+	succ := make([]string, 0, len(g.edges[from]))
+	for to := range g.edges[from] {
+		succ = append(succ, to)
+	}
+	sort.Strings(succ)
+	return succ
+}
+
+// stronglyConnectedComponents returns the components of the graph with more
+// than one target, using Tarjan's algorithm. Both the components and their
+// targets are sorted, so the result is deterministic.
+func (g *importGraph) stronglyConnectedComponents() [][]string {
+	nodes := make([]string, 0, len(g.edges))
+	for from := range g.edges {
+		nodes = append(nodes, from)
+	}
+	sort.Strings(nodes)
+
+	index := make(map[string]int)
+	lowLink := make(map[string]int)
+	onStack := make(map[string]bool)
+	var stack []string
+	var components [][]string
+
+	var strongConnect func(v string)
+	strongConnect = func(v string) {
+		index[v] = len(index)
+		lowLink[v] = index[v]
+		stack = append(stack, v)
+		onStack[v] = true
+		for _, w := range g.successors(v) {
+			if _, visited := index[w]; !visited {
+				strongConnect(w)
+				lowLink[v] = min(lowLink[v], lowLink[w])
+			} else if onStack[w] {
+				lowLink[v] = min(lowLink[v], index[w])
+			}
+		}
+		if lowLink[v] != index[v] {
+			return
+		}
+		var component []string
+		for {
+			w := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			onStack[w] = false
+			component = append(component, w)
+			if w == v {
+				break
+			}
+		}
+		if len(component) > 1 {
+			sort.Strings(component)
+			components = append(components, component)
+		}
+	}
+	for _, v := range nodes {
+		if _, visited := index[v]; !visited {
+			strongConnect(v)
+		}
+	}
+	sort.Slice(components, func(i, j int) bool {
+		return components[i][0] < components[j][0]
+	})
+	return components
+}
+
+// cycles returns the import cycles of the graph.
+func (g *importGraph) cycles() []importCycle {
+	var cycles []importCycle
+	for _, component := range g.stronglyConnectedComponents() {
+		cycles = append(cycles, importCycle{
+			Targets: component,
+			Chain:   g.shortestCycle(component),
+		})
+	}
+	return cycles
+}
+
+// shortestCycle returns the edges of a shortest cycle going through the first
+// target of the component, using a breadth-first search restricted to the
+// component.
+func (g *importGraph) shortestCycle(component []string) []importEdge {
+	inComponent := make(map[string]bool, len(component))
+	for _, target := range component {
+		inComponent[target] = true
+	}
+	start := component[0]
+	parent := map[string]string{start: ""}
+	queue := []string{start}
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for _, w := range g.successors(v) {
+			if !inComponent[w] {
+				continue
+			}
+			if w == start {
+				var chain []importEdge
+				for to, from := start, v; from != ""; to, from = from, parent[from] {
+					chain = append(chain, g.edge(from, to))
+				}
+				for i, j := 0, len(chain)-1; i < j; i, j = i+1, j-1 {
+					chain[i], chain[j] = chain[j], chain[i]
+				}
+				return chain
+			}
+			if _, seen := parent[w]; !seen {
+				parent[w] = v
+				queue = append(queue, w)
+			}
+		}
+	}
+	return nil
+}
+
+func (g *importGraph) edge(from, to string) importEdge {
+	mod := g.edges[from][to]
+	return importEdge{
+		From:   from,
+		To:     to,
+		File:   mod.Filepath,
+		Line:   mod.LineNumber,
+		Import: mod.Name,
+	}
+}
+
+// String returns a human-readable description of the cycle.
+func (c importCycle) String() string {
+	var sb strings.Builder
+	fmt.Fprintf(&sb, "import cycle between %d targets (%s):\n", len(c.Targets), strings.Join(c.Targets, ", "))
+	for _, edge := range c.Chain {
+		fmt.Fprintf(&sb, "\t%s -> %s: %q, line %d: imports %q\n", edge.From, edge.To, edge.File, edge.Line, edge.Import)
+	}
+	return sb.String()
+}
+
+// writeCycleReport writes the cycles as JSON to the given path.
+func writeCycleReport(path string, cycles []importCycle) error {
+	report := cycleReport{Cycles: cycles}
+	if report.Cycles == nil {
+		report.Cycles = []importCycle{}
+	}
+	data, err := json.MarshalIndent(report, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the cycle report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the cycle report: %w", err)
+	}
+	return nil
+}
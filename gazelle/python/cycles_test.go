@@ -0,0 +1,78 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportGraphCycles(t *testing.T) {
+	var g importGraph
+	g.addEdge("//a", "//b", Module{Name: "b", Filepath: "a/__init__.py", LineNumber: 1})
+	g.addEdge("//b", "//c", Module{Name: "c", Filepath: "b/__init__.py", LineNumber: 2})
+	g.addEdge("//c", "//a", Module{Name: "a", Filepath: "c/__init__.py", LineNumber: 3})
+	g.addEdge("//b", "//a", Module{Name: "a.x", Filepath: "b/__init__.py", LineNumber: 4})
+	g.addEdge("//b", "//a", Module{Name: "a.y", Filepath: "b/__init__.py", LineNumber: 5})
+	g.addEdge("//d", "//a", Module{Name: "a", Filepath: "d/__init__.py", LineNumber: 1})
+	g.addEdge("//e", "//f", Module{Name: "f", Filepath: "e/__init__.py", LineNumber: 1})
+	g.addEdge("//f", "//e", Module{Name: "e", Filepath: "f/__init__.py", LineNumber: 1})
+
+	cycles := g.cycles()
+	assert.Equal(t, []importCycle{
+		{
+			Targets: []string{"//a", "//b", "//c"},
+			Chain: []importEdge{
+				{From: "//a", To: "//b", File: "a/__init__.py", Line: 1, Import: "b"},
+				{From: "//b", To: "//a", File: "b/__init__.py", Line: 4, Import: "a.x"},
+			},
+		},
+		{
+			Targets: []string{"//e", "//f"},
+			Chain: []importEdge{
+				{From: "//e", To: "//f", File: "e/__init__.py", Line: 1, Import: "f"},
+				{From: "//f", To: "//e", File: "f/__init__.py", Line: 1, Import: "e"},
+			},
+		},
+	}, cycles)
+	assert.Equal(t, "import cycle between 2 targets (//e, //f):\n"+
+		"\t//e -> //f: \"e/__init__.py\", line 1: imports \"f\"\n"+
+		"\t//f -> //e: \"f/__init__.py\", line 1: imports \"e\"\n", cycles[1].String())
+}
+
+func TestImportGraphWithoutCycles(t *testing.T) {
+	var g importGraph
+	g.addEdge("//a", "//b", Module{Name: "b"})
+	g.addEdge("//b", "//c", Module{Name: "c"})
+	g.addEdge("//a", "//c", Module{Name: "c"})
+	assert.Empty(t, g.cycles())
+
+	path := filepath.Join(t.TempDir(), "cycles.json")
+	if !assert.NoError(t, writeCycleReport(path, g.cycles())) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var report cycleReport
+	assert.NoError(t, json.Unmarshal(data, &report))
+	assert.NotNil(t, report.Cycles)
+	assert.Empty(t, report.Cycles)
+}
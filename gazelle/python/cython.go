@@ -0,0 +1,218 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bufio"
+	"bytes"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/lists/singlylinkedlist"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	// pyxLibraryKind is the kind of the targets compiling the Cython sources
+	// into extension modules, see python_generate_cython.
+	pyxLibraryKind = "pyx_library"
+	// pyxExt and pxdExt are the extensions of the Cython implementation and
+	// declaration files.
+	pyxExt = ".pyx"
+	pxdExt = ".pxd"
+	// cythonTargetSuffix is the suffix of the name of the pyx_library of a
+	// package, added to the name of its py_library.
+	cythonTargetSuffix = "_pyx"
+)
+
+// cythonBuiltinPackages are the packages shipped with Cython, whose imports
+// and cimports have no dependency.
+var cythonBuiltinPackages = map[string]bool{
+	"cpython": true,
+	"cython":  true,
+	"libc":    true,
+	"libcpp":  true,
+	"posix":   true,
+}
+
+var (
+	// cythonImportRe matches the `import a.b as c, d` and `cimport a.b`
+	// statements.
+	cythonImportRe = regexp.MustCompile(`^(?:c?import)\s+(.+)$`)
+	// cythonFromImportRe matches the `from a.b import c, d` and
+	// `from a.b cimport c` statements.
+	cythonFromImportRe = regexp.MustCompile(`^from\s+(\S+)\s+(?:c?import)\s+(.+)$`)
+)
+
+// isCythonSource returns whether the file is a Cython implementation or
+// declaration file.
+func isCythonSource(f string) bool {
+	ext := filepath.Ext(f)
+	return ext == pyxExt || ext == pxdExt
+}
+
+// parseCythonImports returns the modules imported or cimported by the Cython
+// code of the file at path, relative to the repository root. The Cython syntax
+// isn't Python, so the statements are matched line by line, joining the
+// continued ones and the parenthesized names of the from imports. The packages shipped with Cython,
+// e.g. libc, are skipped.
+func parseCythonImports(code []byte, path string) []Module {
+	var modules []Module
+	add := func(name, from string, lineNumber uint32) {
+		top, _, _ := strings.Cut(strings.TrimLeft(name, "."), ".")
+		if name == "" || cythonBuiltinPackages[top] {
+			return
+		}
+		modules = append(modules, Module{Name: name, LineNumber: lineNumber, Filepath: path, From: from})
+	}
+
+	scanner := bufio.NewScanner(bytes.NewReader(code))
+	var statement string
+	var lineNumber, statementLine uint32
+	for scanner.Scan() {
+		lineNumber++
+		line, _, _ := strings.Cut(scanner.Text(), "#")
+		line = strings.TrimSpace(line)
+		if statement == "" {
+			statementLine = lineNumber
+		}
+		statement = strings.TrimSpace(statement + " " + strings.TrimSuffix(line, `\`))
+		if strings.HasSuffix(line, `\`) ||
+			(strings.HasPrefix(statement, "from ") && strings.Count(statement, "(") > strings.Count(statement, ")")) {
+			continue
+		}
+		current := statement
+		statement = ""
+
+		if m := cythonFromImportRe.FindStringSubmatch(current); m != nil {
+			from := m[1]
+			names := strings.Trim(m[2], "() ")
+			if names == "*" {
+				add(from, from, statementLine)
+				continue
+			}
+			for _, name := range strings.Split(names, ",") {
+				name, _, _ = strings.Cut(strings.TrimSpace(name), " as ")
+				name = strings.TrimSpace(name)
+				if name == "" {
+					continue
+				}
+				if strings.HasSuffix(from, ".") {
+					add(from+name, from, statementLine)
+				} else {
+					add(from+"."+name, from, statementLine)
+				}
+			}
+		} else if m := cythonImportRe.FindStringSubmatch(current); m != nil {
+			for _, name := range strings.Split(m[1], ",") {
+				name, _, _ = strings.Cut(strings.TrimSpace(name), " as ")
+				add(strings.TrimSpace(name), "", statementLine)
+			}
+		}
+	}
+	return modules
+}
+
+// cythonImports returns the ImportSpecs of the extension modules compiled
+// from the Cython sources of the pyx_library r, which the cimports resolve to
+// as well.
+func cythonImports(pythonProjectRoot, pkg string, r *rule.Rule) []resolve.ImportSpec {
+	var provides []resolve.ImportSpec
+	seen := make(map[string]bool)
+	for _, src := range r.AttrStrings("srcs") {
+		if !isCythonSource(src) {
+			continue
+		}
+		provide := importSpecFromSrc(pythonProjectRoot, pkg, strings.TrimSuffix(src, filepath.Ext(src))+".py")
+		if !seen[provide.Imp] {
+			seen[provide.Imp] = true
+			provides = append(provides, provide)
+		}
+	}
+	return provides
+}
+
+// generateCythonLibrary generates, with python_generate_cython, a
+// pyx_library with the Cython sources of the package, whose deps are resolved
+// from their imports and cimports. The pyx_library of a package without
+// Cython sources anymore is emptied.
+func generateCythonLibrary(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	name string,
+	result *language.GenerateResult,
+	collisionErrors *singlylinkedlist.List,
+) {
+	srcs := treeset.NewWith(godsutils.StringComparator)
+	for _, f := range args.RegularFiles {
+		if isCythonSource(f) && !cfg.IgnoresFile(filepath.Base(f)) && !cfg.ExcludesPath(filepath.Join(args.Rel, f)) {
+			srcs.Add(f)
+		}
+	}
+	if srcs.Empty() {
+		if args.File != nil {
+			for _, r := range args.File.Rules {
+				if r.Name() == name && kindMatches(args.Config, r, pyxLibraryKind) {
+					result.Empty = append(result.Empty, rule.NewRule(pyxLibraryKind, name))
+				}
+			}
+		}
+		return
+	}
+	if err := ensureNoCollision(args.Config, args.File, name, pyxLibraryKind); err != nil {
+		fqTarget := label.New("", args.Rel, name)
+		collisionErrors.Add(fmt.Errorf("failed to generate target %q of kind %q for the Cython sources: %w",
+			fqTarget.String(), getMappedKind(args.Config, pyxLibraryKind), err))
+		return
+	}
+
+	deps := treeset.NewWith(moduleComparator)
+	for _, src := range srcs.Values() {
+		code, err := os.ReadFile(filepath.Join(args.Dir, src.(string)))
+		if err != nil {
+			log.Printf("ERROR: %v\n", err)
+			continue
+		}
+		for _, mod := range parseCythonImports(code, filepath.Join(args.Rel, src.(string))) {
+			if cfg.IgnoresDependency(mod.Name) || (mod.From != "" && cfg.IgnoresDependency(mod.From)) {
+				continue
+			}
+			addModuleToTreeSet(deps, mod)
+		}
+	}
+	pyxLibrary := newTargetBuilder(pyxLibraryKind, name, pythonProjectRoot, args.Rel, pyFileNames, false).
+		addVisibility(visibility).
+		addSrcs(srcs).
+		addModuleDependencies(deps).
+		generateImportsAttribute().
+		build()
+	result.Gen = append(result.Gen, pyxLibrary)
+	result.Imports = append(result.Imports, pyxLibrary.PrivateAttr(config.GazelleImportsKey))
+}
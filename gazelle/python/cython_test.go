@@ -0,0 +1,83 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseCythonImports(t *testing.T) {
+	code := []byte(`# cython: language_level=3
+import numpy as np, os.path
+cimport numpy as cnp
+from libc.math cimport sqrt
+from cython.parallel import prange
+from fastmath.vector cimport Vector  # the declarations
+from fastmath.matrix import (
+    Matrix,
+    identity as eye,
+)
+from . cimport helpers
+from util import *
+
+cdef extern from "header.h":
+    int compute(int)
+
+def norm(Vector v):
+    import json
+    return sqrt(v.dot(v))
+`)
+	var got []Module
+	for _, mod := range parseCythonImports(code, "fastmath/lib.pyx") {
+		assert.Equal(t, "fastmath/lib.pyx", mod.Filepath)
+		got = append(got, Module{Name: mod.Name, LineNumber: mod.LineNumber, From: mod.From})
+	}
+	assert.Equal(t, []Module{
+		{Name: "numpy", LineNumber: 2},
+		{Name: "os.path", LineNumber: 2},
+		{Name: "numpy", LineNumber: 3},
+		{Name: "fastmath.vector.Vector", LineNumber: 6, From: "fastmath.vector"},
+		{Name: "fastmath.matrix.Matrix", LineNumber: 7, From: "fastmath.matrix"},
+		{Name: "fastmath.matrix.identity", LineNumber: 7, From: "fastmath.matrix"},
+		{Name: ".helpers", LineNumber: 11, From: "."},
+		{Name: "util", LineNumber: 12, From: "util"},
+		{Name: "json", LineNumber: 18},
+	}, got)
+}
+
+func TestCythonImports(t *testing.T) {
+	f, err := rule.LoadData("BUILD", "fastmath", []byte(`
+pyx_library(
+    name = "fastmath_pyx",
+    srcs = [
+        "__init__.py",
+        "vector.pxd",
+        "vector.pyx",
+        "matrix.pyx",
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got []string
+	for _, provide := range cythonImports("", "fastmath", f.Rules[0]) {
+		got = append(got, provide.Imp)
+	}
+	assert.Equal(t, []string{"fastmath.vector", "fastmath.matrix"}, got)
+}
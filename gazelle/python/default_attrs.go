@@ -0,0 +1,138 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"regexp"
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// attrNameRe matches the names of the attributes of the python_default_attr
+// directive.
+var attrNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// parseDefaultAttr parses the value of the python_default_attr directive,
+// e.g. "py_test timeout=moderate". It returns the kind, the attribute and its
+// value, empty to remove the attribute.
+func parseDefaultAttr(value string) (string, string, string, error) {
+	fields := strings.SplitN(strings.TrimSpace(value), " ", 2)
+	if len(fields) != 2 {
+		return "", "", "", fmt.Errorf("expected a kind and an attribute, e.g. \"py_test timeout=moderate\", got %q", value)
+	}
+	kind := fields[0]
+	attr, attrValue, ok := strings.Cut(strings.TrimSpace(fields[1]), "=")
+	attr, attrValue = strings.TrimSpace(attr), strings.TrimSpace(attrValue)
+	if !ok || !attrNameRe.MatchString(attr) {
+		return "", "", "", fmt.Errorf("expected an attribute, e.g. \"timeout=moderate\", got %q", fields[1])
+	}
+	info, ok := pyKinds[kind]
+	if !ok {
+		return "", "", "", fmt.Errorf("unknown kind %q", kind)
+	}
+	if attr == "name" || info.NonEmptyAttrs[attr] || info.MergeableAttrs[attr] || info.ResolveAttrs[attr] {
+		return "", "", "", fmt.Errorf("the attribute %q of %s is generated", attr, kind)
+	}
+	if attrValue != "" {
+		if _, err := parseDefaultAttrValue(attrValue); err != nil {
+			return "", "", "", fmt.Errorf("invalid value of the attribute %q: %w", attr, err)
+		}
+	}
+	return kind, attr, attrValue, nil
+}
+
+// parseDefaultAttrValue parses the value of an attribute of the
+// python_default_attr directive, a Starlark expression, e.g. `["manual"]` or
+// `True`. A bare word, e.g. `moderate`, is a string.
+func parseDefaultAttrValue(value string) (bzl.Expr, error) {
+	f, err := bzl.ParseBuild("python_default_attr", []byte("_ = "+value))
+	if err != nil || len(f.Stmt) != 1 {
+		return nil, fmt.Errorf("expected a Starlark expression, got %q", value)
+	}
+	assign, ok := f.Stmt[0].(*bzl.AssignExpr)
+	if !ok {
+		return nil, fmt.Errorf("expected a Starlark expression, got %q", value)
+	}
+	if ident, ok := assign.RHS.(*bzl.Ident); ok {
+		switch ident.Name {
+		case "True", "False", "None":
+		default:
+			return &bzl.StringExpr{Value: ident.Name}, nil
+		}
+	}
+	return assign.RHS, nil
+}
+
+// setDefaultAttrs sets the attributes of python_default_attr on the rules
+// generated in the package, or on the existing rules they're merged into.
+// The tags are added to the other tags of the rules, while the other
+// attributes are replaced. Rules and attributes marked with a "# keep"
+// comment are left untouched.
+func setDefaultAttrs(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	for _, r := range gen {
+		attrs := cfg.DefaultAttrs(r.Kind())
+		if len(attrs) == 0 {
+			continue
+		}
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		names := make([]string, 0, len(attrs))
+		for name := range attrs {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			if attrShouldKeep(target, name) {
+				continue
+			}
+			// The values are validated when the directives are read.
+			expr, _ := parseDefaultAttrValue(attrs[name])
+			if name == "tags" {
+				if tags, ok := stringList(expr); ok {
+					replaceTags(target, func(tag string) bool { return slices.Contains(tags, tag) }, tags)
+					continue
+				}
+			}
+			target.SetAttr(name, expr)
+		}
+	}
+}
+
+// stringList returns the strings of expr if it's a list of strings.
+func stringList(expr bzl.Expr) ([]string, bool) {
+	list, ok := expr.(*bzl.ListExpr)
+	if !ok {
+		return nil, false
+	}
+	values := make([]string, 0, len(list.List))
+	for _, elem := range list.List {
+		str, ok := elem.(*bzl.StringExpr)
+		if !ok {
+			return nil, false
+		}
+		values = append(values, str.Value)
+	}
+	return values, true
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+func TestParseDefaultAttr(t *testing.T) {
+	tests := []struct {
+		value, kind, attr, attrValue string
+		wantErr                      bool
+	}{
+		{value: "py_test timeout=moderate", kind: "py_test", attr: "timeout", attrValue: "moderate"},
+		{value: `py_library tags = ["a", "b"]`, kind: "py_library", attr: "tags", attrValue: `["a", "b"]`},
+		{value: "py_test timeout=", kind: "py_test", attr: "timeout"},
+		{value: "py_test", wantErr: true},
+		{value: "py_test timeout", wantErr: true},
+		{value: "go_test timeout=short", wantErr: true},
+		{value: "py_test deps=[]", wantErr: true},
+		{value: "py_test name=foo", wantErr: true},
+		{value: "py_test tags=[", wantErr: true},
+	}
+	for _, tt := range tests {
+		kind, attr, attrValue, err := parseDefaultAttr(tt.value)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("%q: unexpected error %v", tt.value, err)
+			continue
+		}
+		if kind != tt.kind || attr != tt.attr || attrValue != tt.attrValue {
+			t.Errorf("%q: expected %q, %q, %q, got %q, %q, %q", tt.value, tt.kind, tt.attr, tt.attrValue, kind, attr, attrValue)
+		}
+	}
+}
+
+func TestParseDefaultAttrValue(t *testing.T) {
+	tests := map[string]string{
+		"moderate":       `"moderate"`,
+		`"moderate"`:     `"moderate"`,
+		"True":           "True",
+		"3":              "3",
+		`["manual"]`:     `["manual"]`,
+		`{"MODE": "ci"}`: `{"MODE": "ci"}`,
+	}
+	for value, want := range tests {
+		expr, err := parseDefaultAttrValue(value)
+		if err != nil {
+			t.Errorf("%q: unexpected error %v", value, err)
+			continue
+		}
+		if got := bzl.FormatString(expr); got != want {
+			t.Errorf("%q: expected %s, got %s", value, want, got)
+		}
+	}
+}
@@ -0,0 +1,144 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// depCommentsKey is the private attribute of the generated rules holding the
+// comments of the dependencies of the existing rules, see
+// addExistingDepComments.
+const depCommentsKey = "_gazelle_python_dep_comments"
+
+// depCommentAttrs are the dependency attributes whose elements carry their
+// comments from one to another.
+var depCommentAttrs = []string{"deps", "pyi_deps", depsToRemoveAttr}
+
+// depComments maps the dependencies of an existing rule to the comments
+// written by hand on their elements, e.g. a ticket or a justification.
+type depComments map[string]bzl.Comments
+
+// addExistingDepComments records the comments of the elements of the
+// dependency attributes of the existing rules in the BUILD file on the
+// generated rules they're merged into. Gazelle keeps the elements of an
+// attribute that are generated again, with their comments, but the
+// dependencies moving to another attribute or to a select() branch, e.g. from
+// deps to deps_to_remove, are new elements, which get the recorded comments
+// back, see convertDependencySetToExpr.
+func addExistingDepComments(args language.GenerateArgs, gen []*rule.Rule) {
+	for _, r := range gen {
+		existing := ruleInFile(args, r)
+		if existing == r {
+			continue
+		}
+		comments := make(depComments)
+		for _, attr := range depCommentAttrs {
+			if expr := existing.Attr(attr); expr != nil {
+				comments.collect(expr)
+			}
+		}
+		if len(comments) > 0 {
+			r.SetPrivateAttr(depCommentsKey, comments)
+		}
+	}
+}
+
+// ruleDepComments returns the comments of the dependencies recorded on the
+// generated rule r.
+func ruleDepComments(r *rule.Rule) depComments {
+	comments, _ := r.PrivateAttr(depCommentsKey).(depComments)
+	return comments
+}
+
+// collect records the comments of the string elements of the lists of expr,
+// including the ones of the select() branches, but not the conditions. The
+// "# keep" and "# gazelle:" comments aren't recorded, as they're handled by
+// Gazelle and applyDepsComments. The first comments of a dependency win.
+func (c depComments) collect(expr bzl.Expr) {
+	bzl.Walk(expr, func(e bzl.Expr, stk []bzl.Expr) {
+		str, ok := e.(*bzl.StringExpr)
+		if !ok {
+			return
+		}
+		if len(stk) > 0 {
+			if kv, ok := stk[len(stk)-1].(*bzl.KeyValueExpr); ok && kv.Key == e {
+				return
+			}
+		}
+		if _, ok := c[str.Value]; ok {
+			return
+		}
+		comments := bzl.Comments{
+			Before: handWrittenComments(str.Comments.Before),
+			Suffix: handWrittenComments(str.Comments.Suffix),
+		}
+		if len(comments.Before) > 0 || len(comments.Suffix) > 0 {
+			c[str.Value] = comments
+		}
+	})
+}
+
+// handWrittenComments returns the comments other than the "# keep" and
+// "# gazelle:" ones.
+func handWrittenComments(comments []bzl.Comment) []bzl.Comment {
+	var kept []bzl.Comment
+	for _, com := range comments {
+		text := strings.TrimSpace(strings.TrimPrefix(com.Token, "#"))
+		if text == "keep" || strings.HasPrefix(text, "keep: ") || strings.HasPrefix(text, "gazelle:") {
+			continue
+		}
+		kept = append(kept, bzl.Comment{Token: com.Token})
+	}
+	return kept
+}
+
+// stringExpr returns the element of the dependency dep, with its recorded
+// comments.
+func (c depComments) stringExpr(dep string) *bzl.StringExpr {
+	str := &bzl.StringExpr{Value: dep}
+	if comments, ok := c[dep]; ok {
+		str.Comments.Before = append([]bzl.Comment(nil), comments.Before...)
+		str.Comments.Suffix = append([]bzl.Comment(nil), comments.Suffix...)
+	}
+	return str
+}
+
+// apply adds the recorded comments to the string elements of the lists of
+// expr, e.g. the branches of the select() of the platform-conditional
+// dependencies, which are built by Gazelle.
+func (c depComments) apply(expr bzl.Expr) {
+	if len(c) == 0 {
+		return
+	}
+	bzl.Walk(expr, func(e bzl.Expr, stk []bzl.Expr) {
+		list, ok := e.(*bzl.ListExpr)
+		if !ok {
+			return
+		}
+		for i, elem := range list.List {
+			if str, ok := elem.(*bzl.StringExpr); ok {
+				if _, ok := c[str.Value]; ok {
+					list.List[i] = c.stringExpr(str.Value)
+					list.ForceMultiLine = true
+				}
+			}
+		}
+	})
+}
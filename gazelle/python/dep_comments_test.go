@@ -0,0 +1,99 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAddExistingDepComments(t *testing.T) {
+	f, err := rule.LoadData("BUILD", "app", []byte(`
+py_library(
+    name = "app",
+    deps = [
+        # Needed by the CLI, see TICKET-1.
+        "//cli",
+        "//core",  # TICKET-2
+        "//legacy",  # keep
+        "//tools",  # gazelle:remove
+    ] + select({
+        "@platforms//os:linux": [
+            "//linux",  # TICKET-3
+        ],
+        "//conditions:default": [],
+    }),
+    pyi_deps = [
+        "//stubs",  # TICKET-4
+    ],
+)
+
+py_library(
+    name = "other",
+    deps = [
+        "//core",  # TICKET-5
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	app := rule.NewRule(pyLibraryKind, "app")
+	generated := rule.NewRule(pyLibraryKind, "generated")
+	args := language.GenerateArgs{Config: config.New(), File: f}
+	addExistingDepComments(args, []*rule.Rule{app, generated})
+
+	comments := ruleDepComments(app)
+	got := make(map[string][]string, len(comments))
+	for dep, c := range comments {
+		for _, com := range append(c.Before, c.Suffix...) {
+			got[dep] = append(got[dep], com.Token)
+		}
+	}
+	assert.Equal(t, map[string][]string{
+		"//cli":   {"# Needed by the CLI, see TICKET-1."},
+		"//core":  {"# TICKET-2"},
+		"//linux": {"# TICKET-3"},
+		"//stubs": {"# TICKET-4"},
+	}, got)
+	assert.Nil(t, ruleDepComments(generated))
+}
+
+func TestConvertDependencySetToExprComments(t *testing.T) {
+	comments := depComments{
+		"//core":  {Suffix: []bzl.Comment{{Token: "# TICKET-2"}}},
+		"//linux": {Suffix: []bzl.Comment{{Token: "# TICKET-3"}}},
+	}
+	deps := treeset.NewWith(godsutils.StringComparator, "//api", "//core")
+	list := convertDependencySetToExpr(deps, comments).(*bzl.ListExpr)
+	assert.True(t, list.ForceMultiLine)
+	assert.Contains(t, bzl.FormatString(list), `"//core",  # TICKET-2`)
+
+	platformDeps := map[string]*treeset.Set{
+		"linux": treeset.NewWith(godsutils.StringComparator, "//linux"),
+	}
+	expr := convertPlatformDependenciesToExpr(treeset.NewWith(godsutils.StringComparator), platformDeps, comments)
+	assert.Contains(t, bzl.FormatString(expr), `"//linux",  # TICKET-3`)
+
+	list = convertDependencySetToExpr(deps, nil).(*bzl.ListExpr)
+	assert.False(t, list.ForceMultiLine)
+}
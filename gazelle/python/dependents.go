@@ -0,0 +1,264 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/merger"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+)
+
+// addGeneratedTargets records the package and the targets generated in it,
+// which are resolved by this run, so that the dependents of their changed
+// modules outside of it are resolved again, see reresolveDependents.
+func (py *Resolver) addGeneratedTargets(args language.GenerateArgs, gen []*rule.Rule) {
+	if py.cache == nil {
+		return
+	}
+	if py.visitedPackages == nil {
+		py.visitedPackages = make(map[string]bool)
+		py.generatedTargets = make(map[string]bool)
+	}
+	py.repoRoot = args.Config.RepoRoot
+	py.visitedPackages[args.Rel] = true
+	for _, r := range gen {
+		py.generatedTargets[label.New(args.Config.RepoName, args.Rel, r.Name()).String()] = true
+	}
+}
+
+// changedProviders compares the modules provided by the targets indexed by
+// this run with the ones of the previous run, and returns the targets whose
+// modules changed, e.g. when a file was added, removed or renamed, with the
+// modules they now provide and didn't before. The targets that are gone from
+// the visited packages, or with their package, are changed too, and
+// forgotten. Without any previous run, nothing changed.
+func (rc *resolutionCache) changedProviders(repoRoot string, visitedPackages map[string]bool) map[string][]string {
+	changed := make(map[string][]string)
+	if len(rc.previous.Provides) == 0 {
+		return changed
+	}
+	for target, modules := range rc.current.Provides {
+		previous, ok := rc.previous.Provides[target]
+		if ok && strings.Join(previous, " ") == strings.Join(modules, " ") {
+			continue
+		}
+		if !ok {
+			l, err := label.Parse(target)
+			if err != nil || !visitedPackages[l.Pkg] {
+				continue
+			}
+		}
+		changed[target] = difference(modules, previous)
+	}
+	for target := range rc.previous.Provides {
+		if _, ok := rc.current.Provides[target]; ok {
+			continue
+		}
+		l, err := label.Parse(target)
+		if err != nil {
+			continue
+		}
+		if _, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(l.Pkg))); visitedPackages[l.Pkg] || os.IsNotExist(err) {
+			changed[target] = nil
+			delete(rc.previous.Provides, target)
+		}
+	}
+	return changed
+}
+
+// dependents returns the targets resolved by a previous run, and not by this
+// one, that depend on one of the changed targets, or that left unresolved an
+// import of one of their new modules, sorted.
+func (rc *resolutionCache) dependents(changed map[string][]string, resolved map[string]bool) []string {
+	added := make(map[string]bool)
+	for _, modules := range changed {
+		for _, module := range modules {
+			added[module] = true
+		}
+	}
+	var dependents []string
+	for target, cached := range rc.previous.Targets {
+		if resolved[target] {
+			continue
+		}
+		from, err := label.Parse(target)
+		if err != nil {
+			continue
+		}
+		if dependsOnChanged(from, cached, changed) || importsAdded(cached, added) {
+			dependents = append(dependents, target)
+		}
+	}
+	sort.Strings(dependents)
+	return dependents
+}
+
+// dependsOnChanged returns whether the cached resolution of the target from
+// has a dependency on one of the changed targets.
+func dependsOnChanged(from label.Label, cached cachedResolution, changed map[string][]string) bool {
+	deps := append(append([]string{}, cached.Deps...), cached.PyiDeps...)
+	for _, platformDeps := range cached.PlatformDeps {
+		deps = append(deps, platformDeps...)
+	}
+	for _, dep := range deps {
+		l, err := label.Parse(dep)
+		if err != nil {
+			continue
+		}
+		if _, ok := changed[l.Abs(from.Repo, from.Pkg).String()]; ok {
+			return true
+		}
+	}
+	return false
+}
+
+// importsAdded returns whether one of the unresolved imports of the cached
+// resolution is one of the added modules, or one of their submodules or
+// names.
+func importsAdded(cached cachedResolution, added map[string]bool) bool {
+	for _, u := range cached.UnresolvedImports {
+		for module := u.Import; module != ""; {
+			if added[module] {
+				return true
+			}
+			i := strings.LastIndex(module, ".")
+			if i < 0 {
+				break
+			}
+			module = module[:i]
+		}
+	}
+	return false
+}
+
+// reresolveDependents resolves again the imports of the targets that depend
+// on a target whose modules changed, when Gazelle runs on a part of the
+// repository only, so that they aren't left stale. Their imports are read from
+// the cache, and the dependencies are merged into their BUILD files, written
+// with the ones of the visited packages.
+func (py *Python) reresolveDependents() {
+	if py.cache == nil || py.ruleIndex == nil {
+		return
+	}
+	changed := py.cache.changedProviders(py.repoRoot, py.visitedPackages)
+	if len(changed) == 0 {
+		return
+	}
+	for _, target := range py.cache.dependents(changed, py.generatedTargets) {
+		py.reresolveDependent(target, py.cache.previous.Targets[target])
+	}
+}
+
+// reresolveDependent resolves again the imports of the target, from its cached
+// resolution, and merges its dependencies into the rule of its BUILD file.
+// The targets that can't be resolved that way are reported instead.
+func (py *Python) reresolveDependent(target string, cached cachedResolution) {
+	from, _ := label.Parse(target)
+	c := py.packageConfigs[from.Pkg]
+	stale := func(reason string) {
+		log.Printf("WARNING: %s depends on targets whose modules changed, but %s: run Gazelle on //%s to update it", target, reason, from.Pkg)
+	}
+	if c == nil {
+		stale("its package wasn't indexed")
+		return
+	}
+	f := py.dependentFiles[from.Pkg]
+	if f == nil {
+		var err error
+		f, err = loadBuildFile(c, filepath.Join(c.RepoRoot, filepath.FromSlash(from.Pkg)), from.Pkg)
+		if err != nil {
+			log.Fatal(err)
+		}
+	}
+	var existing *rule.Rule
+	if f != nil {
+		for _, r := range f.Rules {
+			if r.Name() == from.Name {
+				existing = r
+			}
+		}
+	}
+	if existing == nil {
+		stale("its rule wasn't found")
+		return
+	}
+	if _, ok := pyKinds[existing.Kind()]; !ok || existing.ShouldKeep() || isDepsFileReference(existing.Attr("deps")) {
+		stale("its rule can't be merged")
+		return
+	}
+
+	modules := treeset.NewWith(moduleComparator)
+	for _, mod := range cached.Modules {
+		modules.Add(mod)
+	}
+	res := py.newRuleResolution(c, modules, from)
+	res.cacheKey = py.resolutionCacheKey(from, modules)
+	py.resolveModules(py.ruleIndex, res)
+
+	gen := rule.NewRule(existing.Kind(), existing.Name())
+	resolvedDeps := treeset.NewWith(godsutils.StringComparator)
+	for _, dep := range cached.ResolvedDeps {
+		resolvedDeps.Add(dep)
+	}
+	gen.SetPrivateAttr(resolvedDepsKey, resolvedDeps)
+	if cached.NoDepsOrder {
+		gen.SetPrivateAttr(noDepsOrderKey, true)
+	}
+	args := language.GenerateArgs{Config: c, Rel: from.Pkg, File: f}
+	addExistingDepsToRemove(args, []*rule.Rule{gen})
+	addNoDepsOrderComments(args, []*rule.Rule{gen})
+	py.addBuildozerTargets(args, []*rule.Rule{gen})
+	py.applyResolution(gen, res)
+	merger.MergeFile(f, nil, []*rule.Rule{gen}, merger.PostResolve, pyKinds, nil)
+
+	if py.dependentFiles == nil {
+		py.dependentFiles = make(map[string]*rule.File)
+	}
+	py.dependentFiles[from.Pkg] = f
+}
+
+// writeDependentFiles writes the BUILD files of the dependents resolved again.
+// The print and diff modes of Gazelle only cover the visited packages, so the
+// files that would change are reported instead of written outside of the fix
+// mode.
+func (py *Python) writeDependentFiles() {
+	pkgs := make([]string, 0, len(py.dependentFiles))
+	for pkg := range py.dependentFiles {
+		pkgs = append(pkgs, pkg)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		f := py.dependentFiles[pkg]
+		if !py.updatesFiles {
+			if existing, err := os.ReadFile(f.Path); err != nil || !bytes.Equal(existing, f.Format()) {
+				log.Printf("WARNING: %s would be updated with the dependents resolved again: run Gazelle in the fix mode to update it", f.Path)
+			}
+			continue
+		}
+		if err := f.Save(f.Path); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
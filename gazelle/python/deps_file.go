@@ -0,0 +1,242 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	// depsFileName is the name of the file holding the dependencies of the
+	// targets of a package when python_generate_deps_file is set.
+	depsFileName = "py_deps.bzl"
+	// depsFileHeader is the first line of the generated py_deps.bzl files,
+	// which tells them apart from the files written by hand.
+	depsFileHeader = "# Code generated by Gazelle from the Python imports. DO NOT EDIT."
+)
+
+// depsFileConstants maps the dependency attributes to the constants of the
+// py_deps.bzl files holding their values, by target.
+var depsFileConstants = []struct {
+	attr     string
+	constant string
+}{
+	{"deps", "PY_DEPS"},
+	{"pyi_deps", "PY_PYI_DEPS"},
+}
+
+// depsFileLoad is the load of the constants of the py_deps.bzl files, so that
+// Gazelle adds and removes it from the BUILD files as the constants are used.
+var depsFileLoad = rule.LoadInfo{
+	Name:    ":" + depsFileName,
+	Symbols: []string{"PY_DEPS", "PY_PYI_DEPS"},
+}
+
+// depsFieldInvalidChars matches the characters of the target names that
+// aren't allowed in the fields of the constants.
+var depsFieldInvalidChars = regexp.MustCompile(`[^A-Za-z0-9_]`)
+
+// starlarkKeywords are the reserved words that can't name a field.
+var starlarkKeywords = map[string]bool{
+	"and": true, "break": true, "continue": true, "def": true, "elif": true,
+	"else": true, "for": true, "if": true, "in": true, "lambda": true,
+	"load": true, "not": true, "or": true, "pass": true, "return": true,
+	"while": true,
+}
+
+// depsFilePackage is a package whose targets get their dependencies from a
+// py_deps.bzl file, once all the dependencies are resolved.
+type depsFilePackage struct {
+	// path is the absolute path of the py_deps.bzl file.
+	path string
+	// rules are the rules written to the BUILD file: the existing rules when
+	// there are some, or the generated ones.
+	rules []*rule.Rule
+}
+
+// addDepsFilePackage records the targets generated in the package when
+// python_generate_deps_file applies to it. The references to the constants of
+// the existing targets are removed beforehand, so that the resolved
+// dependencies are merged as lists, and moved again to the py_deps.bzl file
+// only when the directive still applies. Otherwise, the package is recorded
+// without any target when it referenced the constants, so that its
+// py_deps.bzl file is removed.
+func (py *Python) addDepsFilePackage(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	var rules []*rule.Rule
+	referenced := false
+	for _, r := range gen {
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		for _, c := range depsFileConstants {
+			if isDepsFileReference(target.Attr(c.attr)) && !attrShouldKeep(target, c.attr) {
+				target.DelAttr(c.attr)
+				referenced = true
+			}
+		}
+		rules = append(rules, target)
+	}
+	if !cfg.GenerateDepsFile() {
+		if !referenced {
+			return
+		}
+		rules = nil
+	}
+	py.depsFilePackages = append(py.depsFilePackages, depsFilePackage{
+		path:  filepath.Join(args.Config.RepoRoot, args.Rel, depsFileName),
+		rules: rules,
+	})
+}
+
+// isDepsFileReference returns whether expr references a constant of a
+// py_deps.bzl file, e.g. PY_DEPS.app.
+func isDepsFileReference(expr bzl.Expr) bool {
+	dot, ok := expr.(*bzl.DotExpr)
+	if !ok {
+		return false
+	}
+	ident, ok := dot.X.(*bzl.Ident)
+	if !ok {
+		return false
+	}
+	for _, c := range depsFileConstants {
+		if ident.Name == c.constant {
+			return true
+		}
+	}
+	return false
+}
+
+// depsFieldName returns the field of the constants holding the dependencies
+// of the target, e.g. "foo_test" for "foo-test", or "" when the name of the
+// target can't be turned into a field.
+func depsFieldName(targetName string) string {
+	field := depsFieldInvalidChars.ReplaceAllString(targetName, "_")
+	if field == "" || (field[0] >= '0' && field[0] <= '9') || starlarkKeywords[field] {
+		return ""
+	}
+	return field
+}
+
+// hasKeptValue returns whether any part of expr is marked with a "# keep"
+// comment, which Gazelle only preserves in the BUILD files.
+func hasKeptValue(expr bzl.Expr) bool {
+	kept := false
+	bzl.Walk(expr, func(e bzl.Expr, _ []bzl.Expr) {
+		if rule.ShouldKeep(e) {
+			kept = true
+		}
+	})
+	return kept
+}
+
+// writeDepsFiles moves the dependencies of the recorded targets to the
+// py_deps.bzl files of their packages, replacing them with references to the
+// constants in the BUILD files. The dependencies marked with a "# keep"
+// comment, and those of the targets whose names can't be turned into fields,
+// stay in the BUILD files. A py_deps.bzl file left without any dependency is
+// removed. The print and diff modes of Gazelle leave the py_deps.bzl files
+// untouched.
+func (py *Python) writeDepsFiles() {
+	for _, pkg := range py.depsFilePackages {
+		fields := make([]map[string]bzl.Expr, len(depsFileConstants))
+		for i := range fields {
+			fields[i] = make(map[string]bzl.Expr)
+		}
+		for _, r := range pkg.rules {
+			field := depsFieldName(r.Name())
+			if field == "" {
+				continue
+			}
+			for i, c := range depsFileConstants {
+				expr := r.Attr(c.attr)
+				if expr == nil || isDepsFileReference(expr) || attrShouldKeep(r, c.attr) || hasKeptValue(expr) {
+					continue
+				}
+				if _, ok := fields[i][field]; ok {
+					log.Printf("WARNING: the %s of %q stay in the BUILD file: another target uses the field %s.%s", c.attr, r.Name(), c.constant, field)
+					continue
+				}
+				fields[i][field] = expr
+				r.SetAttr(c.attr, &bzl.DotExpr{X: &bzl.Ident{Name: c.constant}, Name: field})
+			}
+		}
+		if err := writeDepsFile(pkg.path, fields, !py.updatesFiles); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// writeDepsFile writes the py_deps.bzl file at path, defining a struct per
+// constant with the given fields, unless its content is unchanged. Without
+// any field, a previously generated file is removed instead. Nothing is
+// written or removed in a dry run.
+func writeDepsFile(path string, fields []map[string]bzl.Expr, dryRun bool) error {
+	existing, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	f := &bzl.File{Type: bzl.TypeBzl}
+	for i, c := range depsFileConstants {
+		if len(fields[i]) == 0 {
+			continue
+		}
+		names := make([]string, 0, len(fields[i]))
+		for name := range fields[i] {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		call := &bzl.CallExpr{X: &bzl.Ident{Name: "struct"}, ForceMultiLine: true}
+		for _, name := range names {
+			// The lists are split by dependency, like in the BUILD files, so
+			// that the updates are diff-friendly.
+			bzl.Walk(fields[i][name], func(e bzl.Expr, _ []bzl.Expr) {
+				if list, ok := e.(*bzl.ListExpr); ok && len(list.List) > 1 {
+					list.ForceMultiLine = true
+				}
+			})
+			call.List = append(call.List, &bzl.AssignExpr{
+				LHS: &bzl.Ident{Name: name},
+				Op:  "=",
+				RHS: fields[i][name],
+			})
+		}
+		f.Stmt = append(f.Stmt, &bzl.AssignExpr{LHS: &bzl.Ident{Name: c.constant}, Op: "=", RHS: call})
+	}
+	if len(f.Stmt) == 0 {
+		if !dryRun && bytes.HasPrefix(existing, []byte(depsFileHeader+"\n")) {
+			return os.Remove(path)
+		}
+		return nil
+	}
+	f.Stmt[0].Comment().Before = []bzl.Comment{{Token: depsFileHeader}}
+	content := bzl.Format(f)
+	if dryRun || bytes.Equal(content, existing) {
+		return nil
+	}
+	return os.WriteFile(path, content, 0o644)
+}
@@ -0,0 +1,87 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestDepsFieldName(t *testing.T) {
+	assert.Equal(t, "client_test", depsFieldName("client_test"))
+	assert.Equal(t, "foo_bar_baz", depsFieldName("foo-bar.baz"))
+	assert.Equal(t, "", depsFieldName("3rd_party"))
+	assert.Equal(t, "", depsFieldName("lambda"))
+}
+
+func TestWriteDepsFileRemovesOnlyGeneratedFiles(t *testing.T) {
+	dir := t.TempDir()
+	empty := []map[string]bzl.Expr{{}, {}}
+
+	generated := filepath.Join(dir, "generated.bzl")
+	if err := os.WriteFile(generated, []byte(depsFileHeader+"\nPY_DEPS = struct()\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDepsFile(generated, empty, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err := os.Stat(generated)
+	assert.True(t, os.IsNotExist(err))
+
+	handwritten := filepath.Join(dir, "handwritten.bzl")
+	if err := os.WriteFile(handwritten, []byte("PY_DEPS = struct()\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDepsFile(handwritten, empty, false); err != nil {
+		t.Fatal(err)
+	}
+	_, err = os.Stat(handwritten)
+	assert.NoError(t, err)
+}
+
+func TestWriteDepsFileDryRun(t *testing.T) {
+	dir := t.TempDir()
+	fields := []map[string]bzl.Expr{{"app": &bzl.ListExpr{List: []bzl.Expr{&bzl.StringExpr{Value: "//lib"}}}}, {}}
+
+	added := filepath.Join(dir, "added.bzl")
+	if err := writeDepsFile(added, fields, true); err != nil {
+		t.Fatal(err)
+	}
+	_, err := os.Stat(added)
+	assert.True(t, os.IsNotExist(err))
+
+	generated := filepath.Join(dir, "generated.bzl")
+	content := []byte(depsFileHeader + "\nPY_DEPS = struct()\n")
+	if err := os.WriteFile(generated, content, 0o644); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeDepsFile(generated, []map[string]bzl.Expr{{}, {}}, true); err != nil {
+		t.Fatal(err)
+	}
+	data, err := os.ReadFile(generated)
+	assert.NoError(t, err)
+	assert.Equal(t, content, data)
+
+	if err := writeDepsFile(added, fields, false); err != nil {
+		t.Fatal(err)
+	}
+	data, err = os.ReadFile(added)
+	assert.NoError(t, err)
+	assert.Contains(t, string(data), `app = ["//lib"]`)
+}
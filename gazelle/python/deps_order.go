@@ -0,0 +1,445 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// depsToRemoveAttr is the attribute listing the deps that violate the layering
+// declared with the python_deps_order_file directive.
+const depsToRemoveAttr = "deps_to_remove"
+
+// existingDepsToRemoveKey is the private attribute of the generated rules
+// holding the deps_to_remove entries of the existing rules with the same name.
+const existingDepsToRemoveKey = "_gazelle_python_existing_deps_to_remove"
+
+// keptDepsKey is the private attribute of the generated rules holding the deps
+// of the existing rules with the same name marked with "# keep", which never
+// land in deps_to_remove.
+const keptDepsKey = "_gazelle_python_kept_deps"
+
+// forcedDepsToRemoveKey is the private attribute of the generated rules
+// holding the deps and deps_to_remove entries of the existing rules with the
+// same name marked with "# gazelle:remove", which always land in
+// deps_to_remove.
+const forcedDepsToRemoveKey = "_gazelle_python_forced_deps_to_remove"
+
+// removeCommentRe matches the comment forcing a dep into deps_to_remove.
+var removeCommentRe = regexp.MustCompile(`^#\s*gazelle:remove\s*$`)
+
+// noDepsOrderKey is the private attribute of the generated rules exempted from
+// the deps order by the no_deps_order annotation.
+const noDepsOrderKey = "_gazelle_python_no_deps_order"
+
+// addExistingDepsToRemove records the deps_to_remove entries of the existing
+// rules in the BUILD file on the generated rules with the same name, so that
+// the entries added by hand are merged with the generated ones instead of
+// being overwritten. The entries marked with "# keep" are left to Gazelle,
+// which never removes them. The comments of the deps and deps_to_remove
+// entries are recorded too, see applyDepsComments.
+func addExistingDepsToRemove(args language.GenerateArgs, gen []*rule.Rule) {
+	if args.File == nil {
+		return
+	}
+	existing := make(map[string]*rule.Rule, len(args.File.Rules))
+	for _, r := range args.File.Rules {
+		existing[r.Name()] = r
+	}
+	for _, r := range gen {
+		existingRule, ok := existing[r.Name()]
+		if !ok {
+			continue
+		}
+		var kept, forced []string
+		if list, ok := existingRule.Attr("deps").(*bzl.ListExpr); ok {
+			for _, elem := range list.List {
+				str, ok := elem.(*bzl.StringExpr)
+				if !ok {
+					continue
+				}
+				if rule.ShouldKeep(elem) {
+					kept = append(kept, str.Value)
+				} else if hasRemoveComment(elem) {
+					forced = append(forced, str.Value)
+				}
+			}
+		}
+		if list, ok := existingRule.Attr(depsToRemoveAttr).(*bzl.ListExpr); ok {
+			var entries []string
+			for _, elem := range list.List {
+				if str, ok := elem.(*bzl.StringExpr); ok && !rule.ShouldKeep(elem) {
+					entries = append(entries, str.Value)
+					if hasRemoveComment(elem) {
+						forced = append(forced, str.Value)
+					}
+				}
+			}
+			if len(entries) > 0 {
+				r.SetPrivateAttr(existingDepsToRemoveKey, entries)
+			}
+		}
+		if len(kept) > 0 {
+			r.SetPrivateAttr(keptDepsKey, kept)
+		}
+		if len(forced) > 0 {
+			r.SetPrivateAttr(forcedDepsToRemoveKey, forced)
+		}
+	}
+}
+
+// hasRemoveComment returns whether the list element is marked with a
+// "# gazelle:remove" comment, above it or on its line.
+func hasRemoveComment(elem bzl.Expr) bool {
+	comments := elem.Comment()
+	for _, com := range append(comments.Before, comments.Suffix...) {
+		if removeCommentRe.MatchString(strings.TrimSpace(com.Token)) {
+			return true
+		}
+	}
+	return false
+}
+
+// removeKeptDeps removes from deps the deps of the existing rule marked with
+// "# keep", which never land in deps_to_remove, nor violate the deps order.
+func removeKeptDeps(r *rule.Rule, deps *treeset.Set) {
+	kept, _ := r.PrivateAttr(keptDepsKey).([]string)
+	for _, dep := range kept {
+		deps.Remove(dep)
+	}
+}
+
+// applyDepsComments applies the comments of the deps and deps_to_remove
+// entries of the existing rule to the deps_to_remove entries toRemove: the
+// ones marked with "# gazelle:remove" are added, unless they're marked with
+// "# keep" in deps too, as the kept deps are removed.
+func applyDepsComments(r *rule.Rule, toRemove *treeset.Set) {
+	forced, _ := r.PrivateAttr(forcedDepsToRemoveKey).([]string)
+	for _, dep := range forced {
+		toRemove.Add(dep)
+	}
+	removeKeptDeps(r, toRemove)
+}
+
+// addNoDepsOrderComments exempts the generated rules from the deps order when
+// the existing rule with the same name is preceded by a
+// "# gazelle:no_deps_order" comment in the BUILD file.
+func addNoDepsOrderComments(args language.GenerateArgs, gen []*rule.Rule) {
+	if args.File == nil || args.File.File == nil {
+		return
+	}
+	exempted := make(map[string]bool)
+	for _, r := range args.File.File.Rules("") {
+		for _, com := range r.Call.Comment().Before {
+			if match := noDepsOrderRe.FindStringSubmatch(com.Token); match != nil {
+				exempted[r.Name()] = true
+			}
+		}
+	}
+	for _, r := range gen {
+		if exempted[r.Name()] {
+			r.SetPrivateAttr(noDepsOrderKey, true)
+		}
+	}
+}
+
+// noDepsOrderRe matches the no_deps_order annotation in the BUILD files.
+var noDepsOrderRe = regexp.MustCompile(`^#\s*gazelle:` + string(annotationKindNoDepsOrder) + `\s*$`)
+
+// ignoresDepsOrder returns whether the generated rule r is exempted from the
+// deps order, either by a "# gazelle:no_deps_order" comment above the rule in
+// the BUILD file, or in one of its source files.
+func ignoresDepsOrder(r *rule.Rule) bool {
+	exempted, _ := r.PrivateAttr(noDepsOrderKey).(bool)
+	return exempted
+}
+
+// userDepsToRemove returns the deps_to_remove entries of the existing rule
+// that Gazelle doesn't manage. The entries that violate the layers in
+// depsOrder are managed by Gazelle, which lists them again as long as the
+// dependency is there, so the others were added by hand and are kept.
+func userDepsToRemove(r *rule.Rule, depsOrder *pythonconfig.DepsOrder, from label.Label) *treeset.Set {
+	userEntries := treeset.NewWith(godsutils.StringComparator)
+	entries, _ := r.PrivateAttr(existingDepsToRemoveKey).([]string)
+	for _, entry := range entries {
+		if depsOrder != nil && !depsToRemove(depsOrder, from, srcsForOrdering(r), []string{entry}).Empty() {
+			continue
+		}
+		userEntries.Add(entry)
+	}
+	return userEntries
+}
+
+// srcsForOrdering returns the srcs of the rule recorded at generation time,
+// relative to its package, or nil when the rule wasn't generated by this
+// extension.
+func srcsForOrdering(r *rule.Rule) []string {
+	srcs, _ := r.PrivateAttr(srcsForOrderingKey).([]string)
+	return srcs
+}
+
+// targetLayer returns the index of the layer of the target from, whose
+// sources are srcs, and whether it belongs to one. The target is in the layer
+// of the directories of its srcs when they all belong to the same one, e.g. a
+// target of the project generation mode whose sources live in a subdirectory,
+// and in the layer of its package otherwise.
+func targetLayer(depsOrder *pythonconfig.DepsOrder, from label.Label, srcs []string) (int, bool) {
+	layer := -1
+	for _, src := range srcs {
+		dir := from.Pkg
+		if srcDir := path.Dir(src); srcDir != "." {
+			dir = path.Join(dir, srcDir)
+		}
+		srcLayer, ok := depsOrder.LayerForPackage(dir)
+		if !ok || (layer != -1 && srcLayer != layer) {
+			return depsOrder.LayerForPackage(from.Pkg)
+		}
+		layer = srcLayer
+	}
+	if layer == -1 {
+		return depsOrder.LayerForPackage(from.Pkg)
+	}
+	return layer, true
+}
+
+// depsToRemove returns the subset of deps that the target from, whose sources
+// are srcs, is not allowed to depend on according to the layers in depsOrder.
+// Dependencies on packages that don't belong to any layer, including the
+// packages of the external repositories without a repository-qualified glob,
+// are never considered violations.
+func depsToRemove(depsOrder *pythonconfig.DepsOrder, from label.Label, srcs, deps []string) *treeset.Set {
+	toRemove := treeset.NewWith(godsutils.StringComparator)
+	fromLayer, ok := targetLayer(depsOrder, from, srcs)
+	if !ok {
+		return toRemove
+	}
+	for _, dep := range deps {
+		depLayer, ok := dependencyLayer(depsOrder, from, dep)
+		if !ok {
+			continue
+		}
+		if !depsOrder.Allows(fromLayer, depLayer) {
+			toRemove.Add(dep)
+		}
+	}
+	return toRemove
+}
+
+// dependencyLayer returns the index of the layer of the dependency dep of the
+// target from, and whether it belongs to one.
+func dependencyLayer(depsOrder *pythonconfig.DepsOrder, from label.Label, dep string) (int, bool) {
+	depLabel, err := label.Parse(dep)
+	if err != nil {
+		return -1, false
+	}
+	repo := depLabel.Repo
+	if repo == from.Repo {
+		repo = ""
+	}
+	return depsOrder.LayerForRepoPackage(repo, depLabel.Abs(from.Repo, from.Pkg).Pkg)
+}
+
+// depsOrderViolationErrors returns an error for each dependency in toRemove,
+// pointing at the import that introduced it when depSources knows it.
+func depsOrderViolationErrors(
+	depsOrder *pythonconfig.DepsOrder,
+	from label.Label,
+	srcs []string,
+	toRemove *treeset.Set,
+	depSources map[string]Module,
+) []error {
+	fromLayer, _ := targetLayer(depsOrder, from, srcs)
+	errs := make([]error, 0, toRemove.Size())
+	it := toRemove.Iterator()
+	for it.Next() {
+		dep := it.Value().(string)
+		depLayer, _ := dependencyLayer(depsOrder, from, dep)
+		violation := fmt.Sprintf("layer %q is not allowed to depend on layer %q",
+			depsOrder.Layers[fromLayer].Name, depsOrder.Layers[depLayer].Name)
+		if mod, ok := depSources[dep]; ok {
+			errs = append(errs, fmt.Errorf("%q, line %d: %q resolves to %q: %s",
+				mod.Filepath, mod.LineNumber, mod.Name, dep, violation))
+		} else {
+			errs = append(errs, fmt.Errorf("%q depends on %q: %s", from.String(), dep, violation))
+		}
+	}
+	return errs
+}
+
+// depsToRemoveReport justifies the dependencies listed in the deps_to_remove
+// attributes because they violate the layers, written to the
+// -python_deps_to_remove_report file. A nil report records nothing.
+type depsToRemoveReport struct {
+	Entries []depsToRemoveEntry `json:"entries"`
+}
+
+// depsToRemoveEntry justifies a dependency listed in the deps_to_remove
+// attribute of a target.
+type depsToRemoveEntry struct {
+	Target      string               `json:"target"`
+	Dep         string               `json:"dep"`
+	TargetLayer depsToRemoveLayer    `json:"target_layer"`
+	DepLayer    depsToRemoveLayer    `json:"dep_layer"`
+	Sources     []depsToRemoveSource `json:"sources"`
+}
+
+// depsToRemoveLayer is a layer of the deps order file, with its index in the
+// file.
+type depsToRemoveLayer struct {
+	Name  string `json:"name"`
+	Index int    `json:"index"`
+}
+
+// depsToRemoveSource is an import that pulled a dependency in.
+type depsToRemoveSource struct {
+	File   string `json:"file"`
+	Line   uint32 `json:"line"`
+	Import string `json:"import"`
+}
+
+// add records the dependencies in toRemove, which violate the layers in
+// depsOrder, along with the imports of res that pulled them in. srcs are the
+// sources of the target of res, see targetLayer. srcs are the
+// sources of the target of res, see targetLayer.
+func (report *depsToRemoveReport) add(depsOrder *pythonconfig.DepsOrder, res *ruleResolution, srcs []string, toRemove *treeset.Set) {
+	if report == nil {
+		return
+	}
+	from := res.from
+	fromLayer, _ := targetLayer(depsOrder, from, srcs)
+	it := toRemove.Iterator()
+	for it.Next() {
+		dep := it.Value().(string)
+		depLayer, _ := dependencyLayer(depsOrder, from, dep)
+		entry := depsToRemoveEntry{
+			Target:      from.String(),
+			Dep:         dep,
+			TargetLayer: depsToRemoveLayer{Name: depsOrder.Layers[fromLayer].Name, Index: fromLayer},
+			DepLayer:    depsToRemoveLayer{Name: depsOrder.Layers[depLayer].Name, Index: depLayer},
+			Sources:     []depsToRemoveSource{},
+		}
+		for _, mod := range res.depImports[dep] {
+			entry.Sources = append(entry.Sources, depsToRemoveSource{
+				File:   mod.Filepath,
+				Line:   mod.LineNumber,
+				Import: mod.Name,
+			})
+		}
+		report.Entries = append(report.Entries, entry)
+	}
+}
+
+// write writes the report as JSON to the given path, sorted by target and
+// dependency.
+func (report *depsToRemoveReport) write(path string) error {
+	entries := report.Entries
+	if entries == nil {
+		entries = []depsToRemoveEntry{}
+	}
+	sort.Slice(entries, func(i, j int) bool {
+		if entries[i].Target != entries[j].Target {
+			return entries[i].Target < entries[j].Target
+		}
+		return entries[i].Dep < entries[j].Dep
+	})
+	data, err := json.MarshalIndent(depsToRemoveReport{Entries: entries}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the deps_to_remove report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the deps_to_remove report: %w", err)
+	}
+	return nil
+}
+
+// depsOrderIndexHeader is the first line of the -python_deps_order_index file.
+const depsOrderIndexHeader = "# Code generated by Gazelle from the deps order files. DO NOT EDIT."
+
+// depsOrderIndex maps the resolved targets to the layer of the deps order
+// file of their package, written to the -python_deps_order_index file. A nil
+// index records nothing.
+type depsOrderIndex struct {
+	layers map[string]depsToRemoveLayer
+}
+
+// add records the layer of the target from, whose sources are srcs, in
+// depsOrder, if it belongs to one.
+func (index *depsOrderIndex) add(depsOrder *pythonconfig.DepsOrder, from label.Label, srcs []string) {
+	if index == nil {
+		return
+	}
+	layer, ok := targetLayer(depsOrder, from, srcs)
+	if !ok {
+		return
+	}
+	if index.layers == nil {
+		index.layers = make(map[string]depsToRemoveLayer)
+	}
+	// The labels are written in full, e.g. //pkg:pkg, so that the macros can
+	// look the targets up without normalizing them.
+	target := fmt.Sprintf("//%s:%s", from.Pkg, from.Name)
+	if from.Repo != "" {
+		target = "@" + from.Repo + target
+	}
+	index.layers[target] = depsToRemoveLayer{Name: depsOrder.Layers[layer].Name, Index: layer}
+}
+
+// write writes the index to the given path as a .bzl file defining the
+// DEPS_ORDER_INDEX dict, which maps the labels of the targets to a struct with
+// the name and the index of their layer, sorted by label.
+func (index *depsOrderIndex) write(path string) error {
+	targets := make([]string, 0, len(index.layers))
+	for target := range index.layers {
+		targets = append(targets, target)
+	}
+	sort.Strings(targets)
+	dict := &bzl.DictExpr{ForceMultiLine: true}
+	for _, target := range targets {
+		layer := index.layers[target]
+		dict.List = append(dict.List, &bzl.KeyValueExpr{
+			Key: &bzl.StringExpr{Value: target},
+			Value: &bzl.CallExpr{
+				X: &bzl.Ident{Name: "struct"},
+				List: []bzl.Expr{
+					&bzl.AssignExpr{LHS: &bzl.Ident{Name: "index"}, Op: "=", RHS: &bzl.LiteralExpr{Token: strconv.Itoa(layer.Index)}},
+					&bzl.AssignExpr{LHS: &bzl.Ident{Name: "layer"}, Op: "=", RHS: &bzl.StringExpr{Value: layer.Name}},
+				},
+			},
+		})
+	}
+	stmt := &bzl.AssignExpr{LHS: &bzl.Ident{Name: "DEPS_ORDER_INDEX"}, Op: "=", RHS: dict}
+	stmt.Comment().Before = []bzl.Comment{{Token: depsOrderIndexHeader}}
+	f := &bzl.File{Type: bzl.TypeBzl, Stmt: []bzl.Expr{stmt}}
+	if err := os.WriteFile(path, bzl.Format(f), 0o644); err != nil {
+		return fmt.Errorf("failed to write the deps order index: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,251 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestTargetLayer(t *testing.T) {
+	depsOrder, err := pythonconfig.ParseDepsOrder([]byte(`{"layers": [
+		{"name": "billing", "packages": ["services/billing/**"], "depends_on": ["core"]},
+		{"name": "api", "packages": ["api/**"], "depends_on": ["core"]},
+		{"name": "core", "packages": ["core/**", "services/core/**"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	tests := []struct {
+		name  string
+		from  label.Label
+		srcs  []string
+		layer int
+		ok    bool
+	}{
+		{"package", label.New("", "api", "api"), []string{"__init__.py"}, 1, true},
+		{"no srcs", label.New("", "api", "api"), nil, 1, true},
+		{"srcs in a subdirectory", label.New("", "services", "services"), []string{"billing/__init__.py", "billing/invoices.py"}, 0, true},
+		{"srcs in several layers", label.New("", "services", "services"), []string{"billing/__init__.py", "core/db.py"}, -1, false},
+		{"srcs out of the layers", label.New("", "core", "core"), []string{"__init__.py", "../tools/lint.py"}, 2, true},
+		{"root package", label.New("", "", "root"), []string{"api/__init__.py"}, 1, true},
+	}
+	for _, tt := range tests {
+		layer, ok := targetLayer(depsOrder, tt.from, tt.srcs)
+		assert.Equal(t, tt.ok, ok, tt.name)
+		assert.Equal(t, tt.layer, layer, tt.name)
+	}
+}
+
+func TestDepsToRemoveSrcsForOrdering(t *testing.T) {
+	depsOrder, err := pythonconfig.ParseDepsOrder([]byte(`{"layers": [
+		{"name": "billing", "packages": ["services/billing/**"], "depends_on": ["core"]},
+		{"name": "api", "packages": ["api/**"], "depends_on": ["core"]},
+		{"name": "core", "packages": ["core/**"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	from := label.New("", "services", "services")
+	r := newTargetBuilder(pyLibraryKind, "services", "", "services", treeset.NewWith(godsutils.StringComparator), false).
+		addSrc("billing/__init__.py").
+		addSrc("billing/invoices.py").
+		build()
+	// The kind is mapped to a macro taking the sources under another name,
+	// and the srcs attribute is gone from the rule.
+	r.SetKind("billing_library")
+	r.SetAttr("modules", r.AttrStrings("srcs"))
+	r.DelAttr("srcs")
+
+	assert.Equal(t, []string{"billing/__init__.py", "billing/invoices.py"}, srcsForOrdering(r))
+	toRemove := depsToRemove(depsOrder, from, srcsForOrdering(r), []string{"//api", "//core"})
+	assert.Equal(t, []interface{}{"//api"}, toRemove.Values())
+	errs := depsOrderViolationErrors(depsOrder, from, srcsForOrdering(r), toRemove, nil)
+	if assert.Len(t, errs, 1) {
+		assert.EqualError(t, errs[0], `"//services" depends on "//api": layer "billing" is not allowed to depend on layer "api"`)
+	}
+
+	// Without the srcs recorded at generation time, the target is in the
+	// layer of its package, which has none.
+	assert.True(t, depsToRemove(depsOrder, from, nil, []string{"//api", "//core"}).Empty())
+}
+
+func TestDepsToRemoveExternalRepositories(t *testing.T) {
+	depsOrder, err := pythonconfig.ParseDepsOrder([]byte(`{"layers": [
+		{"name": "app", "packages": ["app/**"], "depends_on": ["core"]},
+		{"name": "core", "packages": ["core/**", "@shared_lib//python/core/**"]},
+		{"name": "shared", "packages": ["@shared_lib//python/**"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	toRemove := depsToRemove(depsOrder, label.New("", "app", "app"), nil, []string{
+		"@shared_lib//python/core/strings",
+		"@shared_lib//python/http",
+		"@other//python/http",
+		"@pypi//requests",
+	})
+	assert.Equal(t, []interface{}{"@shared_lib//python/http"}, toRemove.Values())
+}
+
+func TestDepsToRemoveReport(t *testing.T) {
+	depsOrder, err := pythonconfig.ParseDepsOrder([]byte(`{"layers": [
+		{"name": "web", "packages": ["web/**"], "depends_on": ["core"]},
+		{"name": "api", "packages": ["api/**"], "depends_on": ["core"]},
+		{"name": "core", "packages": ["core/**"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var py Resolver
+	res := py.newRuleResolution(nil, nil, label.New("", "web/views", "views"))
+	res.addDependencySource("//api/users", Module{Name: "api.users", Filepath: "web/views/a.py", LineNumber: 1})
+	res.addDependencySource("//api/users", Module{Name: "api.users.models", Filepath: "web/views/b.py", LineNumber: 3})
+	res.addDependencySource("//core", Module{Name: "core", Filepath: "web/views/a.py", LineNumber: 2})
+	toRemove := depsToRemove(depsOrder, res.from, nil, []string{"//api/users", "//core"})
+
+	// A nil report records nothing.
+	py.depsToRemoveReport.add(depsOrder, res, nil, toRemove)
+
+	report := &depsToRemoveReport{}
+	report.add(depsOrder, res, nil, toRemove)
+	path := filepath.Join(t.TempDir(), "report.json")
+	if !assert.NoError(t, report.write(path)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var written depsToRemoveReport
+	if err := json.Unmarshal(data, &written); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []depsToRemoveEntry{{
+		Target:      "//web/views",
+		Dep:         "//api/users",
+		TargetLayer: depsToRemoveLayer{Name: "web", Index: 0},
+		DepLayer:    depsToRemoveLayer{Name: "api", Index: 1},
+		Sources: []depsToRemoveSource{
+			{File: "web/views/a.py", Line: 1, Import: "api.users"},
+			{File: "web/views/b.py", Line: 3, Import: "api.users.models"},
+		},
+	}}, written.Entries)
+}
+
+func TestDepsToRemoveUsesTheDependencyPackage(t *testing.T) {
+	depsOrder, err := pythonconfig.ParseDepsOrder([]byte(`{"layers": [
+		{"name": "web", "packages": ["web/**"], "depends_on": ["core"]},
+		{"name": "api", "packages": ["api/**"], "depends_on": ["core"]},
+		{"name": "core", "packages": ["core/**"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// The layers of the dependencies come from their labels, whatever their
+	// srcs: the __init__.py of a package, renamed files or several files.
+	toRemove := depsToRemove(depsOrder, label.New("", "web/views", "views"), nil, []string{
+		"//api/users",
+		"//api/users:models_lib",
+		"//core/utils:utils",
+		":local",
+		"@pypi//requests",
+		"//tools:lint",
+	})
+	assert.Equal(t, []interface{}{"//api/users", "//api/users:models_lib"}, toRemove.Values())
+}
+
+func TestDepsOrderIndex(t *testing.T) {
+	depsOrder, err := pythonconfig.ParseDepsOrder([]byte(`{"layers": [
+		{"name": "web", "packages": ["web/**"], "depends_on": ["core"]},
+		{"name": "core", "packages": ["core/**"]}
+	]}`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	// A nil index records nothing.
+	var nilIndex *depsOrderIndex
+	nilIndex.add(depsOrder, label.New("", "web", "web"), nil)
+
+	index := &depsOrderIndex{}
+	index.add(depsOrder, label.New("", "web/views", "views"), nil)
+	index.add(depsOrder, label.New("", "core", "core_test"), nil)
+	index.add(depsOrder, label.New("", "core", "core"), nil)
+	index.add(depsOrder, label.New("", "tools", "tools"), nil)
+	path := filepath.Join(t.TempDir(), "deps_order_index.bzl")
+	if !assert.NoError(t, index.write(path)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `# Code generated by Gazelle from the deps order files. DO NOT EDIT.
+DEPS_ORDER_INDEX = {
+    "//core:core": struct(index = 1, layer = "core"),
+    "//core:core_test": struct(index = 1, layer = "core"),
+    "//web/views:views": struct(index = 0, layer = "web"),
+}
+`, string(data))
+}
+
+func TestApplyDepsComments(t *testing.T) {
+	f, err := rule.LoadData("core/BUILD", "core", []byte(`
+py_library(
+    name = "core",
+    srcs = ["__init__.py"],
+    deps_to_remove = [
+        "//legacy",
+        "//tools:fmt",  # gazelle:remove
+        "//tools:lint",  # keep
+    ],
+    deps = [
+        "//api",  # keep
+        # gazelle:remove
+        "//third_party/slow",
+        "//web",  # gazelle:remove
+        "//util",
+    ],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	gen := rule.NewRule("py_library", "core")
+	addExistingDepsToRemove(language.GenerateArgs{File: f}, []*rule.Rule{gen})
+
+	// The violations and the entries added by hand, as computed from the
+	// resolved deps.
+	toRemove := treeset.NewWith(godsutils.StringComparator, "//api", "//legacy", "//util")
+	applyDepsComments(gen, toRemove)
+	assert.Equal(t, []interface{}{
+		"//legacy",
+		"//third_party/slow",
+		"//tools:fmt",
+		"//util",
+		"//web",
+	}, toRemove.Values())
+}
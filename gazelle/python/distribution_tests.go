@@ -0,0 +1,108 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// distributionTestSuffix is the suffix of the names of the smoke tests of the
+// distributions, see python_distribution_tests.
+const distributionTestSuffix = "_import_test"
+
+var distributionTestNameSeparators = regexp.MustCompile(`[-_.]+`)
+
+// distributionTestName returns the name of the smoke test of the
+// distribution.
+func distributionTestName(distributionName string) string {
+	name := distributionTestNameSeparators.ReplaceAllString(strings.ToLower(distributionName), "_")
+	return strings.Trim(name, "_") + distributionTestSuffix
+}
+
+// generateDistributionTests generates a py_test per distribution of the
+// gazelle manifest, importing its top-level modules with the file of the
+// python_distribution_tests directive, which receives them as arguments. The
+// modules are resolved like any other import, so the tests depend on their
+// distributions. The existing smoke tests of the distributions removed from
+// the manifest are deleted, unless marked with a "# keep" comment.
+func generateDistributionTests(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	result *language.GenerateResult,
+) {
+	filename := cfg.DistributionTests()
+	if filename == "" {
+		return
+	}
+	modules := cfg.DistributionModules()
+	distributionNames := make([]string, 0, len(modules))
+	for distributionName := range modules {
+		distributionNames = append(distributionNames, distributionName)
+	}
+	sort.Strings(distributionNames)
+
+	generated := make(map[string]struct{}, len(distributionNames))
+	for _, distributionName := range distributionNames {
+		name := distributionTestName(distributionName)
+		if _, ok := generated[name]; ok {
+			continue
+		}
+		generated[name] = struct{}{}
+		pyTestTarget := newTargetBuilder(pyTestKind, name, pythonProjectRoot, args.Rel, pyFileNames, false).
+			addVisibility(visibility).
+			addSrc(filename).
+			setMain(filename).
+			generateImportsAttribute()
+		for _, modName := range modules[distributionName] {
+			pyTestTarget.addModuleDependency(Module{
+				Name:     modName,
+				Filepath: filepath.Join(args.Rel, filename),
+			})
+		}
+		pyTest := pyTestTarget.build()
+		pyTest.SetAttr("args", modules[distributionName])
+		// The args attribute isn't mergeable, so the one of the existing rule
+		// is updated along with the modules of the distribution.
+		if target := ruleInFile(args, pyTest); target != pyTest && !target.ShouldKeep() {
+			target.SetAttr("args", modules[distributionName])
+		}
+		result.Gen = append(result.Gen, pyTest)
+		result.Imports = append(result.Imports, pyTest.PrivateAttr(config.GazelleImportsKey))
+	}
+
+	if args.File == nil {
+		return
+	}
+	for _, r := range args.File.Rules {
+		if _, ok := generated[r.Name()]; ok || !strings.HasSuffix(r.Name(), distributionTestSuffix) {
+			continue
+		}
+		if kindMatches(args.Config, r, pyTestKind) && r.AttrString("main") == filename && !r.ShouldKeep() {
+			r.Delete()
+		}
+	}
+}
@@ -0,0 +1,188 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/emirpasic/gods/sets/treeset"
+	sitter "github.com/smacker/go-tree-sitter"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	// doctestFilesKey is the private attribute of the generated rules holding
+	// the files of their srcs with doctests, see python_generate_doctests.
+	doctestFilesKey = "_gazelle_python_doctest_files"
+	// doctestSuffix is the suffix of the names of the tests running the
+	// doctests of a module, e.g. utils_doctest for utils.py.
+	doctestSuffix = "_doctest"
+	// doctestModule is the main module of the tests running the doctests.
+	doctestModule = "doctest"
+	// doctestPrompt starts the examples of the docstrings.
+	doctestPrompt = ">>>"
+
+	sitterNodeTypeExpressionStatement = "expression_statement"
+)
+
+// hasDoctests returns whether the docstring of the module, or of one of its
+// functions, classes or methods, has an example, i.e. a line starting with the
+// `>>>` prompt, as collected by the doctest module.
+func (p *FileParser) hasDoctests(node *sitter.Node) bool {
+	if !bytes.Contains(p.code, []byte(doctestPrompt)) {
+		return false
+	}
+	return p.blockHasDoctests(node)
+}
+
+// blockHasDoctests returns whether the docstring of the block, or of the
+// functions and classes it defines, has an example. The bodies of the
+// classes are searched, but not the ones of the functions, whose nested
+// definitions aren't collected by the doctest module.
+func (p *FileParser) blockHasDoctests(block *sitter.Node) bool {
+	if p.docstringHasExamples(block) {
+		return true
+	}
+	for i := 0; i < int(block.NamedChildCount()); i++ {
+		definition := block.NamedChild(i)
+		if definition.Type() == sitterNodeTypeDecoratedDefinition {
+			definition = definition.ChildByFieldName("definition")
+			if definition == nil {
+				continue
+			}
+		}
+		body := definition.ChildByFieldName("body")
+		if body == nil {
+			continue
+		}
+		switch definition.Type() {
+		case sitterNodeTypeFunctionDefinition:
+			if p.docstringHasExamples(body) {
+				return true
+			}
+		case sitterNodeTypeClassDefinition:
+			if p.blockHasDoctests(body) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// docstringHasExamples returns whether the block starts with a docstring with
+// an example.
+func (p *FileParser) docstringHasExamples(block *sitter.Node) bool {
+	for i := 0; i < int(block.NamedChildCount()); i++ {
+		statement := block.NamedChild(i)
+		if statement.Type() == sitterNodeTypeComment {
+			continue
+		}
+		if statement.Type() != sitterNodeTypeExpressionStatement || statement.NamedChildCount() != 1 {
+			return false
+		}
+		docstring := statement.NamedChild(0)
+		if docstring.Type() != sitterNodeTypeString {
+			return false
+		}
+		// The prefix and the quotes are trimmed, since the example may start
+		// on the first line.
+		content := strings.TrimLeft(docstring.Content(p.code), `rRuU"'`)
+		for _, line := range strings.Split(content, "\n") {
+			if strings.HasPrefix(strings.TrimSpace(line), doctestPrompt) {
+				return true
+			}
+		}
+		return false
+	}
+	return false
+}
+
+// doctestName returns the name of the test running the doctests of the
+// module src, e.g. utils_doctest for utils.py, or sub_utils_doctest for
+// sub/utils.py.
+func doctestName(src string) string {
+	return strings.ReplaceAll(strings.TrimSuffix(src, ".py"), "/", "_") + doctestSuffix
+}
+
+// generateDoctests generates, with python_generate_doctests, a py_test per
+// module of the generated libraries with examples in its docstrings, running
+// `python -m doctest` on the module. The test depends on the module, resolved
+// like any other import, so that its imports are available. The existing
+// tests of the modules without doctests anymore, or of all the modules when
+// the doctests are disabled, are deleted, unless marked with a "# keep"
+// comment.
+func generateDoctests(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	result *language.GenerateResult,
+) {
+	generated := make(map[string]bool)
+	if cfg.GenerateDoctests() {
+		var doctestFiles []string
+		for _, r := range result.Gen {
+			if r.Kind() != pyLibraryKind {
+				continue
+			}
+			files, _ := r.PrivateAttr(doctestFilesKey).([]string)
+			for _, f := range files {
+				// The notebooks aren't modules of the package, see
+				// python_notebook_converter.
+				if filepath.Ext(f) == ".py" {
+					doctestFiles = append(doctestFiles, f)
+				}
+			}
+		}
+		sort.Strings(doctestFiles)
+		for _, f := range doctestFiles {
+			name := doctestName(f)
+			if generated[name] {
+				continue
+			}
+			generated[name] = true
+			pyTest := newTargetBuilder(pyTestKind, name, pythonProjectRoot, args.Rel, pyFileNames, false).
+				addModuleDependency(Module{
+					Name:     importSpecFromSrc(pythonProjectRoot, args.Rel, f).Imp,
+					Filepath: filepath.Join(args.Rel, f),
+				}).
+				generateImportsAttribute().
+				build()
+			pyTest.SetAttr("main_module", doctestModule)
+			pyTest.SetAttr("args", []string{"$(rootpath " + f + ")"})
+			pyTest.SetAttr("data", []string{f})
+			result.Gen = append(result.Gen, pyTest)
+			result.Imports = append(result.Imports, pyTest.PrivateAttr(config.GazelleImportsKey))
+		}
+	}
+
+	if args.File == nil {
+		return
+	}
+	for _, r := range args.File.Rules {
+		if generated[r.Name()] || !strings.HasSuffix(r.Name(), doctestSuffix) {
+			continue
+		}
+		if kindMatches(args.Config, r, pyTestKind) && r.AttrString("main_module") == doctestModule && !r.ShouldKeep() {
+			r.Delete()
+		}
+	}
+}
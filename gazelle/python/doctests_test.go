@@ -0,0 +1,78 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"context"
+	"testing"
+)
+
+func TestHasDoctests(t *testing.T) {
+	tests := []struct {
+		name string
+		code string
+		want bool
+	}{
+		{
+			name: "module docstring",
+			code: "\"\"\"\n>>> 1 + 1\n2\n\"\"\"\n",
+			want: true,
+		},
+		{
+			name: "example on the first line",
+			code: "def f():\n    r\"\"\">>> f()\"\"\"\n",
+			want: true,
+		},
+		{
+			name: "decorated method",
+			code: "class A:\n    @staticmethod\n    def f():\n        # A comment.\n        '''\n        >>> A.f()\n        '''\n",
+			want: true,
+		},
+		{
+			name: "nested function",
+			code: "def f():\n    def g():\n        \"\"\">>> g()\"\"\"\n",
+			want: false,
+		},
+		{
+			name: "not a docstring",
+			code: "x = 1\n\"\"\">>> x\"\"\"\nprint('>>> x')\n",
+			want: false,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewFileParser()
+			p.SetCodeAndFile([]byte(tt.code), "", "mod.py")
+			output, err := p.Parse(context.Background())
+			if err != nil {
+				t.Fatalf("Failed to parse: %v", err)
+			}
+			if output.HasDoctests != tt.want {
+				t.Errorf("HasDoctests = %v, want %v", output.HasDoctests, tt.want)
+			}
+		})
+	}
+}
+
+func TestDoctestName(t *testing.T) {
+	for src, want := range map[string]string{
+		"utils.py":     "utils_doctest",
+		"sub/utils.py": "sub_utils_doctest",
+	} {
+		if got := doctestName(src); got != want {
+			t.Errorf("doctestName(%q) = %q, want %q", src, got, want)
+		}
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strings"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// entryPointPolicySkip is a package where the python_entry_point_policy
+// directive prevented the generation of some targets.
+type entryPointPolicySkip struct {
+	pkg        string
+	kind       pythonconfig.EntryPointPolicyKind
+	entryFiles []string
+}
+
+// satisfiesEntryPointPolicy returns whether the given kind of targets can be
+// generated in a package containing the given files.
+func satisfiesEntryPointPolicy(cfg *pythonconfig.Config, kind pythonconfig.EntryPointPolicyKind, regularFiles []string) bool {
+	entryFiles := cfg.EntryPointPolicy(kind)
+	if entryFiles == nil {
+		return true
+	}
+	for _, f := range regularFiles {
+		for _, entryFile := range entryFiles {
+			if f == entryFile {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// skipByEntryPointPolicy records that the given kind of targets were not
+// generated in the package because of the python_entry_point_policy directive.
+func (py *Python) skipByEntryPointPolicy(cfg *pythonconfig.Config, pkg string, kind pythonconfig.EntryPointPolicyKind) {
+	py.entryPointPolicySkips = append(py.entryPointPolicySkips, entryPointPolicySkip{
+		pkg:        pkg,
+		kind:       kind,
+		entryFiles: cfg.EntryPointPolicy(kind),
+	})
+}
+
+// DoneGeneratingRules is called when all calls to GenerateRules have been
+// completed. It reports the packages skipped by the python_entry_point_policy
+// directive.
+func (py *Python) DoneGeneratingRules() {
+	if len(py.entryPointPolicySkips) == 0 {
+		return
+	}
+	skips := py.entryPointPolicySkips
+	sort.SliceStable(skips, func(i, j int) bool {
+		if skips[i].pkg != skips[j].pkg {
+			return skips[i].pkg < skips[j].pkg
+		}
+		return skips[i].kind < skips[j].kind
+	})
+	var sb strings.Builder
+	for _, skip := range skips {
+		fmt.Fprintf(&sb, "\t//%s: %s targets (none of %s found)\n", skip.pkg, skip.kind, strings.Join(skip.entryFiles, ", "))
+	}
+	log.Printf("INFO: targets skipped by the '%s' directive:\n%s", pythonconfig.EntryPointPolicy, sb.String())
+}
@@ -0,0 +1,104 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// explainDependencyEnv is the environment variable that was used to explain a
+// dependency before the -python_explain_dependency flag. It is still honored
+// when the flag isn't set.
+const explainDependencyEnv = "EXPLAIN_DEPENDENCY"
+
+// explainFile is the format of the file written by -python_explain_output.
+type explainFile struct {
+	// Dependency is the explained dependency, if any. When it's empty, all the
+	// resolution decisions are listed.
+	Dependency  string               `json:"dependency,omitempty"`
+	Resolutions []resolutionDecision `json:"resolutions"`
+}
+
+// parseExplainDependency returns the dependency to explain, from the
+// -python_explain_dependency flag or the EXPLAIN_DEPENDENCY environment
+// variable.
+func parseExplainDependency(flagValue string) (label.Label, error) {
+	value := flagValue
+	if value == "" {
+		value = os.Getenv(explainDependencyEnv)
+	}
+	if value == "" {
+		return label.NoLabel, nil
+	}
+	l, err := label.Parse(value)
+	if err != nil {
+		return label.NoLabel, fmt.Errorf("invalid dependency to explain %q: %w", value, err)
+	}
+	if l.Relative {
+		return label.NoLabel, fmt.Errorf("invalid dependency to explain %q: the label must be absolute", value)
+	}
+	return l, nil
+}
+
+// explains returns whether dep, relative to the target from, is the
+// dependency to explain.
+func (py *Resolver) explains(from label.Label, dep string) bool {
+	if py.explainDependency.Equal(label.NoLabel) {
+		return false
+	}
+	l, err := label.Parse(dep)
+	if err != nil {
+		return false
+	}
+	return l.Abs(from.Repo, from.Pkg).Equal(py.explainDependency)
+}
+
+// explainedResolutions returns the decisions resolving to the dependency to
+// explain, or all of them when no dependency is explained.
+func (py *Resolver) explainedResolutions() []resolutionDecision {
+	if py.explainDependency.Equal(label.NoLabel) {
+		return py.resolutions
+	}
+	explained := make([]resolutionDecision, 0)
+	for _, d := range py.resolutions {
+		if d.Label == py.explainDependency.String() {
+			explained = append(explained, d)
+		}
+	}
+	return explained
+}
+
+// writeExplanation writes the explained decisions as JSON to the given path.
+func (py *Resolver) writeExplanation(path string) error {
+	f := explainFile{Resolutions: py.explainedResolutions()}
+	if !py.explainDependency.Equal(label.NoLabel) {
+		f.Dependency = py.explainDependency.String()
+	}
+	if f.Resolutions == nil {
+		f.Resolutions = []resolutionDecision{}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the explanation: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the explanation: %w", err)
+	}
+	return nil
+}
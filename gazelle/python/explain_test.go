@@ -0,0 +1,72 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseExplainDependency(t *testing.T) {
+	t.Setenv(explainDependencyEnv, "")
+	l, err := parseExplainDependency("")
+	assert.NoError(t, err)
+	assert.Equal(t, label.NoLabel, l)
+
+	l, err = parseExplainDependency("@pip//requests:requests")
+	assert.NoError(t, err)
+	assert.Equal(t, label.New("pip", "requests", "requests"), l)
+
+	t.Setenv(explainDependencyEnv, "//lib")
+	l, err = parseExplainDependency("")
+	assert.NoError(t, err)
+	assert.Equal(t, label.New("", "lib", "lib"), l)
+
+	_, err = parseExplainDependency(":lib")
+	assert.Error(t, err)
+}
+
+func TestExplainResolutions(t *testing.T) {
+	r := Resolver{recordResolutions: true, explainDependency: label.New("", "lib", "lib")}
+	from := label.New("", "lib/sub", "sub")
+	assert.True(t, r.explains(from, "//lib"))
+	assert.False(t, r.explains(from, ":lib"))
+	assert.True(t, r.explains(label.New("", "lib", "other"), ":lib"))
+
+	r.recordResolution(from, Module{Name: "lib.util", Filepath: "lib/sub/a.py", LineNumber: 1}, "lib", resolutionStrategyIndex, "//lib")
+	r.recordResolution(from, Module{Name: "os", Filepath: "lib/sub/a.py", LineNumber: 2}, "os", resolutionStrategyStdlib, "")
+
+	path := filepath.Join(t.TempDir(), "explain.json")
+	if !assert.NoError(t, r.writeExplanation(path)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var f explainFile
+	assert.NoError(t, json.Unmarshal(data, &f))
+	assert.Equal(t, explainFile{
+		Dependency: "//lib",
+		Resolutions: []resolutionDecision{
+			{Target: "//lib/sub", File: "lib/sub/a.py", Line: 1, Import: "lib.util", Module: "lib", Strategy: resolutionStrategyIndex, Label: "//lib"},
+		},
+	}, f)
+}
@@ -0,0 +1,201 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"io/fs"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// externalIndex maps the modules provided by the py_library targets of an
+// external repository to their labels.
+type externalIndex map[string][]label.Label
+
+// parseExternalRepository parses the value of the python_external_repository
+// directive, e.g. "shared ../shared". It returns the name of the repository
+// and the path to its checkout.
+func parseExternalRepository(value string) (string, string, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("expected a repository name and the path to its checkout, got %q", value)
+	}
+	name := strings.TrimPrefix(fields[0], "@")
+	if _, err := label.Parse("@" + name + "//:x"); err != nil || name == "" {
+		return "", "", fmt.Errorf("invalid repository name %q", fields[0])
+	}
+	return name, fields[1], nil
+}
+
+// externalRepositoryPath returns the absolute path to the checkout declared
+// in the package rel, relative to its directory unless it's absolute.
+func externalRepositoryPath(repoRoot, rel, path string) string {
+	if filepath.IsAbs(path) {
+		return filepath.Clean(path)
+	}
+	return filepath.Join(repoRoot, rel, path)
+}
+
+// loadExternalIndexes indexes the external repositories that the
+// configuration of any of the pending resolutions declares, before their
+// cache keys are computed.
+func (py *Resolver) loadExternalIndexes(pending []*ruleResolution) {
+	for _, res := range pending {
+		cfgs := res.c.Exts[languageName].(pythonconfig.Configs)
+		for _, repository := range cfgs[res.from.Pkg].ExternalRepositories() {
+			py.externalIndex(res.c, repository)
+		}
+	}
+}
+
+// externalIndex returns the index of the external repository, building it on
+// first use. It's safe to call from the concurrent resolutions.
+func (py *Resolver) externalIndex(c *config.Config, repository pythonconfig.ExternalRepositoryCheckout) externalIndex {
+	py.mu.Lock()
+	defer py.mu.Unlock()
+	key := repository.Name + "=" + repository.Path
+	if index, ok := py.externalIndexes[key]; ok {
+		return index
+	}
+	index, err := buildExternalIndex(c, repository)
+	if err != nil {
+		log.Fatalf("failed to index the external repository %q: %v", repository.Name, err)
+	}
+	if py.externalIndexes == nil {
+		py.externalIndexes = make(map[string]externalIndex)
+	}
+	py.externalIndexes[key] = index
+	return index
+}
+
+// buildExternalIndex walks the checkout of the external repository and
+// indexes the modules of the py_library targets of its BUILD files, under the
+// python_root directives of the repository.
+func buildExternalIndex(c *config.Config, repository pythonconfig.ExternalRepositoryCheckout) (externalIndex, error) {
+	index := make(externalIndex)
+	roots := make(map[string]string)
+	err := filepath.WalkDir(repository.Path, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if !entry.IsDir() {
+			return nil
+		}
+		rel, _ := filepath.Rel(repository.Path, path)
+		if rel != "." && skipPreflightDir(rel, entry.Name()) {
+			return fs.SkipDir
+		}
+		pkg := filepath.ToSlash(rel)
+		if pkg == "." {
+			pkg = ""
+		}
+		root := ""
+		if pkg != "" {
+			parent := filepath.ToSlash(filepath.Dir(rel))
+			if parent == "." {
+				parent = ""
+			}
+			root = roots[parent]
+		}
+		f, err := loadBuildFile(c, path, pkg)
+		if err != nil {
+			return err
+		}
+		if f != nil {
+			for _, d := range f.Directives {
+				if d.Key == pythonconfig.PythonRootDirective {
+					root = pkg
+				}
+			}
+			for _, r := range f.Rules {
+				if r.Kind() != pyLibraryKind {
+					continue
+				}
+				target := label.New(repository.Name, pkg, r.Name())
+				for _, src := range r.AttrStrings("srcs") {
+					if filepath.Ext(src) != ".py" {
+						continue
+					}
+					imp := importSpecFromSrc(root, pkg, src).Imp
+					index[imp] = append(index[imp], target)
+				}
+			}
+		}
+		roots[pkg] = root
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return index, nil
+}
+
+// in the repository or in an external one, or returns nil if there is none.
+// external repository, or returns nil if there is none.
+func loadBuildFile(c *config.Config, dir, pkg string) (*rule.File, error) {
+	for _, name := range c.ValidBuildFileNames {
+		path := filepath.Join(dir, name)
+		data, err := os.ReadFile(path)
+		if err != nil {
+			if os.IsNotExist(err) {
+				continue
+			}
+			// BUILD may be a directory, e.g. of a build tool.
+			if info, statErr := os.Stat(path); statErr == nil && info.IsDir() {
+				continue
+			}
+			return nil, err
+		}
+		return rule.LoadData(path, pkg, data)
+	}
+	return nil, nil
+}
+
+// findExternalModule looks up the module in the external repositories of the
+// configuration. It returns the labels of the targets providing it, from all
+// the repositories, sorted.
+func (py *Resolver) findExternalModule(c *config.Config, cfg *pythonconfig.Config, moduleName string) []label.Label {
+	var matches []label.Label
+	for _, repository := range cfg.ExternalRepositories() {
+		matches = append(matches, py.externalIndex(c, repository)[moduleName]...)
+	}
+	sort.Slice(matches, func(i, j int) bool {
+		return matches[i].String() < matches[j].String()
+	})
+	return matches
+}
+
+// addExternalIndexes records the indexes of the external repositories in the
+// cache, so that the resolutions are invalidated when they change.
+func (py *Resolver) addExternalIndexes() {
+	if py.cache == nil {
+		return
+	}
+	for key, index := range py.externalIndexes {
+		for module, targets := range index {
+			py.cache.addExternal(key, module, targets)
+		}
+	}
+}
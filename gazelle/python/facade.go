@@ -0,0 +1,142 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// facadeOf returns the facade package of the package pkg if it's one of its
+// immediate subdirectories, whose targets are re-exported by the facade, see
+// python_coarse_grained_facade.
+func facadeOf(cfg *pythonconfig.Config, pkg string) (string, bool) {
+	facade, ok := cfg.FacadePackage()
+	if !ok || pkg == facade {
+		return "", false
+	}
+	parent := path.Dir(pkg)
+	if parent == "." {
+		parent = ""
+	}
+	return facade, parent == facade
+}
+
+// isUnderPackage returns whether the package pkg is the package parent or one
+// of its subpackages.
+func isUnderPackage(pkg, parent string) bool {
+	return parent == "" || pkg == parent || strings.HasPrefix(pkg, parent+"/")
+}
+
+// facadeVisibility returns the visibility of the targets of the immediate
+// subdirectories of the facade package: the facade and its subpackages only,
+// so that the subdirectories may depend on each other.
+func facadeVisibility(facade string) []string {
+	return []string{label.New("", facade, "__subpackages__").String()}
+}
+
+// facadeLabel returns the label of the library of the facade package, named
+// like the library generated for the whole package.
+func facadeLabel(c *config.Config, facade string) label.Label {
+	cfg := c.Exts[languageName].(pythonconfig.Configs)[facade]
+	name := cfg.TargetName(pythonconfig.GeneratedTarget{
+		Kind:        pyLibraryKind,
+		Pkg:         facade,
+		PythonRoot:  cfg.PythonProjectRoot(),
+		PackageName: filepath.Base(filepath.Join(c.RepoRoot, facade)),
+	})
+	return label.New(c.RepoName, facade, name)
+}
+
+// recordFacadeMembers records the libraries generated in the immediate
+// subdirectory of a facade package, see generateFacade.
+func (py *Python) recordFacadeMembers(facade string, args language.GenerateArgs, result *language.GenerateResult) {
+	for _, r := range result.Gen {
+		if r.Kind() != pyLibraryKind {
+			continue
+		}
+		if py.facadeMembers == nil {
+			py.facadeMembers = make(map[string][]string)
+		}
+		member := label.New("", args.Rel, r.Name()).Rel("", facade).String()
+		py.facadeMembers[facade] = append(py.facadeMembers[facade], member)
+	}
+}
+
+// generateFacade makes the library of the facade package depend on the
+// libraries of its immediate subdirectories, generated before it as Gazelle
+// walks the repository in post-order. The library is generated without
+// srcs when the facade package has no Python file of its own.
+func (py *Python) generateFacade(
+	args language.GenerateArgs,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	result *language.GenerateResult,
+) {
+	members := py.facadeMembers[args.Rel]
+	delete(py.facadeMembers, args.Rel)
+	if len(members) == 0 {
+		return
+	}
+	name := facadeLabel(args.Config, args.Rel).Name
+	for _, r := range result.Gen {
+		if r.Kind() == pyLibraryKind && r.Name() == name {
+			resolvedDeps := r.PrivateAttr(resolvedDepsKey).(*treeset.Set)
+			for _, member := range members {
+				resolvedDeps.Add(member)
+			}
+			return
+		}
+	}
+	facade := newTargetBuilder(pyLibraryKind, name, pythonProjectRoot, args.Rel, pyFileNames, false).
+		addVisibility(visibility).
+		addResolvedDependencies(members).
+		build()
+	result.Gen = append(result.Gen, facade)
+	result.Imports = append(result.Imports, facade.PrivateAttr(config.GazelleImportsKey))
+}
+
+// facadeMatches replaces the matches of an import that are targets of the
+// immediate subdirectories of a facade package with the library of the
+// facade, unless the importing target is in the facade package or one of its
+// subpackages.
+func facadeMatches(c *config.Config, cfgs pythonconfig.Configs, matches []resolve.FindResult, from label.Label) []resolve.FindResult {
+	replaced := make([]resolve.FindResult, 0, len(matches))
+	seen := make(map[string]bool, len(matches))
+	for _, match := range matches {
+		if match.Label.Repo == "" || match.Label.Repo == from.Repo {
+			if cfg, ok := cfgs[match.Label.Pkg]; ok {
+				if facade, ok := facadeOf(cfg, match.Label.Pkg); ok && !isUnderPackage(from.Pkg, facade) {
+					match = resolve.FindResult{Label: facadeLabel(c, facade)}
+				}
+			}
+		}
+		if !seen[match.Label.String()] {
+			seen[match.Label.String()] = true
+			replaced = append(replaced, match)
+		}
+	}
+	return replaced
+}
@@ -0,0 +1,93 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestFacadeOf(t *testing.T) {
+	root := pythonconfig.New("/repo", "")
+	root.SetCoarseGrainedGeneration(true)
+	platform := root.NewChild()
+	platform.SetCoarseGrainedFacade("platform", true)
+	tests := map[string]bool{
+		"platform":           false,
+		"platform/auth":      true,
+		"platform/auth/keys": false,
+		"platformer":         false,
+	}
+	for pkg, want := range tests {
+		facade, ok := facadeOf(platform, pkg)
+		assert.Equal(t, want, ok, pkg)
+		if ok {
+			assert.Equal(t, "platform", facade, pkg)
+		}
+	}
+
+	packageMode := platform.NewChild()
+	packageMode.SetCoarseGrainedGeneration(false)
+	_, ok := facadeOf(packageMode, "platform/auth")
+	assert.False(t, ok, "expected no facade outside the project generation mode")
+}
+
+func TestFacadeMatches(t *testing.T) {
+	root := pythonconfig.New("/repo", "")
+	root.SetCoarseGrainedGeneration(true)
+	platform := root.NewChild()
+	platform.SetCoarseGrainedFacade("platform", true)
+	cfgs := pythonconfig.Configs{
+		"":                   root,
+		"platform":           platform,
+		"platform/auth":      platform.NewChild(),
+		"platform/billing":   platform.NewChild(),
+		"platform/auth/keys": platform.NewChild(),
+	}
+	c := config.New()
+	c.RepoRoot = "/repo"
+	c.Exts[languageName] = cfgs
+
+	var matches []resolve.FindResult
+	for _, target := range []string{
+		"//platform/auth:auth",
+		"//platform/billing:billing",
+		"//tools:tools",
+	} {
+		l, err := label.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches = append(matches, resolve.FindResult{Label: l})
+	}
+
+	var got []string
+	for _, match := range facadeMatches(c, cfgs, matches, label.New("", "app", "app")) {
+		got = append(got, match.Label.String())
+	}
+	assert.Equal(t, []string{"//platform", "//tools"}, got)
+
+	got = nil
+	for _, match := range facadeMatches(c, cfgs, matches, label.New("", "platform/billing", "billing")) {
+		got = append(got, match.Label.String())
+	}
+	assert.Equal(t, []string{"//platform/auth", "//platform/billing", "//tools"}, got)
+}
@@ -15,11 +15,13 @@
 package python
 
 import (
+	"bytes"
 	"context"
 	"fmt"
 	"log"
 	"os"
 	"path/filepath"
+	"regexp"
 	"strings"
 
 	sitter "github.com/smacker/go-tree-sitter"
@@ -37,13 +39,47 @@ const (
 	sitterNodeTypeImportStatement     = "import_statement"
 	sitterNodeTypeComparisonOperator  = "comparison_operator"
 	sitterNodeTypeImportFromStatement = "import_from_statement"
+	sitterNodeTypeElifClause          = "elif_clause"
+	sitterNodeTypeAttribute           = "attribute"
+	sitterNodeTypeCall                = "call"
+	sitterNodeTypeTuple               = "tuple"
+	sitterNodeTypeList                = "list"
+	sitterNodeTypeTryStatement        = "try_statement"
+	sitterNodeTypeExceptClause        = "except_clause"
+	sitterNodeTypeAsPattern           = "as_pattern"
+	sitterNodeTypeBlock               = "block"
+	sitterNodeTypeType                = "type"
 )
 
+// forwardReferencePattern matches the dotted names in the string annotations,
+// e.g. mypkg.models.User in "Optional[mypkg.models.User]". Names without a dot
+// refer to the current module and are skipped.
+var forwardReferencePattern = regexp.MustCompile(`[A-Za-z_]\w*(?:\.[A-Za-z_]\w*)+`)
+
 type ParserOutput struct {
 	FileName string
 	Modules  []Module
 	Comments []Comment
 	HasMain  bool
+	// HasShebang is whether the file starts with a shebang line running
+	// Python, e.g. "#!/usr/bin/env python3".
+	HasShebang bool
+	// ReExports maps the names imported by an __init__.py file with a from
+	// import to the module they come from, e.g. "bar" to ".impl.bar.bar" for
+	// `from .impl.bar import bar`. Relative modules keep their leading dots.
+	ReExports map[string]string
+	// PackageData are the package data files read with importlib.resources or
+	// pkgutil.get_data.
+	PackageData []PackageResource
+	// PytestMarkers are the names of the pytest markers applied to the tests
+	// of the file, e.g. "slow" for `@pytest.mark.slow`, sorted.
+	PytestMarkers []string
+	// TestCases is the estimated number of test cases of the file: its test
+	// functions, each multiplied by the values of its parametrize markers.
+	TestCases int
+	// HasDoctests is whether the docstrings of the file have examples, see
+	// python_generate_doctests.
+	HasDoctests bool
 }
 
 type FileParser struct {
@@ -51,6 +87,15 @@ type FileParser struct {
 	relFilepath          string
 	output               ParserOutput
 	inTypeCheckingBlock  bool
+	// platforms are the operating systems the code being parsed runs on, when
+	// it's guarded by a sys.platform check.
+	platforms []string
+	// inOptionalBlock is true while parsing the body of a `try:` statement
+	// catching ImportError.
+	inOptionalBlock bool
+	// resolveStringAnnotations enables the extraction of the forward
+	// references from the string annotations.
+	resolveStringAnnotations bool
 }
 
 func NewFileParser() *FileParser {
@@ -124,6 +169,16 @@ func (p *FileParser) parseMain(ctx context.Context, node *sitter.Node) bool {
 	return false
 }
 
+// hasPythonShebang returns whether the code starts with a shebang line
+// running Python, which is another idiom for python scripts/binaries.
+func hasPythonShebang(code []byte) bool {
+	if !bytes.HasPrefix(code, []byte("#!")) {
+		return false
+	}
+	line, _, _ := bytes.Cut(code, []byte("\n"))
+	return bytes.Contains(line, []byte("python"))
+}
+
 // parseImportStatement parses a node for an import statement, returning a `Module` and a boolean
 // representing if the parse was OK or not.
 func parseImportStatement(node *sitter.Node, code []byte) (Module, bool) {
@@ -168,6 +223,8 @@ func (p *FileParser) parseImportStatements(node *sitter.Node) bool {
 			m.Name = cleanImportString(m.Name)
 			m.Filepath = p.relFilepath
 			m.TypeCheckingOnly = p.inTypeCheckingBlock
+			m.Platforms = p.platforms
+			m.Optional = p.inOptionalBlock
 			if strings.HasPrefix(m.Name, ".") {
 				continue
 			}
@@ -176,6 +233,9 @@ func (p *FileParser) parseImportStatements(node *sitter.Node) bool {
 	} else if node.Type() == sitterNodeTypeImportFromStatement {
 		from := node.Child(1).Content(p.code)
 		from = cleanImportString(from)
+		if p.output.FileName == pyLibraryEntrypointFilename {
+			p.parseReExports(node, from)
+		}
 		// If the import is from the current package, we don't need to add it to the modules i.e. from . import Class1.
 		// If the import is from a different relative package i.e. from .package1 import foo, we need to add it to the modules.
 		if from == "." {
@@ -191,6 +251,8 @@ func (p *FileParser) parseImportStatements(node *sitter.Node) bool {
 			m.Name = cleanImportString(m.Name)
 			m.Name = fmt.Sprintf("%s.%s", from, m.Name)
 			m.TypeCheckingOnly = p.inTypeCheckingBlock
+			m.Platforms = p.platforms
+			m.Optional = p.inOptionalBlock
 			p.output.Modules = append(p.output.Modules, m)
 		}
 	} else {
@@ -199,6 +261,33 @@ func (p *FileParser) parseImportStatements(node *sitter.Node) bool {
 	return true
 }
 
+// parseReExports records the names imported by the from import statement node
+// in FileParser.output.ReExports.
+func (p *FileParser) parseReExports(node *sitter.Node, from string) {
+	for j := 3; j < int(node.ChildCount()); j++ {
+		child := node.Child(j)
+		var name, alias string
+		switch child.Type() {
+		case sitterNodeTypeDottedName:
+			name = cleanImportString(child.Content(p.code))
+			alias = name
+		case sitterNodeTypeAliasedImport:
+			name = cleanImportString(child.Child(0).Content(p.code))
+			alias = child.ChildByFieldName("alias").Content(p.code)
+		default:
+			continue
+		}
+		if p.output.ReExports == nil {
+			p.output.ReExports = make(map[string]string)
+		}
+		if strings.HasSuffix(from, ".") {
+			p.output.ReExports[alias] = from + name
+		} else {
+			p.output.ReExports[alias] = from + "." + name
+		}
+	}
+}
+
 // parseComments parses a node for comments, returning true if the node is a comment.
 // It updates FileParser.output.Comments with the parsed comment.
 func (p *FileParser) parseComments(node *sitter.Node) bool {
@@ -210,6 +299,15 @@ func (p *FileParser) parseComments(node *sitter.Node) bool {
 }
 
 func (p *FileParser) SetCodeAndFile(code []byte, relPackagePath, filename string) {
+	if filepath.Ext(filename) == notebookExt {
+		// The code cells of the notebooks are parsed, see
+		// python_notebook_converter.
+		nbCode, err := notebookCode(code)
+		if err != nil {
+			log.Printf("WARNING: failed to read the notebook %q: %v\n", filepath.Join(relPackagePath, filename), err)
+		}
+		code = nbCode
+	}
 	p.code = code
 	p.relFilepath = filepath.Join(relPackagePath, filename)
 	p.output.FileName = filename
@@ -241,28 +339,125 @@ func (p *FileParser) isTypeCheckingBlock(node *sitter.Node) bool {
 	return false
 }
 
+// trailingAnnotation returns the kind of the "# gazelle:typing-only" or
+// "# gazelle:no-dep" annotation trailing the import statement stmt, on its
+// last line, if the node is one.
+func (p *FileParser) trailingAnnotation(stmt, node *sitter.Node) (annotationKind, bool) {
+	if node.Type() != sitterNodeTypeComment || node.StartPoint().Row != stmt.EndPoint().Row {
+		return "", false
+	}
+	comment := Comment(node.Content(p.code))
+	annotation, err := comment.asAnnotation()
+	if err != nil || annotation == nil {
+		return "", false
+	}
+	switch annotation.kind {
+	case annotationKindTypingOnly, annotationKindNoDep:
+		return annotation.kind, true
+	}
+	return "", false
+}
+
+// parseStringAnnotations parses the type annotation node for strings, e.g.
+// `x: "mypkg.models.User"`, adding the dotted names they contain to
+// FileParser.output.Modules as type-checking only forward references.
+func (p *FileParser) parseStringAnnotations(node *sitter.Node) {
+	if node.Type() == sitterNodeTypeString {
+		content := strings.TrimLeft(node.Content(p.code), "rRbBuUfF")
+		content = strings.Trim(content, `"'`)
+		for _, name := range forwardReferencePattern.FindAllString(content, -1) {
+			p.output.Modules = append(p.output.Modules, Module{
+				Name:             name,
+				LineNumber:       node.StartPoint().Row + 1,
+				Filepath:         p.relFilepath,
+				TypeCheckingOnly: true,
+				ForwardReference: true,
+			})
+		}
+		return
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		p.parseStringAnnotations(node.NamedChild(i))
+	}
+}
+
 func (p *FileParser) parse(ctx context.Context, node *sitter.Node) {
 	if node == nil {
 		return
 	}
 
+	if p.resolveStringAnnotations && node.Type() == sitterNodeTypeType {
+		p.parseStringAnnotations(node)
+		return
+	}
+
+	if p.parsePackageResource(node) {
+		return
+	}
+
 	// Check if this is a TYPE_CHECKING block
 	wasInTypeCheckingBlock := p.inTypeCheckingBlock
 	if p.isTypeCheckingBlock(node) {
 		p.inTypeCheckingBlock = true
 	}
 
+	// Check if this is a block guarded by a sys.platform check. Only the
+	// consequence is guarded; the elif and else clauses are not.
+	var guarded *sitter.Node
+	var guardedPlatforms []string
+	if node.Type() == sitterNodeTypeIfStatement || node.Type() == sitterNodeTypeElifClause {
+		if platforms := p.platformsOfCondition(node.ChildByFieldName("condition")); platforms != nil {
+			guarded = node.ChildByFieldName("consequence")
+			guardedPlatforms = intersectPlatforms(p.platforms, platforms)
+		}
+	}
+
+	// Check if this is a try statement making the imports of its body optional.
+	var optional *sitter.Node
+	if p.catchesImportError(node) {
+		optional = node.ChildByFieldName("body")
+	}
+
 	for i := 0; i < int(node.ChildCount()); i++ {
 		if err := ctx.Err(); err != nil {
 			return
 		}
 		child := node.Child(i)
+		numModules := len(p.output.Modules)
 		if p.parseImportStatements(child) {
+			if next := node.Child(i + 1); next != nil {
+				if kind, ok := p.trailingAnnotation(child, next); ok {
+					if kind == annotationKindNoDep {
+						p.output.Modules = p.output.Modules[:numModules]
+					} else {
+						for j := numModules; j < len(p.output.Modules); j++ {
+							p.output.Modules[j].TypeCheckingOnly = true
+						}
+					}
+					// The annotation is consumed, so that it isn't reported as
+					// misplaced.
+					i++
+				}
+			}
 			continue
 		}
 		if p.parseComments(child) {
 			continue
 		}
+		if guarded != nil && child.Equal(guarded) {
+			wasPlatforms := p.platforms
+			p.platforms = guardedPlatforms
+			p.parse(ctx, child)
+			p.platforms = wasPlatforms
+			continue
+		}
+		if optional != nil && child.Equal(optional) {
+			wasInOptionalBlock := p.inOptionalBlock
+			p.inOptionalBlock = true
+			p.parse(ctx, child)
+			p.inOptionalBlock = wasInOptionalBlock
+			continue
+		}
 		p.parse(ctx, child)
 	}
 
@@ -277,6 +472,10 @@ func (p *FileParser) Parse(ctx context.Context) (*ParserOutput, error) {
 	}
 
 	p.output.HasMain = p.parseMain(ctx, rootNode)
+	p.output.HasShebang = hasPythonShebang(p.code)
+	p.output.PytestMarkers = p.parsePytestMarkers(rootNode)
+	p.output.TestCases = p.countTestCases(rootNode)
+	p.output.HasDoctests = p.hasDoctests(rootNode)
 
 	p.parse(ctx, rootNode)
 	return &p.output, nil
@@ -241,6 +241,30 @@ if __name__ == "__main__":
 	}
 }
 
+func TestParseShebang(t *testing.T) {
+	t.Parallel()
+	units := []struct {
+		name   string
+		code   string
+		result bool
+	}{
+		{name: "no shebang", code: "a = 1\n", result: false},
+		{name: "env python", code: "#!/usr/bin/env python3\nimport sys\n", result: true},
+		{name: "absolute python", code: "#!/usr/bin/python -u\n", result: true},
+		{name: "shell", code: "#!/bin/sh\n# python\n", result: false},
+		{name: "not first line", code: "\n#!/usr/bin/env python3\n", result: false},
+	}
+	for _, u := range units {
+		t.Run(u.name, func(t *testing.T) {
+			p := NewFileParser()
+			p.SetCodeAndFile([]byte(u.code), "", "")
+			output, err := p.Parse(context.Background())
+			assert.NoError(t, err)
+			assert.Equal(t, u.result, output.HasShebang)
+		})
+	}
+}
+
 func TestParseFull(t *testing.T) {
 	p := NewFileParser()
 	code := []byte(`from bar import abc`)
@@ -292,6 +316,265 @@ def example_function():
 	}
 }
 
+func TestTypingOnlyAnnotation(t *testing.T) {
+	code := `
+import attrs  # gazelle:typing-only
+import yaml
+from typing_extensions import (
+    Self,
+)  # gazelle:typing-only
+import toml
+# gazelle:typing-only
+import ujson
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	expectedModules := map[string]bool{
+		"attrs":                  true,
+		"yaml":                   false,
+		"typing_extensions.Self": true,
+		"toml":                   false,
+		"ujson":                  false,
+	}
+	for _, mod := range result.Modules {
+		if expected, exists := expectedModules[mod.Name]; exists {
+			if mod.TypeCheckingOnly != expected {
+				t.Errorf("Module %s: expected TypeCheckingOnly=%v, got %v", mod.Name, expected, mod.TypeCheckingOnly)
+			}
+		}
+	}
+	// Only the misplaced annotation is left in the comments.
+	assert.Equal(t, []Comment{"# gazelle:typing-only"}, result.Comments)
+}
+
+func TestNoDepAnnotation(t *testing.T) {
+	code := `
+import attrs  # gazelle:no-dep
+import yaml
+from typing_extensions import (
+    Self,
+)  # gazelle: no-dep
+import toml
+# gazelle:no-dep
+import ujson
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	var names []string
+	for _, mod := range result.Modules {
+		names = append(names, mod.Name)
+	}
+	assert.Equal(t, []string{"yaml", "toml", "ujson"}, names)
+	// Only the misplaced annotation is left in the comments.
+	assert.Equal(t, []Comment{"# gazelle:no-dep"}, result.Comments)
+}
+
+func TestStringAnnotations(t *testing.T) {
+	code := `
+import numpy as np
+
+x: "mypkg.config.Settings" = load()
+description = "not.an.annotation"
+
+def f(user: "mypkg.models.User", items: "list[other.Item]" = None) -> "np.ndarray":
+    local: "Local" = None
+`
+	p := NewFileParser()
+	p.resolveStringAnnotations = true
+	p.SetCodeAndFile([]byte(code), "", "test.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	var forwardReferences []string
+	for _, mod := range result.Modules {
+		if mod.ForwardReference {
+			assert.True(t, mod.TypeCheckingOnly, mod.Name)
+			forwardReferences = append(forwardReferences, mod.Name)
+		}
+	}
+	assert.Equal(t, []string{"mypkg.config.Settings", "mypkg.models.User", "other.Item", "np.ndarray"}, forwardReferences)
+
+	// The string annotations are only parsed when enabled.
+	p = NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test.py")
+	result, err = p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	assert.Equal(t, []Module{{Name: "numpy", LineNumber: 2, Filepath: "test.py"}}, result.Modules)
+}
+
+func TestParseReExports(t *testing.T) {
+	code := `
+from . import impl
+from .impl.bar import bar, baz as qux
+from foo.models import User
+from ..sibling import *
+import os
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "foo", "__init__.py")
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	assert.Equal(t, map[string]string{
+		"impl": ".impl",
+		"bar":  ".impl.bar.bar",
+		"qux":  ".impl.bar.baz",
+		"User": "foo.models.User",
+	}, result.ReExports)
+
+	// Only the __init__.py files re-export names.
+	p = NewFileParser()
+	p.SetCodeAndFile([]byte(code), "foo", "other.py")
+	result, err = p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	assert.Nil(t, result.ReExports)
+}
+
+func TestPlatformGuardedImports(t *testing.T) {
+	code := `
+import sys
+
+if sys.platform == "win32":
+    import winreg
+    import pywintypes
+elif "darwin" == sys.platform:
+    import objc
+elif sys.platform.startswith("freebsd"):
+    import bsd
+else:
+    import distro
+
+if sys.platform in ("linux", "darwin"):
+    if sys.platform.startswith("linux"):
+        import systemd
+    import uvloop
+
+if sys.platform != "win32":
+    import fcntl
+
+if sys.platform == "emscripten":
+    import pyodide
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	expectedPlatforms := map[string][]string{
+		"sys":        nil,
+		"winreg":     {"windows"},
+		"pywintypes": {"windows"},
+		"objc":       {"osx"},
+		"bsd":        {"freebsd"},
+		"distro":     nil,
+		"systemd":    {"linux"},
+		"uvloop":     {"linux", "osx"},
+		"fcntl":      nil,
+		"pyodide":    nil,
+	}
+	assert.Len(t, result.Modules, len(expectedPlatforms))
+	for _, mod := range result.Modules {
+		assert.Equal(t, expectedPlatforms[mod.Name], mod.Platforms, mod.Name)
+	}
+}
+
+func TestOptionalImports(t *testing.T) {
+	code := `
+try:
+    import ujson as json
+except ImportError:
+    import json
+
+try:
+    from lxml import etree
+except (ValueError, ModuleNotFoundError) as e:
+    etree = None
+
+try:
+    import yaml
+except:
+    yaml = None
+
+try:
+    import toml
+except ValueError:
+    toml = None
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	expectedOptional := map[string]bool{
+		"ujson":      true,
+		"json":       false,
+		"lxml.etree": true,
+		"yaml":       true,
+		"toml":       false,
+	}
+	assert.Len(t, result.Modules, len(expectedOptional))
+	for _, mod := range result.Modules {
+		assert.Equal(t, expectedOptional[mod.Name], mod.Optional, mod.Name)
+	}
+}
+
+func TestPackageData(t *testing.T) {
+	code := `
+import importlib.resources
+import pkgutil
+from importlib.resources import files
+
+schema = importlib.resources.files("mypkg").joinpath("schemas", "user.json").read_text()
+config = pkgutil.get_data(__name__, "data/config.yaml")
+logo = files("mypkg.assets") / "img" / "logo.png"
+template = importlib.resources.read_text("mypkg", "base.html")
+name = compute()
+dynamic = importlib.resources.files("mypkg") / name
+escaping = files(__package__) / ".." / "secret.txt"
+anchor = files("mypkg")
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "app", "main.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	assert.Equal(t, []PackageResource{
+		{Package: "mypkg", Path: "schemas/user.json", LineNumber: 6, Filepath: "app/main.py"},
+		{Package: "", Path: "data/config.yaml", LineNumber: 7, Filepath: "app/main.py"},
+		{Package: "mypkg.assets", Path: "img/logo.png", LineNumber: 8, Filepath: "app/main.py"},
+		{Package: "mypkg", Path: "base.html", LineNumber: 9, Filepath: "app/main.py"},
+	}, result.PackageData)
+}
+
 func TestParseImportStatements_MultilineWithBackslashAndWhitespace(t *testing.T) {
 	t.Parallel()
 	t.Run("multiline from import", func(t *testing.T) {
@@ -383,3 +666,73 @@ from foo\
 		assert.ElementsMatch(t, expected, output.Modules)
 	})
 }
+
+func TestParsePytestMarkers(t *testing.T) {
+	code := `
+import pytest
+
+pytestmark = [pytest.mark.integration, pytest.mark.usefixtures("db")]
+
+@pytest.mark.slow
+def test_slow():
+    pass
+
+@pytest.mark.timeout(60)
+def test_timeout():
+    pass
+
+class TestGroup:
+    pytestmark = pytest.mark.gpu
+
+    @pytest.mark.slow
+    def test_method(self):
+        pass
+
+@pytest.fixture
+def fixture():
+    pass
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test_foo.py")
+
+	output, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	assert.Equal(t, []string{"gpu", "integration", "slow", "timeout", "usefixtures"}, output.PytestMarkers)
+}
+
+func TestPackageDataFileReads(t *testing.T) {
+	code := `import os
+from pathlib import Path
+
+HERE = Path(__file__).parent
+a = open("data/a.json")
+b = (Path(__file__).resolve().parent / "b.json").read_text()
+c = Path(__file__).parent.joinpath("sub", "c.txt")
+d = os.path.join(os.path.dirname(os.path.abspath(__file__)), "d.csv")
+e = Path(__file__).with_name("e.yaml")
+f = open(os.path.join(os.path.dirname(__file__), "f.bin"), "rb")
+open("out.txt", "w")
+open(Path(__file__).parent / "log.txt", mode="a")
+open(name)
+Path(__file__).parent.parent / "outside.json"
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "app", "main.py")
+
+	result, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+
+	assert.Equal(t, []PackageResource{
+		{Path: "data/a.json", LineNumber: 5, Filepath: "app/main.py"},
+		{Path: "b.json", LineNumber: 6, Filepath: "app/main.py"},
+		{Path: "sub/c.txt", LineNumber: 7, Filepath: "app/main.py"},
+		{Path: "d.csv", LineNumber: 8, Filepath: "app/main.py"},
+		{Path: "e.yaml", LineNumber: 9, Filepath: "app/main.py"},
+		{Path: "f.bin", LineNumber: 10, Filepath: "app/main.py"},
+	}, result.PackageData)
+}
@@ -42,6 +42,8 @@ const (
 	pyTestEntrypointTargetname  = "__test__"
 	conftestFilename            = "conftest.py"
 	conftestTargetname          = "conftest"
+	testUtilsTargetname         = "testutils"
+	buildToolsTargetname        = "build_tools"
 )
 
 var (
@@ -75,7 +77,8 @@ func matchesAnyGlob(s string, globs []string) bool {
 }
 
 // findConftestPaths returns package paths containing conftest.py, from currentPkg
-// up through ancestors, stopping at module root.
+// up through ancestors, stopping at the Python project root, above which the
+// conftest.py files aren't modules of the project.
 func findConftestPaths(repoRoot, currentPkg, pythonProjectRoot string, includeAncestorConftest bool) []string {
 	var result []string
 	for pkg := currentPkg; ; pkg = filepath.Dir(pkg) {
@@ -91,7 +94,7 @@ func findConftestPaths(repoRoot, currentPkg, pythonProjectRoot string, includeAn
 		if !includeAncestorConftest {
 			break
 		}
-		if pkg == "" {
+		if pkg == "" || pkg == pythonProjectRoot {
 			break
 		}
 	}
@@ -109,17 +112,40 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		return language.GenerateResult{}
 	}
 
+	if cfg.IsOpaquePackage(args.Rel) {
+		// The targets of the opaque directories are hand-written, see
+		// python_opaque.
+		return language.GenerateResult{}
+	}
+
 	if !isBazelPackage(args.Dir) {
 		if cfg.CoarseGrainedGeneration() {
 			// Determine if the current directory is the root of the coarse-grained
 			// generation. If not, return without generating anything.
+			// The immediate subdirectories of a facade package are roots
+			// too, see python_coarse_grained_facade.
 			parent := cfg.Parent()
-			if parent != nil && parent.CoarseGrainedGeneration() {
+			if _, ok := facadeOf(cfg, args.Rel); !ok && parent != nil && parent.CoarseGrainedGeneration() {
+				return language.GenerateResult{}
+			}
+		} else if parent := cfg.Parent(); parent != nil && parent.FlattenSubpackages() {
+			// The files of this directory belong to the target of the nearest
+			// Bazel package, see python_flatten_subpackages.
+			return language.GenerateResult{}
+		} else if parent != nil && parent.FoldSubdirs() {
+			// The files of a loose directory, without an __init__.py file,
+			// belong to the target of the nearest Python package, see
+			// python_fold_subdirs.
+			if hasInit, _ := hasLibraryEntrypointFile(args.Dir); !hasInit {
 				return language.GenerateResult{}
 			}
 		}
 	}
 
+	// The rules of the wrapper macros are handled like the ones of the kinds
+	// they wrap, see python_wrapper_macro.
+	defer py.unwrapFileMacros(cfg, args.File)()
+
 	pythonProjectRoot := cfg.PythonProjectRoot()
 
 	packageName := filepath.Base(args.Dir)
@@ -127,6 +153,12 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	pyLibraryFilenames := treeset.NewWith(godsutils.StringComparator)
 	pyTestFilenames := treeset.NewWith(godsutils.StringComparator)
 	pyFileNames := treeset.NewWith(godsutils.StringComparator)
+	// toolingFilenames are the files matching python_tooling_file_pattern,
+	// e.g. setup.py, which go to the build_tools target.
+	toolingFilenames := treeset.NewWith(godsutils.StringComparator)
+	// globbedFilenames are the Python files the glob of the library srcs may
+	// match, see python_srcs_strategy.
+	globbedFilenames := treeset.NewWith(godsutils.StringComparator)
 
 	// hasPyBinaryEntryPointFile controls whether a single py_binary target should be generated for
 	// this package or not.
@@ -139,20 +171,31 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	hasConftestFile := false
 
 	testFileGlobs := cfg.TestFilePattern()
+	toolingFileGlobs := cfg.ToolingFilePattern()
 
 	for _, f := range args.RegularFiles {
-		if cfg.IgnoresFile(filepath.Base(f)) {
+		if filepath.Ext(f) == ".py" {
+			globbedFilenames.Add(f)
+		}
+		if cfg.IgnoresFile(filepath.Base(f)) || cfg.ExcludesPath(filepath.Join(args.Rel, f)) {
 			continue
 		}
 		ext := filepath.Ext(f)
 		if ext == ".py" {
 			pyFileNames.Add(f)
+			if f == cfg.DistributionTests() {
+				// The file only runs the smoke tests of the distributions, see
+				// python_distribution_tests.
+				continue
+			}
 			if !hasPyBinaryEntryPointFile && f == pyBinaryEntrypointFilename {
 				hasPyBinaryEntryPointFile = true
 			} else if !hasPyTestEntryPointFile && f == pyTestEntrypointFilename {
 				hasPyTestEntryPointFile = true
 			} else if f == conftestFilename {
 				hasConftestFile = true
+			} else if matchesAnyGlob(f, toolingFileGlobs) {
+				toolingFilenames.Add(f)
 			} else if matchesAnyGlob(f, testFileGlobs) {
 				pyTestFilenames.Add(f)
 			} else {
@@ -161,6 +204,24 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		}
 	}
 
+	// The missing __init__.py file of the Python package is created, see
+	// python_generate_init_files. The print and diff modes don't write it.
+	if generatesInitFile(args, cfg, pyFileNames) {
+		if exists, err := ensureInitFile(args.Dir, cfg.InitFilesMode(), !py.updatesFiles); err != nil {
+			log.Printf("ERROR: %v\n", err)
+		} else if exists && !pyFileNames.Contains(pyLibraryEntrypointFilename) {
+			globbedFilenames.Add(pyLibraryEntrypointFilename)
+			pyFileNames.Add(pyLibraryEntrypointFilename)
+			pyLibraryFilenames.Add(pyLibraryEntrypointFilename)
+		}
+	}
+
+	// The python_entry_point_policy directive may prevent test and binary
+	// targets from being generated in this package.
+	allowsTestTargets := satisfiesEntryPointPolicy(cfg, pythonconfig.EntryPointPolicyTest, args.RegularFiles)
+	allowsBinaryTargets := satisfiesEntryPointPolicy(cfg, pythonconfig.EntryPointPolicyBinary, args.RegularFiles)
+	skippedBinaryTargets := false
+
 	// If a __test__.py file was not found on disk, search for targets that are
 	// named __test__.
 	if !hasPyTestEntryPointFile && args.File != nil {
@@ -172,8 +233,16 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		}
 	}
 
+	// The immediate subdirectories of a facade package get targets of their
+	// own, see python_coarse_grained_facade.
+	facadePackage, isFacade := cfg.FacadePackage()
+	isFacade = isFacade && facadePackage == args.Rel
+
 	// Add files from subdirectories if they meet the criteria.
 	for _, d := range args.Subdirs {
+		if isFacade {
+			break
+		}
 		// boundaryPackages represents child Bazel packages that are used as a
 		// boundary to stop processing under that tree.
 		boundaryPackages := make(map[string]struct{})
@@ -207,16 +276,31 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 						return nil
 					}
 
-					if !cfg.CoarseGrainedGeneration() {
+					if !cfg.CoarseGrainedGeneration() && !cfg.FlattenSubpackages() {
+						// The loose directories, without an __init__.py
+						// file, are folded into the targets, see
+						// python_fold_subdirs.
+						if hasInit, _ := hasLibraryEntrypointFile(path); cfg.FoldSubdirs() && !hasInit {
+							return nil
+						}
 						return fs.SkipDir
 					}
 
 					return nil
 				}
 				if filepath.Ext(path) == ".py" {
-					if cfg.CoarseGrainedGeneration() || !isEntrypointFile(path) {
+					if srcPath, err := filepath.Rel(args.Dir, path); err == nil {
+						globbedFilenames.Add(filepath.ToSlash(srcPath))
+					}
+					// The flattened directories are Python packages of the
+					// target, but can't have their own binaries and tests.
+					if cfg.CoarseGrainedGeneration() || !isEntrypointFile(path) ||
+						(cfg.FlattenSubpackages() && filepath.Base(path) == pyLibraryEntrypointFilename) {
 						srcPath, _ := filepath.Rel(args.Dir, path)
 						repoPath := filepath.Join(args.Rel, srcPath)
+						if cfg.ExcludesPath(repoPath) {
+							return nil
+						}
 						excludedPatterns := cfg.ExcludedPatterns()
 						if excludedPatterns != nil {
 							it := excludedPatterns.Iterator()
@@ -232,7 +316,9 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 							}
 						}
 						baseName := filepath.Base(path)
-						if matchesAnyGlob(baseName, testFileGlobs) {
+						if matchesAnyGlob(baseName, toolingFileGlobs) {
+							toolingFilenames.Add(srcPath)
+						} else if matchesAnyGlob(baseName, testFileGlobs) {
 							pyTestFilenames.Add(srcPath)
 						} else {
 							pyLibraryFilenames.Add(srcPath)
@@ -248,8 +334,12 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		}
 	}
 
-	parser := newPython3Parser(args.Config.RepoRoot, args.Rel, cfg.IgnoresDependency)
-	visibility := cfg.Visibility()
+	parser := newPython3Parser(args.Config.RepoRoot, args.Rel, cfg.IgnoresDependency, cfg.ResolveStringAnnotations(), py.cache, cfg.ShebangBinaries(), cfg.IsBinaryEntrypoint)
+	visibility := cfg.PackageVisibility(args.Rel)
+	facade, isFacadeMember := facadeOf(cfg, args.Rel)
+	if isFacadeMember {
+		visibility = facadeVisibility(facade)
+	}
 
 	var result language.GenerateResult
 	result.Gen = make([]*rule.Rule, 0)
@@ -259,6 +349,15 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	}
 
 	collisionErrors := singlylinkedlist.New()
+	if cfg.GenerateCython() {
+		cythonTargetName := cfg.TargetName(pythonconfig.GeneratedTarget{
+			Kind:        pyLibraryKind,
+			Pkg:         args.Rel,
+			PythonRoot:  pythonProjectRoot,
+			PackageName: packageName,
+		}) + cythonTargetSuffix
+		generateCythonLibrary(args, cfg, pythonProjectRoot, pyFileNames, visibility, cythonTargetName, &result, collisionErrors)
+	}
 	// Create a validFilesMap of mainModules to validate if python macros have valid srcs.
 	validFilesMap := make(map[string]struct{})
 
@@ -268,9 +367,44 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	if cfg.PerFileGeneration() {
 		var hasInit bool
 		hasInit, hasPopulatedInit = hasLibraryEntrypointFile(args.Dir)
+		// The empty __init__.py files are tracked too when they're managed
+		// by python_generate_init_files.
+		hasPopulatedInit = hasPopulatedInit || (hasInit && cfg.InitFilesMode() != pythonconfig.InitFilesModeNone)
 		autoIncludeInit = cfg.PerFileGenerationIncludeInit() && hasInit && hasPopulatedInit
 	}
 
+	// With python_generation_mode_per_file_test_utils, the conftest.py file
+	// and the other files of a package with tests go to a single testutils
+	// target, rather than to a target per file.
+	testUtilsFilenames := treeset.NewWith(godsutils.StringComparator)
+	if cfg.PerFileGeneration() && cfg.PerFileGenerationTestUtils() && !pyTestFilenames.Empty() {
+		pyLibraryFilenames.Each(func(index int, filename interface{}) {
+			if filename != pyLibraryEntrypointFilename || hasPopulatedInit {
+				testUtilsFilenames.Add(filename)
+			}
+		})
+		pyLibraryFilenames.Clear()
+		if hasConftestFile {
+			testUtilsFilenames.Add(conftestFilename)
+			hasConftestFile = false
+		}
+	}
+
+	// targetName derives the name of a target of the kind generated for the
+	// whole package, or for the given file.
+	targetName := func(kind, file string) string {
+		t := pythonconfig.GeneratedTarget{
+			Kind:        kind,
+			Pkg:         args.Rel,
+			PythonRoot:  pythonProjectRoot,
+			PackageName: packageName,
+			File:        file,
+		}
+		name := cfg.TargetName(t)
+		py.namingReport.add(t, cfg.LegacyTargetName(t), name)
+		return name
+	}
+
 	appendPyLibrary := func(srcs *treeset.Set, pyLibraryTargetName string) {
 		allDeps, mainModules, annotations, err := parser.parse(srcs)
 		for name := range mainModules {
@@ -280,7 +414,9 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			log.Fatalf("ERROR: %v\n", err)
 		}
 
-		if !hasPyBinaryEntryPointFile {
+		if !hasPyBinaryEntryPointFile && !allowsBinaryTargets && len(mainModules) > 0 {
+			skippedBinaryTargets = true
+		} else if !hasPyBinaryEntryPointFile {
 			// Creating one py_binary target per main module when __main__.py doesn't exist.
 			mainFileNames := make([]string, 0, len(mainModules))
 			for name := range mainModules {
@@ -299,7 +435,7 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 
 			sort.Strings(mainFileNames)
 			for _, filename := range mainFileNames {
-				pyBinaryTargetName := strings.TrimSuffix(filepath.Base(filename), ".py")
+				pyBinaryTargetName := targetName(pyBinaryKind, filename)
 				if err := ensureNoCollision(args.Config, args.File, pyBinaryTargetName, pyBinaryKind); err != nil {
 					fqTarget := label.New("", args.Rel, pyBinaryTargetName)
 					log.Printf("failed to generate target %q of kind %q: %v",
@@ -323,6 +459,11 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 				if autoIncludeInit {
 					pyBinaryBuilder.addSrc(pyLibraryEntrypointFilename)
 				}
+				// py_binary only infers the main file from the target name,
+				// which the naming strategies may derive differently.
+				if pyBinaryTargetName != strings.TrimSuffix(filepath.Base(filename), ".py") {
+					pyBinaryBuilder.setMain(filename)
+				}
 
 				pyBinary := pyBinaryBuilder.build()
 				result.Gen = append(result.Gen, pyBinary)
@@ -362,17 +503,25 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			collisionErrors.Add(err)
 		}
 
-		pyLibrary := newTargetBuilder(pyLibraryKind, pyLibraryTargetName, pythonProjectRoot, args.Rel, pyFileNames, cfg.ResolveSiblingImports()).
+		pyLibraryBuilder := newTargetBuilder(pyLibraryKind, pyLibraryTargetName, pythonProjectRoot, args.Rel, pyFileNames, cfg.ResolveSiblingImports()).
 			addVisibility(visibility).
 			addSrcs(srcs).
 			addPyiSrcs(pyiSrcs).
 			addModuleDependencies(allDeps).
 			addResolvedDependencies(annotations.includeDeps).
 			generateImportsAttribute().
-			setAnnotations(*annotations).
-			build()
+			setAnnotations(*annotations)
+		// The files are still parsed above, the glob only changes how the
+		// srcs are written.
+		if cfg.SrcsStrategy() == pythonconfig.SrcsStrategyGlob && !cfg.PerFileGeneration() {
+			pyLibraryBuilder.setSrcsGlob(librarySrcsGlob(cfg, srcs, globbedFilenames))
+		} else if hasSrcsGlob(args.File, pyLibraryTargetName) {
+			pyLibraryBuilder.replaceExistingSrcsGlob()
+		}
+		pyLibrary := pyLibraryBuilder.build()
+		addPyTypedData(args, cfg, pyLibrary, srcs)
 
-		if pyLibrary.IsEmpty(py.Kinds()[pyLibrary.Kind()]) {
+		if pyLibrary.IsEmpty(pyKinds[pyLibrary.Kind()]) {
 			result.Empty = append(result.Empty, pyLibrary)
 		} else {
 			result.Gen = append(result.Gen, pyLibrary)
@@ -380,29 +529,59 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		}
 	}
 
-	if cfg.PerFileGeneration() {
+	if stubs := stubFilenames(args, cfg, pyFileNames); pyFileNames.Empty() && pyLibraryFilenames.Empty() && !stubs.Empty() {
+		// The packages with type stubs only, e.g. the ones of native or
+		// vendored code, get a stub library.
+		generateStubLibrary(args, cfg, parser, pythonProjectRoot, pyFileNames, visibility, stubs,
+			targetName(pyLibraryKind, ""), &result, collisionErrors)
+	} else if cfg.PerFileGeneration() {
+		filenames := treeset.NewWith(godsutils.StringComparator)
 		pyLibraryFilenames.Each(func(index int, filename interface{}) {
-			pyLibraryTargetName := strings.TrimSuffix(filepath.Base(filename.(string)), ".py")
-			if filename == pyLibraryEntrypointFilename && !hasPopulatedInit {
-				return // ignore empty __init__.py.
+			if filename != pyLibraryEntrypointFilename || hasPopulatedInit {
+				filenames.Add(filename) // ignore empty __init__.py.
+			}
+		})
+		var groups []*treeset.Set
+		if cfg.PerFileGenerationMergeCycles() {
+			var err error
+			groups, err = groupPerFileCycles(parser, cfg, args.Rel, filenames)
+			if err != nil {
+				log.Fatalf("ERROR: %v\n", err)
+			}
+		} else {
+			for _, filename := range filenames.Values() {
+				groups = append(groups, treeset.NewWith(godsutils.StringComparator, filename))
+			}
+		}
+		moduleGroups, err := pythonconfig.LoadModuleGroups(args.Dir)
+		if err != nil {
+			log.Printf("ERROR: %v\n", err)
+		}
+		var groupedTargetNames []string
+		for _, srcs := range mergeModuleGroups(args.Rel, groups, moduleGroups) {
+			pyLibraryTargetName := targetName(pyLibraryKind, srcs.Values()[0].(string))
+			for _, filename := range srcs.Values()[1:] {
+				groupedTargetNames = append(groupedTargetNames, targetName(pyLibraryKind, filename.(string)))
 			}
-			srcs := treeset.NewWith(godsutils.StringComparator, filename)
 			if autoIncludeInit {
 				srcs.Add(pyLibraryEntrypointFilename)
 			}
 			appendPyLibrary(srcs, pyLibraryTargetName)
-		})
+		}
+		result.Empty = append(result.Empty, staleGroupedLibraries(args, groupedTargetNames)...)
 	} else {
-		appendPyLibrary(pyLibraryFilenames, cfg.RenderLibraryName(packageName))
+		appendPyLibrary(pyLibraryFilenames, targetName(pyLibraryKind, ""))
 	}
 
-	if hasPyBinaryEntryPointFile {
+	if hasPyBinaryEntryPointFile && !allowsBinaryTargets {
+		skippedBinaryTargets = true
+	} else if hasPyBinaryEntryPointFile {
 		deps, _, annotations, err := parser.parseSingle(pyBinaryEntrypointFilename)
 		if err != nil {
 			log.Fatalf("ERROR: %v\n", err)
 		}
 
-		pyBinaryTargetName := cfg.RenderBinaryName(packageName)
+		pyBinaryTargetName := targetName(pyBinaryKind, "")
 
 		// Check if a target with the same name we are generating already
 		// exists, and if it is of a different kind from the one we are
@@ -474,6 +653,82 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		result.Imports = append(result.Imports, conftest.PrivateAttr(config.GazelleImportsKey))
 	}
 
+	if !testUtilsFilenames.Empty() {
+		deps, _, annotations, err := parser.parse(testUtilsFilenames)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+
+		// Check if a target with the same name we are generating already
+		// exists, and if it is of a different kind from the one we are
+		// generating. If so, we have to throw an error since Gazelle won't
+		// generate it correctly.
+		if err := ensureNoCollision(args.Config, args.File, testUtilsTargetname, pyLibraryKind); err != nil {
+			fqTarget := label.New("", args.Rel, testUtilsTargetname)
+			err := fmt.Errorf("failed to generate target %q of kind %q: %w. ",
+				fqTarget.String(), getMappedKind(args.Config, pyLibraryKind), err)
+			collisionErrors.Add(err)
+		}
+
+		// Add any sibling .pyi files to pyi_srcs
+		pyiSrcs, _ := getPyiFilenames(testUtilsFilenames, cfg.GeneratePyiSrcs(), args.Dir)
+
+		testUtilsTarget := newTargetBuilder(pyLibraryKind, testUtilsTargetname, pythonProjectRoot, args.Rel, pyFileNames, cfg.ResolveSiblingImports()).
+			addSrcs(testUtilsFilenames).
+			addPyiSrcs(pyiSrcs).
+			addModuleDependencies(deps).
+			addResolvedDependencies(annotations.includeDeps).
+			setAnnotations(*annotations).
+			addVisibility(visibility).
+			setTestonly().
+			generateImportsAttribute()
+
+		testUtils := testUtilsTarget.build()
+
+		result.Gen = append(result.Gen, testUtils)
+		result.Imports = append(result.Imports, testUtils.PrivateAttr(config.GazelleImportsKey))
+		result.Empty = append(result.Empty, staleTestUtilsLibraries(args, testUtilsFilenames)...)
+	}
+
+	if !toolingFilenames.Empty() {
+		deps, _, annotations, err := parser.parse(toolingFilenames)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+
+		// Check if a target with the same name we are generating already
+		// exists, and if it is of a different kind from the one we are
+		// generating. If so, we have to throw an error since Gazelle won't
+		// generate it correctly.
+		if err := ensureNoCollision(args.Config, args.File, buildToolsTargetname, pyLibraryKind); err != nil {
+			fqTarget := label.New("", args.Rel, buildToolsTargetname)
+			err := fmt.Errorf("failed to generate target %q of kind %q: %w. ",
+				fqTarget.String(), getMappedKind(args.Config, pyLibraryKind), err)
+			collisionErrors.Add(err)
+		}
+
+		// The tooling files aren't indexed, see Resolver.Imports, so their
+		// target only exists to resolve their imports.
+		buildToolsTarget := newTargetBuilder(pyLibraryKind, buildToolsTargetname, pythonProjectRoot, args.Rel, pyFileNames, cfg.ResolveSiblingImports()).
+			addSrcs(toolingFilenames).
+			addModuleDependencies(deps).
+			addResolvedDependencies(annotations.includeDeps).
+			setAnnotations(*annotations).
+			addVisibility(visibility).
+			generateImportsAttribute()
+
+		buildTools := buildToolsTarget.build()
+
+		result.Gen = append(result.Gen, buildTools)
+		result.Imports = append(result.Imports, buildTools.PrivateAttr(config.GazelleImportsKey))
+	}
+
+	// The __test__ target running the tests is generated, see
+	// python_test_runner.
+	if cfg.TestRunner() == pythonconfig.TestRunnerPytest && allowsTestTargets && !hasPyTestEntryPointFile {
+		hasPyTestEntryPointTarget = generatePytestMain(args, cfg, pythonProjectRoot, pyFileNames, !pyTestFilenames.Empty(), &result)
+	}
+
 	var pyTestTargets []*targetBuilder
 	newPyTestTargetBuilder := func(srcs *treeset.Set, pyTestTargetName string) *targetBuilder {
 		deps, _, annotations, err := parser.parse(srcs)
@@ -503,7 +758,11 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			setAnnotations(*annotations).
 			generateImportsAttribute()
 	}
-	if (!cfg.PerPackageGenerationRequireTestEntryPoint() || hasPyTestEntryPointFile || hasPyTestEntryPointTarget || cfg.CoarseGrainedGeneration()) && !cfg.PerFileGeneration() {
+	if !allowsTestTargets {
+		if hasPyTestEntryPointFile || hasPyTestEntryPointTarget || !pyTestFilenames.Empty() {
+			py.skipByEntryPointPolicy(cfg, args.Rel, pythonconfig.EntryPointPolicyTest)
+		}
+	} else if (!cfg.PerPackageGenerationRequireTestEntryPoint() || hasPyTestEntryPointFile || hasPyTestEntryPointTarget || cfg.CoarseGrainedGeneration()) && !cfg.PerFileGeneration() {
 		// Create one py_test target per package
 		if hasPyTestEntryPointFile {
 			// Only add the pyTestEntrypointFilename to the pyTestFilenames if
@@ -511,7 +770,7 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 			pyTestFilenames.Add(pyTestEntrypointFilename)
 		}
 		if hasPyTestEntryPointTarget || !pyTestFilenames.Empty() {
-			pyTestTargetName := cfg.RenderTestName(packageName)
+			pyTestTargetName := targetName(pyTestKind, "")
 			pyTestTarget := newPyTestTargetBuilder(pyTestFilenames, pyTestTargetName)
 
 			if hasPyTestEntryPointTarget {
@@ -533,7 +792,7 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		// Create one py_test target per file
 		pyTestFilenames.Each(func(index int, testFile interface{}) {
 			srcs := treeset.NewWith(godsutils.StringComparator, testFile)
-			pyTestTargetName := strings.TrimSuffix(filepath.Base(testFile.(string)), ".py")
+			pyTestTargetName := targetName(pyTestKind, testFile.(string))
 			pyTestTarget := newPyTestTargetBuilder(srcs, pyTestTargetName)
 
 			if hasPyTestEntryPointTarget {
@@ -552,11 +811,21 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 	}
 
 	for _, pyTestTarget := range pyTestTargets {
+		if !testUtilsFilenames.Empty() {
+			pyTestTarget.addResolvedDependency(":" + testUtilsTargetname)
+		}
 		shouldAddConftest := pyTestTarget.annotations.includePytestConftest == nil ||
 			*pyTestTarget.annotations.includePytestConftest
 
 		if shouldAddConftest {
 			for _, conftestPkg := range findConftestPaths(args.Config.RepoRoot, args.Rel, pythonProjectRoot, cfg.IncludeAncestorConftest()) {
+				if matchesAnyGlob(conftestFilename, toolingFileGlobs) {
+					// The tooling conftest.py files aren't indexed, so the
+					// conftest targets are added by label.
+					conftestLabel := label.New("", filepath.ToSlash(conftestPkg), conftestTargetname)
+					pyTestTarget.addResolvedDependency(conftestLabel.Rel("", args.Rel).String())
+					continue
+				}
 				pyTestTarget.addModuleDependency(
 					Module{
 						Name:     importSpecFromSrc(pythonProjectRoot, conftestPkg, conftestFilename).Imp,
@@ -570,15 +839,44 @@ func (py *Python) GenerateRules(args language.GenerateArgs) language.GenerateRes
 		result.Gen = append(result.Gen, pyTest)
 		result.Imports = append(result.Imports, pyTest.PrivateAttr(config.GazelleImportsKey))
 	}
+	generateDistributionTests(args, cfg, pythonProjectRoot, pyFileNames, visibility, &result)
+	generateDoctests(args, cfg, pythonProjectRoot, pyFileNames, &result)
+	generatePyprojectTargets(args, cfg, pythonProjectRoot, pyFileNames, visibility, &result, collisionErrors)
+	generateNotebooks(args, cfg, parser, pythonProjectRoot, pyFileNames, visibility, &result, collisionErrors)
+	if isFacade {
+		py.generateFacade(args, pythonProjectRoot, pyFileNames, visibility, &result)
+	} else if isFacadeMember {
+		py.recordFacadeMembers(facade, args, &result)
+	}
+	setTestonlyTargets(args, cfg, result.Gen)
+	setPytestMarkerAttrs(args, cfg, result.Gen)
+	setDefaultAttrs(args, cfg, result.Gen)
+	setImportsAttrs(args, result.Gen)
+	if skippedBinaryTargets {
+		py.skipByEntryPointPolicy(cfg, args.Rel, pythonconfig.EntryPointPolicyBinary)
+	}
+	py.addBuildozerTargets(args, result.Gen)
+	py.addWeightedBinaries(args, cfg, result.Gen)
+	py.addOptionalImportTargets(args, cfg, result.Gen)
+	py.addUnresolvedImportTargets(args, cfg, result.Gen)
+	py.addLicensedTargets(args, cfg, result.Gen)
+	py.addDepsFilePackage(args, cfg, result.Gen)
+	py.addManualSelects(args, result.Gen)
+	py.addPackageDataTargets(args, cfg, result.Gen)
+	addExistingDepsToRemove(args, result.Gen)
+	addExistingDepComments(args, result.Gen)
+	addNoDepsOrderComments(args, result.Gen)
+	setTestShardCounts(args, cfg, result.Gen)
+	py.addPendingResolutions(args, result)
 	emptyRules := py.getRulesWithInvalidSrcs(args, validFilesMap)
 	result.Empty = append(result.Empty, emptyRules...)
 	if !collisionErrors.Empty() {
 		it := collisionErrors.Iterator()
 		for it.Next() {
-			log.Printf("ERROR: %v\n", it.Value())
+			py.runErrors.add(args.Rel, it.Value().(error).Error())
 		}
-		os.Exit(1)
 	}
+	py.wrapGeneratedMacros(cfg, &result)
 
 	return result
 }
@@ -618,6 +916,36 @@ func (py *Python) getRulesWithInvalidSrcs(args language.GenerateArgs, validFiles
 	return invalidRules
 }
 
+// staleTestUtilsLibraries returns empty rules for the existing py_library
+// targets whose sources all went to the testutils target, e.g. the former
+// conftest and per-file targets, so that they're removed.
+func staleTestUtilsLibraries(args language.GenerateArgs, testUtilsFilenames *treeset.Set) []*rule.Rule {
+	if args.File == nil {
+		return nil
+	}
+	var stale []*rule.Rule
+	for _, r := range args.File.Rules {
+		if r.Name() == testUtilsTargetname || !kindMatches(args.Config, r, pyLibraryKind) {
+			continue
+		}
+		srcs := r.AttrStrings("srcs")
+		if len(srcs) == 0 {
+			continue
+		}
+		covered := true
+		for _, src := range srcs {
+			if !testUtilsFilenames.Contains(src) {
+				covered = false
+				break
+			}
+		}
+		if covered {
+			stale = append(stale, newTargetBuilder(pyLibraryKind, r.Name(), "", "", nil, false).build())
+		}
+	}
+	return stale
+}
+
 // isBazelPackage determines if the directory is a Bazel package by probing for
 // the existence of a known BUILD file name.
 func isBazelPackage(dir string) bool {
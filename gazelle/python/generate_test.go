@@ -0,0 +1,53 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestFindConftestPaths(t *testing.T) {
+	root := t.TempDir()
+	for _, pkg := range []string{"", "src", "src/one", "src/one/two/three"} {
+		if err := os.MkdirAll(filepath.Join(root, pkg), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(filepath.Join(root, pkg, conftestFilename), nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		pkg               string
+		pythonProjectRoot string
+		includeAncestors  bool
+		want              []string
+	}{
+		{pkg: "src/one/two/three", pythonProjectRoot: "", includeAncestors: true, want: []string{"src/one/two/three", "src/one", "src", ""}},
+		// The conftest.py files above the Python project root are skipped.
+		{pkg: "src/one/two/three", pythonProjectRoot: "src", includeAncestors: true, want: []string{"src/one/two/three", "src/one", "src"}},
+		{pkg: "src/one/two", pythonProjectRoot: "src/one", includeAncestors: true, want: []string{"src/one"}},
+		{pkg: "src/one/two/three", pythonProjectRoot: "", includeAncestors: false, want: []string{"src/one/two/three"}},
+		{pkg: "src/one/two", pythonProjectRoot: "", includeAncestors: false},
+	}
+	for _, tt := range tests {
+		got := findConftestPaths(root, tt.pkg, tt.pythonProjectRoot, tt.includeAncestors)
+		assert.Equal(t, tt.want, got, "%s in the Python project %q", tt.pkg, tt.pythonProjectRoot)
+	}
+}
@@ -0,0 +1,76 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"path/filepath"
+	"slices"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// parseGeneratedModule parses the value of the python_generated_module
+// directive, e.g. "version.py //tools:gen_version", declared in the package
+// pkg. It returns the path of the generated file relative to the package and
+// the absolute label of the target generating it.
+func parseGeneratedModule(pkg, value string) (string, label.Label, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return "", label.NoLabel, fmt.Errorf("expected a Python file and a label, got %q", value)
+	}
+	src := fields[0]
+	if filepath.Ext(src) != ".py" {
+		return "", label.NoLabel, fmt.Errorf("%q is not a Python file", src)
+	}
+	l, err := label.Parse(fields[1])
+	if err != nil {
+		return "", label.NoLabel, fmt.Errorf("invalid label %q: %v", fields[1], err)
+	}
+	return src, l.Abs("", pkg), nil
+}
+
+// addGeneratedModules records the modules generated in the package rel, as
+// declared by the python_generated_module directives, whose values are given,
+// and by the outs of the targets tagged with py_generated.
+func addGeneratedModules(cfg *pythonconfig.Config, rel string, f *rule.File, values []string) error {
+	for _, value := range values {
+		src, l, err := parseGeneratedModule(rel, value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.GeneratedModule, err)
+		}
+		cfg.AddGeneratedModule(importSpecFromSrc(cfg.PythonProjectRoot(), rel, src).Imp, l)
+	}
+	for _, r := range f.Rules {
+		if !slices.Contains(r.AttrStrings("tags"), pythonconfig.GeneratedTag) {
+			continue
+		}
+		outs := r.AttrStrings("outs")
+		if out := r.AttrString("out"); out != "" {
+			outs = append(outs, out)
+		}
+		l := label.New("", rel, r.Name())
+		for _, out := range outs {
+			if filepath.Ext(out) == ".py" {
+				cfg.AddGeneratedModule(importSpecFromSrc(cfg.PythonProjectRoot(), rel, out).Imp, l)
+			}
+		}
+	}
+	return nil
+}
@@ -0,0 +1,209 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// loadIgnoreModules reads the modules to ignore from the file given to the
+// -python_add_ignore_annotations flag: either a JSON file written by
+// -python_diagnostics_file, whose unresolved imports are ignored, or a text
+// file listing one module per line. Empty lines and lines starting with "#"
+// are skipped.
+func loadIgnoreModules(path string) (map[string]bool, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the modules to ignore: %w", err)
+	}
+	modules := make(map[string]bool)
+	if filepath.Ext(path) == ".json" {
+		var f diagnosticsFile
+		if err := json.Unmarshal(data, &f); err != nil {
+			return nil, fmt.Errorf("failed to decode the modules to ignore from %q: %w", path, err)
+		}
+		for _, imp := range f.UnresolvedImports {
+			modules[imp.Import] = true
+		}
+		return modules, nil
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		line = strings.TrimSpace(line)
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+		modules[line] = true
+	}
+	return modules, nil
+}
+
+// annotateIgnore returns whether the import mod is one of the modules to
+// ignore given to -python_add_ignore_annotations, or one of their submodules,
+// in which case it's recorded to be annotated.
+func (py *Resolver) annotateIgnore(repoRoot string, mod Module) bool {
+	if len(py.ignoreModules) == 0 {
+		return false
+	}
+	ignored := false
+	for module := range py.ignoreModules {
+		if mod.Name == module || strings.HasPrefix(mod.Name, module+".") {
+			ignored = true
+			break
+		}
+	}
+	if !ignored {
+		return false
+	}
+	path := filepath.Join(repoRoot, mod.Filepath)
+	py.mu.Lock()
+	defer py.mu.Unlock()
+	if py.ignoreAnnotations == nil {
+		py.ignoreAnnotations = make(map[string]map[int][]string)
+	}
+	if py.ignoreAnnotations[path] == nil {
+		py.ignoreAnnotations[path] = make(map[int][]string)
+	}
+	line := int(mod.LineNumber)
+	py.ignoreAnnotations[path][line] = append(py.ignoreAnnotations[path][line], mod.Name)
+	return true
+}
+
+// applyIgnoreAnnotations inserts the recorded "# gazelle:ignore" annotations
+// into the Python files.
+func (py *Python) applyIgnoreAnnotations() {
+	if len(py.ignoreAnnotations) == 0 {
+		return
+	}
+	paths := make([]string, 0, len(py.ignoreAnnotations))
+	for path := range py.ignoreAnnotations {
+		paths = append(paths, path)
+	}
+	sort.Strings(paths)
+	count := 0
+	for _, path := range paths {
+		n, err := insertIgnoreAnnotations(path, py.ignoreAnnotations[path])
+		if err != nil {
+			log.Fatal(err)
+		}
+		count += n
+	}
+	log.Printf("Added %d gazelle:ignore annotation(s) to %d file(s)", count, len(paths))
+}
+
+// insertIgnoreAnnotations inserts a "# gazelle:ignore" annotation above the
+// statements containing the given 1-based lines, for the modules imported
+// there. The annotations are only read outside of the import statements, so
+// they go above the first line of multi-line statements. It returns the number
+// of annotations inserted.
+func insertIgnoreAnnotations(path string, modulesByLine map[int][]string) (int, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add the gazelle:ignore annotations: %w", err)
+	}
+	lines := strings.SplitAfter(string(data), "\n")
+
+	// Group the modules by the line where their annotation is inserted.
+	starts := statementStarts(lines)
+	annotations := make(map[int][]string)
+	for line, modules := range modulesByLine {
+		if line < 1 || line > len(lines) {
+			return 0, fmt.Errorf("failed to add the gazelle:ignore annotations: %q has no line %d", path, line)
+		}
+		i := starts[line-1]
+		annotations[i] = append(annotations[i], modules...)
+	}
+
+	var b strings.Builder
+	for i, line := range lines {
+		if modules, ok := annotations[i]; ok {
+			sort.Strings(modules)
+			unique := modules[:0]
+			for j, module := range modules {
+				if j == 0 || module != modules[j-1] {
+					unique = append(unique, module)
+				}
+			}
+			indentation := line[:len(line)-len(strings.TrimLeft(line, " \t"))]
+			fmt.Fprintf(&b, "%s# %s%s %s\n", indentation, annotationPrefix, annotationKindIgnore, strings.Join(unique, ","))
+		}
+		b.WriteString(line)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return 0, fmt.Errorf("failed to add the gazelle:ignore annotations: %w", err)
+	}
+	if err := os.WriteFile(path, []byte(b.String()), info.Mode()); err != nil {
+		return 0, fmt.Errorf("failed to add the gazelle:ignore annotations: %w", err)
+	}
+	return len(annotations), nil
+}
+
+// statementStarts returns, for each line of Python code, the index of the
+// first line of the statement containing it, following the lines joined with
+// a backslash, or by open brackets and triple-quoted strings.
+func statementStarts(lines []string) []int {
+	starts := make([]int, len(lines))
+	start := 0
+	depth := 0
+	quote := ""
+	continued := false
+	for i, line := range lines {
+		if depth == 0 && quote == "" && !continued {
+			start = i
+		}
+		starts[i] = start
+		for j := 0; j < len(line); j++ {
+			rest := line[j:]
+			if quote != "" {
+				if rest[0] == '\\' {
+					j++
+				} else if strings.HasPrefix(rest, quote) {
+					j += len(quote) - 1
+					quote = ""
+				}
+				continue
+			}
+			switch rest[0] {
+			case '#':
+				j = len(line)
+			case '"', '\'':
+				quote = rest[:1]
+				if strings.HasPrefix(rest, strings.Repeat(quote, 3)) {
+					quote = strings.Repeat(quote, 3)
+				}
+				j += len(quote) - 1
+			case '(', '[', '{':
+				depth++
+			case ')', ']', '}':
+				if depth > 0 {
+					depth--
+				}
+			}
+		}
+		if len(quote) == 1 {
+			// Single-quoted strings end with the line.
+			quote = ""
+		}
+		continued = quote == "" && strings.HasSuffix(strings.TrimRight(line, "\r\n"), "\\")
+	}
+	return starts
+}
@@ -0,0 +1,111 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestLoadIgnoreModules(t *testing.T) {
+	dir := t.TempDir()
+
+	text := filepath.Join(dir, "modules.txt")
+	if err := os.WriteFile(text, []byte("# Legacy modules.\nfoo\n\n  bar.baz  \n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modules, err := loadIgnoreModules(text)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]bool{"foo": true, "bar.baz": true}, modules)
+
+	diagnostics := filepath.Join(dir, "diagnostics.json")
+	if err := os.WriteFile(diagnostics, []byte(`{"unresolved_imports": [
+		{"target": "//app:app", "file": "app/main.py", "line": 3, "import": "foo"},
+		{"target": "//lib:lib", "file": "lib/lib.py", "line": 1, "import": "qux.quux"}
+	]}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	modules, err = loadIgnoreModules(diagnostics)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, map[string]bool{"foo": true, "qux.quux": true}, modules)
+
+	_, err = loadIgnoreModules(filepath.Join(dir, "missing.txt"))
+	assert.Error(t, err)
+}
+
+func TestInsertIgnoreAnnotations(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "main.py")
+	if err := os.WriteFile(path, []byte(`"""Docstring mentioning (
+import foo
+"""
+import foo, bar
+from baz import (
+    qux,
+    quux,
+)
+from corge import \
+    grault
+
+def main():
+    import garply
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	n, err := insertIgnoreAnnotations(path, map[int][]string{
+		4:  {"foo", "bar"},
+		6:  {"baz.qux"},
+		7:  {"baz.quux"},
+		10: {"corge.grault"},
+		13: {"garply"},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, 4, n)
+
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, `"""Docstring mentioning (
+import foo
+"""
+# gazelle:ignore bar,foo
+import foo, bar
+# gazelle:ignore baz.quux,baz.qux
+from baz import (
+    qux,
+    quux,
+)
+# gazelle:ignore corge.grault
+from corge import \
+    grault
+
+def main():
+    # gazelle:ignore garply
+    import garply
+`, string(data))
+
+	_, err = insertIgnoreAnnotations(path, map[int][]string{100: {"foo"}})
+	assert.Error(t, err)
+}
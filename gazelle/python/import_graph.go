@@ -0,0 +1,127 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+)
+
+// importGraphDOTExtension is the extension of the -python_import_graph files
+// written as DOT graphs rather than as JSON.
+const importGraphDOTExtension = ".dot"
+
+// importGraphEdge is an import of the consumer target resolved to the
+// provider target, in the file written by -python_import_graph.
+type importGraphEdge struct {
+	// Module is the resolved module, which can be a parent of the imported
+	// one.
+	Module   string `json:"module"`
+	Provider string `json:"provider"`
+	Consumer string `json:"consumer"`
+	File     string `json:"file"`
+	Line     uint32 `json:"line"`
+	// Import is the imported module, as written in the file.
+	Import   string             `json:"import"`
+	Strategy resolutionStrategy `json:"strategy"`
+}
+
+// importGraphFile is the format of the JSON files written by
+// -python_import_graph.
+type importGraphFile struct {
+	Edges []importGraphEdge `json:"edges"`
+}
+
+// importGraphEdges returns the edges of the import graph from the sorted
+// resolution decisions: the imports resolved to a dependency, first-party or
+// third-party.
+func importGraphEdges(resolutions []resolutionDecision) []importGraphEdge {
+	edges := []importGraphEdge{}
+	for _, d := range resolutions {
+		if d.Label == "" {
+			continue
+		}
+		edges = append(edges, importGraphEdge{
+			Module:   d.Module,
+			Provider: d.Label,
+			Consumer: d.Target,
+			File:     d.File,
+			Line:     d.Line,
+			Import:   d.Import,
+			Strategy: d.Strategy,
+		})
+	}
+	return edges
+}
+
+// formatImportGraphDOT formats the edges as a DOT graph, with an edge from
+// each consumer to each of its providers, labeled with the resolved modules.
+func formatImportGraphDOT(edges []importGraphEdge) []byte {
+	modules := make(map[[2]string]map[string]bool)
+	for _, e := range edges {
+		key := [2]string{e.Consumer, e.Provider}
+		if modules[key] == nil {
+			modules[key] = make(map[string]bool)
+		}
+		modules[key][e.Module] = true
+	}
+	keys := make([][2]string, 0, len(modules))
+	for key := range modules {
+		keys = append(keys, key)
+	}
+	sort.Slice(keys, func(i, j int) bool {
+		if keys[i][0] != keys[j][0] {
+			return keys[i][0] < keys[j][0]
+		}
+		return keys[i][1] < keys[j][1]
+	})
+	var b bytes.Buffer
+	b.WriteString("digraph imports {\n")
+	for _, key := range keys {
+		names := make([]string, 0, len(modules[key]))
+		for module := range modules[key] {
+			names = append(names, module)
+		}
+		sort.Strings(names)
+		fmt.Fprintf(&b, "  %q -> %q [label=%q];\n", key[0], key[1], strings.Join(names, "\n"))
+	}
+	b.WriteString("}\n")
+	return b.Bytes()
+}
+
+// writeImportGraph writes the import graph to the given path, as a DOT graph
+// if it has the .dot extension, as JSON otherwise.
+func writeImportGraph(path string, resolutions []resolutionDecision) error {
+	edges := importGraphEdges(resolutions)
+	var data []byte
+	if filepath.Ext(path) == importGraphDOTExtension {
+		data = formatImportGraphDOT(edges)
+	} else {
+		encoded, err := json.MarshalIndent(importGraphFile{Edges: edges}, "", "  ")
+		if err != nil {
+			return fmt.Errorf("failed to encode the import graph: %w", err)
+		}
+		data = append(encoded, '\n')
+	}
+	if err := os.WriteFile(path, data, 0o644); err != nil {
+		return fmt.Errorf("failed to write the import graph: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteImportGraph(t *testing.T) {
+	resolutions := []resolutionDecision{
+		{Target: "//app", File: "app/main.py", Line: 1, Import: "lib.a", Module: "lib.a", Strategy: resolutionStrategyIndex, Label: "//lib"},
+		{Target: "//app", File: "app/main.py", Line: 2, Import: "lib.b.c", Module: "lib.b", Strategy: resolutionStrategyIndex, Label: "//lib"},
+		{Target: "//app", File: "app/main.py", Line: 3, Import: "os", Module: "os", Strategy: resolutionStrategyStdlib},
+		{Target: "//app", File: "app/main.py", Line: 4, Import: "yaml", Module: "yaml", Strategy: resolutionStrategyThirdParty, Label: "@pip//pyyaml"},
+		{Target: "//lib", File: "lib/b.py", Line: 1, Import: "missing", Module: "missing", Strategy: resolutionStrategyUnresolved},
+	}
+	dir := t.TempDir()
+
+	path := filepath.Join(dir, "graph.json")
+	assert.NoError(t, writeImportGraph(path, resolutions))
+	data, err := os.ReadFile(path)
+	assert.NoError(t, err)
+	var f importGraphFile
+	assert.NoError(t, json.Unmarshal(data, &f))
+	assert.Equal(t, []importGraphEdge{
+		{Module: "lib.a", Provider: "//lib", Consumer: "//app", File: "app/main.py", Line: 1, Import: "lib.a", Strategy: resolutionStrategyIndex},
+		{Module: "lib.b", Provider: "//lib", Consumer: "//app", File: "app/main.py", Line: 2, Import: "lib.b.c", Strategy: resolutionStrategyIndex},
+		{Module: "yaml", Provider: "@pip//pyyaml", Consumer: "//app", File: "app/main.py", Line: 4, Import: "yaml", Strategy: resolutionStrategyThirdParty},
+	}, f.Edges)
+
+	path = filepath.Join(dir, "graph.dot")
+	assert.NoError(t, writeImportGraph(path, resolutions))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.Equal(t, `digraph imports {
+  "//app" -> "//lib" [label="lib.a\nlib.b"];
+  "//app" -> "@pip//pyyaml" [label="yaml"];
+}
+`, string(data))
+
+	path = filepath.Join(dir, "empty.json")
+	assert.NoError(t, writeImportGraph(path, nil))
+	data, err = os.ReadFile(path)
+	assert.NoError(t, err)
+	assert.JSONEq(t, `{"edges": []}`, string(data))
+}
@@ -0,0 +1,159 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"log"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// importWeightTagPrefix is the prefix of the tag carrying the weight of the
+// distributions imported by a binary.
+const importWeightTagPrefix = "import_weight="
+
+// weightedBinary is a binary to tag with the weight of the distributions it
+// imports, once all the dependencies are resolved.
+type weightedBinary struct {
+	label string
+	// rule is the rule written to the BUILD file: the existing rule when
+	// there is one, so that its tags are updated, or the generated one.
+	rule          *rule.Rule
+	importWeights *pythonconfig.ImportWeights
+	budget        int
+}
+
+// distributionWeight is the weight of a distribution imported by a binary.
+type distributionWeight struct {
+	distribution string
+	weight       int
+}
+
+// addWeightedBinaries records the binaries generated in the package when a
+// python_import_weights_file directive applies to it.
+func (py *Python) addWeightedBinaries(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	importWeights := cfg.ImportWeights()
+	if importWeights == nil {
+		return
+	}
+	for _, r := range gen {
+		if r.Kind() != pyBinaryKind {
+			continue
+		}
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		py.weightedBinaries = append(py.weightedBinaries, weightedBinary{
+			label:         label.New(args.Config.RepoName, args.Rel, r.Name()).String(),
+			rule:          target,
+			importWeights: importWeights,
+			budget:        cfg.ImportWeightBudget(),
+		})
+	}
+}
+
+// addDistribution records that the target from imports the given third-party
+// distribution at runtime.
+func (py *Resolver) addDistribution(from label.Label, distribution string) {
+	if py.distributions == nil {
+		py.distributions = make(map[string]map[string]bool)
+	}
+	if py.distributions[from.String()] == nil {
+		py.distributions[from.String()] = make(map[string]bool)
+	}
+	py.distributions[from.String()][distribution] = true
+}
+
+// transitiveDistributions returns the distributions imported by the target
+// and the first-party targets it transitively depends on, sorted.
+func (py *Resolver) transitiveDistributions(target string) []string {
+	seen := map[string]bool{target: true}
+	queue := []string{target}
+	distributions := make(map[string]bool)
+	for len(queue) > 0 {
+		v := queue[0]
+		queue = queue[1:]
+		for distribution := range py.distributions[v] {
+			distributions[distribution] = true
+		}
+		for _, w := range py.importGraph.successors(v) {
+			if !seen[w] {
+				seen[w] = true
+				queue = append(queue, w)
+			}
+		}
+	}
+	sorted := make([]string, 0, len(distributions))
+	for distribution := range distributions {
+		sorted = append(sorted, distribution)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// weigh returns the total weight of the distributions imported by the binary,
+// and the weight of each distribution, heaviest first.
+func (py *Resolver) weigh(binary weightedBinary) (int, []distributionWeight) {
+	var total int
+	var weights []distributionWeight
+	for _, distribution := range py.transitiveDistributions(binary.label) {
+		weight := binary.importWeights.Weight(distribution)
+		if weight == 0 {
+			continue
+		}
+		total += weight
+		weights = append(weights, distributionWeight{distribution: distribution, weight: weight})
+	}
+	sort.SliceStable(weights, func(i, j int) bool {
+		return weights[i].weight > weights[j].weight
+	})
+	return total, weights
+}
+
+// applyImportWeights tags the binaries with the weight of the distributions
+// they import, and warns about the ones over their budget.
+func (py *Python) applyImportWeights() {
+	for _, binary := range py.weightedBinaries {
+		total, weights := py.weigh(binary)
+		setImportWeightTag(binary.rule, total)
+		if binary.budget > 0 && total > binary.budget {
+			heaviest := make([]string, 0, len(weights))
+			for _, w := range weights {
+				heaviest = append(heaviest, fmt.Sprintf("%s (%d)", w.distribution, w.weight))
+			}
+			log.Printf("WARNING: %s imports distributions weighing %d, over the budget of %d: %s",
+				binary.label, total, binary.budget, strings.Join(heaviest, ", "))
+		}
+	}
+}
+
+// setImportWeightTag replaces the weight tag of the rule, keeping its other
+// tags. A zero weight removes the tag.
+func setImportWeightTag(r *rule.Rule, weight int) {
+	var values []string
+	if weight > 0 {
+		values = []string{strconv.Itoa(weight)}
+	}
+	setPrefixedTags(r, importWeightTagPrefix, values)
+}
@@ -0,0 +1,65 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path/filepath"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// importsAttr returns the imports attribute of the targets of the package
+// bzlPackage, i.e. the path from the package to the python root, making the
+// modules importable relative to the root. It's nil when the package is the
+// root, or when no python_root applies, since the repository root is on the
+// Python path by default.
+func importsAttr(pythonProjectRoot, bzlPackage string) []string {
+	if pythonProjectRoot == "" {
+		return nil
+	}
+	p, err := filepath.Rel(bzlPackage, pythonProjectRoot)
+	if err != nil || p == "." {
+		return nil
+	}
+	// The imports are Bazel paths, with forward slashes on every platform.
+	return []string{filepath.ToSlash(p)}
+}
+
+// setImportsAttrs regenerates the imports attribute of the existing rules
+// the py_binary, py_library and py_test targets generated in the package are
+// merged into, which isn't mergeable for all the kinds: the entries marked
+// with a "# keep" comment are kept, and the other ones are replaced by the
+// generated imports, e.g. when the python_root moved. The imports of the rules
+// without generated imports are left untouched, as are the rules and the
+// imports marked with a "# keep" comment.
+func setImportsAttrs(args language.GenerateArgs, gen []*rule.Rule) {
+	for _, r := range gen {
+		switch r.Kind() {
+		case pyBinaryKind, pyLibraryKind, pyTestKind:
+		default:
+			continue
+		}
+		imports := r.Attr("imports")
+		if imports == nil {
+			continue
+		}
+		target := ruleInFile(args, r)
+		if target == r || target.ShouldKeep() || attrShouldKeep(target, "imports") {
+			continue
+		}
+		target.SetAttr("imports", rule.MergeList(imports, target.Attr("imports")))
+	}
+}
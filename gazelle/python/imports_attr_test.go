@@ -0,0 +1,38 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestImportsAttr(t *testing.T) {
+	for name, tc := range map[string]struct {
+		root, pkg string
+		want      []string
+	}{
+		"no root":      {"", "app/lib", nil},
+		"root package": {"src", "src", nil},
+		"child":        {"src", "src/app", []string{".."}},
+		"grandchild":   {"src", "src/app/lib", []string{"../.."}},
+		"nested root":  {"a/b", "a/b/c", []string{".."}},
+	} {
+		t.Run(name, func(t *testing.T) {
+			assert.Equal(t, tc.want, importsAttr(tc.root, tc.pkg))
+		})
+	}
+}
@@ -0,0 +1,129 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// missingInitFiles returns the __init__.py files missing from the packages
+// containing the module, relative to the repository root. E.g. for the module
+// foo.bar.baz, foo/__init__.py and foo/bar/__init__.py are checked, as well as
+// foo/bar/baz/__init__.py when foo/bar/baz is a directory rather than a file.
+func (py *Resolver) missingInitFiles(repoRoot, pythonProjectRoot, moduleName string) []string {
+	parts := strings.Split(moduleName, ".")
+	packages := make([]string, 0, len(parts))
+	for i := 1; i < len(parts); i++ {
+		packages = append(packages, path.Join(pythonProjectRoot, strings.Join(parts[:i], "/")))
+	}
+	module := path.Join(pythonProjectRoot, strings.Join(parts, "/"))
+	if info := py.stat(repoRoot, module); info != nil && info.IsDir() {
+		packages = append(packages, module)
+	}
+	var missing []string
+	for _, pkg := range packages {
+		initFile := path.Join(pkg, pyLibraryEntrypointFilename)
+		if py.stat(repoRoot, initFile) == nil {
+			missing = append(missing, initFile)
+		}
+	}
+	return missing
+}
+
+// stat returns the information about the file at the path relative to the
+// repository root, or nil if it doesn't exist. The results are cached since
+// the same packages are checked for many imports.
+func (py *Resolver) stat(repoRoot, rel string) os.FileInfo {
+	py.mu.Lock()
+	defer py.mu.Unlock()
+	if info, ok := py.statCache[rel]; ok {
+		return info
+	}
+	if py.statCache == nil {
+		py.statCache = make(map[string]os.FileInfo)
+	}
+	info, err := os.Stat(filepath.Join(repoRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		info = nil
+	}
+	py.statCache[rel] = info
+	return info
+}
+
+// namespaceInitContent is the content of the __init__.py files created in the
+// namespace mode of python_generate_init_files, extending the __path__ of the
+// package with the directories of the same package elsewhere. It tells these
+// files apart from the ones written by hand, unlike the empty content, which
+// is as likely to be written by hand.
+const namespaceInitContent = "__path__ = __import__(\"pkgutil\").extend_path(__path__, __name__)\n"
+
+// initFileContent returns the content of the __init__.py files created in the
+// mode.
+func initFileContent(mode pythonconfig.InitFilesModeType) []byte {
+	if mode == pythonconfig.InitFilesModeNamespace {
+		return []byte(namespaceInitContent)
+	}
+	return nil
+}
+
+// generatesInitFile returns whether the __init__.py file of the package is
+// managed by python_generate_init_files: the package has Python files and is
+// below the Python project root, which isn't a Python package itself.
+func generatesInitFile(args language.GenerateArgs, cfg *pythonconfig.Config, pyFileNames *treeset.Set) bool {
+	if cfg.InitFilesMode() == pythonconfig.InitFilesModeNone || pyFileNames.Empty() {
+		return false
+	}
+	root := cfg.PythonProjectRoot()
+	if args.Rel == root || (root != "" && !strings.HasPrefix(args.Rel, root+"/")) {
+		return false
+	}
+	return !cfg.IgnoresFile(pyLibraryEntrypointFilename) &&
+		!cfg.ExcludesPath(filepath.Join(args.Rel, pyLibraryEntrypointFilename))
+}
+
+// ensureInitFile creates the missing __init__.py file of the package
+// directory dir with the content of the mode, and returns whether the file
+// exists. An existing file is only rewritten when it was created in the
+// namespace mode, as told by its content, so that the files written by hand,
+// including the empty ones, are never touched. Nothing is written in a dry
+// run, e.g. in the print and diff modes of Gazelle.
+func ensureInitFile(dir string, mode pythonconfig.InitFilesModeType, dryRun bool) (bool, error) {
+	path := filepath.Join(dir, pyLibraryEntrypointFilename)
+	content := initFileContent(mode)
+	existing, err := os.ReadFile(path)
+	if err == nil {
+		if dryRun || bytes.Equal(existing, content) || !bytes.Equal(existing, []byte(namespaceInitContent)) {
+			return true, nil
+		}
+	} else if !os.IsNotExist(err) {
+		return false, fmt.Errorf("failed to read %q: %w", path, err)
+	} else if dryRun {
+		return false, nil
+	}
+	if err := os.WriteFile(path, content, 0o644); err != nil {
+		return false, fmt.Errorf("failed to write %q: %w", path, err)
+	}
+	return true, nil
+}
@@ -0,0 +1,120 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestMissingInitFiles(t *testing.T) {
+	root := t.TempDir()
+	for _, name := range []string{
+		"src/foo/__init__.py",
+		"src/foo/bar/baz.py",
+		"src/foo/qux/impl.py",
+	} {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	var r Resolver
+	assert.Empty(t, r.missingInitFiles(root, "src", "foo"))
+	assert.Equal(t, []string{"src/foo/bar/__init__.py"}, r.missingInitFiles(root, "src", "foo.bar.baz"))
+	// The module is a directory.
+	assert.Equal(t, []string{"src/foo/qux/__init__.py"}, r.missingInitFiles(root, "src", "foo.qux"))
+
+	var rootResolver Resolver
+	assert.Equal(t, []string{"foo/bar/__init__.py"}, rootResolver.missingInitFiles(filepath.Join(root, "src"), "", "foo.bar"))
+}
+
+func TestEnsureInitFile(t *testing.T) {
+	read := func(dir string) string {
+		content, err := os.ReadFile(filepath.Join(dir, pyLibraryEntrypointFilename))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(content)
+	}
+
+	dir := t.TempDir()
+	exists, err := ensureInitFile(dir, pythonconfig.InitFilesModeNamespace, false)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, namespaceInitContent, read(dir))
+	// The file generated in the namespace mode is rewritten.
+	_, err = ensureInitFile(dir, pythonconfig.InitFilesModeEmpty, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", read(dir))
+	// An empty file may be written by hand, so it's never upgraded.
+	_, err = ensureInitFile(dir, pythonconfig.InitFilesModeNamespace, false)
+	assert.NoError(t, err)
+	assert.Equal(t, "", read(dir))
+
+	// The files written by hand are left untouched.
+	handWritten := "from .core import run\n"
+	if err := os.WriteFile(filepath.Join(dir, pyLibraryEntrypointFilename), []byte(handWritten), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	_, err = ensureInitFile(dir, pythonconfig.InitFilesModeEmpty, false)
+	assert.NoError(t, err)
+	assert.Equal(t, handWritten, read(dir))
+
+	// Nothing is written in a dry run, which only tells whether the file
+	// exists.
+	exists, err = ensureInitFile(dir, pythonconfig.InitFilesModeNamespace, true)
+	assert.NoError(t, err)
+	assert.True(t, exists)
+	assert.Equal(t, handWritten, read(dir))
+	dryRunDir := t.TempDir()
+	exists, err = ensureInitFile(dryRunDir, pythonconfig.InitFilesModeEmpty, true)
+	assert.NoError(t, err)
+	assert.False(t, exists)
+	_, err = os.Stat(filepath.Join(dryRunDir, pyLibraryEntrypointFilename))
+	assert.True(t, os.IsNotExist(err))
+}
+
+func TestGeneratesInitFile(t *testing.T) {
+	cfg := pythonconfig.New("/repo", "src")
+	cfg.SetInitFilesMode(pythonconfig.InitFilesModeEmpty)
+	pyFiles := treeset.NewWith(godsutils.StringComparator, "lib.py")
+	tests := map[string]bool{
+		"src/app":     true,
+		"src/app/sub": true,
+		"src":         false,
+		"tools":       false,
+		"srcs/app":    false,
+	}
+	for rel, want := range tests {
+		assert.Equal(t, want, generatesInitFile(language.GenerateArgs{Rel: rel}, cfg, pyFiles), rel)
+	}
+	assert.False(t, generatesInitFile(language.GenerateArgs{Rel: "src/app"}, cfg, treeset.NewWith(godsutils.StringComparator)))
+
+	cfg.SetInitFilesMode(pythonconfig.InitFilesModeNone)
+	assert.False(t, generatesInitFile(language.GenerateArgs{Rel: "src/app"}, cfg, pyFiles))
+}
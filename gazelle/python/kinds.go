@@ -21,16 +21,32 @@ import (
 )
 
 const (
-	pyBinaryKind       = "py_binary"
-	pyLibraryKind      = "py_library"
-	pyProtoLibraryKind = "py_proto_library"
-	pyTestKind         = "py_test"
+	pyBinaryKind              = "py_binary"
+	pyLibraryKind             = "py_library"
+	pyProtoLibraryKind        = "py_proto_library"
+	pyGrpcLibraryKind         = "py_grpc_library"
+	pyTestKind                = "py_test"
+	pyConsoleScriptBinaryKind = "py_console_script_binary"
+	pyPackageKind             = "py_package"
+	pyWheelKind               = "py_wheel"
 )
 
 // Kinds returns a map that maps rule names (kinds) and information on how to
 // match and merge attributes that may be found in rules of those kinds.
-func (*Python) Kinds() map[string]rule.KindInfo {
-	return pyKinds
+func (py *Python) Kinds() map[string]rule.KindInfo {
+	if len(py.wrapperMacros) == 0 {
+		return pyKinds
+	}
+	// The wrapper macros are kinds of the extension, see
+	// python_wrapper_macro.
+	kinds := make(map[string]rule.KindInfo, len(pyKinds)+len(py.wrapperMacros))
+	for kind, info := range pyKinds {
+		kinds[kind] = info
+	}
+	for _, macro := range py.wrapperMacros {
+		kinds[macro.Macro] = wrapperMacroKindInfo(macro)
+	}
+	return kinds
 }
 
 var pyKinds = map[string]rule.KindInfo{
@@ -49,9 +65,10 @@ var pyKinds = map[string]rule.KindInfo{
 			"imports": true,
 		},
 		ResolveAttrs: map[string]bool{
-			"deps":     true,
-			"pyi_deps": true,
-			"pyi_srcs": true,
+			"deps":           true,
+			"deps_to_remove": true,
+			"pyi_deps":       true,
+			"pyi_srcs":       true,
 		},
 	},
 	pyLibraryKind: {
@@ -61,15 +78,18 @@ var pyKinds = map[string]rule.KindInfo{
 			"deps":    true,
 			"srcs":    true,
 			"imports": true,
+			// The stub libraries have type stubs only.
+			"pyi_srcs": true,
 		},
 		SubstituteAttrs: map[string]bool{},
 		MergeableAttrs: map[string]bool{
 			"srcs": true,
 		},
 		ResolveAttrs: map[string]bool{
-			"deps":     true,
-			"pyi_deps": true,
-			"pyi_srcs": true,
+			"deps":           true,
+			"deps_to_remove": true,
+			"pyi_deps":       true,
+			"pyi_srcs":       true,
 		},
 	},
 	pyProtoLibraryKind: {
@@ -78,6 +98,102 @@ var pyKinds = map[string]rule.KindInfo{
 		},
 		ResolveAttrs: map[string]bool{"deps": true},
 	},
+	// py_grpc_library targets aren't generated, but they're indexed so that
+	// the *_pb2_grpc modules resolve to them.
+	pyGrpcLibraryKind: {},
+	// py_console_script_binary targets are generated for the scripts of
+	// pyproject.toml. The hand-written ones of the PyPI packages set pkg and
+	// are kept.
+	pyConsoleScriptBinaryKind: {
+		NonEmptyAttrs: map[string]bool{
+			"deps":        true,
+			"entry_point": true,
+			"pkg":         true,
+		},
+		MergeableAttrs: map[string]bool{
+			"entry_point": true,
+		},
+		ResolveAttrs: map[string]bool{
+			"deps": true,
+		},
+	},
+	// py_package and py_wheel targets are generated from the [project]
+	// metadata of pyproject.toml with python_generate_wheel.
+	pyPackageKind: {
+		NonEmptyAttrs: map[string]bool{
+			"deps": true,
+		},
+		MergeableAttrs: map[string]bool{
+			"packages": true,
+		},
+		ResolveAttrs: map[string]bool{
+			"deps": true,
+		},
+	},
+	pyWheelKind: {
+		NonEmptyAttrs: map[string]bool{
+			"deps":         true,
+			"distribution": true,
+		},
+		MergeableAttrs: map[string]bool{
+			"deps":                true,
+			"distribution":        true,
+			"entry_points":        true,
+			"extra_requires":      true,
+			"python_requires":     true,
+			"requires":            true,
+			"strip_path_prefixes": true,
+			"summary":             true,
+			"version":             true,
+		},
+	},
+	// genrule targets are generated to convert the Jupyter notebooks with
+	// python_notebook_converter. The other genrules are left untouched: the
+	// generated ones are named after their notebook, and only the ones
+	// converting a notebook are emptied, see isNotebookGenrule.
+	genruleKind: {
+		NonEmptyAttrs: map[string]bool{
+			"outs": true,
+			"srcs": true,
+		},
+		MergeableAttrs: map[string]bool{
+			"cmd":   true,
+			"outs":  true,
+			"srcs":  true,
+			"tools": true,
+		},
+	},
+	// pyx_library targets are generated for the Cython sources with
+	// python_generate_cython.
+	pyxLibraryKind: {
+		MatchAttrs: []string{"srcs"},
+		NonEmptyAttrs: map[string]bool{
+			"deps": true,
+			"srcs": true,
+		},
+		MergeableAttrs: map[string]bool{
+			"srcs": true,
+		},
+		ResolveAttrs: map[string]bool{
+			"deps": true,
+		},
+	},
+	// py_pytest_main targets are generated as the main of the py_test
+	// targets with python_test_runner. Their deps are mergeable so that the
+	// target of a package without tests anymore is deleted.
+	pyPytestMainKind: {
+		NonEmptyAttrs: map[string]bool{
+			"args": true,
+			"deps": true,
+		},
+		MergeableAttrs: map[string]bool{
+			"args": true,
+			"deps": true,
+		},
+		ResolveAttrs: map[string]bool{
+			"deps": true,
+		},
+	},
 	pyTestKind: {
 		MatchAny: false,
 		NonEmptyAttrs: map[string]bool{
@@ -91,9 +207,10 @@ var pyKinds = map[string]rule.KindInfo{
 			"srcs": true,
 		},
 		ResolveAttrs: map[string]bool{
-			"deps":     true,
-			"pyi_deps": true,
-			"pyi_srcs": true,
+			"deps":           true,
+			"deps_to_remove": true,
+			"pyi_deps":       true,
+			"pyi_srcs":       true,
 		},
 	},
 }
@@ -106,7 +223,7 @@ func (py *Python) Loads() []rule.LoadInfo {
 // GenerateRules, now or in the past, should be loadable from one of these
 // files.
 func (py *Python) ApparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
-	return apparentLoads(moduleToApparentName)
+	return append(apparentLoads(moduleToApparentName), wrapperMacroLoads(py.wrapperMacros)...)
 }
 
 func apparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
@@ -114,6 +231,14 @@ func apparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
 	if protobuf == "" {
 		protobuf = "com_google_protobuf"
 	}
+	cython := moduleToApparentName("cython")
+	if cython == "" {
+		cython = "cython"
+	}
+	aspectRulesPy := moduleToApparentName("aspect_rules_py")
+	if aspectRulesPy == "" {
+		aspectRulesPy = "aspect_rules_py"
+	}
 
 	return []rule.LoadInfo{
 		{
@@ -124,11 +249,37 @@ func apparentLoads(moduleToApparentName func(string) string) []rule.LoadInfo {
 				pyTestKind,
 			},
 		},
+		{
+			Name: "@rules_python//python:packaging.bzl",
+			Symbols: []string{
+				pyPackageKind,
+				pyWheelKind,
+			},
+		},
+		{
+			Name: "@rules_python//python/entry_points:py_console_script_binary.bzl",
+			Symbols: []string{
+				pyConsoleScriptBinaryKind,
+			},
+		},
 		{
 			Name: fmt.Sprintf("@%s//bazel:py_proto_library.bzl", protobuf),
 			Symbols: []string{
 				pyProtoLibraryKind,
 			},
 		},
+		{
+			Name: fmt.Sprintf("@%s//Tools:rules.bzl", cython),
+			Symbols: []string{
+				pyxLibraryKind,
+			},
+		},
+		{
+			Name: fmt.Sprintf("@%s//py:defs.bzl", aspectRulesPy),
+			Symbols: []string{
+				pyPytestMainKind,
+			},
+		},
+		depsFileLoad,
 	}
 }
@@ -15,7 +15,17 @@
 package python
 
 import (
+	"context"
+	"flag"
+	"log"
+	"os"
+	"path/filepath"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
 )
 
 // Python satisfies the language.Language interface. It is the Gazelle extension
@@ -23,6 +33,50 @@ import (
 type Python struct {
 	Configurer
 	Resolver
+	language.BaseLifecycleManager
+
+	// entryPointPolicySkips are the packages where targets were not generated
+	// because of the python_entry_point_policy directive.
+	entryPointPolicySkips []entryPointPolicySkip
+	// weightedBinaries are the binaries to tag with the weight of the
+	// distributions they import, see python_import_weights_file.
+	weightedBinaries []weightedBinary
+	// optionalImportTargets maps the labels of the targets to tag with their
+	// optional imports to their rules, see python_optional_imports.
+	optionalImportTargets map[string]*rule.Rule
+	// unresolvedImportTargets maps the labels of the targets to tag when they
+	// have unresolved imports to their rules, see python_unresolved_imports.
+	unresolvedImportTargets map[string]*rule.Rule
+	// licensedTargets are the targets to annotate with the licenses of the
+	// distributions they import, see python_license_label.
+	licensedTargets []licensedTarget
+	// depsFilePackages are the packages whose targets get their dependencies
+	// from a py_deps.bzl file, see python_generate_deps_file.
+	depsFilePackages []depsFilePackage
+	// packageDataTargets maps the labels of the targets to add the package
+	// data files to to their rules, see python_package_data.
+	packageDataTargets map[string]*rule.Rule
+	// manualSelects are the select() expressions written by hand in the
+	// dependencies of the existing rules, added back once the dependencies
+	// are resolved.
+	manualSelects []manualSelects
+	// buildozerTargets are the targets whose dependency changes are written
+	// as buildozer commands, see -python_resolve_output.
+	buildozerTargets []buildozerTarget
+	// dependentFiles maps the packages of the dependents resolved again to
+	// their BUILD files, see reresolveDependents.
+	dependentFiles map[string]*rule.File
+	// namingReport records the generated targets renamed by the
+	// python_naming_strategy, set by the -python_naming_report flag.
+	namingReport *namingReport
+	// wrapperMacroRules are the rules of the wrapper macros generated or
+	// updated by the run, unwrapped again once the dependencies are resolved,
+	// see python_wrapper_macro.
+	wrapperMacroRules map[*rule.Rule]pythonconfig.WrapperMacroInfo
+	// facadeMembers maps the facade packages to the libraries of their
+	// immediate subdirectories, relative to the facade package, see
+	// python_coarse_grained_facade.
+	facadeMembers map[string][]string
 }
 
 // NewLanguage initializes a new Python that satisfies the language.Language
@@ -30,3 +84,166 @@ type Python struct {
 func NewLanguage() language.Language {
 	return &Python{}
 }
+
+// CheckFlags validates the configuration after command line flags are parsed.
+// It also enables the recording of the resolution decisions when they are
+// needed by the flags.
+func (py *Python) CheckFlags(fs *flag.FlagSet, c *config.Config) error {
+	if err := py.Configurer.CheckFlags(fs, c); err != nil {
+		return err
+	}
+	explainDependency, err := parseExplainDependency(py.Configurer.explainDependency)
+	if err != nil {
+		return err
+	}
+	py.Resolver.explainDependency = explainDependency
+	if py.addIgnoreAnnotationsPath != "" {
+		ignoreModules, err := loadIgnoreModules(py.addIgnoreAnnotationsPath)
+		if err != nil {
+			return err
+		}
+		py.ignoreModules = ignoreModules
+	}
+	bazelIgnoredDirs, err := loadBazelIgnore(c.RepoRoot)
+	if err != nil {
+		return err
+	}
+	py.bazelIgnoredDirs = bazelIgnoredDirs
+	if py.cachePath != "" {
+		py.cache = loadResolutionCache(py.cachePath)
+		py.cache.addFiles([]string{filepath.Join(c.RepoRoot, ".bazelignore")})
+	}
+	if py.profileOutputPath != "" {
+		py.profile = &resolutionProfile{}
+	}
+	if py.maxMemory != "" {
+		if err := py.setMemoryLimit(py.maxMemory); err != nil {
+			return err
+		}
+	}
+	if py.depsToRemoveReportPath != "" {
+		py.depsToRemoveReport = &depsToRemoveReport{}
+	}
+	if py.depsOrderIndexPath != "" {
+		py.depsOrderIndex = &depsOrderIndex{}
+	}
+	if py.wheelAuditPath != "" {
+		py.wheelAudit = &wheelAudit{}
+	}
+	if py.namingReportPath != "" {
+		py.namingReport = &namingReport{}
+	}
+	py.recordResolutions = py.recordResolutionsPath != "" || py.verifyResolutionsPath != "" || py.explainOutputPath != "" ||
+		py.importGraphPath != ""
+	return nil
+}
+
+// AfterResolvingDeps is called once all the dependencies have been resolved,
+// before the BUILD files are written.
+func (py *Python) AfterResolvingDeps(ctx context.Context) {
+	py.waitResolutions()
+	py.reresolveDependents()
+	py.reportImportCycles()
+	py.checkRunErrors()
+	// The rules of the wrapper macros are updated like the ones of the kinds
+	// they wrap until the dependencies are final.
+	wrapMacroRules := py.unwrapMacroRules()
+	py.applyImportWeights()
+	py.applyOptionalImportTags()
+	py.applyUnresolvedImports()
+	py.applyLicenses()
+	py.applyPackageData()
+	py.applyManualSelects()
+	py.applyIgnoreAnnotations()
+	// The dependencies written as buildozer commands are left out of the
+	// BUILD files, and so out of the py_deps.bzl files.
+	if py.resolveOutput == resolveOutputBuildozer {
+		py.writeBuildozerCommands()
+		wrapMacroRules()
+	} else {
+		py.writeDepsFiles()
+		wrapMacroRules()
+		py.writeDependentFiles()
+	}
+	py.writeDepsToRemoveReport()
+	py.writeDepsOrderIndex()
+	py.writeWheelAudit()
+	py.writeNamingReport()
+	// The profile is written before the resolutions are verified, which may
+	// fail.
+	py.writeProfile()
+	py.writeCache()
+	py.checkResolutions()
+}
+
+// reportImportCycles reports the import cycles between the resolved targets,
+// as requested by the -python_report_cycles and -python_cycle_report flags.
+func (py *Python) reportImportCycles() {
+	if !py.reportCycles && py.cycleReportPath == "" {
+		return
+	}
+	cycles := py.importGraph.cycles()
+	if py.reportCycles {
+		for _, cycle := range cycles {
+			log.Printf("WARNING: %s", cycle)
+		}
+	}
+	if py.cycleReportPath != "" {
+		if err := writeCycleReport(py.cycleReportPath, cycles); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// writeDepsToRemoveReport writes the -python_deps_to_remove_report file.
+func (py *Python) writeDepsToRemoveReport() {
+	if py.depsToRemoveReport == nil {
+		return
+	}
+	if err := py.depsToRemoveReport.write(py.depsToRemoveReportPath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// writeDepsOrderIndex writes the -python_deps_order_index file.
+func (py *Python) writeDepsOrderIndex() {
+	if py.depsOrderIndex == nil {
+		return
+	}
+	if err := py.depsOrderIndex.write(py.depsOrderIndexPath); err != nil {
+		log.Fatal(err)
+	}
+}
+
+// checkResolutions records the resolution decisions, or verifies them against
+// a previous recording, as requested by the -python_record_resolutions and
+// -python_verify_resolutions flags. A failed verification exits before any
+// BUILD file is written. It also writes the -python_explain_output and
+// -python_import_graph files.
+func (py *Python) checkResolutions() {
+	if !py.recordResolutions {
+		return
+	}
+	sortResolutions(py.resolutions)
+	if py.recordResolutionsPath != "" {
+		if err := writeResolutions(py.recordResolutionsPath, py.resolutions); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if py.explainOutputPath != "" {
+		if err := py.writeExplanation(py.explainOutputPath); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if py.importGraphPath != "" {
+		if err := writeImportGraph(py.importGraphPath, py.resolutions); err != nil {
+			log.Fatal(err)
+		}
+	}
+	if py.verifyResolutionsPath != "" {
+		if err := verifyResolutions(py.verifyResolutionsPath, py.resolutions); err != nil {
+			log.Printf("ERROR: %v", err)
+			os.Exit(1)
+		}
+	}
+}
@@ -0,0 +1,130 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// applicableLicensesAttr is the attribute listing the license metadata
+// targets of the distributions imported by a target.
+const applicableLicensesAttr = "applicable_licenses"
+
+// licensedTarget is a target to annotate with the licenses of the
+// distributions it imports, once all the dependencies are resolved.
+type licensedTarget struct {
+	label label.Label
+	// rule is the rule written to the BUILD file: the existing rule when
+	// there is one, or the generated one.
+	rule *rule.Rule
+	cfg  *pythonconfig.Config
+}
+
+// parseLicenseLabel parses the value of the python_license_label directive,
+// e.g. "MIT License //licenses:mit", declared in the package pkg. It returns
+// the license and the absolute label of its license metadata target.
+func parseLicenseLabel(pkg, value string) (string, label.Label, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 2 {
+		return "", label.NoLabel, fmt.Errorf("expected a license and a label, got %q", value)
+	}
+	l, err := label.Parse(fields[len(fields)-1])
+	if err != nil {
+		return "", label.NoLabel, fmt.Errorf("invalid label %q: %v", fields[len(fields)-1], err)
+	}
+	return strings.Join(fields[:len(fields)-1], " "), l.Abs("", pkg), nil
+}
+
+// addLicensedTargets records the targets generated in the package when a
+// python_license_label directive applies to it.
+func (py *Python) addLicensedTargets(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if !cfg.HasLicenseLabels() {
+		return
+	}
+	for _, r := range gen {
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		py.licensedTargets = append(py.licensedTargets, licensedTarget{
+			label: label.New(args.Config.RepoName, args.Rel, r.Name()),
+			rule:  target,
+			cfg:   cfg,
+		})
+	}
+}
+
+// licenseLabels returns the labels of the license metadata targets of the
+// distributions imported by the target, relative to its package and sorted.
+// The licenses that aren't mapped to a label are skipped.
+func (py *Resolver) licenseLabels(target licensedTarget) []string {
+	labels := make(map[string]bool)
+	for distribution := range py.distributions[target.label.String()] {
+		for _, license := range target.cfg.DistributionLicenses(distribution) {
+			if l, ok := target.cfg.LicenseLabel(license); ok {
+				labels[l.Rel(target.label.Repo, target.label.Pkg).String()] = true
+			}
+		}
+	}
+	sorted := make([]string, 0, len(labels))
+	for l := range labels {
+		sorted = append(sorted, l)
+	}
+	sort.Strings(sorted)
+	return sorted
+}
+
+// applyLicenses sets the applicable_licenses attribute of the recorded
+// targets, removing it from the targets without any licensed distribution.
+// An attribute marked with a "# keep" comment is left untouched.
+func (py *Python) applyLicenses() {
+	for _, target := range py.licensedTargets {
+		if attrShouldKeep(target.rule, applicableLicensesAttr) {
+			continue
+		}
+		if labels := py.licenseLabels(target); len(labels) > 0 {
+			target.rule.SetAttr(applicableLicensesAttr, labels)
+		} else {
+			target.rule.DelAttr(applicableLicensesAttr)
+		}
+	}
+}
+
+// attrShouldKeep returns whether the attribute of the rule, or its value, is
+// marked with a "# keep" comment.
+func attrShouldKeep(r *rule.Rule, key string) bool {
+	expr := r.Attr(key)
+	if expr == nil {
+		return false
+	}
+	if rule.ShouldKeep(expr) {
+		return true
+	}
+	comments := r.AttrComments(key)
+	for _, c := range append(comments.Before, comments.Suffix...) {
+		if text := strings.TrimSpace(strings.TrimPrefix(c.Token, "#")); text == "keep" || strings.HasPrefix(text, "keep: ") {
+			return true
+		}
+	}
+	return false
+}
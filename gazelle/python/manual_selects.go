@@ -0,0 +1,235 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"log"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// manualSelectAttrs are the dependency attributes whose select() expressions
+// written by hand are preserved.
+var manualSelectAttrs = []string{"deps", "pyi_deps"}
+
+// manualSelects are the select() expressions written by hand in a dependency
+// attribute of an existing rule, e.g. the select() of
+// `deps = [":lib"] + select({":gpu": ["@pypi//torch"]})`, which Gazelle
+// can't merge with the resolved dependencies.
+type manualSelects struct {
+	// rule is the rule of the BUILD file.
+	rule *rule.Rule
+	from label.Label
+	attr string
+	// leading are the select() expressions written before the plain list,
+	// and selects the ones written after it.
+	leading []bzl.Expr
+	selects []bzl.Expr
+}
+
+// addManualSelects removes the select() expressions written by hand from the
+// dependency attributes of the existing rules the generated rules are merged
+// into, so that the resolved dependencies are merged into the plain list only.
+// They're added back by applyManualSelects once the dependencies are resolved,
+// on the same side of the plain list, or after it when there was none. Several plain lists are merged into the
+// first one. The select() generated for the platform-conditional dependencies
+// is left in place, as Gazelle merges it. The rules and attributes marked with
+// a "# keep" comment, and the expressions that aren't a sum of lists and
+// select() calls, are left untouched.
+func (py *Python) addManualSelects(args language.GenerateArgs, gen []*rule.Rule) {
+	for _, r := range gen {
+		target := ruleInFile(args, r)
+		if target == r || target.ShouldKeep() {
+			continue
+		}
+		for _, attr := range manualSelectAttrs {
+			if attrShouldKeep(target, attr) {
+				continue
+			}
+			parts, ok := sumParts(target.Attr(attr))
+			if !ok {
+				continue
+			}
+			var merged, leading, selects []bzl.Expr
+			var plain *bzl.ListExpr
+			for _, part := range parts {
+				switch part := part.(type) {
+				case *bzl.ListExpr:
+					if plain == nil {
+						plain = part
+						merged = append(merged, part)
+					} else {
+						plain.List = append(plain.List, part.List...)
+					}
+				case *bzl.CallExpr:
+					if isPlatformSelect(part) {
+						merged = append(merged, part)
+					} else if plain == nil {
+						leading = append(leading, part)
+					} else {
+						selects = append(selects, part)
+					}
+				}
+			}
+			if len(leading) == 0 && len(selects) == 0 {
+				continue
+			}
+			if plain == nil {
+				leading, selects = nil, append(leading, selects...)
+			}
+			if expr := sumExpr(merged); expr != nil {
+				target.SetAttr(attr, expr)
+			} else {
+				target.DelAttr(attr)
+			}
+			py.manualSelects = append(py.manualSelects, manualSelects{
+				rule:    target,
+				from:    label.New("", args.Rel, target.Name()),
+				attr:    attr,
+				leading: leading,
+				selects: selects,
+			})
+		}
+	}
+}
+
+// sumParts returns the operands of expr, a list, a select() call or a sum of
+// them, from left to right. It returns false for any other expression.
+func sumParts(expr bzl.Expr) ([]bzl.Expr, bool) {
+	switch expr := expr.(type) {
+	case *bzl.ListExpr:
+		return []bzl.Expr{expr}, true
+	case *bzl.CallExpr:
+		if ident, ok := expr.X.(*bzl.Ident); ok && ident.Name == "select" && len(expr.List) == 1 {
+			if _, ok := expr.List[0].(*bzl.DictExpr); ok {
+				return []bzl.Expr{expr}, true
+			}
+		}
+	case *bzl.BinaryExpr:
+		if expr.Op != "+" {
+			return nil, false
+		}
+		x, ok := sumParts(expr.X)
+		if !ok {
+			return nil, false
+		}
+		y, ok := sumParts(expr.Y)
+		if !ok {
+			return nil, false
+		}
+		return append(x, y...), true
+	}
+	return nil, false
+}
+
+// sumExpr returns the sum of the expressions, or nil when there are none.
+func sumExpr(exprs []bzl.Expr) bzl.Expr {
+	var sum bzl.Expr
+	for _, expr := range exprs {
+		if sum == nil {
+			sum = expr
+		} else {
+			sum = &bzl.BinaryExpr{X: sum, Op: "+", Y: expr}
+		}
+	}
+	return sum
+}
+
+// isPlatformSelect returns whether the select() call has the shape of the one
+// generated for the platform-conditional dependencies: @platforms//os keys and
+// an empty default branch, without any "# keep" comment.
+func isPlatformSelect(call *bzl.CallExpr) bool {
+	if hasKeptValue(call) {
+		return false
+	}
+	for _, kv := range call.List[0].(*bzl.DictExpr).List {
+		key, ok := kv.Key.(*bzl.StringExpr)
+		if !ok {
+			return false
+		}
+		if key.Value == defaultCondition {
+			if list, ok := kv.Value.(*bzl.ListExpr); !ok || len(list.List) > 0 {
+				return false
+			}
+		} else if !strings.HasPrefix(key.Value, platformConstraintPrefix) {
+			return false
+		}
+	}
+	return true
+}
+
+// applyManualSelects adds the select() expressions written by hand back to the
+// dependency attributes of the recorded rules, around the resolved
+// dependencies. The resolved dependencies already listed in a branch of the
+// select() expressions are removed from the plain list, as they were made
+// conditional on purpose, unless they're marked with a "# keep" comment, in
+// which case Bazel rejects the duplicate label and a warning is logged.
+func (py *Python) applyManualSelects() {
+	for _, m := range py.manualSelects {
+		conditional := make(map[string]bool)
+		for _, s := range append(append([]bzl.Expr{}, m.leading...), m.selects...) {
+			for _, kv := range s.(*bzl.CallExpr).List[0].(*bzl.DictExpr).List {
+				bzl.Walk(kv.Value, func(e bzl.Expr, _ []bzl.Expr) {
+					if str, ok := e.(*bzl.StringExpr); ok {
+						conditional[str.Value] = true
+					}
+				})
+			}
+		}
+		var parts []bzl.Expr
+		if expr := m.rule.Attr(m.attr); expr != nil {
+			if merged, ok := sumParts(expr); ok {
+				for _, part := range merged {
+					if list, ok := part.(*bzl.ListExpr); ok {
+						if part = m.unconditionalDeps(list, conditional); part == nil {
+							continue
+						}
+					}
+					parts = append(parts, part)
+				}
+			} else {
+				parts = append(parts, expr)
+			}
+		}
+		parts = append(append(append([]bzl.Expr{}, m.leading...), parts...), m.selects...)
+		m.rule.SetAttr(m.attr, sumExpr(parts))
+	}
+}
+
+// unconditionalDeps returns the list without the dependencies listed in a
+// branch of the select() expressions written by hand, or nil when no
+// dependency is left.
+func (m manualSelects) unconditionalDeps(list *bzl.ListExpr, conditional map[string]bool) bzl.Expr {
+	var deps []bzl.Expr
+	for _, dep := range list.List {
+		if str, ok := dep.(*bzl.StringExpr); ok && conditional[str.Value] {
+			if !rule.ShouldKeep(dep) {
+				continue
+			}
+			log.Printf("WARNING: %s lists %s in its %s both with a \"# keep\" comment and in a branch of a select(): "+
+				"Bazel rejects the duplicate label, remove one of them", m.from, str.Value, m.attr)
+		}
+		deps = append(deps, dep)
+	}
+	if len(deps) == 0 {
+		return nil
+	}
+	list.List = deps
+	return list
+}
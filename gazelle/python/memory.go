@@ -0,0 +1,66 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"runtime"
+	"runtime/debug"
+	"strconv"
+	"strings"
+)
+
+// memorySizeUnits are the units of the -python_max_memory flag, the same as
+// the ones of the GOMEMLIMIT environment variable.
+var memorySizeUnits = []struct {
+	suffix string
+	size   int64
+}{
+	{"TiB", 1 << 40},
+	{"GiB", 1 << 30},
+	{"MiB", 1 << 20},
+	{"KiB", 1 << 10},
+	{"B", 1},
+}
+
+// parseMemorySize parses a size in bytes, e.g. "12GiB" or "1073741824".
+func parseMemorySize(value string) (int64, error) {
+	number, unit := value, int64(1)
+	for _, u := range memorySizeUnits {
+		if strings.HasSuffix(value, u.suffix) {
+			number, unit = strings.TrimSuffix(value, u.suffix), u.size
+			break
+		}
+	}
+	size, err := strconv.ParseInt(number, 10, 64)
+	if err != nil || size <= 0 || size > (1<<63-1)/unit {
+		return 0, fmt.Errorf("invalid size %q: expected a positive number of bytes, optionally followed by B, KiB, MiB, GiB or TiB", value)
+	}
+	return size * unit, nil
+}
+
+// setMemoryLimit sets the soft memory limit of the run, given to the
+// -python_max_memory flag. The garbage collector runs more often as the limit
+// gets closer, and the resolutions computed ahead of Gazelle are bounded, so
+// that they are released soon after being applied.
+func (py *Python) setMemoryLimit(value string) error {
+	limit, err := parseMemorySize(value)
+	if err != nil {
+		return fmt.Errorf("invalid value for -python_max_memory: %w", err)
+	}
+	debug.SetMemoryLimit(limit)
+	py.resolutionWindow = make(chan struct{}, 2*runtime.GOMAXPROCS(0))
+	return nil
+}
@@ -0,0 +1,41 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestParseMemorySize(t *testing.T) {
+	for value, want := range map[string]int64{
+		"1073741824": 1 << 30,
+		"512B":       512,
+		"64KiB":      64 << 10,
+		"512MiB":     512 << 20,
+		"12GiB":      12 << 30,
+		"1TiB":       1 << 40,
+	} {
+		size, err := parseMemorySize(value)
+		if assert.NoError(t, err, value) {
+			assert.Equal(t, want, size, value)
+		}
+	}
+	for _, value := range []string{"", "0", "-1GiB", "12GB", "GiB", "1.5GiB", "99999999999TiB"} {
+		_, err := parseMemorySize(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,98 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"log"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// mergeModuleGroups merges the per-file groups of the library files of a
+// package with the groups of its .gazelle-groups.yaml file, so that the files
+// of a module group, and the files grouped with them, e.g. because of a cycle,
+// end up in a single target. The files of a module group that aren't library
+// files of the package are ignored with a warning. The groups are sorted by
+// their first file.
+func mergeModuleGroups(
+	bzlPackage string,
+	groups []*treeset.Set,
+	moduleGroups *pythonconfig.ModuleGroups,
+) []*treeset.Set {
+	if moduleGroups == nil {
+		return groups
+	}
+	for _, moduleGroup := range moduleGroups.Groups {
+		merged := treeset.NewWith(godsutils.StringComparator)
+		for _, filename := range moduleGroup {
+			if merged.Contains(filename) {
+				continue
+			}
+			i := findGroup(groups, filename)
+			if i < 0 {
+				log.Printf("WARNING: %s: %q isn't a library file of the package, so it's ignored\n",
+					filepath.Join(bzlPackage, pythonconfig.ModuleGroupsFilename), filename)
+				continue
+			}
+			merged.Add(groups[i].Values()...)
+			groups = append(groups[:i], groups[i+1:]...)
+		}
+		if !merged.Empty() {
+			groups = append(groups, merged)
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Values()[0].(string) < groups[j].Values()[0].(string)
+	})
+	return groups
+}
+
+// findGroup returns the index of the group with the file, or -1.
+func findGroup(groups []*treeset.Set, filename string) int {
+	for i, group := range groups {
+		if group.Contains(filename) {
+			return i
+		}
+	}
+	return -1
+}
+
+// staleGroupedLibraries returns empty rules for the existing per-file
+// py_library targets of the files grouped with others, named targetNames, e.g.
+// the former models_mixins target once models_mixins.py is grouped with
+// models.py, so that they're removed.
+func staleGroupedLibraries(args language.GenerateArgs, targetNames []string) []*rule.Rule {
+	if args.File == nil {
+		return nil
+	}
+	stale := make(map[string]bool, len(targetNames))
+	for _, name := range targetNames {
+		stale[name] = true
+	}
+	var rules []*rule.Rule
+	for _, r := range args.File.Rules {
+		if stale[r.Name()] && kindMatches(args.Config, r, pyLibraryKind) {
+			rules = append(rules, newTargetBuilder(pyLibraryKind, r.Name(), "", "", nil, false).build())
+		}
+	}
+	return rules
+}
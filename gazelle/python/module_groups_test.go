@@ -0,0 +1,95 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestMergeModuleGroups(t *testing.T) {
+	newGroups := func(groups ...[]string) []*treeset.Set {
+		var sets []*treeset.Set
+		for _, group := range groups {
+			set := treeset.NewWith(godsutils.StringComparator)
+			for _, filename := range group {
+				set.Add(filename)
+			}
+			sets = append(sets, set)
+		}
+		return sets
+	}
+	groupValues := func(groups []*treeset.Set) [][]string {
+		var values [][]string
+		for _, group := range groups {
+			var filenames []string
+			for _, filename := range group.Values() {
+				filenames = append(filenames, filename.(string))
+			}
+			values = append(values, filenames)
+		}
+		return values
+	}
+
+	tests := []struct {
+		name         string
+		groups       [][]string
+		moduleGroups *pythonconfig.ModuleGroups
+		want         [][]string
+	}{
+		{
+			name:   "no module groups",
+			groups: [][]string{{"a.py"}, {"b.py"}},
+			want:   [][]string{{"a.py"}, {"b.py"}},
+		},
+		{
+			name:         "module group",
+			groups:       [][]string{{"models.py"}, {"models_mixins.py"}, {"views.py"}},
+			moduleGroups: &pythonconfig.ModuleGroups{Groups: [][]string{{"models_mixins.py", "models.py"}}},
+			want:         [][]string{{"models.py", "models_mixins.py"}, {"views.py"}},
+		},
+		{
+			name:         "module group with a cycle",
+			groups:       [][]string{{"a.py", "c.py"}, {"b.py"}, {"d.py"}},
+			moduleGroups: &pythonconfig.ModuleGroups{Groups: [][]string{{"b.py", "c.py"}}},
+			want:         [][]string{{"a.py", "b.py", "c.py"}, {"d.py"}},
+		},
+		{
+			name:   "overlapping module groups",
+			groups: [][]string{{"a.py"}, {"b.py"}, {"c.py"}, {"d.py"}},
+			moduleGroups: &pythonconfig.ModuleGroups{
+				Groups: [][]string{{"a.py", "b.py"}, {"b.py", "c.py"}},
+			},
+			want: [][]string{{"a.py", "b.py", "c.py"}, {"d.py"}},
+		},
+		{
+			name:         "unknown files",
+			groups:       [][]string{{"a.py"}, {"b.py"}},
+			moduleGroups: &pythonconfig.ModuleGroups{Groups: [][]string{{"a.py", "a.py", "missing.py"}, {"missing.py"}}},
+			want:         [][]string{{"a.py"}, {"b.py"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := mergeModuleGroups("pkg", newGroups(tt.groups...), tt.moduleGroups)
+			assert.Equal(t, tt.want, groupValues(got))
+		})
+	}
+}
@@ -0,0 +1,67 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+)
+
+// addNamespaceProviders records the target as a provider of the implicit
+// namespace packages, see PEP 420, enclosing the modules it provides: the
+// parent packages of each module without an __init__.py file, up to the first
+// regular package. Importing a namespace package then depends on all of its
+// providers, which may live in different Bazel packages.
+func (py *Resolver) addNamespaceProviders(repoRoot, pythonProjectRoot string, target label.Label, provides []resolve.ImportSpec) {
+	for _, provide := range provides {
+		parts := strings.Split(provide.Imp, ".")
+		for i := len(parts) - 1; i > 0; i-- {
+			dir := path.Join(pythonProjectRoot, strings.Join(parts[:i], "/"))
+			if info := py.stat(repoRoot, dir); info == nil || !info.IsDir() {
+				break
+			}
+			if py.stat(repoRoot, path.Join(dir, pyLibraryEntrypointFilename)) != nil {
+				break
+			}
+			namespace := strings.Join(parts[:i], ".")
+			if py.namespaceProviders == nil {
+				py.namespaceProviders = make(map[string]map[string]label.Label)
+			}
+			if py.namespaceProviders[namespace] == nil {
+				py.namespaceProviders[namespace] = make(map[string]label.Label)
+			}
+			py.namespaceProviders[namespace][target.String()] = target
+			py.cache.addNamespace(namespace, target)
+		}
+	}
+}
+
+// findNamespaceProviders returns the targets providing the modules of the
+// implicit namespace package, sorted by label. The index is complete once
+// the rules are resolved, so it's safe to read concurrently.
+func (py *Resolver) findNamespaceProviders(namespace string) []label.Label {
+	providers := make([]label.Label, 0, len(py.namespaceProviders[namespace]))
+	for _, target := range py.namespaceProviders[namespace] {
+		providers = append(providers, target)
+	}
+	sort.Slice(providers, func(i, j int) bool {
+		return providers[i].String() < providers[j].String()
+	})
+	return providers
+}
@@ -0,0 +1,88 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// namingReport records the generated targets whose name under the
+// python_naming_strategy differs from their legacy name, written to the
+// -python_naming_report file so that a change of naming strategy can be
+// rolled out, e.g. by updating the references to the renamed targets. A nil
+// report records nothing.
+type namingReport struct {
+	renamed []renamedTarget
+}
+
+// renamedTarget is a generated target named differently than by the legacy
+// naming strategy.
+type renamedTarget struct {
+	Kind string `json:"kind"`
+	From string `json:"from"`
+	To   string `json:"to"`
+}
+
+// namingReportFile is the format of the -python_naming_report file.
+type namingReportFile struct {
+	Renamed []renamedTarget `json:"renamed"`
+}
+
+// add records the target t when its name differs from its legacy name.
+func (report *namingReport) add(t pythonconfig.GeneratedTarget, legacyName, name string) {
+	if report == nil || legacyName == name {
+		return
+	}
+	report.renamed = append(report.renamed, renamedTarget{
+		Kind: t.Kind,
+		From: label.New("", t.Pkg, legacyName).String(),
+		To:   label.New("", t.Pkg, name).String(),
+	})
+}
+
+// write writes the renamed targets, sorted by their legacy label, as JSON to
+// the given path.
+func (report *namingReport) write(path string) error {
+	renamed := append([]renamedTarget{}, report.renamed...)
+	sort.Slice(renamed, func(i, j int) bool {
+		return renamed[i].From < renamed[j].From
+	})
+	data, err := json.MarshalIndent(namingReportFile{Renamed: renamed}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the naming report: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the naming report: %w", err)
+	}
+	return nil
+}
+
+// writeNamingReport writes the -python_naming_report file.
+func (py *Python) writeNamingReport() {
+	if py.namingReport == nil {
+		return
+	}
+	if err := py.namingReport.write(py.namingReportPath); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,47 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestNamingReport(t *testing.T) {
+	report := &namingReport{}
+	report.add(pythonconfig.GeneratedTarget{Kind: "py_test", Pkg: "b"}, "b_test", "b_test_1a2b3c4d")
+	report.add(pythonconfig.GeneratedTarget{Kind: "py_library", Pkg: "a"}, "a", "a")
+	report.add(pythonconfig.GeneratedTarget{Kind: "py_library", Pkg: "a", File: "x.py"}, "x", "a_x")
+	// A nil report records nothing.
+	(*namingReport)(nil).add(pythonconfig.GeneratedTarget{Kind: "py_library", Pkg: "c"}, "c", "d")
+
+	path := filepath.Join(t.TempDir(), "naming.json")
+	if !assert.NoError(t, report.write(path)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	assert.JSONEq(t, `{"renamed": [
+		{"kind": "py_library", "from": "//a:x", "to": "//a:a_x"},
+		{"kind": "py_test", "from": "//b:b_test", "to": "//b:b_test_1a2b3c4d"}
+	]}`, string(data))
+}
@@ -0,0 +1,89 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"path"
+	"regexp"
+	"slices"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// nativeModuleRe matches the dotted names of the Python modules, e.g.
+// "fastlib" or "native.fastlib".
+var nativeModuleRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*(\.[A-Za-z_][A-Za-z0-9_]*)*$`)
+
+// nativeExtensionKinds are the kinds of the targets building the native
+// extension modules indexed when tagged with python_extension.
+var nativeExtensionKinds = []string{"cc_binary", "cc_shared_library"}
+
+// parseNativeModule parses the value of the python_native_module directive,
+// e.g. "fastlib //native:fastlib.so", declared in the package pkg. It returns
+// the name of the module and the absolute label of the target building the
+// extension.
+func parseNativeModule(pkg, value string) (string, label.Label, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return "", label.NoLabel, fmt.Errorf("expected a module and a label, got %q", value)
+	}
+	module := fields[0]
+	if !nativeModuleRe.MatchString(module) {
+		return "", label.NoLabel, fmt.Errorf("%q is not a module name", module)
+	}
+	if ext := path.Ext(module); ext == ".so" || ext == ".pyd" {
+		return "", label.NoLabel, fmt.Errorf("%q is the file name of the extension, expected its module name", module)
+	}
+	l, err := label.Parse(fields[1])
+	if err != nil {
+		return "", label.NoLabel, fmt.Errorf("invalid label %q: %v", fields[1], err)
+	}
+	return module, l.Abs("", pkg), nil
+}
+
+// nativeExtensionModule returns the module of the extension built by the
+// target named name in the package rel, named after the target up to its
+// first dot, e.g. native.fastlib for //native:fastlib.so or
+// //native:fastlib.cpython-311-x86_64-linux-gnu.so.
+func nativeExtensionModule(cfg *pythonconfig.Config, rel, name string) string {
+	base, _, _ := strings.Cut(name, ".")
+	return importSpecFromSrc(cfg.PythonProjectRoot(), rel, base+".py").Imp
+}
+
+// addNativeModules records the native extension modules built in the package
+// rel, as declared by the python_native_module directives, whose values are
+// given, and by the cc_binary and cc_shared_library targets tagged with
+// python_extension.
+func addNativeModules(cfg *pythonconfig.Config, rel string, f *rule.File, values []string) error {
+	for _, value := range values {
+		module, l, err := parseNativeModule(rel, value)
+		if err != nil {
+			return fmt.Errorf("invalid value for directive %q: %w", pythonconfig.NativeModule, err)
+		}
+		cfg.AddNativeModule(module, l)
+	}
+	for _, r := range f.Rules {
+		if !slices.Contains(nativeExtensionKinds, r.Kind()) || !slices.Contains(r.AttrStrings("tags"), pythonconfig.NativeExtensionTag) {
+			continue
+		}
+		cfg.AddNativeModule(nativeExtensionModule(cfg, rel, r.Name()), label.New("", rel, r.Name()))
+	}
+	return nil
+}
@@ -0,0 +1,92 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestParseNativeModule(t *testing.T) {
+	module, l, err := parseNativeModule("native", "fastlib :fastlib.so")
+	assert.NoError(t, err)
+	assert.Equal(t, "fastlib", module)
+	assert.Equal(t, "//native:fastlib.so", l.String())
+
+	module, l, err = parseNativeModule("", "native.fastlib //native:fastlib.so")
+	assert.NoError(t, err)
+	assert.Equal(t, "native.fastlib", module)
+	assert.Equal(t, "//native:fastlib.so", l.String())
+
+	for _, value := range []string{
+		"fastlib",
+		"fastlib.so //native:fastlib.so",
+		"native/fastlib //native:fastlib.so",
+		"fastlib //native:fastlib.so extra",
+		"fastlib //native:fast:lib",
+	} {
+		_, _, err := parseNativeModule("", value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestAddNativeModules(t *testing.T) {
+	f, err := rule.LoadData("native/BUILD", "native", []byte(`
+cc_binary(
+    name = "fastlib.so",
+    linkshared = True,
+    tags = ["python_extension"],
+)
+
+cc_shared_library(
+    name = "codec.cpython-311-x86_64-linux-gnu.so",
+    tags = ["python_extension"],
+)
+
+cc_binary(
+    name = "tool",
+)
+
+genrule(
+    name = "gen",
+    outs = ["gen.so"],
+    tags = ["python_extension"],
+)
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := pythonconfig.New("/repo", "")
+	assert.NoError(t, addNativeModules(cfg, "native", f, []string{"_speedups :speedups.so"}))
+
+	for module, want := range map[string]string{
+		"native.fastlib": "//native:fastlib.so",
+		"native.codec":   "//native:codec.cpython-311-x86_64-linux-gnu.so",
+		"_speedups":      "//native:speedups.so",
+	} {
+		l, ok := cfg.FindNativeModule(module)
+		if assert.True(t, ok, module) {
+			assert.Equal(t, want, l.String(), module)
+		}
+	}
+	for _, module := range []string{"native.tool", "native.gen"} {
+		_, ok := cfg.FindNativeModule(module)
+		assert.False(t, ok, module)
+	}
+}
@@ -0,0 +1,222 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"log"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/lists/singlylinkedlist"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	// genruleKind is the kind of the targets converting the notebooks, see
+	// python_notebook_converter.
+	genruleKind = "genrule"
+	// notebookExt is the extension of the Jupyter notebooks.
+	notebookExt = ".ipynb"
+	// notebookGenruleSuffix is the suffix of the name of the genrule
+	// converting a notebook, e.g. analysis_ipynb for analysis.ipynb.
+	notebookGenruleSuffix = "_ipynb"
+)
+
+// parseNotebookConverter parses the value of the python_notebook_converter
+// directive of the package pkg: the label of the converter, or an empty value
+// to disable the notebooks.
+func parseNotebookConverter(pkg, value string) (label.Label, error) {
+	value = strings.TrimSpace(value)
+	if value == "" {
+		return label.NoLabel, nil
+	}
+	if strings.ContainsAny(value, " \t") {
+		return label.NoLabel, fmt.Errorf("invalid label %q: the labels can't contain whitespace", value)
+	}
+	l, err := label.Parse(value)
+	if err != nil {
+		return label.NoLabel, fmt.Errorf("invalid label %q: %v", value, err)
+	}
+	return l.Abs("", pkg), nil
+}
+
+// notebook is the part of the Jupyter notebook format read by Gazelle.
+type notebook struct {
+	Cells []struct {
+		CellType string `json:"cell_type"`
+		// Source is a string, or a list of lines.
+		Source json.RawMessage `json:"source"`
+	} `json:"cells"`
+}
+
+// notebookCode returns the Python code of the code cells of the Jupyter
+// notebook, as converted by jupyter nbconvert. The IPython magics and shell
+// commands, e.g. `%matplotlib inline` or `!pip install`, aren't Python and
+// are blanked, and the cells with a cell magic are skipped.
+func notebookCode(content []byte) ([]byte, error) {
+	var nb notebook
+	if err := json.Unmarshal(content, &nb); err != nil {
+		return nil, err
+	}
+	var code bytes.Buffer
+	for _, cell := range nb.Cells {
+		if cell.CellType != "code" {
+			continue
+		}
+		var source string
+		if err := json.Unmarshal(cell.Source, &source); err != nil {
+			var lines []string
+			if err := json.Unmarshal(cell.Source, &lines); err != nil {
+				return nil, fmt.Errorf("invalid cell source: %w", err)
+			}
+			source = strings.Join(lines, "")
+		}
+		if strings.HasPrefix(strings.TrimSpace(source), "%%") {
+			continue
+		}
+		for _, line := range strings.Split(source, "\n") {
+			if trimmed := strings.TrimSpace(line); strings.HasPrefix(trimmed, "%") || strings.HasPrefix(trimmed, "!") {
+				line = ""
+			}
+			code.WriteString(line)
+			code.WriteByte('\n')
+		}
+	}
+	return code.Bytes(), nil
+}
+
+// notebookModule returns the name of the Python module converted from the
+// notebook, e.g. analysis.py for analysis.ipynb.
+func notebookModule(filename string) string {
+	return strings.TrimSuffix(filename, notebookExt) + ".py"
+}
+
+// generateNotebooks generates, with python_notebook_converter, a genrule
+// converting each Jupyter notebook of the package to a Python module, and a
+// py_library of the module named after the notebook, whose deps are resolved
+// from the imports of the code cells. The notebooks paired with a Python
+// module of the same name, e.g. by jupytext, are skipped. The targets
+// generated before for the notebooks removed since, or when the notebooks
+// are disabled, are emptied.
+func generateNotebooks(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	parser *python3Parser,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	result *language.GenerateResult,
+	collisionErrors *singlylinkedlist.List,
+) {
+	generated := make(map[string]bool)
+	converter := cfg.NotebookConverter()
+	var notebooks []string
+	if converter != label.NoLabel {
+		for _, f := range args.RegularFiles {
+			if filepath.Ext(f) == notebookExt && !cfg.IgnoresFile(filepath.Base(f)) && !cfg.ExcludesPath(filepath.Join(args.Rel, f)) {
+				notebooks = append(notebooks, f)
+			}
+		}
+	}
+	sort.Strings(notebooks)
+	for _, nb := range notebooks {
+		module := notebookModule(nb)
+		if pyFileNames.Contains(module) {
+			log.Printf("WARNING: %s: skipping the notebook paired with %s\n", filepath.Join(args.Rel, nb), module)
+			continue
+		}
+		name := strings.TrimSuffix(nb, notebookExt)
+		genruleName := name + notebookGenruleSuffix
+		if err := notebookTargetCollision(args, result, name, pyLibraryKind); err != nil {
+			collisionErrors.Add(err)
+			continue
+		}
+		if err := notebookTargetCollision(args, result, genruleName, genruleKind); err != nil {
+			collisionErrors.Add(err)
+			continue
+		}
+		deps, _, annotations, err := parser.parseSingle(nb)
+		if err != nil {
+			log.Fatalf("ERROR: %v\n", err)
+		}
+		tool := converter.Rel(args.Config.RepoName, args.Rel).String()
+		convert := rule.NewRule(genruleKind, genruleName)
+		convert.SetAttr("srcs", []string{nb})
+		convert.SetAttr("outs", []string{module})
+		convert.SetAttr("cmd", fmt.Sprintf("$(execpath %s) --to script --stdout $< > $@", tool))
+		convert.SetAttr("tools", []string{tool})
+		result.Gen = append(result.Gen, convert)
+		result.Imports = append(result.Imports, nil)
+
+		library := newTargetBuilder(pyLibraryKind, name, pythonProjectRoot, args.Rel, pyFileNames, cfg.ResolveSiblingImports()).
+			addVisibility(visibility).
+			addSrc(module).
+			addModuleDependencies(deps).
+			addResolvedDependencies(annotations.includeDeps).
+			generateImportsAttribute().
+			setAnnotations(*annotations).
+			build()
+		result.Gen = append(result.Gen, library)
+		result.Imports = append(result.Imports, library.PrivateAttr(config.GazelleImportsKey))
+		generated[genruleName] = true
+	}
+
+	if args.File == nil {
+		return
+	}
+	for _, r := range args.File.Rules {
+		if !isNotebookGenrule(r) || generated[r.Name()] {
+			continue
+		}
+		result.Empty = append(result.Empty,
+			rule.NewRule(genruleKind, r.Name()),
+			rule.NewRule(pyLibraryKind, strings.TrimSuffix(r.Name(), notebookGenruleSuffix)))
+	}
+}
+
+// isNotebookGenrule returns whether the rule is a genrule converting a
+// notebook, as generated by generateNotebooks.
+func isNotebookGenrule(r *rule.Rule) bool {
+	srcs := r.AttrStrings("srcs")
+	return r.Kind() == genruleKind && len(srcs) == 1 &&
+		r.Name() == strings.TrimSuffix(srcs[0], notebookExt)+notebookGenruleSuffix
+}
+
+// notebookTargetCollision returns an error if a target of another kind, or
+// one generated already, has the name of a target of a notebook.
+func notebookTargetCollision(args language.GenerateArgs, result *language.GenerateResult, name, kind string) error {
+	fqTarget := label.New("", args.Rel, name)
+	for _, r := range result.Gen {
+		if r.Name() == name {
+			return fmt.Errorf("failed to generate target %q of kind %q for a notebook: "+
+				"a target with the same name is already generated", fqTarget.String(), getMappedKind(args.Config, kind))
+		}
+	}
+	if err := ensureNoCollision(args.Config, args.File, name, kind); err != nil {
+		return fmt.Errorf("failed to generate target %q of kind %q for a notebook: %w",
+			fqTarget.String(), getMappedKind(args.Config, kind), err)
+	}
+	return nil
+}
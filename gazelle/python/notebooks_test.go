@@ -0,0 +1,72 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestNotebookCode(t *testing.T) {
+	code, err := notebookCode([]byte(`{
+		"cells": [
+			{"cell_type": "markdown", "source": ["import notreal\n"]},
+			{"cell_type": "code", "source": ["%matplotlib inline\n", "!pip install seaborn\n", "import pandas\n"]},
+			{"cell_type": "code", "source": "%%bash\nimport nope"},
+			{"cell_type": "code", "source": "import numpy"}
+		]
+	}`))
+	assert.NoError(t, err)
+	assert.Equal(t, "\n\nimport pandas\n\nimport numpy\n", string(code))
+
+	_, err = notebookCode([]byte(`{"cells": [{"cell_type": "code", "source": 1}]}`))
+	assert.Error(t, err)
+	_, err = notebookCode([]byte(`not a notebook`))
+	assert.Error(t, err)
+}
+
+func TestParseNotebookConverter(t *testing.T) {
+	l, err := parseNotebookConverter("analysis", ":nbconvert")
+	assert.NoError(t, err)
+	assert.Equal(t, label.New("", "analysis", "nbconvert"), l)
+
+	l, err = parseNotebookConverter("analysis", "")
+	assert.NoError(t, err)
+	assert.Equal(t, label.NoLabel, l)
+
+	_, err = parseNotebookConverter("analysis", "//my tools:nbconvert")
+	assert.Error(t, err)
+}
+
+func TestIsNotebookGenrule(t *testing.T) {
+	newGenrule := func(name string, srcs ...string) *rule.Rule {
+		r := rule.NewRule(genruleKind, name)
+		r.SetAttr("srcs", srcs)
+		return r
+	}
+	assert.True(t, isNotebookGenrule(newGenrule("report_ipynb", "report.ipynb")))
+	// The genrules that aren't converting a notebook are left untouched.
+	assert.False(t, isNotebookGenrule(newGenrule("notes_ipynb", "notes.txt")))
+	assert.False(t, isNotebookGenrule(newGenrule("report", "report.ipynb")))
+	assert.False(t, isNotebookGenrule(newGenrule("report_ipynb", "report.ipynb", "data.csv")))
+	assert.False(t, isNotebookGenrule(newGenrule("version", "VERSION")))
+
+	library := rule.NewRule(pyLibraryKind, "report_ipynb")
+	library.SetAttr("srcs", []string{"report.ipynb"})
+	assert.False(t, isNotebookGenrule(library))
+}
@@ -0,0 +1,62 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// parseOpaque parses the value of the python_opaque directive, e.g.
+// "//third_party/vendored/foo", declared in the package pkg. It returns the
+// absolute label of the opaque library.
+func parseOpaque(pkg, value string) (label.Label, error) {
+	l, err := label.Parse(strings.TrimSpace(value))
+	if err != nil {
+		return label.NoLabel, fmt.Errorf("invalid label %q: %v", value, err)
+	}
+	l = l.Abs("", pkg)
+	if l.Repo != "" {
+		return label.NoLabel, fmt.Errorf("%q is not a label of the main repository", value)
+	}
+	if l.Pkg == "" {
+		return label.NoLabel, fmt.Errorf("%q is in the root package, which can't be opaque", value)
+	}
+	return l, nil
+}
+
+// addOpaqueLibrary records the opaque library of the python_opaque directive
+// declared in the package rel, providing the module of its package relative
+// to the Python project root.
+func addOpaqueLibrary(cfg *pythonconfig.Config, rel, value string) error {
+	l, err := parseOpaque(rel, value)
+	if err != nil {
+		return err
+	}
+	pythonProjectRoot := cfg.PythonProjectRoot()
+	dir := l.Pkg
+	if pythonProjectRoot != "" {
+		if !strings.HasPrefix(l.Pkg, pythonProjectRoot+"/") {
+			return fmt.Errorf("the package of %q is not under the Python root %q", value, "//"+pythonProjectRoot)
+		}
+		dir = strings.TrimPrefix(l.Pkg, pythonProjectRoot+"/")
+	}
+	cfg.AddOpaqueLibrary(strings.ReplaceAll(dir, "/", "."), l)
+	return nil
+}
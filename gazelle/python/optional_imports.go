@@ -0,0 +1,108 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	sitter "github.com/smacker/go-tree-sitter"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// optionalImportTagPrefix is the prefix of the tags listing the optional
+// imports of a target, when python_optional_imports is set to tag.
+const optionalImportTagPrefix = "optional_import="
+
+// importErrors are the exceptions raised when an import fails.
+var importErrors = map[string]bool{
+	"ImportError":         true,
+	"ModuleNotFoundError": true,
+}
+
+// catchesImportError returns true if the given node is a `try:` statement with
+// an except clause catching ImportError, ModuleNotFoundError, or any exception.
+// The imports in its body are optional.
+func (p *FileParser) catchesImportError(node *sitter.Node) bool {
+	if node.Type() != sitterNodeTypeTryStatement {
+		return false
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		clause := node.NamedChild(i)
+		if clause.Type() != sitterNodeTypeExceptClause {
+			continue
+		}
+		caught := clause.NamedChild(0)
+		if caught == nil || caught.Type() == sitterNodeTypeBlock {
+			// A bare `except:` catches everything.
+			return true
+		}
+		if caught.Type() == sitterNodeTypeAsPattern {
+			// `except ImportError as e:`
+			caught = caught.NamedChild(0)
+		}
+		switch caught.Type() {
+		case sitterNodeTypeIdentifier:
+			if importErrors[caught.Content(p.code)] {
+				return true
+			}
+		case sitterNodeTypeTuple:
+			for j := 0; j < int(caught.NamedChildCount()); j++ {
+				if importErrors[caught.NamedChild(j).Content(p.code)] {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// addOptionalImportTargets records the targets generated in the package when
+// python_optional_imports is set to tag, to tag them with their optional
+// imports once they're resolved.
+func (py *Python) addOptionalImportTargets(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if cfg.OptionalImportsMode() != pythonconfig.OptionalImportsModeTag {
+		return
+	}
+	py.optionalImportTargets = addTaggedTargets(py.optionalImportTargets, args, gen)
+}
+
+// addOptionalImport records that the target from optionally imports the
+// given module.
+func (py *Resolver) addOptionalImport(from label.Label, module string) {
+	if py.optionalImports == nil {
+		py.optionalImports = make(map[string]map[string]bool)
+	}
+	if py.optionalImports[from.String()] == nil {
+		py.optionalImports[from.String()] = make(map[string]bool)
+	}
+	py.optionalImports[from.String()][module] = true
+}
+
+// applyOptionalImportTags tags the recorded targets with their optional
+// imports, removing the stale tags of the targets without any.
+func (py *Python) applyOptionalImportTags() {
+	for target, r := range py.optionalImportTargets {
+		modules := make([]string, 0, len(py.optionalImports[target]))
+		for module := range py.optionalImports[target] {
+			modules = append(modules, module)
+		}
+		sort.Strings(modules)
+		setPrefixedTags(r, optionalImportTagPrefix, modules)
+	}
+}
@@ -0,0 +1,462 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	sitter "github.com/smacker/go-tree-sitter"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// packageDataKey is the private attribute of the generated rules holding the
+// package data files read by their sources, see python_package_data.
+const packageDataKey = "_gazelle_python_package_data"
+
+const (
+	sitterNodeTypeArgumentList   = "argument_list"
+	sitterNodeTypeBinaryOperator = "binary_operator"
+)
+
+// PackageResource is a package data file read by a Python file with
+// importlib.resources or pkgutil.get_data, e.g.
+// `importlib.resources.files("mypkg").joinpath("schema.json")`.
+type PackageResource struct {
+	// The module of the package holding the file, e.g. "mypkg", or empty for
+	// the package of the reading file, e.g. with `files(__package__)`.
+	Package string `json:"package,omitempty"`
+	// The slash-separated path of the file relative to the package.
+	Path string `json:"path"`
+	// The line number where the file is read.
+	LineNumber uint32 `json:"lineno"`
+	// The path to the reading file relative to the Bazel workspace root.
+	Filepath string `json:"filepath"`
+}
+
+// resourceModules are the modules providing the importlib.resources functions.
+var resourceModules = []string{"importlib.resources", "importlib_resources", "resources"}
+
+// resourceFunctions are the importlib.resources functions taking the package
+// as first argument. The bare names are recognized too, as imported with
+// `from importlib.resources import files`, except for the ambiguous path.
+var resourceFunctions = map[string]bool{
+	"files":       true,
+	"open_binary": true,
+	"open_text":   true,
+	"path":        true,
+	"read_binary": true,
+	"read_text":   true,
+}
+
+// resourceFunction returns the importlib.resources function, or get_data for
+// pkgutil.get_data, called by name, e.g. "files" for
+// "importlib.resources.files".
+func resourceFunction(name string) (string, bool) {
+	if name == "pkgutil.get_data" || name == "get_data" {
+		return "get_data", true
+	}
+	for _, module := range resourceModules {
+		if function := strings.TrimPrefix(name, module+"."); function != name && resourceFunctions[function] {
+			return function, true
+		}
+	}
+	return name, resourceFunctions[name] && name != "path"
+}
+
+// openFunctions are the functions opening a file by path, relative to the
+// package of the reading file for the data files.
+var openFunctions = map[string]bool{
+	"builtins.open": true,
+	"io.open":       true,
+	"open":          true,
+}
+
+// filePathFunctions are the functions returning the path of the file given
+// as their only argument, e.g. `Path(__file__)`.
+var filePathFunctions = map[string]bool{
+	"Path":             true,
+	"os.path.abspath":  true,
+	"os.path.realpath": true,
+	"pathlib.Path":     true,
+}
+
+// parsePackageResource records the package data file read by the expression,
+// if any, in FileParser.output.PackageData. It returns true if the node is
+// such an expression, whose children don't need to be parsed.
+func (p *FileParser) parsePackageResource(node *sitter.Node) bool {
+	if node.Type() != sitterNodeTypeCall && node.Type() != sitterNodeTypeBinaryOperator {
+		return false
+	}
+	if p.isWritingOpen(node) {
+		// The files written aren't data, whatever the path they're opened by.
+		return true
+	}
+	pkg, parts, ok := p.resourcePath(node)
+	if !ok || len(parts) == 0 {
+		return false
+	}
+	resourcePath := path.Clean(path.Join(parts...))
+	if path.IsAbs(resourcePath) || resourcePath == ".." || strings.HasPrefix(resourcePath, "../") {
+		return false
+	}
+	p.output.PackageData = append(p.output.PackageData, PackageResource{
+		Package:    pkg,
+		Path:       resourcePath,
+		LineNumber: node.StartPoint().Row + 1,
+		Filepath:   p.relFilepath,
+	})
+	return true
+}
+
+// resourcePath returns the package and the path components of the package
+// data file the expression refers to, e.g. "mypkg" and ["data", "a.json"] for
+// `files("mypkg").joinpath("data") / "a.json"` or
+// `pkgutil.get_data("mypkg", "data/a.json")`. The paths relative to the
+// reading file, e.g. `Path(__file__).parent / "a.json"` or `open("a.json")`,
+// are in its package. Only string literals are understood.
+func (p *FileParser) resourcePath(node *sitter.Node) (string, []string, bool) {
+	switch node.Type() {
+	case sitterNodeTypeAttribute:
+		// The directory of the file, e.g. `Path(__file__).parent`.
+		if node.ChildByFieldName("attribute").Content(p.code) == "parent" && p.isFilePath(node.ChildByFieldName("object")) {
+			return "", nil, true
+		}
+	case sitterNodeTypeBinaryOperator:
+		if node.ChildByFieldName("operator").Content(p.code) != "/" {
+			return "", nil, false
+		}
+		pkg, parts, ok := p.resourcePath(node.ChildByFieldName("left"))
+		if !ok {
+			return "", nil, false
+		}
+		part, ok := p.stringValue(node.ChildByFieldName("right"))
+		if !ok {
+			return "", nil, false
+		}
+		return pkg, append(parts, part), true
+	case sitterNodeTypeCall:
+		function := node.ChildByFieldName("function")
+		arguments := node.ChildByFieldName("arguments")
+		if arguments == nil || arguments.Type() != sitterNodeTypeArgumentList {
+			return "", nil, false
+		}
+		if function.Type() == sitterNodeTypeAttribute && function.ChildByFieldName("attribute").Content(p.code) == "joinpath" {
+			pkg, parts, ok := p.resourcePath(function.ChildByFieldName("object"))
+			if !ok {
+				return "", nil, false
+			}
+			more, ok := p.stringArguments(arguments, 0)
+			if !ok {
+				return "", nil, false
+			}
+			return pkg, append(parts, more...), true
+		}
+		if function.Type() == sitterNodeTypeAttribute && function.ChildByFieldName("attribute").Content(p.code) == "with_name" {
+			// A sibling of the file, e.g. `Path(__file__).with_name("a.json")`.
+			parts, ok := p.stringArguments(arguments, 0)
+			return "", parts, ok && len(parts) == 1 && p.isFilePath(function.ChildByFieldName("object"))
+		}
+		functionName := strings.Join(strings.Fields(function.Content(p.code)), "")
+		switch {
+		case openFunctions[functionName]:
+			file := arguments.NamedChild(0)
+			if file == nil || file.Type() == sitterNodeTypeKeywordArgument {
+				return "", nil, false
+			}
+			if part, ok := p.stringValue(file); ok {
+				return "", []string{part}, true
+			}
+			return p.resourcePath(file)
+		case functionName == "os.path.dirname":
+			// The directory of the file, e.g. `os.path.dirname(__file__)`.
+			return "", nil, arguments.NamedChildCount() == 1 && p.isFilePath(arguments.NamedChild(0))
+		case functionName == "os.path.join":
+			if arguments.NamedChildCount() == 0 {
+				return "", nil, false
+			}
+			pkg, parts, ok := p.resourcePath(arguments.NamedChild(0))
+			if !ok {
+				return "", nil, false
+			}
+			more, ok := p.stringArguments(arguments, 1)
+			if !ok {
+				return "", nil, false
+			}
+			return pkg, append(parts, more...), true
+		}
+		name, ok := resourceFunction(functionName)
+		if !ok {
+			return "", nil, false
+		}
+		pkg, ok := p.resourceAnchor(arguments.NamedChild(0))
+		if !ok {
+			return "", nil, false
+		}
+		if name == "files" {
+			// The files are joined to the traversable returned by files().
+			return pkg, nil, arguments.NamedChildCount() <= 1
+		}
+		parts, ok := p.stringArguments(arguments, 1)
+		if !ok {
+			return "", nil, false
+		}
+		return pkg, parts, true
+	}
+	return "", nil, false
+}
+
+// isFilePath returns whether the expression is the path of the reading file,
+// e.g. `__file__` or `Path(__file__).resolve()`.
+func (p *FileParser) isFilePath(node *sitter.Node) bool {
+	if node == nil {
+		return false
+	}
+	switch node.Type() {
+	case sitterNodeTypeIdentifier:
+		return node.Content(p.code) == "__file__"
+	case sitterNodeTypeCall:
+		function := node.ChildByFieldName("function")
+		arguments := node.ChildByFieldName("arguments")
+		if arguments == nil || arguments.Type() != sitterNodeTypeArgumentList {
+			return false
+		}
+		if function.Type() == sitterNodeTypeAttribute && arguments.NamedChildCount() == 0 {
+			switch function.ChildByFieldName("attribute").Content(p.code) {
+			case "absolute", "resolve":
+				return p.isFilePath(function.ChildByFieldName("object"))
+			}
+			return false
+		}
+		name := strings.Join(strings.Fields(function.Content(p.code)), "")
+		return filePathFunctions[name] && arguments.NamedChildCount() == 1 && p.isFilePath(arguments.NamedChild(0))
+	}
+	return false
+}
+
+// isWritingOpen returns whether the expression opens a file for writing,
+// e.g. `open("out.txt", "w")`.
+func (p *FileParser) isWritingOpen(node *sitter.Node) bool {
+	if node.Type() != sitterNodeTypeCall || !openFunctions[strings.Join(strings.Fields(node.ChildByFieldName("function").Content(p.code)), "")] {
+		return false
+	}
+	arguments := node.ChildByFieldName("arguments")
+	if arguments == nil || arguments.Type() != sitterNodeTypeArgumentList {
+		return false
+	}
+	var mode *sitter.Node
+	for i := 0; i < int(arguments.NamedChildCount()); i++ {
+		arg := arguments.NamedChild(i)
+		if arg.Type() != sitterNodeTypeKeywordArgument {
+			if i == 1 {
+				mode = arg
+			}
+			continue
+		}
+		if arg.ChildByFieldName("name").Content(p.code) == "mode" {
+			mode = arg.ChildByFieldName("value")
+		}
+	}
+	value, ok := p.stringValue(mode)
+	return ok && strings.ContainsAny(value, "wax")
+}
+
+// resourceAnchor returns the package given as first argument of the
+// importlib.resources functions: the module of a string literal, or empty for
+// the package of the file itself, with `__package__`, `__name__` or without
+// argument.
+func (p *FileParser) resourceAnchor(node *sitter.Node) (string, bool) {
+	if node == nil {
+		return "", true
+	}
+	if node.Type() == sitterNodeTypeIdentifier {
+		switch node.Content(p.code) {
+		case "__package__", "__name__":
+			return "", true
+		}
+		return "", false
+	}
+	return p.stringValue(node)
+}
+
+// stringArguments returns the values of the arguments following the first
+// skip ones, which must all be string literals.
+func (p *FileParser) stringArguments(arguments *sitter.Node, skip int) ([]string, bool) {
+	var values []string
+	for i := skip; i < int(arguments.NamedChildCount()); i++ {
+		value, ok := p.stringValue(arguments.NamedChild(i))
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+// parsePackageData parses the value of the python_package_data directive,
+// e.g. "files" or "target package_data". It returns the mode and the name of
+// the target added by PackageDataModeTarget.
+func parsePackageData(value string) (pythonconfig.PackageDataModeType, string, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", "", fmt.Errorf("expected one of none, files or target NAME, got %q", value)
+	}
+	switch mode := pythonconfig.PackageDataModeType(fields[0]); mode {
+	case pythonconfig.PackageDataModeNone, pythonconfig.PackageDataModeFiles:
+		if len(fields) == 1 {
+			return mode, "", nil
+		}
+	case pythonconfig.PackageDataModeTarget:
+		if len(fields) == 2 {
+			if _, err := label.Parse(":" + fields[1]); err != nil {
+				return "", "", fmt.Errorf("invalid target name %q: %v", fields[1], err)
+			}
+			return mode, fields[1], nil
+		}
+	}
+	return "", "", fmt.Errorf("expected one of none, files or target NAME, got %q", value)
+}
+
+// addPackageDataTargets records the targets generated in the package when
+// python_package_data applies to it, to add their package data files once
+// they're resolved.
+func (py *Python) addPackageDataTargets(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if len(gen) > 0 {
+		if py.generatedPackages == nil {
+			py.generatedPackages = make(map[string]bool)
+		}
+		py.generatedPackages[args.Rel] = true
+	}
+	if cfg.PackageDataMode() == pythonconfig.PackageDataModeNone {
+		return
+	}
+	py.packageDataTargets = addTaggedTargets(py.packageDataTargets, args, gen)
+}
+
+// addPackageData records the labels of the package data files read by the
+// sources of the rule r, generated as the target from, that exist in the
+// repository. The packages are looked up in the Python project of the
+// target.
+func (py *Resolver) addPackageData(c *config.Config, cfg *pythonconfig.Config, r *rule.Rule, from label.Label) {
+	if cfg.PackageDataMode() == pythonconfig.PackageDataModeNone {
+		return
+	}
+	resources, _ := r.PrivateAttr(packageDataKey).([]PackageResource)
+	for _, resource := range resources {
+		dir := filepath.Dir(resource.Filepath)
+		if resource.Package != "" {
+			dir = filepath.Join(cfg.PythonProjectRoot(), strings.ReplaceAll(resource.Package, ".", string(filepath.Separator)))
+		}
+		rel := filepath.Join(dir, filepath.FromSlash(resource.Path))
+		info, err := os.Stat(filepath.Join(c.RepoRoot, rel))
+		if err != nil || (info.IsDir() && cfg.PackageDataMode() == pythonconfig.PackageDataModeFiles) {
+			continue
+		}
+		pkg := py.bazelPackage(c, filepath.Dir(rel))
+		var data string
+		if cfg.PackageDataMode() == pythonconfig.PackageDataModeTarget {
+			data = label.New("", pkg, cfg.PackageDataTarget()).Rel(from.Repo, from.Pkg).String()
+		} else {
+			name, _ := filepath.Rel(filepath.FromSlash(pkg), rel)
+			data = label.New("", pkg, filepath.ToSlash(name)).Rel(from.Repo, from.Pkg).String()
+			// The files of the package are listed by name, like the srcs.
+			data = strings.TrimPrefix(data, ":")
+		}
+		if py.packageData == nil {
+			py.packageData = make(map[string]map[string]bool)
+		}
+		if py.packageData[from.String()] == nil {
+			py.packageData[from.String()] = make(map[string]bool)
+		}
+		py.packageData[from.String()][data] = true
+	}
+}
+
+// bazelPackage returns the Bazel package owning the directory dir, relative
+// to the repository root: the closest directory with a BUILD file, or where
+// Gazelle generates one.
+func (py *Resolver) bazelPackage(c *config.Config, dir string) string {
+	for {
+		pkg := filepath.ToSlash(dir)
+		if pkg == "." {
+			pkg = ""
+		}
+		if py.generatedPackages[pkg] {
+			return pkg
+		}
+		for _, name := range c.ValidBuildFileNames {
+			if info, err := os.Stat(filepath.Join(c.RepoRoot, dir, name)); err == nil && !info.IsDir() {
+				return pkg
+			}
+		}
+		if pkg == "" {
+			return ""
+		}
+		dir = filepath.Dir(dir)
+	}
+}
+
+// applyPackageData adds the package data files read by the recorded targets
+// to their data attribute, keeping the files already listed. The data that
+// isn't a plain list of strings, or that is marked with a "# keep" comment,
+// is left untouched.
+func (py *Python) applyPackageData() {
+	for target, r := range py.packageDataTargets {
+		if len(py.packageData[target]) == 0 || attrShouldKeep(r, "data") {
+			continue
+		}
+		if expr := r.Attr("data"); expr != nil {
+			list, ok := expr.(*bzl.ListExpr)
+			if !ok || hasKeptValue(list) {
+				continue
+			}
+			plain := true
+			for _, elem := range list.List {
+				if _, ok := elem.(*bzl.StringExpr); !ok {
+					plain = false
+				}
+			}
+			if !plain {
+				continue
+			}
+		}
+		current := r.AttrStrings("data")
+		listed := make(map[string]bool, len(current))
+		for _, data := range current {
+			listed[data] = true
+		}
+		var added []string
+		for data := range py.packageData[target] {
+			if !listed[data] {
+				added = append(added, data)
+			}
+		}
+		if len(added) == 0 {
+			continue
+		}
+		sort.Strings(added)
+		r.SetAttr("data", append(current, added...))
+	}
+}
@@ -37,6 +37,18 @@ type python3Parser struct {
 	// The function that determines if a dependency is ignored from a Gazelle
 	// directive. It's the signature of pythonconfig.Config.IgnoresDependency.
 	ignoresDependency func(dep string) bool
+	// Whether the forward references of the string annotations are resolved,
+	// see pythonconfig.ResolveStringAnnotations.
+	resolveStringAnnotations bool
+	// The cache of the parsing of the files, see -python_cache_file. It may be
+	// nil.
+	cache *resolutionCache
+	// Whether the files with a Python shebang line are main modules, see
+	// pythonconfig.ShebangBinaries.
+	shebangBinaries bool
+	// The function that determines if a file is a main module by its name.
+	// It's the signature of pythonconfig.Config.IsBinaryEntrypoint.
+	isBinaryEntrypoint func(file string) bool
 }
 
 // newPython3Parser constructs a new python3Parser.
@@ -44,11 +56,19 @@ func newPython3Parser(
 	repoRoot string,
 	relPackagePath string,
 	ignoresDependency func(dep string) bool,
+	resolveStringAnnotations bool,
+	cache *resolutionCache,
+	shebangBinaries bool,
+	isBinaryEntrypoint func(file string) bool,
 ) *python3Parser {
 	return &python3Parser{
-		repoRoot:          repoRoot,
-		relPackagePath:    relPackagePath,
-		ignoresDependency: ignoresDependency,
+		repoRoot:                 repoRoot,
+		relPackagePath:           relPackagePath,
+		ignoresDependency:        ignoresDependency,
+		resolveStringAnnotations: resolveStringAnnotations,
+		cache:                    cache,
+		shebangBinaries:          shebangBinaries,
+		isBinaryEntrypoint:       isBinaryEntrypoint,
 	}
 }
 
@@ -75,7 +95,9 @@ func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, map[strin
 				defer func() {
 					<-ch
 				}()
-				res, err := NewFileParser().ParseFile(ctx, p.repoRoot, p.relPackagePath, filename)
+				fileParser := NewFileParser()
+				fileParser.resolveStringAnnotations = p.resolveStringAnnotations
+				res, err := p.cache.parseFile(ctx, fileParser, p.repoRoot, p.relPackagePath, filename)
 				if err != nil {
 					return err
 				}
@@ -93,7 +115,8 @@ func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, map[strin
 	allAnnotations := new(annotations)
 	allAnnotations.ignore = make(map[string]struct{})
 	for res := range chRes {
-		if res.HasMain {
+		isMain := res.HasMain || (p.shebangBinaries && res.HasShebang) || p.isBinaryEntrypoint(res.FileName)
+		if isMain {
 			mainModules[res.FileName] = treeset.NewWith(moduleComparator)
 		}
 		annotations, err := annotationsFromComments(res.Comments)
@@ -115,7 +138,7 @@ func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, map[strin
 			}
 
 			addModuleToTreeSet(modules, m)
-			if res.HasMain {
+			if isMain {
 				addModuleToTreeSet(mainModules[res.FileName], m)
 			}
 		}
@@ -126,9 +149,17 @@ func (p *python3Parser) parse(pyFilenames *treeset.Set) (*treeset.Set, map[strin
 		}
 		allAnnotations.includeDeps = append(allAnnotations.includeDeps, annotations.includeDeps...)
 		allAnnotations.includePytestConftest = annotations.includePytestConftest
+		allAnnotations.packageData = append(allAnnotations.packageData, res.PackageData...)
+		allAnnotations.noDepsOrder = allAnnotations.noDepsOrder || annotations.noDepsOrder
+		allAnnotations.pytestMarkers = append(allAnnotations.pytestMarkers, res.PytestMarkers...)
+		allAnnotations.testCases += res.TestCases
+		if res.HasDoctests {
+			allAnnotations.doctestFiles = append(allAnnotations.doctestFiles, res.FileName)
+		}
 	}
 
 	allAnnotations.includeDeps = removeDupesFromStringTreeSetSlice(allAnnotations.includeDeps)
+	allAnnotations.pytestMarkers = removeDupesFromStringTreeSetSlice(allAnnotations.pytestMarkers)
 
 	return modules, mainModules, allAnnotations, nil
 }
@@ -163,6 +194,17 @@ type Module struct {
 	From string `json:"from"`
 	// Whether this import is type-checking only (inside if TYPE_CHECKING block).
 	TypeCheckingOnly bool `json:"type_checking_only"`
+	// The operating systems on which this import happens, if it's guarded by a
+	// sys.platform check, e.g. ["windows"] for `if sys.platform == "win32":`.
+	Platforms []string `json:"platforms,omitempty"`
+	// Whether this import is optional, i.e. in the body of a `try:` statement
+	// catching ImportError.
+	Optional bool `json:"optional"`
+	// Whether this is a dotted name found in a string annotation, e.g.
+	// `x: "mypkg.models.User"`, rather than an import. It may be a local
+	// name, e.g. an alias of an imported module, so it's never reported as
+	// unresolved.
+	ForwardReference bool `json:"forward_reference,omitempty"`
 }
 
 // moduleComparator compares modules by name.
@@ -171,11 +213,29 @@ func moduleComparator(a, b interface{}) int {
 }
 
 // addModuleToTreeSet adds a module to a treeset.Set, ensuring that a TypeCheckingOnly=false module is
-// prefered over a TypeCheckingOnly=true module.
+// prefered over a TypeCheckingOnly=true module, that a required module is prefered over an optional
+// one, and that a module imported on all platforms is prefered over a module imported on some
+// platforms only.
 func addModuleToTreeSet(set *treeset.Set, mod Module) {
 	if mod.TypeCheckingOnly && set.Contains(mod) {
 		return
 	}
+	if mod.Optional || len(mod.Platforms) > 0 {
+		_, value := set.Find(func(_ int, value interface{}) bool {
+			return value.(Module).Name == mod.Name
+		})
+		if existing, ok := value.(Module); ok && !existing.TypeCheckingOnly {
+			switch {
+			case mod.Optional && !existing.Optional:
+				return
+			case mod.Optional != existing.Optional || len(mod.Platforms) == 0:
+			case len(existing.Platforms) == 0:
+				return
+			default:
+				mod.Platforms = unionPlatforms(existing.Platforms, mod.Platforms)
+			}
+		}
+	}
 	set.Add(mod)
 }
 
@@ -192,6 +252,20 @@ const (
 	// Eg: '# gazelle:include_dep //foo/bar:baz,@repo//:target
 	annotationKindIncludeDep            annotationKind = "include_dep"
 	annotationKindIncludePytestConftest annotationKind = "include_pytest_conftest"
+	// Resolve the imports of a statement to `pyi_deps`, as if they were in a
+	// TYPE_CHECKING block. It takes no value and must trail the statement.
+	// Eg: 'import foo  # gazelle:typing-only'
+	annotationKindTypingOnly annotationKind = "typing-only"
+	// Skip the dependencies of the imports of a statement, e.g. a single
+	// conditional import. It takes no value and must trail the statement.
+	// Eg: 'import foo  # gazelle:no-dep'
+	annotationKindNoDep annotationKind = "no-dep"
+	// Exempt the target of the file from the deps order, leaving its
+	// violations out of deps_to_remove. It takes no value, and applies to the
+	// whole target in the package generation mode. It's also recognized right
+	// above a rule in a BUILD file.
+	// Eg: '# gazelle:no_deps_order'
+	annotationKindNoDepsOrder annotationKind = "no_deps_order"
 )
 
 // Comment represents a Python comment.
@@ -205,6 +279,10 @@ func (c *Comment) asAnnotation() (*annotation, error) {
 		return nil, nil
 	}
 	withoutPrefix := strings.TrimPrefix(uncomment, annotationPrefix)
+	switch kind := annotationKind(strings.TrimSpace(withoutPrefix)); kind {
+	case annotationKindTypingOnly, annotationKindNoDep, annotationKindNoDepsOrder:
+		return &annotation{kind: kind}, nil
+	}
 	annotationParts := strings.SplitN(withoutPrefix, " ", 2)
 	if len(annotationParts) < 2 {
 		return nil, fmt.Errorf("`%s` requires a value", *c)
@@ -233,6 +311,20 @@ type annotations struct {
 	// python test file, should be added to the py_test target's `deps` attribute.
 	// A *bool is used so that we can handle the "not set" state.
 	includePytestConftest *bool
+	// The package data files read by the parsed files, see
+	// pythonconfig.PackageData.
+	packageData []PackageResource
+	// Whether the target is exempted from the deps order, see
+	// annotationKindNoDepsOrder.
+	noDepsOrder bool
+	// The pytest markers applied to the tests of the parsed files, see
+	// pythonconfig.PytestMarker.
+	pytestMarkers []string
+	// The estimated number of test cases of the parsed files, see
+	// pythonconfig.TestShardCases.
+	testCases int
+	// The parsed files with doctests, see pythonconfig.GenerateDoctests.
+	doctestFiles []string
 }
 
 // annotationsFromComments returns all the annotations parsed out of the
@@ -241,6 +333,7 @@ func annotationsFromComments(comments []Comment) (*annotations, error) {
 	ignore := make(map[string]struct{})
 	includeDeps := []string{}
 	var includePytestConftest *bool
+	noDepsOrder := false
 	for _, comment := range comments {
 		annotation, err := comment.asAnnotation()
 		if err != nil {
@@ -276,12 +369,21 @@ func annotationsFromComments(comments []Comment) (*annotations, error) {
 				}
 				includePytestConftest = &parsedVal
 			}
+			if annotation.kind == annotationKindNoDepsOrder {
+				noDepsOrder = true
+			}
+			if annotation.kind == annotationKindTypingOnly || annotation.kind == annotationKindNoDep {
+				// The annotations trailing import statements are consumed by
+				// the file parser.
+				log.Printf("WARNING: %q only applies to the import statement it trails. Ignoring annotation", comment)
+			}
 		}
 	}
 	return &annotations{
 		ignore:                ignore,
 		includeDeps:           includeDeps,
 		includePytestConftest: includePytestConftest,
+		noDepsOrder:           noDepsOrder,
 	}, nil
 }
 
@@ -0,0 +1,114 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// groupPerFileCycles groups the files of a package that import each other in
+// a cycle, so that each group can be generated as a single target in the
+// "file" generation mode. Files that are not part of a cycle are in a group of
+// their own. The groups are sorted by their first file.
+func groupPerFileCycles(
+	parser *python3Parser,
+	cfg *pythonconfig.Config,
+	bzlPackage string,
+	filenames *treeset.Set,
+) ([]*treeset.Set, error) {
+	// Map the modules of the package to the files providing them, the same way
+	// they are indexed and resolved.
+	moduleFiles := make(map[string]string, filenames.Size())
+	siblingFiles := make(map[string]string, filenames.Size())
+	for _, v := range filenames.Values() {
+		filename := v.(string)
+		moduleFiles[importSpecFromSrc(cfg.PythonProjectRoot(), bzlPackage, filename).Imp] = filename
+		if filename != pyLibraryEntrypointFilename {
+			siblingFiles[strings.TrimSuffix(filename, ".py")] = filename
+		}
+	}
+
+	var graph importGraph
+	for _, v := range filenames.Values() {
+		filename := v.(string)
+		modules, _, _, err := parser.parseSingle(filename)
+		if err != nil {
+			return nil, err
+		}
+		it := modules.Iterator()
+		for it.Next() {
+			mod := it.Value().(Module)
+			if dep, ok := siblingModuleFile(cfg, mod, moduleFiles, siblingFiles); ok && dep != filename {
+				graph.addEdge(filename, dep, mod)
+			}
+		}
+	}
+
+	grouped := make(map[string]bool)
+	var groups []*treeset.Set
+	for _, component := range graph.stronglyConnectedComponents() {
+		group := treeset.NewWith(godsutils.StringComparator)
+		for _, filename := range component {
+			group.Add(filename)
+			grouped[filename] = true
+		}
+		groups = append(groups, group)
+	}
+	for _, v := range filenames.Values() {
+		if filename := v.(string); !grouped[filename] {
+			groups = append(groups, treeset.NewWith(godsutils.StringComparator, filename))
+		}
+	}
+	sort.Slice(groups, func(i, j int) bool {
+		return groups[i].Values()[0].(string) < groups[j].Values()[0].(string)
+	})
+	return groups, nil
+}
+
+// siblingModuleFile returns the file of the package providing the imported
+// module, if any.
+func siblingModuleFile(
+	cfg *pythonconfig.Config,
+	mod Module,
+	moduleFiles map[string]string,
+	siblingFiles map[string]string,
+) (string, bool) {
+	if strings.HasPrefix(mod.From, ".") {
+		// Only relative imports of siblings, e.g. `from .foo import bar`, can
+		// target a file of the same package.
+		if !cfg.ExperimentalAllowRelativeImports() || strings.HasPrefix(mod.From, "..") {
+			return "", false
+		}
+		filename, ok := siblingFiles[strings.Split(strings.TrimPrefix(mod.From, "."), ".")[0]]
+		return filename, ok
+	}
+	moduleParts := strings.Split(mod.Name, ".")
+	for i := len(moduleParts); i > 0; i-- {
+		if filename, ok := moduleFiles[strings.Join(moduleParts[:i], ".")]; ok {
+			return filename, true
+		}
+	}
+	if cfg.ResolveSiblingImports() {
+		filename, ok := siblingFiles[moduleParts[0]]
+		return filename, ok
+	}
+	return "", false
+}
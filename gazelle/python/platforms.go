@@ -0,0 +1,277 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"slices"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	sitter "github.com/smacker/go-tree-sitter"
+)
+
+const (
+	// platformConstraintPrefix is the prefix of the constraint labels used as
+	// keys of the select() for platform-conditional dependencies.
+	platformConstraintPrefix = "@platforms//os:"
+	// defaultCondition is the key of the default branch of a select().
+	defaultCondition = "//conditions:default"
+)
+
+// sysPlatformOSes maps the values of sys.platform to the names of the
+// @platforms//os constraints. The BSDs append their major version to
+// sys.platform, e.g. "freebsd14", which is stripped before the lookup.
+var sysPlatformOSes = map[string]string{
+	"aix":     "aix",
+	"android": "android",
+	"cygwin":  "windows",
+	"darwin":  "osx",
+	"freebsd": "freebsd",
+	"ios":     "ios",
+	"linux":   "linux",
+	"netbsd":  "netbsd",
+	"openbsd": "openbsd",
+	"win32":   "windows",
+}
+
+// platformsOfCondition returns the operating systems on which the condition of
+// an if statement can be true, when the condition only checks sys.platform.
+// The supported conditions are:
+//
+//	sys.platform == "win32"
+//	sys.platform in ("linux", "darwin")
+//	sys.platform.startswith("freebsd")
+//	sys.platform.startswith(("linux", "darwin"))
+//
+// It returns nil for any other condition, or if any of the values isn't known.
+func (p *FileParser) platformsOfCondition(node *sitter.Node) []string {
+	if node == nil {
+		return nil
+	}
+	switch node.Type() {
+	case sitterNodeTypeComparisonOperator:
+		if node.ChildCount() != 3 {
+			return nil
+		}
+		a, b := node.Child(0), node.Child(2)
+		switch node.Child(1).Type() {
+		case "==":
+			// Convert "'win32' == sys.platform" to "sys.platform == 'win32'".
+			if p.isSysPlatform(b) {
+				a, b = b, a
+			}
+			if !p.isSysPlatform(a) {
+				return nil
+			}
+			value, ok := p.stringValue(b)
+			if !ok {
+				return nil
+			}
+			return platformsOfSysPlatforms([]string{value})
+		case "in":
+			if !p.isSysPlatform(a) {
+				return nil
+			}
+			values, ok := p.stringValues(b)
+			if !ok {
+				return nil
+			}
+			return platformsOfSysPlatforms(values)
+		}
+	case sitterNodeTypeCall:
+		function := node.ChildByFieldName("function")
+		if function == nil || function.Type() != sitterNodeTypeAttribute ||
+			!p.isSysPlatform(function.ChildByFieldName("object")) ||
+			function.ChildByFieldName("attribute").Content(p.code) != "startswith" {
+			return nil
+		}
+		arguments := node.ChildByFieldName("arguments")
+		if arguments == nil || arguments.NamedChildCount() != 1 {
+			return nil
+		}
+		prefixes, ok := p.stringValues(arguments.NamedChild(0))
+		if !ok {
+			if prefix, ok := p.stringValue(arguments.NamedChild(0)); ok {
+				prefixes = []string{prefix}
+			}
+		}
+		var values []string
+		for _, prefix := range prefixes {
+			if prefix == "" {
+				return nil
+			}
+			for value := range sysPlatformOSes {
+				if strings.HasPrefix(value, prefix) {
+					values = append(values, value)
+				}
+			}
+		}
+		return platformsOfSysPlatforms(values)
+	}
+	return nil
+}
+
+// isSysPlatform returns true if the node is the expression `sys.platform`.
+func (p *FileParser) isSysPlatform(node *sitter.Node) bool {
+	return node != nil && node.Type() == sitterNodeTypeAttribute && node.Content(p.code) == "sys.platform"
+}
+
+// stringValue returns the value of a string literal.
+func (p *FileParser) stringValue(node *sitter.Node) (string, bool) {
+	if node == nil || node.Type() != sitterNodeTypeString {
+		return "", false
+	}
+	return strings.Trim(node.Content(p.code), `"'`), true
+}
+
+// stringValues returns the values of a tuple or list of string literals.
+func (p *FileParser) stringValues(node *sitter.Node) ([]string, bool) {
+	if node == nil || (node.Type() != sitterNodeTypeTuple && node.Type() != sitterNodeTypeList) {
+		return nil, false
+	}
+	values := make([]string, 0, node.NamedChildCount())
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		value, ok := p.stringValue(node.NamedChild(i))
+		if !ok {
+			return nil, false
+		}
+		values = append(values, value)
+	}
+	return values, true
+}
+
+// platformsOfSysPlatforms returns the sorted operating systems matching the
+// given values of sys.platform, or nil if any of them isn't known.
+func platformsOfSysPlatforms(values []string) []string {
+	if len(values) == 0 {
+		return nil
+	}
+	platforms := make([]string, 0, len(values))
+	for _, value := range values {
+		os, ok := sysPlatformOSes[value]
+		if !ok {
+			os, ok = sysPlatformOSes[strings.TrimRight(value, "0123456789")]
+		}
+		if !ok {
+			return nil
+		}
+		platforms = append(platforms, os)
+	}
+	return sortedPlatforms(platforms)
+}
+
+// intersectPlatforms returns the platforms of an import guarded by the
+// platform checks outer and inner, where outer is nil when there is no outer
+// check. Contradictory checks fall back to the inner one.
+func intersectPlatforms(outer, inner []string) []string {
+	if outer == nil {
+		return inner
+	}
+	var platforms []string
+	for _, platform := range inner {
+		if slices.Contains(outer, platform) {
+			platforms = append(platforms, platform)
+		}
+	}
+	if len(platforms) == 0 {
+		return inner
+	}
+	return platforms
+}
+
+// unionPlatforms returns the platforms of a module imported on both a and b.
+func unionPlatforms(a, b []string) []string {
+	return sortedPlatforms(append(append([]string{}, a...), b...))
+}
+
+// sortedPlatforms sorts and removes the duplicates from platforms.
+func sortedPlatforms(platforms []string) []string {
+	sort.Strings(platforms)
+	unique := platforms[:0]
+	for i, platform := range platforms {
+		if i == 0 || platform != platforms[i-1] {
+			unique = append(unique, platform)
+		}
+	}
+	return unique
+}
+
+// addPlatformDependency adds a dependency that is only needed on the given
+// platforms.
+func addPlatformDependency(dep string, platforms []string, platformDeps map[string]*treeset.Set) {
+	for _, platform := range platforms {
+		set, ok := platformDeps[platform]
+		if !ok {
+			set = treeset.NewWith(godsutils.StringComparator)
+			platformDeps[platform] = set
+		}
+		set.Add(dep)
+	}
+}
+
+// convertPlatformDependenciesToExpr returns the expression for deps, followed
+// by a select() on @platforms//os for the dependencies that are only needed on
+// some platforms. It returns nil when there are no dependencies at all. The
+// elements get the comments of the dependencies in the existing rule.
+func convertPlatformDependenciesToExpr(deps *treeset.Set, platformDeps map[string]*treeset.Set, comments depComments) bzl.Expr {
+	selectValue := make(rule.SelectStringListValue)
+	for platform, set := range platformDeps {
+		var platformDepsList []string
+		it := set.Iterator()
+		for it.Next() {
+			if dep := it.Value().(string); !deps.Contains(dep) {
+				platformDepsList = append(platformDepsList, dep)
+			}
+		}
+		if len(platformDepsList) > 0 {
+			selectValue[platformConstraintPrefix+platform] = platformDepsList
+		}
+	}
+	if len(selectValue) == 0 {
+		if deps.Empty() {
+			return nil
+		}
+		return convertDependencySetToExpr(deps, comments)
+	}
+	selectValue[defaultCondition] = []string{}
+	selectExpr := selectValue.BzlExpr()
+	comments.apply(selectExpr)
+	if deps.Empty() {
+		return selectExpr
+	}
+	return &bzl.BinaryExpr{
+		X:  convertDependencySetToExpr(deps, comments),
+		Op: "+",
+		Y:  selectExpr,
+	}
+}
+
+// allDependencies returns the dependencies of deps and platformDeps.
+func allDependencies(deps *treeset.Set, platformDeps map[string]*treeset.Set) []string {
+	all := treeset.NewWith(godsutils.StringComparator)
+	all.Add(deps.Values()...)
+	for _, set := range platformDeps {
+		all.Add(set.Values()...)
+	}
+	values := make([]string, 0, all.Size())
+	for _, value := range all.Values() {
+		values = append(values, value.(string))
+	}
+	return values
+}
@@ -0,0 +1,465 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"os"
+	"path"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/bmatcuk/doublestar/v4"
+
+	"github.com/bazel-contrib/rules_python/gazelle/manifest"
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// preflightDirectiveRe matches Gazelle directives, the same way Gazelle does
+// when loading BUILD files.
+var preflightDirectiveRe = regexp.MustCompile(`^#\s*gazelle:(\w+)\s*(.*?)\s*$`)
+
+// preflightDirective is a directive found by the preflight phase, alongside
+// its location.
+type preflightDirective struct {
+	key, value string
+	// The path of the BUILD file relative to the repository root.
+	path string
+	// The Bazel package of the BUILD file.
+	pkg  string
+	line int
+}
+
+func (d preflightDirective) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("%s:%d: gazelle:%s: %s", d.path, d.line, d.key, fmt.Sprintf(format, args...))
+}
+
+// preflightConfigureDirective applies the directive d, with the presets of
+// the profiles expanded, to the scratch configuration, see configureDirective.
+func preflightConfigureDirective(c *config.Config, scratch *pythonconfig.Config, d preflightDirective) error {
+	expanded, err := expandProfiles([]rule.Directive{{Key: d.key, Value: d.value}})
+	if err != nil {
+		return err
+	}
+	var deferred deferredDirectives
+	for _, e := range expanded {
+		if err := configureDirective(c, d.pkg, scratch, e, &deferred); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runPreflight validates the configuration of the whole repository before any
+// generation happens. Every BUILD file is scanned for Python directives and
+// all problems found are returned at once, with their locations.
+func runPreflight(c *config.Config) error {
+	walked, errs := walkPreflight(c)
+	directives := walked.directives
+	knownRepos := knownRepositories(c)
+
+	var pythonRoots []preflightDirective
+	manifestFileNames := make(map[string]preflightDirective)
+	// The directives are applied to a scratch configuration by the same code
+	// as in Configure, so that a configuration passing the preflight phase
+	// doesn't fail there. The checks below come on top, e.g. the files the
+	// directives refer to are read.
+	scratch := pythonconfig.New(c.RepoRoot, "")
+	for _, d := range directives {
+		if err := preflightConfigureDirective(c, scratch, d); err != nil {
+			errs = append(errs, d.errorf("%v", err))
+			continue
+		}
+		switch d.key {
+		case pythonconfig.PythonRootDirective:
+			pythonRoots = append(pythonRoots, d)
+		case pythonconfig.PythonManifestFileNameDirective:
+			manifestFileNames[d.pkg] = d
+		case pythonconfig.DepsOrderFile:
+			if _, err := pythonconfig.LoadDepsOrder(filepath.Join(c.RepoRoot, d.pkg, d.value)); err != nil {
+				errs = append(errs, d.errorf("%v", err))
+			}
+		case pythonconfig.ImportWeightsFile:
+			if _, err := pythonconfig.LoadImportWeights(filepath.Join(c.RepoRoot, d.pkg, d.value)); err != nil {
+				errs = append(errs, d.errorf("%v", err))
+			}
+		case pythonconfig.TestTimingsFile:
+			if _, err := pythonconfig.LoadTestTimings(filepath.Join(c.RepoRoot, d.pkg, d.value)); err != nil {
+				errs = append(errs, d.errorf("%v", err))
+			}
+		case pythonconfig.WheelLockFile:
+			if _, err := pythonconfig.LoadWheelLock(filepath.Join(c.RepoRoot, d.pkg, d.value)); err != nil {
+				errs = append(errs, d.errorf("%v", err))
+			}
+		case pythonconfig.PyprojectDependencies:
+			if d.value == "" {
+				continue
+			}
+			if knownRepos != nil {
+				if _, ok := knownRepos[d.value]; !ok {
+					errs = append(errs, d.errorf("repository %q is not declared in the workspace", d.value))
+				}
+			}
+			if _, err := readPyproject(filepath.Join(c.RepoRoot, d.pkg, pyprojectFilename)); err != nil {
+				errs = append(errs, d.errorf("%v", err))
+			}
+		case pythonconfig.ExternalRepository:
+			name, path, _ := parseExternalRepository(d.value)
+			if info, err := os.Stat(externalRepositoryPath(c.RepoRoot, d.pkg, path)); err != nil || !info.IsDir() {
+				errs = append(errs, d.errorf("the checkout %q of the repository %q isn't a directory", path, name))
+			}
+		case "resolve", "resolve_regexp":
+			fields := strings.Fields(d.value)
+			if len(fields) < 3 || fields[0] != languageName {
+				continue
+			}
+			if d.key == "resolve_regexp" {
+				if _, err := regexp.Compile(fields[1]); err != nil {
+					errs = append(errs, d.errorf("invalid regular expression %q: %v", fields[1], err))
+					continue
+				}
+			}
+			l, err := label.Parse(fields[len(fields)-1])
+			if err != nil {
+				errs = append(errs, d.errorf("invalid label %q: %v", fields[len(fields)-1], err))
+				continue
+			}
+			if l.Repo != "" && knownRepos != nil {
+				if _, ok := knownRepos[l.Repo]; !ok {
+					errs = append(errs, d.errorf("repository %q is not declared in the workspace", l.Repo))
+				}
+			}
+		}
+	}
+
+	errs = append(errs, ambiguousPythonRoots(pythonRoots, walked.pyFiles)...)
+
+	// Validate the manifests that are explicitly declared, or that exist with
+	// the default name.
+	for _, rel := range walked.dirs {
+		dir := filepath.Join(c.RepoRoot, filepath.FromSlash(rel))
+		manifestPath := filepath.Join(dir, "gazelle_python.yaml")
+		d, declared := manifestFileNames[rel]
+		if declared {
+			manifestPath = filepath.Join(dir, d.value)
+			if _, err := os.Stat(manifestPath); err != nil {
+				errs = append(errs, d.errorf("manifest %q does not exist", path.Join(rel, d.value)))
+				continue
+			}
+		} else if _, err := os.Stat(manifestPath); err != nil {
+			continue
+		}
+		relManifestPath, _ := filepath.Rel(c.RepoRoot, manifestPath)
+		manifestFile := new(manifest.File)
+		if err := manifestFile.Decode(manifestPath); err != nil {
+			errs = append(errs, fmt.Errorf("%s: %w", relManifestPath, err))
+			continue
+		}
+		if manifestFile.Manifest == nil {
+			errs = append(errs, fmt.Errorf("%s: the manifest is empty", relManifestPath))
+			continue
+		}
+		pipRepository := manifestFile.Manifest.PipDepsRepositoryName
+		if manifestFile.Manifest.PipRepository != nil {
+			pipRepository = manifestFile.Manifest.PipRepository.Name
+		}
+		if pipRepository == "" {
+			errs = append(errs, fmt.Errorf("%s: the manifest doesn't declare a pip repository", relManifestPath))
+		} else if knownRepos != nil {
+			if _, ok := knownRepos[pipRepository]; !ok {
+				errs = append(errs, fmt.Errorf("%s: the pip repository %q is not declared in the workspace", relManifestPath, pipRepository))
+			}
+		}
+		// The integrity hash covers the sources of the manifest generator,
+		// which only Bazel knows about, so the gazelle_python_manifest test
+		// target is what verifies it against the requirements.
+		if manifestFile.Integrity != "" {
+			log.Printf("WARNING: %s: the integrity of the manifest can't be verified by the preflight validation, "+
+				"run the test of its gazelle_python_manifest target to check it against the requirements\n", relManifestPath)
+		}
+	}
+
+	if len(errs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("preflight validation found %d problem(s):\n%w", len(errs), errors.Join(errs...))
+}
+
+// preflightWalk is what the preflight phase finds in the repository.
+type preflightWalk struct {
+	// directives are the Python related directives of the BUILD files, sorted
+	// by location.
+	directives []preflightDirective
+	// dirs are the directories walked, relative to the repository root.
+	dirs []string
+	// pyFiles are the Python files of the directories walked, relative to the
+	// repository root.
+	pyFiles []string
+}
+
+// walkPreflight walks the directories of the repository like Gazelle does:
+// the directories listed in .bazelignore or matching a gazelle:exclude
+// directive are skipped, along with the hidden directories and the Bazel
+// convenience symlinks.
+func walkPreflight(c *config.Config) (preflightWalk, []error) {
+	var walked preflightWalk
+	var errs []error
+	buildFileNames := make(map[string]struct{}, len(c.ValidBuildFileNames))
+	for _, name := range c.ValidBuildFileNames {
+		buildFileNames[name] = struct{}{}
+	}
+	ignoredDirs, err := loadBazelIgnore(c.RepoRoot)
+	if err != nil {
+		errs = append(errs, err)
+	}
+	isExcluded := func(rel string, excludes []string) bool {
+		for _, dir := range ignoredDirs {
+			if rel == dir {
+				return true
+			}
+		}
+		for _, pattern := range excludes {
+			if ok, _ := doublestar.Match(pattern, rel); ok {
+				return true
+			}
+		}
+		return false
+	}
+
+	var walkDir func(rel string, excludes []string)
+	walkDir = func(rel string, excludes []string) {
+		walked.dirs = append(walked.dirs, rel)
+		entries, err := os.ReadDir(filepath.Join(c.RepoRoot, filepath.FromSlash(rel)))
+		if err != nil {
+			errs = append(errs, err)
+			return
+		}
+		// The exclusions of the BUILD file apply to the directory, so it's
+		// read before anything else.
+		excludes = excludes[:len(excludes):len(excludes)]
+		for _, entry := range entries {
+			if _, ok := buildFileNames[entry.Name()]; !ok || entry.IsDir() {
+				continue
+			}
+			directives, err := readPreflightDirectives(c.RepoRoot, path.Join(rel, entry.Name()))
+			if err != nil {
+				errs = append(errs, err)
+				continue
+			}
+			for _, d := range directives {
+				if d.key == "exclude" {
+					excludes = append(excludes, path.Join(rel, d.value))
+				}
+			}
+			walked.directives = append(walked.directives, directives...)
+		}
+		for _, entry := range entries {
+			entryRel := path.Join(rel, entry.Name())
+			if isExcluded(entryRel, excludes) {
+				continue
+			}
+			if !entry.IsDir() {
+				if filepath.Ext(entry.Name()) == ".py" {
+					walked.pyFiles = append(walked.pyFiles, entryRel)
+				}
+				continue
+			}
+			if skipPreflightDir(filepath.FromSlash(entryRel), entry.Name()) {
+				continue
+			}
+			walkDir(entryRel, excludes)
+		}
+	}
+	walkDir("", nil)
+
+	sort.SliceStable(walked.directives, func(i, j int) bool {
+		if walked.directives[i].path != walked.directives[j].path {
+			return walked.directives[i].path < walked.directives[j].path
+		}
+		return walked.directives[i].line < walked.directives[j].line
+	})
+	return walked, errs
+}
+
+// readPreflightDirectives returns the directives of the BUILD file at rel,
+// relative to the repository root.
+func readPreflightDirectives(repoRoot, rel string) ([]preflightDirective, error) {
+	content, err := os.ReadFile(filepath.Join(repoRoot, filepath.FromSlash(rel)))
+	if err != nil {
+		return nil, err
+	}
+	f, err := bzl.ParseBuild(rel, content)
+	if err != nil {
+		return nil, err
+	}
+	pkg := path.Dir(rel)
+	if pkg == "." {
+		pkg = ""
+	}
+	var directives []preflightDirective
+	for _, stmt := range f.Stmt {
+		comments := stmt.Comment()
+		for _, com := range append(comments.Before, comments.After...) {
+			match := preflightDirectiveRe.FindStringSubmatch(com.Token)
+			if match == nil {
+				continue
+			}
+			directives = append(directives, preflightDirective{
+				key:   match[1],
+				value: match[2],
+				path:  rel,
+				pkg:   pkg,
+				line:  com.Start.Line,
+			})
+		}
+	}
+	return directives, nil
+}
+
+// ambiguousPythonRoots returns an error for each python_root nested under
+// another one when a module is provided by files of both roots, e.g. foo.py
+// under the outer root and inner/foo.py under the inner root for the module
+// foo, which then resolves to two targets. Nesting the roots is fine
+// otherwise. The files belong to the innermost root containing them.
+func ambiguousPythonRoots(pythonRoots []preflightDirective, pyFiles []string) []error {
+	contains := func(root, rel string) bool {
+		return root == "" || rel == root || strings.HasPrefix(rel, root+"/")
+	}
+	// The files providing each module, by python_root.
+	modules := make(map[string]map[string]string, len(pythonRoots))
+	for _, f := range pyFiles {
+		root := -1
+		for i, r := range pythonRoots {
+			if contains(r.pkg, f) && (root < 0 || len(r.pkg) > len(pythonRoots[root].pkg)) {
+				root = i
+			}
+		}
+		if root < 0 {
+			continue
+		}
+		rootPkg := pythonRoots[root].pkg
+		rel := strings.TrimPrefix(strings.TrimPrefix(f, rootPkg), "/")
+		module := strings.TrimSuffix(rel, ".py")
+		if path.Base(module) == "__init__" {
+			module = path.Dir(module)
+		}
+		if module == "." {
+			continue
+		}
+		if modules[rootPkg] == nil {
+			modules[rootPkg] = make(map[string]string)
+		}
+		module = strings.ReplaceAll(module, "/", ".")
+		if _, ok := modules[rootPkg][module]; !ok {
+			modules[rootPkg][module] = f
+		}
+	}
+
+	var errs []error
+	for _, inner := range pythonRoots {
+		for _, outer := range pythonRoots {
+			if inner.pkg == outer.pkg || !contains(outer.pkg, inner.pkg) {
+				continue
+			}
+			var ambiguous []string
+			for module := range modules[inner.pkg] {
+				if _, ok := modules[outer.pkg][module]; ok {
+					ambiguous = append(ambiguous, module)
+				}
+			}
+			if len(ambiguous) == 0 {
+				continue
+			}
+			sort.Strings(ambiguous)
+			module := ambiguous[0]
+			errs = append(errs, inner.errorf("python root %q overlaps ambiguously with the python root %q declared at %s:%d: "+
+				"the module %q is provided by both %q and %q",
+				inner.pkg, outer.pkg, outer.path, outer.line, module, modules[inner.pkg][module], modules[outer.pkg][module]))
+		}
+	}
+	return errs
+}
+
+// skipPreflightDir returns whether the preflight phase should skip the given
+// directory, e.g. the Bazel convenience symlinks.
+func skipPreflightDir(rel, name string) bool {
+	if rel == "" {
+		return false
+	}
+	return strings.HasPrefix(name, ".") || (!strings.Contains(rel, string(filepath.Separator)) && strings.HasPrefix(name, "bazel-"))
+}
+
+// knownRepositories returns the apparent names of the repositories declared in
+// the MODULE.bazel and WORKSPACE files. It returns nil if the repositories
+// can't be determined, in which case repository names are not validated.
+func knownRepositories(c *config.Config) map[string]struct{} {
+	repos := make(map[string]struct{})
+	for _, r := range c.Repos {
+		repos[r.Name()] = struct{}{}
+	}
+	if content, err := os.ReadFile(filepath.Join(c.RepoRoot, "MODULE.bazel")); err == nil {
+		if f, err := bzl.ParseModule("MODULE.bazel", content); err == nil {
+			for _, stmt := range f.Stmt {
+				call, ok := stmt.(*bzl.CallExpr)
+				if !ok {
+					continue
+				}
+				switch bzl.FormatString(call.X) {
+				case "use_repo":
+					for _, arg := range call.List[1:] {
+						switch arg := arg.(type) {
+						case *bzl.StringExpr:
+							repos[arg.Value] = struct{}{}
+						case *bzl.AssignExpr:
+							repos[bzl.FormatString(arg.LHS)] = struct{}{}
+						}
+					}
+				case "bazel_dep":
+					var name, repoName string
+					for _, arg := range call.List {
+						if assign, ok := arg.(*bzl.AssignExpr); ok {
+							if value, ok := assign.RHS.(*bzl.StringExpr); ok {
+								switch bzl.FormatString(assign.LHS) {
+								case "name":
+									name = value.Value
+								case "repo_name":
+									repoName = value.Value
+								}
+							}
+						}
+					}
+					if repoName != "" {
+						name = repoName
+					}
+					if name != "" {
+						repos[name] = struct{}{}
+					}
+				}
+			}
+		}
+	}
+	if len(repos) == 0 {
+		return nil
+	}
+	return repos
+}
@@ -0,0 +1,158 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/stretchr/testify/assert"
+)
+
+func writePreflightFiles(t *testing.T, files map[string]string) string {
+	t.Helper()
+	root := t.TempDir()
+	for name, content := range files {
+		path := filepath.Join(root, name)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, []byte(content), 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	return root
+}
+
+func TestPreflight(t *testing.T) {
+	root := writePreflightFiles(t, map[string]string{
+		"MODULE.bazel": `bazel_dep(name = "rules_python", version = "1.0.0")
+pip = use_extension("@rules_python//python/extensions:pip.bzl", "pip")
+use_repo(pip, "pip")
+`,
+		"BUILD.bazel": `# gazelle:python_root
+# gazelle:python_generation_mode modules
+`,
+		"src/BUILD.bazel": `# gazelle:python_root
+# gazelle:python_manifest_file_name missing.yaml
+# gazelle:resolve py foo @unknown//:foo
+# gazelle:python_deps_order_file layers.yaml
+# gazelle:resolve_regexp py ^foo\.( //foo
+# gazelle:python_generated_module version.txt :gen_version
+# gazelle:python_license_label //licenses:mit
+# gazelle:python_profile strict
+# gazelle:resolve_symbol py pkg.mod //other:target
+# gazelle:resolve py foo.*.bar //foo
+# gazelle:python_pyproject_dependencies unknown
+# gazelle:python_exclude_regex _flymake(\.py$
+`,
+		"src/pyproject.toml": `[project]
+dependencies = "requests"
+`,
+		"src/layers.yaml": `layers: [{name: a, depends_on: [b]}]`,
+		"foo.py":          "",
+		"src/foo.py":      "",
+		"gazelle_python.yaml": `manifest:
+  pip_repository:
+    name: pypi
+`,
+	})
+	c := &config.Config{RepoRoot: root, ValidBuildFileNames: config.DefaultValidBuildFileNames}
+
+	err := runPreflight(c)
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "found 15 problem(s)")
+	assert.Contains(t, err.Error(), `BUILD.bazel:2: gazelle:python_generation_mode: invalid value for directive "python_generation_mode": modules`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:1: gazelle:python_root: python root "src" overlaps ambiguously with the python root "" declared at BUILD.bazel:1: the module "foo" is provided by both "src/foo.py" and "foo.py"`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:2: gazelle:python_manifest_file_name: manifest "src/missing.yaml" does not exist`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:3: gazelle:resolve: repository "unknown" is not declared in the workspace`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:4: gazelle:python_deps_order_file:`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:5: gazelle:resolve_regexp: invalid regular expression "^foo\\.("`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:6: gazelle:python_generated_module: invalid value for directive "python_generated_module": "version.txt" is not a Python file`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:7: gazelle:python_license_label: invalid value for directive "python_license_label": expected a license and a label, got "//licenses:mit"`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:8: gazelle:python_profile: invalid value for directive "python_profile": strict: possible values are data-science/services-coarse/strict-per-file`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:9: gazelle:resolve_symbol: invalid value for directive "resolve_symbol": expected a module:symbol, e.g. pkg.mod:SpecificClass, got "pkg.mod"`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:10: gazelle:resolve: invalid value for directive "resolve": expected a wildcard only at the end of the module, e.g. foo.bar.*, got "foo.*.bar"`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:11: gazelle:python_pyproject_dependencies: repository "unknown" is not declared in the workspace`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:11: gazelle:python_pyproject_dependencies: failed to parse`)
+	assert.Contains(t, err.Error(), `src/BUILD.bazel:12: gazelle:python_exclude_regex: invalid value for directive "python_exclude_regex": error parsing regexp`)
+	assert.Contains(t, err.Error(), `line 2: the dependencies must be an array`)
+	assert.Contains(t, err.Error(), `gazelle_python.yaml: the pip repository "pypi" is not declared in the workspace`)
+}
+
+func TestPreflightConfigure(t *testing.T) {
+	// The directives are validated by the same code as in Configure.
+	root := writePreflightFiles(t, map[string]string{
+		"BUILD.bazel": `# gazelle:python_test_file_pattern foo_*_[A-Z_test?.py
+# gazelle:python_tooling_file_pattern
+# gazelle:python_label_convention
+# gazelle:python_generate_pyi_deps maybe
+# gazelle:python_testonly_dirs tests/helpers
+# gazelle:no_deps_order now
+# gazelle:python_profile services-coarse
+`,
+	})
+	c := &config.Config{RepoRoot: root, ValidBuildFileNames: config.DefaultValidBuildFileNames}
+
+	err := runPreflight(c)
+	if !assert.Error(t, err) {
+		return
+	}
+	assert.Contains(t, err.Error(), "found 5 problem(s)")
+	assert.Contains(t, err.Error(), `BUILD.bazel:1: gazelle:python_test_file_pattern: invalid glob pattern 'foo_*_[A-Z_test?.py'`)
+	assert.Contains(t, err.Error(), `BUILD.bazel:3: gazelle:python_label_convention: directive 'python_label_convention' requires a value`)
+	assert.Contains(t, err.Error(), `BUILD.bazel:4: gazelle:python_generate_pyi_deps: strconv.ParseBool: parsing "maybe": invalid syntax`)
+	assert.Contains(t, err.Error(), `BUILD.bazel:5: gazelle:python_testonly_dirs: invalid value for directive "python_testonly_dirs": "tests/helpers": expected a directory name`)
+	assert.Contains(t, err.Error(), `BUILD.bazel:6: gazelle:no_deps_order: the directive "no_deps_order" takes no value`)
+}
+
+func TestPreflightValid(t *testing.T) {
+	root := writePreflightFiles(t, map[string]string{
+		"MODULE.bazel": `pip = use_extension("@rules_python//python/extensions:pip.bzl", "pip")
+use_repo(pip, pypi = "pip")
+`,
+		".bazelignore": "node_modules\n",
+		"BUILD.bazel": `# gazelle:python_generation_mode file
+# gazelle:python_root
+# gazelle:exclude third_party/**
+# gazelle:resolve py foo @pypi//foo
+# gazelle:resolve_regexp py ^vendored\.(\w+) //vendored/$1
+# gazelle:python_generated_module version.py //tools:gen_version
+# gazelle:python_license_label MIT License //licenses:mit
+# gazelle:python_profile services-coarse
+# gazelle:resolve_symbol py pkg.mod:SpecificClass //other:target
+# gazelle:python_exclude_regex _flymake\.py$
+`,
+		"gazelle_python.yaml": `manifest:
+  pip_repository:
+    name: pypi
+integrity: 0123456789abcdef
+`,
+		// The nested python root provides other modules than its parent.
+		"app.py":                   "",
+		"src/BUILD.bazel":          "# gazelle:python_root\n",
+		"src/lib/__init__.py":      "",
+		"src/lib/util.py":          "",
+		"third_party/BUILD.bazel":  "# gazelle:python_generation_mode modules\n",
+		"node_modules/BUILD.bazel": "# gazelle:python_generation_mode modules\n",
+	})
+	c := &config.Config{RepoRoot: root, ValidBuildFileNames: config.DefaultValidBuildFileNames}
+
+	assert.NoError(t, runPreflight(c))
+}
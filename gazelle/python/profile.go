@@ -0,0 +1,268 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// resolutionProfile aggregates the time spent in the lookups of each
+// resolution strategy, by module prefix, for the -python_profile_output flag.
+type resolutionProfile struct {
+	// mu guards prefixes, recorded by the concurrent resolutions of the rules.
+	mu sync.Mutex
+	// prefixes maps the top-level modules, e.g. "google" for
+	// "google.protobuf.message", to the time spent by each strategy resolving
+	// their imports.
+	prefixes map[string]map[resolutionStrategy]*profileEntry
+}
+
+// profileEntry is the number of lookups of a resolution strategy and the time
+// they took.
+type profileEntry struct {
+	Lookups  int           `json:"lookups"`
+	Duration time.Duration `json:"-"`
+	// DurationMs is set from Duration when the profile is written.
+	DurationMs float64 `json:"duration_ms"`
+}
+
+// add adds the lookups of the other entry.
+func (e *profileEntry) add(other *profileEntry) {
+	e.Lookups += other.Lookups
+	e.Duration += other.Duration
+}
+
+// strategyProfile is the profile of a resolution strategy.
+type strategyProfile struct {
+	Strategy resolutionStrategy `json:"strategy"`
+	profileEntry
+}
+
+// prefixProfile is the profile of the imports of a module prefix.
+type prefixProfile struct {
+	Prefix string `json:"prefix"`
+	profileEntry
+	Strategies []strategyProfile `json:"strategies"`
+}
+
+// profileFile is the format of the file written by -python_profile_output.
+// The strategies and the prefixes are sorted by decreasing duration.
+type profileFile struct {
+	profileEntry
+	Strategies []strategyProfile `json:"strategies"`
+	Prefixes   []prefixProfile   `json:"prefixes"`
+}
+
+// record records a lookup of the strategy for the module, started at start.
+// It's a no-op when profiling is disabled.
+func (p *resolutionProfile) record(module string, strategy resolutionStrategy, start time.Time) {
+	if p == nil {
+		return
+	}
+	duration := time.Since(start)
+	prefix, _, _ := strings.Cut(module, ".")
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if p.prefixes == nil {
+		p.prefixes = make(map[string]map[resolutionStrategy]*profileEntry)
+	}
+	if p.prefixes[prefix] == nil {
+		p.prefixes[prefix] = make(map[resolutionStrategy]*profileEntry)
+	}
+	entry, ok := p.prefixes[prefix][strategy]
+	if !ok {
+		entry = &profileEntry{}
+		p.prefixes[prefix][strategy] = entry
+	}
+	entry.Lookups++
+	entry.Duration += duration
+}
+
+// file returns the aggregated profile.
+func (p *resolutionProfile) file() profileFile {
+	var f profileFile
+	strategies := make(map[resolutionStrategy]*profileEntry)
+	for prefix, entries := range p.prefixes {
+		pp := prefixProfile{Prefix: prefix}
+		for strategy, entry := range entries {
+			pp.add(entry)
+			pp.Strategies = append(pp.Strategies, strategyProfile{Strategy: strategy, profileEntry: *entry})
+			if strategies[strategy] == nil {
+				strategies[strategy] = &profileEntry{}
+			}
+			strategies[strategy].add(entry)
+		}
+		sortStrategyProfiles(pp.Strategies)
+		f.add(&pp.profileEntry)
+		f.Prefixes = append(f.Prefixes, pp)
+	}
+	for strategy, entry := range strategies {
+		f.Strategies = append(f.Strategies, strategyProfile{Strategy: strategy, profileEntry: *entry})
+	}
+	sortStrategyProfiles(f.Strategies)
+	sort.Slice(f.Prefixes, func(i, j int) bool {
+		if f.Prefixes[i].Duration != f.Prefixes[j].Duration {
+			return f.Prefixes[i].Duration > f.Prefixes[j].Duration
+		}
+		return f.Prefixes[i].Prefix < f.Prefixes[j].Prefix
+	})
+	return f
+}
+
+// sortStrategyProfiles sorts the profiles by decreasing duration.
+func sortStrategyProfiles(profiles []strategyProfile) {
+	sort.Slice(profiles, func(i, j int) bool {
+		if profiles[i].Duration != profiles[j].Duration {
+			return profiles[i].Duration > profiles[j].Duration
+		}
+		return profiles[i].Strategy < profiles[j].Strategy
+	})
+}
+
+// setDurations sets the durations in milliseconds of the entries of the file.
+func (f *profileFile) setDurations() {
+	ms := func(e *profileEntry) {
+		e.DurationMs = float64(e.Duration) / float64(time.Millisecond)
+	}
+	ms(&f.profileEntry)
+	for i := range f.Strategies {
+		ms(&f.Strategies[i].profileEntry)
+	}
+	for i := range f.Prefixes {
+		ms(&f.Prefixes[i].profileEntry)
+		for j := range f.Prefixes[i].Strategies {
+			ms(&f.Prefixes[i].Strategies[j].profileEntry)
+		}
+	}
+}
+
+// writeProfile writes the resolution profile to the file given to the
+// -python_profile_output flag, if any.
+func (py *Python) writeProfile() {
+	if py.profileOutputPath == "" {
+		return
+	}
+	f := py.profile.file()
+	f.setDurations()
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		log.Fatal(fmt.Errorf("failed to encode the resolution profile: %w", err))
+	}
+	if err := os.WriteFile(py.profileOutputPath, append(data, '\n'), 0o644); err != nil {
+		log.Fatal(fmt.Errorf("failed to write the resolution profile: %w", err))
+	}
+}
+
+// findOverride looks up the resolve directives for the import of mod, the
+// exact ones first, then the wildcard ones.
+func (py *Resolver) findOverride(c *config.Config, cfg *pythonconfig.Config, mod Module, imp resolve.ImportSpec) (label.Label, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyOverride, time.Now())
+	}
+	if override, ok := resolve.FindRuleWithOverride(c, imp, languageName); ok {
+		return override, true
+	}
+	override, _, ok := cfg.FindWildcardResolve(imp.Imp)
+	return override, ok
+}
+
+// findSymbolResolve looks up the resolve_symbol directives for the symbol
+// imported from the module by mod.
+func (py *Resolver) findSymbolResolve(cfg *pythonconfig.Config, mod Module, module, symbol string) (label.Label, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyOverride, time.Now())
+	}
+	return cfg.FindSymbolResolve(module, symbol)
+}
+
+// findThirdPartyDependency looks up the manifest for the import of mod.
+func (py *Resolver) findThirdPartyDependency(cfg *pythonconfig.Config, mod Module, moduleName string) (string, string, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyThirdParty, time.Now())
+	}
+	return cfg.FindThirdPartyDependency(moduleName)
+}
+
+// findGeneratedModule looks up the generated modules for the import of mod.
+func (py *Resolver) findGeneratedModule(cfg *pythonconfig.Config, mod Module, moduleName string) (label.Label, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyGenerated, time.Now())
+	}
+	return cfg.FindGeneratedModule(moduleName)
+}
+
+// findNativeModule looks up the native extension modules for the import of
+// mod.
+func (py *Resolver) findNativeModule(cfg *pythonconfig.Config, mod Module, moduleName string) (label.Label, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyNative, time.Now())
+	}
+	return cfg.FindNativeModule(moduleName)
+}
+
+// findOpaqueLibrary looks up the opaque libraries for the import of mod.
+func (py *Resolver) findOpaqueLibrary(cfg *pythonconfig.Config, mod Module, moduleName string) (label.Label, string, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyOpaque, time.Now())
+	}
+	return cfg.FindOpaqueLibrary(moduleName)
+}
+
+// findRulesByImport looks up the index of the first-party targets for the
+// import of mod.
+func (py *Resolver) findRulesByImport(c *config.Config, ix *resolve.RuleIndex, mod Module, imp resolve.ImportSpec) []resolve.FindResult {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyIndex, time.Now())
+	}
+	return ix.FindRulesByImportWithConfig(c, imp, languageName)
+}
+
+// findStdModuleBackport looks up the manifest for the backport of the
+// standard module imported by mod, if it's missing from the targeted Python
+// version. It returns the dependency, its distribution and the module of the
+// backport.
+func (py *Resolver) findStdModuleBackport(cfg *pythonconfig.Config, mod Module, moduleName string) (string, string, string, bool) {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyThirdParty, time.Now())
+	}
+	_, backportModule := stdModuleBackport(moduleName, cfg.PythonVersion())
+	if backportModule == "" {
+		return "", "", "", false
+	}
+	dep, distributionName, ok := cfg.FindThirdPartyDependency(backportModule)
+	return dep, distributionName, backportModule, ok
+}
+
+// isStdModule checks whether the import of mod is part of the standard
+// library of the targeted Python version.
+func (py *Resolver) isStdModule(cfg *pythonconfig.Config, mod Module, moduleName string) bool {
+	if py.profile != nil {
+		defer py.profile.record(mod.Name, resolutionStrategyStdlib, time.Now())
+	}
+	return isStdModule(Module{Name: moduleName}, cfg.PythonVersion())
+}
@@ -0,0 +1,50 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+	"time"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestResolutionProfile(t *testing.T) {
+	// Recording is a no-op when profiling is disabled.
+	var disabled *resolutionProfile
+	disabled.record("foo", resolutionStrategyIndex, time.Now())
+
+	p := &resolutionProfile{}
+	p.record("google.protobuf.message", resolutionStrategyOverride, time.Now())
+	p.record("google.protobuf.message", resolutionStrategyThirdParty, time.Now().Add(-2*time.Millisecond))
+	p.record("google.api", resolutionStrategyThirdParty, time.Now())
+	p.record("os.path", resolutionStrategyStdlib, time.Now())
+
+	f := p.file()
+	f.setDurations()
+	assert.Equal(t, 4, f.Lookups)
+	assert.GreaterOrEqual(t, f.DurationMs, 2.0)
+	if assert.Len(t, f.Prefixes, 2) {
+		assert.Equal(t, "google", f.Prefixes[0].Prefix)
+		assert.Equal(t, 3, f.Prefixes[0].Lookups)
+		assert.Equal(t, resolutionStrategyThirdParty, f.Prefixes[0].Strategies[0].Strategy)
+		assert.Equal(t, 2, f.Prefixes[0].Strategies[0].Lookups)
+		assert.Equal(t, "os", f.Prefixes[1].Prefix)
+	}
+	if assert.Len(t, f.Strategies, 3) {
+		assert.Equal(t, resolutionStrategyThirdParty, f.Strategies[0].Strategy)
+		assert.Equal(t, 2, f.Strategies[0].Lookups)
+	}
+}
@@ -0,0 +1,119 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	// pyTypedFilename is the PEP 561 marker of the packages shipping their
+	// type information.
+	pyTypedFilename = "py.typed"
+	// typedClassifier is the trove classifier of the wheels of the typed
+	// packages.
+	typedClassifier = "Typing :: Typed"
+)
+
+// pyTypedMarkers returns the py.typed markers of the directories of the srcs,
+// relative to the package, e.g. "py.typed" and "sub/py.typed" for the srcs
+// lib.py and sub/util.py of a library with the files of the subdirectories.
+func pyTypedMarkers(args language.GenerateArgs, cfg *pythonconfig.Config, srcs *treeset.Set) []string {
+	dirs := make(map[string]bool)
+	for _, src := range srcs.Values() {
+		dirs[path.Dir(src.(string))] = true
+	}
+	var markers []string
+	for dir := range dirs {
+		marker := path.Join(dir, pyTypedFilename)
+		if cfg.IgnoresFile(pyTypedFilename) || cfg.ExcludesPath(filepath.Join(args.Rel, marker)) {
+			continue
+		}
+		if isPyTypedPackage(args.Dir, dir) {
+			markers = append(markers, marker)
+		}
+	}
+	sort.Strings(markers)
+	return markers
+}
+
+// isPyTypedPackage returns whether the directory dir, relative to the package
+// directory pkgDir, has a py.typed marker.
+func isPyTypedPackage(pkgDir, dir string) bool {
+	info, err := os.Stat(filepath.Join(pkgDir, dir, pyTypedFilename))
+	return err == nil && !info.IsDir()
+}
+
+// addPyTypedData adds the py.typed markers of the srcs to the data of the
+// generated library r, so that the consumers of the library, and the wheels
+// packaging it, get its type information. As the data of the existing
+// library isn't merged, its markers are updated in place: the missing ones
+// are added and the ones of the directories without a marker anymore are
+// removed. The data marked with a "# keep" comment, or that isn't a plain
+// list of strings, is left untouched.
+func addPyTypedData(args language.GenerateArgs, cfg *pythonconfig.Config, r *rule.Rule, srcs *treeset.Set) {
+	markers := pyTypedMarkers(args, cfg, srcs)
+	if len(markers) > 0 {
+		r.SetAttr("data", markers)
+	}
+	if args.File == nil {
+		return
+	}
+	for _, existing := range args.File.Rules {
+		if existing.Name() == r.Name() && kindMatches(args.Config, existing, pyLibraryKind) {
+			updatePyTypedData(existing, markers)
+		}
+	}
+}
+
+// updatePyTypedData replaces the py.typed markers of the data of the existing
+// library r with the given markers.
+func updatePyTypedData(r *rule.Rule, markers []string) {
+	expr := r.Attr("data")
+	if expr == nil || attrShouldKeep(r, "data") {
+		return
+	}
+	list, ok := expr.(*bzl.ListExpr)
+	if !ok || hasKeptValue(list) {
+		return
+	}
+	var data []string
+	for _, elem := range list.List {
+		s, ok := elem.(*bzl.StringExpr)
+		if !ok {
+			return
+		}
+		if path.Base(s.Value) != pyTypedFilename {
+			data = append(data, s.Value)
+		}
+	}
+	data = append(data, markers...)
+	sort.Strings(data)
+	if len(data) == 0 {
+		r.DelAttr("data")
+	} else {
+		r.SetAttr("data", data)
+	}
+}
@@ -0,0 +1,94 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestPyTypedMarkers(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"py.typed", "typed/py.typed", "untyped/util.py"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	args := language.GenerateArgs{Dir: dir, Rel: "pkg"}
+	srcs := treeset.NewWith(godsutils.StringComparator, "lib.py", "typed/util.py", "untyped/util.py")
+	cfg := pythonconfig.New(dir, "")
+	assert.Equal(t, []string{"py.typed", "typed/py.typed"}, pyTypedMarkers(args, cfg, srcs))
+
+	cfg.AddIgnoreFile(pyTypedFilename)
+	assert.Empty(t, pyTypedMarkers(args, cfg, srcs))
+}
+
+func TestUpdatePyTypedData(t *testing.T) {
+	tests := map[string]struct {
+		build   string
+		markers []string
+		want    []string
+	}{
+		"added": {
+			build:   `py_library(name = "lib", data = ["schema.json"])`,
+			markers: []string{"py.typed"},
+			want:    []string{"py.typed", "schema.json"},
+		},
+		"removed": {
+			build: `py_library(name = "lib", data = ["py.typed", "schema.json"])`,
+			want:  []string{"schema.json"},
+		},
+		"only marker removed": {
+			build: `py_library(name = "lib", data = ["py.typed"])`,
+		},
+		"kept": {
+			build: `
+py_library(
+    name = "lib",
+    data = ["py.typed"],  # keep
+)
+`,
+			want: []string{"py.typed"},
+		},
+		"not a plain list": {
+			build:   `py_library(name = "lib", data = glob(["*.json"]))`,
+			markers: []string{"py.typed"},
+		},
+	}
+	for name, tt := range tests {
+		t.Run(name, func(t *testing.T) {
+			f, err := rule.LoadData("BUILD", "", []byte(tt.build))
+			if err != nil {
+				t.Fatal(err)
+			}
+			r := f.Rules[0]
+			updatePyTypedData(r, tt.markers)
+			assert.Equal(t, tt.want, r.AttrStrings("data"))
+		})
+	}
+}
@@ -0,0 +1,592 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/lists/singlylinkedlist"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	sitter "github.com/smacker/go-tree-sitter"
+	"github.com/smacker/go-tree-sitter/toml"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	pyprojectFilename = "pyproject.toml"
+
+	tomlNodeTypeTable       = "table"
+	tomlNodeTypePair        = "pair"
+	tomlNodeTypeBareKey     = "bare_key"
+	tomlNodeTypeQuotedKey   = "quoted_key"
+	tomlNodeTypeDottedKey   = "dotted_key"
+	tomlNodeTypeString      = "string"
+	tomlNodeTypeArray       = "array"
+	tomlNodeTypeInlineTable = "inline_table"
+)
+
+// projectScript is an entry of the [project.scripts] or
+// [project.gui-scripts] table of a pyproject.toml, e.g.
+// `mycli = "mypkg.cli:main"`.
+type projectScript struct {
+	name string
+	// entryPoint is the "module:attr" object reference of the script.
+	entryPoint string
+	// gui is whether the script is one of [project.gui-scripts].
+	gui        bool
+	lineNumber uint32
+}
+
+// module returns the module of the entry point of the script.
+func (s projectScript) module() string {
+	module, _, _ := strings.Cut(s.entryPoint, ":")
+	return strings.TrimSpace(module)
+}
+
+// requirementNameRe matches the name of the distribution of a PEP 508
+// requirement, e.g. requests for "requests[socks]>=2; python_version>'3.8'".
+var requirementNameRe = regexp.MustCompile(`^\s*([A-Za-z0-9](?:[A-Za-z0-9._-]*[A-Za-z0-9])?)`)
+
+// pyproject holds the parts of a pyproject.toml Gazelle is interested in.
+type pyproject struct {
+	name           string
+	version        string
+	description    string
+	requiresPython string
+	scripts        []projectScript
+	// entryPoints maps the groups of the [project.entry-points] tables to
+	// their entry points, as "name = object reference".
+	entryPoints map[string][]string
+	// requirements are the PEP 508 requirements of [project.dependencies].
+	requirements []string
+	// optionalRequirements maps the extras of
+	// [project.optional-dependencies] to their requirements.
+	optionalRequirements map[string][]string
+	// dependencies are the names of the distributions required by the
+	// [project.dependencies] and [project.optional-dependencies] arrays.
+	dependencies []string
+}
+
+// parsePyproject parses the code of a pyproject.toml. The scripts are sorted
+// by name, the dependencies are sorted and deduplicated, without the project
+// itself that the optional dependencies may refer to.
+func parsePyproject(code []byte) (*pyproject, error) {
+	parser := sitter.NewParser()
+	parser.SetLanguage(toml.GetLanguage())
+	tree, err := parser.ParseCtx(context.Background(), nil, code)
+	if err != nil {
+		return nil, err
+	}
+	root := tree.RootNode()
+	if root.HasError() {
+		return nil, fmt.Errorf("invalid TOML")
+	}
+
+	project := &pyproject{}
+	stringValue := func(key []string, value *sitter.Node) (string, error) {
+		if value.Type() != tomlNodeTypeString {
+			return "", fmt.Errorf("line %d: %s must be a string", value.StartPoint().Row+1, strings.Join(key, "."))
+		}
+		v, err := decodeTOMLString(value.Content(code))
+		if err != nil {
+			return "", fmt.Errorf("line %d: %w", value.StartPoint().Row+1, err)
+		}
+		return v, nil
+	}
+	err = walkTOMLPairs(root, code, func(key []string, value *sitter.Node) error {
+		if len(key) < 2 || key[0] != "project" {
+			return nil
+		}
+		var err error
+		switch {
+		case len(key) == 2 && key[1] == "name":
+			project.name, err = stringValue(key, value)
+		case len(key) == 2 && key[1] == "version":
+			project.version, err = stringValue(key, value)
+		case len(key) == 2 && key[1] == "description":
+			project.description, err = stringValue(key, value)
+		case len(key) == 2 && key[1] == "requires-python":
+			project.requiresPython, err = stringValue(key, value)
+		case len(key) == 2 && key[1] == "dependencies":
+			project.requirements, err = parseRequirements(value, code)
+		case len(key) == 3 && key[1] == "optional-dependencies":
+			var requirements []string
+			requirements, err = parseRequirements(value, code)
+			if project.optionalRequirements == nil {
+				project.optionalRequirements = make(map[string][]string)
+			}
+			project.optionalRequirements[key[2]] = requirements
+		case len(key) == 3 && (key[1] == "scripts" || key[1] == "gui-scripts"):
+			var entryPoint string
+			entryPoint, err = stringValue(key, value)
+			project.scripts = append(project.scripts, projectScript{
+				name:       key[2],
+				entryPoint: entryPoint,
+				gui:        key[1] == "gui-scripts",
+				lineNumber: value.StartPoint().Row + 1,
+			})
+		case len(key) == 4 && key[1] == "entry-points":
+			var entryPoint string
+			entryPoint, err = stringValue(key, value)
+			if project.entryPoints == nil {
+				project.entryPoints = make(map[string][]string)
+			}
+			project.entryPoints[key[2]] = append(project.entryPoints[key[2]], key[3]+" = "+entryPoint)
+		}
+		return err
+	})
+	if err != nil {
+		return nil, err
+	}
+	sort.SliceStable(project.scripts, func(i, j int) bool {
+		return project.scripts[i].name < project.scripts[j].name
+	})
+
+	dependencies := make(map[string]struct{})
+	requirements := project.requirements
+	for _, extraRequirements := range project.optionalRequirements {
+		requirements = append(requirements, extraRequirements...)
+	}
+	for _, requirement := range requirements {
+		name := requirementNameRe.FindStringSubmatch(requirement)[1]
+		if pythonconfig.NormalizeDistributionName(name) == pythonconfig.NormalizeDistributionName(project.name) {
+			continue
+		}
+		if _, ok := dependencies[name]; !ok {
+			dependencies[name] = struct{}{}
+			project.dependencies = append(project.dependencies, name)
+		}
+	}
+	sort.Strings(project.dependencies)
+	return project, nil
+}
+
+// parseRequirements returns the PEP 508 requirements of the array.
+func parseRequirements(value *sitter.Node, code []byte) ([]string, error) {
+	if value.Type() != tomlNodeTypeArray {
+		return nil, fmt.Errorf("line %d: the dependencies must be an array", value.StartPoint().Row+1)
+	}
+	var requirements []string
+	for i := 0; i < int(value.NamedChildCount()); i++ {
+		item := value.NamedChild(i)
+		if item.Type() != tomlNodeTypeString {
+			continue
+		}
+		requirement, err := decodeTOMLString(item.Content(code))
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %w", item.StartPoint().Row+1, err)
+		}
+		if !requirementNameRe.MatchString(requirement) {
+			return nil, fmt.Errorf("line %d: invalid requirement %q", item.StartPoint().Row+1, requirement)
+		}
+		requirements = append(requirements, strings.TrimSpace(requirement))
+	}
+	return requirements, nil
+}
+
+// readPyproject reads and parses the pyproject.toml at path. It returns nil
+// when the file doesn't exist.
+func readPyproject(path string) (*pyproject, error) {
+	code, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, err
+	}
+	project, err := parsePyproject(code)
+	if err != nil {
+		return nil, fmt.Errorf("failed to parse %q: %w", path, err)
+	}
+	return project, nil
+}
+
+// addPyprojectDependencies registers the distributions required by the
+// pyproject.toml at path, if any, as the ones of the pip repository.
+func addPyprojectDependencies(cfg *pythonconfig.Config, path, repository string) error {
+	project, err := readPyproject(path)
+	if err != nil || project == nil {
+		return err
+	}
+	cfg.AddDeclaredDistributions(repository, project.dependencies)
+	return nil
+}
+
+// walkTOMLPairs calls fn with the full key, e.g. [project scripts mycli], and
+// the value of every key/value pair of the document. The pairs of the inline
+// tables are walked too. The arrays of tables are skipped.
+func walkTOMLPairs(root *sitter.Node, code []byte, fn func(key []string, value *sitter.Node) error) error {
+	var walkPairs func(prefix []string, node *sitter.Node) error
+	walkPairs = func(prefix []string, node *sitter.Node) error {
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			pair := node.NamedChild(i)
+			if pair.Type() != tomlNodeTypePair || pair.NamedChildCount() < 2 {
+				continue
+			}
+			key, err := decodeTOMLKey(pair.NamedChild(0), code)
+			if err != nil {
+				return err
+			}
+			key = append(append([]string{}, prefix...), key...)
+			value := pair.NamedChild(int(pair.NamedChildCount()) - 1)
+			if value.Type() == tomlNodeTypeInlineTable {
+				if err := walkPairs(key, value); err != nil {
+					return err
+				}
+				continue
+			}
+			if err := fn(key, value); err != nil {
+				return err
+			}
+		}
+		return nil
+	}
+
+	if err := walkPairs(nil, root); err != nil {
+		return err
+	}
+	for i := 0; i < int(root.NamedChildCount()); i++ {
+		table := root.NamedChild(i)
+		if table.Type() != tomlNodeTypeTable || table.NamedChildCount() == 0 {
+			continue
+		}
+		key, err := decodeTOMLKey(table.NamedChild(0), code)
+		if err != nil {
+			return err
+		}
+		if err := walkPairs(key, table); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// decodeTOMLKey returns the parts of a bare, quoted or dotted key.
+func decodeTOMLKey(node *sitter.Node, code []byte) ([]string, error) {
+	switch node.Type() {
+	case tomlNodeTypeBareKey:
+		return []string{node.Content(code)}, nil
+	case tomlNodeTypeQuotedKey:
+		key, err := decodeTOMLString(node.Content(code))
+		if err != nil {
+			return nil, err
+		}
+		return []string{key}, nil
+	case tomlNodeTypeDottedKey:
+		var parts []string
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			part, err := decodeTOMLKey(node.NamedChild(i), code)
+			if err != nil {
+				return nil, err
+			}
+			parts = append(parts, part...)
+		}
+		return parts, nil
+	default:
+		return nil, fmt.Errorf("line %d: unexpected key %q", node.StartPoint().Row+1, node.Content(code))
+	}
+}
+
+// decodeTOMLString returns the value of a basic, literal or multi-line string.
+func decodeTOMLString(s string) (string, error) {
+	switch {
+	case strings.HasPrefix(s, `'''`) && strings.HasSuffix(s, `'''`) && len(s) >= 6:
+		return trimFirstNewline(s[3 : len(s)-3]), nil
+	case strings.HasPrefix(s, `"""`) && strings.HasSuffix(s, `"""`) && len(s) >= 6:
+		// Escape the quotes and newlines the multi-line strings allow to
+		// unquote them as a basic string.
+		var b strings.Builder
+		escaped := false
+		for _, r := range trimFirstNewline(s[3 : len(s)-3]) {
+			switch {
+			case escaped:
+				escaped = false
+			case r == '\\':
+				escaped = true
+			case r == '"':
+				b.WriteByte('\\')
+			case r == '\r':
+				continue
+			case r == '\n':
+				b.WriteString(`\n`)
+				continue
+			}
+			b.WriteRune(r)
+		}
+		return strconv.Unquote(`"` + b.String() + `"`)
+	case strings.HasPrefix(s, `'`) && strings.HasSuffix(s, `'`) && len(s) >= 2:
+		return s[1 : len(s)-1], nil
+	case strings.HasPrefix(s, `"`) && strings.HasSuffix(s, `"`) && len(s) >= 2:
+		return strconv.Unquote(s)
+	default:
+		return "", fmt.Errorf("invalid TOML string %s", s)
+	}
+}
+
+// trimFirstNewline trims the newline following the opening delimiter of a
+// multi-line string.
+func trimFirstNewline(s string) string {
+	if strings.HasPrefix(s, "\r\n") {
+		return s[2:]
+	}
+	return strings.TrimPrefix(s, "\n")
+}
+
+// generatePyprojectTargets generates the targets of the pyproject.toml of
+// the package, if any: the scripts and, with python_generate_wheel, the
+// wheel.
+func generatePyprojectTargets(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	result *language.GenerateResult,
+	collisionErrors *singlylinkedlist.List,
+) {
+	project := &pyproject{}
+	for _, f := range args.RegularFiles {
+		if f != pyprojectFilename || cfg.IgnoresFile(f) {
+			continue
+		}
+		code, err := os.ReadFile(filepath.Join(args.Dir, f))
+		if err != nil {
+			log.Printf("ERROR: %v\n", err)
+			return
+		}
+		project, err = parsePyproject(code)
+		if err != nil {
+			log.Printf("ERROR: failed to parse %q: %v\n", filepath.Join(args.Rel, f), err)
+			return
+		}
+	}
+	generateProjectScripts(args, pythonProjectRoot, pyFileNames, visibility, project.scripts, result, collisionErrors)
+	if cfg.GenerateWheel() && project.name != "" {
+		generateProjectWheel(args, pythonProjectRoot, pyFileNames, visibility, project, result, collisionErrors)
+	}
+}
+
+// pyprojectTargetCollision returns an error if a target of another kind, or
+// one generated already, has the name of a target of the pyproject.toml.
+func pyprojectTargetCollision(args language.GenerateArgs, result *language.GenerateResult, name, kind string) error {
+	fqTarget := label.New("", args.Rel, name)
+	for _, r := range result.Gen {
+		if r.Name() == name {
+			return fmt.Errorf("failed to generate target %q of kind %q for %s: "+
+				"a target with the same name is already generated", fqTarget.String(),
+				getMappedKind(args.Config, kind), pyprojectFilename)
+		}
+	}
+	if err := ensureNoCollision(args.Config, args.File, name, kind); err != nil {
+		return fmt.Errorf("failed to generate target %q of kind %q for %s: %w",
+			fqTarget.String(), getMappedKind(args.Config, kind), pyprojectFilename, err)
+	}
+	return nil
+}
+
+// generateProjectScripts generates a py_console_script_binary for each script
+// of the pyproject.toml. The deps of the targets are resolved from the modules
+// of their entry points. The targets generated before for the scripts removed
+// since are emptied.
+func generateProjectScripts(
+	args language.GenerateArgs,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	scripts []projectScript,
+	result *language.GenerateResult,
+	collisionErrors *singlylinkedlist.List,
+) {
+	generated := make(map[string]struct{}, len(scripts))
+	for _, script := range scripts {
+		if err := pyprojectTargetCollision(args, result, script.name, pyConsoleScriptBinaryKind); err != nil {
+			collisionErrors.Add(err)
+			continue
+		}
+		if script.module() == "" {
+			log.Printf("WARNING: %s: the script %q has no module, skipping it\n",
+				filepath.Join(args.Rel, pyprojectFilename), script.name)
+			continue
+		}
+		generated[script.name] = struct{}{}
+		scriptTarget := newTargetBuilder(pyConsoleScriptBinaryKind, script.name, pythonProjectRoot, args.Rel, pyFileNames, false).
+			addVisibility(visibility).
+			addModuleDependency(Module{
+				Name:       script.module(),
+				LineNumber: script.lineNumber,
+				Filepath:   filepath.Join(args.Rel, pyprojectFilename),
+			})
+		scriptRule := scriptTarget.build()
+		scriptRule.SetAttr("entry_point", script.entryPoint)
+		result.Gen = append(result.Gen, scriptRule)
+		result.Imports = append(result.Imports, scriptRule.PrivateAttr(config.GazelleImportsKey))
+	}
+
+	if args.File == nil {
+		return
+	}
+	for _, r := range args.File.Rules {
+		if !kindMatches(args.Config, r, pyConsoleScriptBinaryKind) || r.Attr("entry_point") == nil {
+			continue
+		}
+		if _, ok := generated[r.Name()]; ok {
+			continue
+		}
+		result.Empty = append(result.Empty, rule.NewRule(pyConsoleScriptBinaryKind, r.Name()))
+	}
+}
+
+// wheelTargetNames returns the names of the py_package and py_wheel targets
+// of the distribution, e.g. my_project_pkg and my_project_wheel for
+// My-Project.
+func wheelTargetNames(distribution string) (string, string) {
+	name := strings.ReplaceAll(pythonconfig.NormalizeDistributionName(distribution), "-", "_")
+	return name + "_pkg", name + "_wheel"
+}
+
+// generateProjectWheel generates a py_package and a py_wheel from the
+// [project] metadata of the pyproject.toml. The py_package depends on the
+// top-level packages of the project, the one named after the distribution
+// and the ones of the entry points of the scripts, whose targets are resolved
+// like imports.
+func generateProjectWheel(
+	args language.GenerateArgs,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	project *pyproject,
+	result *language.GenerateResult,
+	collisionErrors *singlylinkedlist.List,
+) {
+	pkgName, wheelName := wheelTargetNames(project.name)
+	if err := pyprojectTargetCollision(args, result, pkgName, pyPackageKind); err != nil {
+		collisionErrors.Add(err)
+		return
+	}
+	if err := pyprojectTargetCollision(args, result, wheelName, pyWheelKind); err != nil {
+		collisionErrors.Add(err)
+		return
+	}
+
+	// The packages are the directories or the modules of the Bazel package,
+	// relative to the repository root as py_package filters the files of the
+	// wheel by their path.
+	packages := treeset.NewWith(godsutils.StringComparator)
+	modules := treeset.NewWith(godsutils.StringComparator)
+	name := strings.ReplaceAll(pythonconfig.NormalizeDistributionName(project.name), "-", "_")
+	for _, src := range []string{filepath.Join(name, pyLibraryEntrypointFilename), name + ".py"} {
+		if _, err := os.Stat(filepath.Join(args.Dir, src)); err == nil {
+			packages.Add(name)
+			modules.Add(importSpecFromSrc(pythonProjectRoot, args.Rel, src).Imp)
+			break
+		}
+	}
+	modulePrefix := importSpecFromSrc(pythonProjectRoot, args.Rel, "__init__.py").Imp
+	for _, script := range project.scripts {
+		module := script.module()
+		if module == "" {
+			continue
+		}
+		modules.Add(module)
+		if modulePrefix != "" {
+			module = strings.TrimPrefix(module, modulePrefix+".")
+		}
+		topLevel, _, _ := strings.Cut(module, ".")
+		packages.Add(topLevel)
+	}
+	if modules.Empty() {
+		log.Printf("WARNING: %s: no package of the project %q found, skipping its wheel\n",
+			filepath.Join(args.Rel, pyprojectFilename), project.name)
+		return
+	}
+
+	pkgTarget := newTargetBuilder(pyPackageKind, pkgName, pythonProjectRoot, args.Rel, pyFileNames, false).
+		addVisibility(visibility)
+	for _, module := range modules.Values() {
+		pkgTarget.addModuleDependency(Module{
+			Name:     module.(string),
+			Filepath: filepath.Join(args.Rel, pyprojectFilename),
+		})
+	}
+	pkg := pkgTarget.build()
+	var packagePaths []string
+	for _, p := range packages.Values() {
+		packagePaths = append(packagePaths, strings.ReplaceAll(filepath.Join(args.Rel, p.(string)), "/", "."))
+	}
+	pkg.SetAttr("packages", packagePaths)
+	result.Gen = append(result.Gen, pkg)
+	result.Imports = append(result.Imports, pkg.PrivateAttr(config.GazelleImportsKey))
+
+	wheel := newTargetBuilder(pyWheelKind, wheelName, pythonProjectRoot, args.Rel, pyFileNames, false).
+		addVisibility(visibility).
+		build()
+	wheel.SetAttr("distribution", project.name)
+	if project.version != "" {
+		wheel.SetAttr("version", project.version)
+	}
+	if project.description != "" {
+		wheel.SetAttr("summary", project.description)
+	}
+	if project.requiresPython != "" {
+		wheel.SetAttr("python_requires", project.requiresPython)
+	}
+	if len(project.requirements) > 0 {
+		wheel.SetAttr("requires", project.requirements)
+	}
+	if len(project.optionalRequirements) > 0 {
+		wheel.SetAttr("extra_requires", project.optionalRequirements)
+	}
+	entryPoints := make(map[string][]string, len(project.entryPoints)+2)
+	for group, groupEntryPoints := range project.entryPoints {
+		entryPoints[group] = groupEntryPoints
+	}
+	for _, script := range project.scripts {
+		group := "console_scripts"
+		if script.gui {
+			group = "gui_scripts"
+		}
+		entryPoints[group] = append(entryPoints[group], script.name+" = "+script.entryPoint)
+	}
+	if len(entryPoints) > 0 {
+		wheel.SetAttr("entry_points", entryPoints)
+	}
+	// The py.typed markers of the packages are in the data of their
+	// libraries, and so in the wheel.
+	for _, p := range packages.Values() {
+		if isPyTypedPackage(args.Dir, p.(string)) {
+			wheel.SetAttr("classifiers", []string{typedClassifier})
+			break
+		}
+	}
+	if pythonProjectRoot != "" {
+		wheel.SetAttr("strip_path_prefixes", []string{pythonProjectRoot + "/"})
+	}
+	wheel.SetAttr("deps", []string{":" + pkgName})
+	result.Gen = append(result.Gen, wheel)
+	result.Imports = append(result.Imports, wheel.PrivateAttr(config.GazelleImportsKey))
+}
@@ -0,0 +1,121 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+	"github.com/stretchr/testify/require"
+)
+
+func TestParsePyproject(t *testing.T) {
+	code := []byte(`
+[project]
+name = "mycli"
+gui-scripts = { "mycli-gui" = "mycli.gui:main" }
+
+[project.scripts]
+mycli = "mycli.main:main"
+mycli-admin = 'mycli.admin:Admin.run'
+mycli-multi = """
+mycli.multi:main"""
+
+[tool.setuptools]
+scripts = { ignored = "not.a:script" }
+`)
+	project, err := parsePyproject(code)
+	require.NoError(t, err)
+	assert.Equal(t, []projectScript{
+		{name: "mycli", entryPoint: "mycli.main:main", lineNumber: 7},
+		{name: "mycli-admin", entryPoint: "mycli.admin:Admin.run", lineNumber: 8},
+		{name: "mycli-gui", entryPoint: "mycli.gui:main", gui: true, lineNumber: 4},
+		{name: "mycli-multi", entryPoint: "mycli.multi:main", lineNumber: 9},
+	}, project.scripts)
+	assert.Equal(t, "mycli.admin", project.scripts[1].module())
+}
+
+func TestParsePyprojectDependencies(t *testing.T) {
+	code := []byte(`
+[project]
+name = "my_project"
+dependencies = [
+    "requests[socks] >=2.28",  # HTTP
+    'typing-extensions; python_version < "3.11"',
+    "Django",
+]
+
+[project.optional-dependencies]
+test = ["pytest>=8", "requests"]
+all = ["My-Project[test]"]
+`)
+	project, err := parsePyproject(code)
+	require.NoError(t, err)
+	assert.Equal(t, "my_project", project.name)
+	assert.Equal(t, []string{"Django", "pytest", "requests", "typing-extensions"}, project.dependencies)
+	assert.Equal(t, []string{"requests[socks] >=2.28", `typing-extensions; python_version < "3.11"`, "Django"}, project.requirements)
+	assert.Equal(t, map[string][]string{"test": {"pytest>=8", "requests"}, "all": {"My-Project[test]"}}, project.optionalRequirements)
+}
+
+func TestParsePyprojectMetadata(t *testing.T) {
+	code := []byte(`
+[project]
+name = "my-project"
+version = "1.0.0"
+description = "My project."
+requires-python = ">=3.9"
+
+[project.entry-points."my_project.plugins"]
+core = "my_project.plugins:core"
+`)
+	project, err := parsePyproject(code)
+	require.NoError(t, err)
+	assert.Equal(t, "1.0.0", project.version)
+	assert.Equal(t, "My project.", project.description)
+	assert.Equal(t, ">=3.9", project.requiresPython)
+	assert.Equal(t, map[string][]string{"my_project.plugins": {"core = my_project.plugins:core"}}, project.entryPoints)
+}
+
+func TestWheelTargetNames(t *testing.T) {
+	pkg, wheel := wheelTargetNames("My.Project")
+	assert.Equal(t, "my_project_pkg", pkg)
+	assert.Equal(t, "my_project_wheel", wheel)
+}
+
+func TestParsePyprojectErrors(t *testing.T) {
+	_, err := parsePyproject([]byte("[project.scripts]\nmycli = 1\n"))
+	assert.ErrorContains(t, err, `line 2: project.scripts.mycli must be a string`)
+	_, err = parsePyproject([]byte("[project]\ndependencies = [\">=1\"]\n"))
+	assert.ErrorContains(t, err, `line 2: invalid requirement ">=1"`)
+	_, err = parsePyproject([]byte("[project\n"))
+	assert.Error(t, err)
+}
+
+func TestDecodeTOMLString(t *testing.T) {
+	tests := []struct {
+		s    string
+		want string
+	}{
+		{s: `"a\tb"`, want: "a\tb"},
+		{s: `'a\tb'`, want: `a\tb`},
+		{s: "'''\na'b'''", want: "a'b"},
+		{s: "\"\"\"\na\"b\\\"c\nd\"\"\"", want: "a\"b\"c\nd"},
+	}
+	for _, tt := range tests {
+		got, err := decodeTOMLString(tt.s)
+		require.NoError(t, err, tt.s)
+		assert.Equal(t, tt.want, got, tt.s)
+	}
+}
@@ -0,0 +1,203 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	sitter "github.com/smacker/go-tree-sitter"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// pytestMarkersKey is the private attribute of the generated rules holding
+// the pytest markers applied by their sources, see python_pytest_marker.
+const pytestMarkersKey = "_gazelle_python_pytest_markers"
+
+const (
+	sitterNodeTypeDecorator  = "decorator"
+	sitterNodeTypeAssignment = "assignment"
+	// pytestMarkAttribute is the object of the pytest markers, e.g. of
+	// `pytest.mark.slow`.
+	pytestMarkAttribute = "pytest.mark"
+	// pytestMarkVariable is the variable applying markers to all the tests of
+	// a module or a class, e.g. `pytestmark = pytest.mark.slow`.
+	pytestMarkVariable = "pytestmark"
+)
+
+// pytestMarkerNameRe matches the names of the pytest markers.
+var pytestMarkerNameRe = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// testSizes are the sizes of the tests, from the smallest to the largest.
+var testSizes = []string{"small", "medium", "large", "enormous"}
+
+// parsePytestMarker parses the value of the python_pytest_marker directive,
+// e.g. "slow size=large tag=slow". A marker without tags and size maps to a
+// tag named after it.
+func parsePytestMarker(value string) (string, pythonconfig.PytestMarkerAttrs, error) {
+	var marker pythonconfig.PytestMarkerAttrs
+	fields := strings.Fields(value)
+	if len(fields) == 0 || !pytestMarkerNameRe.MatchString(fields[0]) {
+		return "", marker, fmt.Errorf("expected a marker, e.g. \"slow size=large\", got %q", value)
+	}
+	for _, field := range fields[1:] {
+		key, v, _ := strings.Cut(field, "=")
+		switch {
+		case key == "tag" && v != "":
+			marker.Tags = append(marker.Tags, v)
+		case key == "size" && sizeIndex(v) >= 0:
+			marker.Size = v
+		case key == "size":
+			return "", marker, fmt.Errorf("invalid size %q: expected one of %s", v, strings.Join(testSizes, ", "))
+		default:
+			return "", marker, fmt.Errorf("expected tag=TAG or size=SIZE, got %q", field)
+		}
+	}
+	if len(marker.Tags) == 0 && marker.Size == "" {
+		marker.Tags = []string{fields[0]}
+	}
+	return fields[0], marker, nil
+}
+
+// sizeIndex returns the index of the test size in testSizes, or -1.
+func sizeIndex(size string) int {
+	for i, s := range testSizes {
+		if s == size {
+			return i
+		}
+	}
+	return -1
+}
+
+// parsePytestMarkers returns the names of the pytest markers applied by the
+// decorators of the code, e.g. `@pytest.mark.slow` or
+// `@pytest.mark.timeout(60)`, and by the pytestmark variables, sorted.
+func (p *FileParser) parsePytestMarkers(node *sitter.Node) []string {
+	if !bytes.Contains(p.code, []byte(pytestMarkAttribute)) {
+		return nil
+	}
+	markers := make(map[string]bool)
+	var walk func(node *sitter.Node)
+	walk = func(node *sitter.Node) {
+		switch node.Type() {
+		case sitterNodeTypeDecorator:
+			if node.NamedChildCount() > 0 {
+				if name, ok := p.pytestMarkerName(node.NamedChild(0)); ok {
+					markers[name] = true
+				}
+			}
+			return
+		case sitterNodeTypeAssignment:
+			left, right := node.ChildByFieldName("left"), node.ChildByFieldName("right")
+			if left != nil && right != nil && left.Type() == sitterNodeTypeIdentifier && left.Content(p.code) == pytestMarkVariable {
+				p.addPytestMarkers(right, markers)
+				return
+			}
+		}
+		for i := 0; i < int(node.NamedChildCount()); i++ {
+			walk(node.NamedChild(i))
+		}
+	}
+	walk(node)
+	names := make([]string, 0, len(markers))
+	for name := range markers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// addPytestMarkers adds the markers of the value of a pytestmark variable,
+// e.g. a marker or a list of markers, to markers.
+func (p *FileParser) addPytestMarkers(node *sitter.Node, markers map[string]bool) {
+	if name, ok := p.pytestMarkerName(node); ok {
+		markers[name] = true
+		return
+	}
+	for i := 0; i < int(node.NamedChildCount()); i++ {
+		p.addPytestMarkers(node.NamedChild(i), markers)
+	}
+}
+
+// pytestMarkerName returns the name of the marker of the expression, e.g.
+// "slow" for `pytest.mark.slow` or `pytest.mark.slow(reason="...")`.
+func (p *FileParser) pytestMarkerName(node *sitter.Node) (string, bool) {
+	if node.Type() == sitterNodeTypeCall {
+		node = node.ChildByFieldName("function")
+		if node == nil {
+			return "", false
+		}
+	}
+	if node.Type() != sitterNodeTypeAttribute {
+		return "", false
+	}
+	object, attribute := node.ChildByFieldName("object"), node.ChildByFieldName("attribute")
+	if object == nil || attribute == nil || object.Content(p.code) != pytestMarkAttribute {
+		return "", false
+	}
+	return attribute.Content(p.code), true
+}
+
+// setPytestMarkerAttrs sets the tags and the size of the py_test targets
+// generated in the package from the pytest markers applied by their files,
+// mapped by python_pytest_marker. The tags of the mapped markers are managed:
+// the ones of the markers no longer applied are removed. The size is set to
+// the largest one of the markers, and left untouched otherwise. Rules and
+// attributes marked with a "# keep" comment are left untouched.
+func setPytestMarkerAttrs(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if !cfg.HasPytestMarkers() {
+		return
+	}
+	for _, r := range gen {
+		if r.Kind() != pyTestKind {
+			continue
+		}
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		var tags []string
+		added := make(map[string]bool)
+		size := -1
+		markers, _ := r.PrivateAttr(pytestMarkersKey).([]string)
+		for _, name := range markers {
+			marker, ok := cfg.PytestMarker(name)
+			if !ok {
+				continue
+			}
+			for _, tag := range marker.Tags {
+				if !added[tag] {
+					added[tag] = true
+					tags = append(tags, tag)
+				}
+			}
+			if i := sizeIndex(marker.Size); i > size {
+				size = i
+			}
+		}
+		if !attrShouldKeep(target, "tags") {
+			replaceTags(target, cfg.IsPytestMarkerTag, tags)
+		}
+		if size >= 0 && !attrShouldKeep(target, "size") {
+			target.SetAttr("size", testSizes[size])
+		}
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestParsePytestMarker(t *testing.T) {
+	name, marker, err := parsePytestMarker("slow size=large tag=slow tag=nightly")
+	assert.NoError(t, err)
+	assert.Equal(t, "slow", name)
+	assert.Equal(t, pythonconfig.PytestMarkerAttrs{Tags: []string{"slow", "nightly"}, Size: "large"}, marker)
+
+	name, marker, err = parsePytestMarker("integration")
+	assert.NoError(t, err)
+	assert.Equal(t, "integration", name)
+	assert.Equal(t, pythonconfig.PytestMarkerAttrs{Tags: []string{"integration"}}, marker)
+
+	for _, value := range []string{"", "pytest.mark.slow", "slow size=huge", "slow tag=", "slow timeout=60"} {
+		_, _, err := parsePytestMarker(value)
+		assert.Error(t, err, value)
+	}
+}
@@ -0,0 +1,108 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"context"
+	"log"
+	"os"
+	"path"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+)
+
+// reExports returns the names re-exported by the __init__.py file of the
+// package module, relative to the Python project root, mapped to the absolute
+// modules they come from. The files are parsed once.
+func (py *Resolver) reExports(repoRoot, pythonProjectRoot, module string) map[string]string {
+	rel := path.Join(pythonProjectRoot, strings.ReplaceAll(module, ".", "/"))
+	py.mu.Lock()
+	reExports, ok := py.reExportsCache[rel]
+	py.mu.Unlock()
+	if ok {
+		return reExports
+	}
+	output, err := py.cache.parseFile(context.Background(), NewFileParser(), repoRoot, rel, pyLibraryEntrypointFilename)
+	if err != nil && !os.IsNotExist(err) {
+		log.Printf("WARNING: failed to parse the re-exports of %q: %v", path.Join(rel, pyLibraryEntrypointFilename), err)
+	}
+	if err == nil && len(output.ReExports) > 0 {
+		reExports = make(map[string]string, len(output.ReExports))
+		for name, reExport := range output.ReExports {
+			reExports[name] = absoluteReExport(module, reExport)
+		}
+	}
+	py.mu.Lock()
+	defer py.mu.Unlock()
+	if py.reExportsCache == nil {
+		py.reExportsCache = make(map[string]map[string]string)
+	}
+	py.reExportsCache[rel] = reExports
+	return reExports
+}
+
+// absoluteReExport returns the absolute module of a re-export of the package
+// module, e.g. foo.impl.bar for .impl.bar in the package foo.
+func absoluteReExport(module, reExport string) string {
+	relativeDepth := len(reExport) - len(strings.TrimLeft(reExport, "."))
+	if relativeDepth == 0 {
+		return reExport
+	}
+	parts := strings.Split(module, ".")
+	if relativeDepth-1 > len(parts) {
+		return strings.TrimLeft(reExport, ".")
+	}
+	parts = parts[:len(parts)-(relativeDepth-1)]
+	if rest := reExport[relativeDepth:]; rest != "" {
+		parts = append(parts, rest)
+	}
+	return strings.Join(parts, ".")
+}
+
+// reExportDependency returns the dependency on the target implementing the
+// name imported from the package module, when its __init__.py file
+// re-exports it from a submodule, e.g. for `from foo import bar` with
+// `from .impl.bar import bar` in foo/__init__.py. Only one level of
+// re-exports is followed, and only to first-party targets.
+func (py *Resolver) reExportDependency(
+	c *config.Config,
+	ix *resolve.RuleIndex,
+	from label.Label,
+	pythonProjectRoot string,
+	module string,
+	imported string,
+) (string, bool) {
+	name, _, _ := strings.Cut(strings.TrimPrefix(imported, module+"."), ".")
+	reExport, ok := py.reExports(c.RepoRoot, pythonProjectRoot, module)[name]
+	if !ok {
+		return "", false
+	}
+	// Only the submodules of the package are followed, so that the import
+	// doesn't resolve to the __init__.py file again.
+	for candidate := reExport; strings.HasPrefix(candidate, module+"."); {
+		matches := ix.FindRulesByImportWithConfig(c, resolve.ImportSpec{Lang: languageName, Imp: candidate}, languageName)
+		if len(matches) == 1 && !matches[0].IsSelfImport(from) && !py.isSelfImport(matches[0].Label, from) {
+			return matches[0].Label.Rel(from.Repo, from.Pkg).String(), true
+		} else if len(matches) > 0 {
+			return "", false
+		}
+		i := strings.LastIndex(candidate, ".")
+		candidate = candidate[:i]
+	}
+	return "", false
+}
@@ -0,0 +1,31 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/stretchr/testify/assert"
+)
+
+func TestAbsoluteReExport(t *testing.T) {
+	assert.Equal(t, "foo.models.User", absoluteReExport("foo", "foo.models.User"))
+	assert.Equal(t, "foo.impl.bar.bar", absoluteReExport("foo", ".impl.bar.bar"))
+	assert.Equal(t, "foo.impl", absoluteReExport("foo", ".impl"))
+	assert.Equal(t, "foo.sibling.name", absoluteReExport("foo.bar", "..sibling.name"))
+	assert.Equal(t, "foo", absoluteReExport("foo.bar", ".."))
+	// Beyond the top-level package.
+	assert.Equal(t, "name", absoluteReExport("foo", "...name"))
+}
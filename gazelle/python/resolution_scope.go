@@ -0,0 +1,45 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// projectMatches returns the matches that belong to the Python project of the
+// target from, i.e. whose package has the same python_root. The targets of
+// the external repositories and of the packages without a config belong to
+// every project.
+func projectMatches(cfgs pythonconfig.Configs, matches []resolve.FindResult, from label.Label) []resolve.FindResult {
+	pythonProjectRoot := cfgs[from.Pkg].PythonProjectRoot()
+	scoped := make([]resolve.FindResult, 0, len(matches))
+	for _, match := range matches {
+		if match.Label.Repo != "" && match.Label.Repo != from.Repo {
+			scoped = append(scoped, match)
+			continue
+		}
+		cfg, ok := cfgs[match.Label.Pkg]
+		if !ok {
+			cfg = cfgs.ParentForPackage(match.Label.Pkg)
+		}
+		if cfg == nil || cfg.PythonProjectRoot() == pythonProjectRoot {
+			scoped = append(scoped, match)
+		}
+	}
+	return scoped
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestProjectMatches(t *testing.T) {
+	root := pythonconfig.New("/repo", "")
+	projectA := root.NewChild()
+	projectA.SetPythonProjectRoot("projects/a")
+	projectB := root.NewChild()
+	projectB.SetPythonProjectRoot("projects/b")
+	cfgs := pythonconfig.Configs{
+		"":                  root,
+		"projects/a":        projectA,
+		"projects/a/app":    projectA.NewChild(),
+		"projects/b":        projectB,
+		"projects/b/common": projectB.NewChild(),
+	}
+	var matches []resolve.FindResult
+	for _, target := range []string{
+		"//projects/a/common:common",
+		"//projects/b/common:common",
+		"//projects/b/common/sub:sub",
+		"//tools:tools",
+		"@pypi//requests:pkg",
+	} {
+		l, err := label.Parse(target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		matches = append(matches, resolve.FindResult{Label: l})
+	}
+
+	var got []string
+	for _, match := range projectMatches(cfgs, matches, label.New("", "projects/a/app", "app")) {
+		got = append(got, match.Label.String())
+	}
+	assert.Equal(t, []string{"//projects/a/common", "@pypi//requests:pkg"}, got)
+
+	got = nil
+	for _, match := range projectMatches(cfgs, matches, label.New("", "projects/b/common", "common")) {
+		got = append(got, match.Label.String())
+	}
+	assert.Equal(t, []string{"//projects/b/common", "//projects/b/common/sub", "@pypi//requests:pkg"}, got)
+}
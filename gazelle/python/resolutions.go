@@ -0,0 +1,229 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// resolutionStrategy is the way an import was resolved.
+type resolutionStrategy string
+
+const (
+	// resolutionStrategyOverride is used when the import matched a
+	// gazelle:resolve or gazelle:resolve_regexp directive.
+	resolutionStrategyOverride resolutionStrategy = "override"
+	// resolutionStrategyThirdParty is used when the import was found in the
+	// manifest.
+	resolutionStrategyThirdParty resolutionStrategy = "third_party"
+	// resolutionStrategyIndex is used when the import was found in the index of
+	// the first-party targets.
+	resolutionStrategyIndex resolutionStrategy = "index"
+	// resolutionStrategyExternal is used when the import was found in the
+	// index of an external repository, see python_external_repository.
+	resolutionStrategyExternal resolutionStrategy = "external"
+	// resolutionStrategyNamespace is used when the import is an implicit
+	// namespace package, resolved to all the targets providing its modules.
+	resolutionStrategyNamespace resolutionStrategy = "namespace"
+	// resolutionStrategyAncestor is used when no target provides the import,
+	// resolved to the target of its deepest ancestor package, see
+	// python_resolve_ancestor_package.
+	resolutionStrategyAncestor resolutionStrategy = "ancestor"
+	// resolutionStrategyGenerated is used when the import is a module
+	// generated at build time, declared with the python_generated_module
+	// directive or the py_generated tag.
+	resolutionStrategyGenerated resolutionStrategy = "generated"
+	// resolutionStrategyNative is used when the import is a native extension
+	// module, declared with the python_native_module directive or the
+	// python_extension tag.
+	resolutionStrategyNative resolutionStrategy = "native"
+	// resolutionStrategyOpaque is used when the import is provided by an
+	// opaque library, declared with the python_opaque directive.
+	resolutionStrategyOpaque resolutionStrategy = "opaque"
+	// resolutionStrategyStdlib is used when the import is part of the standard
+	// library.
+	resolutionStrategyStdlib resolutionStrategy = "stdlib"
+	// resolutionStrategySelf is used when the import is provided by the
+	// target importing it.
+	resolutionStrategySelf resolutionStrategy = "self"
+	// resolutionStrategyUnresolved is used when the import couldn't be
+	// resolved.
+	resolutionStrategyUnresolved resolutionStrategy = "unresolved"
+)
+
+// resolutionDecision records how an import of a target was resolved.
+type resolutionDecision struct {
+	// Target is the label of the target the dependency is attached to.
+	Target string `json:"target"`
+	File   string `json:"file"`
+	Line   uint32 `json:"line"`
+	// Import is the imported module, as written in the file.
+	Import string `json:"import"`
+	// Module is the module that was resolved, which can be a parent of the
+	// imported module.
+	Module   string             `json:"module,omitempty"`
+	Strategy resolutionStrategy `json:"strategy"`
+	// Label is the resolved dependency, if any.
+	Label string `json:"label,omitempty"`
+}
+
+// key identifies the decision when comparing recorded decisions. It doesn't
+// include the line, so that moving an import doesn't count as a change.
+func (d resolutionDecision) key() string {
+	return d.Target + "\x00" + d.File + "\x00" + d.Import
+}
+
+func (d resolutionDecision) String() string {
+	if d.Label == "" {
+		return string(d.Strategy)
+	}
+	return fmt.Sprintf("%s %s", d.Strategy, d.Label)
+}
+
+// resolutionsFile is the format of the files written by
+// -python_record_resolutions and read by -python_verify_resolutions.
+type resolutionsFile struct {
+	Resolutions []resolutionDecision `json:"resolutions"`
+}
+
+// recordResolution records a resolution decision for the import mod of the
+// target from, if recording is enabled.
+func (py *Resolver) recordResolution(
+	from label.Label,
+	mod Module,
+	moduleName string,
+	strategy resolutionStrategy,
+	dep string,
+) {
+	if !py.recordResolutions {
+		return
+	}
+	py.mu.Lock()
+	defer py.mu.Unlock()
+	if dep != "" {
+		if l, err := label.Parse(dep); err == nil {
+			dep = l.Abs(from.Repo, from.Pkg).String()
+		}
+	}
+	py.resolutions = append(py.resolutions, resolutionDecision{
+		Target:   from.String(),
+		File:     mod.Filepath,
+		Line:     mod.LineNumber,
+		Import:   mod.Name,
+		Module:   moduleName,
+		Strategy: strategy,
+		Label:    dep,
+	})
+}
+
+// sortResolutions sorts the decisions by target, file, line and import.
+func sortResolutions(resolutions []resolutionDecision) {
+	sort.SliceStable(resolutions, func(i, j int) bool {
+		a, b := resolutions[i], resolutions[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		if a.Line != b.Line {
+			return a.Line < b.Line
+		}
+		return a.Import < b.Import
+	})
+}
+
+// writeResolutions writes the decisions as JSON to the given path.
+func writeResolutions(path string, resolutions []resolutionDecision) error {
+	f := resolutionsFile{Resolutions: resolutions}
+	if f.Resolutions == nil {
+		f.Resolutions = []resolutionDecision{}
+	}
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the resolutions: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the resolutions: %w", err)
+	}
+	return nil
+}
+
+// readResolutions reads the decisions written by writeResolutions.
+func readResolutions(path string) ([]resolutionDecision, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read the resolutions: %w", err)
+	}
+	var f resolutionsFile
+	if err := json.Unmarshal(data, &f); err != nil {
+		return nil, fmt.Errorf("failed to decode the resolutions from %q: %w", path, err)
+	}
+	return f.Resolutions, nil
+}
+
+// diffResolutions compares the recorded decisions with the actual ones, and
+// returns a human-readable description of each difference.
+func diffResolutions(recorded, actual []resolutionDecision) []string {
+	recordedByKey := make(map[string]resolutionDecision, len(recorded))
+	for _, d := range recorded {
+		recordedByKey[d.key()] = d
+	}
+	actualByKey := make(map[string]resolutionDecision, len(actual))
+	for _, d := range actual {
+		actualByKey[d.key()] = d
+	}
+
+	var diffs []string
+	for _, d := range actual {
+		r, ok := recordedByKey[d.key()]
+		switch {
+		case !ok:
+			diffs = append(diffs, fmt.Sprintf("%s: %q, line %d: %q: new decision: %s",
+				d.Target, d.File, d.Line, d.Import, d))
+		case r.Strategy != d.Strategy || r.Label != d.Label:
+			diffs = append(diffs, fmt.Sprintf("%s: %q, line %d: %q: recorded %s, got %s",
+				d.Target, d.File, d.Line, d.Import, r, d))
+		}
+	}
+	for _, r := range recorded {
+		if _, ok := actualByKey[r.key()]; !ok {
+			diffs = append(diffs, fmt.Sprintf("%s: %q, line %d: %q: recorded %s, but the import wasn't resolved",
+				r.Target, r.File, r.Line, r.Import, r))
+		}
+	}
+	sort.Strings(diffs)
+	return diffs
+}
+
+// verifyResolutions compares the decisions recorded in the given file with the
+// actual ones, returning an error describing the differences.
+func verifyResolutions(path string, actual []resolutionDecision) error {
+	recorded, err := readResolutions(path)
+	if err != nil {
+		return err
+	}
+	diffs := diffResolutions(recorded, actual)
+	if len(diffs) == 0 {
+		return nil
+	}
+	return fmt.Errorf("%d resolution(s) differ from %q:\n\t%s", len(diffs), path, strings.Join(diffs, "\n\t"))
+}
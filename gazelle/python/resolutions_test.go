@@ -0,0 +1,66 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestRecordAndVerifyResolutions(t *testing.T) {
+	r := Resolver{recordResolutions: true}
+	from := label.New("", "app", "app")
+	r.recordResolution(from, Module{Name: "requests", Filepath: "app/main.py", LineNumber: 2}, "requests", resolutionStrategyThirdParty, "@pip//requests")
+	r.recordResolution(from, Module{Name: "lib.util", Filepath: "app/main.py", LineNumber: 1}, "lib", resolutionStrategyIndex, "//lib")
+	r.recordResolution(from, Module{Name: "os", Filepath: "app/main.py", LineNumber: 3}, "os", resolutionStrategyStdlib, "")
+	sortResolutions(r.resolutions)
+	assert.Equal(t, []resolutionDecision{
+		{Target: "//app", File: "app/main.py", Line: 1, Import: "lib.util", Module: "lib", Strategy: resolutionStrategyIndex, Label: "//lib"},
+		{Target: "//app", File: "app/main.py", Line: 2, Import: "requests", Module: "requests", Strategy: resolutionStrategyThirdParty, Label: "@pip//requests"},
+		{Target: "//app", File: "app/main.py", Line: 3, Import: "os", Module: "os", Strategy: resolutionStrategyStdlib},
+	}, r.resolutions)
+
+	path := filepath.Join(t.TempDir(), "resolutions.json")
+	if !assert.NoError(t, writeResolutions(path, r.resolutions)) {
+		return
+	}
+	assert.NoError(t, verifyResolutions(path, r.resolutions))
+
+	// Moving an import isn't a difference.
+	moved := append([]resolutionDecision{}, r.resolutions...)
+	moved[2].Line = 10
+	assert.NoError(t, verifyResolutions(path, moved))
+
+	changed := []resolutionDecision{
+		{Target: "//app", File: "app/main.py", Line: 1, Import: "lib.util", Module: "lib.util", Strategy: resolutionStrategyIndex, Label: "//lib/util"},
+		r.resolutions[1],
+		{Target: "//app", File: "app/main.py", Line: 4, Import: "yaml", Module: "yaml", Strategy: resolutionStrategyUnresolved},
+	}
+	assert.Equal(t, []string{
+		`//app: "app/main.py", line 1: "lib.util": recorded index //lib, got index //lib/util`,
+		`//app: "app/main.py", line 3: "os": recorded stdlib, but the import wasn't resolved`,
+		`//app: "app/main.py", line 4: "yaml": new decision: unresolved`,
+	}, diffResolutions(r.resolutions, changed))
+	assert.Error(t, verifyResolutions(path, changed))
+}
+
+func TestRecordResolutionDisabled(t *testing.T) {
+	var r Resolver
+	r.recordResolution(label.New("", "app", "app"), Module{Name: "os"}, "os", resolutionStrategyStdlib, "")
+	assert.Empty(t, r.resolutions)
+}
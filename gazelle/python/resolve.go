@@ -20,6 +20,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 
 	"github.com/bazelbuild/bazel-gazelle/config"
 	"github.com/bazelbuild/bazel-gazelle/label"
@@ -39,11 +40,142 @@ const (
 	// resolvedDepsKey is the attribute key used to pass dependencies that don't
 	// need to be resolved by the dependency resolver in the Resolver step.
 	resolvedDepsKey = "_gazelle_python_resolved_deps"
+	// srcsForOrderingKey is the attribute key used to pass the srcs of the
+	// generated rules to the deps order, which places the targets in the layer
+	// of their sources. Unlike the srcs attribute, it survives the mapped kinds
+	// whose macros take the sources under another name, as well as the merges
+	// keeping the srcs of the existing rules.
+	srcsForOrderingKey = "_gazelle_python_srcs_for_ordering"
+	// protoModuleSuffix is the suffix of the modules generated by
+	// py_proto_library from each .proto file.
+	protoModuleSuffix = "_pb2"
+	// grpcModuleSuffix is the suffix of the modules generated by
+	// py_grpc_library from each .proto file.
+	grpcModuleSuffix = "_pb2_grpc"
 )
 
 // Resolver satisfies the resolve.Resolver interface. It resolves dependencies
 // in rules generated by this extension.
-type Resolver struct{}
+type Resolver struct {
+	// importGraph is the first-party dependency graph between the resolved
+	// targets, used to detect import cycles.
+	importGraph importGraph
+	// recordResolutions enables the recording of the resolution decisions,
+	// used by the -python_record_resolutions and -python_verify_resolutions
+	// flags.
+	recordResolutions bool
+	// resolutions are the recorded resolution decisions.
+	resolutions []resolutionDecision
+	// explainDependency is the dependency explained in the logs, set by the
+	// -python_explain_dependency flag.
+	explainDependency label.Label
+	// distributions maps each resolved target to the third-party
+	// distributions it imports at runtime, used to weigh the binaries and to
+	// annotate the targets with their licenses.
+	distributions map[string]map[string]bool
+	// optionalImports maps each resolved target to the modules it imports
+	// optionally, when python_optional_imports is set to tag.
+	optionalImports map[string]map[string]bool
+	// unresolvedImports are the imports left unresolved when
+	// python_unresolved_imports is set to tag.
+	unresolvedImports []unresolvedImport
+	// visibilities maps the indexed targets to their visibility, used by
+	// python_resolve_visibility.
+	visibilities map[string][]string
+	// testonlyTargets are the indexed targets that are testonly, see
+	// python_testonly_dirs.
+	testonlyTargets map[string]bool
+	// stubLibraries are the indexed py_library targets with type stubs only,
+	// see recordStubLibrary.
+	stubLibraries map[string]bool
+	// statCache caches the files looked up when python_implicit_namespace_packages
+	// is disabled, see stat.
+	statCache map[string]os.FileInfo
+	// ignoreModules are the modules read from the file given to the
+	// -python_add_ignore_annotations flag.
+	ignoreModules map[string]bool
+	// ignoreAnnotations maps the Python files to the modules to annotate with
+	// "# gazelle:ignore", by line, see -python_add_ignore_annotations.
+	ignoreAnnotations map[string]map[int][]string
+	// reExportsCache maps the packages to the names re-exported by their
+	// __init__.py files, see reExports.
+	reExportsCache map[string]map[string]string
+	// profile aggregates the time spent by the resolution strategies when the
+	// -python_profile_output flag is set.
+	profile *resolutionProfile
+	// bazelIgnoredDirs are the directories listed in .bazelignore.
+	bazelIgnoredDirs []string
+	// cache is the cache of the parsing and of the resolution, set by the
+	// -python_cache_file flag.
+	cache *resolutionCache
+	// mu guards the caches shared by the concurrent resolutions of the rules:
+	// statCache, reExportsCache, ignoreAnnotations and resolutions.
+	mu sync.Mutex
+	// pendingResolutions maps the generated rules to their resolutions,
+	// computed concurrently once the index is built.
+	pendingResolutions map[*rule.Rule]*ruleResolution
+	// pendingOrder are the pending resolutions, in the order of the
+	// generation of their rules.
+	pendingOrder []*ruleResolution
+	// resolutionsStarted is set once the pending resolutions are started.
+	resolutionsStarted bool
+	// resolutionsDone is closed once Gazelle resolved all the rules.
+	resolutionsDone chan struct{}
+	// resolutionWindow bounds the number of resolutions computed ahead of
+	// Gazelle, set by the -python_max_memory flag. Nil when unbounded.
+	resolutionWindow chan struct{}
+	// releasedResolutions is the number of slots of the window freed.
+	releasedResolutions int
+	// resolutionWorkers are the goroutines computing the pending resolutions.
+	resolutionWorkers sync.WaitGroup
+	// depsToRemoveReport justifies the deps_to_remove entries, set by the
+	// -python_deps_to_remove_report flag.
+	depsToRemoveReport *depsToRemoveReport
+	// depsOrderIndex maps the targets to their layer, set by the
+	// -python_deps_order_index flag.
+	depsOrderIndex *depsOrderIndex
+	// wheelAudit records the distributions without a wheel for some target
+	// platforms, set by the -python_wheel_audit flag.
+	wheelAudit *wheelAudit
+	// packageData maps each resolved target to the labels of the package data
+	// files read by its sources, see python_package_data.
+	packageData map[string]map[string]bool
+	// generatedPackages are the packages where Gazelle generates rules, which
+	// own the package data files below them.
+	generatedPackages map[string]bool
+	// runErrors are the validation errors of the generated targets, by
+	// package. The run fails once all the targets are resolved, before any
+	// file is written.
+	runErrors runErrors
+	// externalIndexes are the indexes of the external repositories, keyed by
+	// name and checkout, see python_external_repository. Guarded by mu.
+	externalIndexes map[string]externalIndex
+	// ruleIndex is the index of the rules, kept to resolve the dependents of
+	// the changed targets once Gazelle resolved the rules.
+	ruleIndex *resolve.RuleIndex
+	// namespaceProviders maps the implicit namespace packages to the targets
+	// providing their modules, by label, see addNamespaceProviders.
+	namespaceProviders map[string]map[string]label.Label
+	// packageLibraries maps the directories of the Python packages to their
+	// py_library targets, see addPackageLibrary.
+	packageLibraries map[string][]packageLibrary
+	// aliases maps the alias rules of the packages with indexed targets to
+	// their actual target, aliasedPackages are these packages, and
+	// indexedSources maps the indexed targets to their Python sources, see
+	// isSelfImport.
+	aliases         map[string]label.Label
+	aliasedPackages map[string]bool
+	indexedSources  map[string]map[string]bool
+	// repoRoot is the root of the repository, visitedPackages and
+	// generatedTargets are the packages visited by the run and the targets
+	// generated in them, and packageConfigs maps the indexed packages to their
+	// configuration. They're recorded with the cache only, see
+	// reresolveDependents.
+	repoRoot         string
+	visitedPackages  map[string]bool
+	generatedTargets map[string]bool
+	packageConfigs   map[string]*config.Config
+}
 
 // Name returns the name of the language. This is the prefix of the kinds of
 // rules generated. E.g. py_library and py_binary.
@@ -55,15 +187,74 @@ func (*Resolver) Name() string { return languageName }
 // If nil is returned, the rule will not be indexed. If any non-nil slice is
 // returned, including an empty slice, the rule will be indexed.
 func (py *Resolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
+	if r.Kind() == genruleKind {
+		// The notebooks converted by the genrules are indexed through their
+		// py_library, see python_notebook_converter.
+		return nil
+	}
+	if c.Exts[languageName].(pythonconfig.Configs)[f.Pkg].IsOpaquePackage(f.Pkg) {
+		// The modules of the opaque directories resolve to their library
+		// only, see python_opaque.
+		return nil
+	}
+	defer unwrapRuleMacro(c.Exts[languageName].(pythonconfig.Configs)[f.Pkg], r)()
+	py.recordAliases(c.RepoName, f)
+	expandSrcsGlob(filepath.Join(c.RepoRoot, f.Pkg), r)
+	provides := py.ruleImports(c, r, f)
+	if py.cache != nil {
+		if py.packageConfigs == nil {
+			py.packageConfigs = make(map[string]*config.Config)
+		}
+		py.packageConfigs[f.Pkg] = c
+	}
+	if provides != nil {
+		target := label.New(c.RepoName, f.Pkg, r.Name())
+		py.cache.addIndexed(c.RepoRoot, target, r, provides, py.visibilities[target.String()])
+		if cfg := c.Exts[languageName].(pythonconfig.Configs)[f.Pkg]; cfg.ImplicitNamespacePackages() {
+			py.addNamespaceProviders(c.RepoRoot, cfg.PythonProjectRoot(), target, provides)
+		}
+		py.addPackageLibrary(target, r)
+		py.recordIndexedSources(target, r)
+	}
+	return provides
+}
+
+// ruleImports returns the ImportSpecs provided by the rule r, see Imports.
+func (py *Resolver) ruleImports(c *config.Config, r *rule.Rule, f *rule.File) []resolve.ImportSpec {
 	cfgs := c.Exts[languageName].(pythonconfig.Configs)
 	cfg := cfgs[f.Pkg]
-	srcs := r.AttrStrings("srcs")
+	py.recordVisibility(c.RepoName, r, f)
+	py.recordTestonly(c.RepoName, r, f)
+	// Mapped kinds are translated back to the kinds of this extension before
+	// calling Imports.
+	switch r.Kind() {
+	case pyProtoLibraryKind:
+		protos := r.AttrStrings("deps")
+		// The deps of the generated py_proto_library targets are only set
+		// when resolving them.
+		if resolvedDeps, ok := r.PrivateAttr(resolvedDepsKey).(*treeset.Set); ok {
+			for _, dep := range resolvedDeps.Values() {
+				protos = append(protos, dep.(string))
+			}
+		}
+		return protoImports(cfg.PythonProjectRoot(), f, protos, protoModuleSuffix)
+	case pyGrpcLibraryKind:
+		return protoImports(cfg.PythonProjectRoot(), f, r.AttrStrings("srcs"), grpcModuleSuffix)
+	case pyxLibraryKind:
+		return cythonImports(cfg.PythonProjectRoot(), f.Pkg, r)
+	}
+	srcs := ruleSrcs(r)
+	py.recordStubLibrary(c.RepoName, r, f, srcs)
 	provides := make([]resolve.ImportSpec, 0, len(srcs)+1)
 	for _, src := range srcs {
 		ext := filepath.Ext(src)
 		if ext != ".py" {
 			continue
 		}
+		if matchesAnyGlob(filepath.Base(src), cfg.ToolingFilePattern()) {
+			// Tooling files, e.g. setup.py, aren't importable modules.
+			continue
+		}
 		if cfg.PerFileGeneration() && len(srcs) > 1 && src == pyLibraryEntrypointFilename {
 			// Do not provide import spec from __init__.py when it is being included as
 			// part of another module.
@@ -73,6 +264,37 @@ func (py *Resolver) Imports(c *config.Config, r *rule.Rule, f *rule.File) []reso
 		provide := importSpecFromSrc(pythonProjectRoot, f.Pkg, src)
 		provides = append(provides, provide)
 	}
+	provides = append(provides, stubImports(cfg.PythonProjectRoot(), f.Pkg, r, srcs)...)
+	if len(provides) == 0 {
+		return nil
+	}
+	return provides
+}
+
+// protoImports returns the ImportSpecs of the modules generated from the
+// sources of the proto_library targets of the same file among protos, e.g.
+// foo_pb2 for foo.proto with the "_pb2" suffix. It is used to index the
+// py_proto_library and py_grpc_library targets.
+func protoImports(pythonProjectRoot string, f *rule.File, protos []string, suffix string) []resolve.ImportSpec {
+	var provides []resolve.ImportSpec
+	for _, proto := range protos {
+		l, err := label.Parse(proto)
+		if err != nil || l.Repo != "" || (l.Pkg != f.Pkg && !l.Relative) {
+			continue
+		}
+		for _, r := range f.Rules {
+			if r.Kind() != "proto_library" || r.Name() != l.Name {
+				continue
+			}
+			for _, src := range r.AttrStrings("srcs") {
+				if filepath.Ext(src) != ".proto" {
+					continue
+				}
+				src = strings.TrimSuffix(src, ".proto") + suffix + ".py"
+				provides = append(provides, importSpecFromSrc(pythonProjectRoot, f.Pkg, src))
+			}
+		}
+	}
 	if len(provides) == 0 {
 		return nil
 	}
@@ -137,6 +359,26 @@ func addDependency(dep string, typeCheckingOnly bool, deps, pyiDeps *treeset.Set
 	}
 }
 
+// addModuleDependency adds a dependency resolved from the import mod. If the
+// import is guarded by a sys.platform check, the dependency is only added for
+// the matching platforms.
+func addModuleDependency(dep string, mod Module, deps, pyiDeps *treeset.Set, platformDeps map[string]*treeset.Set) {
+	if len(mod.Platforms) > 0 && !mod.TypeCheckingOnly {
+		addPlatformDependency(dep, mod.Platforms, platformDeps)
+		return
+	}
+	addDependency(dep, mod.TypeCheckingOnly, deps, pyiDeps)
+}
+
+// addDependencySource records mod as an import that introduced dep, and as
+// the first one unless another import introduced it already.
+func (res *ruleResolution) addDependencySource(dep string, mod Module) {
+	if _, ok := res.depSources[dep]; !ok {
+		res.depSources[dep] = mod
+	}
+	res.depImports[dep] = append(res.depImports[dep], mod)
+}
+
 // Resolve translates imported libraries for a given rule into Bazel
 // dependencies. Information about imported libraries is returned for each
 // rule generated by language.GenerateRules in
@@ -154,219 +396,627 @@ func (py *Resolver) Resolve(
 	// TODO(f0rmiga): may need to be defensive here once this Gazelle extension
 	// join with the main Gazelle binary with other rules. It may conflict with
 	// other generators that generate py_* targets.
-	deps := treeset.NewWith(godsutils.StringComparator)
-	pyiDeps := treeset.NewWith(godsutils.StringComparator)
+	if r.Kind() == genruleKind {
+		// The genrules converting the notebooks have no dependencies.
+		return
+	}
+	defer unwrapRuleMacro(c.Exts[languageName].(pythonconfig.Configs)[from.Pkg], r)()
+	if !py.resolutionsStarted {
+		py.startResolutions(ix)
+	}
+	res, ok := py.takeResolution(r, from)
+	if !ok {
+		res = py.newRuleResolution(c, modulesRaw, from)
+		res.cacheKey = py.resolutionCacheKey(from, res.modules)
+		py.resolveModules(ix, res)
+	}
+	py.applyResolution(r, res)
+}
+
+// resolveModules resolves the imports of the rule of res. It runs concurrently
+// with the resolution of the other rules, so it only reads the shared state,
+// guarded by mu when it's a cache, and records everything else in res.
+func (py *Resolver) resolveModules(ix *resolve.RuleIndex, res *ruleResolution) {
+	c, from := res.c, res.from
+	deps, pyiDeps, platformDeps := res.deps, res.pyiDeps, res.platformDeps
 	cfgs := c.Exts[languageName].(pythonconfig.Configs)
 	cfg := cfgs[from.Pkg]
 
-	if modulesRaw != nil {
-		pythonProjectRoot := cfg.PythonProjectRoot()
-		modules := modulesRaw.(*treeset.Set)
-		it := modules.Iterator()
-		explainDependency := os.Getenv("EXPLAIN_DEPENDENCY")
-		hasFatalError := false
-	MODULES_LOOP:
-		for it.Next() {
-			mod := it.Value().(Module)
-			moduleName := mod.Name
-			// Transform relative imports `.` or `..foo.bar` into the package path from root.
-			if strings.HasPrefix(mod.From, ".") {
-				if !cfg.ExperimentalAllowRelativeImports() {
-					continue MODULES_LOOP
-				}
-
-				// Count number of leading dots in mod.From (e.g., ".." = 2, "...foo.bar" = 3)
-				relativeDepth := strings.IndexFunc(mod.From, func(r rune) bool { return r != '.' })
-				if relativeDepth == -1 {
-					relativeDepth = len(mod.From)
-				}
+	if cached, ok := py.cache.resolution(from, res.cacheKey); ok {
+		res.replay(cached)
+		return
+	}
+	if res.modules == nil {
+		return
+	}
+	pythonProjectRoot := cfg.PythonProjectRoot()
+	it := res.modules.Iterator()
+MODULES_LOOP:
+	for it.Next() {
+		mod := it.Value().(Module)
+		moduleName := mod.Name
+		if py.annotateIgnore(c.RepoRoot, mod) {
+			continue MODULES_LOOP
+		}
+		if mod.Optional {
+			switch cfg.OptionalImportsMode() {
+			case pythonconfig.OptionalImportsModeIgnore:
+				continue MODULES_LOOP
+			case pythonconfig.OptionalImportsModeTag:
+				res.optionalImports = append(res.optionalImports, mod.Name)
+				continue MODULES_LOOP
+			}
+		}
+		// Optional imports that can't be resolved aren't errors, unless
+		// they're added like any other import. Neither are the forward
+		// references, which may be local names.
+		validateImport := cfg.ValidateImportStatements() && !mod.ForwardReference &&
+			(!mod.Optional || cfg.OptionalImportsMode() == pythonconfig.OptionalImportsModeAdd)
+		// Transform relative imports `.` or `..foo.bar` into the package path from root.
+		if strings.HasPrefix(mod.From, ".") {
+			if !cfg.ExperimentalAllowRelativeImports() {
+				continue MODULES_LOOP
+			}
 
-				// Extract final symbol (e.g., "some_function") from mod.Name
-				imported := mod.Name
-				if idx := strings.LastIndex(mod.Name, "."); idx >= 0 {
-					imported = mod.Name[idx+1:]
-				}
+			// Count number of leading dots in mod.From (e.g., ".." = 2, "...foo.bar" = 3)
+			relativeDepth := strings.IndexFunc(mod.From, func(r rune) bool { return r != '.' })
+			if relativeDepth == -1 {
+				relativeDepth = len(mod.From)
+			}
 
-				// Optional subpath in 'from' clause, e.g. "from ...my_library.foo import x"
-				fromPath := strings.TrimLeft(mod.From, ".")
-				var fromParts []string
-				if fromPath != "" {
-					fromParts = strings.Split(fromPath, ".")
-				}
+			// Extract final symbol (e.g., "some_function") from mod.Name
+			imported := mod.Name
+			if idx := strings.LastIndex(mod.Name, "."); idx >= 0 {
+				imported = mod.Name[idx+1:]
+			}
 
-				// Current Bazel package as path segments
-				pkgParts := strings.Split(from.Pkg, "/")
+			// Optional subpath in 'from' clause, e.g. "from ...my_library.foo import x"
+			fromPath := strings.TrimLeft(mod.From, ".")
+			var fromParts []string
+			if fromPath != "" {
+				fromParts = strings.Split(fromPath, ".")
+			}
 
-				if relativeDepth-1 > len(pkgParts) {
-					log.Printf("ERROR: Invalid relative import %q in %q: exceeds package root.", mod.Name, mod.Filepath)
-					continue MODULES_LOOP
-				}
+			// Current Bazel package as path segments
+			pkgParts := strings.Split(from.Pkg, "/")
 
-				// Go up relativeDepth - 1 levels
-				baseParts := pkgParts
-				if relativeDepth > 1 {
-					baseParts = pkgParts[:len(pkgParts)-(relativeDepth-1)]
-				}
-				// Build absolute module path
-				absParts := append([]string{}, baseParts...) // base path
-				absParts = append(absParts, fromParts...)    // subpath from 'from'
-				absParts = append(absParts, imported)        // actual imported symbol
+			if relativeDepth-1 > len(pkgParts) {
+				res.logf("ERROR: Invalid relative import %q in %q: exceeds package root.", mod.Name, mod.Filepath)
+				continue MODULES_LOOP
+			}
 
-				moduleName = strings.Join(absParts, ".")
+			// Go up relativeDepth - 1 levels
+			baseParts := pkgParts
+			if relativeDepth > 1 {
+				baseParts = pkgParts[:len(pkgParts)-(relativeDepth-1)]
 			}
+			// Build absolute module path
+			absParts := append([]string{}, baseParts...) // base path
+			absParts = append(absParts, fromParts...)    // subpath from 'from'
+			absParts = append(absParts, imported)        // actual imported symbol
 
-			moduleParts := strings.Split(moduleName, ".")
-			possibleModules := []string{moduleName}
-			for len(moduleParts) > 1 {
-				// Iterate back through the possible imports until
-				// a match is found.
-				// For example, "from foo.bar import baz" where baz is a module, we should try `foo.bar.baz` first, then
-				// `foo.bar`, then `foo`.
-				// In the first case, the import could be file `baz.py` in the directory `foo/bar`.
-				// Or, the import could be variable `baz` in file `foo/bar.py`.
-				// The import could also be from a standard module, e.g. `six.moves`, where
-				// the dependency is actually `six`.
-				moduleParts = moduleParts[:len(moduleParts)-1]
-				possibleModules = append(possibleModules, strings.Join(moduleParts, "."))
+			moduleName = strings.Join(absParts, ".")
+		}
+
+		moduleParts := strings.Split(moduleName, ".")
+		possibleModules := []string{moduleName}
+		for len(moduleParts) > 1 {
+			// Iterate back through the possible imports until
+			// a match is found.
+			// For example, "from foo.bar import baz" where baz is a module, we should try `foo.bar.baz` first, then
+			// `foo.bar`, then `foo`.
+			// In the first case, the import could be file `baz.py` in the directory `foo/bar`.
+			// Or, the import could be variable `baz` in file `foo/bar.py`.
+			// The import could also be from a standard module, e.g. `six.moves`, where
+			// the dependency is actually `six`.
+			moduleParts = moduleParts[:len(moduleParts)-1]
+			possibleModules = append(possibleModules, strings.Join(moduleParts, "."))
+		}
+		if module, symbol, ok := importedSymbol(mod, moduleName); ok {
+			if target, ok := py.findSymbolResolve(cfg, mod, module, symbol); ok {
+				if target.Repo == "" {
+					target.Repo = from.Repo
+				}
+				if !py.isSelfImport(target, from) {
+					py.addOverrideDependency(res, mod, moduleName, target, "resolve_symbol")
+				}
+				continue MODULES_LOOP
 			}
-			errs := []error{}
-		POSSIBLE_MODULE_LOOP:
-			for _, moduleName := range possibleModules {
-				imp := resolve.ImportSpec{Lang: languageName, Imp: moduleName}
-				if override, ok := resolve.FindRuleWithOverride(c, imp, languageName); ok {
-					if override.Repo == "" {
-						override.Repo = from.Repo
+		}
+		errs := []error{}
+	POSSIBLE_MODULE_LOOP:
+		for _, moduleName := range possibleModules {
+			imp := resolve.ImportSpec{Lang: languageName, Imp: moduleName}
+			if override, ok := py.findOverride(c, cfg, mod, imp); ok {
+				if override.Repo == "" {
+					override.Repo = from.Repo
+				}
+				if !py.isSelfImport(override, from) {
+					py.addOverrideDependency(res, mod, moduleName, override, "resolve")
+					continue MODULES_LOOP
+				}
+			} else {
+				if opaque, opaqueModule, ok := py.findOpaqueLibrary(cfg, mod, moduleName); ok {
+					if py.isSelfImport(opaque, from) {
+						py.recordResolution(from, mod, moduleName, resolutionStrategySelf, "")
+						continue MODULES_LOOP
 					}
-					if !override.Equal(from) {
-						if override.Repo == from.Repo {
-							override.Repo = ""
-						}
-						dep := override.Rel(from.Repo, from.Pkg).String()
-						addDependency(dep, mod.TypeCheckingOnly, deps, pyiDeps)
-						if explainDependency == dep {
-							log.Printf("Explaining dependency (%s): "+
-								"in the target %q, the file %q imports %q at line %d, "+
-								"which resolves using the \"gazelle:resolve\" directive.\n",
-								explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber)
-						}
+					if py.skipsIgnoredDirectory(res, mod, moduleName, opaque) {
 						continue MODULES_LOOP
 					}
-				} else {
-					if dep, distributionName, ok := cfg.FindThirdPartyDependency(moduleName); ok {
-						addDependency(dep, mod.TypeCheckingOnly, deps, pyiDeps)
-						// Add the type and stub dependencies if they exist.
-						modules := []string{
-							fmt.Sprintf("%s_stubs", strings.ToLower(distributionName)),
-							fmt.Sprintf("%s_types", strings.ToLower(distributionName)),
-							fmt.Sprintf("types_%s", strings.ToLower(distributionName)),
-							fmt.Sprintf("stubs_%s", strings.ToLower(distributionName)),
+					dep := opaque.Rel(from.Repo, from.Pkg).String()
+					addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+					res.addDependencySource(dep, mod)
+					py.recordResolution(from, mod, moduleName, resolutionStrategyOpaque, dep)
+					if py.explains(from, dep) {
+						res.logf("Explaining dependency (%s): "+
+							"in the target %q, the file %q imports %q at line %d, "+
+							"which is under the module %q of an opaque library.\n",
+							py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, opaqueModule)
+					}
+					continue MODULES_LOOP
+				} else if dep, distributionName, ok := py.findThirdPartyDependency(cfg, mod, moduleName); ok {
+					addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+					res.addDependencySource(dep, mod)
+					py.recordResolution(from, mod, moduleName, resolutionStrategyThirdParty, dep)
+					if !mod.TypeCheckingOnly && distributionName != "" {
+						res.distributions = append(res.distributions, distributionName)
+					}
+					// Add the distributions whose extras requested in the
+					// requirements bring this one, e.g. requests for the
+					// PySocks of requests[socks].
+					if distributionName != "" {
+						for _, extrasDep := range cfg.ExtrasDependencies(distributionName) {
+							addModuleDependency(extrasDep, mod, deps, pyiDeps, platformDeps)
+							res.addDependencySource(extrasDep, mod)
 						}
-						for _, module := range modules {
+					}
+					// Add the type and stub dependencies if they exist. The
+					// imports mapped by python_third_party_prefix have no
+					// distribution, hence no stubs.
+					if distributionName != "" && cfg.AttachesStubDeps() {
+						for _, module := range cfg.TypeStubModules(distributionName) {
 							if dep, _, ok := cfg.FindThirdPartyDependency(module); ok {
 								// Type stub packages are added as type-checking only.
 								addDependency(dep, true, deps, pyiDeps)
 							}
 						}
-						if explainDependency == dep {
-							log.Printf("Explaining dependency (%s): "+
-								"in the target %q, the file %q imports %q at line %d, "+
-								"which resolves from the third-party module %q from the wheel %q.\n",
-								explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, mod.Name, dep)
-						}
+					}
+					// So are the first-party stub libraries of the module.
+					if len(py.stubLibraries) > 0 {
+						stubs, _ := py.partitionStubMatches(py.findRulesByImport(c, ix, mod, imp))
+						py.addStubDependencies(res, mod, stubs)
+					}
+					if py.explains(from, dep) {
+						res.logf("Explaining dependency (%s): "+
+							"in the target %q, the file %q imports %q at line %d, "+
+							"which resolves from the third-party module %q from the wheel %q.\n",
+							py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, mod.Name, dep)
+					}
+					continue MODULES_LOOP
+				} else if generated, ok := py.findGeneratedModule(cfg, mod, moduleName); ok {
+					if py.isSelfImport(generated, from) {
+						py.recordResolution(from, mod, moduleName, resolutionStrategySelf, "")
 						continue MODULES_LOOP
-					} else {
-						matches := ix.FindRulesByImportWithConfig(c, imp, languageName)
-						if len(matches) == 0 {
-							// Check if the imported module is part of the standard library.
-							if isStdModule(Module{Name: moduleName}) {
+					}
+					if py.skipsIgnoredDirectory(res, mod, moduleName, generated) {
+						continue MODULES_LOOP
+					}
+					dep := generated.Rel(from.Repo, from.Pkg).String()
+					addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+					res.addDependencySource(dep, mod)
+					py.recordResolution(from, mod, moduleName, resolutionStrategyGenerated, dep)
+					if py.explains(from, dep) {
+						res.logf("Explaining dependency (%s): "+
+							"in the target %q, the file %q imports %q at line %d, "+
+							"which resolves to a module generated at build time.\n",
+							py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber)
+					}
+					continue MODULES_LOOP
+				} else if native, ok := py.findNativeModule(cfg, mod, moduleName); ok {
+					if py.skipsIgnoredDirectory(res, mod, moduleName, native) {
+						continue MODULES_LOOP
+					}
+					dep := native.Rel(from.Repo, from.Pkg).String()
+					addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+					res.addDependencySource(dep, mod)
+					py.recordResolution(from, mod, moduleName, resolutionStrategyNative, dep)
+					if py.explains(from, dep) {
+						res.logf("Explaining dependency (%s): "+
+							"in the target %q, the file %q imports %q at line %d, "+
+							"which resolves to a native extension module.\n",
+							py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber)
+					}
+					continue MODULES_LOOP
+				} else {
+					matches := py.findRulesByImport(c, ix, mod, imp)
+					if len(matches) == 0 {
+						// Only the imports of the namespace package itself depend on
+						// all of its providers, not the ones of its missing modules.
+						if moduleName == possibleModules[0] && cfg.ImplicitNamespacePackages() {
+							if providers := py.findNamespaceProviders(moduleName); len(providers) > 0 {
+								for _, provider := range providers {
+									if py.isSelfImport(provider, from) {
+										continue
+									}
+									if dir, ok := py.ignoredDirectory(provider, from); ok {
+										res.logf("WARNING: %q, line %d: the namespace package %q is provided by %s, "+
+											"in the directory %q ignored by .bazelignore, so the target is skipped\n",
+											mod.Filepath, mod.LineNumber, moduleName, provider, dir)
+										continue
+									}
+									dep := provider.Rel(from.Repo, from.Pkg).String()
+									addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+									res.addDependencySource(dep, mod)
+									py.recordResolution(from, mod, moduleName, resolutionStrategyNamespace, dep)
+									if py.explains(from, dep) {
+										res.logf("Explaining dependency (%s): "+
+											"in the target %q, the file %q imports %q at line %d, "+
+											"which is an implicit namespace package provided by several targets.\n",
+											py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber)
+									}
+								}
 								continue MODULES_LOOP
-							} else if cfg.ValidateImportStatements() {
-								err := fmt.Errorf(
-									"%[1]q, line %[2]d: %[3]q is an invalid dependency: possible solutions:\n"+
-										"\t1. Add it as a dependency in the requirements.txt file.\n"+
-										"\t2. Use the '# gazelle:resolve py %[3]s TARGET_LABEL' BUILD file directive to resolve to a known dependency.\n"+
-										"\t3. Ignore it with a comment '# gazelle:ignore %[3]s' in the Python file.\n",
-									mod.Filepath, mod.LineNumber, moduleName,
-								)
-								errs = append(errs, err)
-								continue POSSIBLE_MODULE_LOOP
 							}
 						}
-						filteredMatches := make([]resolve.FindResult, 0, len(matches))
-						for _, match := range matches {
-							if match.IsSelfImport(from) {
-								// Prevent from adding itself as a dependency.
-								continue MODULES_LOOP
+						if external := py.findExternalModule(c, cfg, moduleName); len(external) == 1 {
+							dep := external[0].String()
+							addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+							res.addDependencySource(dep, mod)
+							py.recordResolution(from, mod, moduleName, resolutionStrategyExternal, dep)
+							if py.explains(from, dep) {
+								res.logf("Explaining dependency (%s): "+
+									"in the target %q, the file %q imports %q at line %d, "+
+									"which resolves from the index of the external repository %q.\n",
+									py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, external[0].Repo)
+							}
+							continue MODULES_LOOP
+						} else if len(external) > 1 {
+							targets := make([]string, len(external))
+							for i, target := range external {
+								targets[i] = target.String()
+							}
+							err := fmt.Errorf(
+								"%[1]q, line %[2]d: multiple targets (%[3]s) of external repositories may be imported with %[4]q: possible solution:\n"+
+									"\t1. Use the '# gazelle:resolve py %[4]s TARGET_LABEL' BUILD file directive to resolve to one of the above targets.\n",
+								mod.Filepath, mod.LineNumber, strings.Join(targets, ", "), moduleName)
+							errs = append(errs, err)
+							continue POSSIBLE_MODULE_LOOP
+						}
+						// Resolve the standard modules missing from the targeted
+						// version to their backport, if it's in the manifest.
+						if dep, distributionName, backportModule, ok := py.findStdModuleBackport(cfg, mod, moduleName); ok {
+							addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+							res.addDependencySource(dep, mod)
+							py.recordResolution(from, mod, moduleName, resolutionStrategyThirdParty, dep)
+							if !mod.TypeCheckingOnly && distributionName != "" {
+								res.distributions = append(res.distributions, distributionName)
+							}
+							if py.explains(from, dep) {
+								res.logf("Explaining dependency (%s): "+
+									"in the target %q, the file %q imports %q at line %d, "+
+									"which isn't in the standard library of Python 3.%d, so it resolves from its backport %q from the wheel %q.\n",
+									py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, cfg.PythonVersion(), backportModule, dep)
 							}
-							filteredMatches = append(filteredMatches, match)
+							continue MODULES_LOOP
 						}
-						if len(filteredMatches) == 0 {
+						// Check if the imported module is part of the standard library.
+						if py.isStdModule(cfg, mod, moduleName) {
+							py.recordResolution(from, mod, moduleName, resolutionStrategyStdlib, "")
+							continue MODULES_LOOP
+						} else if validateImport {
+							requirement := "it"
+							if backport, _ := stdModuleBackport(moduleName, cfg.PythonVersion()); backport != "" {
+								// The module is in the standard library of
+								// other versions of Python.
+								requirement = fmt.Sprintf("its backport %q", backport)
+							}
+							err := fmt.Errorf(
+								"%[1]q, line %[2]d: %[3]q is an invalid dependency: possible solutions:\n"+
+									"\t1. Add %[4]s as a dependency in the requirements.txt file.\n"+
+									"\t2. Use the '# gazelle:resolve py %[3]s TARGET_LABEL' BUILD file directive to resolve to a known dependency.\n"+
+									"\t3. Ignore it with a comment '# gazelle:ignore %[3]s' in the Python file.\n",
+								mod.Filepath, mod.LineNumber, moduleName, requirement,
+							)
+							errs = append(errs, err)
 							continue POSSIBLE_MODULE_LOOP
 						}
-						if len(filteredMatches) > 1 {
-							sameRootMatches := make([]resolve.FindResult, 0, len(filteredMatches))
-							for _, match := range filteredMatches {
-								if strings.HasPrefix(match.Label.Pkg, pythonProjectRoot) {
-									sameRootMatches = append(sameRootMatches, match)
-								}
+					}
+					filteredMatches := make([]resolve.FindResult, 0, len(matches))
+					for _, match := range matches {
+						if match.IsSelfImport(from) || py.isSelfImport(match.Label, from) {
+							// Prevent from adding itself as a dependency.
+							py.recordResolution(from, mod, moduleName, resolutionStrategySelf, "")
+							continue MODULES_LOOP
+						}
+						if dir, ok := py.ignoredDirectory(match.Label, from); ok {
+							res.logf("WARNING: %q, line %d: %q may be imported from %s, "+
+								"in the directory %q ignored by .bazelignore, so the target is skipped\n",
+								mod.Filepath, mod.LineNumber, moduleName, match.Label, dir)
+							continue
+						}
+						filteredMatches = append(filteredMatches, match)
+					}
+					if len(filteredMatches) == 0 {
+						continue POSSIBLE_MODULE_LOOP
+					}
+					if cfg.ResolutionScope() == pythonconfig.ResolutionScopeProject {
+						scopedMatches := projectMatches(cfgs, filteredMatches, from)
+						if len(scopedMatches) == 0 {
+							err := fmt.Errorf(
+								"%[1]q, line %[2]d: %[3]q may only be imported from targets (%[4]s) of other Python projects than %[5]q: possible solutions:\n"+
+									"\t1. Use the '# gazelle:resolve py %[3]s %[6]s' BUILD file directive to depend on the above target explicitly.\n"+
+									"\t2. Move the module to the Python project %[5]q.\n",
+								mod.Filepath, mod.LineNumber, moduleName, targetListFromResults(filteredMatches),
+								"//"+pythonProjectRoot, filteredMatches[0].Label)
+							errs = append(errs, err)
+							continue POSSIBLE_MODULE_LOOP
+						}
+						filteredMatches = scopedMatches
+					}
+					// The imports from outside a facade resolve to its
+					// library, see python_coarse_grained_facade.
+					filteredMatches = facadeMatches(c, cfgs, filteredMatches, from)
+					if mode := cfg.ResolveVisibilityMode(); mode != pythonconfig.ResolveVisibilityModeIgnore {
+						if visibleMatches := py.visibleMatches(filteredMatches, from.Pkg); len(visibleMatches) > 0 {
+							filteredMatches = visibleMatches
+						} else if mode == pythonconfig.ResolveVisibilityModeRequire {
+							err := fmt.Errorf(
+								"%[1]q, line %[2]d: %[3]q may only be imported from targets (%[4]s) that aren't visible to %[5]q: possible solutions:\n"+
+									"\t1. Add %[5]q to the visibility of one of the above targets.\n"+
+									"\t2. Use the '# gazelle:resolve py %[3]s TARGET_LABEL' BUILD file directive to resolve to a visible target.\n",
+								mod.Filepath, mod.LineNumber, moduleName, targetListFromResults(filteredMatches), "//"+from.Pkg)
+							errs = append(errs, err)
+							continue POSSIBLE_MODULE_LOOP
+						} else if mode == pythonconfig.ResolveVisibilityModeWarn {
+							res.logf("WARNING: %[1]q, line %[2]d: %[3]q may only be imported from targets (%[4]s) "+
+								"that aren't visible to %[5]q, so the dependency is skipped: "+
+								"add %[6]q to the visibility of one of the above targets.\n",
+								mod.Filepath, mod.LineNumber, moduleName, targetListFromResults(filteredMatches),
+								"//"+from.Pkg, "//"+from.Pkg+":__pkg__")
+							py.recordResolution(from, mod, moduleName, resolutionStrategyUnresolved, "")
+							continue MODULES_LOOP
+						}
+					}
+					// When both stub libraries and implementations provide the
+					// module, the type-checking imports resolve to the stubs,
+					// and the other ones to the implementations, with the stubs
+					// as type-checking dependencies.
+					if stubs, others := py.partitionStubMatches(filteredMatches); len(stubs) > 0 && len(others) > 0 {
+						if mod.TypeCheckingOnly {
+							filteredMatches = stubs
+						} else {
+							py.addStubDependencies(res, mod, stubs)
+							filteredMatches = others
+						}
+					}
+					if len(filteredMatches) > 1 {
+						sameRootMatches := make([]resolve.FindResult, 0, len(filteredMatches))
+						for _, match := range filteredMatches {
+							if strings.HasPrefix(match.Label.Pkg, pythonProjectRoot) {
+								sameRootMatches = append(sameRootMatches, match)
 							}
-							if len(sameRootMatches) != 1 {
-								err := fmt.Errorf(
-									"%[1]q, line %[2]d: multiple targets (%[3]s) may be imported with %[4]q: possible solutions:\n"+
-										"\t1. Disambiguate the above multiple targets by removing duplicate srcs entries.\n"+
-										"\t2. Use the '# gazelle:resolve py %[4]s TARGET_LABEL' BUILD file directive to resolve to one of the above targets.\n",
-									mod.Filepath, mod.LineNumber, targetListFromResults(filteredMatches), moduleName)
-								errs = append(errs, err)
-								continue POSSIBLE_MODULE_LOOP
+						}
+						// The conflict policy picks among the targets under the same
+						// Python project root, if there are any.
+						candidates := filteredMatches
+						if len(sameRootMatches) > 0 {
+							candidates = sameRootMatches
+						}
+						if len(candidates) == 1 {
+							filteredMatches = candidates
+						} else if policy := cfg.ResolveConflictPolicy(); policy == pythonconfig.ResolveConflictPolicySkip {
+							py.recordResolution(from, mod, moduleName, resolutionStrategyUnresolved, "")
+							continue MODULES_LOOP
+						} else if match, ok := resolveConflict(policy, candidates, from.Pkg); ok {
+							filteredMatches = []resolve.FindResult{match}
+						} else {
+							err := fmt.Errorf(
+								"%[1]q, line %[2]d: multiple targets (%[3]s) may be imported with %[4]q: possible solutions:\n"+
+									"\t1. Disambiguate the above multiple targets by removing duplicate srcs entries.\n"+
+									"\t2. Use the '# gazelle:resolve py %[4]s TARGET_LABEL' BUILD file directive to resolve to one of the above targets.\n",
+								mod.Filepath, mod.LineNumber, targetListFromResults(filteredMatches), moduleName)
+							errs = append(errs, err)
+							continue POSSIBLE_MODULE_LOOP
+						}
+					}
+					if py.isTestonly(filteredMatches[0].Label) && !py.isTestonly(from) {
+						err := fmt.Errorf(
+							"%[1]q, line %[2]d: %[3]q resolves to the testonly target %[4]s, but %[5]q isn't testonly: possible solutions:\n"+
+								"\t1. Move the module out of the testonly directories of the '# gazelle:%[6]s' directive.\n"+
+								"\t2. Set testonly = True on %[5]q, e.g. by moving it to one of these directories.\n"+
+								"\t3. Use the '# gazelle:resolve py %[3]s TARGET_LABEL' BUILD file directive to resolve to a target that isn't testonly.\n",
+							mod.Filepath, mod.LineNumber, moduleName, filteredMatches[0].Label, from.String(), pythonconfig.TestonlyDirs)
+						// The parent modules would resolve to the same
+						// target, or to one of its ancestors.
+						errs = append(errs, err)
+						break POSSIBLE_MODULE_LOOP
+					}
+					matchLabel := filteredMatches[0].Label.Rel(from.Repo, from.Pkg)
+					dep := matchLabel.String()
+					if py.isStubLibrary(filteredMatches[0].Label) {
+						// The stubs aren't needed at runtime.
+						addDependency(dep, true, deps, pyiDeps)
+					} else {
+						addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+					}
+					res.addDependencySource(dep, mod)
+					py.recordResolution(from, mod, moduleName, resolutionStrategyIndex, dep)
+					if moduleName != possibleModules[0] {
+						if reExportDep, ok := py.reExportDependency(c, ix, from, pythonProjectRoot, moduleName, possibleModules[0]); ok && reExportDep != dep {
+							addModuleDependency(reExportDep, mod, deps, pyiDeps, platformDeps)
+							res.addDependencySource(reExportDep, mod)
+							if py.explains(from, reExportDep) {
+								res.logf("Explaining dependency (%s): "+
+									"in the target %q, the file %q imports %q at line %d, "+
+									"which the __init__.py file of %q re-exports.\n",
+									py.explainDependency, from.String(), mod.Filepath, possibleModules[0], mod.LineNumber, moduleName)
 							}
-							filteredMatches = sameRootMatches
 						}
-						matchLabel := filteredMatches[0].Label.Rel(from.Repo, from.Pkg)
-						dep := matchLabel.String()
-						addDependency(dep, mod.TypeCheckingOnly, deps, pyiDeps)
-						if explainDependency == dep {
-							log.Printf("Explaining dependency (%s): "+
-								"in the target %q, the file %q imports %q at line %d, "+
-								"which resolves from the first-party indexed labels.\n",
-								explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber)
+					}
+					if !cfg.ImplicitNamespacePackages() {
+						if missing := py.missingInitFiles(c.RepoRoot, pythonProjectRoot, moduleName); len(missing) > 0 {
+							res.logf("WARNING: %q, line %d: %q resolves to %s, but the import fails at runtime "+
+								"without the missing %s files: %s\n",
+								mod.Filepath, mod.LineNumber, moduleName, filteredMatches[0].Label, pyLibraryEntrypointFilename,
+								strings.Join(missing, ", "))
 						}
-						continue MODULES_LOOP
 					}
+					if py.explains(from, dep) {
+						res.logf("Explaining dependency (%s): "+
+							"in the target %q, the file %q imports %q at line %d, "+
+							"which resolves from the first-party indexed labels.\n",
+							py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber)
+					}
+					continue MODULES_LOOP
+				}
+			}
+		} // End possible modules loop.
+		if cfg.ResolveAncestorPackage() {
+			if target, pkg, ok := py.findAncestorPackage(pythonProjectRoot, possibleModules); ok {
+				if py.isSelfImport(target, from) {
+					py.recordResolution(from, mod, moduleName, resolutionStrategySelf, "")
+					continue MODULES_LOOP
 				}
-			} // End possible modules loop.
-			if len(errs) > 0 {
-				// If, after trying all possible modules, we still haven't found anything, error out.
-				joinedErrs := ""
-				for _, err := range errs {
-					joinedErrs = fmt.Sprintf("%s%s\n", joinedErrs, err)
+				if py.skipsIgnoredDirectory(res, mod, moduleName, target) {
+					continue MODULES_LOOP
 				}
-				log.Printf("ERROR: failed to validate dependencies for target %q:\n\n%v", from.String(), joinedErrs)
-				hasFatalError = true
+				dep := target.Rel(from.Repo, from.Pkg).String()
+				addModuleDependency(dep, mod, deps, pyiDeps, platformDeps)
+				res.addDependencySource(dep, mod)
+				py.recordResolution(from, mod, moduleName, resolutionStrategyAncestor, dep)
+				if py.explains(from, dep) {
+					res.logf("Explaining dependency (%s): "+
+						"in the target %q, the file %q imports %q at line %d, "+
+						"which no target provides, so it resolves to the target of its ancestor package %q.\n",
+						py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, pkg)
+				}
+				continue MODULES_LOOP
 			}
 		}
-		if hasFatalError {
-			os.Exit(1)
+		py.recordResolution(from, mod, moduleName, resolutionStrategyUnresolved, "")
+		if len(errs) > 0 && cfg.UnresolvedImportsMode() == pythonconfig.UnresolvedImportsModeTag {
+			res.unresolvedImports = append(res.unresolvedImports, newUnresolvedImport(from, mod, errs))
+		} else if len(errs) > 0 {
+			// If, after trying all possible modules, we still haven't found anything, error out.
+			joinedErrs := ""
+			for _, err := range errs {
+				joinedErrs = fmt.Sprintf("%s%s\n", joinedErrs, err)
+			}
+			res.errorf("failed to validate dependencies for target %q:\n\n%v", from.String(), joinedErrs)
 		}
 	}
+}
+
+// applyResolution applies the resolution res to the rule r, in the order in
+// which Gazelle resolves the rules, so that the output is deterministic.
+func (py *Resolver) applyResolution(r *rule.Rule, res *ruleResolution) {
+	from := res.from
+	deps, pyiDeps, platformDeps, depSources := res.deps, res.pyiDeps, res.platformDeps, res.depSources
+	cfgs := res.c.Exts[languageName].(pythonconfig.Configs)
+	cfg := cfgs[from.Pkg]
+
+	for _, message := range res.messages {
+		log.Print(message)
+	}
+	if len(res.errors) > 0 {
+		py.runErrors.add(from.Pkg, res.errors...)
+		return
+	}
+	for _, module := range res.optionalImports {
+		py.addOptionalImport(from, module)
+	}
+	for _, distribution := range res.distributions {
+		py.addDistribution(from, distribution)
+	}
+	py.wheelAudit.add(cfg, from, res.distributions)
+	py.unresolvedImports = append(py.unresolvedImports, res.unresolvedImports...)
+	py.addImportGraphEdges(from, depSources)
+	py.addPackageData(res.c, cfg, r, from)
+	if res.cacheKey != "" {
+		py.cacheResolution(r, res)
+	}
 
 	addResolvedDeps(r, deps)
 
+	comments := ruleDepComments(r)
 	if cfg.GeneratePyiDeps() {
-		if !deps.Empty() {
-			r.SetAttr("deps", convertDependencySetToExpr(deps))
+		if depsExpr := convertPlatformDependenciesToExpr(deps, platformDeps, comments); depsExpr != nil {
+			r.SetAttr("deps", depsExpr)
 		}
 		if !pyiDeps.Empty() {
-			r.SetAttr("pyi_deps", convertDependencySetToExpr(pyiDeps))
+			r.SetAttr("pyi_deps", convertDependencySetToExpr(pyiDeps, comments))
 		}
 	} else {
 		// When generate_pyi_deps is false, merge both deps and pyiDeps into deps
 		combinedDeps := treeset.NewWith(godsutils.StringComparator)
 		combinedDeps.Add(deps.Values()...)
 		combinedDeps.Add(pyiDeps.Values()...)
+		deps = combinedDeps
+
+		if depsExpr := convertPlatformDependenciesToExpr(combinedDeps, platformDeps, comments); depsExpr != nil {
+			r.SetAttr("deps", depsExpr)
+		}
+	}
+
+	depsOrder := cfg.DepsOrder()
+	toRemove := userDepsToRemove(r, depsOrder, from)
+	if depsOrder != nil && !ignoresDepsOrder(r) {
+		srcs := srcsForOrdering(r)
+		violations := depsToRemove(depsOrder, from, srcs, allDependencies(deps, platformDeps))
+		removeKeptDeps(r, violations)
+		if !violations.Empty() && cfg.DepsOrderMode() == pythonconfig.DepsOrderModeError {
+			joinedErrs := ""
+			for _, err := range depsOrderViolationErrors(depsOrder, from, srcs, violations, depSources) {
+				joinedErrs = fmt.Sprintf("%s%s\n", joinedErrs, err)
+			}
+			py.runErrors.add(from.Pkg, fmt.Sprintf("dependencies of target %q violate the deps order:\n\n%v", from.String(), joinedErrs))
+			return
+		}
+		py.depsToRemoveReport.add(depsOrder, res, srcs, violations)
+		toRemove.Add(violations.Values()...)
+	}
+	if depsOrder != nil {
+		py.depsOrderIndex.add(depsOrder, from, srcsForOrdering(r))
+	}
+	applyDepsComments(r, toRemove)
+	if !toRemove.Empty() {
+		r.SetAttr(depsToRemoveAttr, convertDependencySetToExpr(toRemove, comments))
+	}
+}
+
+// addOverrideDependency adds the dependency on target, which the directive,
+// e.g. resolve, resolves the import of mod to, unless it's skipped because of
+// .bazelignore.
+func (py *Resolver) addOverrideDependency(res *ruleResolution, mod Module, moduleName string, target label.Label, directive string) {
+	from := res.from
+	if py.skipsIgnoredDirectory(res, mod, moduleName, target) {
+		return
+	}
+	if target.Repo == from.Repo {
+		target.Repo = ""
+	}
+	dep := target.Rel(from.Repo, from.Pkg).String()
+	addModuleDependency(dep, mod, res.deps, res.pyiDeps, res.platformDeps)
+	res.addDependencySource(dep, mod)
+	py.recordResolution(from, mod, moduleName, resolutionStrategyOverride, dep)
+	if py.explains(from, dep) {
+		res.logf("Explaining dependency (%s): "+
+			"in the target %q, the file %q imports %q at line %d, "+
+			"which resolves using the \"gazelle:%s\" directive.\n",
+			py.explainDependency, from.String(), mod.Filepath, moduleName, mod.LineNumber, directive)
+	}
+}
 
-		if !combinedDeps.Empty() {
-			r.SetAttr("deps", convertDependencySetToExpr(combinedDeps))
+// addImportGraphEdges records the first-party dependencies of the target from
+// in the import graph.
+func (py *Resolver) addImportGraphEdges(from label.Label, depSources map[string]Module) {
+	for dep, mod := range depSources {
+		depLabel, err := label.Parse(dep)
+		if err != nil || (depLabel.Repo != "" && depLabel.Repo != from.Repo) {
+			continue
 		}
+		py.importGraph.addEdge(from.String(), depLabel.Abs(from.Repo, from.Pkg).String(), mod)
 	}
 }
 
@@ -396,13 +1046,17 @@ func targetListFromResults(results []resolve.FindResult) string {
 }
 
 // convertDependencySetToExpr converts the given set of dependencies to an
-// expression to be used in the deps attribute.
-func convertDependencySetToExpr(set *treeset.Set) bzl.Expr {
+// expression to be used in the deps attribute. The elements get the comments
+// of the dependencies in the existing rule, see addExistingDepComments.
+func convertDependencySetToExpr(set *treeset.Set, comments depComments) bzl.Expr {
 	deps := make([]bzl.Expr, set.Size())
+	forceMultiLine := false
 	it := set.Iterator()
 	for it.Next() {
 		dep := it.Value().(string)
-		deps[it.Index()] = &bzl.StringExpr{Value: dep}
+		str := comments.stringExpr(dep)
+		forceMultiLine = forceMultiLine || len(str.Comments.Before) > 0 || len(str.Comments.Suffix) > 0
+		deps[it.Index()] = str
 	}
-	return &bzl.ListExpr{List: deps}
+	return &bzl.ListExpr{List: deps, ForceMultiLine: forceMultiLine}
 }
@@ -0,0 +1,59 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// parseResolveSymbol parses the value of the resolve_symbol directive, e.g.
+// "py pkg.mod:SpecificClass //other:target", declared in the package pkg. It
+// returns the module, the symbol and the absolute label of the target the
+// symbol resolves to.
+func parseResolveSymbol(pkg, value string) (string, string, label.Label, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 3 {
+		return "", "", label.NoLabel, fmt.Errorf("expected a language, a module:symbol and a label, got %q", value)
+	}
+	if fields[0] != languageName {
+		return "", "", label.NoLabel, fmt.Errorf("unsupported language %q, expected %q", fields[0], languageName)
+	}
+	module, symbol, ok := strings.Cut(fields[1], ":")
+	if !ok || module == "" || symbol == "" || strings.Contains(symbol, ".") {
+		return "", "", label.NoLabel, fmt.Errorf("expected a module:symbol, e.g. pkg.mod:SpecificClass, got %q", fields[1])
+	}
+	l, err := label.Parse(fields[2])
+	if err != nil {
+		return "", "", label.NoLabel, fmt.Errorf("invalid label %q: %v", fields[2], err)
+	}
+	return module, symbol, l.Abs("", pkg), nil
+}
+
+// importedSymbol splits the name of the symbol imported from a module by mod,
+// e.g. "pkg.mod.SpecificClass" for "from pkg.mod import SpecificClass", into
+// the module and the symbol. moduleName is the absolute name of the import.
+func importedSymbol(mod Module, moduleName string) (string, string, bool) {
+	if mod.From == "" {
+		return "", "", false
+	}
+	i := strings.LastIndex(moduleName, ".")
+	if i < 0 {
+		return "", "", false
+	}
+	return moduleName[:i], moduleName[i+1:], true
+}
@@ -0,0 +1,51 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+)
+
+// resolveWildcardSuffix is the suffix of the modules of the resolve
+// directives applying to a whole module prefix, e.g. "foo.bar.*".
+const resolveWildcardSuffix = ".*"
+
+// parseResolveWildcard parses the value of a resolve directive, e.g.
+// "py foo.bar.* //lib:bar", declared in the package pkg. It returns the
+// module prefix and the absolute label of the target it resolves to, and
+// whether the directive is a wildcard one for Python at all.
+func parseResolveWildcard(pkg, value string) (string, label.Label, bool, error) {
+	fields := strings.Fields(value)
+	if len(fields) < 3 || len(fields) > 4 || fields[0] != languageName {
+		return "", label.NoLabel, false, nil
+	}
+	// The import language, e.g. "py py foo.bar.* //lib:bar", is optional.
+	imp := fields[len(fields)-2]
+	if !strings.Contains(imp, "*") {
+		return "", label.NoLabel, false, nil
+	}
+	prefix, ok := strings.CutSuffix(imp, resolveWildcardSuffix)
+	if !ok || prefix == "" || strings.Contains(prefix, "*") {
+		return "", label.NoLabel, true, fmt.Errorf("expected a wildcard only at the end of the module, e.g. foo.bar.*, got %q", imp)
+	}
+	l, err := label.Parse(fields[len(fields)-1])
+	if err != nil {
+		return "", label.NoLabel, true, fmt.Errorf("invalid label %q: %v", fields[len(fields)-1], err)
+	}
+	return prefix, l.Abs("", pkg), true, nil
+}
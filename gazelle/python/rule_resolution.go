@@ -0,0 +1,179 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"runtime"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+)
+
+// ruleResolution is the resolution of the imports of a rule. The resolutions
+// of the generated rules are computed concurrently once the index is built,
+// then applied one by one when Gazelle resolves the rules.
+type ruleResolution struct {
+	c        *config.Config
+	from     label.Label
+	modules  *treeset.Set
+	cacheKey string
+
+	deps, pyiDeps *treeset.Set
+	// platformDeps maps each platform to the dependencies only needed on it.
+	platformDeps map[string]*treeset.Set
+	// depSources maps each dependency to the first import that resolved to it.
+	depSources map[string]Module
+	// depImports maps each dependency to all the imports that resolved to it.
+	depImports map[string][]Module
+
+	// messages are logged when the resolution is applied.
+	messages          []string
+	optionalImports   []string
+	distributions     []string
+	unresolvedImports []unresolvedImport
+	// errors are the imports that failed to be resolved, failing the run when
+	// the resolution is applied.
+	errors []string
+
+	// index is the position of the resolution in the order of the generation
+	// of the rules.
+	index int
+	// done is closed once the resolution is computed.
+	done chan struct{}
+}
+
+// newRuleResolution returns the resolution of the imports modulesRaw of the
+// rule from, to be computed.
+func (py *Resolver) newRuleResolution(c *config.Config, modulesRaw interface{}, from label.Label) *ruleResolution {
+	res := &ruleResolution{
+		c:            c,
+		from:         from,
+		deps:         treeset.NewWith(godsutils.StringComparator),
+		pyiDeps:      treeset.NewWith(godsutils.StringComparator),
+		platformDeps: make(map[string]*treeset.Set),
+		depSources:   make(map[string]Module),
+		depImports:   make(map[string][]Module),
+		done:         make(chan struct{}),
+	}
+	if modulesRaw != nil {
+		res.modules = modulesRaw.(*treeset.Set)
+	}
+	return res
+}
+
+// logf records a message, logged when the resolution is applied.
+func (res *ruleResolution) logf(format string, args ...interface{}) {
+	res.messages = append(res.messages, fmt.Sprintf(format, args...))
+}
+
+// errorf records an error, failing the run when the resolution is applied.
+func (res *ruleResolution) errorf(format string, args ...interface{}) {
+	res.errors = append(res.errors, fmt.Sprintf(format, args...))
+}
+
+// addPendingResolutions records the rules generated in the package, whose
+// resolutions are computed concurrently when the first rule is resolved.
+func (py *Python) addPendingResolutions(args language.GenerateArgs, result language.GenerateResult) {
+	if py.pendingResolutions == nil {
+		py.pendingResolutions = make(map[*rule.Rule]*ruleResolution)
+	}
+	py.addGeneratedTargets(args, result.Gen)
+	for i, r := range result.Gen {
+		from := label.New(args.Config.RepoName, args.Rel, r.Name())
+		res := py.newRuleResolution(args.Config, result.Imports[i], from)
+		res.index = len(py.pendingOrder)
+		py.pendingResolutions[r] = res
+		py.pendingOrder = append(py.pendingOrder, res)
+	}
+}
+
+// startResolutions computes the pending resolutions on a bounded pool of
+// goroutines, in the order of the generation of their rules, which is the
+// order in which Gazelle resolves them. The index is read-only from now on.
+func (py *Resolver) startResolutions(ix *resolve.RuleIndex) {
+	py.resolutionsStarted = true
+	py.ruleIndex = ix
+	pending := py.pendingOrder
+	py.pendingOrder = nil
+	// The cache key depends on the whole index, including the external
+	// repositories, so it's computed before the concurrent resolutions.
+	py.loadExternalIndexes(pending)
+	py.addExternalIndexes()
+	for _, res := range pending {
+		res.cacheKey = py.resolutionCacheKey(res.from, res.modules)
+	}
+	jobs := make(chan *ruleResolution)
+	workers := runtime.GOMAXPROCS(0)
+	py.resolutionWorkers.Add(workers)
+	for i := 0; i < workers; i++ {
+		go func() {
+			defer py.resolutionWorkers.Done()
+			for res := range jobs {
+				py.resolveModules(ix, res)
+				close(res.done)
+			}
+		}()
+	}
+	py.resolutionsDone = make(chan struct{})
+	go func() {
+		defer close(jobs)
+		for i, res := range pending {
+			// The resolutions are released once applied.
+			pending[i] = nil
+			if py.resolutionWindow != nil {
+				select {
+				case py.resolutionWindow <- struct{}{}:
+				case <-py.resolutionsDone:
+				}
+			}
+			jobs <- res
+		}
+	}()
+}
+
+// takeResolution returns the pending resolution of the rule r, once it's
+// computed. With the -python_max_memory flag, the resolutions are computed at
+// most a window ahead of the rule resolved by Gazelle: the slots of the
+// resolutions preceding res, either applied or never resolved, are freed.
+func (py *Resolver) takeResolution(r *rule.Rule, from label.Label) (*ruleResolution, bool) {
+	res, ok := py.pendingResolutions[r]
+	if !ok || !res.from.Equal(from) {
+		return nil, false
+	}
+	delete(py.pendingResolutions, r)
+	if py.resolutionWindow != nil {
+		for ; py.releasedResolutions <= res.index; py.releasedResolutions++ {
+			<-py.resolutionWindow
+		}
+	}
+	<-res.done
+	return res, true
+}
+
+// waitResolutions waits for the pending resolutions to be computed, including
+// the ones of the rules that Gazelle didn't resolve.
+func (py *Resolver) waitResolutions() {
+	if py.resolutionsDone != nil {
+		close(py.resolutionsDone)
+	}
+	py.resolutionWorkers.Wait()
+	py.pendingResolutions = nil
+}
@@ -0,0 +1,63 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"log"
+	"os"
+	"sort"
+	"strings"
+)
+
+// runErrors maps the packages to the validation errors of their targets, e.g.
+// the imports that failed to be resolved or the targets colliding with
+// existing ones. They're reported together once all the targets are resolved,
+// so that a single run shows all the problems.
+type runErrors map[string][]string
+
+// add records the errors of the package.
+func (errs *runErrors) add(pkg string, messages ...string) {
+	if *errs == nil {
+		*errs = make(runErrors)
+	}
+	(*errs)[pkg] = append((*errs)[pkg], messages...)
+}
+
+// report logs the errors grouped by package, in the order of the packages.
+func (errs runErrors) report() {
+	pkgs := make([]string, 0, len(errs))
+	count := 0
+	for pkg, messages := range errs {
+		pkgs = append(pkgs, "//"+pkg)
+		count += len(messages)
+	}
+	sort.Strings(pkgs)
+	for _, pkg := range pkgs {
+		messages := errs[strings.TrimPrefix(pkg, "//")]
+		log.Printf("ERROR: %d error(s) in the package %s:\n\n%s", len(messages), pkg, strings.Join(messages, "\n"))
+	}
+	log.Printf("ERROR: %d error(s) in %d package(s) (%s), no BUILD file was updated", count, len(pkgs), strings.Join(pkgs, ", "))
+}
+
+// checkRunErrors reports the validation errors of the run and fails it, before
+// any BUILD file is written. Gazelle gives the languages no way to fail the
+// run once the rules are resolved, hence the exit.
+func (py *Resolver) checkRunErrors() {
+	if len(py.runErrors) == 0 {
+		return
+	}
+	py.runErrors.report()
+	os.Exit(1)
+}
@@ -0,0 +1,106 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"path"
+	"path/filepath"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+// aliasKind is the kind of the rules forwarding to another target, followed
+// when checking the self imports.
+const aliasKind = "alias"
+
+// recordIndexedSources records the Python sources of the indexed target, see
+// isSelfImport.
+func (py *Resolver) recordIndexedSources(target label.Label, r *rule.Rule) {
+	srcs := make(map[string]bool)
+	for _, src := range ruleSrcs(r) {
+		if filepath.Ext(src) == ".py" {
+			srcs[path.Join(target.Pkg, src)] = true
+		}
+	}
+	if py.indexedSources == nil {
+		py.indexedSources = make(map[string]map[string]bool)
+	}
+	py.indexedSources[target.String()] = srcs
+}
+
+// recordAliases records the alias rules of the file, once per package, see
+// isSelfImport.
+func (py *Resolver) recordAliases(repo string, f *rule.File) {
+	if f == nil {
+		return
+	}
+	if py.aliasedPackages == nil {
+		py.aliasedPackages = make(map[string]bool)
+	}
+	if py.aliasedPackages[f.Pkg] {
+		return
+	}
+	py.aliasedPackages[f.Pkg] = true
+	for _, r := range f.Rules {
+		if r.Kind() != aliasKind {
+			continue
+		}
+		actual, err := label.Parse(r.AttrString("actual"))
+		if err != nil {
+			// The actual target may be a select(), which can't be followed.
+			continue
+		}
+		alias := label.New(repo, f.Pkg, r.Name())
+		actual = actual.Abs(repo, f.Pkg)
+		if py.aliases == nil {
+			py.aliases = make(map[string]label.Label)
+		}
+		py.aliases[alias.String()] = actual
+		py.cache.addAlias(alias, actual)
+	}
+}
+
+// isSelfImport returns whether depending on the target from the target from
+// is a self import, creating a cycle: the target is from itself, an alias of
+// it, or a shim whose Python sources are all sources of from. The indexes are
+// complete once the rules are resolved, so it's safe to read concurrently.
+func (py *Resolver) isSelfImport(target, from label.Label) bool {
+	if target.Repo == "" {
+		target.Repo = from.Repo
+	}
+	// Follow the chain of aliases, bounded in case of a cycle.
+	for i := 0; i <= len(py.aliases); i++ {
+		if target.Equal(from) {
+			return true
+		}
+		actual, ok := py.aliases[target.String()]
+		if !ok {
+			break
+		}
+		target = actual
+	}
+	srcs := py.indexedSources[target.String()]
+	if len(srcs) == 0 {
+		return false
+	}
+	fromSrcs := py.indexedSources[from.String()]
+	for src := range srcs {
+		if !fromSrcs[src] {
+			return false
+		}
+	}
+	return true
+}
@@ -0,0 +1,69 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsSelfImport(t *testing.T) {
+	py := &Resolver{}
+	f, err := rule.LoadData("pkg/BUILD.bazel", "pkg", []byte(`
+alias(name = "compat", actual = ":pkg")
+alias(name = "old_compat", actual = "//pkg:compat")
+alias(name = "loop_a", actual = ":loop_b")
+alias(name = "loop_b", actual = ":loop_a")
+alias(name = "other", actual = "//other")
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	py.recordAliases("", f)
+	library := func(pkg, name string, srcs ...string) {
+		r := rule.NewRule(pyLibraryKind, name)
+		r.SetAttr("srcs", srcs)
+		py.recordIndexedSources(label.New("", pkg, name), r)
+	}
+	library("pkg", "pkg", "__init__.py", "core.py", "util.py")
+	library("pkg", "core_shim", "core.py")
+	library("pkg", "mixed_shim", "core.py", "extra.py")
+	library("other", "other", "core.py")
+
+	from := label.New("", "pkg", "pkg")
+	tests := []struct {
+		target string
+		want   bool
+	}{
+		{target: "//pkg", want: true},
+		{target: "//pkg:compat", want: true},
+		{target: "//pkg:old_compat", want: true},
+		{target: "//pkg:core_shim", want: true},
+		{target: "//pkg:mixed_shim"},
+		{target: "//pkg:loop_a"},
+		{target: "//pkg:other"},
+		{target: "//other"},
+	}
+	for _, tt := range tests {
+		target, err := label.Parse(tt.target)
+		if err != nil {
+			t.Fatal(err)
+		}
+		assert.Equal(t, tt.want, py.isSelfImport(target, from), tt.target)
+	}
+}
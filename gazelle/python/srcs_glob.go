@@ -0,0 +1,150 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"io/fs"
+	"path/filepath"
+	"sort"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// globbedSrcsKey is the private attribute of the rules whose srcs are a glob,
+// holding the source files matched by the glob, see python_srcs_strategy.
+const globbedSrcsKey = "_gazelle_python_globbed_srcs"
+
+// srcsGlob is the glob written as the srcs of the package and project
+// libraries with the glob strategy. It replaces the existing srcs of the
+// rules when merging, since lists and globs can't be merged.
+type srcsGlob rule.GlobValue
+
+var (
+	_ rule.BzlExprValue = srcsGlob{}
+	_ rule.Merger       = srcsGlob{}
+)
+
+func (g srcsGlob) BzlExpr() bzl.Expr {
+	return rule.GlobValue(g).BzlExpr()
+}
+
+func (g srcsGlob) Merge(other bzl.Expr) bzl.Expr {
+	return g.BzlExpr()
+}
+
+// librarySrcsGlob returns the glob matching the srcs of a library among the
+// Python files the glob may match, relative to the package. The test file
+// patterns are always excluded, so that the new tests don't go to the
+// library, and the other files that aren't srcs, e.g. the conftest.py and
+// tooling files, are excluded by name.
+func librarySrcsGlob(cfg *pythonconfig.Config, srcs, pyFiles *treeset.Set) srcsGlob {
+	prefix := ""
+	if cfg.CoarseGrainedGeneration() || cfg.FlattenSubpackages() || cfg.FoldSubdirs() {
+		prefix = "**/"
+	}
+	g := srcsGlob{Patterns: []string{prefix + "*.py"}}
+	testFileGlobs := make([]string, 0, len(cfg.TestFilePattern()))
+	for _, pattern := range cfg.TestFilePattern() {
+		testFileGlobs = append(testFileGlobs, prefix+pattern)
+	}
+	g.Excludes = append(g.Excludes, testFileGlobs...)
+	for _, f := range pyFiles.Values() {
+		if srcs.Contains(f) || matchesAnyGlob(f.(string), testFileGlobs) {
+			continue
+		}
+		g.Excludes = append(g.Excludes, f.(string))
+	}
+	sort.Strings(g.Excludes)
+	return g
+}
+
+// listedSrcs are the srcs of a library replacing the glob of an existing
+// rule, when switching back to the list strategy.
+type listedSrcs []string
+
+var (
+	_ rule.BzlExprValue = listedSrcs{}
+	_ rule.Merger       = listedSrcs{}
+)
+
+func (l listedSrcs) BzlExpr() bzl.Expr {
+	return rule.ExprFromValue([]string(l))
+}
+
+func (l listedSrcs) Merge(other bzl.Expr) bzl.Expr {
+	return l.BzlExpr()
+}
+
+// hasSrcsGlob returns whether the rule of the file with the given name has a
+// glob as srcs.
+func hasSrcsGlob(f *rule.File, name string) bool {
+	if f == nil {
+		return false
+	}
+	for _, r := range f.Rules {
+		if r.Name() == name {
+			_, ok := rule.ParseGlobExpr(r.Attr("srcs"))
+			return ok
+		}
+	}
+	return false
+}
+
+// expandSrcsGlob records the files matched by the glob of the srcs of the
+// rule read from the BUILD file of the package in dir, when it wasn't
+// generated by this run, so that the rule can be indexed. Like Bazel, the
+// glob doesn't match the files of the subpackages.
+func expandSrcsGlob(dir string, r *rule.Rule) {
+	if r.PrivateAttr(globbedSrcsKey) != nil {
+		return
+	}
+	g, ok := rule.ParseGlobExpr(r.Attr("srcs"))
+	if !ok {
+		return
+	}
+	var srcs []string
+	_ = filepath.WalkDir(dir, func(path string, entry fs.DirEntry, err error) error {
+		if err != nil {
+			return nil
+		}
+		if entry.IsDir() {
+			if path != dir && isBazelPackage(path) {
+				return fs.SkipDir
+			}
+			return nil
+		}
+		src, _ := filepath.Rel(dir, path)
+		src = filepath.ToSlash(src)
+		if matchesAnyGlob(src, g.Patterns) && !matchesAnyGlob(src, g.Excludes) {
+			srcs = append(srcs, src)
+		}
+		return nil
+	})
+	sort.Strings(srcs)
+	r.SetPrivateAttr(globbedSrcsKey, srcs)
+}
+
+// ruleSrcs returns the source files of the rule, i.e. the files matched by
+// the glob of its srcs if any, see expandSrcsGlob.
+func ruleSrcs(r *rule.Rule) []string {
+	if srcs, ok := r.PrivateAttr(globbedSrcsKey).([]string); ok {
+		return srcs
+	}
+	return r.AttrStrings("srcs")
+}
@@ -0,0 +1,66 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestLibrarySrcsGlob(t *testing.T) {
+	set := func(values ...interface{}) *treeset.Set {
+		return treeset.NewWith(godsutils.StringComparator, values...)
+	}
+	cfg := pythonconfig.New("/repo", "")
+	pyFiles := set("__init__.py", "conftest.py", "foo.py", "foo_test.py", "setup.py")
+	g := librarySrcsGlob(cfg, set("__init__.py", "foo.py"), pyFiles)
+	assert.Equal(t, []string{"*.py"}, g.Patterns)
+	assert.Equal(t, []string{"*_test.py", "conftest.py", "setup.py", "test_*.py"}, g.Excludes)
+
+	cfg.SetCoarseGrainedGeneration(true)
+	g = librarySrcsGlob(cfg, set("foo.py", "sub/bar.py"), set("foo.py", "sub/bar.py", "sub/bar_test.py"))
+	assert.Equal(t, []string{"**/*.py"}, g.Patterns)
+	assert.Equal(t, []string{"**/*_test.py", "**/test_*.py"}, g.Excludes)
+}
+
+func TestExpandSrcsGlob(t *testing.T) {
+	dir := t.TempDir()
+	for _, f := range []string{"foo.py", "foo_test.py", "sub/bar.py", "subpkg/BUILD", "subpkg/baz.py"} {
+		path := filepath.Join(dir, f)
+		if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(path, nil, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	r := rule.NewRule(pyLibraryKind, "pkg")
+	r.SetAttr("srcs", rule.GlobValue{Patterns: []string{"**/*.py"}, Excludes: []string{"**/*_test.py"}})
+	expandSrcsGlob(dir, r)
+	assert.Equal(t, []string{"foo.py", "sub/bar.py"}, ruleSrcs(r))
+
+	listed := rule.NewRule(pyLibraryKind, "listed")
+	listed.SetAttr("srcs", []string{"foo.py"})
+	expandSrcsGlob(dir, listed)
+	assert.Equal(t, []string{"foo.py"}, ruleSrcs(listed))
+}
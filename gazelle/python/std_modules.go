@@ -17,6 +17,8 @@ package python
 import (
 	"bufio"
 	_ "embed"
+	"fmt"
+	"strconv"
 	"strings"
 )
 
@@ -34,7 +36,140 @@ func init() {
 	}
 }
 
-func isStdModule(m Module) bool {
+// stdModuleVersion is the range of the minor versions of Python 3 whose
+// standard library has a module.
+type stdModuleVersion struct {
+	// added is the first minor version with the module, 0 when it's older
+	// than all the supported versions.
+	added int
+	// removed is the first minor version without the module, 0 when it's
+	// still in the standard library.
+	removed int
+	// backport is the distribution providing the module to the versions
+	// without it, if any, and backportModule is the module it provides.
+	backport       string
+	backportModule string
+}
+
+// stdModuleVersions are the modules added to or removed from the standard
+// library since Python 3.8, which the embedded list of the latest version
+// can't tell apart.
+var stdModuleVersions = map[string]stdModuleVersion{
+	"graphlib":           {added: 9, backport: "graphlib_backport", backportModule: "graphlib"},
+	"importlib.metadata": {added: 8, backport: "importlib_metadata", backportModule: "importlib_metadata"},
+	"tomllib":            {added: 11, backport: "tomli", backportModule: "tomli"},
+	"zoneinfo":           {added: 9, backport: "backports.zoneinfo", backportModule: "backports.zoneinfo"},
+	// The symbols of the typing module backported by typing_extensions, which
+	// are imported as "typing.Symbol" by "from typing import Symbol".
+	"typing.Annotated":           {added: 9, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.Concatenate":         {added: 10, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.ParamSpec":           {added: 10, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.TypeAlias":           {added: 10, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.TypeGuard":           {added: 10, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.LiteralString":       {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.Never":               {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.NotRequired":         {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.Required":            {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.Self":                {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.TypeVarTuple":        {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.Unpack":              {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.assert_never":        {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.dataclass_transform": {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.reveal_type":         {added: 11, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.TypeAliasType":       {added: 12, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.override":            {added: 12, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.ReadOnly":            {added: 13, backport: "typing_extensions", backportModule: "typing_extensions"},
+	"typing.TypeIs":              {added: 13, backport: "typing_extensions", backportModule: "typing_extensions"},
+
+	"_dummy_thread":   {removed: 9},
+	"dummy_threading": {removed: 9},
+	"formatter":       {removed: 10},
+	"parser":          {removed: 10},
+	"symbol":          {removed: 10},
+	"binhex":          {removed: 11},
+	"asynchat":        {removed: 12},
+	"asyncore":        {removed: 12},
+	"distutils":       {removed: 12},
+	"imp":             {removed: 12},
+	"smtpd":           {removed: 12},
+	// The dead batteries of PEP 594.
+	"aifc":        {removed: 13},
+	"audioop":     {removed: 13},
+	"cgi":         {removed: 13},
+	"cgitb":       {removed: 13},
+	"chunk":       {removed: 13},
+	"crypt":       {removed: 13},
+	"imghdr":      {removed: 13},
+	"lib2to3":     {removed: 13},
+	"mailcap":     {removed: 13},
+	"msilib":      {removed: 13},
+	"nis":         {removed: 13},
+	"nntplib":     {removed: 13},
+	"ossaudiodev": {removed: 13},
+	"pipes":       {removed: 13},
+	"sndhdr":      {removed: 13},
+	"spwd":        {removed: 13},
+	"sunau":       {removed: 13},
+	"telnetlib":   {removed: 13},
+	"uu":          {removed: 13},
+	"xdrlib":      {removed: 13},
+}
+
+// parsePythonVersion parses the value of the python_version directive, e.g.
+// "3.11" or "3.11.4", and returns its minor version.
+func parsePythonVersion(value string) (int, error) {
+	parts := strings.Split(strings.TrimSpace(value), ".")
+	if len(parts) < 2 || len(parts) > 3 || parts[0] != "3" {
+		return 0, fmt.Errorf("expected a Python 3 version, e.g. 3.11, got %q", value)
+	}
+	for _, part := range parts[1:] {
+		if _, err := strconv.ParseUint(part, 10, 16); err != nil {
+			return 0, fmt.Errorf("expected a Python 3 version, e.g. 3.11, got %q", value)
+		}
+	}
+	minor, _ := strconv.Atoi(parts[1])
+	return minor, nil
+}
+
+// lookupStdModuleVersion returns the versions of the standard library with
+// the module, or with the package of the module, if it was added or removed
+// since Python 3.8.
+func lookupStdModuleVersion(name string) (stdModuleVersion, bool) {
+	for prefix := name; prefix != ""; {
+		if v, ok := stdModuleVersions[prefix]; ok {
+			return v, true
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return stdModuleVersion{}, false
+}
+
+// isStdModule returns whether the module is part of the standard library of
+// the minor version of Python 3, or of the embedded list when it's 0.
+func isStdModule(m Module, minor int) bool {
+	if minor != 0 {
+		if v, ok := lookupStdModuleVersion(m.Name); ok {
+			return minor >= v.added && (v.removed == 0 || minor < v.removed)
+		}
+	}
 	_, ok := stdModules[m.Name]
 	return ok
 }
+
+// stdModuleBackport returns the distribution backporting the module to the
+// minor version of Python 3, whose standard library doesn't have it yet, if
+// any, and the module it provides.
+func stdModuleBackport(name string, minor int) (string, string) {
+	if minor == 0 {
+		return "", ""
+	}
+	v, ok := lookupStdModuleVersion(name)
+	if !ok || minor >= v.added {
+		return "", ""
+	}
+	return v.backport, v.backportModule
+}
@@ -21,7 +21,71 @@ import (
 )
 
 func TestIsStdModule(t *testing.T) {
-	assert.True(t, isStdModule(Module{Name: "unittest"}))
-	assert.True(t, isStdModule(Module{Name: "os.path"}))
-	assert.False(t, isStdModule(Module{Name: "foo"}))
+	assert.True(t, isStdModule(Module{Name: "unittest"}, 0))
+	assert.True(t, isStdModule(Module{Name: "os.path"}, 0))
+	assert.False(t, isStdModule(Module{Name: "foo"}, 0))
+}
+
+func TestIsStdModuleVersion(t *testing.T) {
+	tests := []struct {
+		name  string
+		minor int
+		want  bool
+	}{
+		{name: "tomllib", minor: 0, want: true},
+		{name: "tomllib", minor: 10, want: false},
+		{name: "tomllib._parser", minor: 10, want: false},
+		{name: "tomllib", minor: 11, want: true},
+		{name: "distutils", minor: 0, want: false},
+		{name: "distutils.core", minor: 11, want: true},
+		{name: "distutils", minor: 12, want: false},
+		{name: "telnetlib", minor: 12, want: true},
+		{name: "telnetlib", minor: 13, want: false},
+		{name: "importlib.metadata", minor: 9, want: true},
+		{name: "importlib.metadata", minor: 7, want: false},
+		{name: "importlib", minor: 7, want: true},
+		{name: "os.path", minor: 9, want: true},
+		{name: "typing.Self", minor: 10, want: false},
+		{name: "typing.Self", minor: 11, want: true},
+		{name: "typing", minor: 10, want: true},
+		{name: "foo", minor: 9, want: false},
+	}
+	for _, tt := range tests {
+		assert.Equal(t, tt.want, isStdModule(Module{Name: tt.name}, tt.minor), "%s in 3.%d", tt.name, tt.minor)
+	}
+}
+
+func TestStdModuleBackport(t *testing.T) {
+	tests := []struct {
+		name         string
+		minor        int
+		distribution string
+		module       string
+	}{
+		{name: "tomllib", minor: 10, distribution: "tomli", module: "tomli"},
+		{name: "tomllib", minor: 11},
+		{name: "tomllib", minor: 0},
+		{name: "zoneinfo", minor: 8, distribution: "backports.zoneinfo", module: "backports.zoneinfo"},
+		{name: "typing.Self", minor: 10, distribution: "typing_extensions", module: "typing_extensions"},
+		{name: "typing.Self", minor: 11},
+		{name: "typing.Any", minor: 10},
+		{name: "distutils", minor: 12},
+	}
+	for _, tt := range tests {
+		distribution, module := stdModuleBackport(tt.name, tt.minor)
+		assert.Equal(t, tt.distribution, distribution, "%s in 3.%d", tt.name, tt.minor)
+		assert.Equal(t, tt.module, module, "%s in 3.%d", tt.name, tt.minor)
+	}
+}
+
+func TestParsePythonVersion(t *testing.T) {
+	for value, want := range map[string]int{"3.11": 11, "3.9.18": 9, " 3.12 ": 12} {
+		minor, err := parsePythonVersion(value)
+		assert.NoError(t, err, value)
+		assert.Equal(t, want, minor, value)
+	}
+	for _, value := range []string{"", "3", "2.7", "3.x", "3.11.4.1", "3.-1"} {
+		_, err := parsePythonVersion(value)
+		assert.Error(t, err, value)
+	}
 }
@@ -0,0 +1,161 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/lists/singlylinkedlist"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// stubExt is the extension of the type stubs.
+const stubExt = ".pyi"
+
+// stubFilenames returns the type stubs of the package without a Python module
+// of the same name, e.g. the ones of the native extensions or of the vendored
+// code.
+func stubFilenames(args language.GenerateArgs, cfg *pythonconfig.Config, pyFileNames *treeset.Set) *treeset.Set {
+	stubs := treeset.NewWith(godsutils.StringComparator)
+	for _, f := range args.RegularFiles {
+		if filepath.Ext(f) != stubExt || cfg.IgnoresFile(filepath.Base(f)) || cfg.ExcludesPath(filepath.Join(args.Rel, f)) {
+			continue
+		}
+		if !pyFileNames.Contains(strings.TrimSuffix(f, stubExt) + ".py") {
+			stubs.Add(f)
+		}
+	}
+	return stubs
+}
+
+// generateStubLibrary generates the py_library of a package with type stubs
+// only, named like the library of the package, with the stubs as pyi_srcs.
+// Its deps are resolved from the imports of the stubs, which are type-checking
+// only, so they go to pyi_deps with python_generate_pyi_deps.
+func generateStubLibrary(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	parser *python3Parser,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	visibility []string,
+	stubs *treeset.Set,
+	name string,
+	result *language.GenerateResult,
+	collisionErrors *singlylinkedlist.List,
+) {
+	if err := ensureNoCollision(args.Config, args.File, name, pyLibraryKind); err != nil {
+		fqTarget := label.New("", args.Rel, name)
+		collisionErrors.Add(fmt.Errorf("failed to generate target %q of kind %q for the type stubs: %w",
+			fqTarget.String(), getMappedKind(args.Config, pyLibraryKind), err))
+		return
+	}
+	deps, _, annotations, err := parser.parse(stubs)
+	if err != nil {
+		log.Fatalf("ERROR: %v\n", err)
+	}
+	stubDeps := treeset.NewWith(moduleComparator)
+	for _, dep := range deps.Values() {
+		mod := dep.(Module)
+		mod.TypeCheckingOnly = true
+		stubDeps.Add(mod)
+	}
+	stubLibrary := newTargetBuilder(pyLibraryKind, name, pythonProjectRoot, args.Rel, pyFileNames, false).
+		addVisibility(visibility).
+		addPyiSrcs(stubs).
+		addModuleDependencies(stubDeps).
+		addResolvedDependencies(annotations.includeDeps).
+		generateImportsAttribute().
+		setAnnotations(*annotations).
+		build()
+	addPyTypedData(args, cfg, stubLibrary, stubs)
+	result.Gen = append(result.Gen, stubLibrary)
+	result.Imports = append(result.Imports, stubLibrary.PrivateAttr(config.GazelleImportsKey))
+}
+
+// stubImports returns the modules provided by the type stubs of the pyi_srcs
+// of the rule r without a Python module of the same name in its srcs, e.g. the
+// ones of the native extensions or the ones of the stub libraries.
+func stubImports(pythonProjectRoot, pkg string, r *rule.Rule, srcs []string) []resolve.ImportSpec {
+	modules := make(map[string]bool, len(srcs))
+	for _, src := range srcs {
+		modules[src] = true
+	}
+	var provides []resolve.ImportSpec
+	for _, stub := range r.AttrStrings("pyi_srcs") {
+		if filepath.Ext(stub) != stubExt {
+			continue
+		}
+		module := strings.TrimSuffix(stub, stubExt) + ".py"
+		if !modules[module] {
+			provides = append(provides, importSpecFromSrc(pythonProjectRoot, pkg, module))
+		}
+	}
+	return provides
+}
+
+// recordStubLibrary records whether the indexed rule r of the file f is a stub
+// library, i.e. a py_library with type stubs only.
+func (py *Resolver) recordStubLibrary(repo string, r *rule.Rule, f *rule.File, srcs []string) {
+	if r.Kind() != pyLibraryKind || len(srcs) > 0 || len(r.AttrStrings("pyi_srcs")) == 0 {
+		return
+	}
+	if py.stubLibraries == nil {
+		py.stubLibraries = make(map[string]bool)
+	}
+	py.stubLibraries[label.New(repo, f.Pkg, r.Name()).String()] = true
+}
+
+// isStubLibrary returns whether the indexed target is a stub library.
+func (py *Resolver) isStubLibrary(target label.Label) bool {
+	return py.stubLibraries[target.String()]
+}
+
+// partitionStubMatches splits the matches of an import between the stub
+// libraries and the other targets.
+func (py *Resolver) partitionStubMatches(matches []resolve.FindResult) (stubs, others []resolve.FindResult) {
+	for _, match := range matches {
+		if py.isStubLibrary(match.Label) {
+			stubs = append(stubs, match)
+		} else {
+			others = append(others, match)
+		}
+	}
+	return stubs, others
+}
+
+// addStubDependencies adds the stub libraries to the type-checking
+// dependencies of the resolved rule, for the import of mod.
+func (py *Resolver) addStubDependencies(res *ruleResolution, mod Module, stubs []resolve.FindResult) {
+	for _, stub := range stubs {
+		if stub.IsSelfImport(res.from) || py.isSelfImport(stub.Label, res.from) {
+			continue
+		}
+		dep := stub.Label.Rel(res.from.Repo, res.from.Pkg).String()
+		addDependency(dep, true, res.deps, res.pyiDeps)
+		res.addDependencySource(dep, mod)
+	}
+}
@@ -0,0 +1,40 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestStubImports(t *testing.T) {
+	r := rule.NewRule(pyLibraryKind, "native")
+	r.SetAttr("srcs", []string{"__init__.py", "wrapper.py"})
+	r.SetAttr("pyi_srcs", []string{"__init__.pyi", "_speedups.pyi", "wrapper.pyi", "py.typed"})
+
+	var imports []string
+	for _, spec := range stubImports("src", "src/pkg/native", r, r.AttrStrings("srcs")) {
+		imports = append(imports, spec.Imp)
+	}
+	assert.Equal(t, []string{"pkg.native._speedups"}, imports)
+
+	var stubImportsOnly []string
+	for _, spec := range stubImports("", "fastmath", r, nil) {
+		stubImportsOnly = append(stubImportsOnly, spec.Imp)
+	}
+	assert.Equal(t, []string{"fastmath", "fastmath._speedups", "fastmath.wrapper"}, stubImportsOnly)
+}
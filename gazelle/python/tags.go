@@ -0,0 +1,107 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"slices"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+)
+
+// ruleInFile returns the rule of the BUILD file the generated rule r is merged
+// into, so that its tags can be updated, or r itself for a new rule.
+func ruleInFile(args language.GenerateArgs, r *rule.Rule) *rule.Rule {
+	if args.File == nil {
+		return r
+	}
+	for _, existing := range args.File.Rules {
+		if existing.Name() == r.Name() && kindMatches(args.Config, existing, r.Kind()) {
+			return existing
+		}
+	}
+	return r
+}
+
+// addTaggedTargets adds the rules generated in the package to targets, keyed
+// by label, so that their tags can be updated once the dependencies are
+// resolved. Rules marked with a "# keep" comment are skipped.
+func addTaggedTargets(targets map[string]*rule.Rule, args language.GenerateArgs, gen []*rule.Rule) map[string]*rule.Rule {
+	if targets == nil {
+		targets = make(map[string]*rule.Rule)
+	}
+	for _, r := range gen {
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() {
+			continue
+		}
+		targets[label.New(args.Config.RepoName, args.Rel, r.Name()).String()] = target
+	}
+	return targets
+}
+
+// setPrefixedTags replaces the tags of the rule starting with prefix by the
+// given values, each one prefixed, keeping its other tags.
+func setPrefixedTags(r *rule.Rule, prefix string, values []string) {
+	tags := make([]string, 0, len(values))
+	for _, value := range values {
+		tags = append(tags, prefix+value)
+	}
+	replaceTags(r, func(tag string) bool { return strings.HasPrefix(tag, prefix) }, tags)
+}
+
+// setTag adds the tag to the rule, or removes it, keeping its other tags.
+func setTag(r *rule.Rule, tag string, present bool) {
+	var tags []string
+	if present {
+		tags = []string{tag}
+	}
+	replaceTags(r, func(t string) bool { return t == tag }, tags)
+}
+
+// replaceTags removes the tags of the rule matched by remove, and adds the
+// given tags after the remaining ones. Tags that are not a plain list of
+// strings, or that are marked with a "# keep" comment, are left untouched.
+func replaceTags(r *rule.Rule, remove func(tag string) bool, add []string) {
+	if expr := r.Attr("tags"); expr != nil {
+		list, ok := expr.(*bzl.ListExpr)
+		if !ok || rule.ShouldKeep(list) {
+			return
+		}
+		for _, elem := range list.List {
+			if _, ok := elem.(*bzl.StringExpr); !ok || rule.ShouldKeep(elem) {
+				return
+			}
+		}
+	}
+	current := r.AttrStrings("tags")
+	var tags []string
+	for _, tag := range current {
+		if !remove(tag) {
+			tags = append(tags, tag)
+		}
+	}
+	tags = append(tags, add...)
+	switch {
+	case slices.Equal(tags, current):
+	case len(tags) == 0:
+		r.DelAttr("tags")
+	default:
+		r.SetAttr("tags", tags)
+	}
+}
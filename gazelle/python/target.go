@@ -30,6 +30,8 @@ type targetBuilder struct {
 	pythonProjectRoot     string
 	bzlPackage            string
 	srcs                  *treeset.Set
+	srcsGlob              *srcsGlob
+	replaceSrcsGlob       bool
 	pyiSrcs               *treeset.Set
 	siblingSrcs           *treeset.Set
 	deps                  *treeset.Set
@@ -151,6 +153,20 @@ func (t *targetBuilder) setTestonly() *targetBuilder {
 	return t
 }
 
+// setSrcsGlob writes the srcs of the target as the glob, see
+// python_srcs_strategy.
+func (t *targetBuilder) setSrcsGlob(g srcsGlob) *targetBuilder {
+	t.srcsGlob = &g
+	return t
+}
+
+// replaceExistingSrcsGlob replaces the glob of the srcs of the existing
+// target with the listed srcs.
+func (t *targetBuilder) replaceExistingSrcsGlob() *targetBuilder {
+	t.replaceSrcsGlob = true
+	return t
+}
+
 // setAnnotations sets the annotations attribute on the target.
 func (t *targetBuilder) setAnnotations(val annotations) *targetBuilder {
 	t.annotations = &val
@@ -162,24 +178,27 @@ func (t *targetBuilder) setAnnotations(val annotations) *targetBuilder {
 // case, the value we add is on Bazel sub-packages to be able to perform imports
 // relative to the root project package.
 func (t *targetBuilder) generateImportsAttribute() *targetBuilder {
-	if t.pythonProjectRoot == "" {
-		// When gazelle:python_root is not set or is at the root of the repo, we don't need
-		// to set imports, because that's the Bazel's default.
-		return t
-	}
-	p, _ := filepath.Rel(t.bzlPackage, t.pythonProjectRoot)
-	p = filepath.Clean(p)
-	if p == "." {
-		return t
-	}
-	t.imports = []string{p}
+	t.imports = importsAttr(t.pythonProjectRoot, t.bzlPackage)
 	return t
 }
 
 // build returns the assembled *rule.Rule for the target.
 func (t *targetBuilder) build() *rule.Rule {
 	r := rule.NewRule(t.kind, t.name)
-	if !t.srcs.Empty() {
+	if t.srcsGlob != nil && !t.srcs.Empty() {
+		r.SetAttr("srcs", *t.srcsGlob)
+		srcs := make([]string, 0, t.srcs.Size())
+		for _, src := range t.srcs.Values() {
+			srcs = append(srcs, src.(string))
+		}
+		r.SetPrivateAttr(globbedSrcsKey, srcs)
+	} else if t.replaceSrcsGlob && !t.srcs.Empty() {
+		srcs := make(listedSrcs, 0, t.srcs.Size())
+		for _, src := range t.srcs.Values() {
+			srcs = append(srcs, src.(string))
+		}
+		r.SetAttr("srcs", srcs)
+	} else if !t.srcs.Empty() {
 		r.SetAttr("srcs", t.srcs.Values())
 	}
 	if !t.pyiSrcs.Empty() {
@@ -200,6 +219,26 @@ func (t *targetBuilder) build() *rule.Rule {
 	if t.testonly {
 		r.SetAttr("testonly", true)
 	}
+	if len(t.annotations.pytestMarkers) > 0 {
+		r.SetPrivateAttr(pytestMarkersKey, t.annotations.pytestMarkers)
+	}
+	if t.annotations.testCases > 0 {
+		r.SetPrivateAttr(testCasesKey, t.annotations.testCases)
+	}
+	if len(t.annotations.doctestFiles) > 0 {
+		r.SetPrivateAttr(doctestFilesKey, t.annotations.doctestFiles)
+	}
+	if len(t.annotations.packageData) > 0 {
+		r.SetPrivateAttr(packageDataKey, t.annotations.packageData)
+	}
+	if t.annotations.noDepsOrder {
+		r.SetPrivateAttr(noDepsOrderKey, true)
+	}
 	r.SetPrivateAttr(resolvedDepsKey, t.resolvedDeps)
+	srcs := make([]string, 0, t.srcs.Size())
+	for _, src := range t.srcs.Values() {
+		srcs = append(srcs, src.(string))
+	}
+	r.SetPrivateAttr(srcsForOrderingKey, srcs)
 	return r
 }
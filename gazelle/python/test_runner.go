@@ -0,0 +1,109 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+const (
+	// pyPytestMainKind is the kind of the targets generating the __test__.py
+	// file running the tests of a package with pytest, see
+	// python_test_runner.
+	pyPytestMainKind = "py_pytest_main"
+	// pytestModule is the module of pytest, resolved through the manifest
+	// like the imports of the tests.
+	pytestModule = "pytest"
+)
+
+// parseTestRunner parses the value of the python_test_runner directive, e.g.
+// "pytest --import-mode=importlib", into the test runner and the arguments
+// passed to it.
+func parseTestRunner(value string) (pythonconfig.TestRunnerType, []string, error) {
+	fields := strings.Fields(value)
+	if len(fields) == 0 {
+		return "", nil, fmt.Errorf("expected a test runner, e.g. \"pytest\"")
+	}
+	switch testRunner := pythonconfig.TestRunnerType(fields[0]); testRunner {
+	case pythonconfig.TestRunnerNone:
+		if len(fields) > 1 {
+			return "", nil, fmt.Errorf("unexpected arguments %q without a test runner", strings.Join(fields[1:], " "))
+		}
+		return testRunner, nil, nil
+	case pythonconfig.TestRunnerPytest:
+		return testRunner, fields[1:], nil
+	default:
+		return "", nil, fmt.Errorf("unknown test runner %q: expected one of %s, %s",
+			fields[0], pythonconfig.TestRunnerNone, pythonconfig.TestRunnerPytest)
+	}
+}
+
+// generatePytestMain generates, with python_test_runner, the py_pytest_main
+// target named __test__ of a package with tests, used as the main of its
+// py_test targets. It depends on pytest and passes it the arguments of the
+// directive. The generated target of a package without tests anymore is
+// emptied, while a __test__ target of another kind, written by hand, is kept.
+// It returns whether the package has a __test__ target.
+func generatePytestMain(
+	args language.GenerateArgs,
+	cfg *pythonconfig.Config,
+	pythonProjectRoot string,
+	pyFileNames *treeset.Set,
+	hasTests bool,
+	result *language.GenerateResult,
+) bool {
+	var existing *rule.Rule
+	if args.File != nil {
+		for _, r := range args.File.Rules {
+			if r.Name() == pyTestEntrypointTargetname {
+				existing = r
+				break
+			}
+		}
+	}
+	if existing != nil && !kindMatches(args.Config, existing, pyPytestMainKind) {
+		return true
+	}
+	if !hasTests {
+		if existing != nil {
+			result.Empty = append(result.Empty, rule.NewRule(pyPytestMainKind, pyTestEntrypointTargetname))
+		}
+		return false
+	}
+
+	pytestMain := newTargetBuilder(pyPytestMainKind, pyTestEntrypointTargetname, pythonProjectRoot, args.Rel, pyFileNames, false)
+	if !cfg.IgnoresDependency(pytestModule) {
+		pytestMain.addModuleDependency(Module{
+			Name:     pytestModule,
+			Filepath: filepath.Join(args.Rel, pyTestEntrypointFilename),
+		})
+	}
+	r := pytestMain.build()
+	if runnerArgs := cfg.TestRunnerArgs(); len(runnerArgs) > 0 {
+		r.SetAttr("args", runnerArgs)
+	}
+	result.Gen = append(result.Gen, r)
+	result.Imports = append(result.Imports, r.PrivateAttr(config.GazelleImportsKey))
+	return true
+}
@@ -0,0 +1,86 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/emirpasic/gods/sets/treeset"
+	godsutils "github.com/emirpasic/gods/utils"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestParseTestRunner(t *testing.T) {
+	testRunner, args, err := parseTestRunner("pytest --import-mode=importlib -p no:cacheprovider")
+	assert.NoError(t, err)
+	assert.Equal(t, pythonconfig.TestRunnerPytest, testRunner)
+	assert.Equal(t, []string{"--import-mode=importlib", "-p", "no:cacheprovider"}, args)
+
+	testRunner, args, err = parseTestRunner("none")
+	assert.NoError(t, err)
+	assert.Equal(t, pythonconfig.TestRunnerNone, testRunner)
+	assert.Empty(t, args)
+
+	for _, value := range []string{"", "unittest", "none -v"} {
+		_, _, err := parseTestRunner(value)
+		assert.Error(t, err, value)
+	}
+}
+
+func TestGeneratePytestMain(t *testing.T) {
+	cfg := pythonconfig.New("/repo", "")
+	cfg.SetTestRunner(pythonconfig.TestRunnerPytest, []string{"--import-mode=importlib"})
+	pyFileNames := treeset.NewWith(godsutils.StringComparator, "app_test.py")
+	load := func(build string) *rule.File {
+		f, err := rule.LoadData("BUILD", "app", []byte(build))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return f
+	}
+
+	var result language.GenerateResult
+	args := language.GenerateArgs{Config: config.New(), Rel: "app"}
+	assert.True(t, generatePytestMain(args, cfg, "", pyFileNames, true, &result))
+	if assert.Len(t, result.Gen, 1) {
+		r := result.Gen[0]
+		assert.Equal(t, pyPytestMainKind, r.Kind())
+		assert.Equal(t, pyTestEntrypointTargetname, r.Name())
+		assert.Equal(t, []string{"--import-mode=importlib"}, r.AttrStrings("args"))
+		imports := r.PrivateAttr(config.GazelleImportsKey).(*treeset.Set)
+		if assert.Equal(t, 1, imports.Size()) {
+			assert.Equal(t, pytestModule, imports.Values()[0].(Module).Name)
+		}
+	}
+
+	result = language.GenerateResult{}
+	args.File = load(`py_pytest_main(name = "__test__")`)
+	assert.False(t, generatePytestMain(args, cfg, "", pyFileNames, false, &result))
+	assert.Empty(t, result.Gen)
+	if assert.Len(t, result.Empty, 1) {
+		assert.Equal(t, pyTestEntrypointTargetname, result.Empty[0].Name())
+	}
+
+	result = language.GenerateResult{}
+	args.File = load(`pytest_main(name = "__test__")`)
+	assert.True(t, generatePytestMain(args, cfg, "", pyFileNames, true, &result))
+	assert.Empty(t, result.Gen)
+	assert.Empty(t, result.Empty)
+}
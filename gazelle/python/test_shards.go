@@ -0,0 +1,203 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"bytes"
+	"math"
+	"path"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	sitter "github.com/smacker/go-tree-sitter"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// testCasesKey is the private attribute of the generated rules holding the
+// estimated number of test cases of their sources, see
+// python_test_shard_cases.
+const testCasesKey = "_gazelle_python_test_cases"
+
+const (
+	sitterNodeTypeDecoratedDefinition = "decorated_definition"
+	sitterNodeTypeFunctionDefinition  = "function_definition"
+	sitterNodeTypeClassDefinition     = "class_definition"
+	sitterNodeTypeKeywordArgument     = "keyword_argument"
+	// pytestParametrize is the marker generating a test case for each of its
+	// argvalues.
+	pytestParametrize = pytestMarkAttribute + ".parametrize"
+)
+
+// testShardCount returns the shard_count balancing a test target of the
+// package rel, from its test files srcs and its estimated number of test
+// cases, or 0 when the target isn't worth sharding. With a test timings file
+// and python_test_shard_seconds, the duration of the target is estimated from
+// the timings of its files, the files without timing taking the average
+// duration of the others. Otherwise, with python_test_shard_cases, the test
+// cases are spread evenly across the shards, and with python_test_shard_files,
+// the files are. The shard_count is bounded by python_test_shard_max.
+func testShardCount(cfg *pythonconfig.Config, rel string, srcs []string, cases int) int {
+	count := 0
+	if testTimings := cfg.TestTimings(); testTimings != nil && cfg.TestShardSeconds() > 0 && len(srcs) >= 2 {
+		total, known := 0.0, 0
+		for _, src := range srcs {
+			if seconds, ok := testTimings.Seconds[path.Join(rel, src)]; ok {
+				total += seconds
+				known++
+			}
+		}
+		if known > 0 {
+			total += total / float64(known) * float64(len(srcs)-known)
+			count = min(int(math.Ceil(total/float64(cfg.TestShardSeconds()))), len(srcs))
+		}
+	}
+	if count == 0 && cfg.TestShardCases() > 0 {
+		count = (cases + cfg.TestShardCases() - 1) / cfg.TestShardCases()
+	}
+	if count == 0 && cfg.TestShardFiles() > 0 && len(srcs) >= 2 {
+		count = (len(srcs) + cfg.TestShardFiles() - 1) / cfg.TestShardFiles()
+		count = min(count, len(srcs))
+	}
+	if maxCount := cfg.TestShardMax(); maxCount > 0 && count > maxCount {
+		count = maxCount
+	}
+	if count < 2 {
+		return 0
+	}
+	return count
+}
+
+// countTestCases returns the estimated number of test cases of the code: the
+// test functions of the module and of its test classes, as collected by
+// pytest by default, each multiplied by the number of argvalues of the
+// parametrize markers applied to it or to its classes.
+func (p *FileParser) countTestCases(node *sitter.Node) int {
+	if !bytes.Contains(p.code, []byte("def test")) {
+		return 0
+	}
+	return p.countBlockTestCases(node, 1)
+}
+
+// countBlockTestCases returns the number of test cases of the functions and
+// classes of the block, each function counting for factor test cases times
+// the argvalues of its parametrize markers.
+func (p *FileParser) countBlockTestCases(block *sitter.Node, factor int) int {
+	cases := 0
+	for i := 0; i < int(block.NamedChildCount()); i++ {
+		definition, defFactor := block.NamedChild(i), factor
+		if definition.Type() == sitterNodeTypeDecoratedDefinition {
+			for j := 0; j < int(definition.NamedChildCount()); j++ {
+				decorator := definition.NamedChild(j)
+				if decorator.Type() == sitterNodeTypeDecorator && decorator.NamedChildCount() > 0 {
+					defFactor *= p.parametrizeValues(decorator.NamedChild(0))
+				}
+			}
+			definition = definition.ChildByFieldName("definition")
+			if definition == nil {
+				continue
+			}
+		}
+		name := definition.ChildByFieldName("name")
+		if name == nil {
+			continue
+		}
+		switch definition.Type() {
+		case sitterNodeTypeFunctionDefinition:
+			if strings.HasPrefix(name.Content(p.code), "test") {
+				cases += defFactor
+			}
+		case sitterNodeTypeClassDefinition:
+			if body := definition.ChildByFieldName("body"); body != nil && strings.HasPrefix(name.Content(p.code), "Test") {
+				cases += p.countBlockTestCases(body, defFactor)
+			}
+		}
+	}
+	return cases
+}
+
+// parametrizeValues returns the number of argvalues of the decorator
+// expression when it's a parametrize marker with a literal list or tuple of
+// argvalues, e.g. 3 for `pytest.mark.parametrize("n", [1, 2, 3])`, or 1.
+func (p *FileParser) parametrizeValues(node *sitter.Node) int {
+	if node.Type() != sitterNodeTypeCall {
+		return 1
+	}
+	function, arguments := node.ChildByFieldName("function"), node.ChildByFieldName("arguments")
+	if function == nil || arguments == nil || function.Content(p.code) != pytestParametrize {
+		return 1
+	}
+	var argvalues *sitter.Node
+	positional := 0
+	for i := 0; i < int(arguments.NamedChildCount()); i++ {
+		arg := arguments.NamedChild(i)
+		switch arg.Type() {
+		case sitterNodeTypeComment:
+		case sitterNodeTypeKeywordArgument:
+			if name := arg.ChildByFieldName("name"); name != nil && name.Content(p.code) == "argvalues" {
+				argvalues = arg.ChildByFieldName("value")
+			}
+		default:
+			if positional++; positional == 2 {
+				argvalues = arg
+			}
+		}
+	}
+	if argvalues == nil || (argvalues.Type() != sitterNodeTypeList && argvalues.Type() != sitterNodeTypeTuple) {
+		return 1
+	}
+	values := 0
+	for i := 0; i < int(argvalues.NamedChildCount()); i++ {
+		if argvalues.NamedChild(i).Type() != sitterNodeTypeComment {
+			values++
+		}
+	}
+	return max(values, 1)
+}
+
+// setTestShardCounts sets the shard_count of the test targets generated in
+// the package from their test files, when python_test_shard_seconds,
+// python_test_shard_cases or python_test_shard_files applies to it. The shard_count isn't mergeable, so
+// the one of the existing rules is updated, or removed once the target is
+// small enough to run in a single shard. The rules and the shard_count marked
+// with a "# keep" comment are left untouched.
+func setTestShardCounts(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if cfg.TestShardSeconds() == 0 && cfg.TestShardCases() == 0 && cfg.TestShardFiles() == 0 {
+		return
+	}
+	for _, r := range gen {
+		if r.Kind() != pyTestKind {
+			continue
+		}
+		target := ruleInFile(args, r)
+		if target.ShouldKeep() || attrShouldKeep(target, "shard_count") {
+			continue
+		}
+		// The __test__.py entry point only runs the test files.
+		var srcs []string
+		for _, src := range r.AttrStrings("srcs") {
+			if src != pyTestEntrypointFilename {
+				srcs = append(srcs, src)
+			}
+		}
+		cases, _ := r.PrivateAttr(testCasesKey).(int)
+		if count := testShardCount(cfg, args.Rel, srcs, cases); count > 0 {
+			target.SetAttr("shard_count", count)
+		} else {
+			target.DelAttr("shard_count")
+		}
+	}
+}
@@ -0,0 +1,136 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestTestShardCount(t *testing.T) {
+	timingsPath := filepath.Join(t.TempDir(), "test_timings.json")
+	if err := os.WriteFile(timingsPath, []byte(`{"seconds": {"app/a_test.py": 90, "app/b_test.py": 30}}`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	cfg := pythonconfig.New("/repo", "")
+	cfg.SetTestTimingsPath(timingsPath)
+	cfg.SetTestShardSeconds(30)
+	cfg.SetTestShardFiles(2)
+
+	for name, tc := range map[string]struct {
+		rel   string
+		srcs  []string
+		cases int
+		want  int
+	}{
+		"single file":            {"app", []string{"a_test.py"}, 0, 0},
+		"timed files":            {"app", []string{"a_test.py", "b_test.py"}, 0, 2},
+		"untimed files use mean": {"app", []string{"a_test.py", "b_test.py", "c_test.py", "d_test.py"}, 0, 4},
+		"capped by files":        {"app", []string{"a_test.py", "c_test.py"}, 0, 2},
+		"fallback to files":      {"lib", []string{"a_test.py", "b_test.py", "c_test.py"}, 0, 2},
+		"single shard":           {"lib", []string{"a_test.py", "b_test.py"}, 0, 0},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := testShardCount(cfg, tc.rel, tc.srcs, tc.cases); got != tc.want {
+				t.Errorf("testShardCount(%q, %v) = %d, want %d", tc.rel, tc.srcs, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestTestShardCountCases(t *testing.T) {
+	cfg := pythonconfig.New("/repo", "")
+	cfg.SetTestShardCases(10)
+	cfg.SetTestShardFiles(1)
+	cfg.SetTestShardMax(4)
+
+	for name, tc := range map[string]struct {
+		srcs  []string
+		cases int
+		want  int
+	}{
+		"single file":       {[]string{"a_test.py"}, 25, 3},
+		"single shard":      {[]string{"a_test.py", "b_test.py"}, 10, 0},
+		"bounded by max":    {[]string{"a_test.py"}, 100, 4},
+		"fallback to files": {[]string{"a_test.py", "b_test.py"}, 0, 2},
+	} {
+		t.Run(name, func(t *testing.T) {
+			if got := testShardCount(cfg, "app", tc.srcs, tc.cases); got != tc.want {
+				t.Errorf("testShardCount(%v, %d) = %d, want %d", tc.srcs, tc.cases, got, tc.want)
+			}
+		})
+	}
+}
+
+func TestCountTestCases(t *testing.T) {
+	code := `
+import pytest
+
+CASES = [1, 2]
+
+def helper():
+    pass
+
+def test_plain():
+    pass
+
+@pytest.mark.parametrize("a", [1, 2, 3])
+@pytest.mark.parametrize(
+    "b",
+    (
+        # The comments aren't values.
+        "x",
+        pytest.param("y", marks=pytest.mark.slow),
+    ),
+)
+def test_matrix(a, b):
+    pass
+
+@pytest.mark.parametrize("n", CASES)
+def test_dynamic(n):
+    pass
+
+@pytest.mark.parametrize(argnames="n", argvalues=[1, 2])
+class TestGroup:
+    def test_one(self, n):
+        pass
+
+    @pytest.mark.parametrize("m", [1, 2, 3])
+    def test_two(self, n, m):
+        pass
+
+    def helper(self):
+        pass
+
+class Helper:
+    def test_ignored(self):
+        pass
+`
+	p := NewFileParser()
+	p.SetCodeAndFile([]byte(code), "", "test_foo.py")
+
+	output, err := p.Parse(context.Background())
+	if err != nil {
+		t.Fatalf("Failed to parse: %v", err)
+	}
+	// 1 + 3*2 + 1 + 2*(1 + 3)
+	if output.TestCases != 16 {
+		t.Errorf("TestCases = %d, want 16", output.TestCases)
+	}
+}
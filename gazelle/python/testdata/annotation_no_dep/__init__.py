@@ -0,0 +1,10 @@
+import sys
+
+import yaml
+
+# ujson is only imported when available in the runtime environment, so it
+# shouldn't produce a dependency, while simplejson still does.
+if sys.version_info < (3, 12):
+    import ujson as json  # gazelle:no-dep
+else:
+    import simplejson as json
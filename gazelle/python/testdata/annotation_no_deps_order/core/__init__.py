@@ -0,0 +1,2 @@
+# gazelle:no_deps_order
+import api
@@ -0,0 +1,8 @@
+import yaml
+
+# attrs and typing_extensions are only used by the type annotations, so they
+# should be added to pyi_deps even though they're imported at runtime.
+import attrs  # gazelle:typing-only
+from typing_extensions import (
+    Self,
+)  # gazelle:typing-only
@@ -0,0 +1,2 @@
+import ignored.lib
+import json
@@ -0,0 +1,3 @@
+import api
+
+from core import db
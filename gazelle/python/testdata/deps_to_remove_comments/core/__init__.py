@@ -0,0 +1,2 @@
+import api
+import tools.fmt
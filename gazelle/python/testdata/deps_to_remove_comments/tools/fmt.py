@@ -0,0 +1,2 @@
+def format_source(source):
+    return source.strip()
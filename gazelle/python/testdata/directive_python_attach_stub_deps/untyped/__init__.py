@@ -0,0 +1 @@
+import boto3
@@ -0,0 +1,5 @@
+import sys
+
+from service import handlers
+
+print(handlers.handle(sys.argv[1]))
@@ -0,0 +1,5 @@
+from corp.billing import invoice
+
+
+def checkout(user):
+    return invoice.charge(user, 42)
@@ -0,0 +1,2 @@
+def sign(payload):
+    return payload[::-1]
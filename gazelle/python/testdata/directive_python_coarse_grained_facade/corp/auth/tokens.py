@@ -0,0 +1,2 @@
+def issue(user):
+    return "token-" + user
@@ -0,0 +1,5 @@
+from corp.auth import tokens
+
+
+def charge(user, amount):
+    return tokens.issue(user), amount
@@ -0,0 +1,5 @@
+from pkg import answer
+
+
+def test_answer():
+    assert answer() == 42
@@ -0,0 +1,2 @@
+import core
+import shared.http
@@ -0,0 +1 @@
+import shared.http
@@ -0,0 +1,5 @@
+import importlib
+import sys
+
+for module in sys.argv[1:]:
+    importlib.import_module(module)
@@ -0,0 +1,2 @@
+# Generated by flymake, see the flymake-mode of Emacs.
+import util
@@ -0,0 +1,2 @@
+import shared_utils
+from shared_utils import strings
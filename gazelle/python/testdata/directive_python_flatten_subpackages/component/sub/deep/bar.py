@@ -0,0 +1,2 @@
+from component.sub.foo import foo
+from component.boundary import baz
@@ -0,0 +1 @@
+from component.sub.deep import bar
@@ -0,0 +1 @@
+from app.scripts import seed
@@ -0,0 +1,5 @@
+from app.models import user
+
+
+def seed():
+    return [user.User("admin")]
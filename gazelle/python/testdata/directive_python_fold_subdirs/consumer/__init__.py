@@ -0,0 +1 @@
+from app.scripts.data import load
@@ -0,0 +1,6 @@
+from fastmath import vector
+from fastmath.matrix import scale
+
+
+def report(x, y):
+    return scale(vector.Vector(x, y), 2).norm()
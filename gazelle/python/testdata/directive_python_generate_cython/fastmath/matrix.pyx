@@ -0,0 +1,8 @@
+from fastmath.vector cimport Vector
+
+import util
+
+
+def scale(Vector v, double factor):
+    util.log("scaling")
+    return Vector(v.x * factor, v.y * factor)
@@ -0,0 +1,4 @@
+cdef class Vector:
+    cdef double x, y
+
+    cpdef double dot(self, Vector other)
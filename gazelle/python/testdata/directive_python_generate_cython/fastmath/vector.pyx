@@ -0,0 +1,11 @@
+from libc.math cimport sqrt
+
+from fastmath.vector cimport Vector
+
+
+cdef class Vector:
+    cpdef double dot(self, Vector other):
+        return self.x * other.x + self.y * other.y
+
+    def norm(self):
+        return sqrt(self.dot(self))
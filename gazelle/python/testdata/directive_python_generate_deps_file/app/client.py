@@ -0,0 +1,3 @@
+import requests
+
+from app import client
@@ -0,0 +1,6 @@
+import yaml
+
+from app import client
+
+if __name__ == "__main__":
+    client
@@ -0,0 +1,6 @@
+def double(n):
+    """
+    >>> double(2)
+    4
+    """
+    return n * 2
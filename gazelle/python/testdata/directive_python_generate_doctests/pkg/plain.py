@@ -0,0 +1,13 @@
+# >>> isn't an example outside of the docstrings.
+
+
+def outer():
+    """Returns the inner function."""
+
+    def inner():
+        """The nested functions aren't collected by doctest.
+
+        >>> inner()
+        """
+
+    return inner
@@ -0,0 +1,11 @@
+from pkg import utils
+
+
+class Square:
+    def area(self, side):
+        """Returns the area of the square.
+
+        >>> Square().area(2)
+        4
+        """
+        return utils.add(0, side * side)
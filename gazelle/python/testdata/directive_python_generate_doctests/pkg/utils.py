@@ -0,0 +1,9 @@
+"""Utilities.
+
+>>> add(1, 2)
+3
+"""
+
+
+def add(a, b):
+    return a + b
@@ -0,0 +1 @@
+from hand.core import run
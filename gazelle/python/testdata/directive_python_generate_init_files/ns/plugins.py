@@ -0,0 +1 @@
+PLUGINS = []
@@ -0,0 +1,7 @@
+import requests
+
+from my_cli import plugins
+
+
+def main():
+    return requests.get(plugins.core())
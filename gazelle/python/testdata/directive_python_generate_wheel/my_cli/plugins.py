@@ -0,0 +1,2 @@
+def core():
+    return "https://example.com"
@@ -0,0 +1 @@
+from tests import fixtures
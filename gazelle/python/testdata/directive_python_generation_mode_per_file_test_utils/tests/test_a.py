@@ -0,0 +1,5 @@
+from tests import helpers
+
+
+def test_a():
+    helpers.make()
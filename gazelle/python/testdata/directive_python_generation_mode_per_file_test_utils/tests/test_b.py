@@ -0,0 +1,5 @@
+import lib.other
+
+
+def test_b():
+    pass
@@ -0,0 +1,3 @@
+import foo.bar.baz.impl
+import foo.bar.qux
+import pkg.mod
@@ -0,0 +1,3 @@
+import torch
+
+import lib
@@ -0,0 +1 @@
+from app.utils import strings
@@ -0,0 +1,6 @@
+import fastlib
+from native import codec
+
+
+def run(data):
+    return fastlib.checksum(codec.decode(data))
@@ -0,0 +1,2 @@
+def summarize(df):
+    return df.describe()
@@ -0,0 +1,3 @@
+import foo
+import foo.core
+from foo.sub import helpers
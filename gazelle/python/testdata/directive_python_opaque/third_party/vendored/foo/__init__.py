@@ -0,0 +1 @@
+from foo.core import run
@@ -0,0 +1,5 @@
+import yaml
+
+
+def run():
+    pass
@@ -0,0 +1 @@
+import foo.core
@@ -0,0 +1,9 @@
+import importlib.resources
+import pkgutil
+from importlib.resources import files
+
+SCHEMA = importlib.resources.files("mypkg").joinpath("schema.json").read_text()
+CONFIG = pkgutil.get_data(__name__, "data/config.yaml")
+LOGO = files("assets") / "logo.png"
+MISSING = importlib.resources.read_text("mypkg", "missing.txt")
+TEMPLATES = files(__package__) / "templates"
@@ -0,0 +1,3 @@
+import importlib.resources
+
+TEMPLATE = importlib.resources.files("mypkg") / "templates" / "base.html"
@@ -0,0 +1,19 @@
+import os
+from pathlib import Path
+
+SCHEMA = Path(__file__).parent / "schema.json"
+
+
+def settings():
+    with open(os.path.join(os.path.dirname(__file__), "settings.ini")) as f:
+        return f.read()
+
+
+def cache():
+    with open("missing.txt") as f:
+        return f.read()
+
+
+def dump(value):
+    with open("out.txt", "w") as f:
+        f.write(value)
@@ -0,0 +1,7 @@
+import json
+from pathlib import Path
+
+
+def test_users():
+    users = json.loads(Path(__file__).with_name("fixtures").joinpath("users.json").read_text())
+    assert users == []
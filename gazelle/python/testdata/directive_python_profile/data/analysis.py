@@ -0,0 +1,6 @@
+from data.helpers import plot
+
+try:
+    import ujson
+except ImportError:
+    ujson = None
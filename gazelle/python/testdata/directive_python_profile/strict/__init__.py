@@ -0,0 +1 @@
+"""Strict package."""
@@ -0,0 +1 @@
+from strict import b
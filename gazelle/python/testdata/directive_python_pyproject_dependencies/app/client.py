@@ -0,0 +1,6 @@
+import requests
+from typing_extensions import Self
+
+
+def fetch():
+    return requests.get("https://example.com")
@@ -0,0 +1,7 @@
+import pytest
+
+from app import client
+
+
+def test_fetch():
+    assert client.fetch
@@ -0,0 +1,9 @@
+import pytest
+
+pytestmark = [pytest.mark.integration, pytest.mark.slow(reason="uses a database")]
+
+
+class TestApi:
+    @pytest.mark.gpu
+    def test_render(self):
+        assert True
@@ -0,0 +1,7 @@
+import pytest
+
+
+@pytest.mark.slow
+@pytest.mark.parametrize("n", [1, 2, 3])
+def test_slow(n):
+    assert n
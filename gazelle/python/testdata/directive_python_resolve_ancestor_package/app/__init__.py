@@ -0,0 +1,4 @@
+# No file provides the modules of the plugins, plugins.loader loads them
+# dynamically.
+import plugins.csv_reader
+from plugins.formats import json_writer
@@ -0,0 +1,5 @@
+import json as js
+
+
+def greet(user: "mypkg.models.User") -> "js.JSONDecoder":
+    return js.JSONDecoder()
@@ -0,0 +1 @@
+from vendored import util
@@ -0,0 +1,2 @@
+import secret
+from vendored import util
@@ -0,0 +1 @@
+TOKEN = "x"
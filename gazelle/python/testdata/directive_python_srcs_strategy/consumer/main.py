@@ -0,0 +1,4 @@
+from pkg.foo import foo
+from project.app import mod
+
+print(foo(), mod)
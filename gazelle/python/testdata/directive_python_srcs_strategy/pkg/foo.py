@@ -0,0 +1,5 @@
+from pkg import util
+
+
+def foo():
+    return util.helper()
@@ -0,0 +1,5 @@
+from pkg.foo import foo
+
+
+def test_foo():
+    assert foo() == 42
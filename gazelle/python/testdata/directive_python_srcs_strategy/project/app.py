@@ -0,0 +1,3 @@
+from project.sub import mod
+
+print(mod.VALUE)
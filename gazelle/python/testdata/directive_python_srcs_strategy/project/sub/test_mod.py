@@ -0,0 +1,5 @@
+from project.sub import mod
+
+
+def test_value():
+    assert mod.VALUE == 1
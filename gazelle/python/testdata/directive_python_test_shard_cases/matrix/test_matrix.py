@@ -0,0 +1,12 @@
+import pytest
+
+
+@pytest.mark.parametrize("backend", ["sqlite", "postgres", "mysql"])
+@pytest.mark.parametrize("size", [1, 10, 100, 1000])
+def test_insert(backend, size):
+    assert size
+
+
+class TestQuery:
+    def test_select(self):
+        assert True
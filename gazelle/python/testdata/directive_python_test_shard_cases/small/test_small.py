@@ -0,0 +1,6 @@
+import pytest
+
+
+@pytest.mark.parametrize("n", [1, 2, 3])
+def test_small(n):
+    assert n
@@ -0,0 +1,4 @@
+from tests.helpers.fixtures import NAMES
+
+if __name__ == "__main__":
+    print(NAMES)
@@ -0,0 +1 @@
+NAMES = ["alice", "bob"]
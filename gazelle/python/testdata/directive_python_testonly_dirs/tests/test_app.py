@@ -0,0 +1,7 @@
+from app.main import greet
+from tests.helpers.fixtures import NAMES
+
+
+def test_greet():
+    for name in NAMES:
+        assert greet(name)
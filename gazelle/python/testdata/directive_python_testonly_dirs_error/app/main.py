@@ -0,0 +1,3 @@
+import tests.fakes
+
+client = tests.fakes.FakeClient()
@@ -0,0 +1,4 @@
+import mycorp.vendor.foo.bar
+import mycorp.vendor.pinned
+import requests
+from mycorp.vendor import baz
@@ -0,0 +1,3 @@
+import boto3
+import django
+import requests
@@ -0,0 +1,3 @@
+import tomllib
+import zoneinfo
+from typing import Any, Self
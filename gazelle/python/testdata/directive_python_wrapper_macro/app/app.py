@@ -0,0 +1,5 @@
+from util import strings
+
+
+def shout(s):
+    return strings.upper(s) + "!"
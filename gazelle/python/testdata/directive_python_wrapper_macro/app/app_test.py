@@ -0,0 +1,8 @@
+import unittest
+
+from app import app
+
+
+class AppTest(unittest.TestCase):
+    def test_shout(self):
+        self.assertEqual(app.shout("hi"), "HI!")
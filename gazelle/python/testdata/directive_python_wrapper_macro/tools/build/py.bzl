@@ -0,0 +1,5 @@
+def my_py_library(name, sources = [], py_deps = [], **kwargs):
+    native.py_library(name = name, srcs = sources, deps = py_deps, **kwargs)
+
+def my_py_test(**kwargs):
+    native.py_test(**kwargs)
@@ -0,0 +1,5 @@
+import mycompany.legacy.accounts.models
+import mycompany.legacy.billing
+import mycompany.legacy.special
+import mycompany.plugins.foo.handlers
+from mycompany.legacy.reports import render
@@ -0,0 +1 @@
+from facade import Gadget, Widget, helper
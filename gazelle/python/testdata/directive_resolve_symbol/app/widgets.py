@@ -0,0 +1 @@
+from facade import Widget
@@ -0,0 +1,6 @@
+from impl.gadgets import Gadget
+from impl.widgets import Widget
+
+
+def helper():
+    pass
@@ -0,0 +1,5 @@
+import mycompany.legacy
+import mycompany.legacy.accounts
+import mycompany.legacy.billing
+import mycompany.legacy.special.tools
+from mycompany.legacy.reports import render
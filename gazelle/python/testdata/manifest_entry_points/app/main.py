@@ -0,0 +1,4 @@
+import awscli
+import awscli_wrapper.main
+import yaml
+from yaml_lint.cli import run
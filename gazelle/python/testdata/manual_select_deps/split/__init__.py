@@ -0,0 +1,2 @@
+import gpu
+import lib
@@ -0,0 +1,2 @@
+import company
+import company.foo
@@ -0,0 +1 @@
+import company.ns
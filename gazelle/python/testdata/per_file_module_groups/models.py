@@ -0,0 +1,5 @@
+from models_mixins import TimestampMixin
+
+
+class User(TimestampMixin):
+    pass
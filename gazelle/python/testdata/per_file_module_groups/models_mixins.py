@@ -0,0 +1,2 @@
+class TimestampMixin:
+    created_at = None
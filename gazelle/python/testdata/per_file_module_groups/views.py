@@ -0,0 +1,6 @@
+import models
+from models_mixins import TimestampMixin
+
+
+def show(user: models.User) -> TimestampMixin:
+    return user
@@ -0,0 +1,34 @@
+# Copyright 2023 The Bazel Authors. All rights reserved.
+#
+# Licensed under the Apache License, Version 2.0 (the "License");
+# you may not use this file except in compliance with the License.
+# You may obtain a copy of the License at
+#
+#     http://www.apache.org/licenses/LICENSE-2.0
+#
+# Unless required by applicable law or agreed to in writing, software
+# distributed under the License is distributed on an "AS IS" BASIS,
+# WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+# See the License for the specific language governing permissions and
+# limitations under the License.
+
+import sys
+
+import requests
+
+if sys.platform == "win32":
+    import pywintypes
+    import win32api
+elif sys.platform == "darwin":
+    import objc
+else:
+    import distro
+
+if sys.platform.startswith(("linux", "darwin")):
+    import uvloop
+
+if sys.platform in ("win32", "cygwin"):
+    import colorama
+
+# Imported on all platforms as well, so it isn't platform-specific.
+import colorama
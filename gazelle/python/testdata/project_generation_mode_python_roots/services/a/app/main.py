@@ -0,0 +1,2 @@
+import yaml
+from app.core import db
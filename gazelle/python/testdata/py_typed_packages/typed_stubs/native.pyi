@@ -0,0 +1 @@
+def native_sum(a: int, b: int) -> int: ...
@@ -0,0 +1,4 @@
+class Admin:
+    @staticmethod
+    def run():
+        return 0
@@ -0,0 +1,5 @@
+from pkg.sub import mod
+
+
+def test_run():
+    mod.run()
@@ -0,0 +1,4 @@
+from gen import settings
+from tools.version import VERSION
+
+print(VERSION, settings.DEBUG)
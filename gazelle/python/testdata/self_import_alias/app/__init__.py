@@ -0,0 +1 @@
+import pkg.legacy
@@ -0,0 +1 @@
+from pkg import legacy
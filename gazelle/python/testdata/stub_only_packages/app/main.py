@@ -0,0 +1,4 @@
+import fastmath
+from impl import shapes
+
+print(fastmath.add(1, shapes.area(2)))
@@ -0,0 +1,8 @@
+from typing import TYPE_CHECKING
+
+if TYPE_CHECKING:
+    from impl import shapes
+
+
+def check(module: "shapes") -> None:
+    pass
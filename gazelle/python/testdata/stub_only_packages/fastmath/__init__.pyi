@@ -0,0 +1 @@
+def add(a: int, b: int) -> int: ...
@@ -0,0 +1,4 @@
+from fastmath import add
+
+class Vector:
+    def norm(self) -> float: ...
@@ -0,0 +1 @@
+def area(side: int) -> int: ...
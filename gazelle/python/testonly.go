@@ -0,0 +1,68 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	bzl "github.com/bazelbuild/buildtools/build"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// setTestonlyTargets sets testonly = True on the libraries and binaries
+// generated in the package when it's in one of the directories of
+// python_testonly_dirs. The tests are always testonly.
+func setTestonlyTargets(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if !cfg.IsTestonlyPackage(args.Rel) {
+		return
+	}
+	for _, r := range gen {
+		switch r.Kind() {
+		case pyLibraryKind, pyBinaryKind:
+			r.SetAttr("testonly", true)
+		}
+	}
+}
+
+// recordTestonly records whether the indexed rule r of the file f is
+// testonly, i.e. whether it's a test or has testonly = True.
+func (py *Resolver) recordTestonly(repo string, r *rule.Rule, f *rule.File) {
+	if r.Kind() != pyTestKind && !isTrue(r.Attr("testonly")) {
+		return
+	}
+	if py.testonlyTargets == nil {
+		py.testonlyTargets = make(map[string]bool)
+	}
+	py.testonlyTargets[label.New(repo, f.Pkg, r.Name()).String()] = true
+}
+
+// isTestonly returns whether the indexed target is testonly.
+func (py *Resolver) isTestonly(target label.Label) bool {
+	return py.testonlyTargets[target.String()]
+}
+
+// isTrue returns whether the expression is the True constant, either parsed
+// from a BUILD file or set by Gazelle.
+func isTrue(e bzl.Expr) bool {
+	switch e := e.(type) {
+	case *bzl.Ident:
+		return e.Name == "True"
+	case *bzl.LiteralExpr:
+		return e.Token == "True"
+	}
+	return false
+}
@@ -0,0 +1,44 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// parseThirdPartyPrefix parses the value of the python_third_party_prefix
+// directive, e.g. "mycorp.vendor @vendored//:%{module}". It returns the module
+// prefix and the label template.
+func parseThirdPartyPrefix(value string) (string, string, error) {
+	fields := strings.Fields(value)
+	if len(fields) != 2 {
+		return "", "", fmt.Errorf("expected a module prefix and a label template, got %q", value)
+	}
+	prefix, template := fields[0], fields[1]
+	for _, part := range strings.Split(prefix, ".") {
+		if part == "" {
+			return "", "", fmt.Errorf("invalid module prefix %q", prefix)
+		}
+	}
+	if _, err := label.Parse(strings.ReplaceAll(template, pythonconfig.ThirdPartyPrefixModuleSubstitution, "module")); err != nil {
+		return "", "", fmt.Errorf("invalid label template %q: %v", template, err)
+	}
+	return prefix, template, nil
+}
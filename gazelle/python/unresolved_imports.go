@@ -0,0 +1,124 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// unresolvedImportsTag is the tag of the targets with unresolved imports, when
+// python_unresolved_imports is set to tag.
+const unresolvedImportsTag = "unresolved-imports"
+
+// unresolvedImport is an import that couldn't be resolved, with the errors
+// that would have been reported for it.
+type unresolvedImport struct {
+	Target string   `json:"target"`
+	File   string   `json:"file"`
+	Line   uint32   `json:"line"`
+	Import string   `json:"import"`
+	Errors []string `json:"errors"`
+}
+
+// diagnosticsFile is the format of the file written by
+// -python_diagnostics_file.
+type diagnosticsFile struct {
+	UnresolvedImports []unresolvedImport `json:"unresolved_imports"`
+}
+
+// addUnresolvedImportTargets records the targets generated in the package when
+// python_unresolved_imports is set to tag, to tag them once their imports are
+// resolved.
+func (py *Python) addUnresolvedImportTargets(args language.GenerateArgs, cfg *pythonconfig.Config, gen []*rule.Rule) {
+	if cfg.UnresolvedImportsMode() != pythonconfig.UnresolvedImportsModeTag {
+		return
+	}
+	py.unresolvedImportTargets = addTaggedTargets(py.unresolvedImportTargets, args, gen)
+}
+
+// addUnresolvedImport records that the import mod of the target from couldn't
+// be resolved.
+func (py *Resolver) addUnresolvedImport(from label.Label, mod Module, errs []error) {
+	py.unresolvedImports = append(py.unresolvedImports, newUnresolvedImport(from, mod, errs))
+}
+
+// newUnresolvedImport returns the unresolved import mod of the target from,
+// with the errors explaining why it couldn't be resolved.
+func newUnresolvedImport(from label.Label, mod Module, errs []error) unresolvedImport {
+	messages := make([]string, 0, len(errs))
+	for _, err := range errs {
+		messages = append(messages, strings.TrimSpace(err.Error()))
+	}
+	return unresolvedImport{
+		Target: from.String(),
+		File:   mod.Filepath,
+		Line:   mod.LineNumber,
+		Import: mod.Name,
+		Errors: messages,
+	}
+}
+
+// applyUnresolvedImports tags the recorded targets that have unresolved
+// imports, removing the stale tags of the others, and writes the
+// -python_diagnostics_file file.
+func (py *Python) applyUnresolvedImports() {
+	unresolvedTargets := make(map[string]bool)
+	for _, imp := range py.unresolvedImports {
+		unresolvedTargets[imp.Target] = true
+	}
+	for target, r := range py.unresolvedImportTargets {
+		setTag(r, unresolvedImportsTag, unresolvedTargets[target])
+	}
+	if py.diagnosticsPath != "" {
+		if err := writeDiagnostics(py.diagnosticsPath, py.unresolvedImports); err != nil {
+			log.Fatal(err)
+		}
+	}
+}
+
+// writeDiagnostics writes the unresolved imports as JSON to the given path,
+// sorted by target, file and line.
+func writeDiagnostics(path string, unresolvedImports []unresolvedImport) error {
+	f := diagnosticsFile{UnresolvedImports: append([]unresolvedImport{}, unresolvedImports...)}
+	sort.SliceStable(f.UnresolvedImports, func(i, j int) bool {
+		a, b := f.UnresolvedImports[i], f.UnresolvedImports[j]
+		if a.Target != b.Target {
+			return a.Target < b.Target
+		}
+		if a.File != b.File {
+			return a.File < b.File
+		}
+		return a.Line < b.Line
+	})
+	data, err := json.MarshalIndent(f, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the diagnostics: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the diagnostics: %w", err)
+	}
+	return nil
+}
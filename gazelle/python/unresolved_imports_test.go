@@ -0,0 +1,65 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestWriteDiagnostics(t *testing.T) {
+	var r Resolver
+	from := label.New("", "app", "app")
+	r.addUnresolvedImport(from, Module{Name: "yaml", Filepath: "app/main.py", LineNumber: 4}, []error{errors.New("yaml is invalid\n")})
+	r.addUnresolvedImport(from, Module{Name: "foo", Filepath: "app/main.py", LineNumber: 2}, []error{errors.New("foo is invalid")})
+
+	path := filepath.Join(t.TempDir(), "diagnostics.json")
+	if !assert.NoError(t, writeDiagnostics(path, r.unresolvedImports)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if !assert.NoError(t, err) {
+		return
+	}
+	var f diagnosticsFile
+	if !assert.NoError(t, json.Unmarshal(data, &f)) {
+		return
+	}
+	assert.Equal(t, []unresolvedImport{
+		{Target: "//app", File: "app/main.py", Line: 2, Import: "foo", Errors: []string{"foo is invalid"}},
+		{Target: "//app", File: "app/main.py", Line: 4, Import: "yaml", Errors: []string{"yaml is invalid"}},
+	}, f.UnresolvedImports)
+}
+
+func TestSetTag(t *testing.T) {
+	r := rule.NewRule("py_library", "lib")
+	setTag(r, unresolvedImportsTag, true)
+	assert.Equal(t, []string{unresolvedImportsTag}, r.AttrStrings("tags"))
+
+	r.SetAttr("tags", []string{"manual", unresolvedImportsTag, "unresolved-imports-extra"})
+	setTag(r, unresolvedImportsTag, false)
+	assert.Equal(t, []string{"manual", "unresolved-imports-extra"}, r.AttrStrings("tags"))
+
+	setTag(r, "manual", false)
+	setTag(r, "unresolved-imports-extra", false)
+	assert.Nil(t, r.Attr("tags"))
+}
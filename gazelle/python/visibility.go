@@ -0,0 +1,107 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/resolve"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+)
+
+const (
+	publicVisibility  = "//visibility:public"
+	privateVisibility = "//visibility:private"
+)
+
+// recordVisibility records the visibility of the indexed rule r of the file f,
+// used by python_resolve_visibility. Rules without a visibility attribute get
+// the default_visibility of the package. Visibilities that aren't a plain list
+// of labels, e.g. a select(), aren't recorded, so that the rule is considered
+// visible.
+func (py *Resolver) recordVisibility(repo string, r *rule.Rule, f *rule.File) {
+	visibility := []string{privateVisibility}
+	if r.Attr("visibility") != nil {
+		visibility = r.AttrStrings("visibility")
+		if visibility == nil {
+			return
+		}
+	} else {
+		for _, p := range f.Rules {
+			if p.Kind() == "package" && p.Attr("default_visibility") != nil {
+				visibility = p.AttrStrings("default_visibility")
+				if visibility == nil {
+					return
+				}
+			}
+		}
+	}
+	if py.visibilities == nil {
+		py.visibilities = make(map[string][]string)
+	}
+	py.visibilities[label.New(repo, f.Pkg, r.Name()).String()] = visibility
+}
+
+// isVisibleTo returns whether the target is visible to the package pkg,
+// according to its recorded visibility. Package groups can't be checked, so
+// targets visible to one are considered visible to every package.
+func (py *Resolver) isVisibleTo(target label.Label, pkg string) bool {
+	if target.Pkg == pkg {
+		return true
+	}
+	visibility, ok := py.visibilities[target.String()]
+	if !ok {
+		return true
+	}
+	for _, v := range visibility {
+		if v == publicVisibility {
+			return true
+		}
+		if v == privateVisibility {
+			continue
+		}
+		l, err := label.Parse(v)
+		if err != nil {
+			return true
+		}
+		l = l.Abs(target.Repo, target.Pkg)
+		switch l.Name {
+		case "__pkg__":
+			if l.Pkg == pkg {
+				return true
+			}
+		case "__subpackages__":
+			if l.Pkg == "" || l.Pkg == pkg || strings.HasPrefix(pkg, l.Pkg+"/") {
+				return true
+			}
+		default:
+			// A package_group.
+			return true
+		}
+	}
+	return false
+}
+
+// visibleMatches returns the matches visible to the package pkg.
+func (py *Resolver) visibleMatches(matches []resolve.FindResult, pkg string) []resolve.FindResult {
+	visible := make([]resolve.FindResult, 0, len(matches))
+	for _, match := range matches {
+		if py.isVisibleTo(match.Label, pkg) {
+			visible = append(visible, match)
+		}
+	}
+	return visible
+}
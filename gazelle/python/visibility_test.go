@@ -0,0 +1,68 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+)
+
+func TestIsVisibleTo(t *testing.T) {
+	f, err := rule.LoadData("lib/BUILD.bazel", "lib", []byte(`
+package(default_visibility = ["//app:__pkg__"])
+
+py_library(name = "default")
+
+py_library(name = "private", visibility = ["//visibility:private"])
+
+py_library(name = "public", visibility = ["//visibility:public"])
+
+py_library(name = "subpackages", visibility = [":__subpackages__"])
+
+py_library(name = "group", visibility = ["//groups:friends"])
+
+py_library(name = "selected", visibility = select({"//conditions:default": []}))
+`))
+	if err != nil {
+		t.Fatal(err)
+	}
+	var r Resolver
+	for _, rule := range f.Rules {
+		if rule.Kind() == "py_library" {
+			r.recordVisibility("", rule, f)
+		}
+	}
+
+	for _, tc := range []struct {
+		name string
+		pkg  string
+		want bool
+	}{
+		{"default", "app", true},
+		{"default", "app/sub", false},
+		{"private", "lib", true},
+		{"private", "app", false},
+		{"public", "app", true},
+		{"subpackages", "lib/sub", true},
+		{"subpackages", "library", false},
+		{"group", "app", true},
+		{"selected", "app", true},
+	} {
+		assert.Equal(t, tc.want, r.isVisibleTo(label.New("", "lib", tc.name), tc.pkg), "%s from %s", tc.name, tc.pkg)
+	}
+}
@@ -0,0 +1,152 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"os"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// parseTargetPlatforms parses the value of the python_target_platforms
+// directive, the target platforms separated by spaces. An empty value removes
+// the target platforms.
+func parseTargetPlatforms(value string) ([]pythonconfig.TargetPlatform, error) {
+	var platforms []pythonconfig.TargetPlatform
+	for _, field := range strings.Fields(value) {
+		platform, err := pythonconfig.ParseTargetPlatform(field)
+		if err != nil {
+			return nil, err
+		}
+		platforms = append(platforms, platform)
+	}
+	return platforms, nil
+}
+
+// wheelAudit records the third-party distributions imported by the resolved
+// targets that have no wheel for some of their target platforms, written to
+// the -python_wheel_audit file. A nil audit records nothing.
+type wheelAudit struct {
+	// gaps maps the distributions and the target platforms without a wheel
+	// to the gap and the targets importing the distribution.
+	gaps map[wheelGapKey]*wheelGap
+}
+
+// wheelGapKey identifies a distribution without a wheel for a target
+// platform.
+type wheelGapKey struct {
+	distribution string
+	platform     string
+}
+
+// wheelGap is a distribution without a wheel for a target platform, either
+// built from its sdist or not installable at all.
+type wheelGap struct {
+	Distribution string                         `json:"distribution"`
+	Platform     string                         `json:"platform"`
+	Outcome      pythonconfig.WheelAvailability `json:"outcome"`
+	Targets      []string                       `json:"targets"`
+}
+
+// wheelAuditFile is the format of the -python_wheel_audit file.
+type wheelAuditFile struct {
+	Gaps []*wheelGap `json:"gaps"`
+}
+
+// add audits the distributions imported by the target from against the wheel
+// lock file and the target platforms of cfg. The distributions missing from
+// the lock file are skipped.
+func (audit *wheelAudit) add(cfg *pythonconfig.Config, from label.Label, distributions []string) {
+	if audit == nil || len(distributions) == 0 {
+		return
+	}
+	lock := cfg.WheelLock()
+	if lock == nil {
+		return
+	}
+	for _, distribution := range distributions {
+		for _, platform := range cfg.TargetPlatforms() {
+			outcome := lock.Availability(distribution, platform)
+			if outcome != pythonconfig.WheelSdistOnly && outcome != pythonconfig.WheelUnavailable {
+				continue
+			}
+			key := wheelGapKey{distribution: distribution, platform: platform.String()}
+			if audit.gaps == nil {
+				audit.gaps = make(map[wheelGapKey]*wheelGap)
+			}
+			gap, ok := audit.gaps[key]
+			if !ok {
+				gap = &wheelGap{Distribution: distribution, Platform: platform.String(), Outcome: outcome}
+				audit.gaps[key] = gap
+			}
+			gap.Targets = append(gap.Targets, from.String())
+		}
+	}
+}
+
+// sortedGaps returns the gaps sorted by distribution and platform, with their
+// targets sorted.
+func (audit *wheelAudit) sortedGaps() []*wheelGap {
+	gaps := make([]*wheelGap, 0, len(audit.gaps))
+	for _, gap := range audit.gaps {
+		sort.Strings(gap.Targets)
+		gaps = append(gaps, gap)
+	}
+	sort.Slice(gaps, func(i, j int) bool {
+		if gaps[i].Distribution != gaps[j].Distribution {
+			return gaps[i].Distribution < gaps[j].Distribution
+		}
+		return gaps[i].Platform < gaps[j].Platform
+	})
+	return gaps
+}
+
+// write writes the gaps as JSON to the given path.
+func (audit *wheelAudit) write(path string) error {
+	data, err := json.MarshalIndent(wheelAuditFile{Gaps: audit.sortedGaps()}, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to encode the wheel audit: %w", err)
+	}
+	if err := os.WriteFile(path, append(data, '\n'), 0o644); err != nil {
+		return fmt.Errorf("failed to write the wheel audit: %w", err)
+	}
+	return nil
+}
+
+// writeWheelAudit logs the gaps of the wheel audit and writes the
+// -python_wheel_audit file.
+func (py *Python) writeWheelAudit() {
+	if py.wheelAudit == nil {
+		return
+	}
+	for _, gap := range py.wheelAudit.sortedGaps() {
+		what := "is built from its sdist"
+		if gap.Outcome == pythonconfig.WheelUnavailable {
+			what = "can't be installed"
+		}
+		log.Printf("WARNING: %s has no wheel for %s, so it %s: imported by %s",
+			gap.Distribution, gap.Platform, what, strings.Join(gap.Targets, ", "))
+	}
+	if err := py.wheelAudit.write(py.wheelAuditPath); err != nil {
+		log.Fatal(err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestWheelAudit(t *testing.T) {
+	dir := t.TempDir()
+	lockPath := filepath.Join(dir, "uv.lock")
+	if err := os.WriteFile(lockPath, []byte(`
+wheels = [
+    { url = "https://files.example.com/numpy-1.26.4-cp311-cp311-manylinux_2_17_x86_64.manylinux2014_x86_64.whl" },
+    { url = "https://files.example.com/cryptography-42.0.5-cp39-abi3-macosx_10_12_universal2.whl" },
+]
+sdist = { url = "https://files.example.com/numpy-1.26.4.tar.gz" }
+`), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	platforms, err := parseTargetPlatforms("cp311-manylinux_2_28_x86_64 cp311-macosx_14_0_arm64")
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := pythonconfig.New(dir, "")
+	cfg.SetWheelLockPath(lockPath)
+	cfg.SetTargetPlatforms(platforms)
+
+	audit := &wheelAudit{}
+	audit.add(cfg, label.New("", "app", "app"), []string{"numpy", "cryptography", "requests"})
+	audit.add(cfg, label.New("", "cli", "cli"), []string{"numpy"})
+	// The child configurations inherit the lock file and the target
+	// platforms, and an empty python_target_platforms stops the audit.
+	audit.add(cfg.NewChild(), label.New("", "lib", "lib"), []string{"numpy"})
+	child := cfg.NewChild()
+	child.SetTargetPlatforms(nil)
+	audit.add(child, label.New("", "tools", "tools"), []string{"numpy"})
+	// A nil audit records nothing.
+	(*wheelAudit)(nil).add(cfg, label.New("", "app", "app"), []string{"numpy"})
+
+	path := filepath.Join(dir, "wheel_audit.json")
+	if !assert.NoError(t, audit.write(path)) {
+		return
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got wheelAuditFile
+	if err := json.Unmarshal(data, &got); err != nil {
+		t.Fatal(err)
+	}
+	assert.Equal(t, []*wheelGap{
+		{Distribution: "cryptography", Platform: "cp311-manylinux_2_28_x86_64", Outcome: pythonconfig.WheelUnavailable, Targets: []string{"//app"}},
+		{Distribution: "numpy", Platform: "cp311-macosx_14_0_arm64", Outcome: pythonconfig.WheelSdistOnly, Targets: []string{"//app", "//cli", "//lib"}},
+	}, got.Gaps)
+
+	_, err = parseTargetPlatforms("cp311-manylinux_2_28_x86_64 linux")
+	assert.Error(t, err)
+}
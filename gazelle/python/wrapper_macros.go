@@ -0,0 +1,259 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"path/filepath"
+	"sort"
+	"strings"
+
+	"github.com/bazelbuild/bazel-gazelle/config"
+	"github.com/bazelbuild/bazel-gazelle/label"
+	"github.com/bazelbuild/bazel-gazelle/language"
+	"github.com/bazelbuild/bazel-gazelle/rule"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+// wrapperMacroAttrs are the attributes of the kinds that the wrapper macros
+// can name differently, see python_wrapper_macro.
+var wrapperMacroAttrs = []string{"srcs", "deps", "pyi_deps"}
+
+// parseWrapperMacro parses the value of the python_wrapper_macro directive,
+// e.g. "py_library my_py_library //tools/build:py.bzl srcs=sources".
+func parseWrapperMacro(value string) (pythonconfig.WrapperMacroInfo, error) {
+	var macro pythonconfig.WrapperMacroInfo
+	fields := strings.Fields(value)
+	if len(fields) < 3 {
+		return macro, fmt.Errorf("expected a kind, a macro and a .bzl file, e.g. "+
+			"\"py_library my_py_library //tools/build:py.bzl\", got %q", value)
+	}
+	switch fields[0] {
+	case pyBinaryKind, pyLibraryKind, pyTestKind:
+	default:
+		return macro, fmt.Errorf("invalid kind %q: expected one of %s, %s, %s", fields[0], pyBinaryKind, pyLibraryKind, pyTestKind)
+	}
+	if _, ok := pyKinds[fields[1]]; ok {
+		return macro, fmt.Errorf("invalid macro %q: it's a kind of the extension", fields[1])
+	}
+	if l, err := label.Parse(fields[2]); err != nil || !strings.HasSuffix(l.Name, ".bzl") {
+		return macro, fmt.Errorf("invalid .bzl file %q: expected a label, e.g. //tools/build:py.bzl", fields[2])
+	}
+	macro = pythonconfig.WrapperMacroInfo{Kind: fields[0], Macro: fields[1], Load: fields[2]}
+	for _, field := range fields[3:] {
+		attr, macroAttr, _ := strings.Cut(field, "=")
+		if !isWrapperMacroAttr(attr) || macroAttr == "" {
+			return macro, fmt.Errorf("expected ATTR=MACRO_ATTR, with ATTR among %s, got %q",
+				strings.Join(wrapperMacroAttrs, ", "), field)
+		}
+		if macro.Attrs == nil {
+			macro.Attrs = make(map[string]string)
+		}
+		macro.Attrs[attr] = macroAttr
+	}
+	return macro, nil
+}
+
+// isWrapperMacroAttr returns whether the attribute can be named differently
+// by the wrapper macros.
+func isWrapperMacroAttr(attr string) bool {
+	for _, a := range wrapperMacroAttrs {
+		if a == attr {
+			return true
+		}
+	}
+	return false
+}
+
+// loadWrapperMacros returns the wrapper macros declared in the root BUILD
+// file, which are registered as kinds of the extension before Gazelle walks
+// the repository.
+func loadWrapperMacros(c *config.Config) ([]pythonconfig.WrapperMacroInfo, error) {
+	for _, name := range c.ValidBuildFileNames {
+		f, err := rule.LoadFile(filepath.Join(c.RepoRoot, name), "")
+		if errors.Is(err, fs.ErrNotExist) {
+			continue
+		}
+		if err != nil {
+			return nil, err
+		}
+		var macros []pythonconfig.WrapperMacroInfo
+		for _, d := range f.Directives {
+			if d.Key != pythonconfig.WrapperMacro {
+				continue
+			}
+			macro, err := parseWrapperMacro(d.Value)
+			if err != nil {
+				return nil, fmt.Errorf("%s: invalid value for directive %q: %w", f.Path, pythonconfig.WrapperMacro, err)
+			}
+			macros = append(macros, macro)
+		}
+		return macros, nil
+	}
+	return nil, nil
+}
+
+// wrapperMacroKindInfo returns the KindInfo of the wrapper macro, the one of
+// the kind it wraps with the attributes of the macro.
+func wrapperMacroKindInfo(macro pythonconfig.WrapperMacroInfo) rule.KindInfo {
+	info := pyKinds[macro.Kind]
+	attrs := func(attrs map[string]bool) map[string]bool {
+		macroAttrs := make(map[string]bool, len(attrs))
+		for attr, v := range attrs {
+			macroAttrs[macro.Attr(attr)] = v
+		}
+		return macroAttrs
+	}
+	matchAttrs := make([]string, 0, len(info.MatchAttrs))
+	for _, attr := range info.MatchAttrs {
+		matchAttrs = append(matchAttrs, macro.Attr(attr))
+	}
+	return rule.KindInfo{
+		MatchAny:        info.MatchAny,
+		MatchAttrs:      matchAttrs,
+		NonEmptyAttrs:   attrs(info.NonEmptyAttrs),
+		SubstituteAttrs: attrs(info.SubstituteAttrs),
+		MergeableAttrs:  attrs(info.MergeableAttrs),
+		ResolveAttrs:    attrs(info.ResolveAttrs),
+	}
+}
+
+// wrapperMacroLoads returns the .bzl files defining the wrapper macros.
+func wrapperMacroLoads(macros []pythonconfig.WrapperMacroInfo) []rule.LoadInfo {
+	symbols := make(map[string][]string)
+	for _, macro := range macros {
+		symbols[macro.Load] = append(symbols[macro.Load], macro.Macro)
+	}
+	loads := make([]rule.LoadInfo, 0, len(symbols))
+	for name, macros := range symbols {
+		sort.Strings(macros)
+		loads = append(loads, rule.LoadInfo{Name: name, Symbols: macros})
+	}
+	sort.Slice(loads, func(i, j int) bool { return loads[i].Name < loads[j].Name })
+	return loads
+}
+
+// unwrapMacro turns the rule r of the wrapper macro into a rule of the kind
+// it wraps, with the attributes of the kind, so that it's handled like the
+// rules of the kind. The attributes of the macro are left in place until the
+// rule is wrapped back, so that their comments, e.g. "# keep", are kept.
+func unwrapMacro(r *rule.Rule, macro pythonconfig.WrapperMacroInfo) {
+	r.SetKind(macro.Kind)
+	for _, attr := range wrapperMacroAttrs {
+		if macroAttr := macro.Attr(attr); macroAttr != attr {
+			if v := r.Attr(macroAttr); v != nil {
+				r.SetAttr(attr, v)
+			}
+		}
+	}
+}
+
+// wrapMacro turns the rule r of the kind wrapped by the macro into a rule of
+// the macro, with the attributes of the macro.
+func wrapMacro(r *rule.Rule, macro pythonconfig.WrapperMacroInfo) {
+	r.SetKind(macro.Macro)
+	for _, attr := range wrapperMacroAttrs {
+		macroAttr := macro.Attr(attr)
+		if macroAttr == attr {
+			continue
+		}
+		if v := r.Attr(attr); v != nil {
+			r.SetAttr(macroAttr, v)
+			r.DelAttr(attr)
+		} else if r.Attr(macroAttr) != nil {
+			r.DelAttr(macroAttr)
+		}
+	}
+}
+
+// unwrapRuleMacro unwraps the rule r if it's a rule of a wrapper macro, and
+// returns the function wrapping it back.
+func unwrapRuleMacro(cfg *pythonconfig.Config, r *rule.Rule) func() {
+	macro, ok := cfg.WrapperMacro(r.Kind())
+	if !ok {
+		return func() {}
+	}
+	unwrapMacro(r, macro)
+	return func() { wrapMacro(r, macro) }
+}
+
+// unwrapFileMacros unwraps the rules of the wrapper macros of the BUILD file
+// f, and returns the function wrapping them back. The rules are recorded, so
+// that they're unwrapped again once the dependencies are resolved.
+func (py *Python) unwrapFileMacros(cfg *pythonconfig.Config, f *rule.File) func() {
+	if f == nil || len(cfg.WrapperMacros()) == 0 {
+		return func() {}
+	}
+	unwrapped := make(map[*rule.Rule]pythonconfig.WrapperMacroInfo)
+	for _, r := range f.Rules {
+		if macro, ok := cfg.WrapperMacro(r.Kind()); ok {
+			unwrapMacro(r, macro)
+			unwrapped[r] = macro
+			py.recordWrapperMacroRule(r, macro)
+		}
+	}
+	return func() {
+		for r, macro := range unwrapped {
+			wrapMacro(r, macro)
+		}
+	}
+}
+
+// wrapGeneratedMacros turns the generated rules of the kinds wrapped by a
+// macro into rules of the macro, and records them.
+func (py *Python) wrapGeneratedMacros(cfg *pythonconfig.Config, result *language.GenerateResult) {
+	if len(cfg.WrapperMacros()) == 0 {
+		return
+	}
+	for _, r := range result.Gen {
+		if macro, ok := cfg.WrapperMacroOfKind(r.Kind()); ok {
+			wrapMacro(r, macro)
+			py.recordWrapperMacroRule(r, macro)
+		}
+	}
+	for _, r := range result.Empty {
+		if macro, ok := cfg.WrapperMacroOfKind(r.Kind()); ok {
+			wrapMacro(r, macro)
+		}
+	}
+}
+
+// recordWrapperMacroRule records the rule r of the wrapper macro, see
+// unwrapMacroRules.
+func (py *Python) recordWrapperMacroRule(r *rule.Rule, macro pythonconfig.WrapperMacroInfo) {
+	if py.wrapperMacroRules == nil {
+		py.wrapperMacroRules = make(map[*rule.Rule]pythonconfig.WrapperMacroInfo)
+	}
+	py.wrapperMacroRules[r] = macro
+}
+
+// unwrapMacroRules unwraps the recorded rules of the wrapper macros, so that
+// the dependencies are updated once resolved like the ones of the kinds they
+// wrap, and returns the function wrapping them back.
+func (py *Python) unwrapMacroRules() func() {
+	rules := py.wrapperMacroRules
+	py.wrapperMacroRules = nil
+	for r, macro := range rules {
+		unwrapMacro(r, macro)
+	}
+	return func() {
+		for r, macro := range rules {
+			wrapMacro(r, macro)
+		}
+	}
+}
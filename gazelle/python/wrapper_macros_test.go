@@ -0,0 +1,107 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package python
+
+import (
+	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/rule"
+	"github.com/stretchr/testify/assert"
+
+	"github.com/bazel-contrib/rules_python/gazelle/pythonconfig"
+)
+
+func TestParseWrapperMacro(t *testing.T) {
+	macro, err := parseWrapperMacro("py_library my_py_library //tools/build:py.bzl srcs=sources deps=py_deps")
+	assert.NoError(t, err)
+	assert.Equal(t, pythonconfig.WrapperMacroInfo{
+		Kind:  "py_library",
+		Macro: "my_py_library",
+		Load:  "//tools/build:py.bzl",
+		Attrs: map[string]string{"srcs": "sources", "deps": "py_deps"},
+	}, macro)
+
+	for _, value := range []string{
+		"py_library my_py_library",
+		"py_proto_library my_py_library //tools/build:py.bzl",
+		"py_library py_test //tools/build:py.bzl",
+		"py_library my_py_library //tools/build:py.py",
+		"py_library my_py_library //tools/build:py.bzl data=files",
+		"py_library my_py_library //tools/build:py.bzl srcs=",
+		"py_library my_py_library //tools/build:py.bzl srcs",
+	} {
+		if _, err := parseWrapperMacro(value); err == nil {
+			t.Errorf("%q: expected an error", value)
+		}
+	}
+}
+
+func TestWrapperMacroKindInfo(t *testing.T) {
+	info := wrapperMacroKindInfo(pythonconfig.WrapperMacroInfo{
+		Kind:  "py_library",
+		Macro: "my_py_library",
+		Load:  "//tools/build:py.bzl",
+		Attrs: map[string]string{"srcs": "sources", "deps": "py_deps"},
+	})
+	assert.True(t, info.MergeableAttrs["sources"])
+	assert.False(t, info.MergeableAttrs["srcs"])
+	assert.True(t, info.ResolveAttrs["py_deps"])
+	assert.False(t, info.ResolveAttrs["deps"])
+	assert.True(t, info.ResolveAttrs["pyi_deps"])
+}
+
+func TestWrapMacro(t *testing.T) {
+	macro := pythonconfig.WrapperMacroInfo{
+		Kind:  "py_library",
+		Macro: "my_py_library",
+		Load:  "//tools/build:py.bzl",
+		Attrs: map[string]string{"srcs": "sources", "deps": "py_deps"},
+	}
+	r := rule.NewRule("my_py_library", "lib")
+	r.SetAttr("sources", []string{"lib.py"})
+	r.SetAttr("py_deps", []string{"//util"})
+	r.SetAttr("visibility", []string{"//visibility:public"})
+
+	unwrapMacro(r, macro)
+	assert.Equal(t, "py_library", r.Kind())
+	assert.Equal(t, []string{"lib.py"}, r.AttrStrings("srcs"))
+	assert.Equal(t, []string{"//util"}, r.AttrStrings("deps"))
+
+	r.SetAttr("deps", []string{"//other"})
+	wrapMacro(r, macro)
+	assert.Equal(t, "my_py_library", r.Kind())
+	assert.Equal(t, []string{"lib.py"}, r.AttrStrings("sources"))
+	assert.Equal(t, []string{"//other"}, r.AttrStrings("py_deps"))
+	assert.Equal(t, []string{"//visibility:public"}, r.AttrStrings("visibility"))
+	assert.Nil(t, r.Attr("srcs"))
+	assert.Nil(t, r.Attr("deps"))
+
+	unwrapMacro(r, macro)
+	r.DelAttr("deps")
+	wrapMacro(r, macro)
+	assert.Nil(t, r.Attr("py_deps"))
+}
+
+func TestWrapperMacroLoads(t *testing.T) {
+	loads := wrapperMacroLoads([]pythonconfig.WrapperMacroInfo{
+		{Kind: "py_test", Macro: "my_py_test", Load: "//tools/build:py.bzl"},
+		{Kind: "py_binary", Macro: "my_py_binary", Load: "//tools/build:binary.bzl"},
+		{Kind: "py_library", Macro: "my_py_library", Load: "//tools/build:py.bzl"},
+	})
+	assert.Equal(t, []rule.LoadInfo{
+		{Name: "//tools/build:binary.bzl", Symbols: []string{"my_py_binary"}},
+		{Name: "//tools/build:py.bzl", Symbols: []string{"my_py_library", "my_py_test"}},
+	}, loads)
+}
@@ -0,0 +1,169 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/ghodss/yaml"
+)
+
+// DepsOrder represents the layered architecture declared in the file pointed
+// to by the python_deps_order_file directive. Each layer owns a set of
+// directories and declares which other layers it is allowed to depend on. A
+// dependency from a target in one layer to a target in a layer that is not
+// reachable through depends_on is a layering violation.
+type DepsOrder struct {
+	// Layers is the list of layers. A package belongs to the first layer with
+	// a matching glob.
+	Layers []DepsOrderLayer `json:"layers"`
+
+	// reachable[i][j] is true when layer i may depend on layer j, either
+	// directly or transitively.
+	reachable [][]bool
+}
+
+// DepsOrderLayer represents a single layer of a DepsOrder.
+type DepsOrderLayer struct {
+	// Name is the unique name of the layer.
+	Name string `json:"name"`
+	// Packages is a list of globs matching the Bazel packages, relative to the
+	// repository root, that belong to this layer. The globs prefixed with a
+	// repository, e.g. "@shared_lib//python/**", match the packages of that
+	// external repository.
+	Packages []string `json:"packages"`
+	// DependsOn is the list of layer names that this layer may depend on.
+	DependsOn []string `json:"depends_on,omitempty"`
+}
+
+// LoadDepsOrder parses and validates the YAML or JSON layers file at the
+// given path.
+func LoadDepsOrder(path string) (*DepsOrder, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deps order file: %w", err)
+	}
+	depsOrder, err := ParseDepsOrder(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load deps order file %q: %w", path, err)
+	}
+	return depsOrder, nil
+}
+
+// ParseDepsOrder parses and validates the YAML or JSON layers content.
+func ParseDepsOrder(data []byte) (*DepsOrder, error) {
+	depsOrder := new(DepsOrder)
+	if err := yaml.Unmarshal(data, depsOrder); err != nil {
+		return nil, err
+	}
+	if err := depsOrder.init(); err != nil {
+		return nil, err
+	}
+	return depsOrder, nil
+}
+
+// init validates the layers and computes the reachability matrix.
+func (d *DepsOrder) init() error {
+	indexByName := make(map[string]int, len(d.Layers))
+	for i, layer := range d.Layers {
+		if layer.Name == "" {
+			return fmt.Errorf("layer at position %d has no name", i)
+		}
+		if _, exists := indexByName[layer.Name]; exists {
+			return fmt.Errorf("layer %q is declared more than once", layer.Name)
+		}
+		for _, pattern := range layer.Packages {
+			repo, glob, ok := splitRepoGlob(pattern)
+			if !ok || (strings.HasPrefix(pattern, "@") && repo == "") || !doublestar.ValidatePattern(glob) {
+				return fmt.Errorf("layer %q has an invalid glob %q", layer.Name, pattern)
+			}
+		}
+		indexByName[layer.Name] = i
+	}
+
+	edges := make([][]int, len(d.Layers))
+	for i, layer := range d.Layers {
+		for _, dep := range layer.DependsOn {
+			j, ok := indexByName[dep]
+			if !ok {
+				return fmt.Errorf("layer %q depends on unknown layer %q", layer.Name, dep)
+			}
+			edges[i] = append(edges[i], j)
+		}
+	}
+
+	d.reachable = make([][]bool, len(d.Layers))
+	for i := range d.Layers {
+		d.reachable[i] = make([]bool, len(d.Layers))
+		stack := append([]int{}, edges[i]...)
+		for len(stack) > 0 {
+			j := stack[len(stack)-1]
+			stack = stack[:len(stack)-1]
+			if j == i {
+				return fmt.Errorf("layer %q transitively depends on itself", d.Layers[i].Name)
+			}
+			if d.reachable[i][j] {
+				continue
+			}
+			d.reachable[i][j] = true
+			stack = append(stack, edges[j]...)
+		}
+	}
+	return nil
+}
+
+// LayerForPackage returns the index of the first layer with a glob matching
+// the given Bazel package of the main repository, and whether one was found.
+func (d *DepsOrder) LayerForPackage(pkg string) (int, bool) {
+	return d.LayerForRepoPackage("", pkg)
+}
+
+// LayerForRepoPackage returns the index of the first layer with a glob
+// matching the given Bazel package of the repository repo, empty for the main
+// repository, and whether one was found.
+func (d *DepsOrder) LayerForRepoPackage(repo, pkg string) (int, bool) {
+	for i, layer := range d.Layers {
+		for _, pattern := range layer.Packages {
+			globRepo, glob, _ := splitRepoGlob(pattern)
+			if globRepo != repo {
+				continue
+			}
+			if ok, _ := doublestar.Match(glob, pkg); ok {
+				return i, true
+			}
+		}
+	}
+	return -1, false
+}
+
+// splitRepoGlob splits a glob of the packages of a layer, e.g.
+// "@shared_lib//python/**", into the repository, empty for the main
+// repository, and the glob of the packages.
+func splitRepoGlob(pattern string) (string, string, bool) {
+	if !strings.HasPrefix(pattern, "@") {
+		return "", pattern, true
+	}
+	repo, glob, ok := strings.Cut(strings.TrimLeft(pattern, "@"), "//")
+	return repo, glob, ok
+}
+
+// Allows returns whether a target in the layer at index from may depend on a
+// target in the layer at index to.
+func (d *DepsOrder) Allows(from, to int) bool {
+	return from == to || d.reachable[from][to]
+}
@@ -0,0 +1,124 @@
+package pythonconfig
+
+import (
+	"testing"
+)
+
+const testLayers = `
+layers:
+  - name: web
+    packages: ["web", "web/**"]
+    depends_on: [core]
+  - name: api
+    packages: ["api", "api/**"]
+    depends_on: [core]
+  - name: core
+    packages: ["core", "core/**"]
+    depends_on: [util]
+  - name: util
+    packages: ["util/**"]
+`
+
+func TestParseDepsOrder(t *testing.T) {
+	depsOrder, err := ParseDepsOrder([]byte(testLayers))
+	if err != nil {
+		t.Fatalf("ParseDepsOrder() error: %v", err)
+	}
+
+	layerOf := func(pkg string) int {
+		t.Helper()
+		layer, ok := depsOrder.LayerForPackage(pkg)
+		if !ok {
+			t.Fatalf("LayerForPackage(%q) found no layer", pkg)
+		}
+		return layer
+	}
+
+	tests := map[string]struct {
+		from, to string
+		want     bool
+	}{
+		"same layer":          {from: "web/a", to: "web/b", want: true},
+		"direct dependency":   {from: "api/a", to: "core", want: true},
+		"transitive":          {from: "web", to: "util/strings", want: true},
+		"peers":               {from: "api", to: "web/b", want: false},
+		"upward":              {from: "core/a", to: "api", want: false},
+		"upward transitively": {from: "util/strings", to: "web", want: false},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			if got := depsOrder.Allows(layerOf(tc.from), layerOf(tc.to)); got != tc.want {
+				t.Errorf("Allows(%q, %q) = %v, want %v", tc.from, tc.to, got, tc.want)
+			}
+		})
+	}
+
+	if _, ok := depsOrder.LayerForPackage("other"); ok {
+		t.Errorf("LayerForPackage(%q) unexpectedly found a layer", "other")
+	}
+}
+
+func TestParseDepsOrderJSON(t *testing.T) {
+	depsOrder, err := ParseDepsOrder([]byte(`{"layers": [{"name": "a", "packages": ["a/**"], "depends_on": ["b"]}, {"name": "b", "packages": ["b/**"]}]}`))
+	if err != nil {
+		t.Fatalf("ParseDepsOrder() error: %v", err)
+	}
+	if len(depsOrder.Layers) != 2 {
+		t.Fatalf("expected 2 layers, got %d", len(depsOrder.Layers))
+	}
+	if !depsOrder.Allows(0, 1) || depsOrder.Allows(1, 0) {
+		t.Errorf("unexpected reachability between layers %q and %q", "a", "b")
+	}
+}
+
+func TestParseDepsOrderErrors(t *testing.T) {
+	tests := map[string]string{
+		"missing name":  `layers: [{packages: ["a"]}]`,
+		"duplicate":     `layers: [{name: a}, {name: a}]`,
+		"unknown dep":   `layers: [{name: a, depends_on: [b]}]`,
+		"cycle":         `layers: [{name: a, depends_on: [b]}, {name: b, depends_on: [a]}]`,
+		"bad glob":      `layers: [{name: a, packages: ["a/[**"]}]`,
+		"bad repo glob": `layers: [{name: a, packages: ["@shared_lib/python"]}]`,
+		"no repo":       `layers: [{name: a, packages: ["@//python/**"]}]`,
+	}
+	for name, content := range tests {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseDepsOrder([]byte(content)); err == nil {
+				t.Errorf("ParseDepsOrder(%q) expected an error", content)
+			}
+		})
+	}
+}
+
+func TestLayerForRepoPackage(t *testing.T) {
+	depsOrder, err := ParseDepsOrder([]byte(`layers:
+  - name: app
+    packages: ["python/**"]
+  - name: shared
+    packages: ["@shared_lib//python/**", "@@canonical+//lib"]
+`))
+	if err != nil {
+		t.Fatalf("ParseDepsOrder() error: %v", err)
+	}
+
+	tests := map[string]struct {
+		repo, pkg string
+		want      int
+		wantOK    bool
+	}{
+		"main repository":       {pkg: "python/a", want: 0, wantOK: true},
+		"external repository":   {repo: "shared_lib", pkg: "python/a", want: 1, wantOK: true},
+		"canonical repository":  {repo: "canonical+", pkg: "lib", want: 1, wantOK: true},
+		"unmatched package":     {repo: "shared_lib", pkg: "other", want: -1},
+		"unmatched repository":  {repo: "other", pkg: "python/a", want: -1},
+		"main repository globs": {pkg: "lib", want: -1},
+	}
+	for name, tc := range tests {
+		t.Run(name, func(t *testing.T) {
+			got, ok := depsOrder.LayerForRepoPackage(tc.repo, tc.pkg)
+			if got != tc.want || ok != tc.wantOK {
+				t.Errorf("LayerForRepoPackage(%q, %q) = %d, %v, want %d, %v", tc.repo, tc.pkg, got, ok, tc.want, tc.wantOK)
+			}
+		})
+	}
+}
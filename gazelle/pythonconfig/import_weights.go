@@ -0,0 +1,73 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"fmt"
+	"os"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ImportWeights represents the file pointed to by the
+// python_import_weights_file directive. It assigns a weight, e.g. the size of
+// the wheel or its import time, to the third-party distributions.
+type ImportWeights struct {
+	// Weights maps the distribution names to their weight. Distributions that
+	// are not listed weigh nothing.
+	Weights map[string]int `json:"weights"`
+}
+
+// LoadImportWeights parses and validates the YAML or JSON weights file at the
+// given path.
+func LoadImportWeights(path string) (*ImportWeights, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import weights file: %w", err)
+	}
+	importWeights, err := ParseImportWeights(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load import weights file %q: %w", path, err)
+	}
+	return importWeights, nil
+}
+
+// ParseImportWeights parses and validates the YAML or JSON weights content.
+func ParseImportWeights(data []byte) (*ImportWeights, error) {
+	var raw ImportWeights
+	if err := yaml.Unmarshal(data, &raw); err != nil {
+		return nil, err
+	}
+	importWeights := &ImportWeights{Weights: make(map[string]int, len(raw.Weights))}
+	for distribution, weight := range raw.Weights {
+		if weight < 0 {
+			return nil, fmt.Errorf("distribution %q has a negative weight %d", distribution, weight)
+		}
+		importWeights.Weights[normalizeDistributionName(distribution)] = weight
+	}
+	return importWeights, nil
+}
+
+// Weight returns the weight of the given distribution.
+func (w *ImportWeights) Weight(distribution string) int {
+	return w.Weights[normalizeDistributionName(distribution)]
+}
+
+// normalizeDistributionName normalizes the distribution name the way pip
+// does, so that e.g. "PyYAML" and "pyyaml" have the same weight.
+func normalizeDistributionName(distribution string) string {
+	return strings.NewReplacer("-", "_", ".", "_").Replace(strings.ToLower(distribution))
+}
@@ -0,0 +1,40 @@
+package pythonconfig
+
+import (
+	"testing"
+)
+
+func TestParseImportWeights(t *testing.T) {
+	importWeights, err := ParseImportWeights([]byte(`
+weights:
+  PyYAML: 5
+  scikit-learn: 120
+`))
+	if err != nil {
+		t.Fatalf("ParseImportWeights() error: %v", err)
+	}
+	for distribution, want := range map[string]int{
+		"pyyaml":       5,
+		"PyYAML":       5,
+		"scikit_learn": 120,
+		"Scikit.Learn": 120,
+		"numpy":        0,
+	} {
+		if got := importWeights.Weight(distribution); got != want {
+			t.Errorf("Weight(%q) = %d, want %d", distribution, got, want)
+		}
+	}
+}
+
+func TestParseImportWeightsErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"negative weight": "weights:\n  numpy: -1\n",
+		"invalid weight":  "weights:\n  numpy: heavy\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseImportWeights([]byte(content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
@@ -0,0 +1,78 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/ghodss/yaml"
+)
+
+// ModuleGroupsFilename is the name of the file of a package listing the
+// modules generated as a single target in the "file" generation mode.
+const ModuleGroupsFilename = ".gazelle-groups.yaml"
+
+// ModuleGroups represents the .gazelle-groups.yaml file of a package. Each
+// group lists files of the package that are kept in a single target when
+// python_generation_mode is "file", while the other files still get a target
+// of their own.
+type ModuleGroups struct {
+	// Groups is the list of groups, each one being a list of filenames
+	// relative to the package, e.g. ["models.py", "models_mixins.py"].
+	Groups [][]string `json:"groups"`
+}
+
+// LoadModuleGroups parses and validates the .gazelle-groups.yaml file of the
+// package directory dir. It returns nil when the package doesn't have one.
+func LoadModuleGroups(dir string) (*ModuleGroups, error) {
+	path := filepath.Join(dir, ModuleGroupsFilename)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module groups file: %w", err)
+	}
+	moduleGroups, err := ParseModuleGroups(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load module groups file %q: %w", path, err)
+	}
+	return moduleGroups, nil
+}
+
+// ParseModuleGroups parses and validates the YAML or JSON module groups
+// content.
+func ParseModuleGroups(data []byte) (*ModuleGroups, error) {
+	moduleGroups := new(ModuleGroups)
+	if err := yaml.Unmarshal(data, moduleGroups); err != nil {
+		return nil, err
+	}
+	for i, group := range moduleGroups.Groups {
+		if len(group) == 0 {
+			return nil, fmt.Errorf("group %d is empty", i)
+		}
+		for _, filename := range group {
+			if filename == "" || strings.Contains(filename, "/") {
+				return nil, fmt.Errorf("group %d: %q isn't a file of the package", i, filename)
+			}
+		}
+	}
+	return moduleGroups, nil
+}
@@ -0,0 +1,58 @@
+package pythonconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func TestParseModuleGroups(t *testing.T) {
+	moduleGroups, err := ParseModuleGroups([]byte("groups:\n  - [models.py, models_mixins.py]\n  - [views.py]\n"))
+	if err != nil {
+		t.Fatalf("ParseModuleGroups() error: %v", err)
+	}
+	want := [][]string{{"models.py", "models_mixins.py"}, {"views.py"}}
+	if !reflect.DeepEqual(moduleGroups.Groups, want) {
+		t.Errorf("Groups = %v, want %v", moduleGroups.Groups, want)
+	}
+}
+
+func TestParseModuleGroupsErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"empty group":    "groups:\n  - []\n",
+		"empty filename": "groups:\n  - [models.py, \"\"]\n",
+		"subdirectory":   "groups:\n  - [models.py, sub/models.py]\n",
+		"invalid groups": "groups: models.py\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseModuleGroups([]byte(content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadModuleGroupsMissingFile(t *testing.T) {
+	moduleGroups, err := LoadModuleGroups(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadModuleGroups() error: %v", err)
+	}
+	if moduleGroups != nil {
+		t.Errorf("LoadModuleGroups() = %v, want nil", moduleGroups)
+	}
+}
+
+func TestLoadModuleGroups(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, ModuleGroupsFilename), []byte("groups: [[a.py, b.py]]\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	moduleGroups, err := LoadModuleGroups(dir)
+	if err != nil {
+		t.Fatalf("LoadModuleGroups() error: %v", err)
+	}
+	if want := [][]string{{"a.py", "b.py"}}; !reflect.DeepEqual(moduleGroups.Groups, want) {
+		t.Errorf("Groups = %v, want %v", moduleGroups.Groups, want)
+	}
+}
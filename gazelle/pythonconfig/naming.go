@@ -0,0 +1,204 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"crypto/sha256"
+	"fmt"
+	"path"
+	"sort"
+	"strings"
+)
+
+// GeneratedTarget describes a generated target whose name is derived by a
+// TargetNamingStrategy.
+type GeneratedTarget struct {
+	// Kind is the kind of the target before any map_kind directive:
+	// py_library, py_binary or py_test.
+	Kind string
+	// Pkg is the Bazel package of the target, relative to the repository root.
+	Pkg string
+	// PythonRoot is the python_root of the package, relative to the
+	// repository root.
+	PythonRoot string
+	// PackageName is the name substituted for $package_name$ by the naming
+	// conventions, the base name of the package directory.
+	PackageName string
+	// File is the source file the target is generated for, relative to Pkg,
+	// e.g. in the "file" generation mode, or empty for the targets generated
+	// for the whole package.
+	File string
+}
+
+// TargetNamingStrategy derives the names of the generated targets. The
+// built-in strategies are selected with the python_naming_strategy directive,
+// and custom ones can be added with RegisterNamingStrategy.
+type TargetNamingStrategy interface {
+	// TargetName returns the name of the generated target t, under the
+	// configuration c of its package.
+	TargetName(c *Config, t GeneratedTarget) string
+}
+
+// TargetNamingStrategyFunc adapts a function to the TargetNamingStrategy
+// interface.
+type TargetNamingStrategyFunc func(c *Config, t GeneratedTarget) string
+
+// TargetName calls f(c, t).
+func (f TargetNamingStrategyFunc) TargetName(c *Config, t GeneratedTarget) string {
+	return f(c, t)
+}
+
+// The built-in naming strategies.
+const (
+	// NamingStrategyLegacy names the targets generated for a whole package
+	// with the python_*_naming_convention directives, and the targets
+	// generated for a file after the file name without its extension. This
+	// is the default.
+	NamingStrategyLegacy = "legacy"
+	// NamingStrategyFilename names the targets generated for a file after the
+	// file name, the extension included, so that they never collide with the
+	// targets generated for a package, e.g. "utils_py" for "utils.py".
+	NamingStrategyFilename = "filename"
+	// NamingStrategyModulePath names the targets after the module path of
+	// their package or file relative to the python_root, so that they're
+	// unique across the repository, e.g. "app_utils_strings" for
+	// "app/utils/strings.py".
+	NamingStrategyModulePath = "module-path"
+	// NamingStrategyHashed appends to the legacy names a short hash of the
+	// package, the file and the kind of the targets, so that they're unique
+	// across the repository and stable.
+	NamingStrategyHashed = "hashed"
+)
+
+// namingStrategies are the naming strategies selectable with the
+// python_naming_strategy directive.
+var namingStrategies = map[string]TargetNamingStrategy{
+	NamingStrategyLegacy:     TargetNamingStrategyFunc(legacyTargetName),
+	NamingStrategyFilename:   TargetNamingStrategyFunc(filenameTargetName),
+	NamingStrategyModulePath: TargetNamingStrategyFunc(modulePathTargetName),
+	NamingStrategyHashed:     TargetNamingStrategyFunc(hashedTargetName),
+}
+
+// RegisterNamingStrategy makes the naming strategy selectable with the
+// python_naming_strategy directive under the given name. It's meant to be
+// called from the init function of a package linked into the Gazelle binary,
+// and panics if the name is already registered.
+func RegisterNamingStrategy(name string, strategy TargetNamingStrategy) {
+	if _, ok := namingStrategies[name]; ok {
+		panic(fmt.Sprintf("naming strategy %q is already registered", name))
+	}
+	namingStrategies[name] = strategy
+}
+
+// NamingStrategies returns the sorted names of the registered naming
+// strategies.
+func NamingStrategies() []string {
+	names := make([]string, 0, len(namingStrategies))
+	for name := range namingStrategies {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LookupNamingStrategy returns the naming strategy registered under the
+// given name.
+func LookupNamingStrategy(name string) (TargetNamingStrategy, bool) {
+	strategy, ok := namingStrategies[name]
+	return strategy, ok
+}
+
+// legacyTargetName implements NamingStrategyLegacy.
+func legacyTargetName(c *Config, t GeneratedTarget) string {
+	if t.File != "" {
+		return strings.TrimSuffix(path.Base(t.File), ".py")
+	}
+	return c.renderName(t.Kind, t.PackageName)
+}
+
+// filenameTargetName implements NamingStrategyFilename.
+func filenameTargetName(c *Config, t GeneratedTarget) string {
+	if t.File != "" {
+		return strings.ReplaceAll(path.Base(t.File), ".", "_")
+	}
+	return legacyTargetName(c, t)
+}
+
+// modulePathTargetName implements NamingStrategyModulePath. The targets of
+// the python_root package itself keep their legacy names.
+func modulePathTargetName(c *Config, t GeneratedTarget) string {
+	modulePath := t.Pkg
+	if t.PythonRoot != "" {
+		modulePath = strings.TrimPrefix(strings.TrimPrefix(t.Pkg, t.PythonRoot), "/")
+	}
+	if t.File != "" {
+		modulePath = path.Join(modulePath, strings.TrimSuffix(path.Base(t.File), ".py"))
+	}
+	if modulePath == "" {
+		return legacyTargetName(c, t)
+	}
+	name := strings.ReplaceAll(modulePath, "/", "_")
+	if t.File != "" {
+		return name
+	}
+	return c.renderName(t.Kind, name)
+}
+
+// hashedTargetName implements NamingStrategyHashed.
+func hashedTargetName(c *Config, t GeneratedTarget) string {
+	sum := sha256.Sum256([]byte(t.Kind + "\x00" + path.Join(t.Pkg, t.File)))
+	return fmt.Sprintf("%s_%x", legacyTargetName(c, t), sum[:4])
+}
+
+// renderName renders the naming convention of the kind with the package
+// name.
+func (c *Config) renderName(kind, packageName string) string {
+	switch kind {
+	case "py_binary":
+		return c.RenderBinaryName(packageName)
+	case "py_test":
+		return c.RenderTestName(packageName)
+	default:
+		return c.RenderLibraryName(packageName)
+	}
+}
+
+// SetNamingStrategy sets the name of the naming strategy of the generated
+// targets.
+func (c *Config) SetNamingStrategy(name string) {
+	c.namingStrategy = name
+}
+
+// NamingStrategy returns the name of the naming strategy of the generated
+// targets.
+func (c *Config) NamingStrategy() string {
+	return c.namingStrategy
+}
+
+// TargetName returns the name of the generated target t, derived by the naming
+// strategy of the configuration.
+func (c *Config) TargetName(t GeneratedTarget) string {
+	strategy, ok := namingStrategies[c.namingStrategy]
+	if !ok {
+		strategy = namingStrategies[NamingStrategyLegacy]
+	}
+	return strategy.TargetName(c, t)
+}
+
+// LegacyTargetName returns the name of the generated target t under the
+// legacy naming strategy.
+func (c *Config) LegacyTargetName(t GeneratedTarget) string {
+	return legacyTargetName(c, t)
+}
@@ -0,0 +1,69 @@
+package pythonconfig
+
+import (
+	"regexp"
+	"testing"
+)
+
+func TestTargetName(t *testing.T) {
+	library := GeneratedTarget{Kind: "py_library", Pkg: "src/app/utils", PythonRoot: "src", PackageName: "utils"}
+	binary := GeneratedTarget{Kind: "py_binary", Pkg: "src/app/utils", PythonRoot: "src", PackageName: "utils"}
+	fileLibrary := GeneratedTarget{Kind: "py_library", Pkg: "src/app/utils", PythonRoot: "src", PackageName: "utils", File: "strings.py"}
+	fileTest := GeneratedTarget{Kind: "py_test", Pkg: "src/app/utils", PythonRoot: "src", PackageName: "utils", File: "strings_test.py"}
+	root := GeneratedTarget{Kind: "py_test", Pkg: "src", PythonRoot: "src", PackageName: "src"}
+
+	for _, tc := range []struct {
+		strategy string
+		target   GeneratedTarget
+		want     string
+	}{
+		{NamingStrategyLegacy, library, "utils"},
+		{NamingStrategyLegacy, binary, "utils_bin"},
+		{NamingStrategyLegacy, fileLibrary, "strings"},
+		{NamingStrategyLegacy, fileTest, "strings_test"},
+		{NamingStrategyFilename, library, "utils"},
+		{NamingStrategyFilename, fileLibrary, "strings_py"},
+		{NamingStrategyFilename, fileTest, "strings_test_py"},
+		{NamingStrategyModulePath, library, "app_utils"},
+		{NamingStrategyModulePath, binary, "app_utils_bin"},
+		{NamingStrategyModulePath, fileLibrary, "app_utils_strings"},
+		{NamingStrategyModulePath, root, "src_test"},
+	} {
+		c := New("/repo", "")
+		c.SetNamingStrategy(tc.strategy)
+		if got := c.TargetName(tc.target); got != tc.want {
+			t.Errorf("%s: TargetName(%+v) = %q, want %q", tc.strategy, tc.target, got, tc.want)
+		}
+	}
+
+	c := New("/repo", "")
+	c.SetNamingStrategy(NamingStrategyHashed)
+	hashed := c.TargetName(fileLibrary)
+	if !regexp.MustCompile(`^strings_[0-9a-f]{8}$`).MatchString(hashed) {
+		t.Errorf("hashed: TargetName(%+v) = %q, want strings_ and a hash", fileLibrary, hashed)
+	}
+	if other := c.TargetName(fileTest); other == hashed || c.TargetName(fileLibrary) != hashed {
+		t.Errorf("hashed: the names must be unique and stable, got %q and %q", hashed, other)
+	}
+}
+
+func TestRegisterNamingStrategy(t *testing.T) {
+	RegisterNamingStrategy("test-prefixed", TargetNamingStrategyFunc(func(c *Config, t GeneratedTarget) string {
+		return "prefixed_" + c.LegacyTargetName(t)
+	}))
+	defer delete(namingStrategies, "test-prefixed")
+
+	c := New("/repo", "")
+	c.SetNamingStrategy("test-prefixed")
+	child := c.NewChild()
+	if got := child.TargetName(GeneratedTarget{Kind: "py_library", Pkg: "app", PackageName: "app"}); got != "prefixed_app" {
+		t.Errorf("TargetName() = %q, want %q", got, "prefixed_app")
+	}
+
+	defer func() {
+		if recover() == nil {
+			t.Error("registering a strategy twice must panic")
+		}
+	}()
+	RegisterNamingStrategy(NamingStrategyLegacy, TargetNamingStrategyFunc(legacyTargetName))
+}
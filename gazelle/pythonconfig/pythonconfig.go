@@ -20,7 +20,9 @@ import (
 	"os"
 	"path"
 	"regexp"
+	"sort"
 	"strings"
+	"sync"
 
 	"github.com/emirpasic/gods/lists/singlylinkedlist"
 
@@ -61,6 +63,15 @@ const (
 	// requires a test entry point to generate test targets in "package" GenerationMode.
 	// This is a boolean directive.
 	GenerationModePerPackageRequireTestEntryPoint = "python_generation_mode_per_package_require_test_entry_point"
+	// GenerationModePerFileMergeCycles represents the directive that augments
+	// the "per_file" GenerationMode by merging the files importing each other
+	// in a cycle into a single target. This is a boolean directive.
+	GenerationModePerFileMergeCycles = "python_generation_mode_per_file_merge_cycles"
+	// GenerationModePerFileTestUtils represents the directive that augments
+	// the "per_file" GenerationMode by grouping the conftest.py file and the
+	// helpers of the tests of a package into a single testutils target that
+	// all the tests depend on. This is a boolean directive.
+	GenerationModePerFileTestUtils = "python_generation_mode_per_file_test_utils"
 	// LibraryNamingConvention represents the directive that controls the
 	// py_library naming convention. It interpolates $package_name$ with the
 	// Bazel package name. E.g. if the Bazel package name is `foo`, setting this
@@ -125,8 +136,570 @@ const (
 	// https://github.com/bazel-contrib/rules_python/issues/3595 which requested
 	// that the behavior be configurable.
 	PythonIncludeAncestorConftest = "python_include_ancestor_conftest"
+	// DepsOrderFile represents the directive that points to a YAML or JSON
+	// file describing the layers of the repository. When set, dependencies
+	// that violate the layering are listed in the deps_to_remove attribute.
+	// The path is relative to the directory of the BUILD file declaring it.
+	DepsOrderFile = "python_deps_order_file"
+	// DepsOrderMode represents the directive that controls what happens when
+	// a dependency violates the layering declared with python_deps_order_file.
+	// See DepsOrderModeType.
+	DepsOrderMode = "python_deps_order_mode"
+	// EntryPointPolicy represents the directive that restricts the generation
+	// of test or binary targets to the packages containing at least one of the
+	// given entry files. The value is the kind of targets, "test" or "binary",
+	// followed by the file names. Omitting the file names removes the policy
+	// for that kind of targets.
+	EntryPointPolicy = "python_entry_point_policy"
+	// ImportWeightsFile represents the directive that points to a YAML or JSON
+	// file assigning weights to the third-party distributions. When set, the
+	// binaries are tagged with the weight of the distributions they import.
+	// The path is relative to the directory of the BUILD file declaring it.
+	ImportWeightsFile = "python_import_weights_file"
+	// ImportWeightBudget represents the directive that sets the maximum weight
+	// of the distributions imported by a binary before a warning is logged.
+	ImportWeightBudget = "python_import_weight_budget"
+	// TestTimingsFile represents the directive that points to a YAML or JSON
+	// file recording the duration of the test files, used to balance the
+	// shard_count of the test targets with python_test_shard_seconds. The path
+	// is relative to the directory of the BUILD file declaring it.
+	TestTimingsFile = "python_test_timings_file"
+	// TestShardSeconds represents the directive that sets the duration, in
+	// seconds, of the shards of the test targets whose test files have
+	// timings. Zero, the default, disables the timing-based sharding.
+	TestShardSeconds = "python_test_shard_seconds"
+	// TestShardFiles represents the directive that sets the number of test
+	// files of the shards of the test targets without timings. Zero, the
+	// default, disables the file-based sharding.
+	TestShardFiles = "python_test_shard_files"
+	// TestShardCases represents the directive that sets the number of test
+	// cases of the shards of the test targets without timings, estimated
+	// from the test functions and their parametrize markers. Zero, the
+	// default, disables the case-based sharding.
+	TestShardCases = "python_test_shard_cases"
+	// TestShardMax represents the directive that sets the maximum
+	// shard_count of the test targets. Zero, the default, doesn't bound it.
+	TestShardMax = "python_test_shard_max"
+	// WheelLockFile represents the directive that points to the lock file
+	// listing the wheels and the sdists of the third-party distributions,
+	// audited against the python_target_platforms with the
+	// -python_wheel_audit flag. The path is relative to the directory of the
+	// BUILD file declaring it.
+	WheelLockFile = "python_wheel_lock_file"
+	// TargetPlatforms represents the directive that lists the platforms the
+	// third-party distributions are installed on, e.g.
+	// "cp311-manylinux_2_28_x86_64 cp311-macosx_14_0_arm64". An empty value
+	// removes them.
+	TargetPlatforms = "python_target_platforms"
+	// NamingStrategy represents the directive that selects the strategy
+	// deriving the names of the generated targets, one of NamingStrategies.
+	NamingStrategy = "python_naming_strategy"
+	// ResolveAncestorPackage represents the directive that controls whether
+	// the imports that no target provides, nor any of their parent modules,
+	// are resolved to the target of the __init__.py file of their deepest
+	// ancestor package. Defaults to false.
+	ResolveAncestorPackage = "python_resolve_ancestor_package"
+	// Opaque represents the directive that declares the label of a Bazel
+	// package, e.g. a vendored tree, as the only target providing the modules
+	// under its directory, e.g. "//third_party/vendored/foo". Gazelle neither
+	// generates nor indexes the targets of the packages under it.
+	Opaque = "python_opaque"
+	// PythonVersion represents the directive that declares the version of
+	// Python targeted, e.g. "3.11", selecting the modules of the standard
+	// library. Defaults to the version of the embedded list of modules.
+	PythonVersion = "python_version"
+	// ShebangBinaries represents the directive that controls whether the
+	// files starting with a Python shebang line, e.g. "#!/usr/bin/env
+	// python3", get a py_binary like the ones with a __main__ guard. This is
+	// a boolean directive. Defaults to false.
+	ShebangBinaries = "python_shebang_binaries"
+	// PyprojectDependencies represents the directive that declares the pip
+	// repository, e.g. "pypi", of the distributions listed by the
+	// dependencies of the pyproject.toml files. The imports of the modules
+	// named after them resolve to that repository when no gazelle manifest
+	// maps them. Defaults to not reading the dependencies.
+	PyprojectDependencies = "python_pyproject_dependencies"
+	// GenerateWheel represents the directive that controls whether a
+	// py_wheel and a py_package are generated from the [project] metadata of
+	// the pyproject.toml files. This is a boolean directive. Defaults to
+	// false.
+	GenerateWheel = "python_generate_wheel"
+	// GenerateDoctests represents the directive that controls whether a
+	// py_test running the doctests of each module with `>>>` examples in
+	// its docstrings is generated. This is a boolean directive. Defaults to
+	// false.
+	GenerateDoctests = "python_generate_doctests"
+	// SrcsStrategy represents the directive that controls how the srcs of
+	// the generated py_library targets are written. See SrcsStrategyType.
+	SrcsStrategy = "python_srcs_strategy"
+	// TestonlyDirs represents the directive that lists the names of the
+	// directories, e.g. "tests,testing", whose libraries and binaries are
+	// generated with testonly = True, including in their subdirectories.
+	// Defaults to none.
+	TestonlyDirs = "python_testonly_dirs"
+	// DefaultAttr represents the directive that sets an attribute of the
+	// generated rules of a kind, e.g. "py_test timeout=moderate". It can be
+	// repeated, and an empty value removes the attribute set by the parent
+	// packages, e.g. "py_test timeout=".
+	DefaultAttr = "python_default_attr"
+	// PytestMarker represents the directive that maps a pytest marker, e.g.
+	// "slow" for `@pytest.mark.slow`, to the tags and the size of the py_test
+	// targets whose files apply it, e.g. "slow size=large tag=slow". It can
+	// be repeated.
+	PytestMarker = "python_pytest_marker"
+	// NotebookConverter represents the directive that sets the label of the
+	// tool converting the Jupyter notebooks to Python modules, e.g. a
+	// py_console_script_binary of jupyter-nbconvert. When set, a genrule
+	// converting each notebook and a py_library of the converted module are
+	// generated. An empty value disables the notebooks.
+	NotebookConverter = "python_notebook_converter"
+	// ExcludeRegex represents the directive that excludes from the generation
+	// the files whose path, relative to the repository root, matches the
+	// regular expression, e.g. `_flymake\.py$`. It can be repeated, and
+	// applies to the subpackages. An empty value resets the expressions.
+	ExcludeRegex = "python_exclude_regex"
+	// WrapperMacro represents the directive that declares a macro wrapping a
+	// kind of the extension, e.g. "py_library my_py_library
+	// //tools/build:py.bzl srcs=sources", along with the names of its srcs,
+	// deps and pyi_deps attributes when they differ. The macro is generated
+	// instead of the kind, and its rules are indexed and resolved like the
+	// ones of the kind. It's only supported in the root BUILD file, since the
+	// kinds are registered before the repository is walked.
+	WrapperMacro = "python_wrapper_macro"
+	// CoarseGrainedFacade represents the directive that controls whether, in
+	// project generation mode, the package declaring it is a facade: its
+	// immediate subdirectories get targets of their own, visible to the
+	// facade package and its subpackages only, and the library of the
+	// package depends on them. The imports from outside the facade resolve
+	// to its library. Defaults to false.
+	CoarseGrainedFacade = "python_coarse_grained_facade"
+	// BinaryEntrypoints represents the directive that lists the names of the
+	// files getting a py_binary like the ones with a __main__ guard, e.g.
+	// "main.py,cli.py". An empty value resets the names.
+	BinaryEntrypoints = "python_binary_entrypoints"
+	// GenerateCython represents the directive that controls whether a
+	// pyx_library target is generated for the Cython .pyx and .pxd files of
+	// the packages. Defaults to false.
+	GenerateCython = "python_generate_cython"
+	// OptionalImports represents the directive that controls how the imports
+	// in the body of a `try:` statement catching ImportError are resolved.
+	// See OptionalImportsModeType.
+	OptionalImports = "python_optional_imports"
+	// UnresolvedImports represents the directive that controls what happens
+	// when an import can't be resolved while validating the import
+	// statements. See UnresolvedImportsModeType.
+	UnresolvedImports = "python_unresolved_imports"
+	// GeneratedModule represents the directive that declares a Python file
+	// generated at build time, e.g. by a genrule, and the label of the target
+	// generating it. The path of the file is relative to the directory of the
+	// BUILD file declaring it. The module is resolved to the label from any
+	// package of the repository.
+	GeneratedModule = "python_generated_module"
+	// NativeModule represents the directive that declares a native extension
+	// module, e.g. built by a cc_binary or a pybind11 rule, and the label of
+	// the target building it, e.g. "fastlib //native:fastlib.so". The module
+	// is resolved to the label from any package of the repository.
+	NativeModule = "python_native_module"
+	// LicenseLabel represents the directive that maps a license of the
+	// third-party distributions, as listed in the licenses of the Gazelle
+	// manifest, to the label of its license metadata target. The targets
+	// importing distributions with mapped licenses get these labels in their
+	// applicable_licenses attribute.
+	LicenseLabel = "python_license_label"
+	// ResolveVisibility represents the directive that controls whether the
+	// visibility of the first-party targets is taken into account when
+	// resolving the imports. See ResolveVisibilityModeType.
+	ResolveVisibility = "python_resolve_visibility"
+	// ImplicitNamespacePackages represents the directive that controls
+	// whether the Python packages may omit their __init__.py files, as
+	// implicit namespace packages. When disabled, a warning lists the missing
+	// __init__.py files of the imports resolved to first-party targets.
+	// Defaults to true.
+	ImplicitNamespacePackages = "python_implicit_namespace_packages"
+	// ResolveConflictPolicy represents the directive that controls how an
+	// import is resolved when several first-party targets provide its module.
+	// See ResolveConflictPolicyType.
+	ResolveConflictPolicy = "python_resolve_conflict_policy"
+	// ToolingFilePattern represents the directive that controls which Python
+	// files are tooling files, e.g. setup.py, whose imports are resolved
+	// without registering them as importable modules.
+	ToolingFilePattern = "python_tooling_file_pattern"
+	// ResolveStringAnnotations represents the directive that controls whether
+	// the dotted names of the string annotations, e.g. `x: "mypkg.models.User"`,
+	// are resolved as type-checking only imports. Defaults to false.
+	ResolveStringAnnotations = "python_resolve_string_annotations"
+	// FlattenSubpackages represents the directive that controls whether, in
+	// package generation mode, the Python files of the descendant directories
+	// without a BUILD file belong to the target of the nearest Bazel package.
+	// Defaults to false.
+	FlattenSubpackages = "python_flatten_subpackages"
+	// FoldSubdirs represents the directive that controls whether, in package
+	// generation mode, the Python files of the descendant directories without
+	// a BUILD file nor an __init__.py file belong to the target of the
+	// nearest Python package. Defaults to false.
+	FoldSubdirs = "python_fold_subdirs"
+	// GenerateInitFiles represents the directive that controls whether the
+	// missing __init__.py files of the Python packages are created on disk,
+	// and with which content. See InitFilesModeType.
+	GenerateInitFiles = "python_generate_init_files"
+	// TestRunner represents the directive that controls the test runner of the
+	// generated py_test targets, followed by the arguments passed to it, e.g.
+	// "pytest --import-mode=importlib". See TestRunnerType.
+	TestRunner = "python_test_runner"
+	// Profile represents the directive that applies the directives of one of
+	// the presets, see ProfileType. The directives following it in the same
+	// BUILD file override the ones of the preset.
+	Profile = "python_profile"
+	// ResolveSymbol represents the directive that resolves a symbol imported
+	// from a module, e.g. "py pkg.mod:SpecificClass //other:target", to a
+	// target, taking precedence over the resolution of the module. It's
+	// needed for the facade modules re-exporting symbols from different
+	// targets.
+	ResolveSymbol = "resolve_symbol"
+	// ResolutionScope represents the directive that controls which
+	// first-party targets an import may resolve to. See ResolutionScopeType.
+	ResolutionScope = "python_resolution_scope"
+	// DistributionTests represents the directive that generates, in the
+	// current package only, a smoke test importing the top-level modules of
+	// each distribution of the gazelle manifest. Its value is the file of the
+	// package running the test, which receives the modules as arguments.
+	DistributionTests = "python_distribution_tests"
+	// ThirdPartyPrefix represents the directive that maps the imports under a
+	// module prefix to a label computed from a template, e.g.
+	// "mycorp.vendor @vendored//:%{module}", when no gazelle manifest maps
+	// them.
+	ThirdPartyPrefix = "python_third_party_prefix"
+	// ExternalRepository represents the directive that resolves the imports
+	// to the py_library targets of an external Gazelle-managed repository,
+	// indexed from its checkout, e.g. "shared ../shared". The path is relative
+	// to the directory of the BUILD file declaring it.
+	ExternalRepository = "python_external_repository"
+	// TypeStubPattern represents the directive that controls the names of the
+	// modules probed in the gazelle manifests for the type stub packages of
+	// the imported distributions, e.g. "$distribution_name$-stubs", whose
+	// dependencies go to pyi_deps. Defaults to DefaultTypeStubPatternString.
+	TypeStubPattern = "python_type_stub_pattern"
+	// AttachStubDeps represents the directive that controls whether the type
+	// stub packages of the imported distributions are looked up and added to
+	// the dependencies. See AttachStubDepsModeType.
+	AttachStubDeps = "python_attach_stub_deps"
+	// GenerateDepsFile represents the directive that controls whether the
+	// deps and pyi_deps of the generated targets are written to a py_deps.bzl
+	// file in their package, and referenced as constants from the BUILD file.
+	// Defaults to false.
+	GenerateDepsFile = "python_generate_deps_file"
+	// PackageData represents the directive that controls whether the package
+	// data files read with importlib.resources or pkgutil.get_data are added
+	// to the data attribute of the targets. See PackageDataModeType.
+	PackageData = "python_package_data"
+)
+
+// GeneratedTag is the tag marking the targets whose outs are Python files
+// generated at build time. The modules of these files are resolved to the
+// targets from any package of the repository, like with the GeneratedModule
+// directive.
+const GeneratedTag = "py_generated"
+
+// NativeExtensionTag is the tag marking the cc_binary and cc_shared_library
+// targets building native extension modules, named after the targets. The
+// modules are resolved to the targets from any package of the repository,
+// like with the NativeModule directive.
+const NativeExtensionTag = "python_extension"
+
+// EntryPointPolicyKind represents the kinds of targets restricted by the
+// EntryPointPolicy directive.
+type EntryPointPolicyKind string
+
+// Entry point policy kinds
+const (
+	EntryPointPolicyTest   EntryPointPolicyKind = "test"
+	EntryPointPolicyBinary EntryPointPolicyKind = "binary"
+)
+
+// DepsOrderModeType represents one of the modes handling violations of the
+// deps order.
+type DepsOrderModeType string
+
+// Deps order modes
+const (
+	// DepsOrderModeRemove lists the violating dependencies in the
+	// deps_to_remove attribute.
+	DepsOrderModeRemove DepsOrderModeType = "remove"
+	// DepsOrderModeError fails with a diagnostic pointing at the offending
+	// import for each violating dependency.
+	DepsOrderModeError DepsOrderModeType = "error"
+)
+
+// OptionalImportsModeType represents one of the modes handling the optional
+// imports, i.e. the imports guarded by `try: ... except ImportError:`.
+type OptionalImportsModeType string
+
+// Optional imports modes
+const (
+	// OptionalImportsModeIgnore doesn't add dependencies for the optional
+	// imports.
+	OptionalImportsModeIgnore OptionalImportsModeType = "ignore"
+	// OptionalImportsModeAdd resolves the optional imports like any other
+	// import, failing the validation if they can't be resolved.
+	OptionalImportsModeAdd OptionalImportsModeType = "add"
+	// OptionalImportsModeIfAvailable adds dependencies for the optional
+	// imports that can be resolved, e.g. the distributions of the manifest,
+	// and silently skips the others.
+	OptionalImportsModeIfAvailable OptionalImportsModeType = "if_available"
+	// OptionalImportsModeTag doesn't add dependencies for the optional
+	// imports, but lists them in the tags of the targets, e.g.
+	// "optional_import=ujson".
+	OptionalImportsModeTag OptionalImportsModeType = "tag"
+)
+
+// InitFilesModeType represents one of the modes creating the missing
+// __init__.py files of the Python packages.
+type InitFilesModeType string
+
+// Init files modes
+const (
+	// InitFilesModeNone doesn't create the __init__.py files.
+	InitFilesModeNone InitFilesModeType = "none"
+	// InitFilesModeEmpty creates empty __init__.py files.
+	InitFilesModeEmpty InitFilesModeType = "empty"
+	// InitFilesModeNamespace creates __init__.py files extending the __path__
+	// of the package with pkgutil, so that the namespace packages spanning
+	// several directories keep working.
+	InitFilesModeNamespace InitFilesModeType = "namespace"
+)
+
+// TestRunnerType represents one of the test runners of the generated py_test
+// targets.
+type TestRunnerType string
+
+// Test runners
+const (
+	// TestRunnerNone doesn't generate a test runner. The py_test targets use
+	// the __test__.py file or the __test__ target of the package, if any.
+	TestRunnerNone TestRunnerType = "none"
+	// TestRunnerPytest generates a py_pytest_main target named __test__,
+	// running the tests of the package with pytest.
+	TestRunnerPytest TestRunnerType = "pytest"
+)
+
+// PackageDataModeType represents one of the modes handling the package data
+// files read with importlib.resources or pkgutil.get_data.
+type PackageDataModeType string
+
+// Package data modes
+const (
+	// PackageDataModeNone doesn't add the package data files to the targets.
+	PackageDataModeNone PackageDataModeType = "none"
+	// PackageDataModeFiles adds the package data files themselves to the data
+	// attribute of the targets.
+	PackageDataModeFiles PackageDataModeType = "files"
+	// PackageDataModeTarget adds a target of the Bazel package holding the
+	// package data, e.g. a filegroup, to the data attribute of the targets,
+	// e.g. "target package_data".
+	PackageDataModeTarget PackageDataModeType = "target"
+)
+
+// AttachStubDepsModeType represents one of the modes handling the type stub
+// packages of the imported distributions.
+type AttachStubDepsModeType string
+
+// Attach stub deps modes
+const (
+	// AttachStubDepsNever doesn't look up the type stub packages.
+	AttachStubDepsNever AttachStubDepsModeType = "never"
+	// AttachStubDepsPyiOnly adds the type stub packages to pyi_deps, and
+	// skips them when python_generate_pyi_deps is disabled instead of adding
+	// them to deps.
+	AttachStubDepsPyiOnly AttachStubDepsModeType = "pyi_only"
+	// AttachStubDepsRuntime adds the type stub packages to pyi_deps, or to
+	// deps along with the other type-checking dependencies when
+	// python_generate_pyi_deps is disabled. This is the default.
+	AttachStubDepsRuntime AttachStubDepsModeType = "runtime"
 )
 
+// UnresolvedImportsModeType represents one of the modes handling the imports
+// that can't be resolved.
+type UnresolvedImportsModeType string
+
+// Unresolved imports modes
+const (
+	// UnresolvedImportsModeError fails with the possible solutions for each
+	// unresolved import.
+	UnresolvedImportsModeError UnresolvedImportsModeType = "error"
+	// UnresolvedImportsModeTag tags the targets with unresolved imports with
+	// "unresolved-imports" instead of failing.
+	UnresolvedImportsModeTag UnresolvedImportsModeType = "tag"
+)
+
+// ResolveVisibilityModeType represents one of the modes taking the visibility
+// of the first-party targets into account when resolving the imports.
+type ResolveVisibilityModeType string
+
+// Resolve visibility modes
+const (
+	// ResolveVisibilityModeIgnore resolves the imports regardless of the
+	// visibility of the targets.
+	ResolveVisibilityModeIgnore ResolveVisibilityModeType = "ignore"
+	// ResolveVisibilityModePrefer resolves the imports to the targets visible
+	// to the importing package when there are any, and to the other ones
+	// otherwise.
+	ResolveVisibilityModePrefer ResolveVisibilityModeType = "prefer"
+	// ResolveVisibilityModeRequire only resolves the imports to the targets
+	// visible to the importing package, failing when none of them is.
+	ResolveVisibilityModeRequire ResolveVisibilityModeType = "require"
+	// ResolveVisibilityModeWarn only resolves the imports to the targets
+	// visible to the importing package, skipping the dependency with a
+	// warning when none of them is.
+	ResolveVisibilityModeWarn ResolveVisibilityModeType = "warn"
+)
+
+// ResolveConflictPolicyType represents one of the policies applied when
+// several first-party targets provide the module of an import.
+type ResolveConflictPolicyType string
+
+// Resolve conflict policies
+const (
+	// ResolveConflictPolicyError fails the resolution, listing the targets.
+	ResolveConflictPolicyError ResolveConflictPolicyType = "error"
+	// ResolveConflictPolicyFirst resolves the import to the first target, in
+	// the order of their labels.
+	ResolveConflictPolicyFirst ResolveConflictPolicyType = "first"
+	// ResolveConflictPolicyNearest resolves the import to the target whose
+	// package is the nearest to the importing package in the directory tree.
+	ResolveConflictPolicyNearest ResolveConflictPolicyType = "nearest"
+	// ResolveConflictPolicySkip leaves the import unresolved, without
+	// failing.
+	ResolveConflictPolicySkip ResolveConflictPolicyType = "skip"
+)
+
+// ResolutionScopeType represents one of the scopes of the first-party targets
+// that an import may resolve to.
+type ResolutionScopeType string
+
+// Resolution scopes
+const (
+	// ResolutionScopeRepository resolves the imports to the targets of the
+	// whole repository.
+	ResolutionScopeRepository ResolutionScopeType = "repository"
+	// ResolutionScopeProject resolves the imports to the targets under the
+	// same python_root only, failing the imports of the modules of other
+	// Python projects.
+	ResolutionScopeProject ResolutionScopeType = "project"
+)
+
+// SrcsStrategyType represents one of the ways of writing the srcs of the
+// generated py_library targets.
+type SrcsStrategyType string
+
+// Srcs strategies
+const (
+	// SrcsStrategyList lists the source files of the targets. This is the
+	// default.
+	SrcsStrategyList SrcsStrategyType = "list"
+	// SrcsStrategyGlob writes the srcs of the package and project libraries
+	// as a glob of the Python files, excluding the files going to the other
+	// targets, e.g. the tests.
+	SrcsStrategyGlob SrcsStrategyType = "glob"
+)
+
+// PytestMarkerAttrs are the tags and the size of the py_test targets whose
+// files apply a pytest marker, see the PytestMarker directive.
+type PytestMarkerAttrs struct {
+	Tags []string
+	// Size is the size of the targets, e.g. "large", or empty to leave it
+	// unset.
+	Size string
+}
+
+// WrapperMacroInfo describes a macro wrapping a kind of the extension, see the
+// WrapperMacro directive.
+type WrapperMacroInfo struct {
+	// Kind is the wrapped kind, e.g. py_library.
+	Kind string
+	// Macro is the name of the macro, e.g. my_py_library.
+	Macro string
+	// Load is the label of the .bzl file defining the macro.
+	Load string
+	// Attrs maps the attributes of the kind, e.g. "srcs", to the ones of the
+	// macro, e.g. "sources", when they differ.
+	Attrs map[string]string
+}
+
+// Attr returns the name of the attribute attr of the kind for the macro.
+func (m WrapperMacroInfo) Attr(attr string) string {
+	if macroAttr, ok := m.Attrs[attr]; ok {
+		return macroAttr
+	}
+	return attr
+}
+
+// ProfileType represents one of the presets of the python_profile directive.
+type ProfileType string
+
+// Profiles
+const (
+	// ProfileStrictPerFile generates a target per file, only resolving the
+	// imports to the visible targets of the regular packages.
+	ProfileStrictPerFile ProfileType = "strict-per-file"
+	// ProfileServicesCoarse generates a target per Python project, tolerating
+	// the optional and unresolved imports of the services.
+	ProfileServicesCoarse ProfileType = "services-coarse"
+	// ProfileDataScience generates a target per package, including the
+	// directories without a BUILD file, e.g. of notebooks helpers, tolerating
+	// the optional and unresolved imports.
+	ProfileDataScience ProfileType = "data-science"
+)
+
+// ProfileDirective is one of the directives applied by a preset.
+type ProfileDirective struct {
+	Key, Value string
+}
+
+// profiles maps the presets to the directives they apply, in order.
+var profiles = map[ProfileType][]ProfileDirective{
+	ProfileStrictPerFile: {
+		{GenerationMode, string(GenerationModeFile)},
+		{GenerationModePerFileIncludeInit, "true"},
+		{ValidateImportStatementsDirective, "true"},
+		{UnresolvedImports, string(UnresolvedImportsModeError)},
+		{ResolveVisibility, string(ResolveVisibilityModeRequire)},
+		{ResolveConflictPolicy, string(ResolveConflictPolicyError)},
+		{ImplicitNamespacePackages, "false"},
+	},
+	ProfileServicesCoarse: {
+		{GenerationMode, string(GenerationModeProject)},
+		{OptionalImports, string(OptionalImportsModeIfAvailable)},
+		{UnresolvedImports, string(UnresolvedImportsModeTag)},
+		{ResolveVisibility, string(ResolveVisibilityModePrefer)},
+		{ResolveConflictPolicy, string(ResolveConflictPolicyNearest)},
+	},
+	ProfileDataScience: {
+		{GenerationMode, string(GenerationModePackage)},
+		{FlattenSubpackages, "true"},
+		{OptionalImports, string(OptionalImportsModeIfAvailable)},
+		{UnresolvedImports, string(UnresolvedImportsModeTag)},
+		{ResolveConflictPolicy, string(ResolveConflictPolicyNearest)},
+		{ResolveStringAnnotations, "true"},
+	},
+}
+
+// ProfileDirectives returns the directives applied by the preset, in order,
+// and whether the preset exists.
+func ProfileDirectives(profile ProfileType) ([]ProfileDirective, bool) {
+	directives, ok := profiles[profile]
+	return directives, ok
+}
+
+// ProfileNames returns the names of the presets, sorted.
+func ProfileNames() []string {
+	names := make([]string, 0, len(profiles))
+	for profile := range profiles {
+		names = append(names, string(profile))
+	}
+	sort.Strings(names)
+	return names
+}
+
 // GenerationModeType represents one of the generation modes for the Python
 // extension.
 type GenerationModeType string
@@ -143,10 +716,17 @@ const (
 	GenerationModeFile    GenerationModeType = "file"
 )
 
+// ThirdPartyPrefixModuleSubstitution is replaced, in the label templates of
+// the python_third_party_prefix directive, by the first component of the
+// imported module following the prefix.
+const ThirdPartyPrefixModuleSubstitution = "%{module}"
+
 const (
 	packageNameNamingConventionSubstitution     = "$package_name$"
 	protoNameNamingConventionSubstitution       = "$proto_name$"
 	distributionNameLabelConventionSubstitution = "$distribution_name$"
+	pythonRootVisibilitySubstitution            = "$python_root$"
+	packageVisibilitySubstitution               = "$package$"
 )
 
 const (
@@ -154,6 +734,8 @@ const (
 	DefaultVisibilityFmtString = "//%s:__subpackages__"
 	// The default globs used to determine pt_test targets.
 	DefaultTestFilePatternString = "*_test.py,test_*.py"
+	// The default patterns of the modules of the type stub packages.
+	DefaultTypeStubPatternString = "$distribution_name$_stubs,$distribution_name$_types,types_$distribution_name$,stubs_$distribution_name$"
 	// The default convention of label of third-party dependencies.
 	DefaultLabelConvention = "$distribution_name$"
 	// The default normalization applied to distribution names of third-party dependency labels.
@@ -190,11 +772,101 @@ func (c Configs) ParentForPackage(pkg string) *Config {
 type Config struct {
 	parent *Config
 
-	extensionEnabled    bool
-	repoRoot            string
-	pythonProjectRoot   string
-	gazelleManifestPath string
-	gazelleManifest     *manifest.Manifest
+	extensionEnabled      bool
+	repoRoot              string
+	pythonProjectRoot     string
+	gazelleManifestPath   string
+	gazelleManifest       *manifest.Manifest
+	depsOrderPath         string
+	depsOrder             *DepsOrder
+	depsOrderMode         DepsOrderModeType
+	entryPointPolicies    map[EntryPointPolicyKind][]string
+	importWeightsPath     string
+	importWeights         *ImportWeights
+	importWeightBudget    int
+	testTimingsPath       string
+	testTimings           *TestTimings
+	testShardSeconds      int
+	testShardFiles        int
+	testShardCases        int
+	testShardMax          int
+	wheelLockPath         string
+	wheelLock             *WheelLock
+	targetPlatforms       []TargetPlatform
+	namingStrategy        string
+	resolveAncestorPkg    bool
+	optionalImportsMode   OptionalImportsModeType
+	unresolvedImportsMode UnresolvedImportsModeType
+	packageDataMode       PackageDataModeType
+	// packageDataTarget is the name of the target added by
+	// PackageDataModeTarget.
+	packageDataTarget     string
+	resolveVisibilityMode ResolveVisibilityModeType
+	resolveConflictPolicy ResolveConflictPolicyType
+	resolutionScope       ResolutionScopeType
+	srcsStrategy          SrcsStrategyType
+	// distributionTests is the test file of the python_distribution_tests
+	// directive, which isn't inherited by the child packages.
+	distributionTests string
+	// generatedModules maps the generated modules to the labels of the
+	// targets generating them. It's shared by all the packages.
+	generatedModules map[string]label.Label
+	// nativeModules maps the native extension modules to the labels of the
+	// targets building them. It's shared by all the packages.
+	nativeModules map[string]label.Label
+	// opaqueLibraries maps the modules of the python_opaque directories to
+	// the labels of their targets. It's shared by all the packages.
+	opaqueLibraries map[string]label.Label
+	licenseLabels   map[string]label.Label
+	// symbolResolves maps the symbols imported from modules, as
+	// "module:symbol", to the labels of the targets they resolve to.
+	symbolResolves map[string]label.Label
+	// wildcardResolves maps the module prefixes of the resolve directives
+	// ending with ".*" to the labels of the targets they resolve to.
+	wildcardResolves map[string]label.Label
+	// defaultAttrs maps the kinds of the generated rules to the values of
+	// the attributes set on them by python_default_attr, by attribute.
+	defaultAttrs map[string]map[string]string
+	// pytestMarkers maps the pytest markers to the tags and the size of the
+	// py_test targets applying them.
+	pytestMarkers map[string]PytestMarkerAttrs
+	// notebookConverter is the tool converting the Jupyter notebooks, or
+	// label.NoLabel when the notebooks aren't converted.
+	notebookConverter label.Label
+	// wrapperMacros are the macros wrapping the kinds of the extension, see
+	// python_wrapper_macro.
+	wrapperMacros []WrapperMacroInfo
+	// facadePackage is the package declaring python_coarse_grained_facade,
+	// if facade is true.
+	facadePackage string
+	facade        bool
+	// binaryEntrypoints are the names of the files getting a py_binary, see
+	// python_binary_entrypoints.
+	binaryEntrypoints []string
+	// generateCython is whether the Cython sources get a pyx_library, see
+	// python_generate_cython.
+	generateCython bool
+	// excludeRegexes are the regular expressions of the paths of the files
+	// excluded from the generation by python_exclude_regex.
+	excludeRegexes []*regexp.Regexp
+	// pythonVersion is the minor version of Python 3 targeted, e.g. 11 for
+	// Python 3.11, or 0 when unset.
+	pythonVersion int
+	// pyprojectRepository is the pip repository of the dependencies of the
+	// pyproject.toml files, see PyprojectDependencies.
+	pyprojectRepository string
+	// pyprojectPath is the path of the pyproject.toml file of the package
+	// read for its dependencies, which isn't inherited by the child packages.
+	pyprojectPath string
+	// declaredDistributions maps the module names guessed from the names of
+	// the distributions declared by the pyproject.toml files to them.
+	declaredDistributions map[string]declaredDistribution
+	// thirdPartyPrefixes are the module prefixes mapped to label templates,
+	// in the order of the python_third_party_prefix directives.
+	thirdPartyPrefixes []thirdPartyPrefix
+	// externalRepositories are the external repositories indexed for the
+	// resolution, see ExternalRepository.
+	externalRepositories []ExternalRepositoryCheckout
 
 	excludedPatterns                          *singlylinkedlist.List
 	ignoreFiles                               map[string]struct{}
@@ -204,13 +876,24 @@ type Config struct {
 	perFileGeneration                         bool
 	perFileGenerationIncludeInit              bool
 	perPackageGenerationRequireTestEntryPoint bool
+	perFileGenerationMergeCycles              bool
+	perFileGenerationTestUtils                bool
+	shebangBinaries                           bool
+	generateWheel                             bool
+	generateDoctests                          bool
 	libraryNamingConvention                   string
 	binaryNamingConvention                    string
 	testNamingConvention                      string
 	protoNamingConvention                     string
 	defaultVisibility                         []string
+	defaultVisibilityDeclared                 bool
+	visibilityFile                            *VisibilityFile
 	visibility                                []string
 	testFilePattern                           []string
+	typeStubPattern                           []string
+	attachStubDepsMode                        AttachStubDepsModeType
+	toolingFilePattern                        []string
+	testonlyDirs                              []string
 	labelConvention                           string
 	labelNormalization                        LabelNormalizationType
 	experimentalAllowRelativeImports          bool
@@ -219,6 +902,14 @@ type Config struct {
 	generateProto                             bool
 	resolveSiblingImports                     bool
 	includeAncestorConftest                   bool
+	implicitNamespacePackages                 bool
+	resolveStringAnnotations                  bool
+	flattenSubpackages                        bool
+	foldSubdirs                               bool
+	initFilesMode                             InitFilesModeType
+	testRunner                                TestRunnerType
+	testRunnerArgs                            []string
+	generateDepsFile                          bool
 }
 
 type LabelNormalizationType int
@@ -250,9 +941,12 @@ func New(
 		binaryNamingConvention:                    fmt.Sprintf("%s_bin", packageNameNamingConventionSubstitution),
 		testNamingConvention:                      fmt.Sprintf("%s_test", packageNameNamingConventionSubstitution),
 		protoNamingConvention:                     fmt.Sprintf("%s_py_pb2", protoNameNamingConventionSubstitution),
-		defaultVisibility:                         []string{fmt.Sprintf(DefaultVisibilityFmtString, "")},
+		defaultVisibility:                         []string{fmt.Sprintf(DefaultVisibilityFmtString, pythonRootVisibilitySubstitution)},
 		visibility:                                []string{},
 		testFilePattern:                           strings.Split(DefaultTestFilePatternString, ","),
+		typeStubPattern:                           strings.Split(DefaultTypeStubPatternString, ","),
+		attachStubDepsMode:                        AttachStubDepsRuntime,
+		namingStrategy:                            NamingStrategyLegacy,
 		labelConvention:                           DefaultLabelConvention,
 		labelNormalization:                        DefaultLabelNormalizationType,
 		experimentalAllowRelativeImports:          false,
@@ -261,6 +955,21 @@ func New(
 		generateProto:                             false,
 		resolveSiblingImports:                     false,
 		includeAncestorConftest:                   true,
+		implicitNamespacePackages:                 true,
+		depsOrderMode:                             DepsOrderModeRemove,
+		entryPointPolicies:                        make(map[EntryPointPolicyKind][]string),
+		optionalImportsMode:                       OptionalImportsModeIfAvailable,
+		initFilesMode:                             InitFilesModeNone,
+		testRunner:                                TestRunnerNone,
+		packageDataMode:                           PackageDataModeNone,
+		unresolvedImportsMode:                     UnresolvedImportsModeError,
+		resolveVisibilityMode:                     ResolveVisibilityModeIgnore,
+		resolveConflictPolicy:                     ResolveConflictPolicyError,
+		resolutionScope:                           ResolutionScopeRepository,
+		srcsStrategy:                              SrcsStrategyList,
+		generatedModules:                          make(map[string]label.Label),
+		nativeModules:                             make(map[string]label.Label),
+		opaqueLibraries:                           make(map[string]label.Label),
 	}
 }
 
@@ -285,13 +994,24 @@ func (c *Config) NewChild() *Config {
 		perFileGeneration:            c.perFileGeneration,
 		perFileGenerationIncludeInit: c.perFileGenerationIncludeInit,
 		perPackageGenerationRequireTestEntryPoint: c.perPackageGenerationRequireTestEntryPoint,
+		perFileGenerationMergeCycles:              c.perFileGenerationMergeCycles,
+		perFileGenerationTestUtils:                c.perFileGenerationTestUtils,
+		shebangBinaries:                           c.shebangBinaries,
+		generateWheel:                             c.generateWheel,
+		generateDoctests:                          c.generateDoctests,
 		libraryNamingConvention:                   c.libraryNamingConvention,
 		binaryNamingConvention:                    c.binaryNamingConvention,
 		testNamingConvention:                      c.testNamingConvention,
 		protoNamingConvention:                     c.protoNamingConvention,
 		defaultVisibility:                         c.defaultVisibility,
+		defaultVisibilityDeclared:                 c.defaultVisibilityDeclared,
+		visibilityFile:                            c.visibilityFile,
 		visibility:                                c.visibility,
 		testFilePattern:                           c.testFilePattern,
+		typeStubPattern:                           c.typeStubPattern,
+		attachStubDepsMode:                        c.attachStubDepsMode,
+		toolingFilePattern:                        c.toolingFilePattern,
+		testonlyDirs:                              c.testonlyDirs,
 		labelConvention:                           c.labelConvention,
 		labelNormalization:                        c.labelNormalization,
 		experimentalAllowRelativeImports:          c.experimentalAllowRelativeImports,
@@ -300,6 +1020,52 @@ func (c *Config) NewChild() *Config {
 		generateProto:                             c.generateProto,
 		resolveSiblingImports:                     c.resolveSiblingImports,
 		includeAncestorConftest:                   c.includeAncestorConftest,
+		implicitNamespacePackages:                 c.implicitNamespacePackages,
+		resolveStringAnnotations:                  c.resolveStringAnnotations,
+		flattenSubpackages:                        c.flattenSubpackages,
+		foldSubdirs:                               c.foldSubdirs,
+		initFilesMode:                             c.initFilesMode,
+		testRunner:                                c.testRunner,
+		testRunnerArgs:                            c.testRunnerArgs,
+		generateDepsFile:                          c.generateDepsFile,
+		depsOrderMode:                             c.depsOrderMode,
+		entryPointPolicies:                        c.entryPointPolicies,
+		importWeightBudget:                        c.importWeightBudget,
+		testShardSeconds:                          c.testShardSeconds,
+		testShardFiles:                            c.testShardFiles,
+		testShardCases:                            c.testShardCases,
+		testShardMax:                              c.testShardMax,
+		targetPlatforms:                           c.targetPlatforms,
+		namingStrategy:                            c.namingStrategy,
+		resolveAncestorPkg:                        c.resolveAncestorPkg,
+		pythonVersion:                             c.pythonVersion,
+		pyprojectRepository:                       c.pyprojectRepository,
+		declaredDistributions:                     c.declaredDistributions,
+		optionalImportsMode:                       c.optionalImportsMode,
+		packageDataMode:                           c.packageDataMode,
+		packageDataTarget:                         c.packageDataTarget,
+		unresolvedImportsMode:                     c.unresolvedImportsMode,
+		resolveVisibilityMode:                     c.resolveVisibilityMode,
+		resolveConflictPolicy:                     c.resolveConflictPolicy,
+		resolutionScope:                           c.resolutionScope,
+		srcsStrategy:                              c.srcsStrategy,
+		generatedModules:                          c.generatedModules,
+		nativeModules:                             c.nativeModules,
+		opaqueLibraries:                           c.opaqueLibraries,
+		licenseLabels:                             c.licenseLabels,
+		symbolResolves:                            c.symbolResolves,
+		wildcardResolves:                          c.wildcardResolves,
+		defaultAttrs:                              c.defaultAttrs,
+		pytestMarkers:                             c.pytestMarkers,
+		notebookConverter:                         c.notebookConverter,
+		excludeRegexes:                            c.excludeRegexes,
+		wrapperMacros:                             c.wrapperMacros,
+		facadePackage:                             c.facadePackage,
+		facade:                                    c.facade,
+		binaryEntrypoints:                         c.binaryEntrypoints,
+		generateCython:                            c.generateCython,
+		thirdPartyPrefixes:                        c.thirdPartyPrefixes,
+		externalRepositories:                      c.externalRepositories,
 	}
 }
 
@@ -346,36 +1112,745 @@ func (c *Config) SetGazelleManifestPath(gazelleManifestPath string) {
 	c.gazelleManifestPath = gazelleManifestPath
 }
 
+// InputFiles returns the paths of the files read by the current
+// configuration: the Gazelle manifest, the deps order file, the import
+// weights file and the pyproject.toml file, when they're set.
+func (c *Config) InputFiles() []string {
+	var files []string
+	for _, path := range []string{c.gazelleManifestPath, c.depsOrderPath, c.importWeightsPath, c.pyprojectPath} {
+		if path != "" {
+			files = append(files, path)
+		}
+	}
+	return files
+}
+
+// gazelleManifestMu guards the loading of the Gazelle manifests, which
+// happens when the imports of the rules are concurrently resolved.
+var gazelleManifestMu sync.Mutex
+
+// loadedGazelleManifest returns the Gazelle manifest of the current
+// configuration, loading it if needed. It returns nil when the configuration
+// has no manifest.
+func (c *Config) loadedGazelleManifest() *manifest.Manifest {
+	gazelleManifestMu.Lock()
+	defer gazelleManifestMu.Unlock()
+	if c.gazelleManifestPath != "" && c.gazelleManifest == nil {
+		gazelleManifest, err := loadGazelleManifest(c.gazelleManifestPath)
+		if err != nil {
+			log.Fatal(err)
+		}
+		c.SetGazelleManifest(gazelleManifest)
+	}
+	return c.gazelleManifest
+}
+
 // FindThirdPartyDependency scans the gazelle manifests for the current config
 // and the parent configs up to the root finding if it can resolve the module
-// name.
+// name, first in their modules mappings, then in the modules of the entry
+// points of their distributions. Otherwise, it looks up the distributions
+// declared by the pyproject.toml files, then the python_third_party_prefix
+// directives, in which case the distribution name is empty.
 func (c *Config) FindThirdPartyDependency(modName string) (string, string, bool) {
+	if dep, distributionName, ok := c.findManifestDependency(modName, modulesMapping); ok {
+		return dep, distributionName, true
+	}
+	if dep, distributionName, ok := c.findManifestDependency(modName, entryPoints); ok {
+		return dep, distributionName, true
+	}
+	if distribution, ok := c.declaredDistributions[modName]; ok {
+		lbl := c.FormatThirdPartyDependency(distribution.repository, distribution.name)
+		return lbl.String(), distribution.name, true
+	}
+	if dep, ok := c.findThirdPartyPrefix(modName); ok {
+		return dep, "", true
+	}
+	return "", "", false
+}
+
+// modulesMapping returns the modules mapping of the gazelle manifest.
+func modulesMapping(gazelleManifest *manifest.Manifest) manifest.ModulesMapping {
+	return gazelleManifest.ModulesMapping
+}
+
+// entryPoints returns the modules of the entry points of the gazelle manifest.
+func entryPoints(gazelleManifest *manifest.Manifest) manifest.ModulesMapping {
+	return gazelleManifest.EntryPoints
+}
+
+// findManifestDependency scans the gazelle manifests for the current config
+// and the parent configs up to the root finding if the mapping returned by
+// mapping maps the module name.
+func (c *Config) findManifestDependency(modName string, mapping func(*manifest.Manifest) manifest.ModulesMapping) (string, string, bool) {
 	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
-		// Attempt to load the manifest if needed.
-		if currentCfg.gazelleManifestPath != "" && currentCfg.gazelleManifest == nil {
-			currentCfgManifest, err := loadGazelleManifest(currentCfg.gazelleManifestPath)
+		if gazelleManifest := currentCfg.loadedGazelleManifest(); gazelleManifest != nil {
+			if distributionName, ok := mapping(gazelleManifest)[modName]; ok {
+				lbl := currentCfg.FormatThirdPartyDependency(distributionRepositoryName(gazelleManifest), distributionName)
+				return lbl.String(), distributionName, true
+			}
+		}
+	}
+	return "", "", false
+}
+
+// distributionRepositoryName returns the name of the pip repository of the
+// gazelle manifest.
+func distributionRepositoryName(gazelleManifest *manifest.Manifest) string {
+	if gazelleManifest.PipDepsRepositoryName != "" {
+		return gazelleManifest.PipDepsRepositoryName
+	}
+	if gazelleManifest.PipRepository != nil {
+		return gazelleManifest.PipRepository.Name
+	}
+	return ""
+}
+
+// ExtrasDependencies returns the sorted labels of the distributions whose
+// extras, as listed in the closest gazelle manifest listing extras, require
+// the given distribution, e.g. requests for PySocks with requests[socks].
+func (c *Config) ExtrasDependencies(distributionName string) []string {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		gazelleManifest := currentCfg.loadedGazelleManifest()
+		if gazelleManifest == nil || len(gazelleManifest.Extras) == 0 {
+			continue
+		}
+		var deps []string
+		for base, extras := range gazelleManifest.Extras {
+			if requiredByExtras(distributionName, extras) {
+				lbl := currentCfg.FormatThirdPartyDependency(distributionRepositoryName(gazelleManifest), base)
+				deps = append(deps, lbl.String())
+			}
+		}
+		sort.Strings(deps)
+		return deps
+	}
+	return nil
+}
+
+// requiredByExtras returns whether one of the extras requires the
+// distribution.
+func requiredByExtras(distributionName string, extras map[string][]string) bool {
+	for _, distributions := range extras {
+		for _, distribution := range distributions {
+			if NormalizeDistributionName(distribution) == NormalizeDistributionName(distributionName) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// DistributionLicenses returns the licenses of the distribution listed in the
+// closest gazelle manifest listing it.
+func (c *Config) DistributionLicenses(distributionName string) []string {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if gazelleManifest := currentCfg.loadedGazelleManifest(); gazelleManifest != nil {
+			if licenses, ok := gazelleManifest.Licenses[distributionName]; ok {
+				return licenses
+			}
+		}
+	}
+	return nil
+}
+
+// DistributionModules maps the distributions listed in the gazelle manifests
+// of the current config and the parent configs to their top-level modules,
+// i.e. the modules whose parent modules aren't provided by the same
+// distribution, sorted.
+func (c *Config) DistributionModules() map[string][]string {
+	distributions := make(map[string]string)
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		gazelleManifest := currentCfg.loadedGazelleManifest()
+		if gazelleManifest == nil {
+			continue
+		}
+		for modName, distributionName := range gazelleManifest.ModulesMapping {
+			// The closest manifest takes precedence, as when resolving.
+			if _, ok := distributions[modName]; !ok {
+				distributions[modName] = distributionName
+			}
+		}
+	}
+	modules := make(map[string][]string)
+	for modName, distributionName := range distributions {
+		topLevel := true
+		parts := strings.Split(modName, ".")
+		for i := 1; i < len(parts); i++ {
+			if distributions[strings.Join(parts[:i], ".")] == distributionName {
+				topLevel = false
+				break
+			}
+		}
+		if topLevel {
+			modules[distributionName] = append(modules[distributionName], modName)
+		}
+	}
+	for _, modNames := range modules {
+		sort.Strings(modNames)
+	}
+	return modules
+}
+
+// thirdPartyPrefix is a module prefix mapped to a label template by the
+// python_third_party_prefix directive declared in the package pkg.
+type thirdPartyPrefix struct {
+	prefix   string
+	template string
+	pkg      string
+}
+
+// AddThirdPartyPrefix maps the imports under the module prefix to the label
+// template, relative to the package pkg declaring it.
+func (c *Config) AddThirdPartyPrefix(prefix, template, pkg string) {
+	prefixes := make([]thirdPartyPrefix, len(c.thirdPartyPrefixes), len(c.thirdPartyPrefixes)+1)
+	copy(prefixes, c.thirdPartyPrefixes)
+	c.thirdPartyPrefixes = append(prefixes, thirdPartyPrefix{prefix: prefix, template: template, pkg: pkg})
+}
+
+// ExternalRepositoryCheckout is an external Gazelle-managed repository whose
+// py_library targets are indexed from its checkout, see ExternalRepository.
+type ExternalRepositoryCheckout struct {
+	// Name is the apparent name of the repository, e.g. "shared".
+	Name string
+	// Path is the absolute path to the checkout of the repository.
+	Path string
+}
+
+// AddExternalRepository indexes the external repository name from its
+// checkout at path, replacing the checkout of a parent package for the same
+// repository.
+func (c *Config) AddExternalRepository(name, path string) {
+	repositories := make([]ExternalRepositoryCheckout, 0, len(c.externalRepositories)+1)
+	for _, r := range c.externalRepositories {
+		if r.Name != name {
+			repositories = append(repositories, r)
+		}
+	}
+	c.externalRepositories = append(repositories, ExternalRepositoryCheckout{Name: name, Path: path})
+}
+
+// ExternalRepositories returns the external repositories indexed for the
+// resolution, in the order of their declaration.
+func (c *Config) ExternalRepositories() []ExternalRepositoryCheckout {
+	return c.externalRepositories
+}
+
+// findThirdPartyPrefix returns the label computed from the template of the
+// longest module prefix of the module name, the last declared one on a tie.
+// The modules whose parent modules, down to the prefix, are mapped by a gazelle
+// manifest are left to the manifest.
+func (c *Config) findThirdPartyPrefix(modName string) (string, bool) {
+	var match *thirdPartyPrefix
+	for i, p := range c.thirdPartyPrefixes {
+		if modName != p.prefix && !strings.HasPrefix(modName, p.prefix+".") {
+			continue
+		}
+		if match == nil || len(p.prefix) >= len(match.prefix) {
+			match = &c.thirdPartyPrefixes[i]
+		}
+	}
+	if match == nil {
+		return "", false
+	}
+	parts := strings.Split(modName, ".")
+	for i := len(parts) - 1; i > strings.Count(match.prefix, "."); i-- {
+		if _, _, ok := c.findManifestDependency(strings.Join(parts[:i], "."), modulesMapping); ok {
+			return "", false
+		}
+	}
+	module, _, _ := strings.Cut(strings.TrimPrefix(strings.TrimPrefix(modName, match.prefix), "."), ".")
+	if module == "" && strings.Contains(match.template, ThirdPartyPrefixModuleSubstitution) {
+		return "", false
+	}
+	l, err := label.Parse(strings.ReplaceAll(match.template, ThirdPartyPrefixModuleSubstitution, module))
+	if err != nil {
+		return "", false
+	}
+	return l.Abs("", match.pkg).String(), true
+}
+
+// SetDistributionTests sets the file running the smoke tests of the
+// distributions generated in the current package.
+func (c *Config) SetDistributionTests(filename string) {
+	c.distributionTests = filename
+}
+
+// DistributionTests returns the file running the smoke tests of the
+// distributions generated in the current package, or an empty string.
+func (c *Config) DistributionTests() string {
+	return c.distributionTests
+}
+
+// SetDepsOrderPath sets the path to the deps order file for the current
+// configuration.
+func (c *Config) SetDepsOrderPath(depsOrderPath string) {
+	c.depsOrderPath = depsOrderPath
+	c.depsOrder = nil
+}
+
+// DepsOrder returns the layers declared by the closest python_deps_order_file
+// directive, loading the file if needed. It returns nil when no deps order
+// file applies to the current configuration.
+func (c *Config) DepsOrder() *DepsOrder {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.depsOrderPath == "" {
+			continue
+		}
+		if currentCfg.depsOrder == nil {
+			depsOrder, err := LoadDepsOrder(currentCfg.depsOrderPath)
 			if err != nil {
 				log.Fatal(err)
 			}
-			currentCfg.SetGazelleManifest(currentCfgManifest)
+			currentCfg.depsOrder = depsOrder
 		}
+		return currentCfg.depsOrder
+	}
+	return nil
+}
 
-		if currentCfg.gazelleManifest != nil {
-			gazelleManifest := currentCfg.gazelleManifest
-			if distributionName, ok := gazelleManifest.ModulesMapping[modName]; ok {
-				var distributionRepositoryName string
-				if gazelleManifest.PipDepsRepositoryName != "" {
-					distributionRepositoryName = gazelleManifest.PipDepsRepositoryName
-				} else if gazelleManifest.PipRepository != nil {
-					distributionRepositoryName = gazelleManifest.PipRepository.Name
-				}
+// SetImportWeightsPath sets the path to the import weights file for the
+// current configuration.
+func (c *Config) SetImportWeightsPath(importWeightsPath string) {
+	c.importWeightsPath = importWeightsPath
+	c.importWeights = nil
+}
 
-				lbl := currentCfg.FormatThirdPartyDependency(distributionRepositoryName, distributionName)
-				return lbl.String(), distributionName, true
+// ImportWeights returns the weights declared by the closest
+// python_import_weights_file directive, loading the file if needed. It returns
+// nil when no import weights file applies to the current configuration.
+func (c *Config) ImportWeights() *ImportWeights {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.importWeightsPath == "" {
+			continue
+		}
+		if currentCfg.importWeights == nil {
+			importWeights, err := LoadImportWeights(currentCfg.importWeightsPath)
+			if err != nil {
+				log.Fatal(err)
 			}
+			currentCfg.importWeights = importWeights
 		}
+		return currentCfg.importWeights
 	}
-	return "", "", false
+	return nil
+}
+
+// SetImportWeightBudget sets the maximum weight of the distributions imported
+// by a binary. Zero means no budget.
+func (c *Config) SetImportWeightBudget(budget int) {
+	c.importWeightBudget = budget
+}
+
+// ImportWeightBudget returns the maximum weight of the distributions imported
+// by a binary, or zero when there is no budget.
+func (c *Config) ImportWeightBudget() int {
+	return c.importWeightBudget
+}
+
+// SetTestTimingsPath sets the path to the test timings file for the current
+// configuration.
+func (c *Config) SetTestTimingsPath(testTimingsPath string) {
+	c.testTimingsPath = testTimingsPath
+	c.testTimings = nil
+}
+
+// TestTimings returns the timings declared by the closest
+// python_test_timings_file directive, loading the file if needed. It returns
+// nil when no test timings file applies to the current configuration.
+func (c *Config) TestTimings() *TestTimings {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.testTimingsPath == "" {
+			continue
+		}
+		if currentCfg.testTimings == nil {
+			testTimings, err := LoadTestTimings(currentCfg.testTimingsPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			currentCfg.testTimings = testTimings
+		}
+		return currentCfg.testTimings
+	}
+	return nil
+}
+
+// SetTestShardSeconds sets the duration, in seconds, of the shards of the
+// test targets with timings. Zero disables the timing-based sharding.
+func (c *Config) SetTestShardSeconds(seconds int) {
+	c.testShardSeconds = seconds
+}
+
+// TestShardSeconds returns the duration, in seconds, of the shards of the
+// test targets with timings, or zero when the timing-based sharding is
+// disabled.
+func (c *Config) TestShardSeconds() int {
+	return c.testShardSeconds
+}
+
+// SetTestShardFiles sets the number of test files of the shards of the test
+// targets without timings. Zero disables the file-based sharding.
+func (c *Config) SetTestShardFiles(files int) {
+	c.testShardFiles = files
+}
+
+// TestShardFiles returns the number of test files of the shards of the test
+// targets without timings, or zero when the file-based sharding is disabled.
+func (c *Config) TestShardFiles() int {
+	return c.testShardFiles
+}
+
+// SetTestShardCases sets the number of test cases of the shards of the test
+// targets without timings. Zero disables the case-based sharding.
+func (c *Config) SetTestShardCases(cases int) {
+	c.testShardCases = cases
+}
+
+// TestShardCases returns the number of test cases of the shards of the test
+// targets without timings, or zero when the case-based sharding is disabled.
+func (c *Config) TestShardCases() int {
+	return c.testShardCases
+}
+
+// SetTestShardMax sets the maximum shard_count of the test targets. Zero
+// doesn't bound it.
+func (c *Config) SetTestShardMax(maxCount int) {
+	c.testShardMax = maxCount
+}
+
+// TestShardMax returns the maximum shard_count of the test targets, or zero
+// when it isn't bounded.
+func (c *Config) TestShardMax() int {
+	return c.testShardMax
+}
+
+// SetWheelLockPath sets the path to the wheel lock file for the current
+// configuration.
+func (c *Config) SetWheelLockPath(wheelLockPath string) {
+	c.wheelLockPath = wheelLockPath
+	c.wheelLock = nil
+}
+
+// WheelLock returns the wheels and the sdists listed in the lock file of the
+// closest python_wheel_lock_file directive, loading the file if needed. It
+// returns nil when no wheel lock file applies to the current configuration.
+func (c *Config) WheelLock() *WheelLock {
+	for currentCfg := c; currentCfg != nil; currentCfg = currentCfg.parent {
+		if currentCfg.wheelLockPath == "" {
+			continue
+		}
+		if currentCfg.wheelLock == nil {
+			wheelLock, err := LoadWheelLock(currentCfg.wheelLockPath)
+			if err != nil {
+				log.Fatal(err)
+			}
+			currentCfg.wheelLock = wheelLock
+		}
+		return currentCfg.wheelLock
+	}
+	return nil
+}
+
+// SetTargetPlatforms sets the platforms the third-party distributions are
+// installed on.
+func (c *Config) SetTargetPlatforms(platforms []TargetPlatform) {
+	c.targetPlatforms = platforms
+}
+
+// TargetPlatforms returns the platforms the third-party distributions are
+// installed on.
+func (c *Config) TargetPlatforms() []TargetPlatform {
+	return c.targetPlatforms
+}
+
+// SetDepsOrderMode sets how violations of the deps order are handled.
+func (c *Config) SetDepsOrderMode(depsOrderMode DepsOrderModeType) {
+	c.depsOrderMode = depsOrderMode
+}
+
+// DepsOrderMode returns how violations of the deps order are handled.
+func (c *Config) DepsOrderMode() DepsOrderModeType {
+	return c.depsOrderMode
+}
+
+// SetOptionalImportsMode sets how the optional imports are resolved.
+func (c *Config) SetOptionalImportsMode(optionalImportsMode OptionalImportsModeType) {
+	c.optionalImportsMode = optionalImportsMode
+}
+
+// OptionalImportsMode returns how the optional imports are resolved.
+func (c *Config) OptionalImportsMode() OptionalImportsModeType {
+	return c.optionalImportsMode
+}
+
+// SetPackageData sets how the package data files are added to the targets,
+// and the name of the target added by PackageDataModeTarget.
+func (c *Config) SetPackageData(packageDataMode PackageDataModeType, packageDataTarget string) {
+	c.packageDataMode = packageDataMode
+	c.packageDataTarget = packageDataTarget
+}
+
+// PackageDataMode returns how the package data files are added to the
+// targets.
+func (c *Config) PackageDataMode() PackageDataModeType {
+	return c.packageDataMode
+}
+
+// PackageDataTarget returns the name of the target added by
+// PackageDataModeTarget.
+func (c *Config) PackageDataTarget() string {
+	return c.packageDataTarget
+}
+
+// SetUnresolvedImportsMode sets how the unresolved imports are handled.
+func (c *Config) SetUnresolvedImportsMode(unresolvedImportsMode UnresolvedImportsModeType) {
+	c.unresolvedImportsMode = unresolvedImportsMode
+}
+
+// UnresolvedImportsMode returns how the unresolved imports are handled.
+func (c *Config) UnresolvedImportsMode() UnresolvedImportsModeType {
+	return c.unresolvedImportsMode
+}
+
+// SetResolveVisibilityMode sets how the visibility of the first-party targets
+// is taken into account when resolving the imports.
+func (c *Config) SetResolveVisibilityMode(resolveVisibilityMode ResolveVisibilityModeType) {
+	c.resolveVisibilityMode = resolveVisibilityMode
+}
+
+// ResolveVisibilityMode returns how the visibility of the first-party targets
+// is taken into account when resolving the imports.
+func (c *Config) ResolveVisibilityMode() ResolveVisibilityModeType {
+	return c.resolveVisibilityMode
+}
+
+// SetResolveConflictPolicy sets how an import is resolved when several
+// first-party targets provide its module.
+func (c *Config) SetResolveConflictPolicy(resolveConflictPolicy ResolveConflictPolicyType) {
+	c.resolveConflictPolicy = resolveConflictPolicy
+}
+
+// ResolveConflictPolicy returns how an import is resolved when several
+// first-party targets provide its module.
+func (c *Config) ResolveConflictPolicy() ResolveConflictPolicyType {
+	return c.resolveConflictPolicy
+}
+
+// SetResolutionScope sets which first-party targets an import may resolve to.
+func (c *Config) SetResolutionScope(resolutionScope ResolutionScopeType) {
+	c.resolutionScope = resolutionScope
+}
+
+// ResolutionScope returns which first-party targets an import may resolve
+// to.
+func (c *Config) ResolutionScope() ResolutionScopeType {
+	return c.resolutionScope
+}
+
+// AddGeneratedModule records that the module is generated by the target with
+// the given absolute label. The module is visible from every package.
+func (c *Config) AddGeneratedModule(module string, target label.Label) {
+	c.generatedModules[module] = target
+}
+
+// GeneratedModules returns the generated modules recorded so far, mapped to
+// the absolute labels of the targets generating them.
+func (c *Config) GeneratedModules() map[string]label.Label {
+	return c.generatedModules
+}
+
+// FindGeneratedModule returns the absolute label of the target generating the
+// module, if any.
+func (c *Config) FindGeneratedModule(module string) (label.Label, bool) {
+	target, ok := c.generatedModules[module]
+	return target, ok
+}
+
+// AddNativeModule records that the native extension module is built by the
+// target with the given absolute label. The module is visible from every
+// package.
+func (c *Config) AddNativeModule(module string, target label.Label) {
+	c.nativeModules[module] = target
+}
+
+// NativeModules returns the native extension modules recorded so far, mapped
+// to the absolute labels of the targets building them.
+func (c *Config) NativeModules() map[string]label.Label {
+	return c.nativeModules
+}
+
+// FindNativeModule returns the absolute label of the target building the
+// native extension module, if any.
+func (c *Config) FindNativeModule(module string) (label.Label, bool) {
+	target, ok := c.nativeModules[module]
+	return target, ok
+}
+
+// AddOpaqueLibrary records that the module and its submodules are provided by
+// the target with the given absolute label, the only one of its directory.
+// The module is visible from every package.
+func (c *Config) AddOpaqueLibrary(module string, target label.Label) {
+	c.opaqueLibraries[module] = target
+}
+
+// FindOpaqueLibrary returns the absolute label of the opaque library providing
+// the module, if any, and the module of the library. The innermost library
+// wins when they're nested.
+func (c *Config) FindOpaqueLibrary(module string) (label.Label, string, bool) {
+	for prefix := module; prefix != ""; {
+		if target, ok := c.opaqueLibraries[prefix]; ok {
+			return target, prefix, true
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return label.NoLabel, "", false
+}
+
+// IsOpaquePackage returns whether the Bazel package is in the directory of an
+// opaque library, whose targets are neither generated nor indexed.
+func (c *Config) IsOpaquePackage(pkg string) bool {
+	for _, target := range c.opaqueLibraries {
+		if pkg == target.Pkg || strings.HasPrefix(pkg, target.Pkg+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// SetLicenseLabel maps the license to the absolute label of its license
+// metadata target.
+func (c *Config) SetLicenseLabel(license string, target label.Label) {
+	labels := make(map[string]label.Label, len(c.licenseLabels)+1)
+	for k, v := range c.licenseLabels {
+		labels[k] = v
+	}
+	labels[license] = target
+	c.licenseLabels = labels
+}
+
+// LicenseLabel returns the absolute label of the license metadata target of
+// the license, if it is mapped.
+func (c *Config) LicenseLabel(license string) (label.Label, bool) {
+	target, ok := c.licenseLabels[license]
+	return target, ok
+}
+
+// SetSymbolResolve resolves the symbol imported from the module to the
+// absolute label of the target.
+func (c *Config) SetSymbolResolve(module, symbol string, target label.Label) {
+	resolves := make(map[string]label.Label, len(c.symbolResolves)+1)
+	for k, v := range c.symbolResolves {
+		resolves[k] = v
+	}
+	resolves[module+":"+symbol] = target
+	c.symbolResolves = resolves
+}
+
+// FindSymbolResolve returns the absolute label of the target that the symbol
+// imported from the module resolves to, if any.
+func (c *Config) FindSymbolResolve(module, symbol string) (label.Label, bool) {
+	target, ok := c.symbolResolves[module+":"+symbol]
+	return target, ok
+}
+
+// SetWildcardResolve resolves the modules under the prefix, and the prefix
+// itself, to the absolute label of the target.
+func (c *Config) SetWildcardResolve(prefix string, target label.Label) {
+	resolves := make(map[string]label.Label, len(c.wildcardResolves)+1)
+	for k, v := range c.wildcardResolves {
+		resolves[k] = v
+	}
+	resolves[prefix] = target
+	c.wildcardResolves = resolves
+}
+
+// FindWildcardResolve returns the absolute label of the target that the
+// module resolves to through a wildcard resolve directive, if any, and the
+// prefix of the directive. The longest prefix wins when they're nested.
+func (c *Config) FindWildcardResolve(module string) (label.Label, string, bool) {
+	for prefix := module; prefix != ""; {
+		if target, ok := c.wildcardResolves[prefix]; ok {
+			return target, prefix, true
+		}
+		i := strings.LastIndex(prefix, ".")
+		if i < 0 {
+			break
+		}
+		prefix = prefix[:i]
+	}
+	return label.NoLabel, "", false
+}
+
+// declaredDistribution is a distribution declared by the dependencies of a
+// pyproject.toml, see PyprojectDependencies.
+type declaredDistribution struct {
+	repository string
+	name       string
+}
+
+// SetPyprojectRepository sets the pip repository of the dependencies of the
+// pyproject.toml files. An empty name turns off reading them.
+func (c *Config) SetPyprojectRepository(repository string) {
+	c.pyprojectRepository = repository
+}
+
+// PyprojectRepository returns the pip repository of the dependencies of the
+// pyproject.toml files, or an empty string when they aren't read.
+func (c *Config) PyprojectRepository() string {
+	return c.pyprojectRepository
+}
+
+// SetPyprojectPath sets the path of the pyproject.toml file of the package,
+// whose dependencies are read, see PyprojectDependencies.
+func (c *Config) SetPyprojectPath(pyprojectPath string) {
+	c.pyprojectPath = pyprojectPath
+}
+
+// AddDeclaredDistributions resolves the imports of the modules named after
+// the distributions, e.g. typing_extensions for typing-extensions, to their
+// targets in the pip repository. The names of the distributions whose
+// modules are named differently, e.g. PyYAML, are left to the gazelle
+// manifests and the resolve directives.
+func (c *Config) AddDeclaredDistributions(repository string, names []string) {
+	distributions := make(map[string]declaredDistribution, len(c.declaredDistributions)+len(names))
+	for k, v := range c.declaredDistributions {
+		distributions[k] = v
+	}
+	for _, name := range names {
+		module := strings.Trim(distributionNameSeparatorRe.ReplaceAllString(strings.ToLower(name), "_"), "_")
+		distributions[module] = declaredDistribution{repository: repository, name: name}
+	}
+	c.declaredDistributions = distributions
+}
+
+// HasLicenseLabels returns whether any license is mapped to a label.
+func (c *Config) HasLicenseLabels() bool {
+	return len(c.licenseLabels) > 0
+}
+
+// SetEntryPointPolicy restricts the generation of the given kind of targets to
+// the packages containing at least one of the entry files. An empty list of
+// entry files removes the restriction.
+func (c *Config) SetEntryPointPolicy(kind EntryPointPolicyKind, entryFiles []string) {
+	policies := make(map[EntryPointPolicyKind][]string, len(c.entryPointPolicies)+1)
+	for k, v := range c.entryPointPolicies {
+		policies[k] = v
+	}
+	if len(entryFiles) == 0 {
+		delete(policies, kind)
+	} else {
+		policies[kind] = entryFiles
+	}
+	c.entryPointPolicies = policies
+}
+
+// EntryPointPolicy returns the entry files required to generate the given kind
+// of targets, or nil if there is no restriction.
+func (c *Config) EntryPointPolicy(kind EntryPointPolicyKind) []string {
+	return c.entryPointPolicies[kind]
 }
 
 // AddIgnoreFile adds a file to the list of ignored files for a given package.
@@ -493,6 +1968,80 @@ func (c *Config) PerPackageGenerationRequireTestEntryPoint() bool {
 	return c.perPackageGenerationRequireTestEntryPoint
 }
 
+// SetPerFileGenerationMergeCycles sets whether the files importing each other
+// in a cycle are merged into a single target in per-file generation.
+func (c *Config) SetPerFileGenerationMergeCycles(mergeCycles bool) {
+	c.perFileGenerationMergeCycles = mergeCycles
+}
+
+// PerFileGenerationMergeCycles returns whether the files importing each other
+// in a cycle are merged into a single target in per-file generation.
+func (c *Config) PerFileGenerationMergeCycles() bool {
+	return c.perFileGenerationMergeCycles
+}
+
+// SetPerFileGenerationTestUtils sets whether the conftest.py file and the
+// helpers of the tests are grouped into a testutils target in per-file
+// generation.
+func (c *Config) SetPerFileGenerationTestUtils(testUtils bool) {
+	c.perFileGenerationTestUtils = testUtils
+}
+
+// PerFileGenerationTestUtils returns whether the conftest.py file and the
+// helpers of the tests are grouped into a testutils target in per-file
+// generation.
+func (c *Config) PerFileGenerationTestUtils() bool {
+	return c.perFileGenerationTestUtils
+}
+
+// SetShebangBinaries sets whether the files starting with a Python shebang
+// line get a py_binary like the ones with a __main__ guard.
+func (c *Config) SetShebangBinaries(shebangBinaries bool) {
+	c.shebangBinaries = shebangBinaries
+}
+
+// ShebangBinaries returns whether the files starting with a Python shebang
+// line get a py_binary like the ones with a __main__ guard.
+func (c *Config) ShebangBinaries() bool {
+	return c.shebangBinaries
+}
+
+// SetGenerateWheel sets whether a py_wheel and a py_package are generated
+// from the [project] metadata of the pyproject.toml files.
+func (c *Config) SetGenerateWheel(generateWheel bool) {
+	c.generateWheel = generateWheel
+}
+
+// GenerateWheel returns whether a py_wheel and a py_package are generated
+// from the [project] metadata of the pyproject.toml files.
+func (c *Config) GenerateWheel() bool {
+	return c.generateWheel
+}
+
+// SetGenerateDoctests sets whether a py_test running the doctests of each
+// module with examples in its docstrings is generated.
+func (c *Config) SetGenerateDoctests(generateDoctests bool) {
+	c.generateDoctests = generateDoctests
+}
+
+// GenerateDoctests returns whether a py_test running the doctests of each
+// module with examples in its docstrings is generated.
+func (c *Config) GenerateDoctests() bool {
+	return c.generateDoctests
+}
+
+// SetSrcsStrategy sets how the srcs of the generated py_library targets are
+// written.
+func (c *Config) SetSrcsStrategy(srcsStrategy SrcsStrategyType) {
+	c.srcsStrategy = srcsStrategy
+}
+
+// SrcsStrategy returns how the srcs of the generated py_library targets are
+// written.
+func (c *Config) SrcsStrategy() SrcsStrategyType {
+	return c.srcsStrategy
+}
+
 // SetLibraryNamingConvention sets the py_library target naming convention.
 func (c *Config) SetLibraryNamingConvention(libraryNamingConvention string) {
 	c.libraryNamingConvention = libraryNamingConvention
@@ -542,14 +2091,61 @@ func (c *Config) AppendVisibility(visibility string) {
 	c.visibility = append(c.visibility, visibility)
 }
 
-// Visibility returns the target's visibility.
+// Visibility returns the target's visibility, as declared by the directives.
+// The labels can contain the $python_root$ and $package$ placeholders, see
+// PackageVisibility.
 func (c *Config) Visibility() []string {
 	return append(c.defaultVisibility, c.visibility...)
 }
 
+// PackageVisibility returns the visibility of the targets generated in the
+// given package. The $python_root$ placeholder is replaced by the python_root
+// of the package, and $package$ by the package itself, so that a visibility
+// declared once applies to every project below it. Unless the
+// python_default_visibility directive applies to the package, the visibility
+// of the first rule of the python-visibility.yaml file matching the package
+// replaces the default visibility.
+func (c *Config) PackageVisibility(pkg string) []string {
+	replacer := strings.NewReplacer(
+		pythonRootVisibilitySubstitution, c.PythonProjectRoot(),
+		packageVisibilitySubstitution, pkg,
+	)
+	visibility := c.Visibility()
+	if c.visibilityFile != nil && !c.defaultVisibilityDeclared {
+		if fileVisibility, ok := c.visibilityFile.VisibilityForPackage(pkg); ok {
+			visibility = append(append([]string{}, fileVisibility...), c.visibility...)
+		}
+	}
+	expanded := make([]string, 0, len(visibility))
+	for _, label := range visibility {
+		expanded = append(expanded, replacer.Replace(label))
+	}
+	return expanded
+}
+
+// HasVisibilityPlaceholder returns whether any of the labels contains a
+// placeholder expanded by PackageVisibility.
+func HasVisibilityPlaceholder(labels []string) bool {
+	for _, label := range labels {
+		if strings.Contains(label, pythonRootVisibilitySubstitution) || strings.Contains(label, packageVisibilitySubstitution) {
+			return true
+		}
+	}
+	return false
+}
+
 // SetDefaultVisibility sets the default visibility of the target.
 func (c *Config) SetDefaultVisibility(visibility []string) {
 	c.defaultVisibility = visibility
+	c.defaultVisibilityDeclared = false
+}
+
+// DeclareDefaultVisibility sets the default visibility of the target as
+// declared by the python_default_visibility directive, which takes precedence
+// over the python-visibility.yaml file.
+func (c *Config) DeclareDefaultVisibility(visibility []string) {
+	c.defaultVisibility = visibility
+	c.defaultVisibilityDeclared = true
 }
 
 // DefaultVisibilty returns the target's default visibility.
@@ -557,6 +2153,11 @@ func (c *Config) DefaultVisibilty() []string {
 	return c.defaultVisibility
 }
 
+// SetVisibilityFile sets the python-visibility.yaml file of the repository.
+func (c *Config) SetVisibilityFile(visibilityFile *VisibilityFile) {
+	c.visibilityFile = visibilityFile
+}
+
 // SetTestFilePattern sets the file patterns that should be mapped to 'py_test' rules.
 func (c *Config) SetTestFilePattern(patterns []string) {
 	c.testFilePattern = patterns
@@ -567,6 +2168,275 @@ func (c *Config) TestFilePattern() []string {
 	return c.testFilePattern
 }
 
+// SetTypeStubPattern sets the patterns of the modules of the type stub
+// packages, with the $distribution_name$ placeholder.
+func (c *Config) SetTypeStubPattern(patterns []string) {
+	c.typeStubPattern = patterns
+}
+
+// TypeStubModules returns the modules probed in the gazelle manifests for the
+// type stub packages of the distribution. They're normalized like the names of
+// the stub wheels in the manifests, e.g. the PEP 561 "foo-stubs" package is
+// probed as "foo_stubs".
+func (c *Config) TypeStubModules(distributionName string) []string {
+	modules := make([]string, 0, len(c.typeStubPattern))
+	for _, pattern := range c.typeStubPattern {
+		module := strings.ReplaceAll(pattern, distributionNameLabelConventionSubstitution, distributionName)
+		module = typeStubSeparators.ReplaceAllString(strings.ToLower(module), "_")
+		modules = append(modules, module)
+	}
+	return modules
+}
+
+// SetAttachStubDepsMode sets how the type stub packages of the imported
+// distributions are added to the dependencies.
+func (c *Config) SetAttachStubDepsMode(mode AttachStubDepsModeType) {
+	c.attachStubDepsMode = mode
+}
+
+// AttachStubDepsMode returns how the type stub packages of the imported
+// distributions are added to the dependencies.
+func (c *Config) AttachStubDepsMode() AttachStubDepsModeType {
+	return c.attachStubDepsMode
+}
+
+// AttachesStubDeps returns whether the type stub packages of the imported
+// distributions are looked up, according to the attach stub deps mode and to
+// python_generate_pyi_deps.
+func (c *Config) AttachesStubDeps() bool {
+	switch c.attachStubDepsMode {
+	case AttachStubDepsNever:
+		return false
+	case AttachStubDepsPyiOnly:
+		return c.generatePyiDeps
+	}
+	return true
+}
+
+// typeStubSeparators matches the runs of separators replaced by an underscore
+// in the names of the stub wheels.
+var typeStubSeparators = regexp.MustCompile(`[-_.]+`)
+
+// SetToolingFilePattern sets the patterns of the tooling files, which aren't
+// registered as importable modules.
+func (c *Config) SetToolingFilePattern(patterns []string) {
+	c.toolingFilePattern = patterns
+}
+
+// ToolingFilePattern returns the patterns of the tooling files, which aren't
+// registered as importable modules.
+func (c *Config) ToolingFilePattern() []string {
+	return c.toolingFilePattern
+}
+
+// SetTestonlyDirs sets the names of the directories whose libraries and
+// binaries are testonly.
+func (c *Config) SetTestonlyDirs(dirs []string) {
+	c.testonlyDirs = dirs
+}
+
+// TestonlyDirs returns the names of the directories whose libraries and
+// binaries are testonly.
+func (c *Config) TestonlyDirs() []string {
+	return c.testonlyDirs
+}
+
+// IsTestonlyPackage returns whether the package rel is in one of the testonly
+// directories, i.e. whether one of its path components is named after them.
+func (c *Config) IsTestonlyPackage(rel string) bool {
+	if len(c.testonlyDirs) == 0 || rel == "" {
+		return false
+	}
+	for _, component := range strings.Split(rel, "/") {
+		for _, dir := range c.testonlyDirs {
+			if component == dir {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// SetDefaultAttr sets the attribute of the generated rules of the kind to the
+// value, a Starlark expression, or removes it for an empty value.
+func (c *Config) SetDefaultAttr(kind, attr, value string) {
+	defaultAttrs := make(map[string]map[string]string, len(c.defaultAttrs)+1)
+	for k, v := range c.defaultAttrs {
+		defaultAttrs[k] = v
+	}
+	attrs := make(map[string]string, len(defaultAttrs[kind])+1)
+	for k, v := range defaultAttrs[kind] {
+		attrs[k] = v
+	}
+	if value == "" {
+		delete(attrs, attr)
+	} else {
+		attrs[attr] = value
+	}
+	defaultAttrs[kind] = attrs
+	c.defaultAttrs = defaultAttrs
+}
+
+// DefaultAttrs returns the values of the attributes set on the generated
+// rules of the kind, by attribute.
+func (c *Config) DefaultAttrs(kind string) map[string]string {
+	return c.defaultAttrs[kind]
+}
+
+// SetPytestMarker maps the pytest marker to the tags and the size of the
+// py_test targets applying it.
+func (c *Config) SetPytestMarker(name string, marker PytestMarkerAttrs) {
+	markers := make(map[string]PytestMarkerAttrs, len(c.pytestMarkers)+1)
+	for k, v := range c.pytestMarkers {
+		markers[k] = v
+	}
+	markers[name] = marker
+	c.pytestMarkers = markers
+}
+
+// PytestMarker returns the tags and the size of the py_test targets applying
+// the pytest marker, if it is mapped.
+func (c *Config) PytestMarker(name string) (PytestMarkerAttrs, bool) {
+	marker, ok := c.pytestMarkers[name]
+	return marker, ok
+}
+
+// SetNotebookConverter sets the tool converting the Jupyter notebooks, or
+// label.NoLabel to disable the notebooks.
+func (c *Config) SetNotebookConverter(converter label.Label) {
+	c.notebookConverter = converter
+}
+
+// NotebookConverter returns the tool converting the Jupyter notebooks, or
+// label.NoLabel when the notebooks aren't converted.
+func (c *Config) NotebookConverter() label.Label {
+	return c.notebookConverter
+}
+
+// AddWrapperMacro adds a macro wrapping a kind of the extension, replacing the
+// former macro of the kind.
+func (c *Config) AddWrapperMacro(macro WrapperMacroInfo) {
+	macros := make([]WrapperMacroInfo, 0, len(c.wrapperMacros)+1)
+	for _, m := range c.wrapperMacros {
+		if m.Kind != macro.Kind {
+			macros = append(macros, m)
+		}
+	}
+	c.wrapperMacros = append(macros, macro)
+}
+
+// WrapperMacros returns the macros wrapping the kinds of the extension.
+func (c *Config) WrapperMacros() []WrapperMacroInfo {
+	return c.wrapperMacros
+}
+
+// WrapperMacroOfKind returns the macro wrapping the kind, if any.
+func (c *Config) WrapperMacroOfKind(kind string) (WrapperMacroInfo, bool) {
+	for _, m := range c.wrapperMacros {
+		if m.Kind == kind {
+			return m, true
+		}
+	}
+	return WrapperMacroInfo{}, false
+}
+
+// WrapperMacro returns the wrapper macro with the given name, if any.
+func (c *Config) WrapperMacro(macro string) (WrapperMacroInfo, bool) {
+	for _, m := range c.wrapperMacros {
+		if m.Macro == macro {
+			return m, true
+		}
+	}
+	return WrapperMacroInfo{}, false
+}
+
+// SetBinaryEntrypoints sets the names of the files getting a py_binary like
+// the ones with a __main__ guard.
+func (c *Config) SetBinaryEntrypoints(names []string) {
+	c.binaryEntrypoints = names
+}
+
+// IsBinaryEntrypoint returns whether the file, whatever its directory, gets a
+// py_binary like the ones with a __main__ guard.
+func (c *Config) IsBinaryEntrypoint(file string) bool {
+	name := path.Base(file)
+	for _, entrypoint := range c.binaryEntrypoints {
+		if entrypoint == name {
+			return true
+		}
+	}
+	return false
+}
+
+// SetGenerateCython sets whether the Cython sources get a pyx_library.
+func (c *Config) SetGenerateCython(generateCython bool) {
+	c.generateCython = generateCython
+}
+
+// GenerateCython returns whether the Cython sources get a pyx_library.
+func (c *Config) GenerateCython() bool {
+	return c.generateCython
+}
+
+// SetCoarseGrainedFacade sets whether the package pkg is a facade, see
+// CoarseGrainedFacade.
+func (c *Config) SetCoarseGrainedFacade(pkg string, facade bool) {
+	c.facadePackage = pkg
+	c.facade = facade
+}
+
+// FacadePackage returns the facade package of the current package, and
+// whether there's one, in project generation mode only.
+func (c *Config) FacadePackage() (string, bool) {
+	if !c.facade || !c.coarseGrainedGeneration {
+		return "", false
+	}
+	return c.facadePackage, true
+}
+
+// AddExcludeRegex adds a regular expression of the paths of the files
+// excluded from the generation. It also applies to the subpackages.
+func (c *Config) AddExcludeRegex(re *regexp.Regexp) {
+	regexes := make([]*regexp.Regexp, 0, len(c.excludeRegexes)+1)
+	regexes = append(regexes, c.excludeRegexes...)
+	c.excludeRegexes = append(regexes, re)
+}
+
+// ResetExcludeRegexes removes the regular expressions of the paths of the
+// files excluded from the generation, e.g. for a subtree.
+func (c *Config) ResetExcludeRegexes() {
+	c.excludeRegexes = nil
+}
+
+// ExcludesPath returns whether the file at the given path, relative to the
+// repository root, is excluded from the generation by python_exclude_regex.
+func (c *Config) ExcludesPath(path string) bool {
+	for _, re := range c.excludeRegexes {
+		if re.MatchString(path) {
+			return true
+		}
+	}
+	return false
+}
+
+// IsPytestMarkerTag returns whether the tag is one of the tags of the mapped
+// pytest markers.
+func (c *Config) IsPytestMarkerTag(tag string) bool {
+	for _, marker := range c.pytestMarkers {
+		for _, t := range marker.Tags {
+			if t == tag {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// HasPytestMarkers returns whether any pytest marker is mapped.
+func (c *Config) HasPytestMarkers() bool {
+	return len(c.pytestMarkers) > 0
+}
+
 // SetLabelConvention sets the label convention used for third-party dependencies.
 func (c *Config) SetLabelConvention(convention string) {
 	c.labelConvention = convention
@@ -651,6 +2521,124 @@ func (c *Config) IncludeAncestorConftest() bool {
 	return c.includeAncestorConftest
 }
 
+// SetImplicitNamespacePackages sets whether the Python packages may omit their
+// __init__.py files.
+func (c *Config) SetImplicitNamespacePackages(implicitNamespacePackages bool) {
+	c.implicitNamespacePackages = implicitNamespacePackages
+}
+
+// ImplicitNamespacePackages returns whether the Python packages may omit their
+// __init__.py files.
+func (c *Config) ImplicitNamespacePackages() bool {
+	return c.implicitNamespacePackages
+}
+
+// SetResolveAncestorPackage sets whether the imports that no target provides
+// are resolved to the target of their deepest ancestor package.
+func (c *Config) SetResolveAncestorPackage(resolveAncestorPackage bool) {
+	c.resolveAncestorPkg = resolveAncestorPackage
+}
+
+// ResolveAncestorPackage returns whether the imports that no target provides
+// are resolved to the target of their deepest ancestor package.
+func (c *Config) ResolveAncestorPackage() bool {
+	return c.resolveAncestorPkg
+}
+
+// SetPythonVersion sets the minor version of Python 3 targeted, e.g. 11 for
+// Python 3.11.
+func (c *Config) SetPythonVersion(minor int) {
+	c.pythonVersion = minor
+}
+
+// PythonVersion returns the minor version of Python 3 targeted, or 0 when
+// it's unset and the embedded list of standard modules is used as is.
+func (c *Config) PythonVersion() int {
+	return c.pythonVersion
+}
+
+// SetResolveStringAnnotations sets whether the dotted names of the string
+// annotations are resolved as type-checking only imports.
+func (c *Config) SetResolveStringAnnotations(resolveStringAnnotations bool) {
+	c.resolveStringAnnotations = resolveStringAnnotations
+}
+
+// ResolveStringAnnotations returns whether the dotted names of the string
+// annotations are resolved as type-checking only imports.
+func (c *Config) ResolveStringAnnotations() bool {
+	return c.resolveStringAnnotations
+}
+
+// SetFlattenSubpackages sets whether the Python files of the descendant
+// directories without a BUILD file belong to the target of the nearest Bazel
+// package.
+func (c *Config) SetFlattenSubpackages(flattenSubpackages bool) {
+	c.flattenSubpackages = flattenSubpackages
+}
+
+// FlattenSubpackages returns whether the Python files of the descendant
+// directories without a BUILD file belong to the target of the nearest Bazel
+// package. It only applies to the package generation mode.
+func (c *Config) FlattenSubpackages() bool {
+	return c.flattenSubpackages && !c.coarseGrainedGeneration && !c.perFileGeneration
+}
+
+// SetFoldSubdirs sets whether the Python files of the descendant directories
+// without a BUILD file nor an __init__.py file belong to the target of the
+// nearest Python package.
+func (c *Config) SetFoldSubdirs(foldSubdirs bool) {
+	c.foldSubdirs = foldSubdirs
+}
+
+// FoldSubdirs returns whether the Python files of the descendant directories
+// without a BUILD file nor an __init__.py file belong to the target of the
+// nearest Python package. It only applies to the package generation mode.
+func (c *Config) FoldSubdirs() bool {
+	return c.foldSubdirs && !c.coarseGrainedGeneration && !c.perFileGeneration
+}
+
+// SetInitFilesMode sets how the missing __init__.py files of the Python
+// packages are created.
+func (c *Config) SetInitFilesMode(initFilesMode InitFilesModeType) {
+	c.initFilesMode = initFilesMode
+}
+
+// InitFilesMode returns how the missing __init__.py files of the Python
+// packages are created.
+func (c *Config) InitFilesMode() InitFilesModeType {
+	return c.initFilesMode
+}
+
+// SetTestRunner sets the test runner of the generated py_test targets and the
+// arguments passed to it.
+func (c *Config) SetTestRunner(testRunner TestRunnerType, args []string) {
+	c.testRunner = testRunner
+	c.testRunnerArgs = args
+}
+
+// TestRunner returns the test runner of the generated py_test targets.
+func (c *Config) TestRunner() TestRunnerType {
+	return c.testRunner
+}
+
+// TestRunnerArgs returns the arguments passed to the test runner, e.g.
+// "--import-mode=importlib".
+func (c *Config) TestRunnerArgs() []string {
+	return c.testRunnerArgs
+}
+
+// SetGenerateDepsFile sets whether the deps and pyi_deps of the generated
+// targets are written to a py_deps.bzl file in their package.
+func (c *Config) SetGenerateDepsFile(generateDepsFile bool) {
+	c.generateDepsFile = generateDepsFile
+}
+
+// GenerateDepsFile returns whether the deps and pyi_deps of the generated
+// targets are written to a py_deps.bzl file in their package.
+func (c *Config) GenerateDepsFile() bool {
+	return c.generateDepsFile
+}
+
 // FormatThirdPartyDependency returns a label to a third-party dependency performing all formating and normalization.
 func (c *Config) FormatThirdPartyDependency(repositoryName string, distributionName string) label.Label {
 	conventionalDistributionName := strings.ReplaceAll(c.labelConvention, distributionNameLabelConventionSubstitution, distributionName)
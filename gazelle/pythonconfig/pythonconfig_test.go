@@ -1,7 +1,13 @@
 package pythonconfig
 
 import (
+	"reflect"
+	"regexp"
 	"testing"
+
+	"github.com/bazelbuild/bazel-gazelle/label"
+
+	"github.com/bazel-contrib/rules_python/gazelle/manifest"
 )
 
 func TestFormatThirdPartyDependency(t *testing.T) {
@@ -280,3 +286,353 @@ func TestConfigsMap(t *testing.T) {
 		}
 	})
 }
+
+func TestPackageVisibility(t *testing.T) {
+	c := New("root/dir", "")
+	c.SetDefaultVisibility([]string{"//$python_root$:__subpackages__", "//tests/$package$:__pkg__"})
+	c.AppendVisibility("//tools:__pkg__")
+	c.SetPythonProjectRoot("proj")
+
+	got := c.PackageVisibility("proj/lib")
+	want := []string{"//proj:__subpackages__", "//tests/proj/lib:__pkg__", "//tools:__pkg__"}
+	if len(got) != len(want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Fatalf("expected %v, got %v", want, got)
+		}
+	}
+
+	if !HasVisibilityPlaceholder(c.DefaultVisibilty()) {
+		t.Fatal("expected a placeholder in the default visibility")
+	}
+	if HasVisibilityPlaceholder([]string{"//tools:__pkg__"}) {
+		t.Fatal("expected no placeholder")
+	}
+}
+
+func TestDistributionModules(t *testing.T) {
+	root := New("root/dir", "")
+	root.SetGazelleManifest(&manifest.Manifest{
+		ModulesMapping: manifest.ModulesMapping{
+			"google.protobuf":         "protobuf",
+			"google.protobuf.message": "protobuf",
+			"requests":                "requests",
+			"six":                     "six",
+		},
+	})
+	child := root.NewChild()
+	child.SetGazelleManifest(&manifest.Manifest{
+		ModulesMapping: manifest.ModulesMapping{
+			"_yaml":         "PyYAML",
+			"six":           "six-fork",
+			"yaml":          "PyYAML",
+			"yaml.composer": "PyYAML",
+		},
+	})
+
+	got := child.DistributionModules()
+	want := map[string][]string{
+		"PyYAML":   {"_yaml", "yaml"},
+		"protobuf": {"google.protobuf"},
+		"requests": {"requests"},
+		"six-fork": {"six"},
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestFindThirdPartyPrefix(t *testing.T) {
+	root := New("root/dir", "")
+	root.SetGazelleManifest(&manifest.Manifest{
+		ModulesMapping: manifest.ModulesMapping{
+			"mycorp.vendor.pinned": "pinned",
+		},
+		PipRepository: &manifest.PipRepository{Name: "pip"},
+	})
+	root.AddThirdPartyPrefix("mycorp.vendor", "@vendored//:%{module}", "")
+	child := root.NewChild()
+	child.AddThirdPartyPrefix("mycorp.vendor.special", ":special", "third_party")
+
+	tests := []struct {
+		modName string
+		want    string
+		ok      bool
+	}{
+		{modName: "mycorp.vendor.foo", want: "@vendored//:foo", ok: true},
+		{modName: "mycorp.vendor.foo.bar", want: "@vendored//:foo", ok: true},
+		{modName: "mycorp.vendor.special.sub", want: "//third_party:special", ok: true},
+		{modName: "mycorp.vendor.pinned", want: "@pip//pinned", ok: true},
+		{modName: "mycorp.vendor.pinned.sub"},
+		{modName: "mycorp.vendor"},
+		{modName: "mycorp.vendored"},
+	}
+	for _, tt := range tests {
+		got, distributionName, ok := child.FindThirdPartyDependency(tt.modName)
+		if ok != tt.ok || got != tt.want {
+			t.Errorf("%s: expected %q, %v, got %q, %v", tt.modName, tt.want, tt.ok, got, ok)
+		}
+		if ok && tt.modName != "mycorp.vendor.pinned" && distributionName != "" {
+			t.Errorf("%s: expected no distribution, got %q", tt.modName, distributionName)
+		}
+	}
+	if got, _, ok := root.FindThirdPartyDependency("mycorp.vendor.special.sub"); !ok || got != "@vendored//:special" {
+		t.Errorf("expected the parent config to ignore the prefix of the child, got %q", got)
+	}
+}
+
+func TestFindOpaqueLibrary(t *testing.T) {
+	root := New("root/dir", "")
+	child := root.NewChild()
+	child.AddOpaqueLibrary("foo", label.New("", "third_party/foo", "foo"))
+	child.AddOpaqueLibrary("foo.bar", label.New("", "third_party/foo/bar", "bar"))
+
+	tests := []struct {
+		modName string
+		want    string
+		module  string
+	}{
+		{modName: "foo", want: "//third_party/foo", module: "foo"},
+		{modName: "foo.core", want: "//third_party/foo", module: "foo"},
+		{modName: "foo.bar.baz", want: "//third_party/foo/bar", module: "foo.bar"},
+		{modName: "foobar"},
+		{modName: "bar.foo"},
+	}
+	for _, tt := range tests {
+		// The opaque libraries are shared by all the packages.
+		got, module, ok := root.FindOpaqueLibrary(tt.modName)
+		if ok != (tt.want != "") || (ok && got.String() != tt.want) || module != tt.module {
+			t.Errorf("%s: expected %q, %q, got %q, %q, %v", tt.modName, tt.want, tt.module, got, module, ok)
+		}
+	}
+	for pkg, want := range map[string]bool{
+		"third_party/foo":     true,
+		"third_party/foo/sub": true,
+		"third_party/foobar":  false,
+		"third_party":         false,
+		"app/third_party/foo": false,
+	} {
+		if got := root.IsOpaquePackage(pkg); got != want {
+			t.Errorf("%s: expected %v, got %v", pkg, want, got)
+		}
+	}
+}
+
+func TestFindWildcardResolve(t *testing.T) {
+	root := New("root/dir", "")
+	root.SetWildcardResolve("foo", label.New("", "lib", "foo"))
+	child := root.NewChild()
+	child.SetWildcardResolve("foo.bar", label.New("", "lib", "bar"))
+
+	tests := []struct {
+		modName string
+		want    string
+		prefix  string
+	}{
+		{modName: "foo", want: "//lib:foo", prefix: "foo"},
+		{modName: "foo.core", want: "//lib:foo", prefix: "foo"},
+		{modName: "foo.bar", want: "//lib:bar", prefix: "foo.bar"},
+		{modName: "foo.bar.baz.qux", want: "//lib:bar", prefix: "foo.bar"},
+		{modName: "foobar"},
+		{modName: "bar.foo"},
+	}
+	for _, tt := range tests {
+		got, prefix, ok := child.FindWildcardResolve(tt.modName)
+		if ok != (tt.want != "") || (ok && got.String() != tt.want) || prefix != tt.prefix {
+			t.Errorf("%s: expected %q, %q, got %q, %q, %v", tt.modName, tt.want, tt.prefix, got, prefix, ok)
+		}
+	}
+	// The directives of the subpackages don't apply to the parents.
+	if got, _, _ := root.FindWildcardResolve("foo.bar.baz"); got.String() != "//lib:foo" {
+		t.Errorf("foo.bar.baz: expected %q in the root, got %q", "//lib:foo", got)
+	}
+}
+
+func TestFindDeclaredDistribution(t *testing.T) {
+	root := New("root/dir", "")
+	root.AddDeclaredDistributions("pypi", []string{"requests", "Typing.Extensions"})
+	child := root.NewChild()
+	child.AddDeclaredDistributions("internal", []string{"requests", "attrs"})
+
+	tests := []struct {
+		cfg          *Config
+		modName      string
+		want         string
+		distribution string
+	}{
+		{cfg: root, modName: "requests", want: "@pypi//requests", distribution: "requests"},
+		{cfg: root, modName: "typing_extensions", want: "@pypi//typing_extensions", distribution: "Typing.Extensions"},
+		{cfg: root, modName: "attrs"},
+		{cfg: child, modName: "requests", want: "@internal//requests", distribution: "requests"},
+		{cfg: child, modName: "typing_extensions", want: "@pypi//typing_extensions", distribution: "Typing.Extensions"},
+		{cfg: child, modName: "attrs", want: "@internal//attrs", distribution: "attrs"},
+		{cfg: child, modName: "requests.adapters"},
+	}
+	for _, tt := range tests {
+		got, distribution, ok := tt.cfg.FindThirdPartyDependency(tt.modName)
+		if ok != (tt.want != "") || got != tt.want || distribution != tt.distribution {
+			t.Errorf("%s: expected %q, %q, got %q, %q, %v", tt.modName, tt.want, tt.distribution, got, distribution, ok)
+		}
+	}
+}
+
+func TestInputFiles(t *testing.T) {
+	root := New("root/dir", "")
+	root.SetGazelleManifestPath("root/dir/gazelle_python.yaml")
+	root.SetPyprojectPath("root/dir/pyproject.toml")
+	child := root.NewChild()
+	child.SetGazelleManifestPath("root/dir/pkg/gazelle_python.yaml")
+
+	want := []string{"root/dir/gazelle_python.yaml", "root/dir/pyproject.toml"}
+	if got := root.InputFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v in the root, got %v", want, got)
+	}
+	// The pyproject.toml file isn't inherited, every package reads its own.
+	want = []string{"root/dir/pkg/gazelle_python.yaml"}
+	if got := child.InputFiles(); !reflect.DeepEqual(got, want) {
+		t.Errorf("expected %v in the child, got %v", want, got)
+	}
+}
+
+func TestTypeStubModules(t *testing.T) {
+	c := New("root/dir", "")
+	got := c.TypeStubModules("Django")
+	want := []string{"django_stubs", "django_types", "types_django", "stubs_django"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+
+	c.SetTypeStubPattern([]string{"$distribution_name$-stubs", "mycorp.$distribution_name$.typing"})
+	got = c.TypeStubModules("google-cloud")
+	want = []string{"google_cloud_stubs", "mycorp_google_cloud_typing"}
+	if !reflect.DeepEqual(got, want) {
+		t.Fatalf("expected %v, got %v", want, got)
+	}
+}
+
+func TestIsTestonlyPackage(t *testing.T) {
+	c := New("root/dir", "")
+	if c.IsTestonlyPackage("tests") {
+		t.Fatal("expected no testonly package without python_testonly_dirs")
+	}
+	c.SetTestonlyDirs([]string{"tests", "testing"})
+	tests := map[string]bool{
+		"":                  false,
+		"tests":             true,
+		"tests/helpers":     true,
+		"src/testing":       true,
+		"src/contest":       false,
+		"src/tests_helpers": false,
+	}
+	for rel, want := range tests {
+		if got := c.IsTestonlyPackage(rel); got != want {
+			t.Errorf("%q: expected %v, got %v", rel, want, got)
+		}
+	}
+}
+
+func TestExcludesPath(t *testing.T) {
+	c := New("root/dir", "")
+	if c.ExcludesPath("pkg/foo_flymake.py") {
+		t.Fatal("expected no excluded path without python_exclude_regex")
+	}
+	c.AddExcludeRegex(regexp.MustCompile(`_flymake\.py$`))
+	child := c.NewChild()
+	child.AddExcludeRegex(regexp.MustCompile(`_version_template\.py$`))
+	tests := map[string]bool{
+		"pkg/foo_flymake.py":           true,
+		"pkg/_version_template.py":     true,
+		"pkg/foo.py":                   false,
+		"pkg/flymake.py":               false,
+		"pkg/sub/bar_flymake.py":       true,
+		"pkg/_version_template.py.bak": false,
+	}
+	for path, want := range tests {
+		if got := child.ExcludesPath(path); got != want {
+			t.Errorf("%q: expected %v, got %v", path, want, got)
+		}
+	}
+	if c.ExcludesPath("pkg/_version_template.py") {
+		t.Error("expected the expressions of the child not to apply to the parent")
+	}
+	child.ResetExcludeRegexes()
+	if child.ExcludesPath("pkg/foo_flymake.py") {
+		t.Error("expected no excluded path after a reset")
+	}
+}
+
+func TestWrapperMacros(t *testing.T) {
+	c := New("root/dir", "")
+	if _, ok := c.WrapperMacroOfKind("py_library"); ok {
+		t.Fatal("expected no wrapper macro without python_wrapper_macro")
+	}
+	c.AddWrapperMacro(WrapperMacroInfo{Kind: "py_library", Macro: "my_py_library", Load: "//tools:py.bzl"})
+	c.AddWrapperMacro(WrapperMacroInfo{Kind: "py_test", Macro: "my_py_test", Load: "//tools:py.bzl"})
+	child := c.NewChild()
+	child.AddWrapperMacro(WrapperMacroInfo{
+		Kind:  "py_library",
+		Macro: "other_py_library",
+		Load:  "//tools:other.bzl",
+		Attrs: map[string]string{"srcs": "sources"},
+	})
+	if macro, ok := child.WrapperMacroOfKind("py_library"); !ok || macro.Macro != "other_py_library" {
+		t.Errorf("expected the macro of the child to replace the one of the parent, got %v", macro)
+	}
+	if _, ok := child.WrapperMacro("my_py_library"); ok {
+		t.Error("expected the replaced macro to be removed")
+	}
+	if macro, ok := child.WrapperMacro("my_py_test"); !ok || macro.Kind != "py_test" {
+		t.Errorf("expected the macro of the parent to be inherited, got %v", macro)
+	}
+	if macro, ok := c.WrapperMacroOfKind("py_library"); !ok || macro.Macro != "my_py_library" {
+		t.Errorf("expected the macros of the child not to apply to the parent, got %v", macro)
+	}
+	macro, _ := child.WrapperMacro("other_py_library")
+	if got := macro.Attr("srcs"); got != "sources" {
+		t.Errorf("expected srcs to be named sources, got %q", got)
+	}
+	if got := macro.Attr("deps"); got != "deps" {
+		t.Errorf("expected deps to keep its name, got %q", got)
+	}
+}
+
+func TestIsBinaryEntrypoint(t *testing.T) {
+	c := New("root/dir", "")
+	if c.IsBinaryEntrypoint("main.py") {
+		t.Fatal("expected no binary entry point without python_binary_entrypoints")
+	}
+	c.SetBinaryEntrypoints([]string{"main.py", "cli.py"})
+	tests := map[string]bool{
+		"main.py":     true,
+		"cmd/cli.py":  true,
+		"app.py":      false,
+		"my_main.py":  false,
+		"main.py.bak": false,
+	}
+	for file, want := range tests {
+		if got := c.NewChild().IsBinaryEntrypoint(file); got != want {
+			t.Errorf("%q: expected %v, got %v", file, want, got)
+		}
+	}
+}
+
+func TestFoldSubdirs(t *testing.T) {
+	c := New("root/dir", "")
+	c.SetFoldSubdirs(true)
+	child := c.NewChild()
+	if !child.FoldSubdirs() {
+		t.Fatal("expected the child to fold its loose subdirectories")
+	}
+	perFile := child.NewChild()
+	perFile.SetPerFileGeneration(true)
+	if perFile.FoldSubdirs() {
+		t.Error("expected no folding in the file generation mode")
+	}
+	project := child.NewChild()
+	project.SetCoarseGrainedGeneration(true)
+	if project.FoldSubdirs() {
+		t.Error("expected no folding in the project generation mode")
+	}
+}
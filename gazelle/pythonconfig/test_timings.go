@@ -0,0 +1,59 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/ghodss/yaml"
+)
+
+// TestTimings represents the file pointed to by the python_test_timings_file
+// directive. It records the duration of the test files, e.g. exported from
+// the CI, to balance the shards of the test targets.
+type TestTimings struct {
+	// Seconds maps the paths of the test files, relative to the repository
+	// root, to their duration in seconds.
+	Seconds map[string]float64 `json:"seconds"`
+}
+
+// LoadTestTimings parses and validates the YAML or JSON timings file at the
+// given path.
+func LoadTestTimings(path string) (*TestTimings, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load test timings file: %w", err)
+	}
+	testTimings, err := ParseTestTimings(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load test timings file %q: %w", path, err)
+	}
+	return testTimings, nil
+}
+
+// ParseTestTimings parses and validates the YAML or JSON timings content.
+func ParseTestTimings(data []byte) (*TestTimings, error) {
+	testTimings := new(TestTimings)
+	if err := yaml.Unmarshal(data, testTimings); err != nil {
+		return nil, err
+	}
+	for file, seconds := range testTimings.Seconds {
+		if seconds < 0 {
+			return nil, fmt.Errorf("test file %q has a negative duration %v", file, seconds)
+		}
+	}
+	return testTimings, nil
+}
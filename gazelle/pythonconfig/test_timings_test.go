@@ -0,0 +1,31 @@
+package pythonconfig
+
+import (
+	"testing"
+)
+
+func TestParseTestTimings(t *testing.T) {
+	testTimings, err := ParseTestTimings([]byte(`{"seconds": {"app/a_test.py": 12.5, "app/b_test.py": 3}}`))
+	if err != nil {
+		t.Fatalf("ParseTestTimings() error: %v", err)
+	}
+	if got := testTimings.Seconds["app/a_test.py"]; got != 12.5 {
+		t.Errorf(`Seconds["app/a_test.py"] = %v, want 12.5`, got)
+	}
+	if got, ok := testTimings.Seconds["app/c_test.py"]; ok {
+		t.Errorf(`Seconds["app/c_test.py"] = %v, want none`, got)
+	}
+}
+
+func TestParseTestTimingsErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"negative duration": "seconds:\n  app/a_test.py: -1\n",
+		"invalid duration":  "seconds:\n  app/a_test.py: slow\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseTestTimings([]byte(content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
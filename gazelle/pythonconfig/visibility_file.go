@@ -0,0 +1,106 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+
+	"github.com/bmatcuk/doublestar/v4"
+	"github.com/ghodss/yaml"
+)
+
+// VisibilityFilename is the name of the file at the root of the repository
+// mapping the packages to the visibility of their generated targets.
+const VisibilityFilename = "python-visibility.yaml"
+
+// VisibilityFile represents the python-visibility.yaml file of the repository.
+// The targets generated in a package matching one of its rules get the
+// visibility of the rule instead of the default visibility, so that it doesn't
+// have to be declared by each package.
+type VisibilityFile struct {
+	// Rules is the ordered list of rules. The first rule matching a package
+	// applies.
+	Rules []VisibilityRule `json:"rules"`
+}
+
+// VisibilityRule gives a visibility to the targets of the packages matching
+// one of its globs.
+type VisibilityRule struct {
+	// Packages is the list of globs of the packages, relative to the
+	// repository root, e.g. "services/**".
+	Packages []string `json:"packages"`
+	// Visibility is the list of labels of the visibility, which can contain
+	// the $python_root$ and $package$ placeholders.
+	Visibility []string `json:"visibility"`
+}
+
+// LoadVisibilityFile parses and validates the python-visibility.yaml file of
+// the repository rooted at repoRoot. It returns nil when the repository
+// doesn't have one.
+func LoadVisibilityFile(repoRoot string) (*VisibilityFile, error) {
+	path := filepath.Join(repoRoot, VisibilityFilename)
+	data, err := os.ReadFile(path)
+	if errors.Is(err, fs.ErrNotExist) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to load visibility file: %w", err)
+	}
+	visibilityFile, err := ParseVisibilityFile(data)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load visibility file %q: %w", path, err)
+	}
+	return visibilityFile, nil
+}
+
+// ParseVisibilityFile parses and validates the YAML or JSON visibility
+// content.
+func ParseVisibilityFile(data []byte) (*VisibilityFile, error) {
+	visibilityFile := new(VisibilityFile)
+	if err := yaml.Unmarshal(data, visibilityFile); err != nil {
+		return nil, err
+	}
+	for i, rule := range visibilityFile.Rules {
+		if len(rule.Packages) == 0 {
+			return nil, fmt.Errorf("rule %d has no packages", i)
+		}
+		for _, glob := range rule.Packages {
+			if !doublestar.ValidatePattern(glob) {
+				return nil, fmt.Errorf("rule %d has an invalid glob %q", i, glob)
+			}
+		}
+		if len(rule.Visibility) == 0 {
+			return nil, fmt.Errorf("rule %d has no visibility", i)
+		}
+	}
+	return visibilityFile, nil
+}
+
+// VisibilityForPackage returns the visibility of the first rule with a glob
+// matching the given package, and whether one was found.
+func (v *VisibilityFile) VisibilityForPackage(pkg string) ([]string, bool) {
+	for _, rule := range v.Rules {
+		for _, glob := range rule.Packages {
+			if ok, _ := doublestar.Match(glob, pkg); ok {
+				return rule.Visibility, true
+			}
+		}
+	}
+	return nil, false
+}
@@ -0,0 +1,87 @@
+package pythonconfig
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+const visibilityContent = `rules:
+  - packages: ["services/payments/**"]
+    visibility: ["//services/payments:__subpackages__"]
+  - packages: ["services/**", "tools"]
+    visibility: ["//visibility:public"]
+`
+
+func TestVisibilityForPackage(t *testing.T) {
+	visibilityFile, err := ParseVisibilityFile([]byte(visibilityContent))
+	if err != nil {
+		t.Fatalf("ParseVisibilityFile() error: %v", err)
+	}
+	for pkg, want := range map[string][]string{
+		"services/payments":     {"//services/payments:__subpackages__"},
+		"services/payments/api": {"//services/payments:__subpackages__"},
+		"services/search":       {"//visibility:public"},
+		"tools":                 {"//visibility:public"},
+		"tools/lint":            nil,
+		"":                      nil,
+	} {
+		got, ok := visibilityFile.VisibilityForPackage(pkg)
+		if ok != (want != nil) || !reflect.DeepEqual(got, want) {
+			t.Errorf("VisibilityForPackage(%q) = %v, %t, want %v", pkg, got, ok, want)
+		}
+	}
+}
+
+func TestParseVisibilityFileErrors(t *testing.T) {
+	for name, content := range map[string]string{
+		"no packages":   "rules:\n  - visibility: [\"//visibility:public\"]\n",
+		"invalid glob":  "rules:\n  - packages: [\"services/[\"]\n    visibility: [\"//visibility:public\"]\n",
+		"no visibility": "rules:\n  - packages: [\"services/**\"]\n",
+		"invalid rules": "rules: services\n",
+	} {
+		t.Run(name, func(t *testing.T) {
+			if _, err := ParseVisibilityFile([]byte(content)); err == nil {
+				t.Error("expected an error")
+			}
+		})
+	}
+}
+
+func TestLoadVisibilityFileMissingFile(t *testing.T) {
+	visibilityFile, err := LoadVisibilityFile(t.TempDir())
+	if err != nil {
+		t.Fatalf("LoadVisibilityFile() error: %v", err)
+	}
+	if visibilityFile != nil {
+		t.Errorf("LoadVisibilityFile() = %v, want nil", visibilityFile)
+	}
+}
+
+func TestPackageVisibilityFromFile(t *testing.T) {
+	dir := t.TempDir()
+	if err := os.WriteFile(filepath.Join(dir, VisibilityFilename), []byte(visibilityContent), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	visibilityFile, err := LoadVisibilityFile(dir)
+	if err != nil {
+		t.Fatalf("LoadVisibilityFile() error: %v", err)
+	}
+	root := New(dir, "")
+	root.SetVisibilityFile(visibilityFile)
+	root.AppendVisibility("//tests:__pkg__")
+
+	if got, want := root.PackageVisibility("services/search"), []string{"//visibility:public", "//tests:__pkg__"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PackageVisibility() = %v, want %v", got, want)
+	}
+	if got, want := root.PackageVisibility("lib"), []string{"//:__subpackages__", "//tests:__pkg__"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PackageVisibility() = %v, want %v", got, want)
+	}
+
+	declared := root.NewChild()
+	declared.DeclareDefaultVisibility([]string{"//services:__subpackages__"})
+	if got, want := declared.NewChild().PackageVisibility("services/search"), []string{"//services:__subpackages__", "//tests:__pkg__"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("PackageVisibility() = %v, want %v", got, want)
+	}
+}
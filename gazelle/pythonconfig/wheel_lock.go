@@ -0,0 +1,239 @@
+// Copyright 2023 The Bazel Authors. All rights reserved.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//     http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package pythonconfig
+
+import (
+	"fmt"
+	"os"
+	"regexp"
+	"strconv"
+	"strings"
+)
+
+// WheelLock represents the lock file pointed to by the python_wheel_lock_file
+// directive. Only the file names of the wheels and of the sdists it lists are
+// read, so that any lock file listing them works, e.g. uv.lock, pdm.lock or
+// poetry.lock.
+type WheelLock struct {
+	// Wheels maps the normalized names of the distributions to the tags of
+	// their wheels.
+	Wheels map[string][]WheelTags
+	// Sdists are the normalized names of the distributions with an sdist.
+	Sdists map[string]bool
+}
+
+// WheelTags are the compatibility tags of a wheel, see PEP 425. Each tag may
+// be a set of values, e.g. "py2.py3", split on the dots.
+type WheelTags struct {
+	Python   []string
+	ABI      []string
+	Platform []string
+}
+
+// WheelAvailability is the outcome of the installation of a distribution on
+// a target platform.
+type WheelAvailability string
+
+const (
+	// WheelAvailable is used when a wheel of the distribution is compatible
+	// with the target platform.
+	WheelAvailable WheelAvailability = "wheel"
+	// WheelSdistOnly is used when no wheel of the distribution is compatible
+	// with the target platform, so that it's built from its sdist.
+	WheelSdistOnly WheelAvailability = "sdist"
+	// WheelUnavailable is used when neither a wheel nor an sdist of the
+	// distribution is available for the target platform.
+	WheelUnavailable WheelAvailability = "unavailable"
+	// WheelUnknown is used when the distribution isn't in the lock file.
+	WheelUnknown WheelAvailability = "unknown"
+)
+
+var (
+	// wheelFileRe matches the file names of the wheels, see PEP 427:
+	// {distribution}-{version}(-{build tag})?-{python tag}-{abi tag}-{platform tag}.whl
+	wheelFileRe = regexp.MustCompile(`([A-Za-z0-9_.]+)-[A-Za-z0-9_.!+]+(?:-[0-9][A-Za-z0-9_]*)?-([A-Za-z0-9_.]+)-([A-Za-z0-9_.]+)-([A-Za-z0-9_.]+)\.whl`)
+	// sdistFileRe matches the file names of the sdists.
+	sdistFileRe = regexp.MustCompile(`([A-Za-z0-9][A-Za-z0-9_.-]*?)-[0-9][A-Za-z0-9_.!+]*\.(?:tar\.gz|zip)\b`)
+	// distributionNameSeparatorRe matches the separators normalized by
+	// NormalizeDistributionName and AddDeclaredDistributions.
+	distributionNameSeparatorRe = regexp.MustCompile(`[-_.]+`)
+	// linuxPlatformRe matches the manylinux and musllinux platform tags.
+	linuxPlatformRe = regexp.MustCompile(`^(manylinux|musllinux)_([0-9]+)_([0-9]+)_(.+)$`)
+	// macosPlatformRe matches the macOS platform tags.
+	macosPlatformRe = regexp.MustCompile(`^macosx_([0-9]+)_([0-9]+)_(.+)$`)
+	// cpythonTagRe matches the CPython tags of a target platform, e.g. cp311.
+	cpythonTagRe = regexp.MustCompile(`^cp3([0-9]+)$`)
+)
+
+// legacyManylinuxTags maps the legacy manylinux platform tags to their
+// glibc version, see PEP 600.
+var legacyManylinuxTags = map[string]string{
+	"manylinux1":    "manylinux_2_5",
+	"manylinux2010": "manylinux_2_12",
+	"manylinux2014": "manylinux_2_17",
+}
+
+// NormalizeDistributionName normalizes the name of a distribution, see PEP
+// 503, so that e.g. "Foo_Bar" and "foo-bar" are the same.
+func NormalizeDistributionName(name string) string {
+	return distributionNameSeparatorRe.ReplaceAllString(strings.ToLower(name), "-")
+}
+
+// LoadWheelLock reads the wheels and the sdists listed in the lock file at
+// the given path.
+func LoadWheelLock(path string) (*WheelLock, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to load wheel lock file: %w", err)
+	}
+	return ParseWheelLock(data), nil
+}
+
+// ParseWheelLock reads the wheels and the sdists listed in the lock file
+// content.
+func ParseWheelLock(data []byte) *WheelLock {
+	lock := &WheelLock{
+		Wheels: make(map[string][]WheelTags),
+		Sdists: make(map[string]bool),
+	}
+	for _, match := range wheelFileRe.FindAllStringSubmatch(string(data), -1) {
+		name := NormalizeDistributionName(match[1])
+		lock.Wheels[name] = append(lock.Wheels[name], WheelTags{
+			Python:   strings.Split(match[2], "."),
+			ABI:      strings.Split(match[3], "."),
+			Platform: strings.Split(match[4], "."),
+		})
+	}
+	for _, match := range sdistFileRe.FindAllStringSubmatch(string(data), -1) {
+		lock.Sdists[NormalizeDistributionName(match[1])] = true
+	}
+	return lock
+}
+
+// Availability returns how the distribution is installed on the target
+// platform.
+func (l *WheelLock) Availability(distribution string, platform TargetPlatform) WheelAvailability {
+	name := NormalizeDistributionName(distribution)
+	wheels, hasWheels := l.Wheels[name]
+	if !hasWheels && !l.Sdists[name] {
+		return WheelUnknown
+	}
+	for _, wheel := range wheels {
+		if wheel.CompatibleWith(platform) {
+			return WheelAvailable
+		}
+	}
+	if l.Sdists[name] {
+		return WheelSdistOnly
+	}
+	return WheelUnavailable
+}
+
+// TargetPlatform is a platform the distributions are installed on, declared
+// with the python_target_platforms directive as the CPython tag followed by
+// the platform tag, e.g. "cp311-manylinux_2_28_x86_64".
+type TargetPlatform struct {
+	Python   string
+	Platform string
+}
+
+// String returns the platform as declared in the directive.
+func (p TargetPlatform) String() string {
+	return p.Python + "-" + p.Platform
+}
+
+// ParseTargetPlatform parses a target platform, e.g.
+// "cp311-manylinux_2_28_x86_64".
+func ParseTargetPlatform(value string) (TargetPlatform, error) {
+	python, platform, ok := strings.Cut(value, "-")
+	if !ok || platform == "" || !cpythonTagRe.MatchString(python) {
+		return TargetPlatform{}, fmt.Errorf("invalid target platform %q: expected a CPython tag and a platform tag, e.g. cp311-manylinux_2_28_x86_64", value)
+	}
+	return TargetPlatform{Python: python, Platform: platform}, nil
+}
+
+// CompatibleWith returns whether the wheel can be installed on the target
+// platform: its Python and ABI tags accept the CPython version, e.g. py3,
+// cp311 or cp38-abi3 for cp311, and one of its platform tags is any, the
+// target one, or an older glibc, musl or macOS version of the same
+// architecture.
+func (w WheelTags) CompatibleWith(platform TargetPlatform) bool {
+	compatiblePlatform := false
+	for _, tag := range w.Platform {
+		if platformTagCompatible(tag, platform.Platform) {
+			compatiblePlatform = true
+		}
+	}
+	if !compatiblePlatform {
+		return false
+	}
+	target := cpythonMinor(platform.Python)
+	for _, python := range w.Python {
+		for _, abi := range w.ABI {
+			switch {
+			case abi == "none" && (python == "py3" || python == "py"+platform.Python[2:] || python == platform.Python):
+				return true
+			case abi == platform.Python && python == platform.Python:
+				return true
+			case abi == "abi3" && cpythonTagRe.MatchString(python) && cpythonMinor(python) <= target:
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// cpythonMinor returns the minor version of the CPython 3 tag, e.g. 11 for
+// cp311.
+func cpythonMinor(tag string) int {
+	minor, _ := strconv.Atoi(cpythonTagRe.FindStringSubmatch(tag)[1])
+	return minor
+}
+
+// platformTagCompatible returns whether a wheel with the platform tag can be
+// installed on the target platform tag.
+func platformTagCompatible(tag, target string) bool {
+	if tag == "any" || tag == target {
+		return true
+	}
+	for legacy, tagPrefix := range legacyManylinuxTags {
+		if arch, ok := strings.CutPrefix(tag, legacy+"_"); ok {
+			tag = tagPrefix + "_" + arch
+		}
+		if arch, ok := strings.CutPrefix(target, legacy+"_"); ok {
+			target = tagPrefix + "_" + arch
+		}
+	}
+	if m, t := linuxPlatformRe.FindStringSubmatch(tag), linuxPlatformRe.FindStringSubmatch(target); m != nil && t != nil {
+		return m[1] == t[1] && m[4] == t[4] && !versionAfter(m[2], m[3], t[2], t[3])
+	}
+	if m, t := macosPlatformRe.FindStringSubmatch(tag), macosPlatformRe.FindStringSubmatch(target); m != nil && t != nil {
+		archCompatible := m[3] == t[3] ||
+			(m[3] == "universal2" && (t[3] == "x86_64" || t[3] == "arm64")) ||
+			(m[3] == "intel" && t[3] == "x86_64")
+		return archCompatible && !versionAfter(m[1], m[2], t[1], t[2])
+	}
+	return false
+}
+
+// versionAfter returns whether the version major.minor is after the target
+// version.
+func versionAfter(major, minor, targetMajor, targetMinor string) bool {
+	m, _ := strconv.Atoi(major)
+	n, _ := strconv.Atoi(minor)
+	tm, _ := strconv.Atoi(targetMajor)
+	tn, _ := strconv.Atoi(targetMinor)
+	return m > tm || (m == tm && n > tn)
+}
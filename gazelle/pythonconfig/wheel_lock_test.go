@@ -0,0 +1,68 @@
+package pythonconfig
+
+import (
+	"testing"
+)
+
+func TestWheelLockAvailability(t *testing.T) {
+	lock := ParseWheelLock([]byte(`
+[[package]]
+name = "numpy"
+sdist = { url = "https://files.example.com/numpy-1.26.4.tar.gz" }
+wheels = [
+    { url = "https://files.example.com/numpy-1.26.4-cp311-cp311-manylinux_2_17_x86_64.manylinux2014_x86_64.whl" },
+    { url = "https://files.example.com/numpy-1.26.4-cp311-cp311-macosx_11_0_arm64.whl" },
+]
+
+[[package]]
+name = "cryptography"
+wheels = [
+    { url = "https://files.example.com/cryptography-42.0.5-cp39-abi3-musllinux_1_2_x86_64.whl" },
+    { url = "https://files.example.com/cryptography-42.0.5-cp39-abi3-macosx_10_12_universal2.whl" },
+]
+
+[[package]]
+name = "Typing_Extensions"
+wheels = [
+    { url = "https://files.example.com/typing_extensions-4.10.0-py3-none-any.whl" },
+]
+
+[[package]]
+name = "python-dateutil"
+sdist = { url = "https://files.example.com/python-dateutil-2.9.0.tar.gz" }
+`))
+	for _, tc := range []struct {
+		distribution string
+		platform     string
+		want         WheelAvailability
+	}{
+		{"numpy", "cp311-manylinux_2_28_x86_64", WheelAvailable},
+		{"numpy", "cp311-manylinux_2_12_x86_64", WheelSdistOnly},
+		{"numpy", "cp312-manylinux_2_28_x86_64", WheelSdistOnly},
+		{"numpy", "cp311-macosx_14_0_arm64", WheelAvailable},
+		{"numpy", "cp311-win_amd64", WheelSdistOnly},
+		{"cryptography", "cp312-musllinux_1_2_x86_64", WheelAvailable},
+		{"cryptography", "cp38-musllinux_1_2_x86_64", WheelUnavailable},
+		{"cryptography", "cp311-macosx_11_0_x86_64", WheelAvailable},
+		{"cryptography", "cp311-manylinux_2_28_x86_64", WheelUnavailable},
+		{"typing-extensions", "cp311-win_amd64", WheelAvailable},
+		{"python_dateutil", "cp311-win_amd64", WheelSdistOnly},
+		{"requests", "cp311-win_amd64", WheelUnknown},
+	} {
+		platform, err := ParseTargetPlatform(tc.platform)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if got := lock.Availability(tc.distribution, platform); got != tc.want {
+			t.Errorf("Availability(%q, %s) = %q, want %q", tc.distribution, tc.platform, got, tc.want)
+		}
+	}
+}
+
+func TestParseTargetPlatformErrors(t *testing.T) {
+	for _, value := range []string{"manylinux_2_28_x86_64", "py3-any", "cp311-"} {
+		if _, err := ParseTargetPlatform(value); err == nil {
+			t.Errorf("ParseTargetPlatform(%q): expected an error", value)
+		}
+	}
+}
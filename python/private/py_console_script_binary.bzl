@@ -48,8 +48,9 @@ def _dist_info(pkg):
 def py_console_script_binary(
         *,
         name,
-        pkg,
+        pkg = None,
         entry_points_txt = None,
+        entry_point = None,
         script = None,
         binary_rule = py_binary,
         shebang = "",
@@ -59,12 +60,21 @@ def py_console_script_binary(
 
     Args:
         name: {type}`Name` The name of the resulting target.
-        pkg: {type}`Label` the package for which to generate the script.
+        pkg: {type}`Label | None` the package for which to generate the script.
+            Required unless `entry_point` is given.
         entry_points_txt: {type}`label | None`, the entry_points.txt file to parse
             for available console_script values. It may be a single file, or a
             group of files, but must contain a file named `entry_points.txt`.
             If not specified, defaults to the `dist_info` target in the same
             package as the `pkg` Label.
+        entry_point: {type}`str | None`, the `module:attr` entry point to
+            generate the script for, e.g. one declared in the
+            `[project.scripts]` of a `pyproject.toml`. If given, no
+            `entry_points.txt` is read and the module is expected to be
+            provided by `deps`.
+
+            :::{versionadded} VERSION_NEXT_FEATURE
+            :::
         script: {type}`str`, The console script name that the py_binary is going to be
             generated for. Defaults to the normalized name attribute.
         main: {type}`str`, the python file to be generated, defaults to `<name>_entry_point.py` to
@@ -80,10 +90,16 @@ def py_console_script_binary(
 
     if kwargs.pop("srcs", None):
         fail("passing 'srcs' attribute to py_console_script_binary is unsupported")
+    if not pkg and not entry_point:
+        fail("either 'pkg' or 'entry_point' must be set for py_console_script_binary")
+
+    if not entry_point:
+        entry_points_txt = entry_points_txt or _dist_info(pkg)
 
     py_console_script_gen(
         name = name + "_gen__",
-        entry_points_txt = entry_points_txt or _dist_info(pkg),
+        entry_point = entry_point,
+        entry_points_txt = entry_points_txt,
         out = main,
         console_script = script,
         console_script_guess = name,
@@ -95,6 +111,6 @@ def py_console_script_binary(
         name = name,
         srcs = [main],
         main = main,
-        deps = [pkg] + kwargs.pop("deps", []),
+        deps = ([pkg] if pkg else []) + kwargs.pop("deps", []),
         **kwargs
     )
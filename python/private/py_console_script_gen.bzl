@@ -15,7 +15,8 @@
 """
 A private rule to generate an entry_point python file to be used in a py_binary.
 
-Right now it only supports console_scripts via the entry_points.txt file in the dist-info.
+Right now it only supports console_scripts via the entry_points.txt file in the dist-info
+or an explicitly given entry point.
 
 NOTE @aignas 2023-08-07: This cannot be in pure starlark, because we need to
 read a file and then create a `.py` file based on the contents of that file,
@@ -37,19 +38,24 @@ def _get_entry_points_txt(entry_points_txt):
     fail("{} does not contain {}".format(entry_points_txt, _ENTRY_POINTS_TXT))
 
 def _py_console_script_gen_impl(ctx):
-    entry_points_txt = _get_entry_points_txt(ctx.attr.entry_points_txt)
-
     args = ctx.actions.args()
     args.add("--console-script", ctx.attr.console_script)
     args.add("--console-script-guess", ctx.attr.console_script_guess)
     args.add("--shebang", ctx.attr.shebang)
-    args.add(entry_points_txt)
+
+    inputs = []
+    if ctx.attr.entry_point:
+        args.add("--entry-point", ctx.attr.entry_point)
+    elif ctx.attr.entry_points_txt:
+        entry_points_txt = _get_entry_points_txt(ctx.attr.entry_points_txt)
+        args.add(entry_points_txt)
+        inputs.append(entry_points_txt)
+    else:
+        fail("either 'entry_point' or 'entry_points_txt' must be set")
     args.add(ctx.outputs.out)
 
     ctx.actions.run(
-        inputs = [
-            entry_points_txt,
-        ],
+        inputs = inputs,
         outputs = [ctx.outputs.out],
         arguments = [args],
         mnemonic = "PyConsoleScriptBinaryGen",
@@ -74,9 +80,13 @@ py_console_script_gen = rule(
             default = "",
             mandatory = False,
         ),
+        "entry_point": attr.string(
+            doc = "The `module:attr` entry point to create the .py file for. If set, `entry_points_txt` is not read.",
+            default = "",
+        ),
         "entry_points_txt": attr.label(
             doc = "The filegroup to search for entry_points.txt.",
-            mandatory = True,
+            mandatory = False,
         ),
         "out": attr.output(
             doc = "Output file location.",
@@ -81,23 +81,12 @@ def _guess_entry_point(guess: str, console_scripts: dict[string, string]) -> str
             return candidate
 
 
-def run(
+def _find_entry_point(
     *,
     entry_points: pathlib.Path,
-    out: pathlib.Path,
     console_script: str,
     console_script_guess: str,
-    shebang: str,
-):
-    """Run the generator
-
-    Args:
-        entry_points: The entry_points.txt file to be parsed.
-        out: The output file.
-        console_script: The console_script entry in the entry_points.txt file.
-        console_script_guess: The string used for guessing the console_script if it is not provided.
-        shebang: The shebang to use for the entry point python file. Defaults to empty string (no shebang).
-    """
+) -> str:
     config = EntryPointsParser()
     config.read(entry_points)
 
@@ -130,6 +119,41 @@ def run(
                 f"Please select one of the following console scripts: {available}"
             ) from None
 
+    return entry_point
+
+
+def run(
+    *,
+    entry_points: pathlib.Path | None,
+    out: pathlib.Path,
+    console_script: str,
+    console_script_guess: str,
+    shebang: str,
+    entry_point: str = "",
+):
+    """Run the generator
+
+    Args:
+        entry_points: The entry_points.txt file to be parsed. Unused if the
+            entry_point is given.
+        out: The output file.
+        console_script: The console_script entry in the entry_points.txt file.
+        console_script_guess: The string used for guessing the console_script if it is not provided.
+        shebang: The shebang to use for the entry point python file. Defaults to empty string (no shebang).
+        entry_point: The `module:attr` entry point to generate the file for,
+            e.g. one declared in the `[project.scripts]` of a pyproject.toml.
+    """
+    if not entry_point:
+        if entry_points is None:
+            raise RuntimeError(
+                f"Either the {_ENTRY_POINTS_TXT} or the entry point must be given"
+            )
+        entry_point = _find_entry_point(
+            entry_points=entry_points,
+            console_script=console_script,
+            console_script_guess=console_script_guess,
+        )
+
     module, _, entry_point = entry_point.rpartition(":")
     attr, _, _ = entry_point.partition(".")
     # TODO: handle 'extras' in entry_point generation
@@ -162,9 +186,15 @@ def main():
         "--shebang",
         help="The shebang to use for the entry point python file.",
     )
+    parser.add_argument(
+        "--entry-point",
+        default="",
+        help="The 'module:attr' entry point to generate the file for. If given, the ENTRY_POINTS_TXT is not read.",
+    )
     parser.add_argument(
         "entry_points",
         metavar="ENTRY_POINTS_TXT",
+        nargs="?",
         type=pathlib.Path,
         help="The entry_points.txt within the dist-info of a PyPI wheel",
     )
@@ -182,6 +212,7 @@ def main():
         console_script=args.console_script,
         console_script_guess=args.console_script_guess,
         shebang=args.shebang,
+        entry_point=args.entry_point,
     )
 
 
@@ -226,6 +226,25 @@ class RunTest(unittest.TestCase):
 
         self.assertTrue(got.startswith(shebang + "\n"))
 
+    def test_explicit_entry_point(self):
+        with tempfile.TemporaryDirectory() as tmpdir:
+            tmpdir = pathlib.Path(tmpdir)
+            out = tmpdir / "foo.py"
+
+            run(
+                entry_points=None,
+                out=out,
+                console_script=None,
+                console_script_guess="foo",
+                shebang="",
+                entry_point="foo.bar:Bar.baz",
+            )
+
+            got = out.read_text()
+
+        self.assertRegex(got, "from foo\.bar import Bar")
+        self.assertRegex(got, "sys\.exit\(Bar\.baz\(\)\)")
+
 
 if __name__ == "__main__":
     unittest.main()